@@ -0,0 +1,125 @@
+// Copyright 2024, Pulumi Corporation.  All rights reserved.
+
+// The simulate command runs the stack controller over Stack manifests, with Pulumi replaced by the
+// results in a fixture, and prints the status and events each Stack ends up with. This is for
+// checking Stack manifests against a version of the operator without touching a cluster or a
+// cloud; see pkg/controller/stack/simulate.go for what is simulated.
+//
+//	simulate --fixture fixture.yaml --manifests stacks.yaml [--manifests secrets.yaml ...]
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/spf13/pflag"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/serializer"
+	utilyaml "k8s.io/apimachinery/pkg/util/yaml"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/yaml"
+
+	"github.com/pulumi/pulumi-kubernetes-operator/pkg/apis"
+	"github.com/pulumi/pulumi-kubernetes-operator/pkg/controller/stack"
+)
+
+func main() {
+	fixturePath := pflag.String("fixture", "", "file giving the simulated results for each stack")
+	manifests := pflag.StringSlice("manifests", nil, "files of Kubernetes objects (Stacks, and the Secrets, ConfigMaps and so on they refer to)")
+	maxPasses := pflag.Int("max-passes", 10, "the most times each Stack is reconciled")
+	pflag.Parse()
+
+	if err := run(*fixturePath, *manifests, *maxPasses, os.Stdout); err != nil {
+		fmt.Fprintf(os.Stderr, "simulate: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func run(fixturePath string, manifests []string, maxPasses int, out io.Writer) error {
+	if len(manifests) == 0 {
+		return errors.New("no manifests given")
+	}
+
+	scheme := runtime.NewScheme()
+	if err := clientgoscheme.AddToScheme(scheme); err != nil {
+		return err
+	}
+	if err := apis.AddToScheme(scheme); err != nil {
+		return err
+	}
+
+	var fixture stack.SimulationFixture
+	if fixturePath != "" {
+		b, err := os.ReadFile(fixturePath)
+		if err != nil {
+			return err
+		}
+		if err := yaml.UnmarshalStrict(b, &fixture); err != nil {
+			return fmt.Errorf("reading fixture %s: %w", fixturePath, err)
+		}
+	}
+
+	var objs []client.Object
+	for _, path := range manifests {
+		o, err := readObjects(scheme, path)
+		if err != nil {
+			return fmt.Errorf("reading manifests %s: %w", path, err)
+		}
+		objs = append(objs, o...)
+	}
+
+	sim, err := stack.NewSimulation(scheme, fixture, objs...)
+	if err != nil {
+		return err
+	}
+	report, err := sim.Run(context.Background(), maxPasses)
+	if err != nil {
+		return err
+	}
+	b, err := yaml.Marshal(report)
+	if err != nil {
+		return err
+	}
+	_, err = out.Write(b)
+	return err
+}
+
+// readObjects reads the objects in a file of YAML documents.
+func readObjects(scheme *runtime.Scheme, path string) ([]client.Object, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	decoder := serializer.NewCodecFactory(scheme).UniversalDeserializer()
+	reader := utilyaml.NewYAMLReader(bufio.NewReader(f))
+	var objs []client.Object
+	for {
+		doc, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			return objs, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if len(bytes.TrimSpace(doc)) == 0 {
+			continue
+		}
+		o, gvk, err := decoder.Decode(doc, nil, nil)
+		if err != nil {
+			return nil, err
+		}
+		obj, ok := o.(client.Object)
+		if !ok {
+			return nil, fmt.Errorf("%s is not an object", gvk)
+		}
+		objs = append(objs, obj)
+	}
+}
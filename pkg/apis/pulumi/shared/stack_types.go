@@ -7,6 +7,35 @@ import (
 
 const ReconcileRequestAnnotation = "pulumi.com/reconciliation-request"
 
+// PushWebhookRevisionAnnotation records the revision given by the last push webhook that requested
+// reconciliation of a stack.
+const PushWebhookRevisionAnnotation = "pulumi.com/push-webhook-revision"
+
+// VerifyRequestAnnotation is set on a stack by a stack that has it as a prerequisite with
+// `verify: Refresh`, to request that it verify its resources. The value is arbitrary; the value
+// last acted on is recorded in .status.verification.request.
+const VerifyRequestAnnotation = "pulumi.com/verify-request"
+
+// RotatedAtAnnotation may be put on a Secret to give the time (in RFC3339 format) its contents were
+// last rotated, for the purpose of CredentialMaxAge. It's needed where the Secret is written
+// regularly without its contents changing, so that its metadata doesn't say when it was rotated.
+const RotatedAtAnnotation = "pulumi.com/rotated-at"
+
+// DestroyApprovalAnnotation is put on a stack to approve its destroy, when
+// .spec.destroyOptions.approvalRequired is set; its value must be the ID of the preview of the
+// destroy given in .status.destroyProgress.approval.
+const DestroyApprovalAnnotation = "pulumi.com/approve-destroy"
+
+// SameNamespaceSecretsOnlyAnnotation may be put on a Namespace, with the value "true", to restrict
+// the Secrets the stacks in it can refer to to those in the same namespace.
+const SameNamespaceSecretsOnlyAnnotation = "pulumi.com/same-namespace-secrets-only"
+
+// These are the values of CredentialAgePolicy.
+const (
+	CredentialAgePolicyWarn   = "Warn"
+	CredentialAgePolicyRefuse = "Refuse"
+)
+
 // StackSpec defines the desired state of Pulumi Stack being managed by this operator.
 type StackSpec struct {
 	// Auth info:
@@ -24,6 +53,20 @@ type StackSpec struct {
 	// filesystem, or Kubernetes Secret) as values.
 	EnvRefs map[string]ResourceRef `json:"envRefs,omitempty"`
 
+	// (optional) EnvFrom is a list of Secrets and ConfigMaps, all of whose entries are set as
+	// environment variables, in the same way as for a container's envFrom. When a variable is set
+	// by more than one source, the last source listed takes precedence; a variable given in EnvRefs
+	// takes precedence over all of them. Entries with keys that are not valid environment variable
+	// names are skipped.
+	EnvFrom []EnvFromSource `json:"envFrom,omitempty"`
+
+	// (optional) DotEnvRefs is a list of references to the contents of dotenv files, i.e., lines of
+	// KEY=VALUE, for programs which read a .env file in their working directory rather than (or as
+	// well as) the environment. The contents are written, in order, to a .env file in the project
+	// directory before the program is run, replacing any .env file in the source, and the file is
+	// removed afterwards. The file can be read only by the operator's user.
+	DotEnvRefs []ResourceRef `json:"dotEnvRefs,omitempty"`
+
 	// (optional) SecretEnvs is an optional array of Secret names containing environment variables to set.
 	// Deprecated: use EnvRefs instead.
 	SecretEnvs []string `json:"envSecrets,omitempty"`
@@ -37,7 +80,26 @@ type StackSpec struct {
 	//   - Azure:                       "azblob://<my-pulumi-state-bucket>" <br/>
 	//   - GCP:                         "gs://<my-pulumi-state-bucket>" <br/>
 	// See: https://www.pulumi.com/docs/intro/concepts/state/
+	//
+	// The URL must not contain credentials; use BackendAuth to give them.
 	Backend string `json:"backend,omitempty"`
+	// (optional) BackendAuth gives options and credentials for the backend which can't be given
+	// safely in the Backend URL. These are used only when talking to the backend.
+	BackendAuth *BackendAuth `json:"backendAuth,omitempty"`
+	// (optional) CredentialMaxAge is the greatest age allowed of the Secrets in the stack's
+	// namespace that the stack takes credentials, environment variables or configuration from
+	// (e.g., "720h"). A Secret's age is taken from its pulumi.com/rotated-at annotation, when it has
+	// one, and otherwise from the last time its data was written. Secrets kept up to date by a
+	// controller which writes them without their contents changing (e.g., external-secrets) should
+	// have the annotation set when the credentials are actually rotated. When any of the Secrets is
+	// older, the CredentialsStale condition is set, and CredentialAgePolicy says what happens next.
+	CredentialMaxAge *metav1.Duration `json:"credentialMaxAge,omitempty"`
+	// (optional) CredentialAgePolicy gives what to do when a Secret is older than CredentialMaxAge:
+	// "Warn" (the default) runs the stack anyway, emitting a warning event; "Refuse" gives up on
+	// the stack, marking it as stalled with the reason CredentialsStale, and does not run it again
+	// until the stack or one of its Secrets is changed.
+	// +kubebuilder:validation:Enum=Warn;Refuse
+	CredentialAgePolicy string `json:"credentialAgePolicy,omitempty"`
 
 	// Stack identity:
 
@@ -45,7 +107,44 @@ type StackSpec struct {
 	Stack string `json:"stack"`
 	// (optional) Config is the configuration for this stack, which can be optionally specified inline. If this
 	// is omitted, configuration is assumed to be checked in and taken from the source repository.
+	// Configuration given in the spec is set over that checked in (in `Pulumi.<stack>.yaml`). Where
+	// a key is given by more than one field, its value is taken from the first of these that gives
+	// it: SecretRefs, Secrets, SecretsFrom, ConfigValues, Config, ConfigRefs, ConfigFrom.
 	Config map[string]string `json:"config,omitempty"`
+	// (optional) ConfigValues is configuration for this stack given inline, like Config, but with
+	// each value able to be marked as secret, so that it is encrypted by the stack's secrets
+	// provider. A key may not be given in both Config and ConfigValues.
+	// +optional
+	ConfigValues map[string]ConfigValue `json:"configValues,omitempty"`
+	// (optional) ConfigRefs is configuration for this stack whose values are loaded through
+	// ResourceRef; e.g., from environment variables, files or ConfigMaps. The values are set as
+	// plain (not secret) configuration. A key given in Config or ConfigValues as well takes its
+	// value from there, and a key given in SecretRefs, Secrets or SecretsFrom is set as secret.
+	// +optional
+	ConfigRefs map[string]ResourceRef `json:"configRefs,omitempty"`
+	// (optional) ConfigPath is structured configuration for this stack. Each key is a property
+	// path, as given to `pulumi config set --path`; e.g., `aws:defaultTags.tags.Team` or
+	// `app:hosts[0]`. The values may be any JSON value, and keep their types; e.g., a boolean is
+	// not made into a string. A path may not run through or into a key given in Config,
+	// ConfigRefs, Secrets or SecretRefs, nor into the value at another path.
+	// +optional
+	ConfigPath map[string]apiextensionsv1.JSON `json:"configPath,omitempty"`
+	// (optional) ConfigFrom is a list of ConfigMaps, all of whose entries are set as plain (not
+	// secret) configuration for this stack. When a key is given by more than one ConfigMap, the
+	// last one listed takes precedence; a key given in Config or ConfigRefs takes precedence over
+	// all of them. Since the keys of a ConfigMap can't contain a colon, a key without a Prefix
+	// (e.g., `aws:`) is taken to belong to the project. A change to any of the ConfigMaps has the
+	// stack updated again.
+	// +optional
+	ConfigFrom []ConfigFromSource `json:"configFrom,omitempty"`
+	// (optional) StackConfigFrom gives a ConfigMap key holding a stack settings file
+	// (`Pulumi.<stack>.yaml`), which is written into the project in place of (or merged into) the
+	// one checked in with the program, before the configuration given in the spec is set; so
+	// Config, ConfigRefs, Secrets, SecretRefs and the like take precedence over it. The keys it
+	// gives are treated as checked in by PruneConfig. A change to the ConfigMap has the stack
+	// updated again.
+	// +optional
+	StackConfigFrom *StackConfigSource `json:"stackConfigFrom,omitempty"`
 	// (optional) Secrets is the secret configuration for this stack, which can be optionally specified inline. If this
 	// is omitted, secrets configuration is assumed to be checked in and taken from the source repository.
 	// Deprecated: use SecretRefs instead.
@@ -54,6 +153,45 @@ type StackSpec struct {
 	// (optional) SecretRefs is the secret configuration for this stack which can be specified through ResourceRef.
 	// If this is omitted, secrets configuration is assumed to be checked in and taken from the source repository.
 	SecretRefs map[string]ResourceRef `json:"secretsRef,omitempty"`
+	// (optional) SecretsFrom is a list of Secrets, all of whose entries are set as secret
+	// configuration for this stack. When a key is given by more than one Secret, the last one
+	// listed takes precedence; a key given in Secrets or SecretRefs takes precedence over all of
+	// them. As with ConfigFrom, a key without a Prefix is taken to belong to the project. A change
+	// to any of the Secrets has the stack updated again.
+	// +optional
+	SecretsFrom []SecretsFromSource `json:"secretsFrom,omitempty"`
+	// (optional) PruneConfig, when true, makes the configuration given in the spec the source of
+	// truth for the stack's configuration: a key in the stack's configuration which isn't given by
+	// Config, ConfigValues, ConfigRefs, ConfigPath, ConfigFrom, Secrets, SecretRefs or SecretsFrom
+	// is removed, unless it's in the stack's settings file (`Pulumi.<stack>.yaml`) as checked in
+	// with the program, as found before the spec's configuration is applied. A key which is both
+	// checked in and given in the spec takes its value from the spec, and is never removed. The keys
+	// the operator introduces are recorded in `.status.configKeys`, so that one removed from the
+	// spec is also removed where the stack's settings outlive a single run (e.g., a projectPath that
+	// isn't copied). By default, keys are only ever set, so a key removed from the spec keeps its
+	// last value wherever the stack's settings outlive a single run.
+	// +optional
+	PruneConfig bool `json:"pruneConfig,omitempty"`
+	// (optional) Environments are the Pulumi ESC environments to attach to the stack, in order, as
+	// if listed in the `environment:` section of the stack's settings file. They are attached after
+	// any environments in the settings file as checked in, before the stack is refreshed, updated
+	// or destroyed. An environment removed from this list is detached. Environments need a backend
+	// which supports them, e.g., Pulumi Cloud; while an environment can't be found, the stack is
+	// marked as reconciling with the reason EnvironmentNotFound, and retried after a long wait.
+	// +optional
+	Environments []string `json:"environments,omitempty"`
+	// (optional) Tags are set on the stack in the backend each time the stack is processed, before
+	// it's updated, e.g., for cost attribution or search in Pulumi Cloud. A value can refer to the
+	// Stack object as `{{ .Namespace }}` and `{{ .Name }}`, e.g., `{{ .Namespace }}/{{ .Name }}`.
+	// Tags set by the operator are recorded in the status; one removed from this list is left on
+	// the stack unless PruneTags is set. Failing to set tags doesn't fail the stack; the error is
+	// given in `.status.tagsError`. With a backend which doesn't support tags, they are ignored.
+	// +optional
+	Tags map[string]string `json:"tags,omitempty"`
+	// (optional) PruneTags can be set to true to remove tags from the stack which the operator set,
+	// once they are removed from Tags. Tags set some other way are never removed.
+	// +optional
+	PruneTags bool `json:"pruneTags,omitempty"`
 	// (optional) SecretsProvider is used to initialize a Stack with alternative encryption.
 	// Examples:
 	//   - AWS:   "awskms:///arn:aws:kms:us-east-1:111122223333:key/1234abcd-12ab-34bc-56ef-1234567890ab?region=us-east-1"
@@ -61,7 +199,21 @@ type StackSpec struct {
 	//   - GCP:   "gcpkms://projects/MYPROJECT/locations/MYLOCATION/keyRings/MYKEYRING/cryptoKeys/MYKEY"
 	//
 	// See: https://www.pulumi.com/docs/intro/concepts/secrets/#initializing-a-stack-with-alternative-encryption
+	//
+	// Changing SecretsProvider for an existing stack moves it to the new provider, as `pulumi stack
+	// change-secrets-provider` does, before it's next updated; the change is recorded in
+	// .status.lastSecretsProviderChange. What's needed to decrypt with the old provider (e.g., the
+	// passphrase) must still be given until the change has succeeded.
 	SecretsProvider string `json:"secretsProvider,omitempty"`
+	// (optional) SecretsProviderPassphraseRef gives the passphrase for the passphrase secrets
+	// provider, which is used when SecretsProvider is "passphrase" (or not given, with a backend
+	// other than the Pulumi Cloud). It's set as PULUMI_CONFIG_PASSPHRASE for every Pulumi
+	// operation, including destroying the stack when it's deleted, taking precedence over any
+	// value given in EnvRefs. When SecretsProvider is "passphrase", the passphrase must be given
+	// here, or in envRefs, envFrom, envs or envSecrets. It may be given with another
+	// SecretsProvider while moving a stack off the passphrase provider.
+	// +optional
+	SecretsProviderPassphraseRef *ResourceRef `json:"secretsProviderPassphraseRef,omitempty"`
 
 	// Source control:
 
@@ -75,16 +227,47 @@ type StackSpec struct {
 	// ProgramRef refers to a Program object, to be used as the source for the stack.
 	ProgramRef *ProgramReference `json:"programRef,omitempty"`
 
+	// ProgramFrom gives an object holding the files of a project, to be used as the source for the
+	// stack.
+	// +optional
+	ProgramFrom *ProgramFromSource `json:"programFrom,omitempty"`
+
+	// (optional) Patches are unified diffs, as given by `git diff`, applied in order to the source
+	// once it has been fetched, e.g., to deploy an urgent fix before it can be merged. Paths are
+	// relative to the root of the source. A stack whose patches don't apply is stalled with the
+	// reason PatchFailed. The checksum of the patches is recorded in the status, and a warning
+	// event is emitted for each update run with patches, so that they are not forgotten.
+	// +optional
+	Patches []string `json:"patches,omitempty"`
+	// (optional) PersistWorkspace says whether the stack's workspace is kept between runs. By
+	// default, it is: a workspace checked out from a git source is brought up to date with a fetch
+	// rather than cloned afresh, and keeps the project's installed dependencies unless the
+	// dependency manifests (e.g., package-lock.json or requirements.txt) have changed; a workspace which can't
+	// be brought up to date is cloned afresh. Set it to false to have each run start from a clean
+	// workspace, e.g., to save disk space for a stack with a large repository.
+	// +optional
+	PersistWorkspace *bool `json:"persistWorkspace,omitempty"`
+
 	// Lifecycle:
 
 	// (optional) Targets is a list of URNs of resources to update exclusively. If supplied, only
 	// resources mentioned will be updated.
 	Targets []string `json:"targets,omitempty"`
+	// (optional) Parallel is the most resource operations to run at once in an update, refresh or
+	// destroy of the stack, as given by `--parallel` to the Pulumi CLI. Lowering it can keep a
+	// stack within a provider's API rate limits. When not set, Pulumi's default is used.
+	// +kubebuilder:validation:Minimum=0
+	Parallel int `json:"parallel,omitempty"`
 
 	// (optional) Prerequisites is a list of references to other stacks, each with a constraint on
 	// how long ago it must have succeeded. This can be used to make sure e.g., state is
 	// re-evaluated before running a stack that depends on it.
 	Prerequisites []PrerequisiteRef `json:"prerequisites,omitempty"`
+	// (optional) DependsOn is a list of other stacks this stack depends on, each with the outputs
+	// of that stack to be passed to this one as configuration or environment variables. This
+	// stack isn't updated until each stack it depends on is Ready; and it's updated again when
+	// their outputs change. A cycle of dependencies (including prerequisites) stalls the stack.
+	DependsOn []StackReference `json:"dependsOn,omitempty"`
 
 	// (optional) ContinueResyncOnCommitMatch - when true - informs the operator to continue trying
 	// to update stacks even if the revision of the source matches. This might be useful in
@@ -101,8 +284,93 @@ type StackSpec struct {
 	// This could occur, for example, is a resource's state is changing outside of Pulumi
 	// (e.g., metadata, timestamps).
 	ExpectNoRefreshChanges bool `json:"expectNoRefreshChanges,omitempty"`
+	// (optional) RefreshConfig gives how to refresh the stack before it is updated. When given, it
+	// takes the place of Refresh and ExpectNoRefreshChanges, which are ignored.
+	// +optional
+	RefreshConfig *RefreshConfig `json:"refreshConfig,omitempty"`
+	// (optional) ContinueOnRefreshError, when true, has the stack updated even if the refresh
+	// before the update fails (e.g., because of a resource that can't be read, which isn't critical
+	// to the stack). The failure is logged and recorded in the RefreshFailed condition. This doesn't
+	// apply to the refresh finding changes when ExpectNoRefreshChanges is set, which still stops the
+	// update.
+	ContinueOnRefreshError bool `json:"continueOnRefreshError,omitempty"`
+	// (optional) DriftDetectionOnly, when true, has the operator check the stack for drift --
+	// changes made to its resources outside of Pulumi -- and report it, rather than update the
+	// stack to undo it. Once the stack is up to date, it is refreshed every
+	// DriftCheckFrequencySeconds; if the refresh changes anything, the Drifted condition is set and
+	// a warning event emitted. The stack is still updated when its source or spec changes, or when
+	// an update is requested with the `pulumi.com/reconciliation-request` annotation, but it isn't
+	// otherwise updated again at the same revision. Since the refresh brings the stack's state up
+	// to date, the Drifted condition stays until the stack is next updated. This has no effect
+	// along with ContinueResyncOnCommitMatch, which has the stack updated regardless.
+	// +optional
+	DriftDetectionOnly bool `json:"driftDetectionOnly,omitempty"`
+	// (optional) DriftCheckFrequencySeconds is how often to check the stack for drift, when
+	// DriftDetectionOnly is set. The default is 3600 (one hour), and the least is 60.
+	// +kubebuilder:validation:Minimum=0
+	// +optional
+	DriftCheckFrequencySeconds int64 `json:"driftCheckFrequencySeconds,omitempty"`
+	// (optional) PreviewOnly, when true, has the operator preview the stack rather than update
+	// it, so that it reports what would change without changing anything. Each time the stack is
+	// processed (e.g., when its source or spec changes, or every ResyncFrequencySeconds when
+	// tracking a branch), a preview is run and its outcome recorded in .status.lastPreview. A
+	// refresh, if asked for, is run as part of the preview, so that the state isn't changed
+	// either; Imports and PostRunCommands are not run. A stack with PreviewOnly set is never
+	// destroyed, even if DestroyOnFinalize is set.
+	// +optional
+	PreviewOnly bool `json:"previewOnly,omitempty"`
+	// (optional) PreRunCommands are shell commands to run before the stack is refreshed or updated,
+	// e.g., to generate files the program needs. Each is run with `sh -c` in the project directory,
+	// with the stack's environment (envRefs, envFrom, envs and envSecrets), after the project's
+	// dependencies are installed. If a command exits with a non-zero status, the rest are not run,
+	// the stack is not updated, and the failure is reported in the stack's status, along with what
+	// the command wrote to stderr.
+	// +optional
+	PreRunCommands []string `json:"preRunCommands,omitempty"`
+	// (optional) Imports are existing resources to import into the stack before it's updated, so
+	// that the program adopts them rather than creating them anew. They are imported with `pulumi
+	// import`, unprotected and without generating code, so the program must declare each of them,
+	// with the same type and name. A resource already in the stack's state (with the same type and
+	// name) is skipped, so the imports are only run once; those run are recorded in
+	// .status.imported.
+	// +optional
+	Imports []ImportSpec `json:"imports,omitempty"`
+	// (optional) PostRunCommands are shell commands to run after the stack is updated
+	// successfully, e.g., smoke tests. They are run in the same way as PreRunCommands, and a failure
+	// is reported in the same way; the update is tried again, along with the commands.
+	// +optional
+	PostRunCommands []string `json:"postRunCommands,omitempty"`
+	// (optional) ShowSecretOutputs, when true, has the values of secret outputs given in the
+	// stack's status, in plain text. By default they are given as "[secret]", since the status is
+	// readable by anyone who can read the Stack object. Only set this if that is acceptable.
+	// +optional
+	ShowSecretOutputs bool `json:"showSecretOutputs,omitempty"`
 	// (optional) DestroyOnFinalize can be set to true to destroy the stack completely upon deletion of the Stack custom resource.
 	DestroyOnFinalize bool `json:"destroyOnFinalize,omitempty"`
+	// (optional) RefreshBeforeDestroy can be set to true, along with DestroyOnFinalize, to refresh
+	// the stack before it is destroyed. This brings the state up to date with resources that were
+	// deleted out of band, which the destroy would otherwise fail on. If the refresh fails, the
+	// destroy is attempted anyway.
+	RefreshBeforeDestroy bool `json:"refreshBeforeDestroy,omitempty"`
+	// (optional) ForceDestroy can be set to true, along with DestroyOnFinalize, to recover a stack
+	// left in a bad state before it is destroyed: any update in progress is cancelled, and pending
+	// operations are removed from the state, as `pulumi cancel` and `pulumi stack export` and
+	// `import` would be used to do by hand. Removing pending operations can leave resources that
+	// were being created untracked, so this is only for stacks that otherwise can't be destroyed.
+	// The steps taken are recorded in `.status.destroyProgress.recoverySteps`.
+	ForceDestroy bool `json:"forceDestroy,omitempty"`
+	// (optional) ProtectResources can be set to true to protect the stack's resources after each
+	// update, as if each were given the `protect` resource option, so that they can't be deleted by
+	// destroying the stack. When the Stack is deleted with DestroyOnFinalize set, it is not
+	// destroyed unless AllowDestroyProtectedResources is also set; it is stalled with the reason
+	// DestroyProtected, and keeps its finalizer, until one or the other is changed.
+	ProtectResources bool `json:"protectResources,omitempty"`
+	// (optional) AllowDestroyProtectedResources can be set to true, along with DestroyOnFinalize, to
+	// destroy a stack with ProtectResources set. Its resources are unprotected before the destroy.
+	AllowDestroyProtectedResources bool `json:"allowDestroyProtectedResources,omitempty"`
+	// (optional) DestroyOptions gives options for destroying the stack, when DestroyOnFinalize is
+	// set.
+	DestroyOptions *DestroyOptions `json:"destroyOptions,omitempty"`
 	// (optional) RetryOnUpdateConflict issues a stack update retry reconciliation loop
 	// in the event that the update hits a HTTP 409 conflict due to
 	// another update in progress.
@@ -111,17 +379,133 @@ type StackSpec struct {
 	// all spawned retries succeed. This will also create a more populated,
 	// and randomized activity timeline for the stack in the Pulumi Service.
 	RetryOnUpdateConflict bool `json:"retryOnUpdateConflict,omitempty"`
+	// (optional) RetryPolicy gives how to retry an update that conflicts with another update in
+	// progress. Giving a policy has conflicts retried, as though RetryOnUpdateConflict were set.
+	// When RetryOnUpdateConflict is set without a policy, the defaults given in RetryPolicy are
+	// used.
+	RetryPolicy *RetryPolicy `json:"retryPolicy,omitempty"`
+	// (optional) CancelOnConflict, when true, has the operator cancel an update that holds the
+	// stack's lock, if the update was started by the operator and interrupted before it could
+	// finish (e.g., because the operator was restarted). A single cancellation is attempted before
+	// retrying; updates not started by the operator are never cancelled.
+	CancelOnConflict bool `json:"cancelOnConflict,omitempty"`
+	// (optional) UpdateTimeoutSeconds is the longest an update is allowed to run for. An update
+	// that runs for longer is cancelled, and the stack is marked as reconciling with the reason
+	// UpdateTimeout; the update is then retried, backing off as for other failures. When not set,
+	// there is no limit.
+	// +kubebuilder:validation:Minimum=0
+	UpdateTimeoutSeconds int64 `json:"updateTimeoutSeconds,omitempty"`
+	// (optional) HistoryLimit is the number of updates kept in .status.history, oldest first out.
+	// Defaults to 5; 0 turns the history off. At most 20 are kept, so that the size of the stack
+	// object stays bounded.
+	// +kubebuilder:validation:Minimum=0
+	// +kubebuilder:validation:Maximum=20
+	HistoryLimit *int32 `json:"historyLimit,omitempty"`
+	// (optional) Notifications gives webhooks to be called when the stack has been processed, with
+	// the outcome. A webhook which can't be called doesn't affect the stack; the problem is logged.
+	Notifications *Notifications `json:"notifications,omitempty"`
 
 	// (optional) UseLocalStackOnly can be set to true to prevent the operator from
 	// creating stacks that do not exist in the tracking git repo.
 	// The default behavior is to create a stack if it doesn't exist.
 	UseLocalStackOnly bool `json:"useLocalStackOnly,omitempty"`
 
+	// (optional) Paused, when true, stops the operator from processing the stack: it is not
+	// refreshed, updated, or resynced, until Paused is set back to false. The Reconciling condition
+	// is set to False with the reason Paused. A paused stack can still be deleted, and is destroyed
+	// if DestroyOnFinalize is set.
+	Paused bool `json:"paused,omitempty"`
+
 	// (optional) ResyncFrequencySeconds when set to a non-zero value, triggers a resync of the stack at
 	// the specified frequency even if no changes to the custom resource are detected.
 	// If branch tracking is enabled (branch is non-empty), commit polling will occur at this frequency.
-	// The minimal resync frequency supported is 60 seconds. The default value for this field is 60 seconds.
+	// A resync refreshes and updates the stack, even when the source is at the revision last
+	// deployed and the spec has not changed, so that drift of the deployed resources is corrected;
+	// this applies to a stack deployed from a specific commit as well. A stack with
+	// DriftDetectionOnly set is not updated by a resync.
+	// The minimal resync frequency supported is 60 seconds. When this is zero or not set, the stack
+	// is not resynced, and a stack tracking a branch (or a tag, or a local path) polls its source
+	// every 60 seconds.
+	// +kubebuilder:validation:Minimum=60
 	ResyncFrequencySeconds int64 `json:"resyncFrequencySeconds,omitempty"`
+
+	// (optional) InitialReconcileDelaySeconds is how long to wait after the stack is created before
+	// it is first run. This gives objects created along with the stack (e.g., the Secrets it refers
+	// to) time to appear. When not set, the operator's default is used, which is zero unless
+	// INITIAL_RECONCILE_DELAY_SECONDS is set in its environment. Regardless of the delay, a stack
+	// that refers to an object which does not exist is marked as reconciling with the reason
+	// WaitingForReferences, and checked again shortly, rather than marked as failed.
+	// +kubebuilder:validation:Minimum=0
+	InitialReconcileDelaySeconds *int64 `json:"initialReconcileDelaySeconds,omitempty"`
+}
+
+// RetryPolicy gives how to retry an update that conflicts with another update in progress. The
+// wait before each retry is the wait before the previous one multiplied by BackoffFactor, up to a
+// limit of ten minutes.
+type RetryPolicy struct {
+	// (optional) MaxRetries is the number of times to retry before giving up, at which point the
+	// stack is marked as stalled with the reason UpdateConflict. Defaults to 10.
+	// +kubebuilder:validation:Minimum=0
+	MaxRetries int32 `json:"maxRetries,omitempty"`
+	// (optional) InitialBackoffSeconds is how long to wait before the first retry. Defaults to 5.
+	// +kubebuilder:validation:Minimum=0
+	InitialBackoffSeconds int64 `json:"initialBackoffSeconds,omitempty"`
+	// (optional) BackoffFactor is the factor by which the wait grows after each retry, given as a
+	// decimal number of at least 1, e.g., "1.5". Defaults to "2".
+	// +kubebuilder:validation:Pattern=`^[0-9]+(\.[0-9]+)?$`
+	BackoffFactor string `json:"backoffFactor,omitempty"`
+}
+
+// RefreshConfig gives how to refresh a stack before it is updated.
+type RefreshConfig struct {
+	// (optional) Enabled, when true, has the stack refreshed before it is updated.
+	Enabled bool `json:"enabled,omitempty"`
+	// (optional) ExpectNoChanges, when true, fails the update if the refresh changes the stack's
+	// state.
+	ExpectNoChanges bool `json:"expectNoChanges,omitempty"`
+	// (optional) IgnoreTargets is a list of URNs of resources to leave out of the refresh, e.g.,
+	// resources known to change outside of Pulumi in ways that don't matter, so that they don't
+	// trip ExpectNoChanges. The rest of the stack's resources (or of Targets, if given) are
+	// refreshed. These are recorded in .status.lastRefresh.ignoredTargets.
+	// +optional
+	IgnoreTargets []string `json:"ignoreTargets,omitempty"`
+}
+
+// DestroyOptions gives options for destroying a stack.
+type DestroyOptions struct {
+	// (optional) BatchSize, when set, has the stack destroyed in batches of at most this many
+	// resources, rather than all at once. Batches are taken from the dependents first, so that no
+	// resource is destroyed before the resources that depend on it. Progress is recorded in
+	// .status.destroyProgress after each batch, and a destroy that is interrupted resumes from the
+	// last batch completed. A full destroy is run after the last batch, to destroy anything left,
+	// including providers.
+	// +kubebuilder:validation:Minimum=1
+	BatchSize int32 `json:"batchSize,omitempty"`
+	// (optional) UseCurrentSource, when true, has the stack destroyed using the program at the
+	// current revision of its git source (e.g., the tip of the branch given). By default, a stack
+	// with a git repository as its source is destroyed using the commit it was last successfully
+	// updated at, so that changes to the program since it was deployed can't break the destroy.
+	// Set this if that commit can no longer be fetched.
+	UseCurrentSource bool `json:"useCurrentSource,omitempty"`
+	// (optional) ApprovalRequired, when true, has the stack destroyed only once the destroy has
+	// been approved. When the stack is deleted, a preview of the destroy is run and recorded in
+	// .status.destroyProgress.approval, with an ID; the destroy goes ahead when the stack is
+	// annotated with `pulumi.com/approve-destroy` set to that ID, within ApprovalValidity of the
+	// preview; it's checked for every minute. An approval which arrives later than that is
+	// rejected, and a fresh preview is run to be approved.
+	// +optional
+	ApprovalRequired bool `json:"approvalRequired,omitempty"`
+	// (optional) ApprovalValidity is how long after the preview of a destroy it can be approved,
+	// when ApprovalRequired is set. It defaults to one hour.
+	// +optional
+	ApprovalValidity *metav1.Duration `json:"approvalValidity,omitempty"`
+	// (optional) Credentials gives environment variables to set only for destroying the stack
+	// (including the preview of the destroy, and any refresh or recovery before it), e.g.,
+	// credentials with the permissions to delete what the stack manages. These take precedence
+	// over envRefs. An event is recorded each time the stack is destroyed with these or with an
+	// approval.
+	// +optional
+	Credentials map[string]ResourceRef `json:"credentials,omitempty"`
 }
 
 // GitSource specifies how to fetch from a git repository directly.
@@ -129,39 +513,227 @@ type GitSource struct {
 	// ProjectRepo is the git source control repository from which we fetch the project code and configuration.
 	// +optional
 	ProjectRepo string `json:"projectRepo,omitempty"`
+	// (optional) ProjectPath is a directory on the operator's filesystem holding the project, to be
+	// used instead of cloning ProjectRepo; e.g., a project baked into the operator image, or mounted
+	// from a volume. It must be within the directory given in the operator's LOCAL_PROJECT_ROOT
+	// environment entry, and a relative path is taken to be relative to that directory. RepoDir
+	// applies within ProjectPath. A hash of the directory's contents is reported as the commit, and
+	// the directory is checked for changes in the same way a branch is polled. This is mutually
+	// exclusive with ProjectRepo, Commit, Branch and Tag.
+	// +optional
+	ProjectPath string `json:"projectPath,omitempty"`
+	// (optional) CopyProjectPath, when true, has the project in ProjectPath copied to a scratch
+	// directory and run from there, so that the original is left untouched. Otherwise the project
+	// is run in place, and the stack settings file (Pulumi.<stack>.yaml) is written into it, so the
+	// directory must be writable.
+	// +optional
+	CopyProjectPath bool `json:"copyProjectPath,omitempty"`
+	// (optional) ProjectArchiveURL is the HTTP(S) URL of a gzipped tarball (.tar.gz) of the
+	// project, to be downloaded and unpacked instead of cloning ProjectRepo; e.g., an artifact in
+	// an internal registry. RepoDir applies within the unpacked archive. The SHA256 digest of the
+	// archive is reported as the commit. When ArchiveSHA256 is not given, the archive is downloaded
+	// again to check for changes in the same way a branch is polled. This is mutually exclusive
+	// with ProjectRepo, ProjectPath, Commit, Branch and Tag.
+	// +optional
+	ProjectArchiveURL string `json:"projectArchiveURL,omitempty"`
+	// (optional) ArchiveAuth refers to a bearer token with which to authenticate the download of
+	// ProjectArchiveURL.
+	// +optional
+	ArchiveAuth *ResourceRef `json:"archiveAuth,omitempty"`
+	// (optional) ArchiveSHA256 is the expected SHA256 digest of the archive at ProjectArchiveURL,
+	// in hex. If the archive downloaded doesn't match, it isn't used.
+	// +kubebuilder:validation:Pattern=`^[0-9a-fA-F]{64}$`
+	// +optional
+	ArchiveSHA256 string `json:"archiveSHA256,omitempty"`
 	// (optional) GitAuthSecret is the the name of a Secret containing an
 	// authentication option for the git repository.
-	// There are 3 different authentication options:
+	// There are 4 different authentication options:
 	//   * Personal access token
 	//   * SSH private key (and it's optional password)
 	//   * Basic auth username and password
+	//   * GitHub App installation, given by appID, installationID, privateKey (PEM-encoded) and,
+	//     for GitHub Enterprise Server, apiURL; installation tokens are minted as needed
 	// Only one authentication mode will be considered if more than one option is specified,
 	// with ssh private key/password preferred first, then personal access token, and finally
-	// basic auth credentials.
+	// basic auth credentials. A GitHub App cannot be given along with any other option.
+	// Ignored if GitAuth is given.
 	// Deprecated. Use GitAuth instead.
 	GitAuthSecret string `json:"gitAuthSecret,omitempty"`
 
 	// (optional) GitAuth allows configuring git authentication options
-	// There are 3 different authentication options:
+	// There are 4 different authentication options:
 	//   * SSH private key (and its optional password)
 	//   * Personal access token
 	//   * Basic auth username and password
+	//   * AWS credentials, for CodeCommit repositories
 	// Only one authentication mode will be considered if more than one option is specified,
-	// with ssh private key/password preferred first, then personal access token, and finally
-	// basic auth credentials.
+	// with AWS credentials for CodeCommit preferred first, then ssh private key/password, then
+	// personal access token, and finally basic auth credentials. Each credential is given as a ResourceRef, so it can come from a
+	// Secret, the operator's environment or filesystem, a literal, or Vault. If both GitAuth and
+	// GitAuthSecret are given, GitAuth is used.
 	GitAuth *GitAuthConfig `json:"gitAuth,omitempty"`
 	// (optional) RepoDir is the directory to work from in the project's source repository
 	// where Pulumi.yaml is located. It is used in case Pulumi.yaml is not
 	// in the project source root.
 	RepoDir string `json:"repoDir,omitempty"`
 	// (optional) Commit is the hash of the commit to deploy. If used, HEAD will be in detached mode. This
-	// is mutually exclusive with the Branch setting. Either value needs to be specified.
+	// is mutually exclusive with the Branch and Tag settings. One of these values needs to be specified.
 	Commit string `json:"commit,omitempty"`
 	// (optional) Branch is the branch name to deploy, either the simple or fully qualified ref name, e.g. refs/heads/master. This
-	// is mutually exclusive with the Commit setting. Either value needs to be specified.
+	// is mutually exclusive with the Commit and Tag settings. One of these values needs to be specified.
 	// When specified, the operator will periodically poll to check if the branch has any new commits.
 	// The frequency of the polling is configurable through ResyncFrequencySeconds, defaulting to every 60 seconds.
 	Branch string `json:"branch,omitempty"`
+	// (optional) Tag is the tag to deploy, either the simple or fully qualified ref name, e.g. refs/tags/v1.0.0.
+	// Annotated and lightweight tags are both resolved to the commit they point at. This is mutually exclusive
+	// with the Commit and Branch settings. One of these values needs to be specified.
+	// When specified, the operator will periodically poll to check if the tag has been moved to another commit,
+	// in the same way as for Branch.
+	Tag string `json:"tag,omitempty"`
+	// (optional) PushWebhook lets a push webhook from the git host request reconciliation of the
+	// stack as soon as the branch or tag it tracks is pushed to, rather than waiting for it to be
+	// polled. The operator receives push webhooks at /hooks/<namespace>/<name> when it's run with
+	// PUSH_WEBHOOK_BIND_ADDRESS set.
+	PushWebhook *PushWebhook `json:"pushWebhook,omitempty"`
+	// (optional) GitProxyURL is the URL of a proxy through which to reach the git repository, e.g.,
+	// http://proxy.example.com:3128. HTTP(S) proxies can be used with HTTP(S) repository URLs, and
+	// SOCKS5 proxies with either HTTP(S) or SSH repository URLs. Credentials for the proxy can be given
+	// in the URL, or in GitProxyAuth. When not given, the proxy for HTTP(S) repository URLs is
+	// taken from the HTTPS_PROXY, HTTP_PROXY and NO_PROXY environment variables of the operator.
+	GitProxyURL string `json:"gitProxyURL,omitempty"`
+	// (optional) GitProxyAuth gives the username and password with which to authenticate to the
+	// proxy given in GitProxyURL.
+	GitProxyAuth *BasicAuth `json:"gitProxyAuth,omitempty"`
+	// (optional) GitTLS gives options for TLS connections to an HTTPS git server; e.g., a CA
+	// bundle for a self-hosted server with a certificate signed by a private CA.
+	GitTLS *GitTLSConfig `json:"gitTLS,omitempty"`
+	// (optional) GitLFS, when true, has the operator fetch the Git LFS objects for the files
+	// checked out, so that the program sees the files themselves rather than LFS pointer files.
+	// The objects are fetched from the LFS server of the repository, using the same credentials as
+	// for the repository; only HTTP(S) repository URLs are supported. If any object cannot be
+	// fetched, or does not match its pointer, the update fails.
+	GitLFS bool `json:"gitLFS,omitempty"`
+	// (optional) FetchDepth, when greater than zero, has the operator make a shallow clone of the
+	// repository, fetching only that many commits from the tip of each branch or tag fetched. When
+	// Commit is given, the git server must allow fetching a commit by its hash if the commit is not
+	// within the depth fetched. Repository mirrors are not used for shallow clones. When not given,
+	// the whole history is fetched.
+	// +kubebuilder:validation:Minimum=0
+	// +optional
+	FetchDepth int `json:"fetchDepth,omitempty"`
+	// (optional) MaxFetchDepth, when FetchDepth and Commit are given, is the depth to which the
+	// operator will deepen the clone to find the commit, if it isn't within FetchDepth commits
+	// and can't be fetched by its hash. The depth is doubled in steps up to MaxFetchDepth; when
+	// not given, the depth is doubled up to 1024 commits, then the whole history is fetched. If
+	// the commit still isn't found, the stack is marked as reconciling with the reason
+	// CommitNotFound, and retried after a long wait.
+	// +kubebuilder:validation:Minimum=0
+	// +optional
+	MaxFetchDepth int `json:"maxFetchDepth,omitempty"`
+	// (optional) GitCloneTimeoutSeconds limits the time each attempt to clone (or fetch) the
+	// repository may take. An attempt taking longer is abandoned, and retried if GitCloneRetries
+	// allows. When not given, an attempt is not limited.
+	// +kubebuilder:validation:Minimum=0
+	// +optional
+	GitCloneTimeoutSeconds int64 `json:"gitCloneTimeoutSeconds,omitempty"`
+	// (optional) GitCloneRetries is the number of times a failed clone (or fetch) of the repository
+	// is retried, after a backoff starting at five seconds and doubling each time up to two
+	// minutes, before the stack is failed with the reason GitCloneFailed. Failures which retrying
+	// won't fix (e.g., rejected credentials, or a commit not in the repository) are not retried.
+	// When not given, the clone is attempted once.
+	// +kubebuilder:validation:Minimum=0
+	// +optional
+	GitCloneRetries int `json:"gitCloneRetries,omitempty"`
+	// (optional) FetchSubmodules, when true, has the operator initialise and check out the
+	// submodules of the repository, recursively, after checking out the revision. Submodules are
+	// fetched to the same FetchDepth, through the same proxy, and with the credentials given for
+	// the repository, when they suit the submodule's URL: SSH keys are used only for SSH URLs, and
+	// tokens and passwords only for HTTP(S) URLs. Submodules on the same host as the repository
+	// use the same credentials, e.g., the installation token of a GitHub App.
+	// +optional
+	FetchSubmodules bool `json:"fetchSubmodules,omitempty"`
+}
+
+// EnvFromSource gives a Secret or ConfigMap, all of whose entries are set as environment variables.
+// Exactly one of SecretRef and ConfigMapRef must be given.
+type EnvFromSource struct {
+	// (optional) Prefix is prepended to each key in the Secret or ConfigMap to give the name of the
+	// environment variable.
+	Prefix string `json:"prefix,omitempty"`
+	// (optional) SecretRef selects a Secret in the stack's namespace.
+	SecretRef *EnvFromObjectReference `json:"secretRef,omitempty"`
+	// (optional) ConfigMapRef selects a ConfigMap in the stack's namespace.
+	ConfigMapRef *EnvFromObjectReference `json:"configMapRef,omitempty"`
+}
+
+// ConfigValue is a configuration value given inline.
+type ConfigValue struct {
+	// Value is the value of the configuration key.
+	Value string `json:"value"`
+	// (optional) Secret, when true, has the value set as secret configuration.
+	// +optional
+	Secret bool `json:"secret,omitempty"`
+}
+
+// ImportSpec gives an existing resource to import into the stack.
+type ImportSpec struct {
+	// Type is the type token of the resource, e.g., `aws:s3/bucket:Bucket`.
+	Type string `json:"type"`
+	// Name is the name of the resource in the program.
+	Name string `json:"name"`
+	// ID is the provider's ID of the existing resource.
+	ID string `json:"id"`
+}
+
+// ConfigFromSource gives a ConfigMap, all of whose entries are set as stack configuration.
+type ConfigFromSource struct {
+	// (optional) Prefix is prepended to each key in the ConfigMap to give the configuration key;
+	// e.g., `aws:`.
+	Prefix string `json:"prefix,omitempty"`
+	// ConfigMapRef selects a ConfigMap in the stack's namespace. The ConfigMap must exist.
+	ConfigMapRef ConfigFromConfigMapReference `json:"configMapRef"`
+}
+
+// StackConfigSource gives a stack settings file to use in place of, or to merge into, the one
+// checked in with the program.
+type StackConfigSource struct {
+	// ConfigMapRef gives the ConfigMap key whose content is the stack settings file, as YAML.
+	ConfigMapRef ConfigMapSelector `json:"configMapRef"`
+	// (optional) Merge, when true, merges the stack settings file into the one checked in: each
+	// configuration key it gives is set, as are the secrets provider, encryption settings and
+	// environments, if it gives them; everything else in the file checked in is kept. By default,
+	// the file checked in (if any) is replaced.
+	Merge bool `json:"merge,omitempty"`
+}
+
+// ConfigFromConfigMapReference refers to a ConfigMap in the stack's namespace.
+type ConfigFromConfigMapReference struct {
+	// Name is the name of the ConfigMap.
+	Name string `json:"name"`
+}
+
+// SecretsFromSource gives a Secret, all of whose entries are set as secret stack configuration.
+type SecretsFromSource struct {
+	// (optional) Prefix is prepended to each key in the Secret to give the configuration key;
+	// e.g., `aws:`.
+	Prefix string `json:"prefix,omitempty"`
+	// SecretRef selects a Secret in the stack's namespace. The Secret must exist.
+	SecretRef SecretsFromSecretReference `json:"secretRef"`
+}
+
+// SecretsFromSecretReference refers to a Secret in the stack's namespace.
+type SecretsFromSecretReference struct {
+	// Name is the name of the Secret.
+	Name string `json:"name"`
+}
+
+// EnvFromObjectReference refers to a Secret or ConfigMap in the stack's namespace.
+type EnvFromObjectReference struct {
+	// Name is the name of the Secret or ConfigMap.
+	Name string `json:"name"`
+	// (optional) Optional, when true, allows the Secret or ConfigMap to not exist, in which case
+	// it sets no environment variables.
+	Optional bool `json:"optional,omitempty"`
 }
 
 // PrerequisiteRef refers to another stack, and gives requirements for the prerequisite to be
@@ -174,6 +746,43 @@ type PrerequisiteRef struct {
 	Requirement *RequirementSpec `json:"requirement,omitempty"`
 }
 
+// Notifications says who is told the outcome of processing a stack.
+type Notifications struct {
+	// Webhooks are each sent a POST request with a JSON payload giving the namespace and name of
+	// the Stack object, the stack name, the outcome (`succeeded` or `failed`), the reason for a
+	// failure if known, the permalink of the update, and the commit.
+	Webhooks []WebhookNotification `json:"webhooks,omitempty"`
+}
+
+// WebhookNotification is a webhook to be called with the outcome of processing a stack.
+type WebhookNotification struct {
+	// URL is the address the payload is POSTed to.
+	URL string `json:"url"`
+	// (optional) AuthHeader gives the value of the Authorization header sent with the payload; e.g.,
+	// a Secret ref to `Bearer <token>`.
+	AuthHeader *ResourceRef `json:"authHeader,omitempty"`
+	// (optional) On lists the outcomes to be notified of. Defaults to all of them.
+	// +kubebuilder:validation:items:Enum=succeeded;failed
+	On []StackUpdateStateMessage `json:"on,omitempty"`
+}
+
+// StackReference refers to another Stack in the same namespace which a stack depends on, and
+// maps its outputs into the stack's configuration and environment. Outputs are given as for a
+// StackOutput resource ref: a string as it is, and any other value as JSON.
+type StackReference struct {
+	// Name is the name of the Stack resource depended on.
+	Name string `json:"name"`
+	// (optional) Config maps configuration keys of this stack to the names of outputs of the
+	// Stack depended on, as if each were given in configRefs.
+	Config map[string]string `json:"config,omitempty"`
+	// (optional) SecretConfig maps configuration keys of this stack to the names of outputs of
+	// the Stack depended on, to be set as secrets, as if each were given in secretsRef.
+	SecretConfig map[string]string `json:"secretConfig,omitempty"`
+	// (optional) Env maps environment variables to the names of outputs of the Stack depended
+	// on, as if each were given in envRefs.
+	Env map[string]string `json:"env,omitempty"`
+}
+
 // RequirementSpec gives constraints for a prerequisite to be considered satisfied.
 type RequirementSpec struct {
 	// SucceededWithinDuration gives a duration within which the prerequisite must have reached a
@@ -181,8 +790,26 @@ type RequirementSpec struct {
 	// the last hour". Fields (should there ever be more than one) are not intended to be mutually
 	// exclusive.
 	SucceededWithinDuration *metav1.Duration `json:"succeededWithinDuration,omitempty"`
+	// (optional) Verify, when set to "Refresh", requires the prerequisite to have verified its
+	// resources recently, by refreshing its state, and found that none of them has been deleted
+	// out of band. If it hasn't verified them within VerifyWithinDuration, it is asked to. The
+	// verification is recorded in the prerequisite's status, so that stacks with the same
+	// prerequisite share it. Verifying does not update the prerequisite's resources.
+	// +kubebuilder:validation:Enum=Refresh
+	Verify string `json:"verify,omitempty"`
+	// (optional) VerifyWithinDuration gives how recent a verification must be to be used, and so
+	// how often the prerequisite is asked to verify its resources at most. Defaults to 10m.
+	VerifyWithinDuration *metav1.Duration `json:"verifyWithinDuration,omitempty"`
+	// (optional) VerifyOutputs names the outputs of the prerequisite that are relied on. When
+	// given, only the deletion of a resource whose ID is (part of) one of these outputs fails the
+	// verification; otherwise, the deletion of any resource does.
+	VerifyOutputs []string `json:"verifyOutputs,omitempty"`
 }
 
+// VerifyRefresh is the value of RequirementSpec.Verify which has a prerequisite refresh its state
+// to verify its resources.
+const VerifyRefresh = "Refresh"
+
 // GitAuthConfig specifies git authentication configuration options.
 // There are 3 different authentication options:
 //   - Personal access token
@@ -194,6 +821,56 @@ type GitAuthConfig struct {
 	PersonalAccessToken *ResourceRef `json:"accessToken,omitempty"`
 	SSHAuth             *SSHAuth     `json:"sshAuth,omitempty"`
 	BasicAuth           *BasicAuth   `json:"basicAuth,omitempty"`
+	// (optional) CodeCommit authenticates to an AWS CodeCommit repository over HTTPS with AWS
+	// credentials, rather than with static git credentials for an IAM user.
+	CodeCommit *CodeCommitAuth `json:"codeCommit,omitempty"`
+
+	// (optional) KnownHosts refers to the known_hosts entries against which the host key of an SSH
+	// git server is verified. When given, the host key must match one of the entries, and the
+	// update fails otherwise. A `knownHosts` entry in the GitAuthSecret is used in the same way.
+	KnownHosts *ResourceRef `json:"knownHosts,omitempty"`
+	// (optional) StrictHostKeyChecking controls whether the host key of an SSH git server is
+	// verified. When true, the host key must be present in the known hosts (either those given in
+	// KnownHosts, or those in $HOME/.ssh/known_hosts). When false, the host key is not verified.
+	// When not set, host keys are verified against KnownHosts if given, and otherwise the host keys
+	// scanned from the server are trusted.
+	StrictHostKeyChecking *bool `json:"strictHostKeyChecking,omitempty"`
+	// (optional) CABundle refers to a PEM-encoded bundle of CA certificates, used to verify the
+	// TLS certificate of an HTTPS git server; for example, a self-hosted server with a
+	// certificate signed by a private CA. The bundle applies only to this stack. A `caBundle`
+	// entry in the GitAuthSecret is used in the same way.
+	CABundle *ResourceRef `json:"caBundle,omitempty"`
+}
+
+// GitTLSConfig gives options for TLS connections to the git server, for fetching the source and
+// any submodules and Git LFS objects.
+type GitTLSConfig struct {
+	// (optional) CABundle refers to a PEM-encoded bundle of CA certificates, used along with the
+	// system roots to verify the TLS certificate of the git server. It applies only to this stack,
+	// and takes the place of a CA bundle given in gitAuth or the GitAuthSecret.
+	CABundle *ResourceRef `json:"caBundle,omitempty"`
+	// (optional) InsecureSkipVerify turns off verification of the git server's TLS certificate.
+	// This leaves the connection open to interception, so a warning is logged each time it's used;
+	// prefer giving a CABundle.
+	InsecureSkipVerify bool `json:"insecureSkipVerify,omitempty"`
+}
+
+// CodeCommitAuth configures authentication to an AWS CodeCommit repository with AWS credentials.
+// As with the AWS CLI's git credential helper, each request is signed with the credentials (AWS
+// Signature Version 4), so only the HTTPS repository URLs can be used.
+type CodeCommitAuth struct {
+	// (optional) AccessKeyID refers to the AWS access key ID to use. When neither this nor
+	// SecretAccessKey is given, credentials are taken from the operator's environment: either
+	// AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY, or a web identity token as provided by IAM roles
+	// for service accounts (AWS_ROLE_ARN and AWS_WEB_IDENTITY_TOKEN_FILE).
+	// +optional
+	AccessKeyID *ResourceRef `json:"accessKeyID,omitempty"`
+	// (optional) SecretAccessKey refers to the AWS secret access key to use with AccessKeyID.
+	// +optional
+	SecretAccessKey *ResourceRef `json:"secretAccessKey,omitempty"`
+	// (optional) SessionToken refers to the session token to use with temporary credentials.
+	// +optional
+	SessionToken *ResourceRef `json:"sessionToken,omitempty"`
 }
 
 // SSHAuth configures ssh-based auth for git authentication.
@@ -210,6 +887,40 @@ type BasicAuth struct {
 	Password ResourceRef `json:"password"`
 }
 
+// BackendAuth gives options and credentials for a backend.
+type BackendAuth struct {
+	// (optional) Endpoint overrides the endpoint of an s3:// backend, for S3-compatible storage
+	// like MinIO; e.g., "minio.example.com:9000".
+	Endpoint string `json:"endpoint,omitempty"`
+	// (optional) ForcePathStyle makes an s3:// backend use path-style addressing of the bucket,
+	// which S3-compatible storage often requires.
+	ForcePathStyle bool `json:"forcePathStyle,omitempty"`
+	// (optional) Region gives the region of an s3:// backend's bucket.
+	Region string `json:"region,omitempty"`
+	// (optional) Profile gives the AWS profile to use for an s3:// backend.
+	Profile string `json:"profile,omitempty"`
+	// (optional) BasicAuth gives credentials for an http:// or https:// backend which requires
+	// basic authentication.
+	BasicAuth *BasicAuth `json:"basicAuth,omitempty"`
+}
+
+// PushWebhook configures the receiving of push webhooks for a stack.
+type PushWebhook struct {
+	// SecretRef refers to the key of a Secret, in the same namespace as the stack, holding the
+	// secret shared with the git host. GitHub and Gitea use it to sign webhooks; GitLab sends it as
+	// a token.
+	SecretRef SecretKeyReference `json:"secretRef"`
+}
+
+// SecretKeyReference refers to a key of a Secret in the same namespace as the object referring to
+// it.
+type SecretKeyReference struct {
+	// Name of the Secret.
+	Name string `json:"name"`
+	// Key within the Secret.
+	Key string `json:"key"`
+}
+
 // FluxSource specifies how to fetch from a Flux source object
 type FluxSource struct {
 	SourceRef FluxSourceReference `json:"sourceRef"`
@@ -223,14 +934,18 @@ type FluxSourceReference struct {
 	APIVersion string `json:"apiVersion"`
 	Kind       string `json:"kind"`
 	Name       string `json:"name"`
+	// (optional) Namespace of the source object. If not given, the source is looked for in the
+	// stack's own namespace. Other namespaces can be used only if namespace isolation is disabled
+	// in the controller.
+	Namespace string `json:"namespace,omitempty"`
 }
 
 // ResourceRef identifies a resource from which information can be loaded.
-// Environment variables, files on the filesystem, Kubernetes Secrets and literal
+// Environment variables, files on the filesystem, Kubernetes Secrets and ConfigMaps, and literal
 // strings are currently supported.
 type ResourceRef struct {
 	// SelectorType is required and signifies the type of selector. Must be one of:
-	// Env, FS, Secret, Literal
+	// Env, FS, Secret, ConfigMap, Literal, Vault, StackOutput, FieldRef
 	SelectorType     ResourceSelectorType `json:"type"`
 	ResourceSelector `json:",inline"`
 }
@@ -240,6 +955,20 @@ type ProgramReference struct {
 	Name string `json:"name"`
 }
 
+// ProgramFromSource gives an object holding the files of a project.
+type ProgramFromSource struct {
+	// ConfigMap refers to a ConfigMap in the same namespace as the stack, each key of which is a
+	// file of the project (e.g., `Pulumi.yaml`, `index.ts`, `package.json`). The revision reported
+	// in the status of the stack is the name and resourceVersion of the ConfigMap.
+	ConfigMap *ProgramConfigMapReference `json:"configMap,omitempty"`
+}
+
+// ProgramConfigMapReference refers to a ConfigMap holding a project.
+type ProgramConfigMapReference struct {
+	// Name of the ConfigMap.
+	Name string `json:"name"`
+}
+
 // NewEnvResourceRef creates a new environment variable resource ref.
 func NewEnvResourceRef(envVarName string) ResourceRef {
 	return ResourceRef{
@@ -278,6 +1007,35 @@ func NewSecretResourceRef(namespace, name, key string) ResourceRef {
 	}
 }
 
+// NewConfigMapResourceRef creates a new ConfigMap resource ref.
+func NewConfigMapResourceRef(namespace, name, key string) ResourceRef {
+	return ResourceRef{
+		SelectorType: ResourceSelectorConfigMap,
+		ResourceSelector: ResourceSelector{
+			ConfigMapRef: &ConfigMapSelector{
+				Namespace: namespace,
+				Name:      name,
+				Key:       key,
+			},
+		},
+	}
+}
+
+// NewVaultResourceRef creates a new HashiCorp Vault resource ref.
+func NewVaultResourceRef(address, path, key string, auth VaultAuth) ResourceRef {
+	return ResourceRef{
+		SelectorType: ResourceSelectorVault,
+		ResourceSelector: ResourceSelector{
+			Vault: &VaultSelector{
+				Address: address,
+				Path:    path,
+				Key:     key,
+				Auth:    auth,
+			},
+		},
+	}
+}
+
 // NewLiteralResourceRef creates a new literal resource ref.
 func NewLiteralResourceRef(value string) ResourceRef {
 	return ResourceRef{
@@ -300,12 +1058,21 @@ const (
 	ResourceSelectorFS = ResourceSelectorType("FS")
 	// ResourceSelectorSecret indicates the resource is a Kubernetes Secret
 	ResourceSelectorSecret = ResourceSelectorType("Secret")
+	// ResourceSelectorConfigMap indicates the resource is a Kubernetes ConfigMap
+	ResourceSelectorConfigMap = ResourceSelectorType("ConfigMap")
 	// ResourceSelectorLiteral indicates the resource is a literal
 	ResourceSelectorLiteral = ResourceSelectorType("Literal")
+	// ResourceSelectorVault indicates the resource is a secret in HashiCorp Vault
+	ResourceSelectorVault = ResourceSelectorType("Vault")
+	// ResourceSelectorStackOutput indicates the resource is an output of another Stack
+	ResourceSelectorStackOutput = ResourceSelectorType("StackOutput")
+	// ResourceSelectorFieldRef indicates the resource is a field of the Stack object itself
+	ResourceSelectorFieldRef = ResourceSelectorType("FieldRef")
 )
 
 // ResourceSelector is a union over resource selectors supporting one of
-// filesystem, environment variable, Kubernetes Secret and literal values.
+// filesystem, environment variable, Kubernetes Secret and ConfigMap, HashiCorp Vault and literal
+// values.
 type ResourceSelector struct {
 	// FileSystem selects a file on the operator's file system
 	FileSystem *FSSelector `json:"filesystem,omitempty"`
@@ -313,8 +1080,16 @@ type ResourceSelector struct {
 	Env *EnvSelector `json:"env,omitempty"`
 	// SecretRef refers to a Kubernetes Secret
 	SecretRef *SecretSelector `json:"secret,omitempty"`
+	// ConfigMapRef refers to a Kubernetes ConfigMap
+	ConfigMapRef *ConfigMapSelector `json:"configMap,omitempty"`
 	// LiteralRef refers to a literal value
 	LiteralRef *LiteralRef `json:"literal,omitempty"`
+	// Vault refers to a secret in HashiCorp Vault
+	Vault *VaultSelector `json:"vault,omitempty"`
+	// StackOutput refers to an output of another Stack
+	StackOutput *StackOutputSelector `json:"stackOutput,omitempty"`
+	// FieldRef refers to a field of the Stack object itself
+	FieldRef *FieldRefSelector `json:"fieldRef,omitempty"`
 }
 
 // FSSelector identifies the path to load information from.
@@ -340,6 +1115,98 @@ type SecretSelector struct {
 	Key string `json:"key"`
 }
 
+// ConfigMapSelector identifies the information to load from a Kubernetes ConfigMap.
+type ConfigMapSelector struct {
+	// Namespace where the ConfigMap is stored. Non-empty values other than the stack's own
+	// namespace will be considered invalid unless namespace isolation is disabled in the
+	// controller.
+	Namespace string `json:"namespace,omitempty"`
+	// Name of the ConfigMap
+	Name string `json:"name"`
+	// Key within the ConfigMap to use.
+	Key string `json:"key"`
+}
+
+// VaultSelector identifies the information to load from a secret in HashiCorp Vault. Secrets in
+// version 1 or version 2 of the KV secrets engine can be used.
+type VaultSelector struct {
+	// Address of the Vault server, e.g., https://vault.example.com:8200.
+	Address string `json:"address"`
+	// (optional) Namespace is the Vault Enterprise namespace of the secret.
+	Namespace string `json:"namespace,omitempty"`
+	// Path of the secret, including the mount of the secrets engine; e.g., "secret/data/pulumi"
+	// for the secret "pulumi" in a KV version 2 engine mounted at "secret".
+	Path string `json:"path"`
+	// Key within the secret to use.
+	Key string `json:"key"`
+	// Auth gives how the operator authenticates with Vault.
+	Auth VaultAuth `json:"auth"`
+}
+
+// VaultAuth specifies how to authenticate with Vault. Exactly one method must be given.
+type VaultAuth struct {
+	// (optional) TokenSecretRef refers to a Kubernetes Secret containing a Vault token.
+	TokenSecretRef *SecretSelector `json:"tokenSecretRef,omitempty"`
+	// (optional) Kubernetes authenticates using the Kubernetes auth method, with the operator's
+	// service account token.
+	Kubernetes *VaultKubernetesAuth `json:"kubernetes,omitempty"`
+}
+
+// VaultKubernetesAuth configures the Vault Kubernetes auth method.
+type VaultKubernetesAuth struct {
+	// Role is the Vault role to log in as.
+	Role string `json:"role"`
+	// (optional) MountPath is where the Kubernetes auth method is mounted. Defaults to "kubernetes".
+	MountPath string `json:"mountPath,omitempty"`
+}
+
+// StackOutputSelector identifies an output of another Stack in the same namespace. The output is
+// taken from the last successful update of the Stack. A string output is given as it is, and any
+// other value as JSON. Secret outputs can only be used if the Stack has showSecretOutputs set.
+// This stack is updated again when the outputs it uses change; until the other Stack exists and
+// has outputs, this stack waits, with the reason WaitingForDependency. A cycle of Stacks using
+// each other's outputs stalls them.
+type StackOutputSelector struct {
+	// Name of the Stack object.
+	Name string `json:"name"`
+	// Output is the name of the output.
+	Output string `json:"output"`
+}
+
+// NewStackOutputResourceRef creates a new stack output resource ref.
+func NewStackOutputResourceRef(name, output string) ResourceRef {
+	return ResourceRef{
+		SelectorType: ResourceSelectorStackOutput,
+		ResourceSelector: ResourceSelector{
+			StackOutput: &StackOutputSelector{
+				Name:   name,
+				Output: output,
+			},
+		},
+	}
+}
+
+// FieldRefSelector identifies a field of the Stack object itself, as for the downward API of a
+// pod. The fields supported are `metadata.name`, `metadata.namespace`, `metadata.uid`,
+// `metadata.labels['<KEY>']` and `metadata.annotations['<KEY>']`; a label or annotation which isn't
+// present gives an empty string.
+type FieldRefSelector struct {
+	// FieldPath is the path of the field, e.g., `metadata.namespace`.
+	FieldPath string `json:"fieldPath"`
+}
+
+// NewFieldRefResourceRef creates a new field resource ref.
+func NewFieldRefResourceRef(fieldPath string) ResourceRef {
+	return ResourceRef{
+		SelectorType: ResourceSelectorFieldRef,
+		ResourceSelector: ResourceSelector{
+			FieldRef: &FieldRefSelector{
+				FieldPath: fieldPath,
+			},
+		},
+	}
+}
+
 // LiteralRef identifies a literal value to load.
 type LiteralRef struct {
 	// Value to load
@@ -360,14 +1227,59 @@ type StackOutputs map[string]apiextensionsv1.JSON
 type StackUpdateState struct {
 	// State is the state of the stack update - one of `succeeded` or `failed`
 	State StackUpdateStateMessage `json:"state,omitempty"`
+	// Reason gives the cause of a failed update, when it's one the operator recognises; e.g.,
+	// `ProjectNotFound` when there's no usable Pulumi project where the stack says to find it.
+	// +optional
+	Reason string `json:"reason,omitempty"`
 	// Last commit attempted
 	LastAttemptedCommit string `json:"lastAttemptedCommit,omitempty"`
 	// Last commit successfully applied
 	LastSuccessfulCommit string `json:"lastSuccessfulCommit,omitempty"`
+	// LastSuccessfulGeneration is the generation of the stack's spec when it was last updated
+	// successfully. Along with LastSuccessfulCommit, it's used to tell whether there's anything new
+	// to update.
+	// +optional
+	LastSuccessfulGeneration int64 `json:"lastSuccessfulGeneration,omitempty"`
+	// ReconcileRequest is the value of the annotation named for `ReconcileRequestAnnotation`, if
+	// any, when the last successful update was started. Changing the annotation to any other value
+	// has the stack updated again, even if nothing else has changed.
+	// +optional
+	ReconcileRequest string `json:"reconcileRequest,omitempty"`
+	// ConfigFromRevision identifies the versions of the ConfigMaps given in configFrom, and the
+	// Secrets given in secretsFrom, when the last successful update was started. A change to any of
+	// them has the stack updated again.
+	// +optional
+	ConfigFromRevision string `json:"configFromRevision,omitempty"`
+	// ReferencesRevision identifies the versions of the other Secrets and ConfigMaps the stack
+	// refers to (e.g., in envRefs or secretRefs) when the last successful update was started. A
+	// change to any of them has the stack updated again.
+	// +optional
+	ReferencesRevision string `json:"referencesRevision,omitempty"`
+	// PatchChecksum is the checksum of the patches given in .spec.patches, if any, which were
+	// applied to the source for the last successful update.
+	// +optional
+	PatchChecksum string `json:"patchChecksum,omitempty"`
 	// Permalink is the Pulumi Console URL of the stack operation.
 	Permalink Permalink `json:"permalink,omitempty"`
 	// LastResyncTime contains a timestamp for the last time a resync of the stack took place.
 	LastResyncTime metav1.Time `json:"lastResyncTime,omitempty"`
+	// StartTime is the time at which the update was started, if the state is the outcome of an
+	// update.
+	// +optional
+	StartTime *metav1.Time `json:"startTime,omitempty"`
+	// AttemptGroup identifies the update attempts made for the same change to the stack or its
+	// source. A retry after a failed update belongs to the same attempt group as the original
+	// attempt.
+	AttemptGroup string `json:"attemptGroup,omitempty"`
+	// Attempts is the number of update attempts made in the attempt group.
+	Attempts int `json:"attempts,omitempty"`
+	// AttemptGeneration is the generation of the stack's spec for which the attempts in the
+	// attempt group were made.
+	// +optional
+	AttemptGeneration int64 `json:"attemptGeneration,omitempty"`
+	// ResourceChanges counts the resource changes by operation (e.g., create, update, delete)
+	// across all the update attempts in the attempt group.
+	ResourceChanges map[string]int `json:"resourceChanges,omitempty"`
 }
 
 // StackUpdateStatus is the status code for the result of a Stack Update run.
@@ -387,6 +1299,13 @@ const (
 	// StackNotFound indicates that the stack update failed to complete due
 	// to stack not being found (HTTP 404) in the Pulumi Service.
 	StackNotFound StackUpdateStatus = 4
+	// StackUpdateTimeout indicates that the stack update was cancelled because it
+	// did not complete within the time given by UpdateTimeoutSeconds.
+	StackUpdateTimeout StackUpdateStatus = 5
+	// StackUpdateRetryable indicates that the stack update failed because of an error which is
+	// likely to be transient (e.g., a provider's rate limit, a 5xx response from a provider's API,
+	// or a network timeout), so that it's worth retrying.
+	StackUpdateRetryable StackUpdateStatus = 6
 )
 
 type StackUpdateStateMessage string
@@ -5,9 +5,30 @@
 package shared
 
 import (
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *BackendAuth) DeepCopyInto(out *BackendAuth) {
+	*out = *in
+	if in.BasicAuth != nil {
+		in, out := &in.BasicAuth, &out.BasicAuth
+		*out = new(BasicAuth)
+		(*in).DeepCopyInto(*out)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new BackendAuth.
+func (in *BackendAuth) DeepCopy() *BackendAuth {
+	if in == nil {
+		return nil
+	}
+	out := new(BackendAuth)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *BasicAuth) DeepCopyInto(out *BasicAuth) {
 	*out = *in
@@ -25,6 +46,164 @@ func (in *BasicAuth) DeepCopy() *BasicAuth {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CodeCommitAuth) DeepCopyInto(out *CodeCommitAuth) {
+	*out = *in
+	if in.AccessKeyID != nil {
+		in, out := &in.AccessKeyID, &out.AccessKeyID
+		*out = new(ResourceRef)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.SecretAccessKey != nil {
+		in, out := &in.SecretAccessKey, &out.SecretAccessKey
+		*out = new(ResourceRef)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.SessionToken != nil {
+		in, out := &in.SessionToken, &out.SessionToken
+		*out = new(ResourceRef)
+		(*in).DeepCopyInto(*out)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CodeCommitAuth.
+func (in *CodeCommitAuth) DeepCopy() *CodeCommitAuth {
+	if in == nil {
+		return nil
+	}
+	out := new(CodeCommitAuth)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ConfigFromConfigMapReference) DeepCopyInto(out *ConfigFromConfigMapReference) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ConfigFromConfigMapReference.
+func (in *ConfigFromConfigMapReference) DeepCopy() *ConfigFromConfigMapReference {
+	if in == nil {
+		return nil
+	}
+	out := new(ConfigFromConfigMapReference)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ConfigFromSource) DeepCopyInto(out *ConfigFromSource) {
+	*out = *in
+	out.ConfigMapRef = in.ConfigMapRef
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ConfigFromSource.
+func (in *ConfigFromSource) DeepCopy() *ConfigFromSource {
+	if in == nil {
+		return nil
+	}
+	out := new(ConfigFromSource)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ConfigMapSelector) DeepCopyInto(out *ConfigMapSelector) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ConfigMapSelector.
+func (in *ConfigMapSelector) DeepCopy() *ConfigMapSelector {
+	if in == nil {
+		return nil
+	}
+	out := new(ConfigMapSelector)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ConfigValue) DeepCopyInto(out *ConfigValue) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ConfigValue.
+func (in *ConfigValue) DeepCopy() *ConfigValue {
+	if in == nil {
+		return nil
+	}
+	out := new(ConfigValue)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *DestroyOptions) DeepCopyInto(out *DestroyOptions) {
+	*out = *in
+	if in.ApprovalValidity != nil {
+		in, out := &in.ApprovalValidity, &out.ApprovalValidity
+		*out = new(v1.Duration)
+		**out = **in
+	}
+	if in.Credentials != nil {
+		in, out := &in.Credentials, &out.Credentials
+		*out = make(map[string]ResourceRef, len(*in))
+		for key, val := range *in {
+			(*out)[key] = *val.DeepCopy()
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new DestroyOptions.
+func (in *DestroyOptions) DeepCopy() *DestroyOptions {
+	if in == nil {
+		return nil
+	}
+	out := new(DestroyOptions)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *EnvFromObjectReference) DeepCopyInto(out *EnvFromObjectReference) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new EnvFromObjectReference.
+func (in *EnvFromObjectReference) DeepCopy() *EnvFromObjectReference {
+	if in == nil {
+		return nil
+	}
+	out := new(EnvFromObjectReference)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *EnvFromSource) DeepCopyInto(out *EnvFromSource) {
+	*out = *in
+	if in.SecretRef != nil {
+		in, out := &in.SecretRef, &out.SecretRef
+		*out = new(EnvFromObjectReference)
+		**out = **in
+	}
+	if in.ConfigMapRef != nil {
+		in, out := &in.ConfigMapRef, &out.ConfigMapRef
+		*out = new(EnvFromObjectReference)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new EnvFromSource.
+func (in *EnvFromSource) DeepCopy() *EnvFromSource {
+	if in == nil {
+		return nil
+	}
+	out := new(EnvFromSource)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *EnvSelector) DeepCopyInto(out *EnvSelector) {
 	*out = *in
@@ -55,6 +234,21 @@ func (in *FSSelector) DeepCopy() *FSSelector {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *FieldRefSelector) DeepCopyInto(out *FieldRefSelector) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new FieldRefSelector.
+func (in *FieldRefSelector) DeepCopy() *FieldRefSelector {
+	if in == nil {
+		return nil
+	}
+	out := new(FieldRefSelector)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *FluxSource) DeepCopyInto(out *FluxSource) {
 	*out = *in
@@ -104,6 +298,26 @@ func (in *GitAuthConfig) DeepCopyInto(out *GitAuthConfig) {
 		*out = new(BasicAuth)
 		(*in).DeepCopyInto(*out)
 	}
+	if in.CodeCommit != nil {
+		in, out := &in.CodeCommit, &out.CodeCommit
+		*out = new(CodeCommitAuth)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.KnownHosts != nil {
+		in, out := &in.KnownHosts, &out.KnownHosts
+		*out = new(ResourceRef)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.StrictHostKeyChecking != nil {
+		in, out := &in.StrictHostKeyChecking, &out.StrictHostKeyChecking
+		*out = new(bool)
+		**out = **in
+	}
+	if in.CABundle != nil {
+		in, out := &in.CABundle, &out.CABundle
+		*out = new(ResourceRef)
+		(*in).DeepCopyInto(*out)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new GitAuthConfig.
@@ -119,11 +333,31 @@ func (in *GitAuthConfig) DeepCopy() *GitAuthConfig {
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *GitSource) DeepCopyInto(out *GitSource) {
 	*out = *in
+	if in.ArchiveAuth != nil {
+		in, out := &in.ArchiveAuth, &out.ArchiveAuth
+		*out = new(ResourceRef)
+		(*in).DeepCopyInto(*out)
+	}
 	if in.GitAuth != nil {
 		in, out := &in.GitAuth, &out.GitAuth
 		*out = new(GitAuthConfig)
 		(*in).DeepCopyInto(*out)
 	}
+	if in.PushWebhook != nil {
+		in, out := &in.PushWebhook, &out.PushWebhook
+		*out = new(PushWebhook)
+		**out = **in
+	}
+	if in.GitProxyAuth != nil {
+		in, out := &in.GitProxyAuth, &out.GitProxyAuth
+		*out = new(BasicAuth)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.GitTLS != nil {
+		in, out := &in.GitTLS, &out.GitTLS
+		*out = new(GitTLSConfig)
+		(*in).DeepCopyInto(*out)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new GitSource.
@@ -136,6 +370,41 @@ func (in *GitSource) DeepCopy() *GitSource {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *GitTLSConfig) DeepCopyInto(out *GitTLSConfig) {
+	*out = *in
+	if in.CABundle != nil {
+		in, out := &in.CABundle, &out.CABundle
+		*out = new(ResourceRef)
+		(*in).DeepCopyInto(*out)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new GitTLSConfig.
+func (in *GitTLSConfig) DeepCopy() *GitTLSConfig {
+	if in == nil {
+		return nil
+	}
+	out := new(GitTLSConfig)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ImportSpec) DeepCopyInto(out *ImportSpec) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ImportSpec.
+func (in *ImportSpec) DeepCopy() *ImportSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(ImportSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *LiteralRef) DeepCopyInto(out *LiteralRef) {
 	*out = *in
@@ -151,6 +420,28 @@ func (in *LiteralRef) DeepCopy() *LiteralRef {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *Notifications) DeepCopyInto(out *Notifications) {
+	*out = *in
+	if in.Webhooks != nil {
+		in, out := &in.Webhooks, &out.Webhooks
+		*out = make([]WebhookNotification, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new Notifications.
+func (in *Notifications) DeepCopy() *Notifications {
+	if in == nil {
+		return nil
+	}
+	out := new(Notifications)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *PrerequisiteRef) DeepCopyInto(out *PrerequisiteRef) {
 	*out = *in
@@ -171,6 +462,41 @@ func (in *PrerequisiteRef) DeepCopy() *PrerequisiteRef {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ProgramConfigMapReference) DeepCopyInto(out *ProgramConfigMapReference) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ProgramConfigMapReference.
+func (in *ProgramConfigMapReference) DeepCopy() *ProgramConfigMapReference {
+	if in == nil {
+		return nil
+	}
+	out := new(ProgramConfigMapReference)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ProgramFromSource) DeepCopyInto(out *ProgramFromSource) {
+	*out = *in
+	if in.ConfigMap != nil {
+		in, out := &in.ConfigMap, &out.ConfigMap
+		*out = new(ProgramConfigMapReference)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ProgramFromSource.
+func (in *ProgramFromSource) DeepCopy() *ProgramFromSource {
+	if in == nil {
+		return nil
+	}
+	out := new(ProgramFromSource)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *ProgramReference) DeepCopyInto(out *ProgramReference) {
 	*out = *in
@@ -186,6 +512,42 @@ func (in *ProgramReference) DeepCopy() *ProgramReference {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PushWebhook) DeepCopyInto(out *PushWebhook) {
+	*out = *in
+	out.SecretRef = in.SecretRef
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PushWebhook.
+func (in *PushWebhook) DeepCopy() *PushWebhook {
+	if in == nil {
+		return nil
+	}
+	out := new(PushWebhook)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *RefreshConfig) DeepCopyInto(out *RefreshConfig) {
+	*out = *in
+	if in.IgnoreTargets != nil {
+		in, out := &in.IgnoreTargets, &out.IgnoreTargets
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new RefreshConfig.
+func (in *RefreshConfig) DeepCopy() *RefreshConfig {
+	if in == nil {
+		return nil
+	}
+	out := new(RefreshConfig)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *RequirementSpec) DeepCopyInto(out *RequirementSpec) {
 	*out = *in
@@ -194,6 +556,16 @@ func (in *RequirementSpec) DeepCopyInto(out *RequirementSpec) {
 		*out = new(v1.Duration)
 		**out = **in
 	}
+	if in.VerifyWithinDuration != nil {
+		in, out := &in.VerifyWithinDuration, &out.VerifyWithinDuration
+		*out = new(v1.Duration)
+		**out = **in
+	}
+	if in.VerifyOutputs != nil {
+		in, out := &in.VerifyOutputs, &out.VerifyOutputs
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new RequirementSpec.
@@ -240,11 +612,31 @@ func (in *ResourceSelector) DeepCopyInto(out *ResourceSelector) {
 		*out = new(SecretSelector)
 		**out = **in
 	}
+	if in.ConfigMapRef != nil {
+		in, out := &in.ConfigMapRef, &out.ConfigMapRef
+		*out = new(ConfigMapSelector)
+		**out = **in
+	}
 	if in.LiteralRef != nil {
 		in, out := &in.LiteralRef, &out.LiteralRef
 		*out = new(LiteralRef)
 		**out = **in
 	}
+	if in.Vault != nil {
+		in, out := &in.Vault, &out.Vault
+		*out = new(VaultSelector)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.StackOutput != nil {
+		in, out := &in.StackOutput, &out.StackOutput
+		*out = new(StackOutputSelector)
+		**out = **in
+	}
+	if in.FieldRef != nil {
+		in, out := &in.FieldRef, &out.FieldRef
+		*out = new(FieldRefSelector)
+		**out = **in
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ResourceSelector.
@@ -257,6 +649,21 @@ func (in *ResourceSelector) DeepCopy() *ResourceSelector {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *RetryPolicy) DeepCopyInto(out *RetryPolicy) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new RetryPolicy.
+func (in *RetryPolicy) DeepCopy() *RetryPolicy {
+	if in == nil {
+		return nil
+	}
+	out := new(RetryPolicy)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *SSHAuth) DeepCopyInto(out *SSHAuth) {
 	*out = *in
@@ -278,6 +685,21 @@ func (in *SSHAuth) DeepCopy() *SSHAuth {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SecretKeyReference) DeepCopyInto(out *SecretKeyReference) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SecretKeyReference.
+func (in *SecretKeyReference) DeepCopy() *SecretKeyReference {
+	if in == nil {
+		return nil
+	}
+	out := new(SecretKeyReference)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *SecretSelector) DeepCopyInto(out *SecretSelector) {
 	*out = *in
@@ -293,6 +715,68 @@ func (in *SecretSelector) DeepCopy() *SecretSelector {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SecretsFromSecretReference) DeepCopyInto(out *SecretsFromSecretReference) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SecretsFromSecretReference.
+func (in *SecretsFromSecretReference) DeepCopy() *SecretsFromSecretReference {
+	if in == nil {
+		return nil
+	}
+	out := new(SecretsFromSecretReference)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SecretsFromSource) DeepCopyInto(out *SecretsFromSource) {
+	*out = *in
+	out.SecretRef = in.SecretRef
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SecretsFromSource.
+func (in *SecretsFromSource) DeepCopy() *SecretsFromSource {
+	if in == nil {
+		return nil
+	}
+	out := new(SecretsFromSource)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *StackConfigSource) DeepCopyInto(out *StackConfigSource) {
+	*out = *in
+	out.ConfigMapRef = in.ConfigMapRef
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new StackConfigSource.
+func (in *StackConfigSource) DeepCopy() *StackConfigSource {
+	if in == nil {
+		return nil
+	}
+	out := new(StackConfigSource)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *StackOutputSelector) DeepCopyInto(out *StackOutputSelector) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new StackOutputSelector.
+func (in *StackOutputSelector) DeepCopy() *StackOutputSelector {
+	if in == nil {
+		return nil
+	}
+	out := new(StackOutputSelector)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in StackOutputs) DeepCopyInto(out *StackOutputs) {
 	{
@@ -314,6 +798,42 @@ func (in StackOutputs) DeepCopy() StackOutputs {
 	return *out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *StackReference) DeepCopyInto(out *StackReference) {
+	*out = *in
+	if in.Config != nil {
+		in, out := &in.Config, &out.Config
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	if in.SecretConfig != nil {
+		in, out := &in.SecretConfig, &out.SecretConfig
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	if in.Env != nil {
+		in, out := &in.Env, &out.Env
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new StackReference.
+func (in *StackReference) DeepCopy() *StackReference {
+	if in == nil {
+		return nil
+	}
+	out := new(StackReference)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *StackSpec) DeepCopyInto(out *StackSpec) {
 	*out = *in
@@ -329,11 +849,35 @@ func (in *StackSpec) DeepCopyInto(out *StackSpec) {
 			(*out)[key] = *val.DeepCopy()
 		}
 	}
+	if in.EnvFrom != nil {
+		in, out := &in.EnvFrom, &out.EnvFrom
+		*out = make([]EnvFromSource, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.DotEnvRefs != nil {
+		in, out := &in.DotEnvRefs, &out.DotEnvRefs
+		*out = make([]ResourceRef, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
 	if in.SecretEnvs != nil {
 		in, out := &in.SecretEnvs, &out.SecretEnvs
 		*out = make([]string, len(*in))
 		copy(*out, *in)
 	}
+	if in.BackendAuth != nil {
+		in, out := &in.BackendAuth, &out.BackendAuth
+		*out = new(BackendAuth)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.CredentialMaxAge != nil {
+		in, out := &in.CredentialMaxAge, &out.CredentialMaxAge
+		*out = new(v1.Duration)
+		**out = **in
+	}
 	if in.Config != nil {
 		in, out := &in.Config, &out.Config
 		*out = make(map[string]string, len(*in))
@@ -341,6 +885,37 @@ func (in *StackSpec) DeepCopyInto(out *StackSpec) {
 			(*out)[key] = val
 		}
 	}
+	if in.ConfigValues != nil {
+		in, out := &in.ConfigValues, &out.ConfigValues
+		*out = make(map[string]ConfigValue, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	if in.ConfigRefs != nil {
+		in, out := &in.ConfigRefs, &out.ConfigRefs
+		*out = make(map[string]ResourceRef, len(*in))
+		for key, val := range *in {
+			(*out)[key] = *val.DeepCopy()
+		}
+	}
+	if in.ConfigPath != nil {
+		in, out := &in.ConfigPath, &out.ConfigPath
+		*out = make(map[string]apiextensionsv1.JSON, len(*in))
+		for key, val := range *in {
+			(*out)[key] = *val.DeepCopy()
+		}
+	}
+	if in.ConfigFrom != nil {
+		in, out := &in.ConfigFrom, &out.ConfigFrom
+		*out = make([]ConfigFromSource, len(*in))
+		copy(*out, *in)
+	}
+	if in.StackConfigFrom != nil {
+		in, out := &in.StackConfigFrom, &out.StackConfigFrom
+		*out = new(StackConfigSource)
+		**out = **in
+	}
 	if in.Secrets != nil {
 		in, out := &in.Secrets, &out.Secrets
 		*out = make(map[string]string, len(*in))
@@ -355,6 +930,28 @@ func (in *StackSpec) DeepCopyInto(out *StackSpec) {
 			(*out)[key] = *val.DeepCopy()
 		}
 	}
+	if in.SecretsFrom != nil {
+		in, out := &in.SecretsFrom, &out.SecretsFrom
+		*out = make([]SecretsFromSource, len(*in))
+		copy(*out, *in)
+	}
+	if in.Environments != nil {
+		in, out := &in.Environments, &out.Environments
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.Tags != nil {
+		in, out := &in.Tags, &out.Tags
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	if in.SecretsProviderPassphraseRef != nil {
+		in, out := &in.SecretsProviderPassphraseRef, &out.SecretsProviderPassphraseRef
+		*out = new(ResourceRef)
+		(*in).DeepCopyInto(*out)
+	}
 	if in.GitSource != nil {
 		in, out := &in.GitSource, &out.GitSource
 		*out = new(GitSource)
@@ -370,6 +967,21 @@ func (in *StackSpec) DeepCopyInto(out *StackSpec) {
 		*out = new(ProgramReference)
 		**out = **in
 	}
+	if in.ProgramFrom != nil {
+		in, out := &in.ProgramFrom, &out.ProgramFrom
+		*out = new(ProgramFromSource)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Patches != nil {
+		in, out := &in.Patches, &out.Patches
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.PersistWorkspace != nil {
+		in, out := &in.PersistWorkspace, &out.PersistWorkspace
+		*out = new(bool)
+		**out = **in
+	}
 	if in.Targets != nil {
 		in, out := &in.Targets, &out.Targets
 		*out = make([]string, len(*in))
@@ -382,6 +994,58 @@ func (in *StackSpec) DeepCopyInto(out *StackSpec) {
 			(*in)[i].DeepCopyInto(&(*out)[i])
 		}
 	}
+	if in.DependsOn != nil {
+		in, out := &in.DependsOn, &out.DependsOn
+		*out = make([]StackReference, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.RefreshConfig != nil {
+		in, out := &in.RefreshConfig, &out.RefreshConfig
+		*out = new(RefreshConfig)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.PreRunCommands != nil {
+		in, out := &in.PreRunCommands, &out.PreRunCommands
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.Imports != nil {
+		in, out := &in.Imports, &out.Imports
+		*out = make([]ImportSpec, len(*in))
+		copy(*out, *in)
+	}
+	if in.PostRunCommands != nil {
+		in, out := &in.PostRunCommands, &out.PostRunCommands
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.DestroyOptions != nil {
+		in, out := &in.DestroyOptions, &out.DestroyOptions
+		*out = new(DestroyOptions)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.RetryPolicy != nil {
+		in, out := &in.RetryPolicy, &out.RetryPolicy
+		*out = new(RetryPolicy)
+		**out = **in
+	}
+	if in.HistoryLimit != nil {
+		in, out := &in.HistoryLimit, &out.HistoryLimit
+		*out = new(int32)
+		**out = **in
+	}
+	if in.Notifications != nil {
+		in, out := &in.Notifications, &out.Notifications
+		*out = new(Notifications)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.InitialReconcileDelaySeconds != nil {
+		in, out := &in.InitialReconcileDelaySeconds, &out.InitialReconcileDelaySeconds
+		*out = new(int64)
+		**out = **in
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new StackSpec.
@@ -425,6 +1089,18 @@ func (in *StackStatus) DeepCopy() *StackStatus {
 func (in *StackUpdateState) DeepCopyInto(out *StackUpdateState) {
 	*out = *in
 	in.LastResyncTime.DeepCopyInto(&out.LastResyncTime)
+	if in.StartTime != nil {
+		in, out := &in.StartTime, &out.StartTime
+		*out = new(v1.Time)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.ResourceChanges != nil {
+		in, out := &in.ResourceChanges, &out.ResourceChanges
+		*out = make(map[string]int, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new StackUpdateState.
@@ -436,3 +1112,84 @@ func (in *StackUpdateState) DeepCopy() *StackUpdateState {
 	in.DeepCopyInto(out)
 	return out
 }
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *VaultAuth) DeepCopyInto(out *VaultAuth) {
+	*out = *in
+	if in.TokenSecretRef != nil {
+		in, out := &in.TokenSecretRef, &out.TokenSecretRef
+		*out = new(SecretSelector)
+		**out = **in
+	}
+	if in.Kubernetes != nil {
+		in, out := &in.Kubernetes, &out.Kubernetes
+		*out = new(VaultKubernetesAuth)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new VaultAuth.
+func (in *VaultAuth) DeepCopy() *VaultAuth {
+	if in == nil {
+		return nil
+	}
+	out := new(VaultAuth)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *VaultKubernetesAuth) DeepCopyInto(out *VaultKubernetesAuth) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new VaultKubernetesAuth.
+func (in *VaultKubernetesAuth) DeepCopy() *VaultKubernetesAuth {
+	if in == nil {
+		return nil
+	}
+	out := new(VaultKubernetesAuth)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *VaultSelector) DeepCopyInto(out *VaultSelector) {
+	*out = *in
+	in.Auth.DeepCopyInto(&out.Auth)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new VaultSelector.
+func (in *VaultSelector) DeepCopy() *VaultSelector {
+	if in == nil {
+		return nil
+	}
+	out := new(VaultSelector)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *WebhookNotification) DeepCopyInto(out *WebhookNotification) {
+	*out = *in
+	if in.AuthHeader != nil {
+		in, out := &in.AuthHeader, &out.AuthHeader
+		*out = new(ResourceRef)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.On != nil {
+		in, out := &in.On, &out.On
+		*out = make([]StackUpdateStateMessage, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new WebhookNotification.
+func (in *WebhookNotification) DeepCopy() *WebhookNotification {
+	if in == nil {
+		return nil
+	}
+	out := new(WebhookNotification)
+	in.DeepCopyInto(out)
+	return out
+}
@@ -35,13 +35,26 @@ const (
 	StackGitAuthFailure         StackEventReason = "StackGitAuthenticationFailure"
 	StackUpdateFailure          StackEventReason = "StackUpdateFailure"
 	StackUpdateConflictDetected StackEventReason = "StackUpdateConflictDetected"
+	StackUpdateTransientFailure StackEventReason = "StackUpdateTransientFailure"
 	StackOutputRetrievalFailure StackEventReason = "StackOutputRetrievalFailure"
+	StackUpdateCancelled        StackEventReason = "StackUpdateCancelled"
+	StackUnknownFields          StackEventReason = "StackUnknownFields"
+	ReconciliationAbandoned     StackEventReason = "ReconciliationAbandoned"
+	StackDriftDetected          StackEventReason = "StackDriftDetected"
+	StackPatched                StackEventReason = "StackPatched"
+	StackCredentialsStale       StackEventReason = "StackCredentialsStale"
+	StackDestroySkipped         StackEventReason = "StackDestroySkipped"
+	StackDestroyApprovalNeeded  StackEventReason = "StackDestroyApprovalNeeded"
+	StackWarningsAggregated     StackEventReason = "StackWarningsAggregated"
 
 	// Normals
 
 	StackUpdateDetected   StackEventReason = "StackUpdateDetected"
 	StackNotFound         StackEventReason = "StackNotFound"
 	StackUpdateSuccessful StackEventReason = "StackCreated"
+	StackReconcileTimings StackEventReason = "StackReconcileTimings"
+	StackUpdateRecovered  StackEventReason = "StackUpdateRecovered"
+	StackElevatedDestroy  StackEventReason = "StackElevatedDestroy"
 )
 
 func StackConfigInvalidEvent() StackEvent {
@@ -64,10 +77,18 @@ func StackUpdateConflictDetectedEvent() StackEvent {
 	return StackEvent{eventType: EventTypeWarning, reason: StackUpdateConflictDetected}
 }
 
+func StackUpdateTransientFailureEvent() StackEvent {
+	return StackEvent{eventType: EventTypeWarning, reason: StackUpdateTransientFailure}
+}
+
 func StackOutputRetrievalFailureEvent() StackEvent {
 	return StackEvent{eventType: EventTypeWarning, reason: StackOutputRetrievalFailure}
 }
 
+func StackUpdateCancelledEvent() StackEvent {
+	return StackEvent{eventType: EventTypeWarning, reason: StackUpdateCancelled}
+}
+
 func StackUpdateDetectedEvent() StackEvent {
 	return StackEvent{eventType: EventTypeNormal, reason: StackUpdateDetected}
 }
@@ -79,3 +100,47 @@ func StackNotFoundEvent() StackEvent {
 func StackUpdateSuccessfulEvent() StackEvent {
 	return StackEvent{eventType: EventTypeNormal, reason: StackUpdateSuccessful}
 }
+
+func StackUnknownFieldsEvent() StackEvent {
+	return StackEvent{eventType: EventTypeWarning, reason: StackUnknownFields}
+}
+
+func ReconciliationAbandonedEvent() StackEvent {
+	return StackEvent{eventType: EventTypeWarning, reason: ReconciliationAbandoned}
+}
+
+func StackDriftDetectedEvent() StackEvent {
+	return StackEvent{eventType: EventTypeWarning, reason: StackDriftDetected}
+}
+
+func StackPatchedEvent() StackEvent {
+	return StackEvent{eventType: EventTypeWarning, reason: StackPatched}
+}
+
+func StackCredentialsStaleEvent() StackEvent {
+	return StackEvent{eventType: EventTypeWarning, reason: StackCredentialsStale}
+}
+
+func StackDestroySkippedEvent() StackEvent {
+	return StackEvent{eventType: EventTypeWarning, reason: StackDestroySkipped}
+}
+
+func StackDestroyApprovalNeededEvent() StackEvent {
+	return StackEvent{eventType: EventTypeWarning, reason: StackDestroyApprovalNeeded}
+}
+
+func StackWarningsAggregatedEvent() StackEvent {
+	return StackEvent{eventType: EventTypeWarning, reason: StackWarningsAggregated}
+}
+
+func StackReconcileTimingsEvent() StackEvent {
+	return StackEvent{eventType: EventTypeNormal, reason: StackReconcileTimings}
+}
+
+func StackUpdateRecoveredEvent() StackEvent {
+	return StackEvent{eventType: EventTypeNormal, reason: StackUpdateRecovered}
+}
+
+func StackElevatedDestroyEvent() StackEvent {
+	return StackEvent{eventType: EventTypeNormal, reason: StackElevatedDestroy}
+}
@@ -15,16 +15,350 @@ type StackStatus struct {
 	Outputs shared.StackOutputs `json:"outputs,omitempty"`
 	// LastUpdate contains details of the status of the last update.
 	LastUpdate *shared.StackUpdateState `json:"lastUpdate,omitempty"`
-	// ObservedGeneration records the value of .meta.generation at the point the controller last processed this object
+	// History contains details of the most recent updates, oldest first, including the last
+	// update. Retries of a failed update replace it in the history. The number of updates kept is
+	// given by .spec.historyLimit.
+	// +optional
+	// +kubebuilder:validation:MaxItems=20
+	History []shared.StackUpdateState `json:"history,omitempty"`
+	// ObservedGeneration records the value of .meta.generation at the point the controller last
+	// finished processing this object; that is, when the stack was last brought up to date, found
+	// to need a change to its spec before it can be processed (it's abandoned), or paused. It is not
+	// advanced while the stack is being retried, so a value behind .meta.generation means the
+	// latest spec has not yet been put into effect.
 	// +optional
 	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
 	// ObservedReconcileRequest records the value of the annotation named for
 	// `ReconcileRequestAnnotation` when it was last seen.
 	ObservedReconcileRequest string `json:"observedReconcileRequest,omitempty"`
+	// LastReconcileTime is the time at which the controller last processed this object, whatever
+	// the outcome.
+	// +optional
+	LastReconcileTime metav1.Time `json:"lastReconcileTime,omitempty"`
+	// CurrentUpdate records an update started by the operator which has not finished. If this is
+	// present when the stack is not being processed, the update was interrupted.
+	// +optional
+	CurrentUpdate *CurrentStackUpdate `json:"currentUpdate,omitempty"`
+	// LastCancel records the last attempt to cancel an interrupted update.
+	// +optional
+	LastCancel *StackCancelState `json:"lastCancel,omitempty"`
+	// ConflictRetries is the number of times an update has been retried after conflicting with
+	// another update, since an update was last run without a conflict.
+	// +optional
+	ConflictRetries int32 `json:"conflictRetries,omitempty"`
+	// TransientRetries is the number of times an update has been retried after failing with an
+	// error which is likely to be transient (e.g., a provider's rate limit), since an update last
+	// ran without one.
+	// +optional
+	TransientRetries int32 `json:"transientRetries,omitempty"`
+	// Abandoned records that the operator has given up on processing the stack. It is cleared when
+	// the spec is changed, reconciliation is requested, or a Secret the stack refers to is changed.
+	// +optional
+	Abandoned *StackAbandonedState `json:"abandoned,omitempty"`
+	// Verification records the last verification of the stack's resources, requested by a stack
+	// that has this stack as a prerequisite.
+	// +optional
+	Verification *StackVerificationState `json:"verification,omitempty"`
+	// DriftCheck records the last check of the stack for drift, when .spec.driftDetectionOnly is
+	// set.
+	// +optional
+	DriftCheck *StackDriftCheckState `json:"driftCheck,omitempty"`
+	// LastRefresh records the last refresh of the stack, whether run before an update (.spec.refresh),
+	// before destroying the stack, or to check for drift. It's kept apart from LastUpdate, so that
+	// the refresh can be found in the Pulumi Console.
+	// +optional
+	LastRefresh *StackRefreshState `json:"lastRefresh,omitempty"`
+	// LastPreview records the last preview of a stack with .spec.previewOnly set.
+	// +optional
+	LastPreview *StackPreviewState `json:"lastPreview,omitempty"`
+	// Environments are the environments from .spec.environments the operator has attached to the
+	// stack, so that one removed from .spec.environments can be detached.
+	// +optional
+	Environments []string `json:"environments,omitempty"`
+	// ConfigKeys are the configuration keys, in their qualified form, the operator has set on the
+	// stack which weren't checked in with the program, so that one removed from the spec can be
+	// removed when .spec.pruneConfig is set.
+	// +optional
+	ConfigKeys []string `json:"configKeys,omitempty"`
+	// Tags are the keys of the tags from .spec.tags the operator has set on the stack, so that
+	// one removed from .spec.tags can be removed when .spec.pruneTags is set.
+	// +optional
+	Tags []string `json:"tags,omitempty"`
+	// TagsError is the error from the last attempt to set the tags from .spec.tags on the stack, if
+	// it failed. It's cleared once they're set.
+	// +optional
+	TagsError string `json:"tagsError,omitempty"`
+	// DestroyProgress records the progress of destroying the stack, when it's being deleted and
+	// .spec.destroyOnFinalize is set: the revision of the source used, and the batches destroyed,
+	// when .spec.destroyOptions.batchSize is set.
+	// +optional
+	DestroyProgress *StackDestroyProgress `json:"destroyProgress,omitempty"`
+	// Imported records the resources given in .spec.imports which have been imported into the
+	// stack, and when.
+	// +optional
+	Imported []ImportedResource `json:"imported,omitempty"`
+	// LastSecretsProviderChange records the last change of the secrets provider the stack's state
+	// and configuration are encrypted with, made because .spec.secretsProvider differs from it. A
+	// change which failed is tried again the next time the stack is processed.
+	// +optional
+	LastSecretsProviderChange *SecretsProviderChange `json:"lastSecretsProviderChange,omitempty"`
+	// LastReconcileTimings summarizes the time spent in each phase of the last reconciliation that
+	// got as far as processing the stack, e.g., "queue=1.2s fetch=3.4s install=- config=200ms
+	// refresh=- update=21m3.1s status=100ms total=21m7s". A phase that wasn't entered is given as
+	// "-"; the total does not include the time spent queued.
+	// +optional
+	LastReconcileTimings string `json:"lastReconcileTimings,omitempty"`
 	// +optional
 	Conditions []metav1.Condition `json:"conditions,omitempty"`
 }
 
+// ImportedResource records a resource imported into the stack.
+type ImportedResource struct {
+	// Type is the type token of the resource.
+	Type string `json:"type"`
+	// Name is the name of the resource in the program.
+	Name string `json:"name"`
+	// ID is the provider's ID of the resource.
+	ID string `json:"id"`
+	// Time is when the resource was imported.
+	Time metav1.Time `json:"time"`
+}
+
+// SecretsProviderChange records a change of a stack's secrets provider, as made by `pulumi stack
+// change-secrets-provider`.
+type SecretsProviderChange struct {
+	// From is the secrets provider the stack was encrypted with; e.g., "passphrase".
+	From string `json:"from"`
+	// To is the secrets provider given in .spec.secretsProvider.
+	To string `json:"to"`
+	// State is the outcome of the change, one of `succeeded` or `failed`.
+	State shared.StackUpdateStateMessage `json:"state"`
+	// Message gives the reason a change failed.
+	// +optional
+	Message string `json:"message,omitempty"`
+	// Time is when the change was attempted.
+	Time metav1.Time `json:"time"`
+}
+
+// CurrentStackUpdate identifies an update started by the operator.
+type CurrentStackUpdate struct {
+	// Generation is the generation of the Stack object for which the update was started.
+	Generation int64 `json:"generation"`
+	// Commit is the revision of the source being deployed.
+	Commit string `json:"commit,omitempty"`
+	// ReconcileRequest is the value of the annotation named for `ReconcileRequestAnnotation`, if
+	// any, when the update was started.
+	// +optional
+	ReconcileRequest string `json:"reconcileRequest,omitempty"`
+	// ConfigFromRevision identifies the versions of the ConfigMaps given in configFrom, and the
+	// Secrets given in secretsFrom, when the update was started.
+	// +optional
+	ConfigFromRevision string `json:"configFromRevision,omitempty"`
+	// ReferencesRevision identifies the versions of the other Secrets and ConfigMaps the stack
+	// refers to when the update was started.
+	// +optional
+	ReferencesRevision string `json:"referencesRevision,omitempty"`
+	// PatchChecksum is the checksum of the patches given in .spec.patches, if any, which were
+	// applied to the source for the update.
+	// +optional
+	PatchChecksum string `json:"patchChecksum,omitempty"`
+	// StartTime is the time at which the update was started.
+	StartTime metav1.Time `json:"startTime"`
+	// Operator identifies the instance of the operator which started the update, by its pod name,
+	// version and start time. When another instance finds the update recorded, it checks with the
+	// backend whether the update finished before it processes the stack.
+	// +optional
+	Operator string `json:"operator,omitempty"`
+	// HandoverTime is when another instance of the operator first found the update still running
+	// in the backend. That instance waits for the update to finish, for a limited time.
+	// +optional
+	HandoverTime *metav1.Time `json:"handoverTime,omitempty"`
+}
+
+// StackCancelState describes an attempt to cancel an update.
+type StackCancelState struct {
+	// Time is the time at which the cancellation was attempted.
+	Time metav1.Time `json:"time"`
+	// Succeeded is true if the update was cancelled.
+	Succeeded bool `json:"succeeded"`
+	// Message gives the reason the cancellation failed, if it did.
+	// +optional
+	Message string `json:"message,omitempty"`
+}
+
+// StackAbandonedState describes the operator giving up on processing a stack.
+type StackAbandonedState struct {
+	// Reason is the reason given in the Stalled condition when the stack was abandoned.
+	Reason string `json:"reason"`
+	// Message explains why the stack was abandoned.
+	Message string `json:"message,omitempty"`
+	// Time is the time at which the stack was abandoned.
+	Time metav1.Time `json:"time"`
+	// Generation is the generation of the Stack object when it was abandoned.
+	Generation int64 `json:"generation"`
+	// ReconcileRequest is the value of the annotation named for `ReconcileRequestAnnotation`
+	// when the stack was abandoned.
+	// +optional
+	ReconcileRequest string `json:"reconcileRequest,omitempty"`
+}
+
+// StackVerificationState describes a verification of a stack's resources by refreshing its state.
+type StackVerificationState struct {
+	// Request is the value of the annotation named for `VerifyRequestAnnotation` which requested
+	// the verification.
+	Request string `json:"request"`
+	// Time is the time at which the verification finished.
+	Time metav1.Time `json:"time"`
+	// Passed is true if no resource was found to have been deleted out of band. It is false if the
+	// verification found deleted resources, or could not be done.
+	Passed bool `json:"passed"`
+	// Message describes the outcome of the verification.
+	// +optional
+	Message string `json:"message,omitempty"`
+	// DeletedResources is the number of resources found to have been deleted out of band.
+	// +optional
+	DeletedResources int32 `json:"deletedResources,omitempty"`
+	// DriftedOutputs names the outputs of the stack that include the ID of a resource found to
+	// have been deleted.
+	// +optional
+	DriftedOutputs []string `json:"driftedOutputs,omitempty"`
+}
+
+// StackDriftCheckState describes a check of a stack for drift, made by refreshing it.
+type StackDriftCheckState struct {
+	// Time is the time at which the check finished.
+	Time metav1.Time `json:"time"`
+	// Revision is the revision of the source the stack was at when it was checked.
+	// +optional
+	Revision string `json:"revision,omitempty"`
+	// Drifted is true if the refresh changed the stack's state.
+	Drifted bool `json:"drifted"`
+	// ResourceChanges counts the changes the refresh made to the stack's state by operation (e.g.,
+	// update, delete).
+	// +optional
+	ResourceChanges map[string]int `json:"resourceChanges,omitempty"`
+	// Message describes the outcome of the check.
+	// +optional
+	Message string `json:"message,omitempty"`
+	// Permalink is the Pulumi Console URL of the refresh.
+	// +optional
+	Permalink shared.Permalink `json:"permalink,omitempty"`
+}
+
+// StackPreviewState describes a preview of the stack.
+type StackPreviewState struct {
+	// State is the outcome of the preview, one of `succeeded` or `failed`.
+	State shared.StackUpdateStateMessage `json:"state"`
+	// Time is the time at which the preview finished.
+	Time metav1.Time `json:"time"`
+	// Revision is the revision of the source previewed (e.g., a git commit).
+	// +optional
+	Revision string `json:"revision,omitempty"`
+	// ChangesDetected is true if the preview found that an update would change the stack.
+	ChangesDetected bool `json:"changesDetected"`
+	// ResourceChanges counts the changes an update would make by operation (e.g., create,
+	// update, delete, replace).
+	// +optional
+	ResourceChanges map[string]int `json:"resourceChanges,omitempty"`
+	// Message gives the reason a preview failed.
+	// +optional
+	Message string `json:"message,omitempty"`
+	// Permalink is the Pulumi Console URL of the preview.
+	// +optional
+	Permalink shared.Permalink `json:"permalink,omitempty"`
+}
+
+// StackRefreshState describes a refresh of the stack.
+type StackRefreshState struct {
+	// State is the outcome of the refresh, one of `succeeded` or `failed`.
+	State shared.StackUpdateStateMessage `json:"state"`
+	// Time is the time at which the refresh finished.
+	Time metav1.Time `json:"time"`
+	// ChangesDetected is true if the refresh changed the stack's state.
+	ChangesDetected bool `json:"changesDetected"`
+	// ResourceChanges counts the changes the refresh made to the stack's state by operation (e.g.,
+	// update, delete).
+	// +optional
+	ResourceChanges map[string]int `json:"resourceChanges,omitempty"`
+	// Message gives the reason a refresh failed.
+	// +optional
+	Message string `json:"message,omitempty"`
+	// Permalink is the Pulumi Console URL of the refresh.
+	// +optional
+	Permalink shared.Permalink `json:"permalink,omitempty"`
+	// IgnoredTargets are the URNs of the resources left out of the refresh, as given in
+	// .spec.refreshConfig.ignoreTargets.
+	// +optional
+	IgnoredTargets []string `json:"ignoredTargets,omitempty"`
+}
+
+// StackDestroyProgress describes the progress of destroying a stack.
+type StackDestroyProgress struct {
+	// Revision is the revision of the source used to destroy the stack.
+	// +optional
+	Revision string `json:"revision,omitempty"`
+	// BatchesCompleted is the number of batches destroyed so far.
+	BatchesCompleted int32 `json:"batchesCompleted"`
+	// ResourcesRemaining is the number of resources left in the stack's state after the last
+	// batch completed.
+	ResourcesRemaining int32 `json:"resourcesRemaining"`
+	// LastBatchTime is the time at which the last batch completed.
+	// +optional
+	LastBatchTime *metav1.Time `json:"lastBatchTime,omitempty"`
+	// RecoverySteps are the steps taken to recover the stack before destroying it, when
+	// forceDestroy is set, in the last attempt to destroy it.
+	// +optional
+	RecoverySteps []StackRecoveryStep `json:"recoverySteps,omitempty"`
+	// Approval is the preview of the destroy awaiting approval, or approved, when
+	// destroyOptions.approvalRequired is set.
+	// +optional
+	Approval *StackDestroyApproval `json:"approval,omitempty"`
+}
+
+// StackDestroyApproval records a preview of destroying a stack, and its approval.
+type StackDestroyApproval struct {
+	// ID identifies the preview; the destroy is approved by annotating the stack with
+	// `pulumi.com/approve-destroy` set to this.
+	ID string `json:"id"`
+	// PreviewTime is when the preview was run.
+	PreviewTime metav1.Time `json:"previewTime"`
+	// ExpiryTime is the time by which the preview must be approved.
+	ExpiryTime metav1.Time `json:"expiryTime"`
+	// Summary says what the destroy will do.
+	// +optional
+	Summary string `json:"summary,omitempty"`
+	// Message says why an approval was rejected, if the last one was.
+	// +optional
+	Message string `json:"message,omitempty"`
+	// ApprovedBy is the field manager which set the approval annotation, if known.
+	// +optional
+	ApprovedBy string `json:"approvedBy,omitempty"`
+	// ApprovedAt is when the preview was approved.
+	// +optional
+	ApprovedAt *metav1.Time `json:"approvedAt,omitempty"`
+}
+
+const (
+	// RecoveryStepCancel is the recovery step of cancelling any update in progress.
+	RecoveryStepCancel = "Cancel"
+	// RecoveryStepClearPendingOperations is the recovery step of removing pending operations
+	// from the stack's state.
+	RecoveryStepClearPendingOperations = "ClearPendingOperations"
+)
+
+// StackRecoveryStep records a step taken to recover a stack before destroying it.
+type StackRecoveryStep struct {
+	// Step is the step taken, either `Cancel` or `ClearPendingOperations`.
+	Step string `json:"step"`
+	// Time is when the step was taken.
+	Time metav1.Time `json:"time"`
+	// Succeeded is whether the step succeeded.
+	Succeeded bool `json:"succeeded"`
+	// Message says what the step did, or why it failed.
+	// +optional
+	Message string `json:"message,omitempty"`
+}
+
 // The conditions form part of the API. They are used to implement a "ready protocol" which works
 // with tooling like kstatus
 // (https://github.com/kubernetes-sigs/cli-utils/blob/master/pkg/kstatus/README.md), as follows:
@@ -32,6 +366,8 @@ type StackStatus struct {
 //  - if the stack is processed to completion, the condition `Ready` will be present with a value of `True`
 //  - if the stack failed, the condition `Ready` will be present with a value of `False`
 //  - if the stack failed and has not been requeued to retry, the condition `Stalled` will be present with a value of `True`
+//  - if the operator has given up on the stack until it is changed, `Ready` will have the reason
+//    `ReconciliationAbandoned`, and `.status.abandoned` records when and why
 //
 // Assuming a stack has been seen by the controller, it will either have Ready=True, or Ready=False
 // and possibly one of {Stalled,Reconciling}=True.
@@ -50,6 +386,17 @@ const (
 	ReadyCondition       = "Ready"
 	StalledCondition     = "Stalled"
 	ReconcilingCondition = "Reconciling"
+	// DriftedCondition is outside the "ready protocol": it gives the outcome of checking the stack
+	// for drift, when .spec.driftDetectionOnly is set. A stack which has drifted is still ready.
+	DriftedCondition = "Drifted"
+	// CredentialsStaleCondition is also outside the "ready protocol": it says whether any of the
+	// Secrets the stack takes credentials from is older than .spec.credentialMaxAge. It is only
+	// present when credentialMaxAge is set.
+	CredentialsStaleCondition = "CredentialsStale"
+	// RefreshFailedCondition is informational too: it's present when the refresh before the last
+	// update failed, and the update went ahead regardless because .spec.continueOnRefreshError is
+	// set. It's removed once a refresh succeeds.
+	RefreshFailedCondition = "RefreshFailed"
 
 	// These give standard reasons for various status values in the conditions
 
@@ -57,6 +404,8 @@ const (
 	NotReadyInProgressReason = "NotReadyInProgress"
 	// Not ready because it's stalled
 	NotReadyStalledReason = "NotReadyStalled"
+	// Not ready because it's stalled, and the operator has given up on it until it's changed
+	NotReadyAbandonedReason = "ReconciliationAbandoned"
 
 	// Reconciling because the stack is being processed
 	ReconcilingProcessingReason  = "StackProcessing"
@@ -65,6 +414,43 @@ const (
 	ReconcilingRetryReason = "RetryingAfterFailure"
 	// Reconciling because a prerequisite was not satisfied
 	ReconcilingPrerequisiteNotSatisfiedReason = "PrerequisiteNotSatisfied"
+	// Reconciling because the stack is new, and waiting for initialReconcileDelaySeconds to pass
+	ReconcilingInitialDelayReason = "InitialDelay"
+	// Reconciling because an object the stack refers to (e.g., a Secret) does not exist yet
+	ReconcilingWaitingForReferencesReason = "WaitingForReferences"
+	// Reconciling because a Stack whose outputs are used (through dependsOn or a StackOutput ref)
+	// does not exist or has no outputs yet
+	ReconcilingWaitingForDependencyReason = "WaitingForDependency"
+	// Not reconciling, because the stack is paused
+	ReconcilingPausedReason = "Paused"
+	// Reconciling because an update started by another instance of the operator is still running
+	ReconcilingInterruptedUpdateReason = "WaitingForInterruptedUpdate"
+	// Reconciling because a command from preRunCommands or postRunCommands failed, and will be
+	// retried
+	ReconcilingCommandFailedReason = "CommandFailed"
+	// Reconciling because the git repository could not be cloned within gitCloneTimeoutSeconds and
+	// gitCloneRetries, and will be retried
+	ReconcilingGitCloneFailedReason = "GitCloneFailed"
+	// Reconciling because the update failed with an error which is likely to be transient (e.g., a
+	// provider's rate limit), and will be retried
+	ReconcilingTransientErrorReason = "RetryingAfterTransientError"
+	// Reconciling because the update did not complete within updateTimeoutSeconds, and will be
+	// retried
+	ReconcilingUpdateTimeoutReason = "UpdateTimeout"
+	// Reconciling because there's no usable Pulumi project in the source where the stack says to
+	// find it. The stack is retried after a long wait, since the source may be changed to fix this
+	// without the spec changing.
+	ReconcilingProjectNotFoundReason = "ProjectNotFound"
+	// Reconciling because the runtime of the project (e.g., dotnet) is not available where the
+	// operator runs programs. Like ProjectNotFound, the stack is retried after a long wait.
+	ReconcilingRuntimeMismatchReason = "RuntimeMismatch"
+	// Reconciling because an environment given in .spec.environments can't be found. The stack is
+	// retried after a long wait, since the environment may yet be created.
+	ReconcilingEnvironmentNotFoundReason = "EnvironmentNotFound"
+	// Reconciling because the commit given in the git source is not in the repository, or not
+	// within maxFetchDepth commits of a branch. The stack is retried after a long wait, since the
+	// commit may yet be pushed.
+	ReconcilingCommitNotFoundReason = "CommitNotFound"
 
 	// Stalled because the .spec can't be processed as it is
 	StalledSpecInvalidReason = "SpecInvalid"
@@ -74,9 +460,42 @@ const (
 	StalledConflictReason = "UpdateConflict"
 	// Stalled because a cross-namespace ref is used, and namespace isolation is in effect.
 	StalledCrossNamespaceRefForbiddenReason = "CrossNamespaceRefForbidden"
+	// Stalled because the host key of the git server could not be verified against the known hosts.
+	StalledHostKeyVerificationFailedReason = "HostKeyVerificationFailed"
+	// Stalled because the TLS certificate of the git server could not be verified.
+	StalledTLSVerificationFailedReason = "TLSVerificationFailed"
+	// Stalled because the git server rejected the credentials given for it.
+	StalledGitAuthenticationFailedReason = "GitAuthenticationFailed"
+	// Stalled because the patches given in .spec.patches could not be applied to the source.
+	StalledPatchFailedReason = "PatchFailed"
+	// Stalled because a Secret the stack takes credentials from is older than credentialMaxAge,
+	// and credentialAgePolicy is Refuse. The stack is abandoned until it's changed, or one of the
+	// Secrets it refers to is.
+	StalledCredentialsStaleReason = "CredentialsStale"
+	// Stalled because the stack depends, through dependsOn or prerequisites, on a stack which in
+	// turn depends on it.
+	StalledDependencyCycleReason = "DependencyCycle"
+	// Stalled because the stack was deleted with destroyOnFinalize, but has protectResources set
+	// without allowDestroyProtectedResources. The stack keeps its finalizer until the spec changes.
+	StalledDestroyProtectedReason = "DestroyProtected"
 
 	// Ready because processing has completed
 	ReadyCompletedReason = "ProcessingCompleted"
+
+	// Drifted because a refresh changed the stack's state
+	DriftedDetectedReason = "DriftDetected"
+	// Not drifted, as far as the last check found
+	DriftedNoneReason = "NoDriftDetected"
+	// Not known whether drifted, because the check failed
+	DriftedCheckFailedReason = "DriftCheckFailed"
+
+	// Credentials stale because a Secret is older than credentialMaxAge
+	CredentialsStaleReason = "CredentialsOlderThanMaxAge"
+	// Credentials not stale, since all the Secrets are within credentialMaxAge
+	CredentialsWithinMaxAgeReason = "CredentialsWithinMaxAge"
+
+	// Refresh failed, and the error was ignored because of continueOnRefreshError
+	RefreshErrorIgnoredReason = "RefreshErrorIgnored"
 )
 
 // MarkReconcilingCondition arranges the conditions used in the "ready protocol", so to indicate that
@@ -118,6 +537,32 @@ func (s *StackStatus) MarkStalledCondition(reason, msg string) {
 	})
 }
 
+// MarkAbandonedCondition arranges the conditions used in the "ready protocol", so to indicate that
+// the resource is stalled, and that the operator has given up on it. This differs from
+// MarkStalledCondition only in the reason given for the resource not being ready, which gives a
+// single signal for all the ways processing can be abandoned.
+func (s *StackStatus) MarkAbandonedCondition(reason, msg string) {
+	s.MarkStalledCondition(reason, msg)
+	apimeta.SetStatusCondition(&s.Conditions, metav1.Condition{
+		Type:    ReadyCondition,
+		Status:  "False",
+		Reason:  NotReadyAbandonedReason,
+		Message: "reconciliation has been abandoned until the stack is changed",
+	})
+}
+
+// MarkPausedCondition arranges the conditions used in the "ready protocol", so to indicate that
+// the resource is paused, and won't be processed until it's resumed. The Ready and Stalled
+// conditions are left as they are, since they describe the last time the resource was processed.
+func (s *StackStatus) MarkPausedCondition() {
+	apimeta.SetStatusCondition(&s.Conditions, metav1.Condition{
+		Type:    ReconcilingCondition,
+		Status:  "False",
+		Reason:  ReconcilingPausedReason,
+		Message: "the stack is paused",
+	})
+}
+
 // MarkReadyCondition arranges the conditions used in the "ready protocol", so to indicate that
 // the resource is considered up to date.
 func (s *StackStatus) MarkReadyCondition() {
@@ -132,6 +577,60 @@ func (s *StackStatus) MarkReadyCondition() {
 	})
 }
 
+// MarkDriftedCondition records the outcome of checking the stack for drift. A stack which has been
+// found to have drifted stays marked as such until ClearDriftedCondition is called (i.e., it's next
+// updated), since the refresh which found the drift brings the state up to date with it.
+func (s *StackStatus) MarkDriftedCondition(status metav1.ConditionStatus, reason, msg string) {
+	conditions := &s.Conditions
+	if status != metav1.ConditionTrue && apimeta.IsStatusConditionTrue(*conditions, DriftedCondition) {
+		return
+	}
+	apimeta.SetStatusCondition(conditions, metav1.Condition{
+		Type:    DriftedCondition,
+		Status:  status,
+		Reason:  reason,
+		Message: msg,
+	})
+}
+
+// ClearDriftedCondition removes the Drifted condition, once the stack has been updated.
+func (s *StackStatus) ClearDriftedCondition() {
+	apimeta.RemoveStatusCondition(&s.Conditions, DriftedCondition)
+}
+
+// MarkCredentialsStaleCondition records whether the Secrets the stack takes credentials from are
+// older than .spec.credentialMaxAge.
+func (s *StackStatus) MarkCredentialsStaleCondition(status metav1.ConditionStatus, reason, msg string) {
+	apimeta.SetStatusCondition(&s.Conditions, metav1.Condition{
+		Type:    CredentialsStaleCondition,
+		Status:  status,
+		Reason:  reason,
+		Message: msg,
+	})
+}
+
+// ClearCredentialsStaleCondition removes the CredentialsStale condition, when credentialMaxAge is
+// not set.
+func (s *StackStatus) ClearCredentialsStaleCondition() {
+	apimeta.RemoveStatusCondition(&s.Conditions, CredentialsStaleCondition)
+}
+
+// MarkRefreshFailedCondition records that the refresh before an update failed, and the update went
+// ahead regardless.
+func (s *StackStatus) MarkRefreshFailedCondition(msg string) {
+	apimeta.SetStatusCondition(&s.Conditions, metav1.Condition{
+		Type:    RefreshFailedCondition,
+		Status:  metav1.ConditionTrue,
+		Reason:  RefreshErrorIgnoredReason,
+		Message: msg,
+	})
+}
+
+// ClearRefreshFailedCondition removes the RefreshFailed condition, once a refresh succeeds.
+func (s *StackStatus) ClearRefreshFailedCondition() {
+	apimeta.RemoveStatusCondition(&s.Conditions, RefreshFailedCondition)
+}
+
 // +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
 
 // Stack is the Schema for the stacks API
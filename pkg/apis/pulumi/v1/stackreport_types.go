@@ -0,0 +1,106 @@
+// Copyright 2024, Pulumi Corporation.  All rights reserved.
+
+package v1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	// StackReportGlobalName is the name of the StackReport which summarises the stacks in all the
+	// namespaces watched by the operator.
+	StackReportGlobalName = "all-namespaces"
+	// StackReportNamespacePrefix prefixes the name of a StackReport which summarises the stacks in
+	// a single namespace. Since namespace names can't contain dots, these names can't clash with
+	// StackReportGlobalName.
+	StackReportNamespacePrefix = "namespace."
+)
+
+// Stack states counted in a StackReport.
+const (
+	// the stack has not been processed yet
+	StackReportStatePending = "pending"
+	// the stack has an update running
+	StackReportStateInProgress = "in-progress"
+	// the last update of the stack succeeded
+	StackReportStateSucceeded = "succeeded"
+	// the last update of the stack failed, and it will be retried
+	StackReportStateFailed = "failed"
+	// the stack is stalled, or the operator has given up on it
+	StackReportStateStalled = "stalled"
+)
+
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+// StackReport summarises the state of the stacks in a namespace, or in all the namespaces watched
+// by the operator. StackReports are maintained by the operator, when it's configured to do so, so
+// that the state of many stacks can be seen without permission to list the stacks themselves.
+// +kubebuilder:resource:path=stackreports,scope=Cluster
+// +kubebuilder:printcolumn:name="Total",type="integer",JSONPath=".report.total"
+// +kubebuilder:printcolumn:name="Failed",type="integer",JSONPath=".report.states.failed"
+// +kubebuilder:printcolumn:name="Stalled",type="integer",JSONPath=".report.states.stalled"
+// +kubebuilder:printcolumn:name="Updated",type="date",JSONPath=".report.time"
+type StackReport struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	// Report is the summary of the stacks, as last made by the operator.
+	Report StackReportSummary `json:"report,omitempty"`
+}
+
+// StackReportSummary gives counts and names of stacks. Lists of names are limited in length, so
+// that the object stays small however many stacks there are.
+type StackReportSummary struct {
+	// Namespace is the namespace summarised, or empty if the report covers all the namespaces
+	// watched by the operator.
+	// +optional
+	Namespace string `json:"namespace,omitempty"`
+	// Time is the time at which the report was made.
+	Time metav1.Time `json:"time"`
+	// Total is the number of stacks.
+	Total int32 `json:"total"`
+	// States counts the stacks in each state: "pending", "in-progress", "succeeded", "failed" and
+	// "stalled".
+	// +optional
+	States map[string]int32 `json:"states,omitempty"`
+	// StaleStacks names the stacks which have a change to their spec not yet processed, or haven't
+	// been processed within the staleness threshold. Names are given as "namespace/name".
+	// +optional
+	StaleStacks []string `json:"staleStacks,omitempty"`
+	// DriftedStacks names the stacks whose last verification found resources deleted out of band.
+	// Names are given as "namespace/name".
+	// +optional
+	DriftedStacks []string `json:"driftedStacks,omitempty"`
+	// OldestFailingStack identifies the failed or stalled stack that has gone longest without a
+	// successful update.
+	// +optional
+	OldestFailingStack *StackReportEntry `json:"oldestFailingStack,omitempty"`
+	// Truncated is true if any of the lists of names was cut short.
+	// +optional
+	Truncated bool `json:"truncated,omitempty"`
+}
+
+// StackReportEntry identifies a stack in a report.
+type StackReportEntry struct {
+	// Name is the name of the stack, as "namespace/name".
+	Name string `json:"name"`
+	// Since is the time of the stack's last successful update, or of its creation if it has never
+	// been updated successfully.
+	Since metav1.Time `json:"since"`
+	// Message gives the reason for the stack's last failure.
+	// +optional
+	Message string `json:"message,omitempty"`
+}
+
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+// StackReportList contains a list of StackReport
+type StackReportList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []StackReport `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&StackReport{}, &StackReportList{})
+}
@@ -31,6 +31,27 @@ func (in *Configuration) DeepCopy() *Configuration {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CurrentStackUpdate) DeepCopyInto(out *CurrentStackUpdate) {
+	*out = *in
+	in.StartTime.DeepCopyInto(&out.StartTime)
+	if in.HandoverTime != nil {
+		in, out := &in.HandoverTime, &out.HandoverTime
+		*out = new(metav1.Time)
+		(*in).DeepCopyInto(*out)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CurrentStackUpdate.
+func (in *CurrentStackUpdate) DeepCopy() *CurrentStackUpdate {
+	if in == nil {
+		return nil
+	}
+	out := new(CurrentStackUpdate)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *CustomTimeouts) DeepCopyInto(out *CustomTimeouts) {
 	*out = *in
@@ -68,6 +89,22 @@ func (in *Getter) DeepCopy() *Getter {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ImportedResource) DeepCopyInto(out *ImportedResource) {
+	*out = *in
+	in.Time.DeepCopyInto(&out.Time)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ImportedResource.
+func (in *ImportedResource) DeepCopy() *ImportedResource {
+	if in == nil {
+		return nil
+	}
+	out := new(ImportedResource)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *Options) DeepCopyInto(out *Options) {
 	*out = *in
@@ -260,6 +297,22 @@ func (in *Resource) DeepCopy() *Resource {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SecretsProviderChange) DeepCopyInto(out *SecretsProviderChange) {
+	*out = *in
+	in.Time.DeepCopyInto(&out.Time)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SecretsProviderChange.
+func (in *SecretsProviderChange) DeepCopy() *SecretsProviderChange {
+	if in == nil {
+		return nil
+	}
+	out := new(SecretsProviderChange)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *Stack) DeepCopyInto(out *Stack) {
 	*out = *in
@@ -287,6 +340,115 @@ func (in *Stack) DeepCopyObject() runtime.Object {
 	return nil
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *StackAbandonedState) DeepCopyInto(out *StackAbandonedState) {
+	*out = *in
+	in.Time.DeepCopyInto(&out.Time)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new StackAbandonedState.
+func (in *StackAbandonedState) DeepCopy() *StackAbandonedState {
+	if in == nil {
+		return nil
+	}
+	out := new(StackAbandonedState)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *StackCancelState) DeepCopyInto(out *StackCancelState) {
+	*out = *in
+	in.Time.DeepCopyInto(&out.Time)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new StackCancelState.
+func (in *StackCancelState) DeepCopy() *StackCancelState {
+	if in == nil {
+		return nil
+	}
+	out := new(StackCancelState)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *StackDestroyApproval) DeepCopyInto(out *StackDestroyApproval) {
+	*out = *in
+	in.PreviewTime.DeepCopyInto(&out.PreviewTime)
+	in.ExpiryTime.DeepCopyInto(&out.ExpiryTime)
+	if in.ApprovedAt != nil {
+		in, out := &in.ApprovedAt, &out.ApprovedAt
+		*out = new(metav1.Time)
+		(*in).DeepCopyInto(*out)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new StackDestroyApproval.
+func (in *StackDestroyApproval) DeepCopy() *StackDestroyApproval {
+	if in == nil {
+		return nil
+	}
+	out := new(StackDestroyApproval)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *StackDestroyProgress) DeepCopyInto(out *StackDestroyProgress) {
+	*out = *in
+	if in.LastBatchTime != nil {
+		in, out := &in.LastBatchTime, &out.LastBatchTime
+		*out = new(metav1.Time)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.RecoverySteps != nil {
+		in, out := &in.RecoverySteps, &out.RecoverySteps
+		*out = make([]StackRecoveryStep, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.Approval != nil {
+		in, out := &in.Approval, &out.Approval
+		*out = new(StackDestroyApproval)
+		(*in).DeepCopyInto(*out)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new StackDestroyProgress.
+func (in *StackDestroyProgress) DeepCopy() *StackDestroyProgress {
+	if in == nil {
+		return nil
+	}
+	out := new(StackDestroyProgress)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *StackDriftCheckState) DeepCopyInto(out *StackDriftCheckState) {
+	*out = *in
+	in.Time.DeepCopyInto(&out.Time)
+	if in.ResourceChanges != nil {
+		in, out := &in.ResourceChanges, &out.ResourceChanges
+		*out = make(map[string]int, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new StackDriftCheckState.
+func (in *StackDriftCheckState) DeepCopy() *StackDriftCheckState {
+	if in == nil {
+		return nil
+	}
+	out := new(StackDriftCheckState)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *StackEvent) DeepCopyInto(out *StackEvent) {
 	*out = *in
@@ -334,6 +496,185 @@ func (in *StackList) DeepCopyObject() runtime.Object {
 	return nil
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *StackPreviewState) DeepCopyInto(out *StackPreviewState) {
+	*out = *in
+	in.Time.DeepCopyInto(&out.Time)
+	if in.ResourceChanges != nil {
+		in, out := &in.ResourceChanges, &out.ResourceChanges
+		*out = make(map[string]int, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new StackPreviewState.
+func (in *StackPreviewState) DeepCopy() *StackPreviewState {
+	if in == nil {
+		return nil
+	}
+	out := new(StackPreviewState)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *StackRecoveryStep) DeepCopyInto(out *StackRecoveryStep) {
+	*out = *in
+	in.Time.DeepCopyInto(&out.Time)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new StackRecoveryStep.
+func (in *StackRecoveryStep) DeepCopy() *StackRecoveryStep {
+	if in == nil {
+		return nil
+	}
+	out := new(StackRecoveryStep)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *StackRefreshState) DeepCopyInto(out *StackRefreshState) {
+	*out = *in
+	in.Time.DeepCopyInto(&out.Time)
+	if in.ResourceChanges != nil {
+		in, out := &in.ResourceChanges, &out.ResourceChanges
+		*out = make(map[string]int, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	if in.IgnoredTargets != nil {
+		in, out := &in.IgnoredTargets, &out.IgnoredTargets
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new StackRefreshState.
+func (in *StackRefreshState) DeepCopy() *StackRefreshState {
+	if in == nil {
+		return nil
+	}
+	out := new(StackRefreshState)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *StackReport) DeepCopyInto(out *StackReport) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Report.DeepCopyInto(&out.Report)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new StackReport.
+func (in *StackReport) DeepCopy() *StackReport {
+	if in == nil {
+		return nil
+	}
+	out := new(StackReport)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *StackReport) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *StackReportEntry) DeepCopyInto(out *StackReportEntry) {
+	*out = *in
+	in.Since.DeepCopyInto(&out.Since)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new StackReportEntry.
+func (in *StackReportEntry) DeepCopy() *StackReportEntry {
+	if in == nil {
+		return nil
+	}
+	out := new(StackReportEntry)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *StackReportList) DeepCopyInto(out *StackReportList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]StackReport, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new StackReportList.
+func (in *StackReportList) DeepCopy() *StackReportList {
+	if in == nil {
+		return nil
+	}
+	out := new(StackReportList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *StackReportList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *StackReportSummary) DeepCopyInto(out *StackReportSummary) {
+	*out = *in
+	in.Time.DeepCopyInto(&out.Time)
+	if in.States != nil {
+		in, out := &in.States, &out.States
+		*out = make(map[string]int32, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	if in.StaleStacks != nil {
+		in, out := &in.StaleStacks, &out.StaleStacks
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.DriftedStacks != nil {
+		in, out := &in.DriftedStacks, &out.DriftedStacks
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.OldestFailingStack != nil {
+		in, out := &in.OldestFailingStack, &out.OldestFailingStack
+		*out = new(StackReportEntry)
+		(*in).DeepCopyInto(*out)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new StackReportSummary.
+func (in *StackReportSummary) DeepCopy() *StackReportSummary {
+	if in == nil {
+		return nil
+	}
+	out := new(StackReportSummary)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *StackStatus) DeepCopyInto(out *StackStatus) {
 	*out = *in
@@ -349,6 +690,81 @@ func (in *StackStatus) DeepCopyInto(out *StackStatus) {
 		*out = new(shared.StackUpdateState)
 		(*in).DeepCopyInto(*out)
 	}
+	if in.History != nil {
+		in, out := &in.History, &out.History
+		*out = make([]shared.StackUpdateState, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	in.LastReconcileTime.DeepCopyInto(&out.LastReconcileTime)
+	if in.CurrentUpdate != nil {
+		in, out := &in.CurrentUpdate, &out.CurrentUpdate
+		*out = new(CurrentStackUpdate)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.LastCancel != nil {
+		in, out := &in.LastCancel, &out.LastCancel
+		*out = new(StackCancelState)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Abandoned != nil {
+		in, out := &in.Abandoned, &out.Abandoned
+		*out = new(StackAbandonedState)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Verification != nil {
+		in, out := &in.Verification, &out.Verification
+		*out = new(StackVerificationState)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.DriftCheck != nil {
+		in, out := &in.DriftCheck, &out.DriftCheck
+		*out = new(StackDriftCheckState)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.LastRefresh != nil {
+		in, out := &in.LastRefresh, &out.LastRefresh
+		*out = new(StackRefreshState)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.LastPreview != nil {
+		in, out := &in.LastPreview, &out.LastPreview
+		*out = new(StackPreviewState)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Environments != nil {
+		in, out := &in.Environments, &out.Environments
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.ConfigKeys != nil {
+		in, out := &in.ConfigKeys, &out.ConfigKeys
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.Tags != nil {
+		in, out := &in.Tags, &out.Tags
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.DestroyProgress != nil {
+		in, out := &in.DestroyProgress, &out.DestroyProgress
+		*out = new(StackDestroyProgress)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Imported != nil {
+		in, out := &in.Imported, &out.Imported
+		*out = make([]ImportedResource, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.LastSecretsProviderChange != nil {
+		in, out := &in.LastSecretsProviderChange, &out.LastSecretsProviderChange
+		*out = new(SecretsProviderChange)
+		(*in).DeepCopyInto(*out)
+	}
 	if in.Conditions != nil {
 		in, out := &in.Conditions, &out.Conditions
 		*out = make([]metav1.Condition, len(*in))
@@ -367,3 +783,24 @@ func (in *StackStatus) DeepCopy() *StackStatus {
 	in.DeepCopyInto(out)
 	return out
 }
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *StackVerificationState) DeepCopyInto(out *StackVerificationState) {
+	*out = *in
+	in.Time.DeepCopyInto(&out.Time)
+	if in.DriftedOutputs != nil {
+		in, out := &in.DriftedOutputs, &out.DriftedOutputs
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new StackVerificationState.
+func (in *StackVerificationState) DeepCopy() *StackVerificationState {
+	if in == nil {
+		return nil
+	}
+	out := new(StackVerificationState)
+	in.DeepCopyInto(out)
+	return out
+}
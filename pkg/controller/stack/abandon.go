@@ -0,0 +1,244 @@
+// Copyright 2024, Pulumi Corporation.  All rights reserved.
+
+package stack
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/go-logr/logr"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	"github.com/pulumi/pulumi-kubernetes-operator/pkg/apis/pulumi/shared"
+	pulumiv1 "github.com/pulumi/pulumi-kubernetes-operator/pkg/apis/pulumi/v1"
+)
+
+// Abandonment protocol:
+//
+// When the operator gives up on a stack -- that is, it cannot be processed, and won't be retried
+// until something changes -- it is marked with Ready=False and the reason ReconciliationAbandoned,
+// and the Stalled condition gives the specific reason. The first time this happens, a Warning
+// event with the reason ReconciliationAbandoned is emitted, and the metric stacks_abandoned_total
+// is incremented; while the stack stays abandoned, processing it again (e.g., after the operator
+// restarts) does not emit the event or increment the metric again.
+//
+// The abandonment is ended by any of:
+//   - changing the spec of the stack;
+//   - requesting reconciliation using the annotation named for shared.ReconcileRequestAnnotation;
+//   - changing a Secret the stack refers to (which is done by setting the same annotation).
+//
+// after which giving up on the stack again starts a new abandonment. Processing the stack
+// without giving up on it (e.g., because the problem was fixed elsewhere) also ends it.
+
+// abandon marks the stack as abandoned, for the reason given (one of the Stalled reasons), and
+// returns the result for Reconcile to return. All paths that give up on a stack go through here.
+func (r *ReconcileStack) abandon(instance *pulumiv1.Stack, reason, msg string) (reconcile.Result, error) {
+	if instance.Status.Abandoned == nil {
+		req, _ := getReconcileRequestAnnotation(instance)
+		instance.Status.Abandoned = &pulumiv1.StackAbandonedState{
+			Time:             metav1.Now(),
+			Generation:       instance.GetGeneration(),
+			ReconcileRequest: req,
+		}
+		r.emitEvent(instance, pulumiv1.ReconciliationAbandonedEvent(),
+			"Giving up on the stack until it is changed (%s): %s", reason, msg)
+		recordAbandonedMetrics(instance.Namespace, instance.Name, reason)
+	}
+	instance.Status.Abandoned.Reason = reason
+	instance.Status.Abandoned.Message = msg
+	instance.Status.MarkAbandonedCondition(reason, msg)
+	return reconcile.Result{}, nil
+}
+
+// resumeAbandoned ends the abandonment of the stack, if there is one, when the spec has been
+// changed or reconciliation has been requested since the stack was abandoned. It returns true if
+// the abandonment was ended.
+func resumeAbandoned(instance *pulumiv1.Stack) bool {
+	abandoned := instance.Status.Abandoned
+	if abandoned == nil {
+		return false
+	}
+	req, _ := getReconcileRequestAnnotation(instance)
+	if instance.GetGeneration() == abandoned.Generation && req == abandoned.ReconcileRequest {
+		return false
+	}
+	instance.Status.Abandoned = nil
+	return true
+}
+
+// isAbandoned reports whether the stack was abandoned by this reconciliation.
+func isAbandoned(status *pulumiv1.StackStatus) bool {
+	for _, c := range status.Conditions {
+		if c.Type == pulumiv1.ReadyCondition {
+			return c.Reason == pulumiv1.NotReadyAbandonedReason
+		}
+	}
+	return false
+}
+
+// referencedSecrets returns the names of the Secrets in the stack's own namespace that the stack
+// refers to.
+func referencedSecrets(namespace string, spec *shared.StackSpec) []string {
+	secrets, _ := referencedObjects(namespace, spec)
+	return secrets
+}
+
+// referencedObjects returns the names of the Secrets, and of the ConfigMaps, in the stack's own
+// namespace that the stack refers to for its credentials, environment and configuration. The
+// ConfigMaps given as the program or in configFrom are not included.
+func referencedObjects(namespace string, spec *shared.StackSpec) (secrets, configMaps []string) {
+	seen := map[string]struct{}{}
+	addTo := func(names *[]string, kind, name string) {
+		if _, ok := seen[kind+"/"+name]; name == "" || ok {
+			return
+		}
+		seen[kind+"/"+name] = struct{}{}
+		*names = append(*names, name)
+	}
+	add := func(name string) {
+		addTo(&secrets, "secret", name)
+	}
+	addRef := func(ref *shared.ResourceRef) {
+		if ref == nil {
+			return
+		}
+		secretRef := ref.SecretRef
+		switch ref.SelectorType {
+		case shared.ResourceSelectorSecret:
+		case shared.ResourceSelectorConfigMap:
+			if cm := ref.ConfigMapRef; cm != nil && (cm.Namespace == "" || cm.Namespace == namespace) {
+				addTo(&configMaps, "configmap", cm.Name)
+			}
+			return
+		case shared.ResourceSelectorVault:
+			// the Vault token can be kept in a Secret
+			if ref.Vault == nil {
+				return
+			}
+			secretRef = ref.Vault.Auth.TokenSecretRef
+		default:
+			return
+		}
+		if secretRef != nil && (secretRef.Namespace == "" || secretRef.Namespace == namespace) {
+			add(secretRef.Name)
+		}
+	}
+
+	add(spec.AccessTokenSecret)
+	for _, name := range spec.SecretEnvs {
+		add(name)
+	}
+	for _, ref := range spec.EnvRefs {
+		addRef(&ref)
+	}
+	for _, source := range spec.EnvFrom {
+		if source.SecretRef != nil {
+			add(source.SecretRef.Name)
+		}
+		if source.ConfigMapRef != nil {
+			addTo(&configMaps, "configmap", source.ConfigMapRef.Name)
+		}
+	}
+	for _, ref := range spec.DotEnvRefs {
+		addRef(&ref)
+	}
+	for _, ref := range spec.ConfigRefs {
+		addRef(&ref)
+	}
+	for _, ref := range spec.SecretRefs {
+		addRef(&ref)
+	}
+	for _, source := range spec.SecretsFrom {
+		add(source.SecretRef.Name)
+	}
+	addRef(stackConfigFromRef(spec.StackConfigFrom))
+	addRef(spec.SecretsProviderPassphraseRef)
+	if opts := spec.DestroyOptions; opts != nil {
+		for _, ref := range opts.Credentials {
+			addRef(&ref)
+		}
+	}
+	if auth := spec.BackendAuth; auth != nil && auth.BasicAuth != nil {
+		addRef(&auth.BasicAuth.UserName)
+		addRef(&auth.BasicAuth.Password)
+	}
+	if git := spec.GitSource; git != nil {
+		add(git.GitAuthSecret)
+		if auth := git.GitAuth; auth != nil {
+			addRef(auth.PersonalAccessToken)
+			if auth.SSHAuth != nil {
+				addRef(&auth.SSHAuth.SSHPrivateKey)
+				addRef(auth.SSHAuth.Password)
+			}
+			if auth.BasicAuth != nil {
+				addRef(&auth.BasicAuth.UserName)
+				addRef(&auth.BasicAuth.Password)
+			}
+			addRef(auth.KnownHosts)
+			addRef(auth.CABundle)
+		}
+		if proxy := git.GitProxyAuth; proxy != nil {
+			addRef(&proxy.UserName)
+			addRef(&proxy.Password)
+		}
+		if tls := git.GitTLS; tls != nil {
+			addRef(tls.CABundle)
+		}
+	}
+	return secrets, configMaps
+}
+
+// secretChangedPredicate filters for Secrets whose content has changed. Secrets being created are
+// ignored, since stacks waiting for a Secret to appear are already checked again periodically.
+var secretChangedPredicate = predicate.Funcs{
+	CreateFunc:  func(event.CreateEvent) bool { return false },
+	DeleteFunc:  func(event.DeleteEvent) bool { return false },
+	GenericFunc: func(event.GenericEvent) bool { return false },
+	UpdateFunc: func(e event.UpdateEvent) bool {
+		return e.ObjectOld != nil && e.ObjectNew != nil &&
+			e.ObjectOld.GetResourceVersion() != e.ObjectNew.GetResourceVersion()
+	},
+}
+
+// resumeStacksForSecret returns a map func for watching Secrets, which requests reconciliation of
+// the abandoned stacks that refer to a Secret when it changes. Requesting reconciliation (rather
+// than just queueing the stacks) is what ends the abandonment. Nothing is queued directly, since
+// the change to the annotation queues the stack.
+func resumeStacksForSecret(c client.Client, logger logr.Logger) func(client.Object) []reconcile.Request {
+	return func(secret client.Object) []reconcile.Request {
+		ctx := context.TODO()
+		var stacks pulumiv1.StackList
+		if err := c.List(ctx, &stacks, client.InNamespace(secret.GetNamespace())); err != nil {
+			// we don't get to return an error; only to fail quietly
+			logger.Error(err, "failed to fetch stacks referring to secret",
+				"name", secret.GetName(), "namespace", secret.GetNamespace())
+			return nil
+		}
+		for i := range stacks.Items {
+			stack := &stacks.Items[i]
+			if stack.Status.Abandoned == nil || !contains(referencedSecrets(stack.Namespace, &stack.Spec), secret.GetName()) {
+				continue
+			}
+			stack1 := stack.DeepCopy()
+			a := stack1.GetAnnotations()
+			if a == nil {
+				a = map[string]string{}
+			}
+			a[shared.ReconcileRequestAnnotation] = fmt.Sprintf("referenced Secret %s changed at %s",
+				secret.GetName(), time.Now().Format(time.RFC3339))
+			stack1.SetAnnotations(a)
+			logger.Info("requesting reconciliation of abandoned stack after referenced secret changed",
+				"name", stack.Name, "namespace", stack.Namespace, "secret", secret.GetName())
+			if err := c.Patch(ctx, stack1, client.MergeFrom(stack)); err != nil {
+				logger.Error(err, "failed to request reconciliation of abandoned stack",
+					"name", stack.Name, "namespace", stack.Namespace)
+			}
+		}
+		return nil
+	}
+}
@@ -0,0 +1,175 @@
+// Copyright 2024, Pulumi Corporation.  All rights reserved.
+
+package stack
+
+import (
+	"context"
+	"testing"
+
+	"github.com/pulumi/pulumi-kubernetes-operator/pkg/apis/pulumi/shared"
+	pulumiv1 "github.com/pulumi/pulumi-kubernetes-operator/pkg/apis/pulumi/v1"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	apimeta "k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestAbandon(t *testing.T) {
+	recorder := record.NewFakeRecorder(10)
+	r := &ReconcileStack{recorder: recorder}
+	instance := &pulumiv1.Stack{ObjectMeta: metav1.ObjectMeta{
+		Name: "abandon", Namespace: namespace, Generation: 1,
+	}}
+	abandoned := numStacksAbandoned.With(prometheus.Labels{
+		"namespace": namespace, "name": "abandon", "reason": pulumiv1.StalledSpecInvalidReason,
+	})
+	before := testutil.ToFloat64(abandoned)
+
+	expectEvents := func(t *testing.T, n int) {
+		t.Helper()
+		assert.Len(t, recorder.Events, n)
+		for len(recorder.Events) > 0 {
+			assert.Contains(t, <-recorder.Events, "Warning ReconciliationAbandoned")
+		}
+	}
+
+	// giving up reports the abandonment once, however many times it happens
+	for i := 0; i < 2; i++ {
+		assert.False(t, resumeAbandoned(instance))
+		res, err := r.abandon(instance, pulumiv1.StalledSpecInvalidReason, "spec is invalid")
+		require.NoError(t, err)
+		assert.False(t, res.Requeue)
+		assert.Zero(t, res.RequeueAfter)
+	}
+	expectEvents(t, 1)
+	assert.Equal(t, before+1, testutil.ToFloat64(abandoned))
+	assert.True(t, isAbandoned(&instance.Status))
+	ready := apimeta.FindStatusCondition(instance.Status.Conditions, pulumiv1.ReadyCondition)
+	require.NotNil(t, ready)
+	assert.Equal(t, metav1.ConditionFalse, ready.Status)
+	assert.Equal(t, pulumiv1.NotReadyAbandonedReason, ready.Reason)
+	stalled := apimeta.FindStatusCondition(instance.Status.Conditions, pulumiv1.StalledCondition)
+	require.NotNil(t, stalled)
+	assert.Equal(t, pulumiv1.StalledSpecInvalidReason, stalled.Reason)
+	require.NotNil(t, instance.Status.Abandoned)
+	assert.Equal(t, int64(1), instance.Status.Abandoned.Generation)
+
+	t.Run("spec change", func(t *testing.T) {
+		instance.Generation = 2
+		assert.True(t, resumeAbandoned(instance))
+		assert.Nil(t, instance.Status.Abandoned)
+		_, err := r.abandon(instance, pulumiv1.StalledSpecInvalidReason, "spec is still invalid")
+		require.NoError(t, err)
+		expectEvents(t, 1)
+		assert.Equal(t, before+2, testutil.ToFloat64(abandoned))
+		assert.Equal(t, int64(2), instance.Status.Abandoned.Generation)
+	})
+
+	t.Run("reconcile request", func(t *testing.T) {
+		instance.Annotations = map[string]string{shared.ReconcileRequestAnnotation: "retry"}
+		assert.True(t, resumeAbandoned(instance))
+		_, err := r.abandon(instance, pulumiv1.StalledSpecInvalidReason, "spec is still invalid")
+		require.NoError(t, err)
+		expectEvents(t, 1)
+		assert.Equal(t, before+3, testutil.ToFloat64(abandoned))
+		assert.Equal(t, "retry", instance.Status.Abandoned.ReconcileRequest)
+		assert.False(t, resumeAbandoned(instance))
+	})
+
+	t.Run("not abandoned", func(t *testing.T) {
+		instance.Status.MarkReconcilingCondition(pulumiv1.ReconcilingRetryReason, "retrying")
+		assert.False(t, isAbandoned(&instance.Status))
+		instance.Status.MarkStalledCondition(pulumiv1.StalledPatchFailedReason, "patch failed")
+		assert.False(t, isAbandoned(&instance.Status))
+	})
+}
+
+func TestReferencedSecrets(t *testing.T) {
+	secretRef := func(ns, name string) shared.ResourceRef {
+		return shared.NewSecretResourceRef(ns, name, "key")
+	}
+	token := secretRef("", "git-token")
+	knownHosts := secretRef(namespace, "known-hosts")
+	elsewhere := secretRef("other", "elsewhere")
+	passphrase := secretRef("", "passphrase")
+	spec := shared.StackSpec{
+		AccessTokenSecret: "access-token",
+		SecretEnvs:        []string{"secret-envs"},
+		EnvRefs: map[string]shared.ResourceRef{
+			"AWS_SECRET_ACCESS_KEY": secretRef("", "aws"),
+			"LITERAL":               shared.NewLiteralResourceRef("literal"),
+			"ELSEWHERE":             elsewhere,
+			"VAULT": shared.NewVaultResourceRef("https://vault", "secret/data/pulumi", "key", shared.VaultAuth{
+				TokenSecretRef: &shared.SecretSelector{Name: "vault-token", Key: "token"},
+			}),
+		},
+		EnvFrom: []shared.EnvFromSource{
+			{SecretRef: &shared.EnvFromObjectReference{Name: "env-from"}},
+			{ConfigMapRef: &shared.EnvFromObjectReference{Name: "config-map"}},
+		},
+		ConfigRefs: map[string]shared.ResourceRef{
+			"aws:region": shared.NewConfigMapResourceRef("", "cluster-info", "region"),
+			"app:tier":   secretRef("", "config-secret"),
+		},
+		SecretRefs:                   map[string]shared.ResourceRef{"password": secretRef("", "aws")},
+		SecretsFrom:                  []shared.SecretsFromSource{{SecretRef: shared.SecretsFromSecretReference{Name: "provider-credentials"}}},
+		SecretsProviderPassphraseRef: &passphrase,
+		BackendAuth: &shared.BackendAuth{BasicAuth: &shared.BasicAuth{
+			UserName: shared.NewLiteralResourceRef("user"),
+			Password: secretRef("", "backend-password"),
+		}},
+		GitSource: &shared.GitSource{
+			GitAuthSecret: "git-auth",
+			GitAuth: &shared.GitAuthConfig{
+				PersonalAccessToken: &token,
+				KnownHosts:          &knownHosts,
+			},
+		},
+	}
+	assert.ElementsMatch(t, []string{
+		"access-token", "secret-envs", "aws", "env-from", "git-auth", "git-token", "known-hosts",
+		"vault-token", "backend-password", "config-secret", "provider-credentials", "passphrase",
+	}, referencedSecrets(namespace, &spec))
+}
+
+func TestResumeStacksForSecret(t *testing.T) {
+	abandonedState := &pulumiv1.StackAbandonedState{Reason: pulumiv1.StalledGitAuthenticationFailedReason}
+	stack := func(name, secret string, abandoned *pulumiv1.StackAbandonedState) *pulumiv1.Stack {
+		return &pulumiv1.Stack{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace},
+			Spec:       shared.StackSpec{GitSource: &shared.GitSource{GitAuthSecret: secret}},
+			Status:     pulumiv1.StackStatus{Abandoned: abandoned},
+		}
+	}
+	secret := &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "git-auth", Namespace: namespace}}
+	s := runtime.NewScheme()
+	require.NoError(t, scheme.AddToScheme(s))
+	require.NoError(t, pulumiv1.SchemeBuilder.AddToScheme(s))
+	c := fake.NewFakeClientWithScheme(s,
+		stack("abandoned", "git-auth", abandonedState),
+		stack("not-abandoned", "git-auth", nil),
+		stack("other-secret", "other-auth", abandonedState),
+	)
+
+	assert.Empty(t, resumeStacksForSecret(c, log)(secret))
+
+	for name, requested := range map[string]bool{
+		"abandoned":     true,
+		"not-abandoned": false,
+		"other-secret":  false,
+	} {
+		var got pulumiv1.Stack
+		require.NoError(t, c.Get(context.TODO(), client.ObjectKey{Name: name, Namespace: namespace}, &got))
+		_, ok := getReconcileRequestAnnotation(&got)
+		assert.Equal(t, requested, ok, name)
+	}
+}
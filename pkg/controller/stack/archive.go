@@ -0,0 +1,201 @@
+// Copyright 2024, Pulumi Corporation.  All rights reserved.
+
+package stack
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/pulumi/pulumi-kubernetes-operator/pkg/apis/pulumi/shared"
+)
+
+const (
+	// maxArchiveSize limits the total size of the files unpacked from a project archive, so that a
+	// malformed or malicious archive can't fill the disk.
+	maxArchiveSize = 1 << 30
+)
+
+var archiveHTTPClient = &http.Client{Timeout: 10 * time.Minute}
+
+// archiveRevision gives the revision reported for a project archive with the digest given.
+func archiveRevision(sha256Hex string) string {
+	return "sha256:" + strings.ToLower(sha256Hex)
+}
+
+// SetupWorkdirFromArchive downloads the project archive given in the source, and unpacks it into
+// the workspace directory. The revision returned is the digest of the archive.
+func (sess *reconcileStackSession) SetupWorkdirFromArchive(ctx context.Context, source *shared.GitSource) (string, error) {
+	workspaceDir := sess.getWorkspaceDir()
+	sess.logger.Debug("Setting up pulumi workspace for stack from archive", "stack", sess.stack, "workspace", workspaceDir)
+
+	var token string
+	if source.ArchiveAuth != nil {
+		var err error
+		if token, err = sess.resolveResourceRef(ctx, source.ArchiveAuth); err != nil {
+			return "", fmt.Errorf("resolving archiveAuth: %w", err)
+		}
+	}
+
+	revision, err := fetchProjectArchive(ctx, source.ProjectArchiveURL, token, source.ArchiveSHA256, workspaceDir)
+	if err != nil {
+		return "", err
+	}
+
+	w, err := sess.newWorkspace(ctx, filepath.Join(workspaceDir, source.RepoDir))
+	if err != nil {
+		return "", fmt.Errorf("failed to create local workspace: %w", err)
+	}
+
+	return revision, sess.setupWorkspace(ctx, w)
+}
+
+// fetchProjectArchive downloads the archive at the URL, checks its digest if one is expected, and
+// unpacks it into the directory given. The archive is downloaded in full before anything is
+// unpacked, so that a mismatched archive leaves nothing behind.
+func fetchProjectArchive(ctx context.Context, archiveURL, token, expectedSHA256, dir string) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, archiveURL, nil)
+	if err != nil {
+		return "", newStallErrorf("invalid projectArchiveURL: %v", err)
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	res, err := archiveHTTPClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("downloading project archive: %w", err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		err := fmt.Errorf("downloading project archive: %s", res.Status)
+		if res.StatusCode >= 400 && res.StatusCode < 500 && res.StatusCode != http.StatusTooManyRequests {
+			// the archive can't be had as given, and retrying won't change that
+			return "", newStallErrorf("%v", err)
+		}
+		return "", err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(dir), "archive-*.tar.gz")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(io.MultiWriter(tmp, h), res.Body); err != nil {
+		return "", fmt.Errorf("downloading project archive: %w", err)
+	}
+	digest := hex.EncodeToString(h.Sum(nil))
+	if expectedSHA256 != "" && !strings.EqualFold(digest, expectedSHA256) {
+		return "", newStallErrorf("project archive has SHA256 digest %s, but archiveSHA256 is %s", digest, expectedSHA256)
+	}
+
+	if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+		return "", err
+	}
+	if err := unpackTarGz(tmp, dir); err != nil {
+		return "", fmt.Errorf("unpacking project archive: %w", err)
+	}
+	return archiveRevision(digest), nil
+}
+
+// unpackTarGz unpacks the gzipped tarball into the directory given. Entries that would be written
+// outside the directory are refused, as are symlinks that point outside it, and entries beneath a
+// symlink (since the symlink may lead outside the directory by way of other symlinks).
+func unpackTarGz(r io.Reader, dir string) error {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return newStallErrorf("project archive is not gzipped: %v", err)
+	}
+	defer gz.Close()
+
+	var total int64
+	tr := tar.NewReader(gz)
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return newStallErrorf("reading project archive: %v", err)
+		}
+		target, ok := archiveEntryPath(dir, hdr.Name)
+		if !ok || underSymlink(dir, target) {
+			return newStallErrorf("project archive entry %q is outside the archive", hdr.Name)
+		}
+
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			if err := os.MkdirAll(target, 0700); err != nil {
+				return err
+			}
+		case tar.TypeReg:
+			total += hdr.Size
+			if total > maxArchiveSize {
+				return newStallErrorf("project archive is larger than %d bytes unpacked", maxArchiveSize)
+			}
+			if err := os.MkdirAll(filepath.Dir(target), 0700); err != nil {
+				return err
+			}
+			f, err := os.OpenFile(target, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, hdr.FileInfo().Mode().Perm()|0600)
+			if err != nil {
+				return err
+			}
+			if _, err := io.CopyN(f, tr, hdr.Size); err != nil {
+				f.Close()
+				return err
+			}
+			if err := f.Close(); err != nil {
+				return err
+			}
+		case tar.TypeSymlink:
+			_, inside := archiveEntryPath(dir, filepath.Join(filepath.Dir(hdr.Name), hdr.Linkname))
+			if filepath.IsAbs(hdr.Linkname) || !inside {
+				return newStallErrorf("project archive symlink %q points outside the archive", hdr.Name)
+			}
+			if err := os.MkdirAll(filepath.Dir(target), 0700); err != nil {
+				return err
+			}
+			if err := os.Symlink(hdr.Linkname, target); err != nil {
+				return err
+			}
+		default:
+			// other kinds of entry (hard links, devices, and so on) have no place in a project
+		}
+	}
+}
+
+// archiveEntryPath gives where an entry in an archive is to be unpacked, and false if that is
+// outside the directory.
+func archiveEntryPath(dir, name string) (string, bool) {
+	if filepath.IsAbs(name) {
+		return "", false
+	}
+	target := filepath.Join(dir, name)
+	rel, err := filepath.Rel(dir, target)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", false
+	}
+	return target, true
+}
+
+// underSymlink reports whether any of the directories leading to target, below dir, is a symlink.
+func underSymlink(dir, target string) bool {
+	for p := filepath.Dir(target); len(p) > len(dir); p = filepath.Dir(p) {
+		if info, err := os.Lstat(p); err == nil && info.Mode()&os.ModeSymlink != 0 {
+			return true
+		}
+	}
+	return false
+}
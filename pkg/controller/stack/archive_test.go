@@ -0,0 +1,108 @@
+// Copyright 2024, Pulumi Corporation.  All rights reserved.
+
+package stack
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type archiveEntry struct {
+	name     string
+	content  string
+	linkname string
+}
+
+func makeTarGz(t *testing.T, entries ...archiveEntry) []byte {
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	for _, e := range entries {
+		hdr := &tar.Header{Name: e.name, Mode: 0644, Size: int64(len(e.content)), Typeflag: tar.TypeReg}
+		if e.linkname != "" {
+			hdr = &tar.Header{Name: e.name, Mode: 0777, Linkname: e.linkname, Typeflag: tar.TypeSymlink}
+		}
+		require.NoError(t, tw.WriteHeader(hdr))
+		_, err := tw.Write([]byte(e.content))
+		require.NoError(t, err)
+	}
+	require.NoError(t, tw.Close())
+	require.NoError(t, gz.Close())
+	return buf.Bytes()
+}
+
+func TestFetchProjectArchive(t *testing.T) {
+	archive := makeTarGz(t,
+		archiveEntry{name: "project/Pulumi.yaml", content: "name: test\nruntime: yaml\n"},
+		archiveEntry{name: "project/current", linkname: "Pulumi.yaml"},
+	)
+	sum := sha256.Sum256(archive)
+	digest := hex.EncodeToString(sum[:])
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		_, _ = w.Write(archive)
+	}))
+	defer server.Close()
+
+	fetch := func(token, expected string) (string, string, error) {
+		dir := filepath.Join(t.TempDir(), "workspace")
+		require.NoError(t, os.Mkdir(dir, 0700))
+		revision, err := fetchProjectArchive(context.TODO(), server.URL, token, expected, dir)
+		return dir, revision, err
+	}
+
+	dir, revision, err := fetch("token", "")
+	require.NoError(t, err)
+	assert.Equal(t, "sha256:"+digest, revision)
+	b, err := os.ReadFile(filepath.Join(dir, "project", "current"))
+	require.NoError(t, err)
+	assert.Equal(t, "name: test\nruntime: yaml\n", string(b))
+
+	_, revision, err = fetch("token", digest)
+	require.NoError(t, err)
+	assert.Equal(t, "sha256:"+digest, revision)
+
+	dir, _, err = fetch("token", "0000000000000000000000000000000000000000000000000000000000000000")
+	assert.True(t, isStalledError(err), "digest mismatch")
+	assert.NoFileExists(t, filepath.Join(dir, "project", "Pulumi.yaml"), "nothing unpacked")
+
+	_, _, err = fetch("", "")
+	assert.True(t, isStalledError(err), "refused")
+}
+
+func TestUnpackTarGzRefusesEscapes(t *testing.T) {
+	for name, entries := range map[string][]archiveEntry{
+		"parent":           {{name: "../escaped", content: "x"}},
+		"absolute symlink": {{name: "link", linkname: "/etc"}},
+		"symlink outside":  {{name: "sub/link", linkname: "../../outside"}},
+		"through symlink": {
+			{name: "here", linkname: "."},
+			{name: "link", linkname: "here/.."},
+			{name: "link/escaped", content: "x"},
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			dir := filepath.Join(t.TempDir(), "workspace")
+			require.NoError(t, os.Mkdir(dir, 0700))
+			err := unpackTarGz(bytes.NewReader(makeTarGz(t, entries...)), dir)
+			assert.True(t, isStalledError(err))
+			assert.NoFileExists(t, filepath.Join(filepath.Dir(dir), "escaped"))
+		})
+	}
+}
@@ -0,0 +1,115 @@
+// Copyright 2024, Pulumi Corporation.  All rights reserved.
+
+package stack
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/pulumi/pulumi-kubernetes-operator/pkg/apis/pulumi/shared"
+	pulumiv1 "github.com/pulumi/pulumi-kubernetes-operator/pkg/apis/pulumi/v1"
+)
+
+// updateAttempt tracks an update attempt, and the group of attempts it belongs to. Attempts are
+// grouped so that when an update fails part way through and a retry completes it, the status
+// reflects the whole of the change rather than only the last run.
+type updateAttempt struct {
+	group      string
+	attempts   int
+	generation int64
+	changes    map[string]int
+}
+
+// beginUpdateAttempt starts an update attempt. It continues the attempt group of the last update
+// if that failed, and neither the stack nor the revision of its source has changed since;
+// otherwise, it starts a new attempt group.
+func beginUpdateAttempt(status pulumiv1.StackStatus, generation int64, commit string) updateAttempt {
+	last := status.LastUpdate
+	if last != nil && last.AttemptGroup != "" &&
+		last.State == shared.FailedStackStateMessage &&
+		last.LastAttemptedCommit == commit &&
+		last.AttemptGeneration == generation {
+		changes := make(map[string]int, len(last.ResourceChanges))
+		for op, n := range last.ResourceChanges {
+			changes[op] = n
+		}
+		return updateAttempt{group: last.AttemptGroup, attempts: last.Attempts + 1, generation: generation, changes: changes}
+	}
+	return updateAttempt{group: uuid.New().String(), attempts: 1, generation: generation, changes: map[string]int{}}
+}
+
+// addChanges adds the resource changes made by this attempt to those of the group.
+func (a *updateAttempt) addChanges(changes map[string]int) {
+	for op, n := range changes {
+		a.changes[op] += n
+	}
+}
+
+// applyTo records the attempt group in the update state.
+func (a updateAttempt) applyTo(state *shared.StackUpdateState) {
+	state.AttemptGroup = a.group
+	state.Attempts = a.attempts
+	state.AttemptGeneration = a.generation
+	state.ResourceChanges = nil
+	if len(a.changes) > 0 {
+		state.ResourceChanges = a.changes
+	}
+}
+
+// defaultHistoryLimit is the number of updates kept in .status.history, if .spec.historyLimit is
+// not given.
+const defaultHistoryLimit = 5
+
+// maxHistoryLimit is the most updates kept in .status.history, whatever .spec.historyLimit says.
+// The API server enforces this too, but a stack created before that was enforced could have a
+// larger value.
+const maxHistoryLimit = 20
+
+// recordUpdate records the outcome of an update, as given in .status.lastUpdate, in the history of
+// the stack. An update in the same attempt group as the latest one in the history (i.e., a retry of
+// it) replaces it. The oldest updates are dropped to keep to the history limit.
+func recordUpdate(instance *pulumiv1.Stack, start metav1.Time) {
+	last := instance.Status.LastUpdate
+	if last == nil {
+		return
+	}
+	last.StartTime = &start
+
+	limit := defaultHistoryLimit
+	if instance.Spec.HistoryLimit != nil {
+		limit = int(*instance.Spec.HistoryLimit)
+	}
+	if limit > maxHistoryLimit {
+		limit = maxHistoryLimit
+	}
+	if limit <= 0 {
+		instance.Status.History = nil
+		return
+	}
+
+	history := instance.Status.History
+	if n := len(history); n > 0 && last.AttemptGroup != "" && history[n-1].AttemptGroup == last.AttemptGroup {
+		history = history[:n-1]
+	}
+	history = append(history, *last.DeepCopy())
+	if len(history) > limit {
+		history = history[len(history)-limit:]
+	}
+	instance.Status.History = history
+}
+
+// lastResourceChanges returns the resource changes made by the most recent update of the stack,
+// as recorded in its history. This is used when an update fails, since the result of a failed
+// update doesn't include them.
+func (sess *reconcileStackSession) lastResourceChanges(ctx context.Context) map[string]int {
+	history, err := sess.autoStack.History(ctx, 1 /*pageSize*/, 1 /*page*/)
+	if err != nil || len(history) == 0 || history[0].ResourceChanges == nil {
+		if err != nil {
+			sess.logger.Debug("Unable to get stack history for resource changes", "Error", err.Error())
+		}
+		return nil
+	}
+	return *history[0].ResourceChanges
+}
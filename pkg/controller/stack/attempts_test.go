@@ -0,0 +1,154 @@
+// Copyright 2024, Pulumi Corporation.  All rights reserved.
+
+package stack
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	"github.com/pulumi/pulumi-kubernetes-operator/pkg/apis/pulumi/shared"
+	pulumiv1 "github.com/pulumi/pulumi-kubernetes-operator/pkg/apis/pulumi/v1"
+)
+
+func TestUpdateAttemptGroups(t *testing.T) {
+	const commit = "abc123"
+
+	// the first attempt fails part way through, having created some resources
+	var status pulumiv1.StackStatus
+	first := beginUpdateAttempt(status, 1, commit)
+	assert.NotEmpty(t, first.group)
+	assert.Equal(t, 1, first.attempts)
+	first.addChanges(map[string]int{"create": 3})
+	status.LastUpdate = &shared.StackUpdateState{
+		State:               shared.FailedStackStateMessage,
+		LastAttemptedCommit: commit,
+	}
+	first.applyTo(status.LastUpdate)
+	status.ObservedGeneration = 1
+	assert.Equal(t, int64(1), status.LastUpdate.AttemptGeneration)
+
+	// a retry continues the group, and the final entry shows the changes across both runs
+	retry := beginUpdateAttempt(status, 1, commit)
+	assert.Equal(t, first.group, retry.group)
+	assert.Equal(t, 2, retry.attempts)
+	retry.addChanges(map[string]int{"create": 2, "same": 3})
+	final := &shared.StackUpdateState{State: shared.SucceededStackStateMessage}
+	retry.applyTo(final)
+	assert.Equal(t, first.group, final.AttemptGroup)
+	assert.Equal(t, 2, final.Attempts)
+	assert.Equal(t, map[string]int{"create": 5, "same": 3}, final.ResourceChanges)
+	// the failed entry isn't changed by the retry
+	assert.Equal(t, map[string]int{"create": 3}, status.LastUpdate.ResourceChanges)
+
+	// a new commit starts a new group
+	next := beginUpdateAttempt(status, 1, "def456")
+	assert.NotEqual(t, first.group, next.group)
+	assert.Equal(t, 1, next.attempts)
+
+	// so does a change to the stack
+	next = beginUpdateAttempt(status, 2, commit)
+	assert.NotEqual(t, first.group, next.group)
+
+	// and so does anything following a success
+	status.LastUpdate = final
+	next = beginUpdateAttempt(status, 1, commit)
+	assert.NotEqual(t, first.group, next.group)
+	assert.Empty(t, next.changes)
+}
+
+func TestRecordUpdate(t *testing.T) {
+	start := metav1.NewTime(time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC))
+	var instance pulumiv1.Stack
+	update := func(group string, state shared.StackUpdateStateMessage) {
+		instance.Status.LastUpdate = &shared.StackUpdateState{
+			State:               state,
+			LastAttemptedCommit: group,
+			AttemptGroup:        group,
+		}
+		recordUpdate(&instance, start)
+	}
+	groups := func() []string {
+		var gs []string
+		for _, h := range instance.Status.History {
+			gs = append(gs, h.AttemptGroup)
+		}
+		return gs
+	}
+
+	// the oldest are dropped past the default limit
+	for i := 0; i < 7; i++ {
+		update(fmt.Sprintf("g%d", i), shared.SucceededStackStateMessage)
+	}
+	assert.Equal(t, []string{"g2", "g3", "g4", "g5", "g6"}, groups())
+	require.NotNil(t, instance.Status.History[4].StartTime)
+	assert.Equal(t, start, *instance.Status.History[4].StartTime)
+
+	// a retry replaces the failed attempt
+	update("g7", shared.FailedStackStateMessage)
+	update("g7", shared.SucceededStackStateMessage)
+	assert.Equal(t, []string{"g3", "g4", "g5", "g6", "g7"}, groups())
+	assert.Equal(t, shared.SucceededStackStateMessage, instance.Status.History[4].State)
+
+	// the history is a copy, not changed along with the last update
+	instance.Status.LastUpdate.State = shared.FailedStackStateMessage
+	assert.Equal(t, shared.SucceededStackStateMessage, instance.Status.History[4].State)
+
+	limit := func(n int32) { instance.Spec.HistoryLimit = &n }
+	limit(2)
+	update("g8", shared.SucceededStackStateMessage)
+	assert.Equal(t, []string{"g7", "g8"}, groups())
+
+	limit(100)
+	for i := 9; i < 40; i++ {
+		update(fmt.Sprintf("g%d", i), shared.SucceededStackStateMessage)
+	}
+	assert.Len(t, instance.Status.History, maxHistoryLimit)
+
+	limit(0)
+	update("g40", shared.SucceededStackStateMessage)
+	assert.Empty(t, instance.Status.History)
+}
+
+func TestIsSettledOutcome(t *testing.T) {
+	var status pulumiv1.StackStatus
+	done := reconcile.Result{}
+	assert.False(t, isSettledOutcome(&status, done))
+
+	status.MarkReconcilingCondition(pulumiv1.ReconcilingRetryReason, "update failed; retrying")
+	assert.False(t, isSettledOutcome(&status, reconcile.Result{Requeue: true}), "a stack being retried has not settled")
+	status.MarkReadyCondition()
+	assert.True(t, isSettledOutcome(&status, done))
+	assert.True(t, isSettledOutcome(&status, reconcile.Result{RequeueAfter: time.Minute}), "a ready stack requeued to poll its source")
+
+	status.MarkStalledCondition(pulumiv1.StalledSpecInvalidReason, "bad spec")
+	assert.False(t, isSettledOutcome(&status, done), "stalled, but not abandoned")
+	status.Abandoned = &pulumiv1.StackAbandonedState{Reason: pulumiv1.StalledSpecInvalidReason}
+	status.MarkAbandonedCondition(pulumiv1.StalledSpecInvalidReason, "bad spec")
+	assert.True(t, isSettledOutcome(&status, done))
+	assert.False(t, isSettledOutcome(&status, reconcile.Result{RequeueAfter: time.Minute}), "abandoned, but to be tried again")
+
+	status = pulumiv1.StackStatus{}
+	status.MarkReconcilingCondition(pulumiv1.ReconcilingProcessingReason, "processing")
+	status.MarkPausedCondition()
+	assert.True(t, isSettledOutcome(&status, done))
+}
+
+func TestObserveGeneration(t *testing.T) {
+	instance := &pulumiv1.Stack{ObjectMeta: metav1.ObjectMeta{Generation: 2}}
+	instance.Status.ObservedGeneration = 1
+
+	instance.Status.MarkStalledCondition(pulumiv1.StalledSpecInvalidReason, "failed; retrying")
+	observeGeneration(instance, reconcile.Result{RequeueAfter: time.Minute})
+	assert.Equal(t, int64(1), instance.Status.ObservedGeneration, "a stalled stack being retried")
+
+	instance.Status.Abandoned = &pulumiv1.StackAbandonedState{Reason: pulumiv1.StalledSpecInvalidReason}
+	instance.Status.MarkAbandonedCondition(pulumiv1.StalledSpecInvalidReason, "spec is invalid")
+	observeGeneration(instance, reconcile.Result{})
+	assert.Equal(t, int64(2), instance.Status.ObservedGeneration, "abandoned")
+}
@@ -0,0 +1,102 @@
+// Copyright 2024, Pulumi Corporation.  All rights reserved.
+
+package stack
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strconv"
+
+	"github.com/pulumi/pulumi-kubernetes-operator/pkg/apis/pulumi/shared"
+)
+
+// validateBackend checks the backend URL and .spec.backendAuth. Credentials must not be given in
+// the backend URL, since it's visible to anyone who can read the stack; and the options in
+// backendAuth must suit the kind of backend.
+func validateBackend(spec *shared.StackSpec) error {
+	if spec.Backend == "" {
+		if spec.BackendAuth != nil {
+			return newStallErrorf("backendAuth is given, but backend is not")
+		}
+		return nil
+	}
+	u, err := url.Parse(spec.Backend)
+	if err != nil {
+		// don't repeat the URL, in case it contains credentials
+		return newStallErrorf("backend is not a valid URL")
+	}
+	if u.User != nil {
+		return newStallErrorf("backend URL must not contain credentials; use backendAuth.basicAuth instead")
+	}
+	auth := spec.BackendAuth
+	if auth == nil {
+		return nil
+	}
+	if (auth.Endpoint != "" || auth.ForcePathStyle || auth.Region != "" || auth.Profile != "") && u.Scheme != "s3" {
+		return newStallErrorf("backendAuth.endpoint, forcePathStyle, region and profile can only be used with an s3:// backend")
+	}
+	if auth.BasicAuth != nil && u.Scheme != "https" && u.Scheme != "http" {
+		return newStallErrorf("backendAuth.basicAuth can only be used with an http:// or https:// backend")
+	}
+	return nil
+}
+
+// backendURL returns the URL given to the Pulumi CLI for the backend, with the options and
+// credentials from .spec.backendAuth added to it. These are given in the URL rather than in
+// environment variables, so that they apply only to the backend and not to (e.g.) the AWS provider
+// used by the program. The URL returned may contain credentials, so must not be logged or written
+// to the status.
+func (sess *reconcileStackSession) backendURL(ctx context.Context) (string, error) {
+	auth := sess.stack.BackendAuth
+	if auth == nil {
+		return sess.stack.Backend, nil
+	}
+	if err := validateBackend(&sess.stack); err != nil {
+		return "", err
+	}
+	u, err := url.Parse(sess.stack.Backend)
+	if err != nil {
+		return "", err
+	}
+
+	// These are the query parameters understood by the S3 driver for DIY backends.
+	q := u.Query()
+	for param, value := range map[string]string{
+		"endpoint": auth.Endpoint,
+		"region":   auth.Region,
+		"profile":  auth.Profile,
+	} {
+		if value != "" {
+			q.Set(param, value)
+		}
+	}
+	if auth.ForcePathStyle {
+		q.Set("s3ForcePathStyle", strconv.FormatBool(true))
+	}
+	u.RawQuery = q.Encode()
+
+	if auth.BasicAuth != nil {
+		userName, err := sess.resolveResourceRef(ctx, &auth.BasicAuth.UserName)
+		if err != nil {
+			return "", fmt.Errorf("resolving backendAuth.basicAuth user name: %w", err)
+		}
+		password, err := sess.resolveResourceRef(ctx, &auth.BasicAuth.Password)
+		if err != nil {
+			return "", fmt.Errorf("resolving backendAuth.basicAuth password: %w", err)
+		}
+		u.User = url.UserPassword(userName, password)
+	}
+	return u.String(), nil
+}
+
+// credentialFreePermalink removes any credentials from a URL reported by the Pulumi CLI, which may
+// have been derived from the backend URL, before it's written to the status.
+func credentialFreePermalink(p string) shared.Permalink {
+	u, err := url.Parse(p)
+	if err != nil || u.User == nil {
+		return shared.Permalink(p)
+	}
+	u.User = nil
+	return shared.Permalink(u.String())
+}
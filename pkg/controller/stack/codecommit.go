@@ -0,0 +1,292 @@
+// Copyright 2024, Pulumi Corporation.  All rights reserved.
+
+package stack
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pulumi/pulumi-kubernetes-operator/pkg/apis/pulumi/shared"
+)
+
+const (
+	// awsCredentialsMargin is how long before they expire temporary credentials are replaced, so
+	// that they don't expire while in use.
+	awsCredentialsMargin = 5 * time.Minute
+
+	defaultAWSRoleSessionName = "pulumi-kubernetes-operator"
+)
+
+var (
+	// errAWSCredentials marks errors caused by AWS refusing, or there being no, credentials; these
+	// are reported as git authentication failures.
+	errAWSCredentials = errors.New("unable to get AWS credentials")
+
+	awsSTSClient = &http.Client{Timeout: 30 * time.Second}
+
+	// webIdentityCredentials keeps the credentials got by assuming a role with a web identity
+	// token, across reconciliations, since each is good for an hour or more.
+	webIdentityCredentials = &awsCredentialsCache{credentials: map[string]awsCredentials{}}
+)
+
+type awsCredentials struct {
+	AccessKeyID     string
+	SecretAccessKey string
+	SessionToken    string
+	// Expiration is zero for credentials which don't expire.
+	Expiration time.Time
+}
+
+// codeCommitRepo holds the parts of a CodeCommit repository URL that go into signing requests.
+type codeCommitRepo struct {
+	host   string
+	path   string
+	region string
+	// domain is the domain of AWS endpoints in the repository's partition, e.g., amazonaws.com
+	domain string
+}
+
+// parseCodeCommitURL checks that the repository URL is for a CodeCommit repository over HTTPS,
+// e.g., https://git-codecommit.us-east-1.amazonaws.com/v1/repos/example, and reads the region from
+// it.
+func parseCodeCommitURL(repoURL string) (*codeCommitRepo, error) {
+	u, err := url.Parse(repoURL)
+	if err == nil && u.Scheme == "https" {
+		host := u.Hostname()
+		for _, prefix := range []string{"git-codecommit-fips.", "git-codecommit."} {
+			if !strings.HasPrefix(host, prefix) {
+				continue
+			}
+			region, domain, ok := strings.Cut(strings.TrimPrefix(host, prefix), ".")
+			if ok && region != "" && strings.HasPrefix(domain, "amazonaws.") {
+				return &codeCommitRepo{host: host, path: u.EscapedPath(), region: region, domain: domain}, nil
+			}
+		}
+	}
+	return nil, newStallErrorf("gitAuth.codeCommit can only be used with a CodeCommit HTTPS repository URL, "+
+		"e.g., https://git-codecommit.us-east-1.amazonaws.com/v1/repos/example, but got %q", repoURL)
+}
+
+// sign gives the username and password with which to authenticate to the repository, in the same
+// way as the AWS CLI's git credential helper. The password is a signature (AWS Signature Version 4)
+// of the repository URL, which is good for a short while after the time given.
+func (repo *codeCommitRepo) sign(creds awsCredentials, now time.Time) (string, string) {
+	username := creds.AccessKeyID
+	if creds.SessionToken != "" {
+		username += "%" + creds.SessionToken
+	}
+
+	timestamp := now.UTC().Format("20060102T150405")
+	date := timestamp[:8]
+	canonicalRequest := fmt.Sprintf("GIT\n%s\n\nhost:%s\n\nhost\n", repo.path, repo.host)
+	canonicalDigest := sha256.Sum256([]byte(canonicalRequest))
+	scope := strings.Join([]string{date, repo.region, "codecommit", "aws4_request"}, "/")
+	stringToSign := strings.Join([]string{
+		"AWS4-HMAC-SHA256", timestamp, scope, hex.EncodeToString(canonicalDigest[:]),
+	}, "\n")
+
+	key := []byte("AWS4" + creds.SecretAccessKey)
+	for _, part := range []string{date, repo.region, "codecommit", "aws4_request"} {
+		key = hmacSHA256(key, part)
+	}
+	return username, timestamp + "Z" + hex.EncodeToString(hmacSHA256(key, stringToSign))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+// codeCommitAuth authenticates git requests over HTTP to a CodeCommit repository. A new password
+// is signed for each request, since each is good for only a short while, and temporary credentials
+// are replaced as they near expiry, so that a long fetch can carry on.
+type codeCommitAuth struct {
+	repo *codeCommitRepo
+	// static gives the credentials from the stack spec, if any; otherwise, they're taken from the
+	// operator's environment.
+	static *awsCredentials
+	// last is used if new credentials can't be got; AWS will say if they're no longer good.
+	last awsCredentials
+}
+
+// resolveCodeCommitAuth reads the credentials given for CodeCommit, if any.
+func (sess *reconcileStackSession) resolveCodeCommitAuth(ctx context.Context, cc *shared.CodeCommitAuth) (*codeCommitAuth, error) {
+	repo, err := parseCodeCommitURL(sess.stack.ProjectRepo)
+	if err != nil {
+		return nil, err
+	}
+	auth := &codeCommitAuth{repo: repo}
+	if cc.AccessKeyID == nil && cc.SecretAccessKey == nil {
+		return auth, nil
+	}
+	if cc.AccessKeyID == nil || cc.SecretAccessKey == nil {
+		return nil, errors.New("gitAuth.codeCommit must give both or neither of 'accessKeyID' and 'secretAccessKey'")
+	}
+	var creds awsCredentials
+	if creds.AccessKeyID, err = sess.resolveResourceRef(ctx, cc.AccessKeyID); err != nil {
+		return nil, fmt.Errorf("resolving gitAuth.codeCommit access key ID: %w", err)
+	}
+	if creds.SecretAccessKey, err = sess.resolveResourceRef(ctx, cc.SecretAccessKey); err != nil {
+		return nil, fmt.Errorf("resolving gitAuth.codeCommit secret access key: %w", err)
+	}
+	if cc.SessionToken != nil {
+		if creds.SessionToken, err = sess.resolveResourceRef(ctx, cc.SessionToken); err != nil {
+			return nil, fmt.Errorf("resolving gitAuth.codeCommit session token: %w", err)
+		}
+	}
+	auth.static = &creds
+	return auth, nil
+}
+
+// credentials gets the AWS credentials to sign requests with.
+func (a *codeCommitAuth) credentials(ctx context.Context) (awsCredentials, error) {
+	if a.static != nil {
+		return *a.static, nil
+	}
+	return awsEnvironmentCredentials(ctx, a.repo, time.Now())
+}
+
+// identity gives what the credentials are for, without including any secret, so that credentials
+// that are replaced as they expire are still recognised as the same.
+func (a *codeCommitAuth) identity() string {
+	if a.static != nil {
+		return a.static.AccessKeyID
+	}
+	if id := os.Getenv("AWS_ACCESS_KEY_ID"); id != "" {
+		return id
+	}
+	return os.Getenv("AWS_ROLE_ARN")
+}
+
+func (a *codeCommitAuth) SetAuth(r *http.Request) {
+	if creds, err := a.credentials(r.Context()); err == nil {
+		a.last = creds
+	} else {
+		log.Error(err, "Failed to refresh AWS credentials for CodeCommit; using the last ones")
+	}
+	r.SetBasicAuth(a.repo.sign(a.last, time.Now()))
+}
+
+func (a *codeCommitAuth) Name() string {
+	return "http-codecommit-auth"
+}
+
+func (a *codeCommitAuth) String() string {
+	return fmt.Sprintf("%s - %s", a.Name(), a.identity())
+}
+
+// awsEnvironmentCredentials gets AWS credentials from the operator's environment: either given
+// directly, or by assuming a role with a web identity token, as with IAM roles for service
+// accounts.
+func awsEnvironmentCredentials(ctx context.Context, repo *codeCommitRepo, now time.Time) (awsCredentials, error) {
+	if id := os.Getenv("AWS_ACCESS_KEY_ID"); id != "" {
+		return awsCredentials{
+			AccessKeyID:     id,
+			SecretAccessKey: os.Getenv("AWS_SECRET_ACCESS_KEY"),
+			SessionToken:    os.Getenv("AWS_SESSION_TOKEN"),
+		}, nil
+	}
+	roleARN, tokenFile := os.Getenv("AWS_ROLE_ARN"), os.Getenv("AWS_WEB_IDENTITY_TOKEN_FILE")
+	if roleARN == "" || tokenFile == "" {
+		return awsCredentials{}, fmt.Errorf("%w: none given in gitAuth.codeCommit, and neither AWS_ACCESS_KEY_ID "+
+			"nor AWS_ROLE_ARN and AWS_WEB_IDENTITY_TOKEN_FILE are set for the operator", errAWSCredentials)
+	}
+	sessionName := os.Getenv("AWS_ROLE_SESSION_NAME")
+	if sessionName == "" {
+		sessionName = defaultAWSRoleSessionName
+	}
+	endpoint := fmt.Sprintf("https://sts.%s.%s/", repo.region, repo.domain)
+	return webIdentityCredentials.get(ctx, endpoint, roleARN, sessionName, tokenFile, now)
+}
+
+// awsCredentialsCache keeps the temporary credentials got for each role.
+type awsCredentialsCache struct {
+	mu          sync.Mutex
+	credentials map[string]awsCredentials
+}
+
+// get returns credentials for the role, assuming it again with the web identity token in the
+// file given if there aren't any that are good for a while yet. The token file is read each time,
+// since it's rotated.
+func (c *awsCredentialsCache) get(ctx context.Context, endpoint, roleARN, sessionName, tokenFile string, now time.Time) (awsCredentials, error) {
+	key := strings.Join([]string{endpoint, roleARN, sessionName}, "|")
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if creds, ok := c.credentials[key]; ok && creds.Expiration.After(now.Add(awsCredentialsMargin)) {
+		return creds, nil
+	}
+	token, err := os.ReadFile(tokenFile)
+	if err != nil {
+		return awsCredentials{}, fmt.Errorf("reading web identity token: %w", err)
+	}
+	creds, err := assumeRoleWithWebIdentity(ctx, endpoint, roleARN, sessionName, strings.TrimSpace(string(token)))
+	if err != nil {
+		return awsCredentials{}, err
+	}
+	c.credentials[key] = creds
+	return creds, nil
+}
+
+// assumeRoleWithWebIdentity asks AWS STS for temporary credentials for the role. This request is
+// authenticated by the web identity token, so it isn't itself signed.
+func assumeRoleWithWebIdentity(ctx context.Context, endpoint, roleARN, sessionName, token string) (awsCredentials, error) {
+	form := url.Values{
+		"Action":           {"AssumeRoleWithWebIdentity"},
+		"Version":          {"2011-06-15"},
+		"RoleArn":          {roleARN},
+		"RoleSessionName":  {sessionName},
+		"WebIdentityToken": {token},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return awsCredentials{}, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	res, err := awsSTSClient.Do(req)
+	if err != nil {
+		return awsCredentials{}, fmt.Errorf("assuming role %s: %w", roleARN, err)
+	}
+	defer res.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(res.Body, 1<<20))
+	if err != nil {
+		return awsCredentials{}, err
+	}
+	if res.StatusCode != http.StatusOK {
+		var stsErr struct {
+			Code    string `xml:"Error>Code"`
+			Message string `xml:"Error>Message"`
+		}
+		_ = xml.Unmarshal(body, &stsErr)
+		err := fmt.Errorf("assuming role %s: %s: %s: %s", roleARN, res.Status, stsErr.Code, stsErr.Message)
+		if res.StatusCode >= 400 && res.StatusCode < 500 {
+			// the role can't be assumed with this token, and retrying won't change that
+			return awsCredentials{}, fmt.Errorf("%w: %v", errAWSCredentials, err)
+		}
+		return awsCredentials{}, err
+	}
+	var assumed struct {
+		Credentials struct {
+			AccessKeyID     string    `xml:"AccessKeyId"`
+			SecretAccessKey string    `xml:"SecretAccessKey"`
+			SessionToken    string    `xml:"SessionToken"`
+			Expiration      time.Time `xml:"Expiration"`
+		} `xml:"AssumeRoleWithWebIdentityResult>Credentials"`
+	}
+	if err := xml.Unmarshal(body, &assumed); err != nil {
+		return awsCredentials{}, fmt.Errorf("reading credentials for role %s: %w", roleARN, err)
+	}
+	return awsCredentials(assumed.Credentials), nil
+}
@@ -0,0 +1,105 @@
+// Copyright 2024, Pulumi Corporation.  All rights reserved.
+
+package stack
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseCodeCommitURL(t *testing.T) {
+	repo, err := parseCodeCommitURL("https://git-codecommit.eu-west-1.amazonaws.com/v1/repos/example")
+	require.NoError(t, err)
+	assert.Equal(t, "eu-west-1", repo.region)
+	assert.Equal(t, "amazonaws.com", repo.domain)
+	assert.Equal(t, "/v1/repos/example", repo.path)
+
+	repo, err = parseCodeCommitURL("https://git-codecommit-fips.us-gov-west-1.amazonaws.com/v1/repos/example")
+	require.NoError(t, err)
+	assert.Equal(t, "us-gov-west-1", repo.region)
+
+	repo, err = parseCodeCommitURL("https://git-codecommit.cn-north-1.amazonaws.com.cn/v1/repos/example")
+	require.NoError(t, err)
+	assert.Equal(t, "amazonaws.com.cn", repo.domain)
+
+	for _, u := range []string{
+		"ssh://git-codecommit.eu-west-1.amazonaws.com/v1/repos/example",
+		"https://github.com/pulumi/examples",
+		"https://git-codecommit.example.com/v1/repos/example",
+	} {
+		_, err = parseCodeCommitURL(u)
+		assert.True(t, isStalledError(err), u)
+	}
+}
+
+func TestCodeCommitSign(t *testing.T) {
+	repo, err := parseCodeCommitURL("https://git-codecommit.eu-west-1.amazonaws.com/v1/repos/example")
+	require.NoError(t, err)
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	creds := awsCredentials{AccessKeyID: "AKIDEXAMPLE", SecretAccessKey: "wJalrXUtnFEMI/K7MDENG/bPxRfiCYEXAMPLEKEY"}
+
+	username, password := repo.sign(creds, now)
+	assert.Equal(t, "AKIDEXAMPLE", username)
+	assert.Equal(t, "20240501T120000Zc541c75a9a67a4de35d86085a365bd85863b285339d8d9899d7072c4cc9c1c12", password)
+
+	creds.SessionToken = "session"
+	username, password2 := repo.sign(creds, now)
+	assert.Equal(t, "AKIDEXAMPLE%session", username)
+	assert.Equal(t, password, password2, "the session token is not part of the signature")
+}
+
+func TestAssumeRoleWithWebIdentity(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	tokenFile := filepath.Join(t.TempDir(), "token")
+	require.NoError(t, os.WriteFile(tokenFile, []byte("web-identity-token\n"), 0600))
+
+	assumed := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.NoError(t, r.ParseForm())
+		assert.Equal(t, "AssumeRoleWithWebIdentity", r.PostForm.Get("Action"))
+		assert.Equal(t, "web-identity-token", r.PostForm.Get("WebIdentityToken"))
+		if r.PostForm.Get("RoleArn") != "arn:aws:iam::123456789012:role/git" {
+			w.WriteHeader(http.StatusForbidden)
+			fmt.Fprint(w, `<ErrorResponse><Error><Code>AccessDenied</Code><Message>Not authorized</Message></Error></ErrorResponse>`)
+			return
+		}
+		assumed++
+		fmt.Fprintf(w, `<AssumeRoleWithWebIdentityResponse><AssumeRoleWithWebIdentityResult><Credentials>
+<AccessKeyId>ASIA%d</AccessKeyId><SecretAccessKey>secret</SecretAccessKey><SessionToken>token</SessionToken>
+<Expiration>%s</Expiration></Credentials></AssumeRoleWithWebIdentityResult></AssumeRoleWithWebIdentityResponse>`,
+			assumed, now.Add(time.Hour).Format(time.RFC3339))
+	}))
+	defer server.Close()
+
+	cache := &awsCredentialsCache{credentials: map[string]awsCredentials{}}
+	creds, err := cache.get(context.TODO(), server.URL, "arn:aws:iam::123456789012:role/git", "session", tokenFile, now)
+	require.NoError(t, err)
+	assert.Equal(t, awsCredentials{
+		AccessKeyID:     "ASIA1",
+		SecretAccessKey: "secret",
+		SessionToken:    "token",
+		Expiration:      now.Add(time.Hour),
+	}, creds)
+
+	// the credentials are reused while they're good for a while yet, then replaced
+	creds, err = cache.get(context.TODO(), server.URL, "arn:aws:iam::123456789012:role/git", "session", tokenFile, now.Add(30*time.Minute))
+	require.NoError(t, err)
+	assert.Equal(t, "ASIA1", creds.AccessKeyID)
+	creds, err = cache.get(context.TODO(), server.URL, "arn:aws:iam::123456789012:role/git", "session", tokenFile, now.Add(57*time.Minute))
+	require.NoError(t, err)
+	assert.Equal(t, "ASIA2", creds.AccessKeyID)
+
+	// being refused is reported as an authentication failure
+	_, err = cache.get(context.TODO(), server.URL, "arn:aws:iam::123456789012:role/other", "session", tokenFile, now)
+	assert.ErrorContains(t, err, "AccessDenied: Not authorized")
+	assert.True(t, isGitAuthenticationError(err))
+}
@@ -0,0 +1,93 @@
+// Copyright 2024, Pulumi Corporation.  All rights reserved.
+
+package stack
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+
+	"github.com/pulumi/pulumi-kubernetes-operator/pkg/apis/pulumi/shared"
+	pulumiv1 "github.com/pulumi/pulumi-kubernetes-operator/pkg/apis/pulumi/v1"
+)
+
+// configFromIndexFieldName is the name used for indexing stacks by the ConfigMaps given in
+// .spec.configFrom.
+const configFromIndexFieldName = ".spec.configFrom.configMapRef.name" // this is an arbitrary string, named for the field it indexes
+
+// secretsFromIndexFieldName is the name used for indexing stacks by the Secrets given in
+// .spec.secretsFrom.
+const secretsFromIndexFieldName = ".spec.secretsFrom.secretRef.name" // this is an arbitrary string, named for the field it indexes
+
+// configFromConfigMapNames gives the names of the ConfigMaps the stack takes configuration from.
+func configFromConfigMapNames(spec *shared.StackSpec) []string {
+	var names []string
+	for _, source := range spec.ConfigFrom {
+		names = append(names, source.ConfigMapRef.Name)
+	}
+	return names
+}
+
+// secretsFromSecretNames gives the names of the Secrets the stack takes secret configuration from.
+func secretsFromSecretNames(spec *shared.StackSpec) []string {
+	var names []string
+	for _, source := range spec.SecretsFrom {
+		names = append(names, source.SecretRef.Name)
+	}
+	return names
+}
+
+// readConfigFrom reads the configuration given by the ConfigMaps in .spec.configFrom, and the
+// secret configuration given by the Secrets in .spec.secretsFrom, to be set by UpdateConfig.
+// Later ConfigMaps and Secrets take precedence over earlier ones. It also works out the revision
+// of the configuration, from the resourceVersions of the ConfigMaps and Secrets, so that a change
+// to any of them can be told apart from what the last update used. The revision names the objects
+// but says nothing of their contents, so it's safe to put in the status.
+func (sess *reconcileStackSession) readConfigFrom(ctx context.Context) error {
+	if len(sess.stack.ConfigFrom) == 0 && len(sess.stack.SecretsFrom) == 0 {
+		return nil
+	}
+	config := map[string]string{}
+	versions := make([]string, len(sess.stack.ConfigFrom), len(sess.stack.ConfigFrom)+len(sess.stack.SecretsFrom))
+	for i, source := range sess.stack.ConfigFrom {
+		name := source.ConfigMapRef.Name
+		configMap := &corev1.ConfigMap{}
+		if err := sess.kubeClient.Get(ctx, types.NamespacedName{Name: name, Namespace: sess.namespace}, configMap); err != nil {
+			return fmt.Errorf("resolving configFrom[%d]: ConfigMap %s/%s: %w", i, sess.namespace, name, err)
+		}
+		for k, v := range configMap.Data {
+			config[source.Prefix+k] = v
+		}
+		versions[i] = name + "@" + configMap.ResourceVersion
+	}
+	secrets := map[string]string{}
+	for i, source := range sess.stack.SecretsFrom {
+		name := source.SecretRef.Name
+		secret := &corev1.Secret{}
+		if err := sess.kubeClient.Get(ctx, types.NamespacedName{Name: name, Namespace: sess.namespace}, secret); err != nil {
+			return fmt.Errorf("resolving secretsFrom[%d]: Secret %s/%s: %w", i, sess.namespace, name, err)
+		}
+		for k, v := range secret.Data {
+			secrets[source.Prefix+k] = string(v)
+		}
+		// the ConfigMaps' entries are given without a kind, as they were before Secrets could be
+		// given, so that the revision of existing stacks doesn't change
+		versions = append(versions, "secret/"+name+"@"+secret.ResourceVersion)
+	}
+	sess.configFrom = config
+	sess.secretsFrom = secrets
+	sess.configFromRevision = strings.Join(versions, ",")
+	return nil
+}
+
+// updateUnchanged is updateUnchanged, also taking into account whether the ConfigMaps given in
+// configFrom, the Secrets given in secretsFrom, or the other Secrets and ConfigMaps the stack refers
+// to have changed since the last successful update. readConfigFrom and readReferencesRevision must
+// have been called.
+func (sess *reconcileStackSession) updateUnchanged(instance *pulumiv1.Stack, revision string) bool {
+	return updateUnchanged(instance, revision) && instance.Status.LastUpdate.ConfigFromRevision == sess.configFromRevision &&
+		referencesUnchanged(instance.Status.LastUpdate.ReferencesRevision, sess.referencesRevision)
+}
@@ -0,0 +1,116 @@
+// Copyright 2024, Pulumi Corporation.  All rights reserved.
+
+package stack
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/scheme"
+	ctrlclient "sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	"github.com/pulumi/pulumi-kubernetes-operator/pkg/apis/pulumi/shared"
+	pulumiv1 "github.com/pulumi/pulumi-kubernetes-operator/pkg/apis/pulumi/v1"
+	"github.com/pulumi/pulumi-kubernetes-operator/pkg/logging"
+)
+
+func TestReadConfigFrom(t *testing.T) {
+	logger := logging.NewLogger(t.Name(), "Request.Test", "TestReadConfigFrom")
+	common := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "common", Namespace: namespace},
+		Data:       map[string]string{"region": "us-west-2", "replicas": "2"},
+	}
+	env := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "env", Namespace: namespace},
+		Data:       map[string]string{"replicas": "5"},
+	}
+	credentials := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "credentials", Namespace: namespace},
+		Data:       map[string][]byte{"accessKey": []byte("AKIA"), "secretKey": []byte("hunter2")},
+	}
+	client := fake.NewFakeClientWithScheme(scheme.Scheme, common, env, credentials)
+	source := func(prefix, name string) shared.ConfigFromSource {
+		return shared.ConfigFromSource{Prefix: prefix, ConfigMapRef: shared.ConfigFromConfigMapReference{Name: name}}
+	}
+	secretSource := func(prefix, name string) shared.SecretsFromSource {
+		return shared.SecretsFromSource{Prefix: prefix, SecretRef: shared.SecretsFromSecretReference{Name: name}}
+	}
+	version := func(obj ctrlclient.Object) string {
+		require.NoError(t, client.Get(context.TODO(), ctrlclient.ObjectKeyFromObject(obj), obj))
+		return obj.GetResourceVersion()
+	}
+
+	t.Run("none", func(t *testing.T) {
+		sess := newReconcileStackSession(logger, shared.StackSpec{}, client, namespace)
+		require.NoError(t, sess.readConfigFrom(context.TODO()))
+		assert.Empty(t, sess.configFrom)
+		assert.Equal(t, "", sess.configFromRevision)
+	})
+
+	t.Run("merged in order", func(t *testing.T) {
+		sess := newReconcileStackSession(logger, shared.StackSpec{
+			ConfigFrom: []shared.ConfigFromSource{source("aws:", "common"), source("", "common"), source("", "env")},
+		}, client, namespace)
+		require.NoError(t, sess.readConfigFrom(context.TODO()))
+		assert.Equal(t, map[string]string{
+			"aws:region":   "us-west-2",
+			"aws:replicas": "2",
+			"region":       "us-west-2",
+			"replicas":     "5",
+		}, sess.configFrom)
+		assert.Equal(t, "common@"+version(common)+",common@"+version(common)+",env@"+version(env), sess.configFromRevision)
+	})
+
+	t.Run("secrets", func(t *testing.T) {
+		sess := newReconcileStackSession(logger, shared.StackSpec{
+			ConfigFrom:  []shared.ConfigFromSource{source("", "env")},
+			SecretsFrom: []shared.SecretsFromSource{secretSource("aws:", "credentials")},
+		}, client, namespace)
+		require.NoError(t, sess.readConfigFrom(context.TODO()))
+		assert.Equal(t, map[string]string{"replicas": "5"}, sess.configFrom)
+		assert.Equal(t, map[string]string{"aws:accessKey": "AKIA", "aws:secretKey": "hunter2"}, sess.secretsFrom)
+		assert.Equal(t, "env@"+version(env)+",secret/credentials@"+version(credentials), sess.configFromRevision)
+		assert.NotContains(t, sess.configFromRevision, "hunter2")
+	})
+
+	t.Run("missing", func(t *testing.T) {
+		sess := newReconcileStackSession(logger, shared.StackSpec{
+			ConfigFrom: []shared.ConfigFromSource{source("", "common"), source("", "absent")},
+		}, client, namespace)
+		err := sess.readConfigFrom(context.TODO())
+		require.Error(t, err)
+		assert.True(t, isMissingReference(err))
+		assert.Contains(t, err.Error(), "configFrom[1]: ConfigMap "+namespace+"/absent")
+	})
+
+	t.Run("missing Secret", func(t *testing.T) {
+		sess := newReconcileStackSession(logger, shared.StackSpec{
+			SecretsFrom: []shared.SecretsFromSource{secretSource("", "absent")},
+		}, client, namespace)
+		err := sess.readConfigFrom(context.TODO())
+		require.Error(t, err)
+		assert.True(t, isMissingReference(err))
+		assert.Contains(t, err.Error(), "secretsFrom[0]: Secret "+namespace+"/absent")
+	})
+}
+
+func TestUpdateUnchangedWithConfigFrom(t *testing.T) {
+	const commit = "0123456789abcdef0123456789abcdef01234567"
+	instance := &pulumiv1.Stack{ObjectMeta: metav1.ObjectMeta{Generation: 1}}
+	instance.Status.LastUpdate = &shared.StackUpdateState{
+		State:                    shared.SucceededStackStateMessage,
+		LastSuccessfulCommit:     commit,
+		LastSuccessfulGeneration: 1,
+		ConfigFromRevision:       "env@1",
+	}
+	sess := &reconcileStackSession{configFromRevision: "env@1"}
+	assert.True(t, sess.updateUnchanged(instance, commit))
+	sess.configFromRevision = "env@2"
+	assert.False(t, sess.updateUnchanged(instance, commit), "ConfigMap changed")
+	assert.False(t, sess.updateUnchanged(instance, "fedcba9876543210fedcba9876543210fedcba98"), "new commit")
+}
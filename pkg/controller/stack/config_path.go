@@ -0,0 +1,241 @@
+// Copyright 2024, Pulumi Corporation.  All rights reserved.
+
+package stack
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/pulumi/pulumi/sdk/v3/go/common/resource/config"
+
+	"github.com/pulumi/pulumi-kubernetes-operator/pkg/apis/pulumi/shared"
+)
+
+// configPathHole stands in for an element of a list which no path in .spec.configPath has given a
+// value, e.g., index 0 when only `app:hosts[1]` is given.
+type configPathHole struct{}
+
+// parseConfigPath splits a path from .spec.configPath into the configuration key it starts with,
+// and the elements of the path under that key; each either a property name (a string) or a list
+// index (an int). The syntax is that of `pulumi config set --path`: properties are given as
+// `.name` or `["name"]`, and list indices as `[n]`.
+func parseConfigPath(path string) (string, []interface{}, error) {
+	end := strings.IndexAny(path, ".[")
+	if end == -1 {
+		end = len(path)
+	}
+	key, rest := path[:end], path[end:]
+	if key == "" {
+		return "", nil, fmt.Errorf("path does not start with a configuration key")
+	}
+
+	var elems []interface{}
+	for rest != "" {
+		switch {
+		case rest[0] == '.':
+			rest = rest[1:]
+			end := strings.IndexAny(rest, ".[")
+			if end == -1 {
+				end = len(rest)
+			}
+			if end == 0 {
+				return "", nil, fmt.Errorf("empty property name in path")
+			}
+			elems = append(elems, rest[:end])
+			rest = rest[end:]
+		case strings.HasPrefix(rest, `["`):
+			end := strings.Index(rest, `"]`)
+			if end == -1 {
+				return "", nil, fmt.Errorf("missing closing \"] in path")
+			}
+			elems = append(elems, rest[2:end])
+			rest = rest[end+2:]
+		default: // rest[0] == '['
+			end := strings.IndexByte(rest, ']')
+			if end == -1 {
+				return "", nil, fmt.Errorf("missing closing ] in path")
+			}
+			index, err := strconv.Atoi(rest[1:end])
+			if err != nil || index < 0 {
+				return "", nil, fmt.Errorf("invalid list index %q in path", rest[1:end])
+			}
+			elems = append(elems, index)
+			rest = rest[end+1:]
+		}
+	}
+	return key, elems, nil
+}
+
+// buildConfigPaths combines the values given in .spec.configPath into a value for each
+// configuration key. Numbers are kept as json.Number, so they are written back as they were
+// given. A path conflicting with the flat configuration, or with another path, is a spec error.
+func buildConfigPaths(spec *shared.StackSpec) (map[string]interface{}, error) {
+	paths := make([]string, 0, len(spec.ConfigPath))
+	for p := range spec.ConfigPath {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+
+	values := map[string]interface{}{}
+	for _, p := range paths {
+		key, elems, err := parseConfigPath(p)
+		if err != nil {
+			return nil, newStallErrorf("configPath %q is not a valid path: %v", p, err)
+		}
+		if flatConfigKey(spec, key) {
+			return nil, newStallErrorf("configPath %q conflicts with the key %q given in config, configValues, configRefs, secrets or secretsRef", p, key)
+		}
+		raw := spec.ConfigPath[p]
+		dec := json.NewDecoder(bytes.NewReader(raw.Raw))
+		dec.UseNumber()
+		var v interface{}
+		if err := dec.Decode(&v); err != nil {
+			return nil, newStallErrorf("configPath %q does not have a valid JSON value: %v", p, err)
+		}
+		current, present := values[key]
+		value, ok := setConfigPath(current, present, elems, v)
+		if !ok {
+			return nil, newStallErrorf("configPath %q conflicts with another path in configPath", p)
+		}
+		values[key] = value
+	}
+
+	for key, v := range values {
+		if hasConfigPathHole(v) {
+			return nil, newStallErrorf("configPath leaves an element of a list under %q without a value", key)
+		}
+	}
+	return values, nil
+}
+
+// flatConfigKey reports whether the configuration key given is set other than by configPath.
+func flatConfigKey(spec *shared.StackSpec, key string) bool {
+	if _, ok := spec.Config[key]; ok {
+		return true
+	}
+	if _, ok := spec.ConfigValues[key]; ok {
+		return true
+	}
+	if _, ok := spec.ConfigRefs[key]; ok {
+		return true
+	}
+	if _, ok := spec.Secrets[key]; ok {
+		return true
+	}
+	_, ok := spec.SecretRefs[key]
+	return ok
+}
+
+// setConfigPath sets the value at the path given under the value at, which is present or not, and
+// returns the result. It returns false if a value is already present at the path, or the path
+// runs into a value that's not a map or list as the path requires.
+func setConfigPath(at interface{}, present bool, elems []interface{}, v interface{}) (interface{}, bool) {
+	if _, hole := at.(configPathHole); hole {
+		present = false
+	}
+	if len(elems) == 0 {
+		return v, !present
+	}
+	switch elem := elems[0].(type) {
+	case string:
+		if !present {
+			at = map[string]interface{}{}
+		}
+		m, ok := at.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		child, present := m[elem]
+		if m[elem], ok = setConfigPath(child, present, elems[1:], v); !ok {
+			return nil, false
+		}
+		return m, true
+	case int:
+		if !present {
+			at = []interface{}{}
+		}
+		l, ok := at.([]interface{})
+		if !ok {
+			return nil, false
+		}
+		for len(l) <= elem {
+			l = append(l, configPathHole{})
+		}
+		if l[elem], ok = setConfigPath(l[elem], true, elems[1:], v); !ok {
+			return nil, false
+		}
+		return l, true
+	}
+	return nil, false
+}
+
+func hasConfigPathHole(v interface{}) bool {
+	switch v := v.(type) {
+	case configPathHole:
+		return true
+	case map[string]interface{}:
+		for _, e := range v {
+			if hasConfigPathHole(e) {
+				return true
+			}
+		}
+	case []interface{}:
+		for _, e := range v {
+			if hasConfigPathHole(e) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// setConfigPaths writes the values given in .spec.configPath to the stack settings. These are
+// written as structured values, rather than through `pulumi config set`, which would give them
+// all as strings.
+func (sess *reconcileStackSession) setConfigPaths(ctx context.Context) error {
+	values, err := buildConfigPaths(&sess.stack)
+	if err != nil {
+		return err
+	}
+	w := sess.autoStack.Workspace()
+	project, err := w.ProjectSettings(ctx)
+	if err != nil {
+		return fmt.Errorf("unable to get project settings: %w", err)
+	}
+	settings, err := w.StackSettings(ctx, sess.stack.Stack)
+	if err != nil {
+		return fmt.Errorf("unable to get stack settings: %w", err)
+	}
+	if settings.Config == nil {
+		settings.Config = config.Map{}
+	}
+	for k, v := range values {
+		name := k
+		if !strings.Contains(name, ":") {
+			// as for `pulumi config set`, a key without a namespace belongs to the project
+			name = string(project.Name) + ":" + name
+		}
+		key, err := config.ParseKey(name)
+		if err != nil {
+			return fmt.Errorf("configPath key %q: %w", k, err)
+		}
+		if s, ok := v.(string); ok {
+			settings.Config[key] = config.NewValue(s)
+			continue
+		}
+		raw, err := json.Marshal(v)
+		if err != nil {
+			return fmt.Errorf("configPath key %q: %w", k, err)
+		}
+		settings.Config[key] = config.NewObjectValue(string(raw))
+	}
+	if err := w.SaveStackSettings(ctx, sess.stack.Stack, settings); err != nil {
+		return fmt.Errorf("failed to save stack settings: %w", err)
+	}
+	return nil
+}
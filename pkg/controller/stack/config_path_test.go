@@ -0,0 +1,101 @@
+// Copyright 2024, Pulumi Corporation.  All rights reserved.
+
+package stack
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+
+	"github.com/pulumi/pulumi-kubernetes-operator/pkg/apis/pulumi/shared"
+)
+
+func TestParseConfigPath(t *testing.T) {
+	key, elems, err := parseConfigPath("aws:defaultTags.tags.Team")
+	require.NoError(t, err)
+	assert.Equal(t, "aws:defaultTags", key)
+	assert.Equal(t, []interface{}{"tags", "Team"}, elems)
+
+	key, elems, err = parseConfigPath(`app:servers[1]["host.name"].port`)
+	require.NoError(t, err)
+	assert.Equal(t, "app:servers", key)
+	assert.Equal(t, []interface{}{1, "host.name", "port"}, elems)
+
+	key, elems, err = parseConfigPath("app:flag")
+	require.NoError(t, err)
+	assert.Equal(t, "app:flag", key)
+	assert.Empty(t, elems)
+
+	for _, bad := range []string{"", ".tags", "app:tags..Team", "app:tags.", "app:list[", "app:list[x]", "app:list[-1]", `app:tags["Team`} {
+		_, _, err := parseConfigPath(bad)
+		assert.Error(t, err, bad)
+	}
+}
+
+func TestBuildConfigPaths(t *testing.T) {
+	spec := func(paths map[string]string) *shared.StackSpec {
+		s := &shared.StackSpec{ConfigPath: map[string]apiextensionsv1.JSON{}}
+		for p, v := range paths {
+			s.ConfigPath[p] = apiextensionsv1.JSON{Raw: []byte(v)}
+		}
+		return s
+	}
+
+	values, err := buildConfigPaths(spec(map[string]string{
+		"aws:defaultTags.tags.Team":  `"platform"`,
+		"aws:defaultTags.tags.Owner": `"ops"`,
+		"app:replicas":               `3`,
+		"app:debug":                  `true`,
+		"app:hosts[0]":               `"a.example.com"`,
+		"app:hosts[1]":               `"b.example.com"`,
+		"app:limits":                 `{"cpu": 1.5, "burst": false}`,
+	}))
+	require.NoError(t, err)
+	encoded, err := json.Marshal(values)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{
+		"aws:defaultTags": {"tags": {"Team": "platform", "Owner": "ops"}},
+		"app:replicas": 3,
+		"app:debug": true,
+		"app:hosts": ["a.example.com", "b.example.com"],
+		"app:limits": {"cpu": 1.5, "burst": false}
+	}`, string(encoded))
+
+	t.Run("conflicts with flat config", func(t *testing.T) {
+		s := spec(map[string]string{"aws:defaultTags.tags.Team": `"platform"`})
+		s.Config = map[string]string{"aws:defaultTags": `{"tags":{}}`}
+		_, err := buildConfigPaths(s)
+		assert.True(t, isStalledError(err))
+		assert.Contains(t, err.Error(), `"aws:defaultTags"`)
+
+		s = spec(map[string]string{"app:password": `"hunter2"`})
+		s.SecretRefs = map[string]shared.ResourceRef{"app:password": shared.NewLiteralResourceRef("hunter2")}
+		_, err = buildConfigPaths(s)
+		assert.True(t, isStalledError(err))
+	})
+
+	t.Run("conflicts between paths", func(t *testing.T) {
+		for _, paths := range []map[string]string{
+			{"app:tags": `{"a": "b"}`, "app:tags.a": `"c"`},
+			{"app:tags": `"x"`, "app:tags.a": `"c"`},
+			{"app:tags.a": `"x"`, "app:tags.a.b": `"c"`},
+			{"app:list[0]": `"x"`, "app:list.name": `"c"`},
+		} {
+			_, err := buildConfigPaths(spec(paths))
+			assert.True(t, isStalledError(err), "%v", paths)
+		}
+	})
+
+	t.Run("list with no value at an index", func(t *testing.T) {
+		_, err := buildConfigPaths(spec(map[string]string{"app:hosts[1]": `"b.example.com"`}))
+		assert.True(t, isStalledError(err))
+	})
+
+	t.Run("invalid value", func(t *testing.T) {
+		_, err := buildConfigPaths(spec(map[string]string{"app:hosts": `[`}))
+		assert.True(t, isStalledError(err))
+	})
+}
@@ -0,0 +1,123 @@
+// Copyright 2024, Pulumi Corporation.  All rights reserved.
+
+package stack
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/pulumi/pulumi/sdk/v3/go/auto"
+	"github.com/pulumi/pulumi/sdk/v3/go/common/resource/config"
+)
+
+// With .spec.pruneConfig, the configuration given in the spec is the source of truth for the
+// stack's configuration. After the spec's configuration has been applied, any key left in the
+// stack's settings which the spec doesn't give is removed, unless it was in the settings file
+// before the spec's configuration was applied (i.e., it's checked in with the program). Keys are
+// compared in their qualified form (`<namespace>:<name>`), since a key given in the spec without
+// a namespace belongs to the project.
+//
+// Where the stack's settings outlive a single run (e.g., a projectPath that isn't copied), a key
+// set by the operator is in the settings file the next time around, and would look as if it were
+// checked in. So the keys the operator introduced (those it set which weren't checked in) are
+// recorded in the status, whether or not pruning is on; a recorded key is pruned once the spec
+// no longer gives it, wherever it's found.
+
+// qualifyConfigKey gives the configuration key in its qualified form.
+func qualifyConfigKey(project, key string) string {
+	if strings.Contains(key, ":") {
+		return key
+	}
+	return project + ":" + key
+}
+
+// configKeysToPrune gives the keys in the stack's settings which aren't given in the spec
+// (managed), and either aren't checked in or were recorded as introduced by the operator, in
+// order. The managed keys may be unqualified.
+func configKeysToPrune(project string, settings []string, managed []string, checkedIn, recorded map[string]bool) []string {
+	keep := make(map[string]bool, len(managed))
+	for _, k := range managed {
+		keep[qualifyConfigKey(project, k)] = true
+	}
+	var prune []string
+	for _, k := range settings {
+		if !keep[k] && (!checkedIn[k] || recorded[k]) {
+			prune = append(prune, k)
+		}
+	}
+	sort.Strings(prune)
+	return prune
+}
+
+// configKeysToRecord gives the keys given in the spec (managed) which the operator introduced:
+// those not checked in, and those recorded before. They're qualified, in order, without repeats.
+func configKeysToRecord(project string, managed []string, checkedIn, recorded map[string]bool) []string {
+	seen := make(map[string]bool, len(managed))
+	var record []string
+	for _, k := range managed {
+		k = qualifyConfigKey(project, k)
+		if !seen[k] && (!checkedIn[k] || recorded[k]) {
+			seen[k] = true
+			record = append(record, k)
+		}
+	}
+	sort.Strings(record)
+	return record
+}
+
+// syncConfigKeys records the configuration keys the operator introduced, and with
+// .spec.pruneConfig, removes from the stack's settings the keys no longer given in the spec; see
+// above. The configuration applied from the spec is given, and configPath is taken from the spec.
+func (sess *reconcileStackSession) syncConfigKeys(ctx context.Context, applied auto.ConfigMap) error {
+	managed := make([]string, 0, len(applied)+len(sess.stack.ConfigPath))
+	for k := range applied {
+		managed = append(managed, k)
+	}
+	for path := range sess.stack.ConfigPath {
+		// the path has been checked already, when the values were set
+		if key, _, err := parseConfigPath(path); err == nil {
+			managed = append(managed, key)
+		}
+	}
+
+	w := sess.autoStack.Workspace()
+	project, err := w.ProjectSettings(ctx)
+	if err != nil {
+		return fmt.Errorf("unable to get project settings: %w", err)
+	}
+	recorded := make(map[string]bool, len(sess.recordedConfigKeys))
+	for _, k := range sess.recordedConfigKeys {
+		recorded[k] = true
+	}
+	record := configKeysToRecord(string(project.Name), managed, sess.checkedInConfig, recorded)
+	if !sess.stack.PruneConfig {
+		sess.configKeys, sess.configKeysSynced = record, true
+		return nil
+	}
+
+	settings, err := w.StackSettings(ctx, sess.stack.Stack)
+	if err != nil {
+		return fmt.Errorf("unable to get stack settings: %w", err)
+	}
+	present := make([]string, 0, len(settings.Config))
+	keys := make(map[string]config.Key, len(settings.Config))
+	for k := range settings.Config {
+		present = append(present, k.String())
+		keys[k.String()] = k
+	}
+	prune := configKeysToPrune(string(project.Name), present, managed, sess.checkedInConfig, recorded)
+	if len(prune) > 0 {
+		for _, k := range prune {
+			delete(settings.Config, keys[k])
+		}
+		if err := w.SaveStackSettings(ctx, sess.stack.Stack, settings); err != nil {
+			return fmt.Errorf("failed to save stack settings: %w", err)
+		}
+		sess.logger.Info("Removed configuration not given in the stack spec", "Stack.Name", sess.stack.Stack, "keys", prune)
+	}
+	// only once the keys no longer given are gone are they forgotten
+	sess.configKeys, sess.configKeysSynced = record, true
+	return nil
+}
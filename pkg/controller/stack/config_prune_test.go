@@ -0,0 +1,46 @@
+// Copyright 2024, Pulumi Corporation.  All rights reserved.
+
+package stack
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConfigKeysToPrune(t *testing.T) {
+	settings := []string{"app:flag", "app:stale", "aws:region", "aws:profile", "app:checkedIn", "app:both"}
+	managed := []string{"flag", "aws:region", "both", "notYetApplied"}
+	checkedIn := map[string]bool{"app:checkedIn": true, "app:both": true}
+
+	assert.Equal(t, []string{"app:stale", "aws:profile"}, configKeysToPrune("app", settings, managed, checkedIn, nil))
+	assert.Empty(t, configKeysToPrune("app", settings, settings, nil, nil), "nothing is pruned when everything is given in the spec")
+	assert.Equal(t, []string{"app:flag", "app:stale", "aws:profile", "aws:region"},
+		configKeysToPrune("app", settings, nil, checkedIn, nil), "everything not checked in is pruned when the spec gives nothing")
+	assert.Equal(t, []string{"app:flag"}, configKeysToPrune("app", []string{"app:flag"}, []string{"other:flag"}, nil, nil),
+		"a key given with another namespace is a different key")
+
+	// where the settings outlive a run, a key the operator set looks checked in the next time
+	checkedIn["app:flag"] = true
+	assert.Equal(t, []string{"app:stale", "aws:profile"}, configKeysToPrune("app", settings, managed, checkedIn, nil))
+	assert.Equal(t, []string{"app:flag", "app:stale", "aws:profile"},
+		configKeysToPrune("app", settings, []string{"aws:region", "both"}, checkedIn, map[string]bool{"app:flag": true}),
+		"a key the operator introduced is pruned though it looks checked in")
+}
+
+func TestConfigKeysToRecord(t *testing.T) {
+	managed := []string{"flag", "aws:region", "both", "app:flag"}
+	checkedIn := map[string]bool{"app:both": true, "aws:region": true}
+
+	assert.Equal(t, []string{"app:flag"}, configKeysToRecord("app", managed, checkedIn, nil),
+		"keys checked in are not the operator's")
+	checkedIn["app:flag"] = true
+	assert.Equal(t, []string{"app:flag"}, configKeysToRecord("app", managed, checkedIn, map[string]bool{"app:flag": true}),
+		"a key recorded stays recorded while it's given")
+	assert.Empty(t, configKeysToRecord("app", nil, checkedIn, map[string]bool{"app:flag": true}))
+}
+
+func TestQualifyConfigKey(t *testing.T) {
+	assert.Equal(t, "app:flag", qualifyConfigKey("app", "flag"))
+	assert.Equal(t, "aws:region", qualifyConfigKey("app", "aws:region"))
+}
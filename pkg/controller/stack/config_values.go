@@ -0,0 +1,25 @@
+// Copyright 2024, Pulumi Corporation.  All rights reserved.
+
+package stack
+
+import (
+	"sort"
+
+	"github.com/pulumi/pulumi-kubernetes-operator/pkg/apis/pulumi/shared"
+)
+
+// validateConfigValues checks that no key is given in both config and configValues, since it
+// wouldn't be clear whether the value is meant to be secret.
+func validateConfigValues(spec *shared.StackSpec) error {
+	var keys []string
+	for k := range spec.ConfigValues {
+		if _, ok := spec.Config[k]; ok {
+			keys = append(keys, k)
+		}
+	}
+	if len(keys) == 0 {
+		return nil
+	}
+	sort.Strings(keys)
+	return newStallErrorf("configuration keys %q are given in both config and configValues", keys)
+}
@@ -0,0 +1,28 @@
+// Copyright 2024, Pulumi Corporation.  All rights reserved.
+
+package stack
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/pulumi/pulumi-kubernetes-operator/pkg/apis/pulumi/shared"
+)
+
+func TestValidateConfigValues(t *testing.T) {
+	spec := shared.StackSpec{
+		Config: map[string]string{"aws:region": "us-west-2", "app:name": "web"},
+		ConfigValues: map[string]shared.ConfigValue{
+			"app:password": {Value: "hunter2", Secret: true},
+			"app:replicas": {Value: "3"},
+		},
+	}
+	assert.NoError(t, validateConfigValues(&spec))
+
+	spec.ConfigValues["app:name"] = shared.ConfigValue{Value: "api", Secret: true}
+	spec.ConfigValues["aws:region"] = shared.ConfigValue{Value: "us-east-1"}
+	err := validateConfigValues(&spec)
+	assert.True(t, isStalledError(err))
+	assert.Contains(t, err.Error(), `["app:name" "aws:region"]`)
+}
@@ -0,0 +1,112 @@
+// Copyright 2024, Pulumi Corporation.  All rights reserved.
+
+package stack
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	"github.com/pulumi/pulumi-kubernetes-operator/pkg/apis/pulumi/shared"
+	pulumiv1 "github.com/pulumi/pulumi-kubernetes-operator/pkg/apis/pulumi/v1"
+)
+
+// secretRotatedAt gives the time a Secret's contents were last rotated. This is the time given in
+// its pulumi.com/rotated-at annotation, if it has one; otherwise, the last time its data was
+// written, according to its managed fields; and failing that, the time it was created.
+func secretRotatedAt(secret *corev1.Secret) (time.Time, error) {
+	if v, ok := secret.Annotations[shared.RotatedAtAnnotation]; ok {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("invalid %s annotation %q: %w", shared.RotatedAtAnnotation, v, err)
+		}
+		return t, nil
+	}
+	var latest time.Time
+	for _, entry := range secret.ManagedFields {
+		if entry.Time == nil || entry.FieldsV1 == nil {
+			continue
+		}
+		if !bytes.Contains(entry.FieldsV1.Raw, []byte(`"f:data"`)) && !bytes.Contains(entry.FieldsV1.Raw, []byte(`"f:stringData"`)) {
+			continue
+		}
+		if entry.Time.Time.After(latest) {
+			latest = entry.Time.Time
+		}
+	}
+	if latest.IsZero() {
+		latest = secret.CreationTimestamp.Time
+	}
+	return latest, nil
+}
+
+// staleCredentials gives a description of each of the Secrets the stack refers to which is older
+// than .spec.credentialMaxAge, or whose age can't be told. Secrets which don't exist are left for
+// resolving the references to deal with.
+func (sess *reconcileStackSession) staleCredentials(ctx context.Context, now time.Time) ([]string, error) {
+	maxAge := sess.stack.CredentialMaxAge.Duration
+	var stale []string
+	for _, name := range referencedSecrets(sess.namespace, &sess.stack) {
+		var secret corev1.Secret
+		if err := sess.kubeClient.Get(ctx, types.NamespacedName{Namespace: sess.namespace, Name: name}, &secret); err != nil {
+			if isMissingReference(err) {
+				continue
+			}
+			return nil, fmt.Errorf("checking age of Secret %s/%s: %w", sess.namespace, name, err)
+		}
+		rotated, err := secretRotatedAt(&secret)
+		if err != nil {
+			stale = append(stale, fmt.Sprintf("%s (%v)", name, err))
+			continue
+		}
+		if now.Sub(rotated) > maxAge {
+			stale = append(stale, fmt.Sprintf("%s (last rotated %s)", name, rotated.UTC().Format(time.RFC3339)))
+		}
+	}
+	return stale, nil
+}
+
+// checkCredentialAge checks the age of the stack's credentials against .spec.credentialMaxAge,
+// recording the outcome in the CredentialsStale condition. If the stack is not to be run, because
+// its credentials are stale and the policy is to refuse, it returns a message saying why.
+func (r *ReconcileStack) checkCredentialAge(ctx context.Context, sess *reconcileStackSession, instance *pulumiv1.Stack) (string, error) {
+	if sess.stack.CredentialMaxAge == nil {
+		instance.Status.ClearCredentialsStaleCondition()
+		return "", nil
+	}
+	maxAge := sess.stack.CredentialMaxAge.Duration
+	stale, err := sess.staleCredentials(ctx, time.Now())
+	if err != nil {
+		return "", err
+	}
+	if len(stale) == 0 {
+		instance.Status.MarkCredentialsStaleCondition(metav1.ConditionFalse, pulumiv1.CredentialsWithinMaxAgeReason,
+			fmt.Sprintf("all Secrets were rotated within %s", maxAge))
+		return "", nil
+	}
+
+	msg := fmt.Sprintf("Secrets older than credentialMaxAge (%s): %s", maxAge, strings.Join(stale, ", "))
+	instance.Status.MarkCredentialsStaleCondition(metav1.ConditionTrue, pulumiv1.CredentialsStaleReason, msg)
+	r.emitEvent(instance, pulumiv1.StackCredentialsStaleEvent(), "%s", msg)
+	if sess.stack.CredentialAgePolicy != shared.CredentialAgePolicyRefuse {
+		sess.logger.Info("WARNING: running stack with stale credentials", "Stack.Name", sess.stack.Stack, "Secrets", stale)
+		return "", nil
+	}
+	sess.logger.Info("Refusing to run stack with stale credentials", "Stack.Name", sess.stack.Stack, "Secrets", stale)
+	return msg, nil
+}
+
+// credentialsStale records that the stack was refused a run by checkCredentialAge, and gives up on
+// it until it is changed. Rotating one of the Secrets changes it, so ends the abandonment.
+func (r *ReconcileStack) credentialsStale(sess *reconcileStackSession, instance *pulumiv1.Stack, msg string) (reconcile.Result, error) {
+	r.markStackFailed(sess, instance, fmt.Errorf("refusing to run: %s", msg), "", "")
+	instance.Status.LastUpdate.Reason = pulumiv1.StalledCredentialsStaleReason
+	return r.abandon(instance, pulumiv1.StalledCredentialsStaleReason, msg)
+}
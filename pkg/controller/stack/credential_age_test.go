@@ -0,0 +1,108 @@
+// Copyright 2024, Pulumi Corporation.  All rights reserved.
+
+package stack
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	"github.com/pulumi/pulumi-kubernetes-operator/pkg/apis/pulumi/shared"
+	pulumiv1 "github.com/pulumi/pulumi-kubernetes-operator/pkg/apis/pulumi/v1"
+	"github.com/pulumi/pulumi-kubernetes-operator/pkg/logging"
+)
+
+func TestSecretRotatedAt(t *testing.T) {
+	created := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	written := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	labelled := time.Date(2024, 4, 1, 0, 0, 0, 0, time.UTC)
+	managed := func(at time.Time, fields string) metav1.ManagedFieldsEntry {
+		ts := metav1.NewTime(at)
+		return metav1.ManagedFieldsEntry{Manager: "kubectl", Time: &ts, FieldsV1: &metav1.FieldsV1{Raw: []byte(fields)}}
+	}
+
+	secret := &corev1.Secret{ObjectMeta: metav1.ObjectMeta{CreationTimestamp: metav1.NewTime(created)}}
+	rotated, err := secretRotatedAt(secret)
+	require.NoError(t, err)
+	assert.Equal(t, created, rotated, "never written since it was created")
+
+	// writing the labels doesn't rotate the contents
+	secret.ManagedFields = []metav1.ManagedFieldsEntry{
+		managed(written, `{"f:data":{"f:password":{}}}`),
+		managed(labelled, `{"f:metadata":{"f:labels":{"f:team":{}}}}`),
+	}
+	rotated, err = secretRotatedAt(secret)
+	require.NoError(t, err)
+	assert.Equal(t, written, rotated)
+
+	// the annotation is believed over the metadata, which a controller may keep writing
+	secret.Annotations = map[string]string{shared.RotatedAtAnnotation: "2024-02-01T00:00:00Z"}
+	rotated, err = secretRotatedAt(secret)
+	require.NoError(t, err)
+	assert.Equal(t, time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC), rotated.UTC())
+
+	secret.Annotations[shared.RotatedAtAnnotation] = "last tuesday"
+	_, err = secretRotatedAt(secret)
+	assert.ErrorContains(t, err, shared.RotatedAtAnnotation)
+}
+
+func TestStaleCredentials(t *testing.T) {
+	logger := logging.NewLogger(t.Name(), "Request.Test", "TestStaleCredentials")
+	now := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+	secret := func(name string, rotated string) *corev1.Secret {
+		return &corev1.Secret{ObjectMeta: metav1.ObjectMeta{
+			Name:        name,
+			Namespace:   namespace,
+			Annotations: map[string]string{shared.RotatedAtAnnotation: rotated},
+		}}
+	}
+	client := fake.NewFakeClientWithScheme(scheme.Scheme,
+		secret("fresh", "2024-05-20T00:00:00Z"),
+		secret("stale", "2024-01-01T00:00:00Z"),
+		secret("unknown", "soon"),
+	)
+
+	sess := newReconcileStackSession(logger, shared.StackSpec{
+		CredentialMaxAge: &metav1.Duration{Duration: 30 * 24 * time.Hour},
+		EnvRefs: map[string]shared.ResourceRef{
+			"AWS_ACCESS_KEY_ID": shared.NewSecretResourceRef(namespace, "stale", "key"),
+			"GITHUB_TOKEN":      shared.NewSecretResourceRef(namespace, "fresh", "token"),
+		},
+		SecretEnvs: []string{"unknown", "absent"},
+	}, client, namespace)
+	stale, err := sess.staleCredentials(context.TODO(), now)
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{
+		"stale (last rotated 2024-01-01T00:00:00Z)",
+		`unknown (invalid pulumi.com/rotated-at annotation "soon": parsing time "soon" as "2006-01-02T15:04:05Z07:00": cannot parse "soon" as "2006")`,
+	}, stale)
+
+	sess.stack.CredentialMaxAge.Duration = 365 * 24 * time.Hour
+	sess.stack.SecretEnvs = nil
+	stale, err = sess.staleCredentials(context.TODO(), now)
+	require.NoError(t, err)
+	assert.Empty(t, stale)
+}
+
+func TestCredentialsStale(t *testing.T) {
+	logger := logging.NewLogger(t.Name(), "Request.Test", "TestCredentialsStale")
+	r := &ReconcileStack{recorder: record.NewFakeRecorder(10)}
+	sess := newReconcileStackSession(logger, shared.StackSpec{}, nil, namespace)
+	instance := &pulumiv1.Stack{ObjectMeta: metav1.ObjectMeta{Name: "stale", Namespace: namespace, Generation: 1}}
+
+	res, err := r.credentialsStale(sess, instance, "Secrets older than credentialMaxAge (720h0m0s): stale")
+	require.NoError(t, err)
+	assert.Zero(t, res, "not retried until the stack or a Secret changes")
+	assert.True(t, isAbandoned(&instance.Status))
+	require.NotNil(t, instance.Status.Abandoned)
+	assert.Equal(t, pulumiv1.StalledCredentialsStaleReason, instance.Status.Abandoned.Reason)
+	assert.Equal(t, pulumiv1.StalledCredentialsStaleReason, instance.Status.LastUpdate.Reason)
+}
@@ -0,0 +1,257 @@
+// Copyright 2024, Pulumi Corporation.  All rights reserved.
+
+package stack
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strings"
+
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	apimeta "k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/pulumi/pulumi-kubernetes-operator/pkg/apis/pulumi/shared"
+	pulumiv1 "github.com/pulumi/pulumi-kubernetes-operator/pkg/apis/pulumi/v1"
+)
+
+// The stacks given in .spec.dependsOn are put into effect with what's already there for
+// prerequisites and StackOutput refs: each stack depended on is made a prerequisite, and each
+// output mapped into the stack becomes a StackOutput ref in configRefs, secretsRef or envRefs.
+// On top of that, a stack depended on must be Ready (not only have succeeded the last time it
+// ran), a change to the outputs used has the stack updated again, and a cycle of dependencies
+// stalls the stack rather than leaving every stack in it waiting forever. A stack whose outputs
+// are used through a StackOutput ref given directly is a dependency too, in all but having to be
+// Ready: the stack waits for it to produce outputs, and is updated again when they change.
+
+var errDependencyNotReady = fmt.Errorf("stack depended on is not Ready")
+
+// dependencyNames gives the names of the stacks the stack depends on, through prerequisites,
+// dependsOn or StackOutput refs.
+func dependencyNames(spec *shared.StackSpec) []string {
+	var names []string
+	seen := map[string]bool{}
+	add := func(name string) {
+		if !seen[name] {
+			seen[name] = true
+			names = append(names, name)
+		}
+	}
+	for _, prereq := range spec.Prerequisites {
+		add(prereq.Name)
+	}
+	for _, dep := range spec.DependsOn {
+		add(dep.Name)
+	}
+	for _, sel := range stackOutputSelectors(spec) {
+		add(sel.Name)
+	}
+	return names
+}
+
+// stackOutputSelectors gives the outputs of other stacks used, through dependsOn or StackOutput
+// refs in configRefs, secretRefs and envRefs, grouped by stack and ordered by output, without
+// repeats. The spec may or may not have had dependsOn expanded.
+func stackOutputSelectors(spec *shared.StackSpec) []shared.StackOutputSelector {
+	seen := map[shared.StackOutputSelector]bool{}
+	var sels []shared.StackOutputSelector
+	add := func(sel shared.StackOutputSelector) {
+		if !seen[sel] {
+			seen[sel] = true
+			sels = append(sels, sel)
+		}
+	}
+	for _, dep := range spec.DependsOn {
+		for _, m := range []map[string]string{dep.Config, dep.SecretConfig, dep.Env} {
+			for _, output := range m {
+				add(shared.StackOutputSelector{Name: dep.Name, Output: output})
+			}
+		}
+	}
+	for _, refs := range []map[string]shared.ResourceRef{spec.ConfigRefs, spec.SecretRefs, spec.EnvRefs} {
+		for _, ref := range refs {
+			if ref.SelectorType == shared.ResourceSelectorStackOutput && ref.StackOutput != nil {
+				add(*ref.StackOutput)
+			}
+		}
+	}
+	// stacks in dependsOn come first, in the order given, as they always have in the revision
+	// worked out by readDependencyOutputs
+	rank := map[string]int{}
+	for i, dep := range spec.DependsOn {
+		if _, ok := rank[dep.Name]; !ok {
+			rank[dep.Name] = i
+		}
+	}
+	sort.Slice(sels, func(i, j int) bool {
+		a, b := sels[i], sels[j]
+		if a.Name == b.Name {
+			return a.Output < b.Output
+		}
+		ra, aRanked := rank[a.Name]
+		rb, bRanked := rank[b.Name]
+		if aRanked && bRanked {
+			return ra < rb
+		}
+		if aRanked != bRanked {
+			return aRanked
+		}
+		return a.Name < b.Name
+	})
+	return sels
+}
+
+// isDependedOn reports whether the stack named is given in dependsOn.
+func isDependedOn(spec *shared.StackSpec, name string) bool {
+	for _, dep := range spec.DependsOn {
+		if dep.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// expandDependsOn gives the spec with the entries of dependsOn put into effect as prerequisites
+// and StackOutput refs. The spec given isn't changed. A configuration key or environment variable
+// given by dependsOn and also otherwise is rejected, since it's not clear which is meant.
+func expandDependsOn(spec shared.StackSpec) (shared.StackSpec, error) {
+	if len(spec.DependsOn) == 0 {
+		return spec, nil
+	}
+	configRefs := copyRefs(spec.ConfigRefs)
+	secretRefs := copyRefs(spec.SecretRefs)
+	envRefs := copyRefs(spec.EnvRefs)
+	prereqs := append([]shared.PrerequisiteRef(nil), spec.Prerequisites...)
+
+	var problems []string
+	isConfigKey := func(key string) bool {
+		_, inConfig := spec.Config[key]
+		_, inValues := spec.ConfigValues[key]
+		_, inSecrets := spec.Secrets[key]
+		_, inConfigRefs := configRefs[key]
+		_, inSecretRefs := secretRefs[key]
+		return inConfig || inValues || inSecrets || inConfigRefs || inSecretRefs
+	}
+	for i, dep := range spec.DependsOn {
+		if dep.Name == "" {
+			problems = append(problems, fmt.Sprintf("dependsOn[%d]: missing name", i))
+			continue
+		}
+		isPrereq := false
+		for _, prereq := range prereqs {
+			isPrereq = isPrereq || prereq.Name == dep.Name
+		}
+		if !isPrereq {
+			prereqs = append(prereqs, shared.PrerequisiteRef{Name: dep.Name})
+		}
+		for _, mapping := range []struct {
+			field string
+			from  map[string]string
+			into  map[string]shared.ResourceRef
+			taken func(string) bool
+		}{
+			{"config", dep.Config, configRefs, isConfigKey},
+			{"secretConfig", dep.SecretConfig, secretRefs, isConfigKey},
+			{"env", dep.Env, envRefs, func(name string) bool { _, ok := envRefs[name]; return ok }},
+		} {
+			for key, output := range mapping.from {
+				if mapping.taken(key) {
+					problems = append(problems, fmt.Sprintf("dependsOn[%d].%s[%q]: already given elsewhere", i, mapping.field, key))
+					continue
+				}
+				mapping.into[key] = shared.NewStackOutputResourceRef(dep.Name, output)
+			}
+		}
+	}
+	if len(problems) > 0 {
+		sort.Strings(problems)
+		return spec, newStallErrorf("invalid dependsOn: %s", strings.Join(problems, "; "))
+	}
+	spec.Prerequisites = prereqs
+	spec.ConfigRefs, spec.SecretRefs, spec.EnvRefs = configRefs, secretRefs, envRefs
+	return spec, nil
+}
+
+func copyRefs(refs map[string]shared.ResourceRef) map[string]shared.ResourceRef {
+	out := make(map[string]shared.ResourceRef, len(refs))
+	for k, v := range refs {
+		out[k] = v
+	}
+	return out
+}
+
+// isDependencyReady checks that a stack given in dependsOn is Ready, so that its outputs aren't
+// used while it's being updated or after it's failed.
+func isDependencyReady(stack *pulumiv1.Stack) error {
+	if !apimeta.IsStatusConditionTrue(stack.Status.Conditions, pulumiv1.ReadyCondition) {
+		return errDependencyNotReady
+	}
+	return nil
+}
+
+// dependencyCycle looks for a cycle of dependencies, through prerequisites, dependsOn or
+// StackOutput refs, which includes the stack given, reading the other stacks in the namespace to
+// follow their dependencies. It gives the names of the stacks in the cycle, starting and ending
+// with this one, or nil if there's none. A stack which doesn't exist is taken to have no
+// dependencies.
+func dependencyCycle(ctx context.Context, c client.Reader, namespace, name string, spec *shared.StackSpec) ([]string, error) {
+	visited := map[string]bool{}
+	var visit func(current string, deps []string, path []string) ([]string, error)
+	visit = func(current string, deps []string, path []string) ([]string, error) {
+		path = append(path, current)
+		for _, dep := range deps {
+			if dep == name {
+				return append(path, dep), nil
+			}
+			if visited[dep] {
+				continue
+			}
+			visited[dep] = true
+			var other pulumiv1.Stack
+			if err := c.Get(ctx, types.NamespacedName{Namespace: namespace, Name: dep}, &other); err != nil {
+				if k8serrors.IsNotFound(err) {
+					continue
+				}
+				return nil, fmt.Errorf("reading Stack %s/%s depended on: %w", namespace, dep, err)
+			}
+			if cycle, err := visit(dep, dependencyNames(&other.Spec), path); cycle != nil || err != nil {
+				return cycle, err
+			}
+		}
+		return nil, nil
+	}
+	return visit(name, dependencyNames(spec), nil)
+}
+
+// readDependencyOutputs works out the revision of the outputs used from each stack depended on
+// through dependsOn or StackOutput refs, and adds it to the revision of the configuration, so
+// that a change to those outputs has the stack updated again. The revision is a digest of the
+// outputs, so it's safe to put in the status.
+func (sess *reconcileStackSession) readDependencyOutputs(ctx context.Context) error {
+	var versions []string
+	sels := stackOutputSelectors(&sess.stack)
+	for i := 0; i < len(sels); {
+		name := sels[i].Name
+		h := sha256.New()
+		for ; i < len(sels) && sels[i].Name == name; i++ {
+			value, err := sess.resolveStackOutputRef(ctx, &sels[i])
+			if err != nil {
+				return fmt.Errorf("resolving outputs of Stack %q: %w", name, err)
+			}
+			fmt.Fprintf(h, "%s=%s\n", sels[i].Output, value)
+		}
+		versions = append(versions, "stack/"+name+"@"+hex.EncodeToString(h.Sum(nil))[:12])
+	}
+	if len(versions) == 0 {
+		return nil
+	}
+	if sess.configFromRevision != "" {
+		versions = append([]string{sess.configFromRevision}, versions...)
+	}
+	sess.configFromRevision = strings.Join(versions, ",")
+	return nil
+}
@@ -0,0 +1,165 @@
+// Copyright 2024, Pulumi Corporation.  All rights reserved.
+
+package stack
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	"github.com/pulumi/pulumi-kubernetes-operator/pkg/apis/pulumi/shared"
+	pulumiv1 "github.com/pulumi/pulumi-kubernetes-operator/pkg/apis/pulumi/v1"
+	"github.com/pulumi/pulumi-kubernetes-operator/pkg/logging"
+)
+
+func TestExpandDependsOn(t *testing.T) {
+	spec := shared.StackSpec{
+		Prerequisites: []shared.PrerequisiteRef{{Name: "network"}},
+		ConfigRefs:    map[string]shared.ResourceRef{"app:region": shared.NewLiteralResourceRef("us-west-2")},
+		DependsOn: []shared.StackReference{{
+			Name:         "network",
+			Config:       map[string]string{"app:vpcId": "vpcId"},
+			SecretConfig: map[string]string{"app:dbPassword": "password"},
+		}, {
+			Name: "cluster",
+			Env:  map[string]string{"KUBECONFIG_DATA": "kubeconfig"},
+		}},
+	}
+	expanded, err := expandDependsOn(spec)
+	require.NoError(t, err)
+	assert.Equal(t, []shared.PrerequisiteRef{{Name: "network"}, {Name: "cluster"}}, expanded.Prerequisites)
+	assert.Equal(t, map[string]shared.ResourceRef{
+		"app:region": shared.NewLiteralResourceRef("us-west-2"),
+		"app:vpcId":  shared.NewStackOutputResourceRef("network", "vpcId"),
+	}, expanded.ConfigRefs)
+	assert.Equal(t, shared.NewStackOutputResourceRef("network", "password"), expanded.SecretRefs["app:dbPassword"])
+	assert.Equal(t, shared.NewStackOutputResourceRef("cluster", "kubeconfig"), expanded.EnvRefs["KUBECONFIG_DATA"])
+	assert.Len(t, spec.ConfigRefs, 1, "the spec given is left as it is")
+	assert.Len(t, spec.Prerequisites, 1)
+
+	spec.Config = map[string]string{"app:vpcId": "vpc-1234"}
+	spec.DependsOn = append(spec.DependsOn, shared.StackReference{})
+	_, err = expandDependsOn(spec)
+	assert.True(t, isStalledError(err))
+	assert.ErrorContains(t, err, `dependsOn[0].config["app:vpcId"]: already given elsewhere`)
+	assert.ErrorContains(t, err, `dependsOn[2]: missing name`)
+}
+
+func TestIsDependencyReady(t *testing.T) {
+	var stack pulumiv1.Stack
+	assert.ErrorIs(t, isDependencyReady(&stack), errDependencyNotReady)
+	stack.Status.MarkReadyCondition()
+	assert.NoError(t, isDependencyReady(&stack))
+	stack.Status.MarkReconcilingCondition(pulumiv1.ReconcilingProcessingReason, "updating")
+	assert.ErrorIs(t, isDependencyReady(&stack), errDependencyNotReady)
+}
+
+func TestDependencyCycle(t *testing.T) {
+	newStack := func(name string, spec shared.StackSpec) *pulumiv1.Stack {
+		return &pulumiv1.Stack{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace}, Spec: spec}
+	}
+	s := runtime.NewScheme()
+	require.NoError(t, scheme.AddToScheme(s))
+	require.NoError(t, pulumiv1.SchemeBuilder.AddToScheme(s))
+	c := fake.NewFakeClientWithScheme(s,
+		newStack("network", shared.StackSpec{}),
+		newStack("cluster", shared.StackSpec{DependsOn: []shared.StackReference{{Name: "network"}}}),
+		newStack("app", shared.StackSpec{Prerequisites: []shared.PrerequisiteRef{{Name: "cluster"}}}),
+		newStack("dns", shared.StackSpec{ConfigRefs: map[string]shared.ResourceRef{
+			"dns:ingress": shared.NewStackOutputResourceRef("app", "ingressAddress"),
+		}}),
+	)
+
+	cycle, err := dependencyCycle(context.TODO(), c, namespace, "app",
+		&shared.StackSpec{DependsOn: []shared.StackReference{{Name: "cluster"}, {Name: "absent"}}})
+	require.NoError(t, err)
+	assert.Nil(t, cycle)
+
+	// network, made to depend on app, closes a cycle
+	cycle, err = dependencyCycle(context.TODO(), c, namespace, "network",
+		&shared.StackSpec{DependsOn: []shared.StackReference{{Name: "app"}}})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"network", "app", "cluster", "network"}, cycle)
+
+	// as does network, made to use an output of dns
+	cycle, err = dependencyCycle(context.TODO(), c, namespace, "network",
+		&shared.StackSpec{EnvRefs: map[string]shared.ResourceRef{
+			"ZONE_ID": shared.NewStackOutputResourceRef("dns", "zoneId"),
+		}})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"network", "dns", "app", "cluster", "network"}, cycle)
+
+	cycle, err = dependencyCycle(context.TODO(), c, namespace, "self",
+		&shared.StackSpec{DependsOn: []shared.StackReference{{Name: "self"}}})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"self", "self"}, cycle)
+}
+
+func TestReadDependencyOutputs(t *testing.T) {
+	logger := logging.NewLogger(t.Name(), "Request.Test", "TestReadDependencyOutputs")
+	network := &pulumiv1.Stack{
+		ObjectMeta: metav1.ObjectMeta{Name: "network", Namespace: namespace},
+		Status: pulumiv1.StackStatus{Outputs: shared.StackOutputs{
+			"vpcId": apiextensionsv1.JSON{Raw: []byte(`"vpc-1"`)},
+		}},
+	}
+	s := runtime.NewScheme()
+	require.NoError(t, scheme.AddToScheme(s))
+	require.NoError(t, pulumiv1.SchemeBuilder.AddToScheme(s))
+	c := fake.NewFakeClientWithScheme(s, network)
+
+	spec := shared.StackSpec{DependsOn: []shared.StackReference{
+		{Name: "network", Config: map[string]string{"app:vpcId": "vpcId"}},
+		{Name: "ordering-only"},
+	}}
+	revision := func() string {
+		sess := newReconcileStackSession(logger, spec, c, namespace)
+		sess.configFromRevision = "settings@12"
+		require.NoError(t, sess.readDependencyOutputs(context.TODO()))
+		return sess.configFromRevision
+	}
+	before := revision()
+	assert.Regexp(t, `^settings@12,stack/network@[0-9a-f]{12}$`, before)
+	assert.Equal(t, before, revision())
+
+	network.Status.Outputs["vpcId"] = apiextensionsv1.JSON{Raw: []byte(`"vpc-2"`)}
+	require.NoError(t, c.Update(context.TODO(), network))
+	assert.NotEqual(t, before, revision(), "a change to an output used changes the revision")
+
+	// an output used through a StackOutput ref given directly counts the same
+	direct := revision()
+	spec = shared.StackSpec{SecretRefs: map[string]shared.ResourceRef{
+		"app:vpcId": shared.NewStackOutputResourceRef("network", "vpcId"),
+	}}
+	assert.Equal(t, direct, revision())
+
+	// a stack which doesn't exist, or hasn't produced outputs, is waited for
+	spec.ConfigRefs = map[string]shared.ResourceRef{"app:dbHost": shared.NewStackOutputResourceRef("database", "host")}
+	sess := newReconcileStackSession(logger, spec, c, namespace)
+	err := sess.readDependencyOutputs(context.TODO())
+	assert.ErrorIs(t, err, errWaitingForDependency)
+	require.NoError(t, c.Create(context.TODO(), &pulumiv1.Stack{ObjectMeta: metav1.ObjectMeta{Name: "database", Namespace: namespace}}))
+	err = sess.readDependencyOutputs(context.TODO())
+	assert.ErrorIs(t, err, errWaitingForDependency)
+	assert.ErrorContains(t, err, "has no outputs yet")
+}
+
+func TestDependencyNames(t *testing.T) {
+	spec := &shared.StackSpec{
+		Prerequisites: []shared.PrerequisiteRef{{Name: "network"}},
+		DependsOn:     []shared.StackReference{{Name: "cluster"}, {Name: "network"}},
+		ConfigRefs: map[string]shared.ResourceRef{
+			"app:vpcId":  shared.NewStackOutputResourceRef("network", "vpcId"),
+			"app:region": shared.NewLiteralResourceRef("us-west-2"),
+		},
+		EnvRefs: map[string]shared.ResourceRef{"DB_HOST": shared.NewStackOutputResourceRef("database", "host")},
+	}
+	assert.Equal(t, []string{"network", "cluster", "database"}, dependencyNames(spec))
+}
@@ -0,0 +1,222 @@
+// Copyright 2024, Pulumi Corporation.  All rights reserved.
+
+package stack
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/prometheus/client_golang/prometheus"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+
+	"github.com/pulumi/pulumi-kubernetes-operator/pkg/apis/pulumi/shared"
+	pulumiv1 "github.com/pulumi/pulumi-kubernetes-operator/pkg/apis/pulumi/v1"
+)
+
+const (
+	// EnvDeprecationReportInterval is the name of the environment entry giving how often the use
+	// of deprecated fields is counted, as a duration, e.g., "10m". The default is one hour.
+	EnvDeprecationReportInterval = "DEPRECATION_REPORT_INTERVAL"
+	// EnvDeprecationReportConfigMap is the name of the environment entry giving a ConfigMap, as
+	// "<namespace>/<name>", in which to list the stacks using each deprecated field. No ConfigMap
+	// is maintained if it's not set.
+	EnvDeprecationReportConfigMap = "DEPRECATION_REPORT_CONFIGMAP"
+
+	defaultDeprecationReportInterval = time.Hour
+)
+
+// Deprecated fields of the stack spec, named as in the Stack resource; these are the values of the
+// "field" label of the stacks_deprecated_fields metric, and the keys of the report ConfigMap.
+const (
+	deprecatedFieldAccessTokenSecret = "accessTokenSecret"
+	deprecatedFieldEnvs              = "envs"
+	deprecatedFieldSecretEnvs        = "envSecrets"
+	deprecatedFieldSecrets           = "secrets"
+)
+
+var deprecatedFields = []string{
+	deprecatedFieldAccessTokenSecret,
+	deprecatedFieldEnvs,
+	deprecatedFieldSecretEnvs,
+	deprecatedFieldSecrets,
+}
+
+// deprecatedFieldsUsed gives the deprecated fields the stack spec uses, in the order of
+// deprecatedFields.
+func deprecatedFieldsUsed(spec *shared.StackSpec) []string {
+	var used []string
+	if spec.AccessTokenSecret != "" {
+		used = append(used, deprecatedFieldAccessTokenSecret)
+	}
+	if len(spec.Envs) > 0 {
+		used = append(used, deprecatedFieldEnvs)
+	}
+	if len(spec.SecretEnvs) > 0 {
+		used = append(used, deprecatedFieldSecretEnvs)
+	}
+	if len(spec.Secrets) > 0 {
+		used = append(used, deprecatedFieldSecrets)
+	}
+	return used
+}
+
+// deprecationUsage gives, for each deprecated field, the stacks using it, as "<namespace>/<name>"
+// and in order.
+type deprecationUsage map[string][]string
+
+func countDeprecationUsage(stacks []pulumiv1.Stack) deprecationUsage {
+	usage := deprecationUsage{}
+	for i := range stacks {
+		for _, field := range deprecatedFieldsUsed(&stacks[i].Spec) {
+			usage[field] = append(usage[field], stackReportName(&stacks[i]))
+		}
+	}
+	for _, names := range usage {
+		sort.Strings(names)
+	}
+	return usage
+}
+
+// byNamespace counts the stacks using each field in each namespace.
+func (u deprecationUsage) byNamespace() map[string]map[string]int {
+	counts := map[string]map[string]int{}
+	for field, names := range u {
+		for _, name := range names {
+			ns := name[:strings.IndexByte(name, '/')]
+			if counts[ns] == nil {
+				counts[ns] = map[string]int{}
+			}
+			counts[ns][field]++
+		}
+	}
+	return counts
+}
+
+// configMapData gives the contents of the report ConfigMap: for each deprecated field, the stacks
+// using it, one to a line.
+func (u deprecationUsage) configMapData() map[string]string {
+	data := map[string]string{}
+	for _, field := range deprecatedFields {
+		data[field] = strings.Join(u[field], "\n")
+	}
+	return data
+}
+
+// addDeprecationReporter runs the deprecation reporter.
+func addDeprecationReporter(mgr manager.Manager) error {
+	interval, err := durationFromEnv(EnvDeprecationReportInterval, defaultDeprecationReportInterval)
+	if err != nil {
+		return err
+	}
+	reporter := &deprecationReporter{
+		client: mgr.GetClient(),
+		// the ConfigMap may be outside the namespaces watched, so it's read directly rather than
+		// from the cache
+		reader:   mgr.GetAPIReader(),
+		logger:   mgr.GetLogger().WithName("deprecation-reporter"),
+		interval: interval,
+	}
+	if raw := os.Getenv(EnvDeprecationReportConfigMap); raw != "" {
+		parts := strings.Split(raw, "/")
+		if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			return fmt.Errorf("%s must be given as <namespace>/<name>, but got %q", EnvDeprecationReportConfigMap, raw)
+		}
+		reporter.configMap = &client.ObjectKey{Namespace: parts[0], Name: parts[1]}
+	}
+	return mgr.Add(reporter)
+}
+
+// deprecationReporter counts the stacks using deprecated fields every interval. The counts are
+// given in the stacks_deprecated_fields metric and logged, and the stacks using each field are
+// listed in a ConfigMap if one is configured. It runs only in the leader, like the controller.
+type deprecationReporter struct {
+	client    client.Client
+	reader    client.Reader
+	logger    logr.Logger
+	interval  time.Duration
+	configMap *client.ObjectKey
+}
+
+func (d *deprecationReporter) Start(ctx context.Context) error {
+	ticker := time.NewTicker(d.interval)
+	defer ticker.Stop()
+	for {
+		if err := d.report(ctx); err != nil {
+			d.logger.Error(err, "unable to report use of deprecated fields")
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+func (d *deprecationReporter) report(ctx context.Context) error {
+	var stacks pulumiv1.StackList
+	if err := d.client.List(ctx, &stacks); err != nil {
+		return fmt.Errorf("listing stacks: %w", err)
+	}
+	usage := countDeprecationUsage(stacks.Items)
+
+	// the gauges are reset each time, so that namespaces no longer using a field aren't left
+	// with a stale count
+	numStacksDeprecatedFields.Reset()
+	for ns, counts := range usage.byNamespace() {
+		for field, n := range counts {
+			numStacksDeprecatedFields.With(prometheus.Labels{"namespace": ns, "field": field}).Set(float64(n))
+		}
+	}
+
+	if len(usage) > 0 {
+		keysAndValues := []interface{}{}
+		for _, field := range deprecatedFields {
+			if names := usage[field]; len(names) > 0 {
+				keysAndValues = append(keysAndValues, field, len(names))
+			}
+		}
+		d.logger.Info("Stacks are using deprecated fields, which will be removed in a future release", keysAndValues...)
+	}
+
+	if d.configMap != nil {
+		return d.save(ctx, usage.configMapData())
+	}
+	return nil
+}
+
+// save creates or updates the report ConfigMap.
+func (d *deprecationReporter) save(ctx context.Context, data map[string]string) error {
+	var current corev1.ConfigMap
+	err := d.reader.Get(ctx, *d.configMap, &current)
+	switch {
+	case apierrors.IsNotFound(err):
+		cm := &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace: d.configMap.Namespace,
+				Name:      d.configMap.Name,
+				Labels:    map[string]string{stackReportManagedByLabel: stackReportManagedBy},
+			},
+			Data: data,
+		}
+		if err := d.client.Create(ctx, cm); err != nil {
+			return fmt.Errorf("creating deprecation report %s: %w", d.configMap, err)
+		}
+		return nil
+	case err != nil:
+		return fmt.Errorf("getting deprecation report %s: %w", d.configMap, err)
+	}
+	current.Data = data
+	if err := d.client.Update(ctx, &current); err != nil {
+		return fmt.Errorf("updating deprecation report %s: %w", d.configMap, err)
+	}
+	return nil
+}
@@ -0,0 +1,64 @@
+// Copyright 2024, Pulumi Corporation.  All rights reserved.
+
+package stack
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/pulumi/pulumi-kubernetes-operator/pkg/apis/pulumi/shared"
+	pulumiv1 "github.com/pulumi/pulumi-kubernetes-operator/pkg/apis/pulumi/v1"
+)
+
+func TestDeprecationUsage(t *testing.T) {
+	stack := func(namespace, name string, spec shared.StackSpec) pulumiv1.Stack {
+		return pulumiv1.Stack{ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: name}, Spec: spec}
+	}
+	stacks := []pulumiv1.Stack{
+		stack("team-b", "web", shared.StackSpec{
+			AccessTokenSecret: "pulumi-token",
+			Secrets:           map[string]string{"app:password": "hunter2"},
+		}),
+		stack("team-a", "web", shared.StackSpec{AccessTokenSecret: "pulumi-token"}),
+		stack("team-a", "db", shared.StackSpec{
+			Envs:       []string{"db-env"},
+			SecretEnvs: []string{"db-secrets"},
+		}),
+		stack("team-a", "current", shared.StackSpec{
+			EnvRefs: map[string]shared.ResourceRef{"PULUMI_ACCESS_TOKEN": shared.NewSecretResourceRef("team-a", "pulumi-token", "token")},
+		}),
+	}
+
+	assert.Equal(t, []string{deprecatedFieldEnvs, deprecatedFieldSecretEnvs}, deprecatedFieldsUsed(&stacks[2].Spec))
+	assert.Empty(t, deprecatedFieldsUsed(&stacks[3].Spec))
+
+	usage := countDeprecationUsage(stacks)
+	assert.Equal(t, deprecationUsage{
+		deprecatedFieldAccessTokenSecret: {"team-a/web", "team-b/web"},
+		deprecatedFieldEnvs:              {"team-a/db"},
+		deprecatedFieldSecretEnvs:        {"team-a/db"},
+		deprecatedFieldSecrets:           {"team-b/web"},
+	}, usage)
+
+	assert.Equal(t, map[string]map[string]int{
+		"team-a": {deprecatedFieldAccessTokenSecret: 1, deprecatedFieldEnvs: 1, deprecatedFieldSecretEnvs: 1},
+		"team-b": {deprecatedFieldAccessTokenSecret: 1, deprecatedFieldSecrets: 1},
+	}, usage.byNamespace())
+
+	assert.Equal(t, map[string]string{
+		deprecatedFieldAccessTokenSecret: "team-a/web\nteam-b/web",
+		deprecatedFieldEnvs:              "team-a/db",
+		deprecatedFieldSecretEnvs:        "team-a/db",
+		deprecatedFieldSecrets:           "team-b/web",
+	}, usage.configMapData())
+
+	// every field is listed in the ConfigMap, so that a field no longer used is seen to be so
+	assert.Equal(t, map[string]string{
+		deprecatedFieldAccessTokenSecret: "",
+		deprecatedFieldEnvs:              "",
+		deprecatedFieldSecretEnvs:        "",
+		deprecatedFieldSecrets:           "",
+	}, countDeprecationUsage(stacks[3:]).configMapData())
+}
@@ -0,0 +1,268 @@
+// Copyright 2024, Pulumi Corporation.  All rights reserved.
+
+package stack
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"os/exec"
+	"sort"
+	"strings"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/pulumi/pulumi-kubernetes-operator/pkg/apis/pulumi/shared"
+	pulumiv1 "github.com/pulumi/pulumi-kubernetes-operator/pkg/apis/pulumi/v1"
+)
+
+// A stack with .spec.destroyOptions.approvalRequired is only destroyed once a preview of the
+// destroy has been approved. The preview is run when the stack is first seen to be deleted, and
+// recorded in .status.destroyProgress.approval with an ID; annotating the stack with that ID
+// approves it. The approval must arrive within the validity window of the preview, so that what's
+// approved is close to what will be destroyed; an approval arriving later is rejected, and a fresh
+// preview is run to be approved instead. The time of the approval, and who gave it, are taken from
+// the managed fields of the stack when they're there.
+
+// defaultDestroyApprovalValidity is how long a preview of a destroy can be approved for, if
+// destroyOptions.approvalValidity isn't given.
+const defaultDestroyApprovalValidity = time.Hour
+
+// destroyApprovalRecheck is the longest the stack is left before checking again for an approval.
+// Adding the annotation doesn't by itself queue the stack (see the predicates in add()), so this
+// is how soon an approval is acted on.
+const destroyApprovalRecheck = time.Minute
+
+// destroyApproval is the approval annotation found on a stack.
+type destroyApproval struct {
+	// ID is the value of the annotation.
+	ID string
+	// Time is when the annotation was set, if known.
+	Time time.Time
+	// Manager is the field manager which set the annotation, if known.
+	Manager string
+}
+
+// destroyApprovalGiven reads the approval annotation from the stack, if there is one, along with
+// when and by which field manager it was last set.
+func destroyApprovalGiven(instance *pulumiv1.Stack) (destroyApproval, bool) {
+	id, ok := instance.GetAnnotations()[shared.DestroyApprovalAnnotation]
+	if !ok {
+		return destroyApproval{}, false
+	}
+	given := destroyApproval{ID: id}
+	field := fmt.Sprintf("%q", "f:"+shared.DestroyApprovalAnnotation)
+	for _, entry := range instance.GetManagedFields() {
+		if entry.FieldsV1 == nil || entry.Time == nil || !strings.Contains(string(entry.FieldsV1.Raw), field) {
+			continue
+		}
+		if given.Time.IsZero() || entry.Time.Time.After(given.Time) {
+			given.Time = entry.Time.Time
+			given.Manager = entry.Manager
+		}
+	}
+	return given, true
+}
+
+// destroyApprovalDecision is the outcome of checking for an approval of the destroy.
+type destroyApprovalDecision int
+
+const (
+	// destroyApprovalNeedsPreview means there's no preview to approve, or it's expired, so a
+	// fresh one must be run.
+	destroyApprovalNeedsPreview destroyApprovalDecision = iota
+	// destroyApprovalPending means the preview is awaiting approval.
+	destroyApprovalPending
+	// destroyApprovalRejected means the preview was approved too late, so a fresh one must be run.
+	destroyApprovalRejected
+	// destroyApprovalAccepted means the preview has been approved.
+	destroyApprovalAccepted
+)
+
+// checkDestroyApproval decides, at the time given, whether the preview recorded has been approved.
+// An approval of unknown time is taken to have arrived when it's seen.
+func checkDestroyApproval(approval *pulumiv1.StackDestroyApproval, given *destroyApproval, now time.Time) destroyApprovalDecision {
+	switch {
+	case approval == nil:
+		return destroyApprovalNeedsPreview
+	case approval.ApprovedAt != nil:
+		return destroyApprovalAccepted
+	case given != nil && given.ID == approval.ID:
+		at := given.Time
+		if at.IsZero() {
+			at = now
+		}
+		if at.After(approval.ExpiryTime.Time) {
+			return destroyApprovalRejected
+		}
+		return destroyApprovalAccepted
+	case now.After(approval.ExpiryTime.Time):
+		return destroyApprovalNeedsPreview
+	default:
+		return destroyApprovalPending
+	}
+}
+
+// destroyApprovalID identifies a preview of destroying the resources given, at the time given.
+func destroyApprovalID(stack string, previewTime time.Time, urns []string) string {
+	urns = append([]string(nil), urns...)
+	sort.Strings(urns)
+	h := sha256.New()
+	fmt.Fprintf(h, "%s\n%s\n", stack, previewTime.UTC().Format(time.RFC3339))
+	for _, urn := range urns {
+		fmt.Fprintln(h, urn)
+	}
+	return hex.EncodeToString(h.Sum(nil))[:12]
+}
+
+// awaitDestroyApproval checks whether the stack, which is being deleted, can be destroyed. If
+// approval isn't required, or has been given for the current preview, it returns true. Otherwise
+// it runs a preview if there isn't a current one, records it in the status, and gives how long to
+// wait before checking again.
+func (r *ReconcileStack) awaitDestroyApproval(ctx context.Context, sess *reconcileStackSession, instance *pulumiv1.Stack) (bool, time.Duration, error) {
+	opts := sess.stack.DestroyOptions
+	if opts == nil || !opts.ApprovalRequired {
+		return true, 0, nil
+	}
+	if instance.Status.DestroyProgress == nil {
+		instance.Status.DestroyProgress = &pulumiv1.StackDestroyProgress{}
+	}
+	progress := instance.Status.DestroyProgress
+	now := time.Now()
+
+	var given *destroyApproval
+	if g, ok := destroyApprovalGiven(instance); ok {
+		given = &g
+	}
+	switch checkDestroyApproval(progress.Approval, given, now) {
+	case destroyApprovalAccepted:
+		if progress.Approval.ApprovedAt == nil {
+			at := metav1.NewTime(now)
+			if !given.Time.IsZero() {
+				at = metav1.NewTime(given.Time)
+			}
+			progress.Approval.ApprovedAt, progress.Approval.ApprovedBy = &at, given.Manager
+			progress.Approval.Message = ""
+			sess.logger.Info("Destroy of stack approved", "Stack.Name", sess.stack.Stack,
+				"Approval.ID", progress.Approval.ID, "Approval.By", given.Manager)
+			if err := sess.patchStatus(ctx, instance); err != nil {
+				return false, 0, err
+			}
+		}
+		return true, 0, nil
+	case destroyApprovalPending:
+		return false, minDuration(destroyApprovalRecheck, progress.Approval.ExpiryTime.Sub(now)), nil
+	}
+
+	message := ""
+	if progress.Approval != nil && given != nil && given.ID == progress.Approval.ID {
+		message = fmt.Sprintf("approval of preview %s arrived after it expired at %s; approve the new preview instead",
+			progress.Approval.ID, progress.Approval.ExpiryTime.UTC().Format(time.RFC3339))
+		sess.logger.Info("WARNING: rejected late approval of destroy", "Stack.Name", sess.stack.Stack,
+			"Approval.ID", progress.Approval.ID)
+	}
+	validity := defaultDestroyApprovalValidity
+	if opts.ApprovalValidity != nil && opts.ApprovalValidity.Duration > 0 {
+		validity = opts.ApprovalValidity.Duration
+	}
+	approval, err := sess.previewDestroy(ctx, now, validity)
+	if err != nil {
+		return false, 0, err
+	}
+	approval.Message = message
+	progress.Approval = approval
+	r.emitEvent(instance, pulumiv1.StackDestroyApprovalNeededEvent(),
+		"Destroying the stack needs approval (%s); annotate the stack with %s=%s by %s to approve it.",
+		approval.Summary, shared.DestroyApprovalAnnotation, approval.ID, approval.ExpiryTime.UTC().Format(time.RFC3339))
+	if err := sess.patchStatus(ctx, instance); err != nil {
+		return false, 0, err
+	}
+	return false, minDuration(destroyApprovalRecheck, validity), nil
+}
+
+// previewDestroy runs a preview of destroying the stack, with the destroy credentials, and gives
+// the record of it to be approved.
+func (sess *reconcileStackSession) previewDestroy(ctx context.Context, now time.Time, validity time.Duration) (*pulumiv1.StackDestroyApproval, error) {
+	if err := sess.setDestroyCredentials(ctx); err != nil {
+		return nil, err
+	}
+	resources, err := sess.stateResources(ctx)
+	if err != nil {
+		return nil, err
+	}
+	w := sess.autoStack.Workspace()
+	args := []string{"destroy", "--preview-only", "--stack", sess.stack.Stack, "--non-interactive"}
+	cmd := exec.CommandContext(ctx, "pulumi", args...)
+	if home := w.PulumiHome(); home != "" {
+		cmd.Env = append(os.Environ(), "PULUMI_HOME="+home)
+	}
+	if _, stderr, err := sess.runCmd("Pulumi Destroy Preview", cmd, w); err != nil {
+		return nil, &commandError{kind: "destroy preview", command: "pulumi " + strings.Join(args, " "), err: err, stderr: stderr}
+	}
+
+	urns := make([]string, len(resources))
+	for i := range resources {
+		urns[i] = resources[i].URN
+	}
+	previewTime := metav1.NewTime(now.Truncate(time.Second))
+	return &pulumiv1.StackDestroyApproval{
+		ID:          destroyApprovalID(sess.stack.Stack, previewTime.Time, urns),
+		PreviewTime: previewTime,
+		ExpiryTime:  metav1.NewTime(previewTime.Add(validity)),
+		Summary:     fmt.Sprintf("%d resources to delete", len(resources)),
+	}, nil
+}
+
+// setDestroyCredentials sets the environment variables given in destroyOptions.credentials on the
+// workspace, overriding any set from envRefs.
+func (sess *reconcileStackSession) setDestroyCredentials(ctx context.Context) error {
+	opts := sess.stack.DestroyOptions
+	if opts == nil {
+		return nil
+	}
+	w := sess.autoStack.Workspace()
+	for name, ref := range opts.Credentials {
+		val, err := sess.resolveResourceRef(ctx, &ref)
+		if err != nil {
+			return fmt.Errorf("resolving destroy credential %q: %w", name, err)
+		}
+		w.SetEnvVar(name, val)
+	}
+	return nil
+}
+
+// elevatedDestroyAudit gives the message for the event recorded when the stack is destroyed with
+// destroy credentials or an approval, or false if neither is used.
+func elevatedDestroyAudit(opts *shared.DestroyOptions, approval *pulumiv1.StackDestroyApproval) (string, bool) {
+	if opts == nil || (len(opts.Credentials) == 0 && !opts.ApprovalRequired) {
+		return "", false
+	}
+	var parts []string
+	if len(opts.Credentials) > 0 {
+		names := make([]string, 0, len(opts.Credentials))
+		for name := range opts.Credentials {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		parts = append(parts, "with destroy credentials "+strings.Join(names, ", "))
+	}
+	if opts.ApprovalRequired && approval != nil && approval.ApprovedAt != nil {
+		by := approval.ApprovedBy
+		if by == "" {
+			by = "unknown"
+		}
+		parts = append(parts, fmt.Sprintf("approved by %s at %s (preview %s)",
+			by, approval.ApprovedAt.UTC().Format(time.RFC3339), approval.ID))
+	}
+	return "Destroying stack " + strings.Join(parts, "; "), true
+}
+
+func minDuration(a, b time.Duration) time.Duration {
+	if b < a {
+		return b
+	}
+	return a
+}
@@ -0,0 +1,103 @@
+// Copyright 2024, Pulumi Corporation.  All rights reserved.
+
+package stack
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/pulumi/pulumi-kubernetes-operator/pkg/apis/pulumi/shared"
+	pulumiv1 "github.com/pulumi/pulumi-kubernetes-operator/pkg/apis/pulumi/v1"
+)
+
+func TestDestroyApprovalGiven(t *testing.T) {
+	earlier := metav1.NewTime(time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC))
+	later := metav1.NewTime(earlier.Add(time.Minute))
+	annotated := `{"f:metadata":{"f:annotations":{"f:pulumi.com/approve-destroy":{}}}}`
+
+	var stack pulumiv1.Stack
+	_, ok := destroyApprovalGiven(&stack)
+	assert.False(t, ok)
+
+	stack.Annotations = map[string]string{shared.DestroyApprovalAnnotation: "abc123"}
+	given, ok := destroyApprovalGiven(&stack)
+	assert.True(t, ok)
+	assert.Equal(t, destroyApproval{ID: "abc123"}, given, "the time and manager aren't known without managed fields")
+
+	stack.ManagedFields = []metav1.ManagedFieldsEntry{
+		{Manager: "kubectl-annotate", Time: &earlier, FieldsV1: &metav1.FieldsV1{Raw: []byte(annotated)}},
+		{Manager: "pulumi-kubernetes-operator", Time: &later, FieldsV1: &metav1.FieldsV1{Raw: []byte(`{"f:status":{}}`)}},
+	}
+	given, _ = destroyApprovalGiven(&stack)
+	assert.Equal(t, destroyApproval{ID: "abc123", Time: earlier.Time, Manager: "kubectl-annotate"}, given)
+
+	stack.ManagedFields = append(stack.ManagedFields,
+		metav1.ManagedFieldsEntry{Manager: "approver", Time: &later, FieldsV1: &metav1.FieldsV1{Raw: []byte(annotated)}})
+	given, _ = destroyApprovalGiven(&stack)
+	assert.Equal(t, destroyApproval{ID: "abc123", Time: later.Time, Manager: "approver"}, given, "the latest to set the annotation is taken")
+}
+
+func TestCheckDestroyApproval(t *testing.T) {
+	preview := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	expiry := preview.Add(time.Hour)
+	pending := &pulumiv1.StackDestroyApproval{ID: "abc123", PreviewTime: metav1.NewTime(preview), ExpiryTime: metav1.NewTime(expiry)}
+	approvedAt := metav1.NewTime(preview.Add(time.Minute))
+	approved := pending.DeepCopy()
+	approved.ApprovedAt = &approvedAt
+
+	tests := []struct {
+		name     string
+		approval *pulumiv1.StackDestroyApproval
+		given    *destroyApproval
+		now      time.Time
+		want     destroyApprovalDecision
+	}{
+		{name: "no preview", now: preview, want: destroyApprovalNeedsPreview},
+		{name: "awaiting approval", approval: pending, now: preview.Add(time.Minute), want: destroyApprovalPending},
+		{name: "other preview approved", approval: pending, given: &destroyApproval{ID: "old"}, now: preview.Add(time.Minute), want: destroyApprovalPending},
+		{name: "expired", approval: pending, now: expiry.Add(time.Second), want: destroyApprovalNeedsPreview},
+		{name: "approved in time", approval: pending, given: &destroyApproval{ID: "abc123", Time: expiry.Add(-time.Second)}, now: expiry.Add(time.Minute), want: destroyApprovalAccepted},
+		{name: "approved late", approval: pending, given: &destroyApproval{ID: "abc123", Time: expiry.Add(time.Second)}, now: expiry.Add(time.Minute), want: destroyApprovalRejected},
+		{name: "approved at unknown time, seen in time", approval: pending, given: &destroyApproval{ID: "abc123"}, now: expiry.Add(-time.Second), want: destroyApprovalAccepted},
+		{name: "approved at unknown time, seen late", approval: pending, given: &destroyApproval{ID: "abc123"}, now: expiry.Add(time.Second), want: destroyApprovalRejected},
+		{name: "already approved", approval: approved, now: expiry.Add(time.Hour), want: destroyApprovalAccepted},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, checkDestroyApproval(tt.approval, tt.given, tt.now))
+		})
+	}
+}
+
+func TestDestroyApprovalID(t *testing.T) {
+	preview := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	urns := []string{"urn:pulumi:dev::p::a", "urn:pulumi:dev::p::b"}
+	id := destroyApprovalID("dev", preview, urns)
+	assert.Len(t, id, 12)
+	assert.Equal(t, id, destroyApprovalID("dev", preview, []string{urns[1], urns[0]}), "the order of resources doesn't matter")
+	assert.NotEqual(t, id, destroyApprovalID("dev", preview.Add(time.Second), urns), "a fresh preview has a new ID")
+	assert.NotEqual(t, id, destroyApprovalID("dev", preview, urns[:1]))
+}
+
+func TestElevatedDestroyAudit(t *testing.T) {
+	_, ok := elevatedDestroyAudit(nil, nil)
+	assert.False(t, ok)
+	_, ok = elevatedDestroyAudit(&shared.DestroyOptions{BatchSize: 10}, nil)
+	assert.False(t, ok)
+
+	msg, ok := elevatedDestroyAudit(&shared.DestroyOptions{Credentials: map[string]shared.ResourceRef{
+		"AWS_SECRET_ACCESS_KEY": shared.NewSecretResourceRef("", "destroy-creds", "secret"),
+		"AWS_ACCESS_KEY_ID":     shared.NewSecretResourceRef("", "destroy-creds", "id"),
+	}}, nil)
+	assert.True(t, ok)
+	assert.Equal(t, "Destroying stack with destroy credentials AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY", msg)
+
+	at := metav1.NewTime(time.Date(2024, 5, 1, 10, 5, 0, 0, time.UTC))
+	msg, ok = elevatedDestroyAudit(&shared.DestroyOptions{ApprovalRequired: true},
+		&pulumiv1.StackDestroyApproval{ID: "abc123", ApprovedAt: &at})
+	assert.True(t, ok)
+	assert.Equal(t, "Destroying stack approved by unknown at 2024-05-01T10:05:00Z (preview abc123)", msg)
+}
@@ -0,0 +1,222 @@
+// Copyright 2024, Pulumi Corporation.  All rights reserved.
+
+package stack
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/pulumi/pulumi/sdk/v3/go/auto/optdestroy"
+	"github.com/pulumi/pulumi/sdk/v3/go/common/util/contract"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	pulumiv1 "github.com/pulumi/pulumi-kubernetes-operator/pkg/apis/pulumi/v1"
+)
+
+// stateResource is the part of a resource in the stack's state that's needed to work out the order
+// in which resources can be destroyed.
+type stateResource struct {
+	URN                  string              `json:"urn"`
+	ID                   string              `json:"id,omitempty"`
+	Type                 string              `json:"type"`
+	Parent               string              `json:"parent,omitempty"`
+	Dependencies         []string            `json:"dependencies,omitempty"`
+	PropertyDependencies map[string][]string `json:"propertyDependencies,omitempty"`
+	DeletedWith          string              `json:"deletedWith,omitempty"`
+}
+
+// parseStateResources reads the resources from an exported deployment.
+func parseStateResources(deployment json.RawMessage) ([]stateResource, error) {
+	var state struct {
+		Resources []stateResource `json:"resources"`
+	}
+	if len(deployment) == 0 {
+		return nil, nil
+	}
+	if err := json.Unmarshal(deployment, &state); err != nil {
+		return nil, err
+	}
+	return state.Resources, nil
+}
+
+// destroyedLast reports whether a resource is left for the full destroy after the batches, rather
+// than put in a batch. The stack resource is the parent of everything, and providers are used by
+// everything; neither can be targeted before all the resources that need them are gone.
+func destroyedLast(r stateResource) bool {
+	return r.Type == "pulumi:pulumi:Stack" || strings.HasPrefix(r.Type, "pulumi:providers:")
+}
+
+// destroyBatches divides the resources into batches of at most the size given, in an order in
+// which they can be destroyed: every resource comes after all the resources that depend on it,
+// whether through an explicit or property dependency, being a child of it, or being deleted with
+// it. Resources are ordered by URN within each level of the dependency graph, so the batches are
+// the same for the same state.
+func destroyBatches(resources []stateResource, size int) [][]string {
+	deps := map[string][]string{}
+	var urns []string
+	for _, r := range resources {
+		if destroyedLast(r) {
+			continue
+		}
+		if _, ok := deps[r.URN]; !ok {
+			urns = append(urns, r.URN)
+			deps[r.URN] = nil
+		}
+		deps[r.URN] = append(deps[r.URN], r.Dependencies...)
+		for _, ds := range r.PropertyDependencies {
+			deps[r.URN] = append(deps[r.URN], ds...)
+		}
+		if r.Parent != "" {
+			deps[r.URN] = append(deps[r.URN], r.Parent)
+		}
+		if r.DeletedWith != "" {
+			deps[r.URN] = append(deps[r.URN], r.DeletedWith)
+		}
+	}
+
+	// Count the dependents of each resource; those without any can be destroyed first.
+	dependents := map[string]int{}
+	for _, urn := range urns {
+		for _, d := range dedupe(deps[urn]) {
+			if _, ok := deps[d]; ok && d != urn {
+				dependents[d]++
+			}
+		}
+	}
+	var ready []string
+	for _, urn := range urns {
+		if dependents[urn] == 0 {
+			ready = append(ready, urn)
+		}
+	}
+
+	ordered := make([]string, 0, len(urns))
+	placed := map[string]bool{}
+	for len(ready) > 0 {
+		sort.Strings(ready)
+		var next []string
+		for _, urn := range ready {
+			ordered = append(ordered, urn)
+			placed[urn] = true
+			for _, d := range dedupe(deps[urn]) {
+				if _, ok := deps[d]; !ok || d == urn {
+					continue
+				}
+				if dependents[d]--; dependents[d] == 0 {
+					next = append(next, d)
+				}
+			}
+		}
+		ready = next
+	}
+	// A cycle shouldn't be possible, but if there is one, whatever's in it goes last and is left
+	// to the engine to sort out.
+	var rest []string
+	for _, urn := range urns {
+		if !placed[urn] {
+			rest = append(rest, urn)
+		}
+	}
+	sort.Strings(rest)
+	ordered = append(ordered, rest...)
+
+	var batches [][]string
+	for len(ordered) > 0 {
+		n := size
+		if n > len(ordered) {
+			n = len(ordered)
+		}
+		batches = append(batches, ordered[:n])
+		ordered = ordered[n:]
+	}
+	return batches
+}
+
+func dedupe(ss []string) []string {
+	seen := map[string]bool{}
+	out := ss[:0:0]
+	for _, s := range ss {
+		if !seen[s] {
+			seen[s] = true
+			out = append(out, s)
+		}
+	}
+	return out
+}
+
+// stateResources exports the stack's state, and returns the resources in it.
+func (sess *reconcileStackSession) stateResources(ctx context.Context) ([]stateResource, error) {
+	deployment, err := sess.autoStack.Export(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("exporting state of stack %q: %w", sess.stack.Stack, err)
+	}
+	resources, err := parseStateResources(deployment.Deployment)
+	if err != nil {
+		return nil, fmt.Errorf("reading state of stack %q: %w", sess.stack.Stack, err)
+	}
+	return resources, nil
+}
+
+// destroyInBatches destroys the resources of the stack in batches of the size given, taking the
+// first batch from what's left in the state each time. Since the state records what has been
+// destroyed, a destroy that was interrupted carries on from the last batch completed. Progress is
+// recorded in the status after each batch. The resources left for last (the stack itself and
+// providers) are not destroyed; that's done by the full destroy which follows.
+func (sess *reconcileStackSession) destroyInBatches(ctx context.Context, instance *pulumiv1.Stack, batchSize int) error {
+	progress := instance.Status.DestroyProgress
+	if progress == nil {
+		progress = &pulumiv1.StackDestroyProgress{}
+		instance.Status.DestroyProgress = progress
+	}
+
+	writer := sess.logger.LogWriterInfo("Pulumi Destroy")
+	defer contract.IgnoreClose(writer)
+
+	lastRemaining := -1
+	for {
+		resources, err := sess.stateResources(ctx)
+		if err != nil {
+			return err
+		}
+		remaining := len(resources)
+		if lastRemaining >= 0 && remaining >= lastRemaining {
+			// the last batch succeeded without removing anything; going round again would do the same
+			return fmt.Errorf("destroying batch %d of stack %q left %d resources in the state",
+				progress.BatchesCompleted, sess.stack.Stack, remaining)
+		}
+		lastRemaining = remaining
+
+		progress.ResourcesRemaining = int32(remaining)
+		if err := sess.patchStatus(ctx, instance); err != nil {
+			// the progress is only informational, so this doesn't stop the destroy
+			sess.logger.Error(err, "Failed to record destroy progress", "Stack.Name", sess.stack.Stack)
+		}
+
+		batches := destroyBatches(resources, batchSize)
+		if len(batches) == 0 {
+			return nil
+		}
+		sess.logger.Info("Destroying batch of resources", "Stack.Name", sess.stack.Stack,
+			"Batch", progress.BatchesCompleted+1, "Resources", len(batches[0]), "Batches.Remaining", len(batches))
+		opts := []optdestroy.Option{
+			optdestroy.Target(batches[0]),
+			optdestroy.TargetDependents(),
+			optdestroy.ProgressStreams(writer),
+			optdestroy.UserAgent(execAgent),
+		}
+		if sess.stack.Parallel > 0 {
+			opts = append(opts, optdestroy.Parallel(sess.stack.Parallel))
+		}
+		_, err = sess.autoStack.Destroy(ctx, opts...)
+		if err != nil {
+			return fmt.Errorf("destroying batch %d of resources for stack %q: %w",
+				progress.BatchesCompleted+1, sess.stack.Stack, err)
+		}
+		progress.BatchesCompleted++
+		now := metav1.Now()
+		progress.LastBatchTime = &now
+	}
+}
@@ -0,0 +1,80 @@
+// Copyright 2024, Pulumi Corporation.  All rights reserved.
+
+package stack
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseStateResources(t *testing.T) {
+	deployment := []byte(`{
+		"manifest": {"time": "2024-01-01T00:00:00Z"},
+		"resources": [
+			{"urn": "urn:pulumi:dev::proj::pulumi:pulumi:Stack::proj-dev", "type": "pulumi:pulumi:Stack"},
+			{"urn": "urn:pulumi:dev::proj::aws:s3/bucket:Bucket::b", "type": "aws:s3/bucket:Bucket",
+			 "parent": "urn:pulumi:dev::proj::pulumi:pulumi:Stack::proj-dev",
+			 "dependencies": ["urn:pulumi:dev::proj::aws:iam/role:Role::r"],
+			 "propertyDependencies": {"policy": ["urn:pulumi:dev::proj::aws:iam/policy:Policy::p"]}}
+		]
+	}`)
+	resources, err := parseStateResources(deployment)
+	require.NoError(t, err)
+	require.Len(t, resources, 2)
+	assert.Equal(t, "aws:s3/bucket:Bucket", resources[1].Type)
+	assert.Equal(t, "urn:pulumi:dev::proj::pulumi:pulumi:Stack::proj-dev", resources[1].Parent)
+	assert.Equal(t, []string{"urn:pulumi:dev::proj::aws:iam/role:Role::r"}, resources[1].Dependencies)
+	assert.Equal(t, []string{"urn:pulumi:dev::proj::aws:iam/policy:Policy::p"}, resources[1].PropertyDependencies["policy"])
+
+	// a stack that's never been updated has no deployment
+	resources, err = parseStateResources(nil)
+	require.NoError(t, err)
+	assert.Empty(t, resources)
+}
+
+func TestDestroyBatches(t *testing.T) {
+	resources := []stateResource{
+		{URN: "stack", Type: "pulumi:pulumi:Stack"},
+		{URN: "provider", Type: "pulumi:providers:aws", Parent: "stack"},
+		{URN: "vpc", Type: "aws:ec2/vpc:Vpc", Parent: "stack"},
+		{URN: "subnet", Type: "aws:ec2/subnet:Subnet", Parent: "stack", Dependencies: []string{"vpc"}},
+		{URN: "component", Type: "my:index:Component", Parent: "stack"},
+		{URN: "instance", Type: "aws:ec2/instance:Instance", Parent: "component",
+			PropertyDependencies: map[string][]string{"subnetId": {"subnet"}}},
+		{URN: "eip", Type: "aws:ec2/eip:Eip", Parent: "stack", DeletedWith: "instance"},
+	}
+
+	t.Run("leaves first", func(t *testing.T) {
+		batches := destroyBatches(resources, 1)
+		assert.Equal(t, [][]string{{"eip"}, {"instance"}, {"component"}, {"subnet"}, {"vpc"}}, batches)
+	})
+
+	t.Run("batched", func(t *testing.T) {
+		batches := destroyBatches(resources, 2)
+		assert.Equal(t, [][]string{{"eip", "instance"}, {"component", "subnet"}, {"vpc"}}, batches)
+	})
+
+	t.Run("independent resources are ordered by URN", func(t *testing.T) {
+		batches := destroyBatches([]stateResource{
+			{URN: "c", Type: "t:t:T"},
+			{URN: "a", Type: "t:t:T"},
+			{URN: "b", Type: "t:t:T"},
+		}, 2)
+		assert.Equal(t, [][]string{{"a", "b"}, {"c"}}, batches)
+	})
+
+	t.Run("only the stack and providers left", func(t *testing.T) {
+		assert.Empty(t, destroyBatches(resources[:2], 10))
+	})
+
+	t.Run("cycle", func(t *testing.T) {
+		batches := destroyBatches([]stateResource{
+			{URN: "a", Type: "t:t:T", Dependencies: []string{"b"}},
+			{URN: "b", Type: "t:t:T", Dependencies: []string{"a"}},
+			{URN: "c", Type: "t:t:T", Dependencies: []string{"a"}},
+		}, 10)
+		assert.Equal(t, [][]string{{"c", "a", "b"}}, batches)
+	})
+}
@@ -0,0 +1,48 @@
+// Copyright 2024, Pulumi Corporation.  All rights reserved.
+
+package stack
+
+import (
+	"context"
+
+	"github.com/pulumi/pulumi-kubernetes-operator/pkg/apis/pulumi/shared"
+	pulumiv1 "github.com/pulumi/pulumi-kubernetes-operator/pkg/apis/pulumi/v1"
+)
+
+// destroyGitSource returns the git source to use when destroying the stack. A destroy runs the
+// program, so a change to the program since the stack was last deployed (e.g., a commit to the
+// branch which doesn't compile) could stop the stack from being destroyed. To avoid that, the
+// commit last deployed successfully is used, unless .spec.destroyOptions.useCurrentSource is set.
+// Only a git repository can be pinned in this way; a local project directory or an archive is used
+// as it is.
+func destroyGitSource(instance *pulumiv1.Stack, source *shared.GitSource) *shared.GitSource {
+	if opts := instance.Spec.DestroyOptions; opts != nil && opts.UseCurrentSource {
+		return source
+	}
+	commit := lastSuccessfulCommit(instance)
+	if commit == "" || commit == source.Commit || source.ProjectRepo == "" || source.ProjectPath != "" || source.ProjectArchiveURL != "" {
+		return source
+	}
+	pinned := *source
+	pinned.Commit = commit
+	pinned.Branch = ""
+	pinned.Tag = ""
+	return &pinned
+}
+
+// recordDestroyRevision records in the status the revision of the source being used to destroy
+// the stack.
+func recordDestroyRevision(ctx context.Context, sess *reconcileStackSession, instance *pulumiv1.Stack, revision string) {
+	if instance.Status.DestroyProgress == nil {
+		instance.Status.DestroyProgress = &pulumiv1.StackDestroyProgress{}
+	}
+	if instance.Status.DestroyProgress.Revision == revision {
+		return
+	}
+	instance.Status.DestroyProgress.Revision = revision
+	sess.logger.Info("Destroying stack", "Stack.Name", sess.stack.Stack, "Revision", revision)
+	if err := sess.patchStatus(ctx, instance); err != nil {
+		// this is only informational, so it doesn't stop the destroy
+		sess.logger.Error(err, "Failed to record revision used to destroy stack", "Stack.Name", sess.stack.Stack)
+	}
+}
@@ -0,0 +1,44 @@
+// Copyright 2024, Pulumi Corporation.  All rights reserved.
+
+package stack
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/pulumi/pulumi-kubernetes-operator/pkg/apis/pulumi/shared"
+	pulumiv1 "github.com/pulumi/pulumi-kubernetes-operator/pkg/apis/pulumi/v1"
+)
+
+func TestDestroyGitSource(t *testing.T) {
+	const deployed = "0123456789abcdef0123456789abcdef01234567"
+	branch := &shared.GitSource{ProjectRepo: "https://github.com/example/infra", Branch: "main", RepoDir: "stacks/net"}
+	stack := func(source *shared.GitSource) *pulumiv1.Stack {
+		s := &pulumiv1.Stack{}
+		s.Spec.GitSource = source
+		s.Spec.DestroyOnFinalize = true
+		s.Status.LastUpdate = &shared.StackUpdateState{LastSuccessfulCommit: deployed}
+		return s
+	}
+
+	pinned := destroyGitSource(stack(branch), branch)
+	assert.Equal(t, &shared.GitSource{ProjectRepo: branch.ProjectRepo, Commit: deployed, RepoDir: "stacks/net"}, pinned)
+	assert.Equal(t, "main", branch.Branch, "the spec is left alone")
+
+	tag := &shared.GitSource{ProjectRepo: branch.ProjectRepo, Tag: "v1"}
+	assert.Equal(t, deployed, destroyGitSource(stack(tag), tag).Commit)
+
+	current := stack(branch)
+	current.Spec.DestroyOptions = &shared.DestroyOptions{UseCurrentSource: true}
+	assert.Same(t, branch, destroyGitSource(current, branch), "useCurrentSource")
+
+	never := stack(branch)
+	never.Status.LastUpdate = nil
+	assert.Same(t, branch, destroyGitSource(never, branch), "never deployed")
+
+	local := &shared.GitSource{ProjectPath: "infra"}
+	assert.Same(t, local, destroyGitSource(stack(local), local), "a local project can't be pinned")
+	archive := &shared.GitSource{ProjectArchiveURL: "https://example.com/infra.tar.gz"}
+	assert.Same(t, archive, destroyGitSource(stack(archive), archive), "an archive can't be pinned")
+}
@@ -0,0 +1,96 @@
+// Copyright 2024, Pulumi Corporation.  All rights reserved.
+
+package stack
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pulumi/pulumi-kubernetes-operator/pkg/apis/pulumi/shared"
+)
+
+// dotEnvFile is the name of the file written in the project directory for .spec.dotEnvRefs.
+const dotEnvFile = ".env"
+
+// dotEnvContents joins the contents given into those of a single dotenv file, in order. Each line
+// must be blank, a comment, or KEY=VALUE (optionally preceded by "export "); the lines at fault
+// are given by number rather than quoted, since the contents are likely to be secret.
+func dotEnvContents(parts []string) (string, error) {
+	var b strings.Builder
+	for i, part := range parts {
+		for n, line := range strings.Split(strings.TrimRight(part, "\r\n"), "\n") {
+			line = strings.TrimSpace(line)
+			if line == "" || strings.HasPrefix(line, "#") {
+				continue
+			}
+			key, _, ok := strings.Cut(strings.TrimPrefix(line, "export "), "=")
+			if !ok || strings.TrimSpace(key) == "" {
+				return "", fmt.Errorf("dotEnvRefs[%d]: line %d is not of the form KEY=VALUE", i, n+1)
+			}
+		}
+		b.WriteString(strings.TrimRight(part, "\r\n"))
+		b.WriteString("\n")
+	}
+	return b.String(), nil
+}
+
+// dotEnvValues gives the values set in the dotenv contents given, so that they can be redacted.
+func dotEnvValues(contents string) []string {
+	var values []string
+	for _, line := range strings.Split(contents, "\n") {
+		if _, value, ok := strings.Cut(line, "="); ok {
+			values = append(values, strings.Trim(strings.TrimSpace(value), `"'`))
+		}
+	}
+	return values
+}
+
+// writeDotEnv resolves the references given in dotEnvRefs, if any, and writes their contents to a
+// .env file in the project directory given. Any .env file already there (e.g., from the source) is
+// replaced, so that the file is created afresh with permissions allowing only the operator's user
+// to read it. The file is removed by removeDotEnv.
+func (sess *reconcileStackSession) writeDotEnv(ctx context.Context, dir string) error {
+	if len(sess.stack.DotEnvRefs) == 0 {
+		return nil
+	}
+	parts := make([]string, len(sess.stack.DotEnvRefs))
+	for i := range sess.stack.DotEnvRefs {
+		ref := &sess.stack.DotEnvRefs[i]
+		value, err := sess.resolveResourceRef(ctx, ref)
+		if err != nil {
+			return fmt.Errorf("resolving dotEnvRefs[%d]: %w", i, err)
+		}
+		if ref.SelectorType != shared.ResourceSelectorLiteral && ref.SelectorType != shared.ResourceSelectorConfigMap {
+			sess.secretValues = append(sess.secretValues, dotEnvValues(value)...)
+		}
+		parts[i] = value
+	}
+	contents, err := dotEnvContents(parts)
+	if err != nil {
+		return err
+	}
+	path := filepath.Join(dir, dotEnvFile)
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("replacing %s: %w", dotEnvFile, err)
+	}
+	sess.dotEnvPath = path
+	if err := os.WriteFile(path, []byte(contents), 0600); err != nil {
+		return fmt.Errorf("writing %s: %w", dotEnvFile, err)
+	}
+	return nil
+}
+
+// removeDotEnv removes the .env file written by writeDotEnv, if there is one, so that it isn't
+// left in a workspace kept for the next run.
+func (sess *reconcileStackSession) removeDotEnv() {
+	if sess.dotEnvPath == "" {
+		return
+	}
+	if err := os.Remove(sess.dotEnvPath); err != nil && !os.IsNotExist(err) {
+		sess.logger.Error(err, "Failed to remove .env file", "path", sess.dotEnvPath)
+	}
+	sess.dotEnvPath = ""
+}
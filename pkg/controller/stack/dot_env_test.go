@@ -0,0 +1,68 @@
+// Copyright 2024, Pulumi Corporation.  All rights reserved.
+
+package stack
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	"github.com/pulumi/pulumi-kubernetes-operator/pkg/apis/pulumi/shared"
+	"github.com/pulumi/pulumi-kubernetes-operator/pkg/logging"
+)
+
+func TestDotEnvContents(t *testing.T) {
+	contents, err := dotEnvContents([]string{"# settings\nREGION=us-west-2\n\n", "export TOKEN=\"abc123\""})
+	require.NoError(t, err)
+	assert.Equal(t, "# settings\nREGION=us-west-2\nexport TOKEN=\"abc123\"\n", contents)
+	assert.Equal(t, []string{"us-west-2", "abc123"}, dotEnvValues(contents))
+
+	_, err = dotEnvContents([]string{"REGION=us-west-2", "A=1\nhunter2"})
+	assert.EqualError(t, err, "dotEnvRefs[1]: line 2 is not of the form KEY=VALUE")
+}
+
+func TestWriteDotEnv(t *testing.T) {
+	logger := logging.NewLogger(t.Name(), "Request.Test", "TestWriteDotEnv")
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "dotenv", Namespace: namespace},
+		Data:       map[string][]byte{".env": []byte("API_KEY=s3cr3t-key\n")},
+	}
+	client := fake.NewFakeClientWithScheme(scheme.Scheme, secret)
+	dir := t.TempDir()
+	path := filepath.Join(dir, ".env")
+	require.NoError(t, os.WriteFile(path, []byte("FROM_SOURCE=1\n"), 0644))
+
+	sess := newReconcileStackSession(logger, shared.StackSpec{
+		DotEnvRefs: []shared.ResourceRef{
+			shared.NewLiteralResourceRef("REGION=us-west-2"),
+			shared.NewSecretResourceRef("", "dotenv", ".env"),
+		},
+	}, client, namespace)
+	require.NoError(t, sess.writeDotEnv(context.TODO(), dir))
+	b, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, "REGION=us-west-2\nAPI_KEY=s3cr3t-key\n", string(b), "the file from the source is replaced")
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+	assert.Contains(t, sess.secretValues, "s3cr3t-key")
+	assert.NotContains(t, sess.secretValues, "us-west-2")
+
+	sess.removeDotEnv()
+	assert.NoFileExists(t, path)
+
+	// nothing is written, or removed, without dotEnvRefs
+	require.NoError(t, os.WriteFile(path, []byte("FROM_SOURCE=1\n"), 0644))
+	sess = newReconcileStackSession(logger, shared.StackSpec{}, client, namespace)
+	require.NoError(t, sess.writeDotEnv(context.TODO(), dir))
+	sess.removeDotEnv()
+	assert.FileExists(t, path)
+}
@@ -0,0 +1,184 @@
+// Copyright 2024, Pulumi Corporation.  All rights reserved.
+
+package stack
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pulumi/pulumi/sdk/v3/go/auto"
+	"github.com/pulumi/pulumi/sdk/v3/go/auto/optrefresh"
+	"github.com/pulumi/pulumi/sdk/v3/go/common/util/contract"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	"github.com/pulumi/pulumi-kubernetes-operator/pkg/apis/pulumi/shared"
+	pulumiv1 "github.com/pulumi/pulumi-kubernetes-operator/pkg/apis/pulumi/v1"
+)
+
+const (
+	// defaultDriftCheckFrequency is how often a stack is checked for drift, if not given.
+	defaultDriftCheckFrequency = time.Hour
+	// minDriftCheckFrequency is the least interval between checks, as for resyncFrequencySeconds.
+	minDriftCheckFrequency = time.Minute
+)
+
+// driftCheckInterval gives how often the stack is to be checked for drift.
+func driftCheckInterval(spec *shared.StackSpec) time.Duration {
+	if spec.DriftCheckFrequencySeconds == 0 {
+		return defaultDriftCheckFrequency
+	}
+	if interval := time.Duration(spec.DriftCheckFrequencySeconds) * time.Second; interval > minDriftCheckFrequency {
+		return interval
+	}
+	return minDriftCheckFrequency
+}
+
+// driftCheckDue reports whether the stack is to be checked for drift at the time given, and if
+// not, how long until it is.
+func driftCheckDue(instance *pulumiv1.Stack, now time.Time) (bool, time.Duration) {
+	if !instance.Spec.DriftDetectionOnly || instance.Spec.ContinueResyncOnCommitMatch {
+		return false, 0
+	}
+	check := instance.Status.DriftCheck
+	if check == nil {
+		return true, 0
+	}
+	if wait := driftCheckInterval(&instance.Spec) - now.Sub(check.Time.Time); wait > 0 {
+		return false, wait
+	}
+	return true, 0
+}
+
+// detectDrift refreshes the stack, and reports what the refresh changed in its state.
+func (sess *reconcileStackSession) detectDrift(ctx context.Context, targets []string) (*pulumiv1.StackDriftCheckState, error) {
+	defer sess.timer.enter(phaseRefresh)()
+	writer := sess.logger.LogWriterDebug("Pulumi Refresh")
+	defer contract.IgnoreClose(writer)
+	opts := []optrefresh.Option{optrefresh.ProgressStreams(writer), optrefresh.UserAgent(execAgent)}
+	if targets != nil {
+		opts = append(opts, optrefresh.Target(targets))
+	}
+	if sess.stack.Parallel > 0 {
+		opts = append(opts, optrefresh.Parallel(sess.stack.Parallel))
+	}
+
+	result, err := sess.autoStack.Refresh(ctx, opts...)
+	sess.recordRefresh(result, err)
+	if err != nil {
+		return nil, fmt.Errorf("refreshing stack %q: %w", sess.stack.Stack, err)
+	}
+	check := &pulumiv1.StackDriftCheckState{
+		Time:            sess.lastRefresh.Time,
+		ResourceChanges: sess.lastRefresh.ResourceChanges,
+		Drifted:         sess.lastRefresh.ChangesDetected,
+		Permalink:       sess.lastRefresh.Permalink,
+	}
+	if check.Drifted {
+		check.Message = "the refresh found changes: " + describeResourceChanges(check.ResourceChanges)
+	} else {
+		check.Message = "the refresh found no changes"
+	}
+	return check, nil
+}
+
+// refreshResourceChanges gives the changes a refresh made to the stack's state, by operation.
+func refreshResourceChanges(result auto.RefreshResult) map[string]int {
+	var changes map[string]int
+	if result.Summary.ResourceChanges != nil {
+		for op, n := range *result.Summary.ResourceChanges {
+			if op != "same" && n > 0 {
+				if changes == nil {
+					changes = map[string]int{}
+				}
+				changes[op] = n
+			}
+		}
+	}
+	return changes
+}
+
+// recordRefresh records the outcome of a refresh, to be saved in .status.lastRefresh.
+func (sess *reconcileStackSession) recordRefresh(result auto.RefreshResult, err error) {
+	refresh := &pulumiv1.StackRefreshState{
+		State: shared.SucceededStackStateMessage,
+		Time:  metav1.Now(),
+	}
+	if err != nil {
+		refresh.State = shared.FailedStackStateMessage
+		refresh.Message = err.Error()
+	} else {
+		refresh.ResourceChanges = refreshResourceChanges(result)
+		refresh.ChangesDetected = len(refresh.ResourceChanges) > 0
+	}
+	if p, err := auto.GetPermalink(result.StdOut); err == nil {
+		refresh.Permalink = credentialFreePermalink(p)
+	}
+	sess.lastRefresh = refresh
+}
+
+// describeResourceChanges gives the changes counted, e.g., "delete=1 update=2".
+func describeResourceChanges(changes map[string]int) string {
+	ops := make([]string, 0, len(changes))
+	for op, n := range changes {
+		ops = append(ops, fmt.Sprintf("%s=%d", op, n))
+	}
+	sort.Strings(ops)
+	return strings.Join(ops, " ")
+}
+
+// recordDriftCheck records the outcome of a check for drift in the status; either what the check
+// found, or the error which stopped it.
+func recordDriftCheck(status *pulumiv1.StackStatus, check *pulumiv1.StackDriftCheckState, err error) {
+	status.DriftCheck = check
+	switch {
+	case err != nil:
+		check.Message = fmt.Sprintf("unable to check for drift: %v", err)
+		status.MarkDriftedCondition(metav1.ConditionUnknown, pulumiv1.DriftedCheckFailedReason, check.Message)
+	case check.Drifted:
+		status.MarkDriftedCondition(metav1.ConditionTrue, pulumiv1.DriftedDetectedReason, check.Message)
+	default:
+		status.MarkDriftedCondition(metav1.ConditionFalse, pulumiv1.DriftedNoneReason, check.Message)
+	}
+}
+
+// checkForDrift handles a stack, set to have drift detected rather than remediated, which is up to
+// date: if it's due to be checked for drift, the check is made and the outcome reported, and
+// either way, the stack is requeued for the next check, or sooner if its source is to be polled
+// sooner.
+func (r *ReconcileStack) checkForDrift(ctx context.Context, sess *reconcileStackSession, instance *pulumiv1.Stack, revision string, pollInterval time.Duration) reconcile.Result {
+	due, wait := driftCheckDue(instance, time.Now())
+	if due {
+		sess.logger.Info("Checking stack for drift", "Stack.Name", sess.stack.Stack, "Commit", revision)
+		check, err := sess.detectDrift(ctx, sess.stack.Targets)
+		if err != nil {
+			sess.logger.Error(err, "Failed to check stack for drift", "Stack.Name", sess.stack.Stack)
+			check = &pulumiv1.StackDriftCheckState{Time: metav1.Now()}
+		}
+		check.Revision = revision
+		recordDriftCheck(&instance.Status, check, err)
+		if check.Drifted {
+			r.emitEvent(instance, pulumiv1.StackDriftDetectedEvent(), "Drift detected: %s.", check.Message)
+		}
+		wait = driftCheckInterval(&instance.Spec)
+	}
+
+	if instance.Status.LastUpdate != nil {
+		instance.Status.LastUpdate.LastResyncTime = metav1.Now()
+	}
+	instance.Status.MarkReadyCondition()
+	if pollInterval > 0 && pollInterval < wait {
+		wait = pollInterval
+	}
+	return reconcile.Result{RequeueAfter: wait}
+}
+
+// isUnexpectedRefreshChanges reports whether a refresh run with expectNoRefreshChanges failed
+// because it found changes, rather than because it couldn't be run; the error from the automation
+// API includes what the CLI wrote to stderr.
+func isUnexpectedRefreshChanges(err error) bool {
+	return strings.Contains(err.Error(), "no changes were expected but changes occurred")
+}
@@ -0,0 +1,111 @@
+// Copyright 2024, Pulumi Corporation.  All rights reserved.
+
+package stack
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/pulumi/pulumi/sdk/v3/go/auto"
+	"github.com/stretchr/testify/assert"
+	apimeta "k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/pulumi/pulumi-kubernetes-operator/pkg/apis/pulumi/shared"
+	pulumiv1 "github.com/pulumi/pulumi-kubernetes-operator/pkg/apis/pulumi/v1"
+)
+
+func TestDriftCheckInterval(t *testing.T) {
+	assert.Equal(t, defaultDriftCheckFrequency, driftCheckInterval(&shared.StackSpec{}))
+	assert.Equal(t, 10*time.Minute, driftCheckInterval(&shared.StackSpec{DriftCheckFrequencySeconds: 600}))
+	assert.Equal(t, minDriftCheckFrequency, driftCheckInterval(&shared.StackSpec{DriftCheckFrequencySeconds: 5}))
+}
+
+func TestDriftCheckDue(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	stack := &pulumiv1.Stack{}
+	due, _ := driftCheckDue(stack, now)
+	assert.False(t, due, "not detecting drift")
+
+	stack.Spec.DriftDetectionOnly = true
+	due, _ = driftCheckDue(stack, now)
+	assert.True(t, due, "never checked")
+
+	stack.Status.DriftCheck = &pulumiv1.StackDriftCheckState{Time: metav1.NewTime(now.Add(-10 * time.Minute))}
+	due, wait := driftCheckDue(stack, now)
+	assert.False(t, due, "checked recently")
+	assert.Equal(t, defaultDriftCheckFrequency-10*time.Minute, wait)
+
+	due, _ = driftCheckDue(stack, now.Add(defaultDriftCheckFrequency))
+	assert.True(t, due, "checked too long ago")
+
+	stack.Spec.ContinueResyncOnCommitMatch = true
+	due, _ = driftCheckDue(stack, now.Add(defaultDriftCheckFrequency))
+	assert.False(t, due, "updated regardless")
+}
+
+func TestRecordDriftCheck(t *testing.T) {
+	drifted := func(status *pulumiv1.StackStatus) metav1.ConditionStatus {
+		c := apimeta.FindStatusCondition(status.Conditions, pulumiv1.DriftedCondition)
+		if c == nil {
+			return ""
+		}
+		return c.Status
+	}
+	var status pulumiv1.StackStatus
+
+	recordDriftCheck(&status, &pulumiv1.StackDriftCheckState{Message: "the refresh found no changes"}, nil)
+	assert.Equal(t, metav1.ConditionFalse, drifted(&status))
+
+	recordDriftCheck(&status, &pulumiv1.StackDriftCheckState{}, errors.New("no credentials"))
+	assert.Equal(t, metav1.ConditionUnknown, drifted(&status))
+	assert.Equal(t, "unable to check for drift: no credentials", status.DriftCheck.Message)
+
+	changes := map[string]int{"update": 2, "delete": 1}
+	recordDriftCheck(&status, &pulumiv1.StackDriftCheckState{Drifted: true, ResourceChanges: changes}, nil)
+	assert.Equal(t, metav1.ConditionTrue, drifted(&status))
+	assert.Equal(t, "delete=1 update=2", describeResourceChanges(changes))
+
+	// the refresh brought the state up to date, so later checks find nothing; the stack is still
+	// marked as drifted until it's updated
+	recordDriftCheck(&status, &pulumiv1.StackDriftCheckState{}, nil)
+	assert.Equal(t, metav1.ConditionTrue, drifted(&status))
+	recordDriftCheck(&status, &pulumiv1.StackDriftCheckState{}, errors.New("no credentials"))
+	assert.Equal(t, metav1.ConditionTrue, drifted(&status))
+	status.ClearDriftedCondition()
+	assert.Equal(t, metav1.ConditionStatus(""), drifted(&status))
+}
+
+func TestRecordRefresh(t *testing.T) {
+	sess := &reconcileStackSession{}
+	sess.recordRefresh(auto.RefreshResult{
+		Summary: auto.UpdateSummary{ResourceChanges: &map[string]int{"same": 4, "update": 1, "delete": 0}},
+	}, nil)
+	assert.Equal(t, shared.SucceededStackStateMessage, sess.lastRefresh.State)
+	assert.True(t, sess.lastRefresh.ChangesDetected)
+	assert.Equal(t, map[string]int{"update": 1}, sess.lastRefresh.ResourceChanges)
+	assert.False(t, sess.lastRefresh.Time.IsZero())
+
+	sess.recordRefresh(auto.RefreshResult{Summary: auto.UpdateSummary{ResourceChanges: &map[string]int{"same": 5}}}, nil)
+	assert.False(t, sess.lastRefresh.ChangesDetected)
+	assert.Empty(t, sess.lastRefresh.ResourceChanges)
+
+	sess.recordRefresh(auto.RefreshResult{}, errors.New("error: the credentials have expired"))
+	assert.Equal(t, shared.FailedStackStateMessage, sess.lastRefresh.State)
+	assert.Equal(t, "error: the credentials have expired", sess.lastRefresh.Message)
+	assert.False(t, sess.lastRefresh.ChangesDetected)
+}
+
+func TestIsUnexpectedRefreshChanges(t *testing.T) {
+	assert.True(t, isUnexpectedRefreshChanges(errors.New(`refreshing stack "dev": failed to refresh stack: exit status 255
+code: 255
+stdout: Refreshing (dev):
+stderr: error: no changes were expected but changes occurred.
+`)))
+	assert.False(t, isUnexpectedRefreshChanges(errors.New(`refreshing stack "dev": failed to refresh stack: exit status 255
+code: 255
+stdout:
+stderr: error: reading bucket "logs": AccessDenied
+`)))
+}
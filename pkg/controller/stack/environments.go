@@ -0,0 +1,85 @@
+// Copyright 2024, Pulumi Corporation.  All rights reserved.
+
+package stack
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	pulumiv1 "github.com/pulumi/pulumi-kubernetes-operator/pkg/apis/pulumi/v1"
+)
+
+// errEnvironmentNotFound marks the error when an environment given in .spec.environments can't be
+// found.
+var errEnvironmentNotFound = errors.New("environment not found")
+
+// environmentsPlan gives the environments to detach and to attach, in order, to bring the
+// environments attached to a stack in line with those wanted, and the environments to record as
+// attached by the operator. Only environments the operator attached (those recorded) are
+// detached, so that environments in the stack's settings as checked in are left alone; an
+// environment wanted which is already attached is left in its place.
+func environmentsPlan(wanted, recorded, attached []string) (detach, attach, record []string) {
+	for _, env := range recorded {
+		if !contains(wanted, env) && contains(attached, env) {
+			detach = append(detach, env)
+		}
+	}
+	for _, env := range wanted {
+		switch {
+		case contains(record, env):
+			// given twice
+		case !contains(attached, env):
+			attach = append(attach, env)
+			record = append(record, env)
+		case contains(recorded, env):
+			record = append(record, env)
+		}
+	}
+	return detach, attach, record
+}
+
+// syncEnvironments attaches the environments given in .spec.environments to the stack, and
+// detaches those the operator attached before which are no longer given. The environments
+// attached by the operator are recorded in sess.environments, for the status.
+func (sess *reconcileStackSession) syncEnvironments(ctx context.Context, recorded []string) error {
+	if len(sess.stack.Environments) == 0 && len(recorded) == 0 {
+		return nil
+	}
+	attached, err := sess.autoStack.ListEnvironments(ctx)
+	if err != nil {
+		return fmt.Errorf("listing the stack's environments: %w", err)
+	}
+	detach, attach, record := environmentsPlan(sess.stack.Environments, recorded, attached)
+	for _, env := range detach {
+		if err := sess.autoStack.RemoveEnvironment(ctx, env); err != nil {
+			return fmt.Errorf("detaching environment %q: %w", env, err)
+		}
+		sess.logger.Info("Detached environment", "Environment", env)
+	}
+	if len(attach) > 0 {
+		if err := sess.autoStack.AddEnvironments(ctx, attach...); err != nil {
+			if strings.Contains(strings.ToLower(err.Error()), "not found") {
+				return fmt.Errorf("%w: attaching environments %s: %v; check environments",
+					errEnvironmentNotFound, strings.Join(attach, ", "), err)
+			}
+			return fmt.Errorf("attaching environments %s: %w", strings.Join(attach, ", "), err)
+		}
+		sess.logger.Info("Attached environments", "Environments", attach)
+	}
+	sess.environments, sess.environmentsSynced = record, true
+	return nil
+}
+
+// environmentNotFound records that an environment given in .spec.environments can't be found, and
+// has the stack tried again after a long wait, as for a project that can't be found.
+func (r *ReconcileStack) environmentNotFound(sess *reconcileStackSession, instance *pulumiv1.Stack, err error) (reconcile.Result, error) {
+	r.emitEvent(instance, pulumiv1.StackInitializationFailureEvent(), "Failed to initialize stack: %v", err.Error())
+	r.markStackFailed(sess, instance, err, "", "")
+	instance.Status.LastUpdate.Reason = pulumiv1.ReconcilingEnvironmentNotFoundReason
+	instance.Status.MarkReconcilingCondition(pulumiv1.ReconcilingEnvironmentNotFoundReason, err.Error())
+	return reconcile.Result{RequeueAfter: projectNotFoundBackoff}, nil
+}
@@ -0,0 +1,89 @@
+// Copyright 2024, Pulumi Corporation.  All rights reserved.
+
+package stack
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	apimeta "k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+
+	"github.com/pulumi/pulumi-kubernetes-operator/pkg/apis/pulumi/shared"
+	pulumiv1 "github.com/pulumi/pulumi-kubernetes-operator/pkg/apis/pulumi/v1"
+	"github.com/pulumi/pulumi-kubernetes-operator/pkg/logging"
+)
+
+func TestEnvironmentsPlan(t *testing.T) {
+	for _, test := range []struct {
+		name                           string
+		wanted, recorded, attached     []string
+		expectedDetach, expectedAttach []string
+		expectedRecord                 []string
+	}{
+		{
+			name:           "first attached",
+			wanted:         []string{"org/aws-creds", "org/shared"},
+			attached:       []string{"org/checked-in"},
+			expectedAttach: []string{"org/aws-creds", "org/shared"},
+			expectedRecord: []string{"org/aws-creds", "org/shared"},
+		},
+		{
+			name:           "already attached by the operator",
+			wanted:         []string{"org/aws-creds", "org/shared"},
+			recorded:       []string{"org/aws-creds", "org/shared"},
+			attached:       []string{"org/checked-in", "org/aws-creds", "org/shared"},
+			expectedRecord: []string{"org/aws-creds", "org/shared"},
+		},
+		{
+			name:           "removed from the list",
+			wanted:         []string{"org/shared"},
+			recorded:       []string{"org/aws-creds", "org/shared"},
+			attached:       []string{"org/aws-creds", "org/shared"},
+			expectedDetach: []string{"org/aws-creds"},
+			expectedRecord: []string{"org/shared"},
+		},
+		{
+			name:     "removed, from a fresh workspace",
+			recorded: []string{"org/aws-creds"},
+			attached: []string{"org/checked-in"},
+		},
+		{
+			name:     "checked in, and given",
+			wanted:   []string{"org/checked-in", "org/checked-in"},
+			attached: []string{"org/checked-in"},
+		},
+		{
+			name:     "checked in, and given, and removed",
+			recorded: []string{"org/aws-creds"},
+			wanted:   []string{"org/checked-in"},
+			attached: []string{"org/checked-in"},
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			detach, attach, record := environmentsPlan(test.wanted, test.recorded, test.attached)
+			assert.Equal(t, test.expectedDetach, detach, "detached")
+			assert.Equal(t, test.expectedAttach, attach, "attached")
+			assert.Equal(t, test.expectedRecord, record, "recorded")
+		})
+	}
+}
+
+func TestEnvironmentNotFound(t *testing.T) {
+	logger := logging.NewLogger(t.Name(), "Request.Test", "TestEnvironmentNotFound")
+	r := &ReconcileStack{recorder: record.NewFakeRecorder(10)}
+	sess := newReconcileStackSession(logger, shared.StackSpec{}, nil, namespace)
+	instance := &pulumiv1.Stack{ObjectMeta: metav1.ObjectMeta{Name: "env", Namespace: namespace, Generation: 1}}
+
+	res, err := r.environmentNotFound(sess, instance, fmt.Errorf("%w: attaching environments prod", errEnvironmentNotFound))
+	require.NoError(t, err)
+	assert.Equal(t, projectNotFoundBackoff, res.RequeueAfter, "retried after a long wait")
+	reconciling := apimeta.FindStatusCondition(instance.Status.Conditions, pulumiv1.ReconcilingCondition)
+	require.NotNil(t, reconciling)
+	assert.Equal(t, pulumiv1.ReconcilingEnvironmentNotFoundReason, reconciling.Reason)
+	assert.Nil(t, apimeta.FindStatusCondition(instance.Status.Conditions, pulumiv1.StalledCondition), "not stalled, since it's retried")
+	assert.Equal(t, pulumiv1.ReconcilingEnvironmentNotFoundReason, instance.Status.LastUpdate.Reason)
+}
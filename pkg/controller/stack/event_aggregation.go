@@ -0,0 +1,238 @@
+// Copyright 2024, Pulumi Corporation.  All rights reserved.
+
+package stack
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/operator-framework/operator-sdk/pkg/k8sutil"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+
+	pulumiv1 "github.com/pulumi/pulumi-kubernetes-operator/pkg/apis/pulumi/v1"
+)
+
+// When a git server or backend that many stacks use is down, each of the stacks emits its own
+// warning, and the events pile up. To avoid that, warnings that come from a dependency shared by
+// stacks are counted by their reason, message template and dependency, over a window of time. Once
+// more than a threshold of these are seen in a window, the rest are not emitted on the stacks;
+// instead, at the end of the window, one event on the operator's Deployment gives the count, the
+// number of stacks and a sample of them. The stacks' conditions are updated as usual. Warnings go
+// back to being emitted on each stack after a window in which there are no more than the
+// threshold.
+
+var (
+	eventAggregationWindow = flag.Duration("event-aggregation-window", 5*time.Minute,
+		"the period over which like warnings from many stacks are counted, and collapsed into one event on the operator")
+	eventAggregationThreshold = flag.Int("event-aggregation-threshold", 20,
+		"the number of like warnings from stacks in an event aggregation window beyond which they are collapsed into one event on the operator; 0 means warnings are never collapsed")
+)
+
+// eventAggregationSampleSize is the number of stacks named in an aggregated event.
+const eventAggregationSampleSize = 5
+
+// eventAggregationKey identifies the warnings which are counted together.
+type eventAggregationKey struct {
+	reason     string
+	template   string
+	dependency string
+}
+
+// eventAggregate counts the warnings with a key over a window.
+type eventAggregate struct {
+	started time.Time
+	// whether warnings are being collapsed, rather than emitted on each stack
+	collapsing bool
+	count      int
+	collapsed  int
+	stacks     map[string]struct{}
+	sample     []string
+	// the message of the first warning collapsed, to give as an example
+	message string
+}
+
+func newEventAggregate(started time.Time, collapsing bool) *eventAggregate {
+	return &eventAggregate{started: started, collapsing: collapsing, stacks: map[string]struct{}{}}
+}
+
+// eventAggregator collapses like warnings from many stacks into one event on the operator.
+type eventAggregator struct {
+	recorder  record.EventRecorder
+	operator  *corev1.ObjectReference
+	window    time.Duration
+	threshold int
+	now       func() time.Time
+
+	mu         sync.Mutex
+	aggregates map[eventAggregationKey]*eventAggregate
+}
+
+// addEventAggregator creates an eventAggregator according to the flags, and adds it to the manager
+// so that aggregated events are emitted at the end of each window. It returns nil if aggregation is
+// turned off, or if the operator's Deployment can't be determined.
+func addEventAggregator(mgr manager.Manager, recorder record.EventRecorder) (*eventAggregator, error) {
+	if *eventAggregationThreshold <= 0 {
+		return nil, nil
+	}
+	if *eventAggregationWindow <= 0 {
+		return nil, fmt.Errorf("event-aggregation-window must be a positive duration, but got %s", *eventAggregationWindow)
+	}
+	namespace, err := k8sutil.GetOperatorNamespace()
+	name := os.Getenv("OPERATOR_NAME")
+	if err != nil || name == "" {
+		log.Info("Not aggregating warnings from stacks, since the operator's Deployment is not known")
+		return nil, nil
+	}
+	a := newEventAggregator(recorder, &corev1.ObjectReference{
+		APIVersion: "apps/v1",
+		Kind:       "Deployment",
+		Namespace:  namespace,
+		Name:       name,
+	}, *eventAggregationWindow, *eventAggregationThreshold)
+	return a, mgr.Add(a)
+}
+
+func newEventAggregator(recorder record.EventRecorder, operator *corev1.ObjectReference, window time.Duration, threshold int) *eventAggregator {
+	return &eventAggregator{
+		recorder:   recorder,
+		operator:   operator,
+		window:     window,
+		threshold:  threshold,
+		now:        time.Now,
+		aggregates: map[eventAggregationKey]*eventAggregate{},
+	}
+}
+
+// eventDependency gives the dependency shared with other stacks that an event is likely about, or
+// "" if the event is not about a shared dependency (e.g., it's about the stack's own
+// configuration), in which case it's always emitted on the stack.
+func eventDependency(instance *pulumiv1.Stack, event pulumiv1.StackEvent) string {
+	if event.EventType() != string(pulumiv1.EventTypeWarning) {
+		return ""
+	}
+	var gitServer string
+	if instance.Spec.GitSource != nil {
+		if remote, err := parseGitRemote(instance.Spec.ProjectRepo); err == nil && remote.Host != "" {
+			gitServer = "git server " + remote.Host
+		}
+	}
+	switch pulumiv1.StackEventReason(event.Reason()) {
+	case pulumiv1.StackGitAuthFailure:
+		return gitServer
+	case pulumiv1.StackInitializationFailure:
+		// this covers fetching the source and selecting the stack in the backend, and either may
+		// be at fault
+		if gitServer != "" {
+			return gitServer + " and " + backendDependency(instance.Spec.Backend)
+		}
+		return backendDependency(instance.Spec.Backend)
+	case pulumiv1.StackUpdateFailure, pulumiv1.StackOutputRetrievalFailure:
+		return backendDependency(instance.Spec.Backend)
+	}
+	return ""
+}
+
+// backendDependency names the backend given, without its path, query or any credentials.
+func backendDependency(backend string) string {
+	if backend == "" {
+		return "default backend"
+	}
+	u, err := url.Parse(backend)
+	if err != nil || u.Scheme == "" {
+		return "backend"
+	}
+	return fmt.Sprintf("backend %s://%s", u.Scheme, u.Host)
+}
+
+// collapse counts the event given, and reports whether it is collapsed into an aggregated event
+// rather than emitted on the stack.
+func (a *eventAggregator) collapse(instance *pulumiv1.Stack, event pulumiv1.StackEvent, template, message string) bool {
+	dependency := eventDependency(instance, event)
+	if dependency == "" {
+		return false
+	}
+	key := eventAggregationKey{reason: event.Reason(), template: template, dependency: dependency}
+	now := a.now()
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	agg := a.aggregates[key]
+	if agg != nil && now.Sub(agg.started) >= a.window {
+		agg = a.roll(key, agg, now)
+	}
+	if agg == nil {
+		agg = newEventAggregate(now, false)
+		a.aggregates[key] = agg
+	}
+	agg.count++
+	stack := instance.Namespace + "/" + instance.Name
+	if _, ok := agg.stacks[stack]; !ok {
+		agg.stacks[stack] = struct{}{}
+		if len(agg.sample) < eventAggregationSampleSize {
+			agg.sample = append(agg.sample, stack)
+		}
+	}
+	if agg.count > a.threshold {
+		agg.collapsing = true
+	}
+	if !agg.collapsing {
+		return false
+	}
+	agg.collapsed++
+	if agg.message == "" {
+		agg.message = message
+	}
+	return true
+}
+
+// flush ends the windows that are over, emitting their aggregated events.
+func (a *eventAggregator) flush() {
+	now := a.now()
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for key, agg := range a.aggregates {
+		if now.Sub(agg.started) >= a.window {
+			a.roll(key, agg, now)
+		}
+	}
+}
+
+// roll emits the aggregated event for a window that's over, if any warnings were collapsed, and
+// starts the next window. Warnings carry on being collapsed in the next window if there were more
+// than the threshold in this one; if there were none, the key is forgotten and nil is returned.
+func (a *eventAggregator) roll(key eventAggregationKey, agg *eventAggregate, now time.Time) *eventAggregate {
+	if agg.collapsed > 0 {
+		a.recorder.Eventf(a.operator, pulumiv1.StackWarningsAggregatedEvent().EventType(), pulumiv1.StackWarningsAggregatedEvent().Reason(),
+			"%d %s warnings from %d stacks in the last %s, likely due to the %s; %d of these were not emitted on the stacks. Stacks affected include %s. For example: %s",
+			agg.count, key.reason, len(agg.stacks), a.window, key.dependency, agg.collapsed, strings.Join(agg.sample, ", "), agg.message)
+	}
+	if agg.count == 0 {
+		delete(a.aggregates, key)
+		return nil
+	}
+	next := newEventAggregate(now, agg.count > a.threshold)
+	a.aggregates[key] = next
+	return next
+}
+
+func (a *eventAggregator) Start(ctx context.Context) error {
+	ticker := time.NewTicker(a.window / 4)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			a.flush()
+			return nil
+		case <-ticker.C:
+			a.flush()
+		}
+	}
+}
@@ -0,0 +1,86 @@
+// Copyright 2024, Pulumi Corporation.  All rights reserved.
+
+package stack
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+
+	"github.com/pulumi/pulumi-kubernetes-operator/pkg/apis/pulumi/shared"
+	pulumiv1 "github.com/pulumi/pulumi-kubernetes-operator/pkg/apis/pulumi/v1"
+)
+
+func TestEventDependency(t *testing.T) {
+	stack := &pulumiv1.Stack{Spec: shared.StackSpec{
+		GitSource: &shared.GitSource{ProjectRepo: "git@github.com:pulumi/examples.git"},
+		Backend:   "s3://user:pass@state-bucket/path?region=us-west-2",
+	}}
+	assert.Equal(t, "git server github.com", eventDependency(stack, pulumiv1.StackGitAuthFailureEvent()))
+	assert.Equal(t, "git server github.com and backend s3://state-bucket",
+		eventDependency(stack, pulumiv1.StackInitializationFailureEvent()))
+	assert.Equal(t, "backend s3://state-bucket", eventDependency(stack, pulumiv1.StackUpdateFailureEvent()))
+	assert.Empty(t, eventDependency(stack, pulumiv1.StackConfigInvalidEvent()), "about the stack itself")
+	assert.Empty(t, eventDependency(stack, pulumiv1.StackUpdateSuccessfulEvent()), "not a warning")
+
+	stack.Spec = shared.StackSpec{}
+	assert.Equal(t, "default backend", eventDependency(stack, pulumiv1.StackInitializationFailureEvent()))
+}
+
+func TestEventAggregator(t *testing.T) {
+	recorder := record.NewFakeRecorder(100)
+	operator := &corev1.ObjectReference{Kind: "Deployment", Namespace: "operator", Name: "pulumi-kubernetes-operator"}
+	a := newEventAggregator(recorder, operator, time.Minute, 2)
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	a.now = func() time.Time { return now }
+
+	event := pulumiv1.StackUpdateFailureEvent()
+	fail := func(name string) bool {
+		stack := &pulumiv1.Stack{ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: name}}
+		return a.collapse(stack, event, "Failed to update Stack: %v.", "Failed to update Stack: 503 Service Unavailable.")
+	}
+
+	// up to the threshold, each warning is emitted on its stack
+	assert.False(t, fail("a"))
+	assert.False(t, fail("b"))
+	// beyond it, they're collapsed
+	for i := 0; i < 5; i++ {
+		assert.True(t, fail(fmt.Sprintf("c%d", i)))
+	}
+	assert.False(t, a.collapse(&pulumiv1.Stack{}, pulumiv1.StackConfigInvalidEvent(), "%s", "invalid"),
+		"warnings about a stack itself are never collapsed")
+
+	a.flush()
+	assert.Empty(t, recorder.Events, "the window is not over")
+
+	now = now.Add(time.Minute)
+	a.flush()
+	require.Len(t, recorder.Events, 1)
+	msg := <-recorder.Events
+	assert.Contains(t, msg, "Warning StackWarningsAggregated 7 StackUpdateFailure warnings from 7 stacks in the last 1m0s")
+	assert.Contains(t, msg, "default backend; 5 of these were not emitted on the stacks")
+	assert.Contains(t, msg, "test/a, test/b, test/c0, test/c1, test/c2.")
+	assert.Contains(t, msg, "503 Service Unavailable")
+
+	// the volume was high, so the next window starts collapsed; when the volume drops, warnings
+	// are emitted on the stacks again
+	assert.True(t, fail("a"))
+	now = now.Add(time.Minute)
+	assert.False(t, fail("a"))
+	require.Len(t, recorder.Events, 1)
+	assert.Contains(t, <-recorder.Events, "1 StackUpdateFailure warnings from 1 stacks")
+
+	// a quiet window ends the aggregate
+	now = now.Add(2 * time.Minute)
+	a.flush()
+	now = now.Add(time.Minute)
+	a.flush()
+	assert.Empty(t, a.aggregates)
+	assert.Empty(t, recorder.Events)
+}
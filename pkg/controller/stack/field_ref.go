@@ -0,0 +1,70 @@
+// Copyright 2024, Pulumi Corporation.  All rights reserved.
+
+package stack
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/pulumi/pulumi-kubernetes-operator/pkg/apis/pulumi/shared"
+)
+
+// fieldRefValue gives the value of the field of the Stack object, with the metadata given, at the
+// path given by a FieldRef selector.
+func fieldRefValue(meta *metav1.ObjectMeta, path string) (string, error) {
+	switch path {
+	case "metadata.name":
+		return meta.Name, nil
+	case "metadata.namespace":
+		return meta.Namespace, nil
+	case "metadata.uid":
+		return string(meta.UID), nil
+	}
+	for prefix, values := range map[string]map[string]string{
+		"metadata.labels":      meta.Labels,
+		"metadata.annotations": meta.Annotations,
+	} {
+		if !strings.HasPrefix(path, prefix+"[") {
+			continue
+		}
+		subscript := strings.TrimPrefix(path, prefix)
+		if len(subscript) < 5 || !strings.HasPrefix(subscript, "['") || !strings.HasSuffix(subscript, "']") {
+			break
+		}
+		return values[subscript[2:len(subscript)-2]], nil
+	}
+	return "", fmt.Errorf("unsupported fieldPath %q; supported are metadata.name, metadata.namespace, metadata.uid, "+
+		"metadata.labels['<KEY>'] and metadata.annotations['<KEY>']", path)
+}
+
+// validateFieldRefs checks that the field paths given by FieldRef selectors in envRefs,
+// configRefs and secretRefs are supported, so that a stack using another is rejected before
+// anything is run.
+func validateFieldRefs(spec *shared.StackSpec) error {
+	var problems []string
+	check := func(field string, refs map[string]shared.ResourceRef) {
+		for k, ref := range refs {
+			if ref.SelectorType != shared.ResourceSelectorFieldRef {
+				continue
+			}
+			if ref.FieldRef == nil {
+				problems = append(problems, fmt.Sprintf("%s[%q]: missing fieldRef", field, k))
+				continue
+			}
+			if _, err := fieldRefValue(&metav1.ObjectMeta{}, ref.FieldRef.FieldPath); err != nil {
+				problems = append(problems, fmt.Sprintf("%s[%q]: %v", field, k, err))
+			}
+		}
+	}
+	check("envRefs", spec.EnvRefs)
+	check("configRefs", spec.ConfigRefs)
+	check("secretRefs", spec.SecretRefs)
+	if len(problems) == 0 {
+		return nil
+	}
+	sort.Strings(problems)
+	return newStallErrorf("invalid fieldRef: %s", strings.Join(problems, "; "))
+}
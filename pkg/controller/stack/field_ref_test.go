@@ -0,0 +1,60 @@
+// Copyright 2024, Pulumi Corporation.  All rights reserved.
+
+package stack
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/pulumi/pulumi-kubernetes-operator/pkg/apis/pulumi/shared"
+)
+
+func TestFieldRefValue(t *testing.T) {
+	meta := &metav1.ObjectMeta{
+		Name:        "networking",
+		Namespace:   "platform",
+		UID:         "0b5b7c34-4cd8-4f5c-9a2e-5b0e4f6f3c11",
+		Labels:      map[string]string{"team": "infra"},
+		Annotations: map[string]string{"example.com/cost-center": "1234"},
+	}
+	for path, want := range map[string]string{
+		"metadata.name":            "networking",
+		"metadata.namespace":       "platform",
+		"metadata.uid":             "0b5b7c34-4cd8-4f5c-9a2e-5b0e4f6f3c11",
+		"metadata.labels['team']":  "infra",
+		"metadata.labels['owner']": "",
+		"metadata.annotations['example.com/cost-center']": "1234",
+	} {
+		got, err := fieldRefValue(meta, path)
+		require.NoError(t, err, path)
+		assert.Equal(t, want, got, path)
+	}
+	for _, path := range []string{"spec.stack", "metadata.labels", "metadata.labels[team]", "metadata.labels['']", "metadata.generation"} {
+		_, err := fieldRefValue(meta, path)
+		assert.Error(t, err, path)
+	}
+}
+
+func TestValidateFieldRefs(t *testing.T) {
+	spec := &shared.StackSpec{
+		EnvRefs: map[string]shared.ResourceRef{
+			"STACK_NS": shared.NewFieldRefResourceRef("metadata.namespace"),
+			"TOKEN":    shared.NewLiteralResourceRef("x"),
+		},
+		ConfigRefs: map[string]shared.ResourceRef{"team": shared.NewFieldRefResourceRef("metadata.labels['team']")},
+	}
+	assert.NoError(t, validateFieldRefs(spec))
+
+	spec.SecretRefs = map[string]shared.ResourceRef{
+		"a": shared.NewFieldRefResourceRef("status.outputs"),
+		"b": {SelectorType: shared.ResourceSelectorFieldRef},
+	}
+	err := validateFieldRefs(spec)
+	require.Error(t, err)
+	assert.True(t, isStalledError(err))
+	assert.Contains(t, err.Error(), `secretRefs["a"]: unsupported fieldPath "status.outputs"`)
+	assert.Contains(t, err.Error(), `secretRefs["b"]: missing fieldRef`)
+}
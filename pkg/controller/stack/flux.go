@@ -10,7 +10,6 @@ import (
 
 	"github.com/fluxcd/pkg/http/fetch"
 
-	"github.com/pulumi/pulumi/sdk/v3/go/auto"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 
 	"github.com/pulumi/pulumi-kubernetes-operator/pkg/apis/pulumi/shared"
@@ -21,7 +20,6 @@ const maxArtifactDownloadSize = 50 * 1024 * 1024
 func (sess *reconcileStackSession) SetupWorkdirFromFluxSource(ctx context.Context, source unstructured.Unstructured, fluxSource *shared.FluxSource) (string, error) {
 	// this source artifact fetching code is based closely on
 	// https://github.com/fluxcd/kustomize-controller/blob/db3c321163522259595894ca6c19ed44a876976d/controllers/kustomization_controller.go#L529
-	homeDir := sess.getPulumiHome()
 	workspaceDir := sess.getWorkspaceDir()
 	sess.logger.Debug("Setting up pulumi workspace for stack", "stack", sess.stack, "workspace", workspaceDir)
 
@@ -50,12 +48,7 @@ func (sess *reconcileStackSession) SetupWorkdirFromFluxSource(ctx context.Contex
 		return "", fmt.Errorf("failed to get artifact from source: %w", err)
 	}
 
-	secretsProvider := auto.SecretsProvider(sess.stack.SecretsProvider)
-	w, err := auto.NewLocalWorkspace(
-		ctx,
-		auto.PulumiHome(homeDir),
-		auto.WorkDir(filepath.Join(workspaceDir, fluxSource.Dir)),
-		secretsProvider)
+	w, err := sess.newWorkspace(ctx, filepath.Join(workspaceDir, fluxSource.Dir))
 	if err != nil {
 		return "", fmt.Errorf("failed to create local workspace: %w", err)
 	}
@@ -5,7 +5,9 @@ package stack
 import (
 	"testing"
 
+	"github.com/pulumi/pulumi-kubernetes-operator/pkg/apis/pulumi/shared"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/apimachinery/pkg/util/yaml"
 )
 
@@ -160,3 +162,21 @@ status:
 		})
 	}
 }
+
+func TestFluxSourceKey(t *testing.T) {
+	gvk := schema.GroupVersionKind{Group: "source.toolkit.fluxcd.io", Version: "v1", Kind: "GitRepository"}
+	ref := shared.FluxSourceReference{APIVersion: "source.toolkit.fluxcd.io/v1", Kind: "GitRepository", Name: "app"}
+
+	if got := fluxSourceNamespace("stacks", ref); got != "stacks" {
+		t.Errorf("fluxSourceNamespace() = %v, want the stack's namespace", got)
+	}
+	ref.Namespace = "flux-system"
+	if got := fluxSourceNamespace("stacks", ref); got != "flux-system" {
+		t.Errorf("fluxSourceNamespace() = %v, want %v", got, ref.Namespace)
+	}
+
+	// the same source name in different namespaces must not be confused
+	if fluxSourceKey(gvk, "stacks", "app") == fluxSourceKey(gvk, "flux-system", "app") {
+		t.Errorf("fluxSourceKey() is the same for sources in different namespaces")
+	}
+}
@@ -0,0 +1,114 @@
+// Copyright 2024, Pulumi Corporation.  All rights reserved.
+
+package stack
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	pulumiv1 "github.com/pulumi/pulumi-kubernetes-operator/pkg/apis/pulumi/v1"
+)
+
+// clearPendingOperations removes the pending operations from an exported deployment, returning
+// the deployment without them and the number removed. If there are none, the deployment is
+// returned as it is.
+func clearPendingOperations(deployment json.RawMessage) (json.RawMessage, int, error) {
+	if len(deployment) == 0 {
+		return deployment, 0, nil
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(deployment, &fields); err != nil {
+		return nil, 0, err
+	}
+	raw, ok := fields["pending_operations"]
+	if !ok {
+		return deployment, 0, nil
+	}
+	var pending []json.RawMessage
+	if err := json.Unmarshal(raw, &pending); err != nil {
+		return nil, 0, fmt.Errorf("reading pending operations: %w", err)
+	}
+	delete(fields, "pending_operations")
+	if len(pending) == 0 {
+		return deployment, 0, nil
+	}
+	cleared, err := json.Marshal(fields)
+	if err != nil {
+		return nil, 0, err
+	}
+	return cleared, len(pending), nil
+}
+
+// recoverForDestroy cancels any update in progress and removes pending operations from the state,
+// so that a stack left in a bad state by an interrupted update can be destroyed. Each step is
+// recorded in the status. A failed cancel doesn't stop the recovery, since there may simply be no
+// update to cancel; failing to clear the pending operations does, since the destroy would fail on
+// them anyway.
+func (sess *reconcileStackSession) recoverForDestroy(ctx context.Context, instance *pulumiv1.Stack) error {
+	if instance.Status.DestroyProgress == nil {
+		instance.Status.DestroyProgress = &pulumiv1.StackDestroyProgress{}
+	}
+	progress := instance.Status.DestroyProgress
+	progress.RecoverySteps = nil
+	record := func(step string, err error, message string) {
+		if err != nil {
+			message = err.Error()
+		}
+		progress.RecoverySteps = append(progress.RecoverySteps, pulumiv1.StackRecoveryStep{
+			Step:      step,
+			Time:      metav1.Now(),
+			Succeeded: err == nil,
+			Message:   message,
+		})
+	}
+	defer func() {
+		if err := sess.patchStatus(ctx, instance); err != nil {
+			sess.logger.Error(err, "Failed to record steps taken to recover stack before destroying it", "Stack.Name", sess.stack.Stack)
+		}
+	}()
+
+	if err := sess.CancelStack(ctx); err != nil {
+		sess.logger.Info("Could not cancel update before destroying stack; carrying on", "Stack.Name", sess.stack.Stack, "Error", err.Error())
+		record(pulumiv1.RecoveryStepCancel, err, "")
+	} else {
+		sess.logger.Info("Cancelled update before destroying stack", "Stack.Name", sess.stack.Stack)
+		record(pulumiv1.RecoveryStepCancel, nil, "cancelled update in progress")
+	}
+
+	n, err := sess.removePendingOperations(ctx)
+	if err != nil {
+		record(pulumiv1.RecoveryStepClearPendingOperations, err, "")
+		return err
+	}
+	if n == 0 {
+		record(pulumiv1.RecoveryStepClearPendingOperations, nil, "no pending operations")
+	} else {
+		sess.logger.Info("Removed pending operations before destroying stack", "Stack.Name", sess.stack.Stack, "Count", n)
+		record(pulumiv1.RecoveryStepClearPendingOperations, nil, fmt.Sprintf("removed %d pending operation(s)", n))
+	}
+	return nil
+}
+
+// removePendingOperations exports the stack's state, and imports it again without the pending
+// operations, returning the number removed.
+func (sess *reconcileStackSession) removePendingOperations(ctx context.Context) (int, error) {
+	deployment, err := sess.autoStack.Export(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("exporting state of stack %q: %w", sess.stack.Stack, err)
+	}
+	cleared, n, err := clearPendingOperations(deployment.Deployment)
+	if err != nil {
+		return 0, fmt.Errorf("reading state of stack %q: %w", sess.stack.Stack, err)
+	}
+	if n == 0 {
+		return 0, nil
+	}
+	deployment.Deployment = cleared
+	if err := sess.autoStack.Import(ctx, deployment); err != nil {
+		return 0, fmt.Errorf("importing state of stack %q without pending operations: %w", sess.stack.Stack, err)
+	}
+	return n, nil
+}
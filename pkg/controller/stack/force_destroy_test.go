@@ -0,0 +1,40 @@
+// Copyright 2024, Pulumi Corporation.  All rights reserved.
+
+package stack
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClearPendingOperations(t *testing.T) {
+	deployment := json.RawMessage(`{
+		"manifest": {"time": "2024-01-01T00:00:00Z"},
+		"resources": [{"urn": "urn:pulumi:dev::proj::pulumi:pulumi:Stack::proj-dev", "type": "pulumi:pulumi:Stack"}],
+		"pending_operations": [
+			{"resource": {"urn": "urn:pulumi:dev::proj::aws:s3/bucket:Bucket::b", "type": "aws:s3/bucket:Bucket"}, "type": "creating"},
+			{"resource": {"urn": "urn:pulumi:dev::proj::aws:s3/bucket:Bucket::c", "type": "aws:s3/bucket:Bucket"}, "type": "updating"}
+		]
+	}`)
+	cleared, n, err := clearPendingOperations(deployment)
+	require.NoError(t, err)
+	assert.Equal(t, 2, n)
+	assert.JSONEq(t, `{
+		"manifest": {"time": "2024-01-01T00:00:00Z"},
+		"resources": [{"urn": "urn:pulumi:dev::proj::pulumi:pulumi:Stack::proj-dev", "type": "pulumi:pulumi:Stack"}]
+	}`, string(cleared))
+
+	// with no pending operations, the deployment is left as it is
+	for _, unchanged := range []string{`{"resources": []}`, `{"resources": [], "pending_operations": []}`, ``} {
+		cleared, n, err := clearPendingOperations(json.RawMessage(unchanged))
+		require.NoError(t, err)
+		assert.Equal(t, 0, n)
+		assert.Equal(t, unchanged, string(cleared))
+	}
+
+	_, _, err = clearPendingOperations(json.RawMessage(`{"pending_operations": {}}`))
+	assert.Error(t, err)
+}
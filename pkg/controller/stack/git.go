@@ -0,0 +1,648 @@
+// Copyright 2024, Pulumi Corporation.  All rights reserved.
+
+package stack
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/protocol/packp/capability"
+	"github.com/go-git/go-git/v5/plumbing/transport"
+	"github.com/go-git/go-git/v5/plumbing/transport/http"
+	"github.com/go-git/go-git/v5/plumbing/transport/ssh"
+	"github.com/go-git/go-git/v5/storage/memory"
+	"github.com/pulumi/pulumi/sdk/v3/go/auto"
+	giturls "github.com/whilp/git-urls"
+	gossh "golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+
+	"github.com/pulumi/pulumi-kubernetes-operator/pkg/apis/pulumi/shared"
+)
+
+var (
+	// scpLikeRemote matches scp-like git remotes, e.g. git@github.com:foo/bar.git or
+	// git@ssh.dev.azure.com:v3/org/project/repo. It mirrors the expression go-git uses to
+	// recognise the same form, so that the host and port we derive here agree with what is
+	// used when the repository is cloned.
+	scpLikeRemote = regexp.MustCompile(`^(?:(?P<user>[^@]+)@)?(?P<host>[^:\s]+):(?:(?P<port>[0-9]{1,5})(?:\/|:))?(?P<path>[^\\].*\/[^\\].*)$`)
+	// remoteWithScheme matches anything that looks like it starts with a URL scheme.
+	remoteWithScheme = regexp.MustCompile(`^[^:]+://`)
+)
+
+// gitRemote is a git remote URL broken into its parts. Both URLs with an explicit scheme
+// (e.g. ssh://git@gitlab.example.com:2222/group/repo.git) and scp-like remotes (e.g.
+// git@ssh.dev.azure.com:v3/org/project/repo) are normalised into this form.
+type gitRemote struct {
+	Scheme string
+	User   string
+	Host   string
+	Port   string
+	Path   string
+}
+
+// parseGitRemote parses a git remote URL. Unlike giturls.Parse, it does not treat a remote
+// which is almost, but not quite, scp-like as a local path; that would mean an SSH remote is
+// not recognised as such, and cloned without the SSH credentials supplied for it.
+func parseGitRemote(raw string) (*gitRemote, error) {
+	if remoteWithScheme.MatchString(raw) {
+		u, err := url.Parse(raw)
+		if err != nil {
+			return nil, fmt.Errorf("parsing git remote %q: %w", raw, err)
+		}
+		if !giturls.Transports.Valid(u.Scheme) {
+			return nil, fmt.Errorf("parsing git remote %q: scheme %q is not a valid git transport", raw, u.Scheme)
+		}
+		remote := &gitRemote{
+			Scheme: u.Scheme,
+			Host:   u.Hostname(),
+			Port:   u.Port(),
+			Path:   u.Path,
+		}
+		if u.User != nil {
+			remote.User = u.User.Username()
+		}
+		return remote, nil
+	}
+
+	if m := scpLikeRemote.FindStringSubmatch(raw); m != nil {
+		return &gitRemote{
+			Scheme: "ssh",
+			User:   m[scpLikeRemote.SubexpIndex("user")],
+			Host:   m[scpLikeRemote.SubexpIndex("host")],
+			Port:   m[scpLikeRemote.SubexpIndex("port")],
+			Path:   m[scpLikeRemote.SubexpIndex("path")],
+		}, nil
+	}
+
+	// Anything with a colon before the first slash was intended as an scp-like remote (git
+	// itself interprets it as one), so refuse it rather than guessing it is a local path.
+	if i := strings.Index(raw, ":"); i >= 0 && !strings.Contains(raw[:i], "/") {
+		return nil, fmt.Errorf("parsing git remote %q: expected [user@]host:path/to/repo or a URL", raw)
+	}
+
+	return &gitRemote{Scheme: "file", Path: raw}, nil
+}
+
+// IsSSH reports whether the remote is accessed over SSH.
+func (r *gitRemote) IsSSH() bool {
+	return r.Scheme == "ssh" || r.Scheme == "git+ssh"
+}
+
+// hostKeyPolicy says how the host key of an SSH git server is to be checked.
+type hostKeyPolicy struct {
+	// KnownHosts holds known_hosts entries to verify against, if given.
+	KnownHosts string
+	// Strict is the setting of strictHostKeyChecking, if given.
+	Strict *bool
+}
+
+// ScanHostKeys reports whether the host keys of the server should be scanned and trusted, which
+// is the behaviour when neither known hosts nor strict checking are given.
+func (p hostKeyPolicy) ScanHostKeys() bool {
+	return p.KnownHosts == "" && p.Strict == nil
+}
+
+// SetupGitHostKeyPolicy resolves how SSH host keys are to be checked, from the stack's gitAuth or
+// gitAuthSecret.
+func (sess *reconcileStackSession) SetupGitHostKeyPolicy(ctx context.Context) (hostKeyPolicy, error) {
+	var policy hostKeyPolicy
+	if sess.stack.GitAuth != nil {
+		policy.Strict = sess.stack.GitAuth.StrictHostKeyChecking
+		if sess.stack.GitAuth.KnownHosts != nil {
+			knownHosts, err := sess.resolveResourceRef(ctx, sess.stack.GitAuth.KnownHosts)
+			if err != nil {
+				return policy, fmt.Errorf("resolving gitAuth known hosts: %w", err)
+			}
+			policy.KnownHosts = knownHosts
+		}
+	} else if sess.stack.GitAuthSecret != "" {
+		secret := &corev1.Secret{}
+		namespacedName := types.NamespacedName{Name: sess.stack.GitAuthSecret, Namespace: sess.namespace}
+		if err := sess.kubeClient.Get(ctx, namespacedName, secret); err != nil {
+			return policy, err
+		}
+		if knownHosts, exists := secret.Data["knownHosts"]; exists {
+			policy.KnownHosts = string(knownHosts)
+		}
+	}
+	if policy.Strict != nil && !*policy.Strict && policy.KnownHosts != "" {
+		return policy, errors.New("gitAuth known hosts cannot be used when strictHostKeyChecking is false")
+	}
+	return policy, nil
+}
+
+// hostKeyCallback returns the callback used to verify SSH host keys of the git remote given,
+// according to the policy. A nil callback means the default, which verifies against
+// $HOME/.ssh/known_hosts.
+func (sess *reconcileStackSession) hostKeyCallback(policy hostKeyPolicy, repo string) (gossh.HostKeyCallback, error) {
+	switch {
+	case policy.KnownHosts != "":
+		path := filepath.Join(sess.rootDir, "known_hosts")
+		if err := os.WriteFile(path, []byte(policy.KnownHosts), 0600); err != nil {
+			return nil, fmt.Errorf("writing known hosts: %w", err)
+		}
+		callback, err := ssh.NewKnownHostsCallback(path)
+		if err != nil {
+			return nil, fmt.Errorf("reading known hosts: %w", err)
+		}
+		return callback, nil
+	case policy.Strict != nil && !*policy.Strict:
+		sess.logger.Info("SSH host key checking is disabled for git remote", "ProjectRepo", repo)
+		return gossh.InsecureIgnoreHostKey(), nil
+	}
+	return nil, nil
+}
+
+// HostKeyVerificationError indicates that the host key presented by a git server could not be
+// verified against the known hosts.
+type HostKeyVerificationError struct {
+	Remote string
+	err    *knownhosts.KeyError
+}
+
+func (e HostKeyVerificationError) Error() string {
+	if len(e.err.Want) == 0 {
+		return fmt.Sprintf("host key verification failed for %s: the host is not in the known hosts", e.Remote)
+	}
+	return fmt.Sprintf("host key verification failed for %s: the host key does not match the known hosts; "+
+		"if the server's key has been rotated, update the known hosts", e.Remote)
+}
+
+func (e HostKeyVerificationError) Unwrap() error {
+	return e.err
+}
+
+// asHostKeyVerificationError wraps err as a HostKeyVerificationError, if it was caused by a host
+// key that could not be verified.
+func asHostKeyVerificationError(remote string, err error) error {
+	var keyErr *knownhosts.KeyError
+	if errors.As(err, &keyErr) {
+		return HostKeyVerificationError{Remote: remote, err: keyErr}
+	}
+	return err
+}
+
+func isHostKeyVerificationError(err error) bool {
+	var e HostKeyVerificationError
+	return errors.As(err, &e)
+}
+
+// gitCABundle resolves the PEM-encoded CA bundle used to verify the TLS certificate of the git
+// server, from the source's gitTLS, or else its gitAuth or gitAuthSecret. A nil bundle
+// means the system roots are used.
+func (sess *reconcileStackSession) gitCABundle(ctx context.Context, source *shared.GitSource) ([]byte, error) {
+	var bundle []byte
+	if source.GitTLS != nil && source.GitTLS.CABundle != nil {
+		pem, err := sess.resolveResourceRef(ctx, source.GitTLS.CABundle)
+		if err != nil {
+			return nil, fmt.Errorf("resolving gitTLS CA bundle: %w", err)
+		}
+		bundle = []byte(pem)
+	} else if source.GitAuth != nil {
+		if source.GitAuth.CABundle == nil {
+			return nil, nil
+		}
+		pem, err := sess.resolveResourceRef(ctx, source.GitAuth.CABundle)
+		if err != nil {
+			return nil, fmt.Errorf("resolving gitAuth CA bundle: %w", err)
+		}
+		bundle = []byte(pem)
+	} else if source.GitAuthSecret != "" {
+		secret := &corev1.Secret{}
+		namespacedName := types.NamespacedName{Name: source.GitAuthSecret, Namespace: sess.namespace}
+		if err := sess.kubeClient.Get(ctx, namespacedName, secret); err != nil {
+			return nil, err
+		}
+		bundle = secret.Data["caBundle"]
+	}
+	if len(bundle) == 0 {
+		return nil, nil
+	}
+	if !x509.NewCertPool().AppendCertsFromPEM(bundle) {
+		return nil, errors.New("the git CA bundle does not contain any PEM-encoded certificates")
+	}
+	return bundle, nil
+}
+
+// isTLSVerificationError reports whether err was caused by a git server presenting a TLS
+// certificate that could not be verified.
+func isTLSVerificationError(err error) bool {
+	for err != nil {
+		var (
+			unknownAuthority x509.UnknownAuthorityError
+			invalid          x509.CertificateInvalidError
+			hostname         x509.HostnameError
+			verification     *tls.CertificateVerificationError
+		)
+		if errors.As(err, &unknownAuthority) || errors.As(err, &invalid) ||
+			errors.As(err, &hostname) || errors.As(err, &verification) {
+			return true
+		}
+		// go-git wraps errors from the HTTP client in an UnexpectedError, which does not
+		// support unwrapping.
+		var unexpected *plumbing.UnexpectedError
+		if !errors.As(err, &unexpected) {
+			return false
+		}
+		err = unexpected.Err
+	}
+	return false
+}
+
+// isGitAuthenticationError reports whether err was caused by the git server rejecting the
+// credentials given for it, or by AWS refusing credentials with which to access CodeCommit.
+func isGitAuthenticationError(err error) bool {
+	return errors.Is(err, transport.ErrAuthenticationRequired) ||
+		errors.Is(err, transport.ErrAuthorizationFailed) ||
+		errors.Is(err, errAWSCredentials)
+}
+
+// gitTransportAuth converts the git credentials into the form used by go-git.
+func gitTransportAuth(remote *gitRemote, gitAuth *auto.GitAuth, hostKeyCallback gossh.HostKeyCallback) (transport.AuthMethod, error) {
+	switch {
+	case gitAuth == nil:
+		return nil, nil
+	case gitAuth.SSHPrivateKey != "":
+		user := "git"
+		if remote.User != "" {
+			user = remote.User
+		}
+		keys, err := ssh.NewPublicKeys(user, []byte(gitAuth.SSHPrivateKey), gitAuth.Password)
+		if err != nil {
+			return nil, fmt.Errorf("loading SSH private key: %w", err)
+		}
+		keys.HostKeyCallback = hostKeyCallback
+		return keys, nil
+	case gitAuth.PersonalAccessToken != "":
+		// the username for use with a PAT can be anything but an empty string
+		return &http.BasicAuth{Username: "git", Password: gitAuth.PersonalAccessToken}, nil
+	case gitAuth.Username != "":
+		return &http.BasicAuth{Username: gitAuth.Username, Password: gitAuth.Password}, nil
+	}
+	return nil, nil
+}
+
+// gitReferenceName normalises the branch given in a git source into a full reference name.
+// People have been advised to use fully qualified names, so these are accepted as well as simple
+// branch names.
+func gitReferenceName(branch string) (plumbing.ReferenceName, error) {
+	refName := plumbing.ReferenceName(branch)
+	switch {
+	case refName.IsRemote(): // e.g., refs/remotes/origin/branch
+		parts := strings.SplitN(strings.TrimPrefix(branch, "refs/remotes/"), "/", 2)
+		if len(parts) != 2 || parts[0] != "origin" {
+			return "", fmt.Errorf("a remote ref must begin with 'refs/remotes/origin/', but got %q", branch)
+		}
+		return plumbing.NewBranchReferenceName(parts[1]), nil
+	case refName.IsTag(), refName.IsBranch():
+		return refName, nil
+	}
+	return plumbing.NewBranchReferenceName(branch), nil
+}
+
+// gitTagReferenceName normalises the tag given in a git source into a full reference name.
+func gitTagReferenceName(tag string) (plumbing.ReferenceName, error) {
+	refName := plumbing.ReferenceName(tag)
+	switch {
+	case refName.IsTag():
+		return refName, nil
+	case strings.HasPrefix(tag, "refs/"):
+		return "", fmt.Errorf("a tag must be a simple name or begin with 'refs/tags/', but got %q", tag)
+	}
+	return plumbing.NewTagReferenceName(tag), nil
+}
+
+// gitProxyOptions resolves the proxy given explicitly for the git source, if any. Otherwise, the
+// zero value is returned, and go-git's HTTP transport falls back to the proxy environment
+// variables.
+func (sess *reconcileStackSession) gitProxyOptions(ctx context.Context, source *shared.GitSource) (transport.ProxyOptions, error) {
+	var opts transport.ProxyOptions
+	if source.GitProxyURL == "" {
+		if source.GitProxyAuth != nil {
+			return opts, errors.New("gitProxyAuth is given, but gitProxyURL is not")
+		}
+		return opts, nil
+	}
+
+	u, err := url.Parse(source.GitProxyURL)
+	if err != nil {
+		return opts, fmt.Errorf("parsing gitProxyURL: %w", err)
+	}
+	switch u.Scheme {
+	case "http", "https", "socks5":
+	default:
+		return opts, fmt.Errorf("gitProxyURL scheme must be one of http, https or socks5, but got %q", u.Scheme)
+	}
+	opts.URL = source.GitProxyURL
+
+	if source.GitProxyAuth != nil {
+		if opts.Username, err = sess.resolveResourceRef(ctx, &source.GitProxyAuth.UserName); err != nil {
+			return opts, fmt.Errorf("resolving gitProxyAuth username: %w", err)
+		}
+		if opts.Password, err = sess.resolveResourceRef(ctx, &source.GitProxyAuth.Password); err != nil {
+			return opts, fmt.Errorf("resolving gitProxyAuth password: %w", err)
+		}
+	}
+	return opts, nil
+}
+
+// gitConnection holds what's needed to reach the repository of a git source.
+type gitConnection struct {
+	remote *gitRemote
+	// gitAuth gives the credentials for the repository, with any short-lived token (e.g., for a
+	// GitHub App) filled in; auth is made from it.
+	gitAuth         *auto.GitAuth
+	auth            transport.AuthMethod
+	hostKeyCallback gossh.HostKeyCallback
+	proxyOptions    transport.ProxyOptions
+	caBundle        []byte
+	// insecureSkipTLS is true if the TLS certificate of the git server is not to be verified.
+	insecureSkipTLS bool
+	// fingerprint identifies the credentials, proxy and CA bundle; see gitCredentialsFingerprint.
+	fingerprint string
+}
+
+// connectGit works out how to reach the repository of the git source given, with the credentials
+// given.
+func (sess *reconcileStackSession) connectGit(ctx context.Context, gitAuth *auto.GitAuth, policy hostKeyPolicy, source *shared.GitSource) (*gitConnection, error) {
+	remote, err := parseGitRemote(source.ProjectRepo)
+	if err != nil {
+		return nil, err
+	}
+	hostKeyCallback, err := sess.hostKeyCallback(policy, source.ProjectRepo)
+	if err != nil {
+		return nil, err
+	}
+	auth, err := gitTransportAuth(remote, gitAuth, hostKeyCallback)
+	if err != nil {
+		return nil, err
+	}
+	// The installation token for a GitHub App is replaced as it nears expiry, so it's the app rather
+	// than the token that identifies the credentials.
+	fingerprintAuth := gitAuth
+	if app := sess.gitHubApp; app != nil {
+		token, err := gitHubAppTokens.token(ctx, app, time.Now())
+		if err != nil {
+			return nil, err
+		}
+		gitAuth = &auto.GitAuth{Username: "x-access-token", Password: token}
+		auth = &gitHubAppAuth{app: app, token: token}
+		fingerprintAuth = &auto.GitAuth{Username: app.appID + "/" + app.installationID, Password: app.keyDigest}
+	}
+	// Likewise, the password for CodeCommit is a signature good for only a short while, and it's
+	// the AWS identity that identifies the credentials.
+	if cc := sess.codeCommit; cc != nil {
+		creds, err := cc.credentials(ctx)
+		if err != nil {
+			return nil, err
+		}
+		username, password := cc.repo.sign(creds, time.Now())
+		gitAuth = &auto.GitAuth{Username: username, Password: password}
+		cc.last = creds
+		auth = cc
+		fingerprintAuth = &auto.GitAuth{Username: cc.identity()}
+	}
+	proxyOptions, err := sess.gitProxyOptions(ctx, source)
+	if err != nil {
+		return nil, err
+	}
+	caBundle, err := sess.gitCABundle(ctx, source)
+	if err != nil {
+		return nil, err
+	}
+	insecureSkipTLS := source.GitTLS != nil && source.GitTLS.InsecureSkipVerify
+	if insecureSkipTLS && !remote.IsSSH() {
+		sess.logger.Info("WARNING: verification of the git server's TLS certificate is turned off by gitTLS.insecureSkipVerify, "+
+			"so the connection could be intercepted", "Stack.Name", sess.stack.Stack, "ProjectRepo", source.ProjectRepo)
+	}
+	if proxyOptions.URL != "" && remote.IsSSH() && !strings.HasPrefix(proxyOptions.URL, "socks5:") {
+		return nil, fmt.Errorf("only a SOCKS5 proxy can be used with the SSH remote %q", source.ProjectRepo)
+	}
+
+	return &gitConnection{
+		remote:          remote,
+		gitAuth:         gitAuth,
+		auth:            auth,
+		hostKeyCallback: hostKeyCallback,
+		proxyOptions:    proxyOptions,
+		caBundle:        caBundle,
+		insecureSkipTLS: insecureSkipTLS,
+		fingerprint:     gitCredentialsFingerprint(fingerprintAuth, proxyOptions, caBundle),
+	}, nil
+}
+
+// CloneGitSource clones the repository given in the git source into the workspace directory,
+// checks out the requested branch or commit, and returns the directory of the project within it.
+func (sess *reconcileStackSession) CloneGitSource(ctx context.Context, gitAuth *auto.GitAuth, policy hostKeyPolicy, source *shared.GitSource) (string, error) {
+	conn, err := sess.connectGit(ctx, gitAuth, policy, source)
+	if err != nil {
+		return "", err
+	}
+	remote, auth, proxyOptions, caBundle := conn.remote, conn.auth, conn.proxyOptions, conn.caBundle
+	gitAuth = conn.gitAuth
+
+	cloneOptions := &git.CloneOptions{
+		RemoteName:      "origin",
+		URL:             source.ProjectRepo,
+		Auth:            auth,
+		ProxyOptions:    proxyOptions,
+		CABundle:        caBundle,
+		InsecureSkipTLS: conn.insecureSkipTLS,
+		Depth:           source.FetchDepth,
+	}
+	// Clone will fetch only the given branch or tag if there is one, leaving HEAD detached at the
+	// commit a tag resolves to; otherwise, it fetches all refs, so that checking out a commit
+	// afterwards will work.
+	switch {
+	case source.Branch != "":
+		if cloneOptions.ReferenceName, err = gitReferenceName(source.Branch); err != nil {
+			return "", err
+		}
+	case source.Tag != "":
+		if cloneOptions.ReferenceName, err = gitTagReferenceName(source.Tag); err != nil {
+			return "", err
+		}
+	}
+
+	// Azure DevOps requires the capabilities multi_ack and multi_ack_detailed on the initial
+	// fetch, which go-git doesn't implement; see
+	// https://github.com/go-git/go-git/blob/master/_examples/azure_devops/main.go
+	if strings.Contains(remote.Host, "dev.azure.com") {
+		transport.UnsupportedCapabilities = []capability.Capability{capability.ThinPack}
+	}
+
+	workspaceDir := sess.getWorkspaceDir()
+	fingerprint := conn.fingerprint
+	repo, err := sess.reuseGitWorkdir(ctx, cloneOptions, fingerprint, source)
+	if err != nil {
+		return "", err
+	}
+	reused := repo != nil
+	switch {
+	case reused:
+		sess.logger.Debug("Fetched into git workspace kept from last run", "workspace", workspaceDir)
+	case sess.gitMirrors != nil && source.FetchDepth == 0:
+		repo, err = sess.gitMirrors.clone(ctx, workspaceDir, cloneOptions, fingerprint)
+	default:
+		repo, err = git.PlainCloneContext(ctx, workspaceDir, false, cloneOptions)
+	}
+	if err != nil {
+		return "", fmt.Errorf("unable to clone repo: %w", asHostKeyVerificationError(source.ProjectRepo, err))
+	}
+
+	if source.Commit != "" {
+		hash := plumbing.NewHash(source.Commit)
+		// ensure that the commit has been fetched
+		fetchOpts := git.FetchOptions{
+			RemoteName:      "origin",
+			Auth:            auth,
+			RefSpecs:        []config.RefSpec{config.RefSpec(source.Commit + ":" + source.Commit)},
+			ProxyOptions:    proxyOptions,
+			CABundle:        caBundle,
+			InsecureSkipTLS: conn.insecureSkipTLS,
+			Depth:           source.FetchDepth,
+		}
+		err = repo.FetchContext(ctx, &fetchOpts)
+		if err != nil && !errors.Is(err, git.NoErrAlreadyUpToDate) && !errors.Is(err, git.ErrExactSHA1NotSupported) {
+			// a server not allowing a commit to be fetched by its hash may refuse outright; a
+			// shallow clone can still be deepened to find it
+			if source.FetchDepth == 0 {
+				return "", fmt.Errorf("fetching commit: %w", asHostKeyVerificationError(source.ProjectRepo, err))
+			}
+			sess.logger.Debug("Unable to fetch commit by its hash", "Commit", source.Commit, "Error", err.Error())
+		}
+		if err := sess.deepenToCommit(ctx, repo, fetchOpts, source); err != nil {
+			return "", err
+		}
+		if reused {
+			if err := resetGitWorkdir(repo, hash); err != nil {
+				return "", err
+			}
+		} else {
+			w, err := repo.Worktree()
+			if err != nil {
+				return "", err
+			}
+			if err = w.Checkout(&git.CheckoutOptions{Hash: hash, Force: true}); err != nil {
+				return "", fmt.Errorf("unable to checkout commit: %w", err)
+			}
+		}
+	}
+	if reused {
+		if err := sess.restoreDependencies(workspaceDir, source); err != nil {
+			return "", err
+		}
+	}
+
+	if source.FetchSubmodules {
+		err := updateSubmodules(ctx, repo, submoduleFetch{
+			remote:          remote,
+			auth:            auth,
+			gitAuth:         gitAuth,
+			hostKeyCallback: conn.hostKeyCallback,
+			fetch: git.FetchOptions{
+				RemoteName:      "origin",
+				ProxyOptions:    proxyOptions,
+				CABundle:        caBundle,
+				InsecureSkipTLS: conn.insecureSkipTLS,
+				Depth:           source.FetchDepth,
+			},
+		}, 1)
+		if err != nil {
+			return "", err
+		}
+	} else {
+		// Now the workspace is checked out, it can be kept for the next run. Workspaces with
+		// submodules are cloned afresh each time instead, since resetting the working tree doesn't
+		// reach into the submodules.
+		record := sess.gitWorkdir
+		if record == nil {
+			record = &gitWorkdirRecord{URL: source.ProjectRepo, CredentialsFingerprint: fingerprint}
+		}
+		record.RepoDir = source.RepoDir
+		record.FetchDepth = source.FetchDepth
+		if err := sess.recordGitWorkdir(record); err != nil {
+			return "", err
+		}
+	}
+
+	if source.GitLFS {
+		lfs, err := newLFSClient(remote, source.ProjectRepo, gitAuth, proxyOptions, caBundle, conn.insecureSkipTLS)
+		if err != nil {
+			return "", err
+		}
+		if err := lfs.Fetch(ctx, workspaceDir); err != nil {
+			return "", err
+		}
+	}
+
+	return filepath.Join(workspaceDir, source.RepoDir), nil
+}
+
+// ResolveGitSourceRevision finds the commit that the branch or tag of the git source points to, by
+// listing the references of the repository rather than fetching from it. For a source giving a
+// commit, it's that commit.
+func (sess *reconcileStackSession) ResolveGitSourceRevision(ctx context.Context, gitAuth *auto.GitAuth, policy hostKeyPolicy, source *shared.GitSource) (string, error) {
+	var name plumbing.ReferenceName
+	var err error
+	switch {
+	case source.Branch != "":
+		name, err = gitReferenceName(source.Branch)
+	case source.Tag != "":
+		name, err = gitTagReferenceName(source.Tag)
+	default:
+		return source.Commit, nil
+	}
+	if err != nil {
+		return "", err
+	}
+	conn, err := sess.connectGit(ctx, gitAuth, policy, source)
+	if err != nil {
+		return "", err
+	}
+	remote := git.NewRemote(memory.NewStorage(), &config.RemoteConfig{
+		Name: "origin",
+		URLs: []string{source.ProjectRepo},
+	})
+	refs, err := remote.ListContext(ctx, &git.ListOptions{
+		Auth:            conn.auth,
+		ProxyOptions:    conn.proxyOptions,
+		CABundle:        conn.caBundle,
+		InsecureSkipTLS: conn.insecureSkipTLS,
+		PeelingOption:   git.AppendPeeled,
+	})
+	if err != nil {
+		return "", fmt.Errorf("listing references: %w", asHostKeyVerificationError(source.ProjectRepo, err))
+	}
+	// An annotated tag is listed along with the commit it points to, which is the one wanted.
+	var direct, peeled *plumbing.Reference
+	for _, ref := range refs {
+		switch ref.Name() {
+		case name:
+			direct = ref
+		case name + "^{}":
+			peeled = ref
+		}
+	}
+	switch {
+	case peeled != nil:
+		return peeled.Hash().String(), nil
+	case direct != nil:
+		return direct.Hash().String(), nil
+	}
+	return "", fmt.Errorf("reference %s not found in %s", name, source.ProjectRepo)
+}
@@ -0,0 +1,104 @@
+// Copyright 2024, Pulumi Corporation.  All rights reserved.
+
+package stack
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/pulumi/pulumi/sdk/v3/go/auto"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	"github.com/pulumi/pulumi-kubernetes-operator/pkg/apis/pulumi/shared"
+	pulumiv1 "github.com/pulumi/pulumi-kubernetes-operator/pkg/apis/pulumi/v1"
+)
+
+const (
+	// gitCloneRetryBackoff is the wait before the first retry of a failed clone; it's doubled for
+	// each retry after that.
+	gitCloneRetryBackoff = 5 * time.Second
+	// maxGitCloneRetryBackoff is the longest wait before a retry.
+	maxGitCloneRetryBackoff = 2 * time.Minute
+)
+
+// errGitCloneFailed marks the error when cloning the repository has failed, within the timeout
+// and retries given in the git source.
+var errGitCloneFailed = errors.New("git clone failed")
+
+// isRetryableCloneError reports whether cloning again might succeed where an attempt failed with
+// the error given. Problems with the spec, the credentials or the repository's contents won't
+// go away by themselves.
+func isRetryableCloneError(err error) bool {
+	return !isMissingReference(err) &&
+		!isStalledError(err) &&
+		!isHostKeyVerificationError(err) &&
+		!isTLSVerificationError(err) &&
+		!isGitAuthenticationError(err) &&
+		!errors.Is(err, errCommitNotFound) &&
+		!errors.Is(err, errProjectNotFound)
+}
+
+// gitCloneBackoff gives the wait before the retry given, counting from 1.
+func gitCloneBackoff(retry int) time.Duration {
+	backoff := gitCloneRetryBackoff
+	for i := 1; i < retry && backoff < maxGitCloneRetryBackoff; i++ {
+		backoff *= 2
+	}
+	return min(backoff, maxGitCloneRetryBackoff)
+}
+
+// cloneGitSourceWithRetries is CloneGitSource, limiting each attempt to the timeout given in the
+// git source, and retrying failed attempts as many times as it allows. Without a timeout or
+// retries, it's a single attempt, and its error is returned as-is; otherwise, the error from the
+// last attempt is marked with errGitCloneFailed, unless it's not worth retrying.
+func (sess *reconcileStackSession) cloneGitSourceWithRetries(ctx context.Context, gitAuth *auto.GitAuth, policy hostKeyPolicy, source *shared.GitSource) (string, error) {
+	if source.GitCloneTimeoutSeconds == 0 && source.GitCloneRetries == 0 {
+		return sess.CloneGitSource(ctx, gitAuth, policy, source)
+	}
+	timeout := time.Duration(source.GitCloneTimeoutSeconds) * time.Second
+	for attempt := 1; ; attempt++ {
+		attemptCtx, cancel := ctx, context.CancelFunc(func() {})
+		if timeout > 0 {
+			attemptCtx, cancel = context.WithTimeout(ctx, timeout)
+		}
+		dir, err := sess.CloneGitSource(attemptCtx, gitAuth, policy, source)
+		timedOut := errors.Is(attemptCtx.Err(), context.DeadlineExceeded)
+		cancel()
+		if err == nil {
+			return dir, nil
+		}
+		if timedOut {
+			err = fmt.Errorf("timed out after %s: %w", timeout, err)
+		}
+		if !isRetryableCloneError(err) {
+			return "", err
+		}
+		if attempt > source.GitCloneRetries || ctx.Err() != nil {
+			return "", gitCloneFailedError(source, attempt, err)
+		}
+		backoff := gitCloneBackoff(attempt)
+		sess.logger.Info("Failed to clone git repository; retrying",
+			"Attempt", attempt, "Retries", source.GitCloneRetries, "Backoff", backoff, "Error", err.Error())
+		select {
+		case <-ctx.Done():
+			return "", gitCloneFailedError(source, attempt, err)
+		case <-time.After(backoff):
+		}
+	}
+}
+
+// gitCloneFailedError marks the error from the last attempt to clone with errGitCloneFailed.
+func gitCloneFailedError(source *shared.GitSource, attempts int, err error) error {
+	return fmt.Errorf("%w for %s after %d attempt(s): %w", errGitCloneFailed, source.ProjectRepo, attempts, err)
+}
+
+// gitCloneFailed records that the git repository could not be cloned, and has the stack retried.
+func (r *ReconcileStack) gitCloneFailed(sess *reconcileStackSession, instance *pulumiv1.Stack, err error) (reconcile.Result, error) {
+	r.emitEvent(instance, pulumiv1.StackInitializationFailureEvent(), "Failed to clone git repository: %v", err.Error())
+	r.markStackFailed(sess, instance, err, "", "")
+	instance.Status.LastUpdate.Reason = pulumiv1.ReconcilingGitCloneFailedReason
+	instance.Status.MarkReconcilingCondition(pulumiv1.ReconcilingGitCloneFailedReason, err.Error())
+	return reconcile.Result{Requeue: true}, nil
+}
@@ -0,0 +1,60 @@
+// Copyright 2024, Pulumi Corporation.  All rights reserved.
+
+package stack
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	"github.com/pulumi/pulumi-kubernetes-operator/pkg/apis/pulumi/shared"
+	"github.com/pulumi/pulumi-kubernetes-operator/pkg/logging"
+)
+
+func TestGitCloneBackoff(t *testing.T) {
+	assert.Equal(t, 5*time.Second, gitCloneBackoff(1))
+	assert.Equal(t, 10*time.Second, gitCloneBackoff(2))
+	assert.Equal(t, 80*time.Second, gitCloneBackoff(5))
+	assert.Equal(t, 2*time.Minute, gitCloneBackoff(6))
+	assert.Equal(t, 2*time.Minute, gitCloneBackoff(100))
+}
+
+func TestIsRetryableCloneError(t *testing.T) {
+	assert.True(t, isRetryableCloneError(context.DeadlineExceeded))
+	assert.False(t, isRetryableCloneError(errCommitNotFound))
+	assert.False(t, isRetryableCloneError(newStallErrorf("bad spec")))
+}
+
+func TestCloneGitSourceWithRetries(t *testing.T) {
+	logger := logging.NewLogger(t.Name(), "Request.Test", "TestCloneGitSourceWithRetries")
+	client := fake.NewFakeClientWithScheme(scheme.Scheme)
+	repoDir, commit := newTestRepo(t)
+	commit("name: first")
+
+	clone := func(source *shared.GitSource) (string, error) {
+		sess := newReconcileStackSession(logger, shared.StackSpec{}, client, namespace)
+		sess.rootDir = t.TempDir()
+		_, err := sess.MakeWorkspaceDir()
+		require.NoError(t, err)
+		return sess.cloneGitSourceWithRetries(context.TODO(), nil, hostKeyPolicy{}, source)
+	}
+
+	dir, err := clone(&shared.GitSource{ProjectRepo: repoDir, GitCloneTimeoutSeconds: 60})
+	require.NoError(t, err)
+	assert.FileExists(t, filepath.Join(dir, "Pulumi.yaml"))
+
+	// a failure is marked as such only when a timeout or retries are given
+	missing := filepath.Join(t.TempDir(), "missing")
+	_, err = clone(&shared.GitSource{ProjectRepo: missing})
+	require.Error(t, err)
+	assert.NotErrorIs(t, err, errGitCloneFailed)
+	_, err = clone(&shared.GitSource{ProjectRepo: missing, GitCloneTimeoutSeconds: 60})
+	assert.ErrorIs(t, err, errGitCloneFailed)
+	assert.Contains(t, err.Error(), "after 1 attempt(s)")
+}
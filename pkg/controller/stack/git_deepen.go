@@ -0,0 +1,112 @@
+// Copyright 2024, Pulumi Corporation.  All rights reserved.
+
+package stack
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/plumbing"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	"github.com/pulumi/pulumi-kubernetes-operator/pkg/apis/pulumi/shared"
+	pulumiv1 "github.com/pulumi/pulumi-kubernetes-operator/pkg/apis/pulumi/v1"
+)
+
+// A shallow clone (fetchDepth) has only the latest commits of each branch. A stack pinned to a
+// commit further back than that can still be deployed if the git server allows fetching a commit
+// by its hash, but many don't. When the commit is not in the clone, the clone is deepened, doubling
+// the depth each time, until the commit is found or the depth reaches maxFetchDepth; without
+// maxFetchDepth, the whole history is fetched as a last resort. Failing that, the commit isn't in
+// the repository (or not within maxFetchDepth commits), and the stack is stalled with the reason
+// CommitNotFound. The depth at which the commit was found is logged, so that fetchDepth can be
+// tuned.
+
+const (
+	// maxDoubledFetchDepth is the depth beyond which a clone is not deepened in steps, when no
+	// maxFetchDepth is given; instead the whole history is fetched.
+	maxDoubledFetchDepth = 1024
+	// unshallowFetchDepth is the depth given to fetch the whole history of a shallow clone, as
+	// `git fetch --unshallow` does.
+	unshallowFetchDepth = 1<<31 - 1
+)
+
+// errCommitNotFound marks the error when the commit given in a git source can't be found.
+var errCommitNotFound = errors.New("commit not found")
+
+// deepeningSteps gives the depths to which a clone of the depth given is deepened in turn to find a
+// commit, up to the maximum given. With no maximum, the depth is doubled up to
+// maxDoubledFetchDepth, then the whole history is fetched.
+func deepeningSteps(depth, maxDepth int) []int {
+	var steps []int
+	limit := maxDepth
+	if limit == 0 {
+		limit = maxDoubledFetchDepth
+	}
+	for d := depth * 2; depth > 0 && d < limit; d *= 2 {
+		steps = append(steps, d)
+	}
+	switch {
+	case maxDepth == 0:
+		steps = append(steps, unshallowFetchDepth)
+	case maxDepth > depth:
+		steps = append(steps, maxDepth)
+	}
+	return steps
+}
+
+// hasCommit reports whether the repository has the commit given.
+func hasCommit(repo *git.Repository, hash plumbing.Hash) bool {
+	_, err := repo.CommitObject(hash)
+	return err == nil
+}
+
+// deepenToCommit deepens the shallow clone in the repository given, in steps, until it has the
+// commit given in the source. The fetch options are those the repository was cloned with.
+func (sess *reconcileStackSession) deepenToCommit(ctx context.Context, repo *git.Repository, fetchOpts git.FetchOptions, source *shared.GitSource) error {
+	hash := plumbing.NewHash(source.Commit)
+	if hasCommit(repo, hash) {
+		return nil
+	}
+	if source.FetchDepth == 0 {
+		// the whole history has been fetched already
+		return fmt.Errorf("%w: %s is not in %s; check commit", errCommitNotFound, source.Commit, source.ProjectRepo)
+	}
+	fetchOpts.RefSpecs = []config.RefSpec{config.RefSpec(fmt.Sprintf("+refs/heads/*:refs/remotes/%s/*", fetchOpts.RemoteName))}
+	fetchOpts.Tags = git.AllTags
+	for _, depth := range deepeningSteps(source.FetchDepth, source.MaxFetchDepth) {
+		fetchOpts.Depth = depth
+		err := repo.FetchContext(ctx, &fetchOpts)
+		if err != nil && !errors.Is(err, git.NoErrAlreadyUpToDate) {
+			return fmt.Errorf("deepening clone to %d commits: %w", depth, asHostKeyVerificationError(source.ProjectRepo, err))
+		}
+		if hasCommit(repo, hash) {
+			if depth == unshallowFetchDepth {
+				sess.logger.Info("Found commit by fetching the whole history; consider giving a greater fetchDepth",
+					"Commit", source.Commit, "FetchDepth", source.FetchDepth)
+			} else {
+				sess.logger.Info("Found commit by deepening the clone; consider giving a fetchDepth of at least the depth reached",
+					"Commit", source.Commit, "FetchDepth", source.FetchDepth, "DepthReached", depth)
+			}
+			return nil
+		}
+	}
+	if source.MaxFetchDepth > 0 {
+		return fmt.Errorf("%w: %s is not within %d commits of any branch of %s; check commit, or give a greater maxFetchDepth",
+			errCommitNotFound, source.Commit, source.MaxFetchDepth, source.ProjectRepo)
+	}
+	return fmt.Errorf("%w: %s is not in %s; check commit", errCommitNotFound, source.Commit, source.ProjectRepo)
+}
+
+// commitNotFound records that the commit given in the git source can't be found, and has the stack
+// tried again after a long wait, as for a project that can't be found.
+func (r *ReconcileStack) commitNotFound(sess *reconcileStackSession, instance *pulumiv1.Stack, err error) (reconcile.Result, error) {
+	r.emitEvent(instance, pulumiv1.StackInitializationFailureEvent(), "Failed to initialize stack: %v", err.Error())
+	r.markStackFailed(sess, instance, err, "", "")
+	instance.Status.LastUpdate.Reason = pulumiv1.ReconcilingCommitNotFoundReason
+	instance.Status.MarkReconcilingCondition(pulumiv1.ReconcilingCommitNotFoundReason, err.Error())
+	return reconcile.Result{RequeueAfter: projectNotFoundBackoff}, nil
+}
@@ -0,0 +1,71 @@
+// Copyright 2024, Pulumi Corporation.  All rights reserved.
+
+package stack
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	apimeta "k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	"github.com/pulumi/pulumi-kubernetes-operator/pkg/apis/pulumi/shared"
+	pulumiv1 "github.com/pulumi/pulumi-kubernetes-operator/pkg/apis/pulumi/v1"
+	"github.com/pulumi/pulumi-kubernetes-operator/pkg/logging"
+)
+
+func TestDeepeningSteps(t *testing.T) {
+	assert.Equal(t, []int{100, 200, 400, 800, unshallowFetchDepth}, deepeningSteps(50, 0),
+		"doubled, then the whole history")
+	assert.Equal(t, []int{100, 200, 300}, deepeningSteps(50, 300), "doubled up to the maximum")
+	assert.Equal(t, []int{100}, deepeningSteps(50, 100))
+	assert.Empty(t, deepeningSteps(50, 50), "no deeper than the maximum")
+	assert.Empty(t, deepeningSteps(50, 20))
+}
+
+func TestDeepenToCommit(t *testing.T) {
+	logger := logging.NewLogger(t.Name(), "Request.Test", "TestDeepenToCommit")
+	sess := newReconcileStackSession(logger, shared.StackSpec{}, fake.NewFakeClientWithScheme(scheme.Scheme), namespace)
+	repoDir, commit := newTestRepo(t)
+	first := commit("name: first")
+	repo, err := git.PlainOpen(repoDir)
+	require.NoError(t, err)
+	opts := git.FetchOptions{RemoteName: "origin"}
+
+	// the commit is there already
+	require.NoError(t, sess.deepenToCommit(context.TODO(), repo, opts, &shared.GitSource{
+		ProjectRepo: repoDir,
+		Commit:      first.String(),
+		FetchDepth:  1,
+	}))
+
+	// the whole history is there, and it isn't in it
+	err = sess.deepenToCommit(context.TODO(), repo, opts, &shared.GitSource{
+		ProjectRepo: repoDir,
+		Commit:      "0123456789abcdef0123456789abcdef01234567",
+	})
+	assert.ErrorIs(t, err, errCommitNotFound)
+}
+
+func TestCommitNotFound(t *testing.T) {
+	logger := logging.NewLogger(t.Name(), "Request.Test", "TestCommitNotFound")
+	r := &ReconcileStack{recorder: record.NewFakeRecorder(10)}
+	sess := newReconcileStackSession(logger, shared.StackSpec{}, nil, namespace)
+	instance := &pulumiv1.Stack{ObjectMeta: metav1.ObjectMeta{Name: "pinned", Namespace: namespace, Generation: 1}}
+
+	res, err := r.commitNotFound(sess, instance, fmt.Errorf("%w: 0123456 is not in https://example.com/repo.git", errCommitNotFound))
+	require.NoError(t, err)
+	assert.Equal(t, projectNotFoundBackoff, res.RequeueAfter, "retried after a long wait")
+	reconciling := apimeta.FindStatusCondition(instance.Status.Conditions, pulumiv1.ReconcilingCondition)
+	require.NotNil(t, reconciling)
+	assert.Equal(t, pulumiv1.ReconcilingCommitNotFoundReason, reconciling.Reason)
+	assert.Nil(t, apimeta.FindStatusCondition(instance.Status.Conditions, pulumiv1.StalledCondition), "not stalled, since it's retried")
+	assert.Equal(t, pulumiv1.ReconcilingCommitNotFoundReason, instance.Status.LastUpdate.Reason)
+}
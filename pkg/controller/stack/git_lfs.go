@@ -0,0 +1,368 @@
+// Copyright 2024, Pulumi Corporation.  All rights reserved.
+
+package stack
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/go-git/go-git/v5/plumbing/transport"
+	"github.com/pulumi/pulumi/sdk/v3/go/auto"
+)
+
+const (
+	// lfsPointerMaxSize is the largest a Git LFS pointer file can be, per the specification.
+	lfsPointerMaxSize = 1024
+	lfsPointerVersion = "version https://git-lfs.github.com/spec/v1"
+	lfsMediaType      = "application/vnd.git-lfs+json"
+)
+
+// lfsPointer is the content of a Git LFS pointer file, which stands in for a large file in the
+// repository.
+type lfsPointer struct {
+	OID  string `json:"oid"`
+	Size int64  `json:"size"`
+}
+
+// parseLFSPointer parses a Git LFS pointer file, returning false if the data is not one.
+func parseLFSPointer(data []byte) (lfsPointer, bool) {
+	var p lfsPointer
+	if len(data) > lfsPointerMaxSize || !bytes.HasPrefix(data, []byte(lfsPointerVersion+"\n")) {
+		return p, false
+	}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		key, value, _ := strings.Cut(scanner.Text(), " ")
+		switch key {
+		case "oid":
+			oid, ok := strings.CutPrefix(value, "sha256:")
+			if !ok {
+				return p, false
+			}
+			p.OID = oid
+		case "size":
+			size, err := strconv.ParseInt(value, 10, 64)
+			if err != nil {
+				return p, false
+			}
+			p.Size = size
+		}
+	}
+	return p, len(p.OID) == sha256.Size*2
+}
+
+// findLFSPointers returns the pointer files in the working tree at dir, by their path.
+func findLFSPointers(dir string) (map[string]lfsPointer, error) {
+	pointers := map[string]lfsPointer{}
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if d.Name() == ".git" {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil || info.Size() > lfsPointerMaxSize {
+			return err
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		if p, ok := parseLFSPointer(data); ok {
+			pointers[path] = p
+		}
+		return nil
+	})
+	return pointers, err
+}
+
+// lfsEndpoint returns the URL of the Git LFS API for the repository, which by convention is at
+// info/lfs under the repository URL.
+func lfsEndpoint(remote *gitRemote, projectRepo string) (string, error) {
+	if remote.Scheme != "http" && remote.Scheme != "https" {
+		return "", fmt.Errorf("gitLFS is supported only for HTTP(S) repository URLs, but got %q", projectRepo)
+	}
+	u, err := url.Parse(projectRepo)
+	if err != nil {
+		return "", err
+	}
+	u.User = nil
+	u.Path = strings.TrimSuffix(u.Path, "/")
+	if !strings.HasSuffix(u.Path, ".git") {
+		u.Path += ".git"
+	}
+	u.Path += "/info/lfs"
+	return u.String(), nil
+}
+
+// lfsClient downloads objects from a Git LFS server, using the basic transfer adapter.
+type lfsClient struct {
+	endpoint string
+	client   *http.Client
+	username string
+	password string
+}
+
+type lfsBatchRequest struct {
+	Operation string       `json:"operation"`
+	Transfers []string     `json:"transfers"`
+	Objects   []lfsPointer `json:"objects"`
+}
+
+type lfsBatchResponse struct {
+	Objects []struct {
+		lfsPointer
+		Actions struct {
+			Download *struct {
+				Href   string            `json:"href"`
+				Header map[string]string `json:"header"`
+			} `json:"download"`
+		} `json:"actions"`
+		Error *struct {
+			Code    int    `json:"code"`
+			Message string `json:"message"`
+		} `json:"error"`
+	} `json:"objects"`
+}
+
+// newLFSClient makes a client for the Git LFS API of the repository, which authenticates with the
+// same credentials, goes through the same proxy, and verifies the server in the same way, as for
+// the repository itself.
+func newLFSClient(remote *gitRemote, source string, gitAuth *auto.GitAuth, proxy transport.ProxyOptions, caBundle []byte, insecureSkipTLS bool) (*lfsClient, error) {
+	endpoint, err := lfsEndpoint(remote, source)
+	if err != nil {
+		return nil, err
+	}
+
+	tr := http.DefaultTransport.(*http.Transport).Clone()
+	if proxy.URL != "" {
+		proxyURL, err := url.Parse(proxy.URL)
+		if err != nil {
+			return nil, fmt.Errorf("parsing gitProxyURL: %w", err)
+		}
+		if proxy.Username != "" {
+			proxyURL.User = url.UserPassword(proxy.Username, proxy.Password)
+		}
+		tr.Proxy = http.ProxyURL(proxyURL)
+	}
+	if len(caBundle) > 0 {
+		roots, err := x509.SystemCertPool()
+		if err != nil {
+			roots = x509.NewCertPool()
+		}
+		roots.AppendCertsFromPEM(caBundle)
+		tr.TLSClientConfig = &tls.Config{RootCAs: roots}
+	}
+	if insecureSkipTLS {
+		if tr.TLSClientConfig == nil {
+			tr.TLSClientConfig = &tls.Config{}
+		}
+		tr.TLSClientConfig.InsecureSkipVerify = true
+	}
+
+	c := &lfsClient{endpoint: endpoint, client: &http.Client{Transport: tr}}
+	switch {
+	case gitAuth == nil:
+	case gitAuth.PersonalAccessToken != "":
+		c.username, c.password = "git", gitAuth.PersonalAccessToken
+	case gitAuth.Username != "":
+		c.username, c.password = gitAuth.Username, gitAuth.Password
+	}
+	return c, nil
+}
+
+// Fetch replaces the pointer files in the working tree at dir with the objects they stand for. If
+// any object cannot be fetched and verified, an error naming the object is returned, and no
+// pointer file is replaced.
+func (c *lfsClient) Fetch(ctx context.Context, dir string) error {
+	pointers, err := findLFSPointers(dir)
+	if err != nil {
+		return fmt.Errorf("finding Git LFS pointer files: %w", err)
+	}
+	if len(pointers) == 0 {
+		return nil
+	}
+
+	objects := map[string]lfsPointer{}
+	for _, p := range pointers {
+		objects[p.OID] = p
+	}
+	batch := lfsBatchRequest{Operation: "download", Transfers: []string{"basic"}}
+	for _, p := range objects {
+		batch.Objects = append(batch.Objects, p)
+	}
+	resp, err := c.batch(ctx, batch)
+	if err != nil {
+		return err
+	}
+
+	downloaded := map[string]string{} // OID -> path of the downloaded object
+	defer func() {
+		for _, path := range downloaded {
+			os.Remove(path)
+		}
+	}()
+	for _, obj := range resp.Objects {
+		if obj.Error != nil {
+			return fmt.Errorf("fetching Git LFS object %s: %d %s", obj.OID, obj.Error.Code, obj.Error.Message)
+		}
+		if obj.Actions.Download == nil {
+			return fmt.Errorf("fetching Git LFS object %s: the server gave no download action", obj.OID)
+		}
+		expected, ok := objects[obj.OID]
+		if !ok {
+			continue
+		}
+		path, err := c.download(ctx, dir, expected, obj.Actions.Download.Href, obj.Actions.Download.Header)
+		if err != nil {
+			return fmt.Errorf("fetching Git LFS object %s: %w", obj.OID, err)
+		}
+		downloaded[obj.OID] = path
+	}
+	for oid := range objects {
+		if _, ok := downloaded[oid]; !ok {
+			return fmt.Errorf("fetching Git LFS object %s: the object was missing from the server's response", oid)
+		}
+	}
+
+	for path, p := range pointers {
+		if err := copyFile(downloaded[p.OID], path); err != nil {
+			return fmt.Errorf("writing Git LFS object %s to %s: %w", p.OID, path, err)
+		}
+	}
+	return nil
+}
+
+func (c *lfsClient) batch(ctx context.Context, batch lfsBatchRequest) (*lfsBatchResponse, error) {
+	body, err := json.Marshal(batch)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.endpoint+"/objects/batch", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", lfsMediaType)
+	req.Header.Set("Content-Type", lfsMediaType)
+	if c.username != "" {
+		req.SetBasicAuth(c.username, c.password)
+	}
+	res, err := c.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("requesting Git LFS objects: %w", err)
+	}
+	defer res.Body.Close()
+	switch res.StatusCode {
+	case http.StatusOK:
+	case http.StatusUnauthorized:
+		return nil, fmt.Errorf("requesting Git LFS objects: %w", transport.ErrAuthenticationRequired)
+	case http.StatusForbidden:
+		return nil, fmt.Errorf("requesting Git LFS objects: %w", transport.ErrAuthorizationFailed)
+	default:
+		return nil, fmt.Errorf("requesting Git LFS objects: unexpected status %s", res.Status)
+	}
+	var resp lfsBatchResponse
+	if err := json.NewDecoder(res.Body).Decode(&resp); err != nil {
+		return nil, fmt.Errorf("decoding Git LFS batch response: %w", err)
+	}
+	return &resp, nil
+}
+
+// download fetches an object into a temporary file under dir, checking that it has the expected
+// size and hash, and returns the path of the file.
+func (c *lfsClient) download(ctx context.Context, dir string, p lfsPointer, href string, header map[string]string) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, href, nil)
+	if err != nil {
+		return "", err
+	}
+	for k, v := range header {
+		req.Header.Set(k, v)
+	}
+	// The credentials for the LFS API are only sent to the same host, and only when the server
+	// hasn't said how to authenticate the download.
+	if _, ok := header["Authorization"]; !ok && c.username != "" && sameHost(href, c.endpoint) {
+		req.SetBasicAuth(c.username, c.password)
+	}
+	res, err := c.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("unexpected status %s", res.Status)
+	}
+
+	f, err := os.CreateTemp(dir, ".lfs-object-")
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	hash := sha256.New()
+	n, err := io.Copy(io.MultiWriter(f, hash), io.LimitReader(res.Body, p.Size+1))
+	if err == nil {
+		switch {
+		case n != p.Size:
+			err = fmt.Errorf("expected %d bytes, but got %d", p.Size, n)
+		case hex.EncodeToString(hash.Sum(nil)) != p.OID:
+			err = errors.New("the content does not match the object ID")
+		}
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return "", err
+	}
+	return f.Name(), nil
+}
+
+func sameHost(a, b string) bool {
+	ua, err := url.Parse(a)
+	if err != nil {
+		return false
+	}
+	ub, err := url.Parse(b)
+	if err != nil {
+		return false
+	}
+	return ua.Host == ub.Host
+}
+
+// copyFile copies the file at src over the file at dst, keeping the mode of dst.
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_TRUNC, 0)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
@@ -0,0 +1,337 @@
+// Copyright 2024, Pulumi Corporation.  All rights reserved.
+
+package stack
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing/transport"
+	"github.com/go-git/go-git/v5/plumbing/transport/client"
+	"github.com/go-git/go-git/v5/plumbing/transport/file"
+	"github.com/go-git/go-git/v5/plumbing/transport/server"
+	"github.com/pulumi/pulumi/sdk/v3/go/auto"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+const (
+	// EnvGitMirrorCacheDir is the name of the environment entry giving a directory in which to keep
+	// a mirror of each git repository used by stacks. When it's set, a repository is cloned once,
+	// then brought up to date with a fetch each time it's used, and stacks are checked out from the
+	// mirror rather than cloned from the remote. When it's not set, each stack clones its
+	// repository every time it's processed.
+	EnvGitMirrorCacheDir = "GIT_MIRROR_CACHE_DIR"
+	// EnvGitMirrorCacheSizeLimit is the name of the environment entry giving the most disk space
+	// the mirrors may take up, as a quantity, e.g., "20Gi". The least recently used mirrors are
+	// removed to stay within the limit. The default is 10Gi.
+	EnvGitMirrorCacheSizeLimit = "GIT_MIRROR_CACHE_SIZE_LIMIT"
+
+	defaultGitMirrorCacheSizeLimit = "10Gi"
+
+	// gitMirrorRecordFile is kept in each mirror, and records the fingerprint of the credentials it
+	// was cloned with. It's touched whenever the mirror is used, so its modification time tells
+	// which mirrors were least recently used.
+	gitMirrorRecordFile = "pulumi-operator-mirror"
+)
+
+// getGitMirrorCache returns the mirror cache configured in the environment, or nil if there is
+// none.
+func getGitMirrorCache() (*gitMirrorCache, error) {
+	dir, ok := os.LookupEnv(EnvGitMirrorCacheDir)
+	if !ok || dir == "" {
+		return nil, nil
+	}
+	raw, ok := os.LookupEnv(EnvGitMirrorCacheSizeLimit)
+	if !ok || raw == "" {
+		raw = defaultGitMirrorCacheSizeLimit
+	}
+	limit, err := resource.ParseQuantity(raw)
+	if err != nil || limit.Sign() <= 0 {
+		return nil, fmt.Errorf("%s must be a positive quantity, e.g., 10Gi, but got %q", EnvGitMirrorCacheSizeLimit, raw)
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf("creating git mirror cache directory: %w", err)
+	}
+	return newGitMirrorCache(dir, limit.Value()), nil
+}
+
+// gitMirrorCache keeps a bare mirror of each git repository used by stacks, so that stacks using
+// the same repository share a clone, which is fetched into rather than cloned again. Each mirror
+// is locked while it's used, so that concurrent reconciliations of stacks using the same
+// repository don't interfere with one another.
+//
+// A mirror is kept for each repository URL, and records the credentials it was last fetched with.
+// If a stack uses the repository with different credentials, the mirror is cloned again with
+// those, so that what one stack can fetch is never used by a stack that may not be able to fetch
+// it. This means stacks using the same repository with different credentials don't benefit from
+// the cache.
+type gitMirrorCache struct {
+	dir       string
+	sizeLimit int64
+
+	mu    sync.Mutex
+	locks map[string]*sync.Mutex
+}
+
+var installMirrorTransport sync.Once
+
+func newGitMirrorCache(dir string, sizeLimit int64) *gitMirrorCache {
+	// The stacks' workspaces are cloned from the mirrors in-process, rather than with the git
+	// programs which the default transport for local repositories runs.
+	installMirrorTransport.Do(func() {
+		client.InstallProtocol("file", &mirrorTransport{
+			mirrors:  server.NewServer(server.DefaultLoader),
+			fallback: file.DefaultClient,
+		})
+	})
+	return &gitMirrorCache{dir: dir, sizeLimit: sizeLimit, locks: map[string]*sync.Mutex{}}
+}
+
+// mirrorTransport serves bare repositories in-process, for cloning from mirrors, and uses the
+// default transport for everything else (e.g., a stack using a repository on the local filesystem).
+type mirrorTransport struct {
+	mirrors, fallback transport.Transport
+}
+
+func (t *mirrorTransport) NewUploadPackSession(ep *transport.Endpoint, auth transport.AuthMethod) (transport.UploadPackSession, error) {
+	if isGitMirror(ep.Path) {
+		return t.mirrors.NewUploadPackSession(ep, auth)
+	}
+	return t.fallback.NewUploadPackSession(ep, auth)
+}
+
+func (t *mirrorTransport) NewReceivePackSession(ep *transport.Endpoint, auth transport.AuthMethod) (transport.ReceivePackSession, error) {
+	return t.fallback.NewReceivePackSession(ep, auth)
+}
+
+func isGitMirror(dir string) bool {
+	_, err := os.Stat(filepath.Join(dir, gitMirrorRecordFile))
+	return err == nil
+}
+
+// mirrorLock returns the lock for the mirror in the directory given.
+func (c *gitMirrorCache) mirrorLock(dir string) *sync.Mutex {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	l, ok := c.locks[dir]
+	if !ok {
+		l = &sync.Mutex{}
+		c.locks[dir] = l
+	}
+	return l
+}
+
+// mirrorDir gives the directory for the mirror of the repository at the URL given.
+func (c *gitMirrorCache) mirrorDir(url string) string {
+	sum := sha256.Sum256([]byte(url))
+	return filepath.Join(c.dir, hex.EncodeToString(sum[:16]))
+}
+
+// gitCredentialsFingerprint gives a digest of everything used to authenticate to a repository,
+// so that a change to any of it can be detected without keeping the credentials themselves.
+func gitCredentialsFingerprint(gitAuth *auto.GitAuth, proxy transport.ProxyOptions, caBundle []byte) string {
+	h := sha256.New()
+	write := func(s string) {
+		fmt.Fprintf(h, "%d:%s;", len(s), s)
+	}
+	if gitAuth != nil {
+		write(gitAuth.Username)
+		write(gitAuth.Password)
+		write(gitAuth.PersonalAccessToken)
+		write(gitAuth.SSHPrivateKey)
+		write(gitAuth.SSHPrivateKeyPath)
+	}
+	write(proxy.URL)
+	write(proxy.Username)
+	write(proxy.Password)
+	write(string(caBundle))
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// clone brings the mirror of the repository given in the clone options up to date, cloning it if
+// there isn't one, then clones the workspace given from the mirror. The workspace's origin is set
+// to the repository's own URL, as though it had been cloned from there.
+func (c *gitMirrorCache) clone(ctx context.Context, workspaceDir string, opts *git.CloneOptions, fingerprint string) (*git.Repository, error) {
+	dir := c.mirrorDir(opts.URL)
+	l := c.mirrorLock(dir)
+	l.Lock()
+	defer l.Unlock()
+
+	if err := c.updateMirror(ctx, dir, opts, fingerprint); err != nil {
+		return nil, err
+	}
+
+	repo, err := git.PlainCloneContext(ctx, workspaceDir, false, &git.CloneOptions{
+		RemoteName:    opts.RemoteName,
+		URL:           dir,
+		ReferenceName: opts.ReferenceName,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("cloning from git mirror: %w", err)
+	}
+	cfg, err := repo.Config()
+	if err != nil {
+		return nil, err
+	}
+	cfg.Remotes[opts.RemoteName].URLs = []string{opts.URL}
+	if err := repo.SetConfig(cfg); err != nil {
+		return nil, fmt.Errorf("setting origin of repository cloned from git mirror: %w", err)
+	}
+
+	// This runs while the mirror just used is still locked, so it won't be removed.
+	c.evict()
+	return repo, nil
+}
+
+// fetch brings the mirror of the repository given in the clone options up to date, then fetches
+// into the repository given from the mirror rather than from the remote.
+func (c *gitMirrorCache) fetch(ctx context.Context, repo *git.Repository, opts *git.CloneOptions, fetchOpts *git.FetchOptions, fingerprint string) error {
+	dir := c.mirrorDir(opts.URL)
+	l := c.mirrorLock(dir)
+	l.Lock()
+	defer l.Unlock()
+
+	if err := c.updateMirror(ctx, dir, opts, fingerprint); err != nil {
+		return err
+	}
+	fromMirror := *fetchOpts
+	fromMirror.RemoteURL = dir
+	fromMirror.Auth = nil
+	fromMirror.ProxyOptions = transport.ProxyOptions{}
+	fromMirror.CABundle = nil
+	fromMirror.InsecureSkipTLS = false
+	if err := repo.FetchContext(ctx, &fromMirror); err != nil {
+		return err
+	}
+
+	c.evict()
+	return nil
+}
+
+// updateMirror fetches into the mirror in the directory given, first cloning it if it doesn't
+// exist, or was made with other credentials. It must be called with the mirror locked.
+func (c *gitMirrorCache) updateMirror(ctx context.Context, dir string, opts *git.CloneOptions, fingerprint string) error {
+	record := filepath.Join(dir, gitMirrorRecordFile)
+	if recorded, err := os.ReadFile(record); err == nil && string(recorded) != fingerprint {
+		if err := os.RemoveAll(dir); err != nil {
+			return fmt.Errorf("removing git mirror cloned with other credentials: %w", err)
+		}
+	}
+
+	repo, err := git.PlainOpen(dir)
+	switch {
+	case errors.Is(err, git.ErrRepositoryNotExists):
+		// anything left by a clone that failed part way through is removed, so it's started afresh
+		if err := os.RemoveAll(dir); err != nil {
+			return err
+		}
+		_, err = git.PlainCloneContext(ctx, dir, true, &git.CloneOptions{
+			URL:             opts.URL,
+			Auth:            opts.Auth,
+			ProxyOptions:    opts.ProxyOptions,
+			CABundle:        opts.CABundle,
+			InsecureSkipTLS: opts.InsecureSkipTLS,
+			Mirror:          true,
+		})
+		if err != nil {
+			_ = os.RemoveAll(dir)
+			return fmt.Errorf("unable to clone repo: %w", asHostKeyVerificationError(opts.URL, err))
+		}
+	case err != nil:
+		return fmt.Errorf("opening git mirror: %w", err)
+	default:
+		err = repo.FetchContext(ctx, &git.FetchOptions{
+			RemoteName:      "origin",
+			Auth:            opts.Auth,
+			ProxyOptions:    opts.ProxyOptions,
+			CABundle:        opts.CABundle,
+			InsecureSkipTLS: opts.InsecureSkipTLS,
+			Tags:            git.AllTags,
+			Force:           true,
+			Prune:           true,
+		})
+		if err != nil && !errors.Is(err, git.NoErrAlreadyUpToDate) {
+			return fmt.Errorf("unable to fetch repo: %w", asHostKeyVerificationError(opts.URL, err))
+		}
+	}
+
+	// This also marks the mirror as used just now.
+	return os.WriteFile(record, []byte(fingerprint), 0600)
+}
+
+// evict removes the least recently used mirrors until the total size of the mirrors is within the
+// limit. Mirrors in use are never removed.
+func (c *gitMirrorCache) evict() {
+	entries, err := os.ReadDir(c.dir)
+	if err != nil {
+		log.Error(err, "Failed to list git mirrors", "dir", c.dir)
+		return
+	}
+	type mirror struct {
+		dir      string
+		size     int64
+		lastUsed time.Time
+	}
+	var mirrors []mirror
+	var total int64
+	for _, e := range entries {
+		if !e.IsDir() {
+			continue
+		}
+		m := mirror{dir: filepath.Join(c.dir, e.Name())}
+		if info, err := os.Stat(filepath.Join(m.dir, gitMirrorRecordFile)); err == nil {
+			m.lastUsed = info.ModTime()
+		}
+		m.size = dirSize(m.dir)
+		total += m.size
+		mirrors = append(mirrors, m)
+	}
+	if total <= c.sizeLimit {
+		return
+	}
+
+	sort.Slice(mirrors, func(i, j int) bool { return mirrors[i].lastUsed.Before(mirrors[j].lastUsed) })
+	for _, m := range mirrors {
+		if total <= c.sizeLimit {
+			return
+		}
+		l := c.mirrorLock(m.dir)
+		if !l.TryLock() {
+			continue
+		}
+		err := os.RemoveAll(m.dir)
+		l.Unlock()
+		if err != nil {
+			log.Error(err, "Failed to remove git mirror", "dir", m.dir)
+			continue
+		}
+		log.Info("Removed least recently used git mirror to stay within size limit", "dir", m.dir, "size", m.size)
+		total -= m.size
+	}
+}
+
+// dirSize gives the total size of the files under the directory given.
+func dirSize(dir string) int64 {
+	var size int64
+	_ = filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			// the directory may be changing underneath us; count what can be counted
+			return nil
+		}
+		if info, err := d.Info(); err == nil && !d.IsDir() {
+			size += info.Size()
+		}
+		return nil
+	})
+	return size
+}
@@ -0,0 +1,127 @@
+// Copyright 2024, Pulumi Corporation.  All rights reserved.
+
+package stack
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/pulumi/pulumi-kubernetes-operator/pkg/apis/pulumi/shared"
+	"github.com/pulumi/pulumi-kubernetes-operator/pkg/logging"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/plumbing/transport"
+	"github.com/pulumi/pulumi/sdk/v3/go/auto"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+// newTestRepo makes a repository with a project in it, and returns its directory and a func to
+// commit a new version of the project.
+func newTestRepo(t *testing.T) (string, func(content string) plumbing.Hash) {
+	repoDir := t.TempDir()
+	repo, err := git.PlainInit(repoDir, false)
+	require.NoError(t, err)
+	w, err := repo.Worktree()
+	require.NoError(t, err)
+	sig := &object.Signature{Name: "Test", Email: "test@example.com", When: time.Now()}
+	return repoDir, func(content string) plumbing.Hash {
+		require.NoError(t, os.WriteFile(filepath.Join(repoDir, "Pulumi.yaml"), []byte(content), 0600))
+		_, err := w.Add("Pulumi.yaml")
+		require.NoError(t, err)
+		hash, err := w.Commit(content, &git.CommitOptions{Author: sig})
+		require.NoError(t, err)
+		return hash
+	}
+}
+
+func TestCloneGitSourceFromMirror(t *testing.T) {
+	logger := logging.NewLogger(t.Name(), "Request.Test", "TestCloneGitSourceFromMirror")
+	client := fake.NewFakeClientWithScheme(scheme.Scheme)
+	mirrors := newGitMirrorCache(t.TempDir(), 1<<30)
+
+	repoDir, commit := newTestRepo(t)
+	first := commit("name: first")
+
+	clone := func() (string, *git.Repository) {
+		sess := newReconcileStackSession(logger, shared.StackSpec{}, client, namespace)
+		sess.rootDir = t.TempDir()
+		sess.gitMirrors = mirrors
+		_, err := sess.MakeWorkspaceDir()
+		require.NoError(t, err)
+		dir, err := sess.CloneGitSource(context.TODO(), nil, hostKeyPolicy{}, &shared.GitSource{ProjectRepo: repoDir})
+		require.NoError(t, err)
+		revision, err := revisionAtWorkingDir(dir)
+		require.NoError(t, err)
+		repo, err := git.PlainOpen(dir)
+		require.NoError(t, err)
+		return revision, repo
+	}
+
+	revision, repo := clone()
+	assert.Equal(t, first.String(), revision)
+	assert.True(t, isGitMirror(mirrors.mirrorDir(repoDir)), "mirror is made")
+
+	// the clone looks as though it came from the repository itself
+	remote, err := repo.Remote("origin")
+	require.NoError(t, err)
+	assert.Equal(t, []string{repoDir}, remote.Config().URLs)
+
+	// a later commit is fetched into the mirror
+	second := commit("name: second")
+	revision, _ = clone()
+	assert.Equal(t, second.String(), revision)
+}
+
+func TestGitMirrorCredentialsChange(t *testing.T) {
+	mirrors := newGitMirrorCache(t.TempDir(), 1<<30)
+	repoDir, commit := newTestRepo(t)
+	commit("name: first")
+
+	opts := &git.CloneOptions{RemoteName: "origin", URL: repoDir}
+	fingerprint := gitCredentialsFingerprint(&auto.GitAuth{PersonalAccessToken: "one"}, transport.ProxyOptions{}, nil)
+	_, err := mirrors.clone(context.TODO(), t.TempDir(), opts, fingerprint)
+	require.NoError(t, err)
+	marker := filepath.Join(mirrors.mirrorDir(repoDir), "marker")
+	require.NoError(t, os.WriteFile(marker, nil, 0600))
+
+	// the same credentials use the same mirror
+	_, err = mirrors.clone(context.TODO(), t.TempDir(), opts, fingerprint)
+	require.NoError(t, err)
+	assert.FileExists(t, marker)
+
+	// other credentials get a fresh mirror
+	fingerprint2 := gitCredentialsFingerprint(&auto.GitAuth{PersonalAccessToken: "two"}, transport.ProxyOptions{}, nil)
+	assert.NotEqual(t, fingerprint, fingerprint2)
+	_, err = mirrors.clone(context.TODO(), t.TempDir(), opts, fingerprint2)
+	require.NoError(t, err)
+	assert.NoFileExists(t, marker)
+	recorded, err := os.ReadFile(filepath.Join(mirrors.mirrorDir(repoDir), gitMirrorRecordFile))
+	require.NoError(t, err)
+	assert.Equal(t, fingerprint2, string(recorded))
+}
+
+func TestGitMirrorEviction(t *testing.T) {
+	// any mirror at all is over the limit, so only the one in use is kept
+	mirrors := newGitMirrorCache(t.TempDir(), 1)
+	repoA, commitA := newTestRepo(t)
+	commitA("name: a")
+	repoB, commitB := newTestRepo(t)
+	commitB("name: b")
+
+	_, err := mirrors.clone(context.TODO(), t.TempDir(), &git.CloneOptions{RemoteName: "origin", URL: repoA}, "")
+	require.NoError(t, err)
+	assert.DirExists(t, mirrors.mirrorDir(repoA))
+
+	_, err = mirrors.clone(context.TODO(), t.TempDir(), &git.CloneOptions{RemoteName: "origin", URL: repoB}, "")
+	require.NoError(t, err)
+	assert.NoDirExists(t, mirrors.mirrorDir(repoA), "least recently used mirror is evicted")
+	assert.DirExists(t, mirrors.mirrorDir(repoB), "mirror in use is kept")
+}
@@ -0,0 +1,126 @@
+// Copyright 2024, Pulumi Corporation.  All rights reserved.
+
+package stack
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/transport"
+	"github.com/pulumi/pulumi/sdk/v3/go/auto"
+	gossh "golang.org/x/crypto/ssh"
+)
+
+// maxSubmoduleDepth limits how deeply submodules are nested, as git does by default.
+const maxSubmoduleDepth = int(git.DefaultSubmoduleRecursionDepth)
+
+// submoduleFetch holds what's needed to fetch the submodules of a repository.
+type submoduleFetch struct {
+	// remote and auth are those of the repository cloned, which are used for submodules on the
+	// same host.
+	remote *gitRemote
+	auth   transport.AuthMethod
+	// gitAuth gives the credentials from which to make the auth for submodules on other hosts.
+	gitAuth         *auto.GitAuth
+	hostKeyCallback gossh.HostKeyCallback
+	fetch           git.FetchOptions
+}
+
+// updateSubmodules initialises the submodules of the repository, fetches the commits recorded for
+// them, and checks them out, then does the same for their submodules in turn.
+func updateSubmodules(ctx context.Context, repo *git.Repository, f submoduleFetch, depth int) error {
+	if depth > maxSubmoduleDepth {
+		return fmt.Errorf("submodules are nested more than %d deep", maxSubmoduleDepth)
+	}
+	w, err := repo.Worktree()
+	if err != nil {
+		return err
+	}
+	subs, err := w.Submodules()
+	if err != nil {
+		return fmt.Errorf("reading submodules: %w", err)
+	}
+	for _, sub := range subs {
+		name := sub.Config().Name
+		if err := sub.Init(); err != nil && !errors.Is(err, git.ErrSubmoduleAlreadyInitialized) {
+			return fmt.Errorf("initialising submodule %s: %w", name, err)
+		}
+		status, err := sub.Status()
+		if err != nil {
+			return fmt.Errorf("reading status of submodule %s: %w", name, err)
+		}
+		subRepo, err := sub.Repository()
+		if err != nil {
+			return fmt.Errorf("opening submodule %s: %w", name, err)
+		}
+		subFetch, err := f.forSubmodule(sub.Config().URL)
+		if err != nil {
+			return fmt.Errorf("submodule %s: %w", name, err)
+		}
+		if err := fetchSubmoduleCommit(ctx, subRepo, subFetch, status.Expected); err != nil {
+			return fmt.Errorf("fetching submodule %s: %w", name, asHostKeyVerificationError(sub.Config().URL, err))
+		}
+		subWorktree, err := subRepo.Worktree()
+		if err != nil {
+			return err
+		}
+		if err := subWorktree.Checkout(&git.CheckoutOptions{Hash: status.Expected, Force: true}); err != nil {
+			return fmt.Errorf("checking out submodule %s: %w", name, err)
+		}
+		if err := updateSubmodules(ctx, subRepo, subFetch, depth+1); err != nil {
+			return fmt.Errorf("submodule %s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// fetchSubmoduleCommit fetches the branches of the submodule's repository and, if that doesn't
+// bring the commit wanted, the commit itself.
+func fetchSubmoduleCommit(ctx context.Context, repo *git.Repository, f submoduleFetch, hash plumbing.Hash) error {
+	opts := f.fetch
+	opts.Auth = f.auth
+	err := repo.FetchContext(ctx, &opts)
+	if err != nil && !errors.Is(err, git.NoErrAlreadyUpToDate) {
+		return err
+	}
+	if _, err := repo.CommitObject(hash); err == nil {
+		return nil
+	}
+	opts.RefSpecs = []config.RefSpec{config.RefSpec("+" + hash.String() + ":" + hash.String())}
+	err = repo.FetchContext(ctx, &opts)
+	if err != nil && !errors.Is(err, git.NoErrAlreadyUpToDate) && !errors.Is(err, git.ErrExactSHA1NotSupported) {
+		return err
+	}
+	return nil
+}
+
+// forSubmodule gives how to fetch the submodule with the URL given. A relative URL is taken
+// relative to the repository, as git does.
+func (f submoduleFetch) forSubmodule(url string) (submoduleFetch, error) {
+	if strings.HasPrefix(url, "./") || strings.HasPrefix(url, "../") {
+		return f, nil
+	}
+	remote, err := parseGitRemote(url)
+	if err != nil {
+		return f, err
+	}
+	sub := f
+	sub.remote = remote
+	switch {
+	case remote.Host == f.remote.Host && remote.IsSSH() == f.remote.IsSSH():
+		// the same credentials are used on the same host
+	case f.gitAuth == nil || (f.gitAuth.SSHPrivateKey != "") != remote.IsSSH():
+		// the credentials given don't suit the submodule's URL
+		sub.auth = nil
+	default:
+		if sub.auth, err = gitTransportAuth(remote, f.gitAuth, f.hostKeyCallback); err != nil {
+			return f, err
+		}
+	}
+	return sub, nil
+}
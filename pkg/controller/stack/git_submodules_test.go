@@ -0,0 +1,154 @@
+// Copyright 2024, Pulumi Corporation.  All rights reserved.
+
+package stack
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/filemode"
+	"github.com/go-git/go-git/v5/plumbing/format/index"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/plumbing/transport/http"
+	"github.com/pulumi/pulumi/sdk/v3/go/auto"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	"github.com/pulumi/pulumi-kubernetes-operator/pkg/apis/pulumi/shared"
+	"github.com/pulumi/pulumi-kubernetes-operator/pkg/logging"
+)
+
+// addSubmodule commits a submodule at the path given, at the commit given of the repository at
+// the URL given.
+func addSubmodule(t *testing.T, repoDir, path, url string, hash plumbing.Hash) {
+	repo, err := git.PlainOpen(repoDir)
+	require.NoError(t, err)
+	w, err := repo.Worktree()
+	require.NoError(t, err)
+	gitmodules := fmt.Sprintf("[submodule %q]\n\tpath = %s\n\turl = %s\n", path, path, url)
+	require.NoError(t, os.WriteFile(filepath.Join(repoDir, ".gitmodules"), []byte(gitmodules), 0600))
+	_, err = w.Add(".gitmodules")
+	require.NoError(t, err)
+	idx, err := repo.Storer.Index()
+	require.NoError(t, err)
+	idx.Entries = append(idx.Entries, &index.Entry{Name: path, Hash: hash, Mode: filemode.Submodule})
+	require.NoError(t, repo.Storer.SetIndex(idx))
+	sig := &object.Signature{Name: "Test", Email: "test@example.com", When: time.Now()}
+	_, err = w.Commit("add submodule "+path, &git.CommitOptions{Author: sig})
+	require.NoError(t, err)
+}
+
+func TestCloneGitSourceWithSubmodules(t *testing.T) {
+	logger := logging.NewLogger(t.Name(), "Request.Test", "TestCloneGitSourceWithSubmodules")
+	client := fake.NewFakeClientWithScheme(scheme.Scheme)
+
+	// parent -> vendor/lib -> nested
+	nestedDir, commitNested := newTestRepo(t)
+	nested := commitNested("name: nested")
+	libDir, commitLib := newTestRepo(t)
+	commitLib("name: lib")
+	addSubmodule(t, libDir, "nested", nestedDir, nested)
+	lib, err := git.PlainOpen(libDir)
+	require.NoError(t, err)
+	libHead, err := lib.Head()
+	require.NoError(t, err)
+	repoDir, commit := newTestRepo(t)
+	commit("name: first")
+	commit("name: parent")
+	addSubmodule(t, repoDir, "vendor/lib", libDir, libHead.Hash())
+
+	sess := newReconcileStackSession(logger, shared.StackSpec{}, client, namespace)
+	sess.rootDir = t.TempDir()
+	_, err = sess.MakeWorkspaceDir()
+	require.NoError(t, err)
+	dir, err := sess.CloneGitSource(context.TODO(), nil, hostKeyPolicy{}, &shared.GitSource{
+		ProjectRepo:     repoDir,
+		Branch:          "master",
+		FetchDepth:      1,
+		FetchSubmodules: true,
+	})
+	require.NoError(t, err)
+
+	b, err := os.ReadFile(filepath.Join(dir, "vendor", "lib", "Pulumi.yaml"))
+	require.NoError(t, err)
+	assert.Equal(t, "name: lib", string(b))
+	b, err = os.ReadFile(filepath.Join(dir, "vendor", "lib", "nested", "Pulumi.yaml"))
+	require.NoError(t, err)
+	assert.Equal(t, "name: nested", string(b))
+
+	repo, err := git.PlainOpen(dir)
+	require.NoError(t, err)
+	shallow, err := repo.Storer.Shallow()
+	require.NoError(t, err)
+	assert.NotEmpty(t, shallow, "clone is shallow")
+
+	// a workspace with submodules isn't kept for the next run
+	sess.CleanupWorkspaceDir()
+	assert.NoDirExists(t, sess.getRetainedWorkdir())
+}
+
+func TestCloneGitSourceWithoutSubmodules(t *testing.T) {
+	logger := logging.NewLogger(t.Name(), "Request.Test", "TestCloneGitSourceWithoutSubmodules")
+	client := fake.NewFakeClientWithScheme(scheme.Scheme)
+	libDir, commitLib := newTestRepo(t)
+	lib := commitLib("name: lib")
+	repoDir, commit := newTestRepo(t)
+	commit("name: parent")
+	addSubmodule(t, repoDir, "lib", libDir, lib)
+
+	sess := newReconcileStackSession(logger, shared.StackSpec{}, client, namespace)
+	sess.rootDir = t.TempDir()
+	_, err := sess.MakeWorkspaceDir()
+	require.NoError(t, err)
+	dir, err := sess.CloneGitSource(context.TODO(), nil, hostKeyPolicy{}, &shared.GitSource{ProjectRepo: repoDir})
+	require.NoError(t, err)
+	assert.NoFileExists(t, filepath.Join(dir, "lib", "Pulumi.yaml"), "submodules are left alone by default")
+
+	repo, err := git.PlainOpen(dir)
+	require.NoError(t, err)
+	shallow, err := repo.Storer.Shallow()
+	require.NoError(t, err)
+	assert.Empty(t, shallow, "clone is full by default")
+}
+
+func TestSubmoduleAuth(t *testing.T) {
+	parent, err := parseGitRemote("https://github.com/example/parent.git")
+	require.NoError(t, err)
+	parentAuth := &gitHubAppAuth{token: "app-token"}
+
+	fetch := func(gitAuth *auto.GitAuth) submoduleFetch {
+		return submoduleFetch{remote: parent, auth: parentAuth, gitAuth: gitAuth}
+	}
+
+	t.Run("relative URL uses the repository's credentials", func(t *testing.T) {
+		sub, err := fetch(nil).forSubmodule("../lib.git")
+		require.NoError(t, err)
+		assert.Equal(t, parentAuth, sub.auth)
+	})
+
+	t.Run("same host uses the repository's credentials", func(t *testing.T) {
+		sub, err := fetch(nil).forSubmodule("https://github.com/example/lib.git")
+		require.NoError(t, err)
+		assert.Equal(t, parentAuth, sub.auth)
+	})
+
+	t.Run("other host uses the credentials given", func(t *testing.T) {
+		sub, err := fetch(&auto.GitAuth{PersonalAccessToken: "pat"}).forSubmodule("https://gitlab.example.com/lib.git")
+		require.NoError(t, err)
+		assert.Equal(t, &http.BasicAuth{Username: "git", Password: "pat"}, sub.auth)
+	})
+
+	t.Run("credentials that don't suit the URL aren't used", func(t *testing.T) {
+		sub, err := fetch(&auto.GitAuth{PersonalAccessToken: "pat"}).forSubmodule("git@gitlab.example.com:group/lib.git")
+		require.NoError(t, err)
+		assert.Nil(t, sub.auth)
+	})
+}
@@ -0,0 +1,377 @@
+// Copyright 2024, Pulumi Corporation.  All rights reserved.
+
+package stack
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/plumbing"
+
+	"github.com/pulumi/pulumi-kubernetes-operator/pkg/apis/pulumi/shared"
+)
+
+// The workspace checked out from a git source is kept between runs of a stack, so that the next
+// run can fetch only what has changed, and keep the project's dependencies if they haven't
+// changed. After a run, the workspace is moved to the directory named by retainedWorkdirName
+// (unless it's kept in the workspace cache instead; see workspace_cache.go). The next run moves it
+// back, sets aside the installed dependencies, fetches the revision wanted, resets the working
+// tree, then puts the dependencies back if the manifests are unchanged. A record kept in the
+// .git directory says which repository and credentials the workspace was checked out with; it's
+// removed while the workspace is being brought up to date, and written again when that's done,
+// so that a workspace left by a run that was stopped part way through is not used. With
+// .spec.persistWorkspace set to false, nothing is kept, and each run starts afresh.
+
+const (
+	retainedWorkdirName = "git-workdir"
+	// gitWorkdirRecordFile is the name of the record, within the .git directory.
+	gitWorkdirRecordFile = "pulumi-operator-workdir.json"
+	// setAsideDependenciesDir is the directory, within the .git directory, into which installed
+	// dependencies are moved while the workspace is reset.
+	setAsideDependenciesDir = "pulumi-operator-dependencies"
+)
+
+// dependencyManifests are the files which, if changed, mean the project's dependencies must be
+// installed afresh.
+var dependencyManifests = []string{
+	"package.json", "package-lock.json", "npm-shrinkwrap.json", "yarn.lock", "pnpm-lock.yaml",
+	"requirements.txt", "Pipfile", "Pipfile.lock", "poetry.lock", "pyproject.toml",
+}
+
+// gitWorkdirRecord describes a workspace checked out from a git source.
+type gitWorkdirRecord struct {
+	// URL is the URL of the repository.
+	URL string `json:"url"`
+	// CredentialsFingerprint is a digest of the credentials, proxy and CA bundle used to fetch from
+	// the repository; see gitCredentialsFingerprint.
+	CredentialsFingerprint string `json:"credentialsFingerprint"`
+	// RepoDir is the directory of the project within the repository.
+	RepoDir string `json:"repoDir"`
+	// FetchDepth is the depth to which the repository was fetched, or zero if it was fetched in
+	// full.
+	FetchDepth int `json:"fetchDepth,omitempty"`
+	// Dependencies is a digest of the dependency manifests in the project directory when its
+	// dependencies were last installed, or empty if they haven't been.
+	Dependencies string `json:"dependencies,omitempty"`
+}
+
+func gitWorkdirRecordPath(workdir string) string {
+	return filepath.Join(workdir, git.GitDirName, gitWorkdirRecordFile)
+}
+
+func readGitWorkdirRecord(workdir string) (*gitWorkdirRecord, bool) {
+	b, err := os.ReadFile(gitWorkdirRecordPath(workdir))
+	if err != nil {
+		return nil, false
+	}
+	var record gitWorkdirRecord
+	if err := json.Unmarshal(b, &record); err != nil {
+		return nil, false
+	}
+	return &record, true
+}
+
+func writeGitWorkdirRecord(workdir string, record *gitWorkdirRecord) error {
+	b, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(gitWorkdirRecordPath(workdir), b, 0600)
+}
+
+// persistWorkspace reports whether the stack's workspace is kept between runs, which it is unless
+// .spec.persistWorkspace is false.
+func persistWorkspace(spec *shared.StackSpec) bool {
+	return spec.PersistWorkspace == nil || *spec.PersistWorkspace
+}
+
+func (sess *reconcileStackSession) getRetainedWorkdir() string {
+	return filepath.Join(sess.rootDir, retainedWorkdirName)
+}
+
+// retainWorkdir keeps the directory given for the next run, if it's a git workspace with a
+// record and the workspace is to be kept, replacing any kept before; otherwise, it removes the
+// directory.
+func (sess *reconcileStackSession) retainWorkdir(dir string) {
+	if _, ok := readGitWorkdirRecord(dir); ok && persistWorkspace(&sess.stack) {
+		retained := sess.getRetainedWorkdir()
+		if err := os.RemoveAll(retained); err == nil {
+			if err = os.Rename(dir, retained); err == nil {
+				sess.logger.Debug("Keeping git workspace for next run", "workspace", retained)
+				return
+			}
+		}
+	}
+	if err := os.RemoveAll(dir); err != nil {
+		sess.logger.Error(err, "Failed to delete workspace dir: %s", dir)
+	}
+}
+
+// reuseGitWorkdir brings the workspace kept from the last run up to date with the source, and
+// returns it as the repository in the workspace directory. If there's no workspace kept, or it was
+// checked out from another repository, with other credentials or to another depth, or it can't be
+// brought up to date, nil is returned and the repository should be cloned afresh. An error is
+// returned only if fetching failed in a way that cloning would too (e.g., the credentials were
+// refused).
+func (sess *reconcileStackSession) reuseGitWorkdir(ctx context.Context, opts *git.CloneOptions, fingerprint string, source *shared.GitSource) (*git.Repository, error) {
+	retained := sess.getRetainedWorkdir()
+	record, ok := readGitWorkdirRecord(retained)
+	if !ok || !persistWorkspace(&sess.stack) || record.URL != opts.URL || record.CredentialsFingerprint != fingerprint || record.FetchDepth != source.FetchDepth {
+		if err := os.RemoveAll(retained); err != nil {
+			return nil, err
+		}
+		return nil, nil
+	}
+
+	// From here, the workspace is being changed, so it's unusable unless this completes.
+	if err := os.Remove(gitWorkdirRecordPath(retained)); err != nil {
+		return nil, err
+	}
+	workspaceDir := sess.getWorkspaceDir()
+	if err := os.RemoveAll(workspaceDir); err != nil {
+		return nil, err
+	}
+	if err := os.Rename(retained, workspaceDir); err != nil {
+		return nil, err
+	}
+	if err := setAsideDependencies(workspaceDir, record.RepoDir); err != nil {
+		return nil, err
+	}
+
+	repo, err := sess.updateGitWorkdir(ctx, workspaceDir, opts, fingerprint, source)
+	if err != nil {
+		if isGitAuthenticationError(err) || isHostKeyVerificationError(err) || isTLSVerificationError(err) {
+			return nil, err
+		}
+		sess.logger.Info("Unable to bring git workspace up to date; cloning afresh", "Error", err.Error())
+		if err := os.RemoveAll(workspaceDir); err != nil {
+			return nil, err
+		}
+		if err := os.MkdirAll(workspaceDir, 0700); err != nil {
+			return nil, err
+		}
+		return nil, nil
+	}
+
+	sess.gitWorkdir = record
+	return repo, nil
+}
+
+// setAsideDependencies moves the directories holding the project's installed dependencies into the
+// .git directory of the workspace, since resetting the working tree would remove them.
+func setAsideDependencies(workspaceDir, repoDir string) error {
+	projectDir := filepath.Join(workspaceDir, repoDir)
+	aside := filepath.Join(workspaceDir, git.GitDirName, setAsideDependenciesDir)
+	if err := os.RemoveAll(aside); err != nil {
+		return err
+	}
+	for _, dir := range dependencyDirs(projectDir) {
+		from, to := filepath.Join(projectDir, dir), filepath.Join(aside, dir)
+		if _, err := os.Stat(from); os.IsNotExist(err) {
+			continue
+		}
+		if err := os.MkdirAll(filepath.Dir(to), 0700); err != nil {
+			return err
+		}
+		if err := os.Rename(from, to); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// restoreDependencies puts back the dependencies set aside before the workspace was reset, if the
+// dependency manifests are unchanged; otherwise, it removes them so that they're installed afresh,
+// without anything left from the old manifests.
+func (sess *reconcileStackSession) restoreDependencies(workspaceDir string, source *shared.GitSource) error {
+	aside := filepath.Join(workspaceDir, git.GitDirName, setAsideDependenciesDir)
+	defer os.RemoveAll(aside)
+
+	record := sess.gitWorkdir
+	projectDir := filepath.Join(workspaceDir, source.RepoDir)
+	deps, err := dependenciesDigest(projectDir)
+	if err != nil || deps == "" || record.RepoDir != source.RepoDir || deps != record.Dependencies {
+		record.Dependencies = ""
+		return nil
+	}
+	for _, dir := range dependencyDirs(projectDir) {
+		from, to := filepath.Join(aside, dir), filepath.Join(projectDir, dir)
+		if _, err := os.Stat(from); os.IsNotExist(err) {
+			continue
+		}
+		if err := os.MkdirAll(filepath.Dir(to), 0700); err != nil {
+			return err
+		}
+		if err := os.Rename(from, to); err != nil {
+			return err
+		}
+	}
+	sess.logger.Debug("Dependency manifests unchanged; keeping installed dependencies")
+	sess.reusedWorkspace = true
+	return nil
+}
+
+// updateGitWorkdir fetches the revision wanted into the repository in the directory given, then
+// resets the working tree to it and removes any files that aren't part of it.
+func (sess *reconcileStackSession) updateGitWorkdir(ctx context.Context, dir string, opts *git.CloneOptions, fingerprint string, source *shared.GitSource) (*git.Repository, error) {
+	repo, err := git.PlainOpen(dir)
+	if err != nil {
+		return nil, fmt.Errorf("opening git workspace: %w", err)
+	}
+
+	fetchOpts := &git.FetchOptions{
+		RemoteName:      opts.RemoteName,
+		Auth:            opts.Auth,
+		ProxyOptions:    opts.ProxyOptions,
+		CABundle:        opts.CABundle,
+		InsecureSkipTLS: opts.InsecureSkipTLS,
+		Depth:           source.FetchDepth,
+		Force:           true,
+	}
+	var target plumbing.ReferenceName
+	switch {
+	case source.Branch != "":
+		branch, err := gitReferenceName(source.Branch)
+		if err != nil {
+			return nil, err
+		}
+		target = plumbing.NewRemoteReferenceName(opts.RemoteName, branch.Short())
+		fetchOpts.RefSpecs = []config.RefSpec{config.RefSpec(fmt.Sprintf("+%s:%s", branch, target))}
+	case source.Tag != "":
+		if target, err = gitTagReferenceName(source.Tag); err != nil {
+			return nil, err
+		}
+		fetchOpts.RefSpecs = []config.RefSpec{config.RefSpec(fmt.Sprintf("+%s:%s", target, target))}
+	default:
+		// All branches are fetched, in case they include the commit wanted; with no commit either,
+		// the branch that was checked out when the repository was cloned is used.
+		fetchOpts.RefSpecs = []config.RefSpec{config.RefSpec(fmt.Sprintf("+refs/heads/*:refs/remotes/%s/*", opts.RemoteName))}
+		fetchOpts.Tags = git.AllTags
+		if source.Commit == "" {
+			head, err := repo.Reference(plumbing.HEAD, false)
+			if err != nil {
+				return nil, err
+			}
+			if head.Type() != plumbing.SymbolicReference || !head.Target().IsBranch() {
+				return nil, errors.New("git workspace has no branch checked out")
+			}
+			target = plumbing.NewRemoteReferenceName(opts.RemoteName, head.Target().Short())
+		}
+	}
+
+	if sess.gitMirrors != nil && source.FetchDepth == 0 {
+		err = sess.gitMirrors.fetch(ctx, repo, opts, fetchOpts, fingerprint)
+	} else {
+		err = repo.FetchContext(ctx, fetchOpts)
+	}
+	if err != nil && !errors.Is(err, git.NoErrAlreadyUpToDate) {
+		return nil, fmt.Errorf("unable to fetch repo: %w", asHostKeyVerificationError(opts.URL, err))
+	}
+
+	if source.Commit != "" {
+		// the caller fetches the commit if need be, and resets the working tree to it
+		return repo, nil
+	}
+	ref, err := repo.Reference(target, true)
+	if err != nil {
+		return nil, fmt.Errorf("resolving %s: %w", target, err)
+	}
+	hash := ref.Hash()
+	if tag, err := repo.TagObject(hash); err == nil {
+		// an annotated tag; check out the commit it points to
+		commit, err := tag.Commit()
+		if err != nil {
+			return nil, err
+		}
+		hash = commit.Hash
+	}
+	return repo, resetGitWorkdir(repo, hash)
+}
+
+// resetGitWorkdir resets the working tree of the repository to the commit given, and removes files
+// that aren't in the commit. Note that go-git's hard reset removes untracked files, including those
+// ignored, so this also removes the stack settings file written by the last run, if it's not in the
+// repository; installed dependencies must be set aside beforehand to keep them.
+func resetGitWorkdir(repo *git.Repository, hash plumbing.Hash) error {
+	w, err := repo.Worktree()
+	if err != nil {
+		return err
+	}
+	if err := w.Reset(&git.ResetOptions{Commit: hash, Mode: git.HardReset}); err != nil {
+		return fmt.Errorf("resetting git workspace: %w", err)
+	}
+	if err := w.Clean(&git.CleanOptions{Dir: true}); err != nil {
+		return fmt.Errorf("cleaning git workspace: %w", err)
+	}
+	return nil
+}
+
+// dependenciesDigest hashes the dependency manifests in the project directory. It returns an
+// empty string if there are none.
+func dependenciesDigest(projectDir string) (string, error) {
+	h := sha256.New()
+	found := false
+	for _, name := range dependencyManifests {
+		f, err := os.Open(filepath.Join(projectDir, name))
+		if os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			return "", err
+		}
+		found = true
+		fmt.Fprintf(h, "%s\x00", name)
+		_, err = io.Copy(h, f)
+		f.Close()
+		if err != nil {
+			return "", err
+		}
+	}
+	if !found {
+		return "", nil
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// dependencyDirs gives the directories, relative to the project directory, into which the
+// project's dependencies are installed.
+func dependencyDirs(projectDir string) []string {
+	dirs := []string{"node_modules"}
+	if _, options, err := readProjectRuntime(projectDir); err == nil {
+		if venv, _ := options["virtualenv"].(string); venv != "" && !filepath.IsAbs(venv) {
+			dirs = append(dirs, venv)
+		}
+	}
+	return dirs
+}
+
+// recordGitWorkdir writes the record for the git workspace, once it's been checked out, so that
+// it can be kept for the next run.
+func (sess *reconcileStackSession) recordGitWorkdir(record *gitWorkdirRecord) error {
+	sess.gitWorkdir = record
+	return writeGitWorkdirRecord(sess.getWorkspaceDir(), record)
+}
+
+// recordDependenciesInstalled notes in the record for the git workspace that the project's
+// dependencies have been installed, so they can be kept if the manifests don't change.
+func (sess *reconcileStackSession) recordDependenciesInstalled() {
+	if sess.gitWorkdir == nil {
+		return
+	}
+	deps, err := dependenciesDigest(filepath.Join(sess.getWorkspaceDir(), sess.gitWorkdir.RepoDir))
+	if err != nil {
+		return
+	}
+	sess.gitWorkdir.Dependencies = deps
+	if err := writeGitWorkdirRecord(sess.getWorkspaceDir(), sess.gitWorkdir); err != nil {
+		sess.logger.Info("Unable to record installed dependencies", "Error", err.Error())
+	}
+}
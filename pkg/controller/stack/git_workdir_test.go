@@ -0,0 +1,179 @@
+// Copyright 2024, Pulumi Corporation.  All rights reserved.
+
+package stack
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	"github.com/pulumi/pulumi-kubernetes-operator/pkg/apis/pulumi/shared"
+	"github.com/pulumi/pulumi-kubernetes-operator/pkg/logging"
+)
+
+// commitFiles commits the files given to the repository in the directory.
+func commitFiles(t *testing.T, repoDir string, files map[string]string) {
+	repo, err := git.PlainOpen(repoDir)
+	require.NoError(t, err)
+	w, err := repo.Worktree()
+	require.NoError(t, err)
+	for name, content := range files {
+		require.NoError(t, os.WriteFile(filepath.Join(repoDir, name), []byte(content), 0600))
+		_, err := w.Add(name)
+		require.NoError(t, err)
+	}
+	sig := &object.Signature{Name: "Test", Email: "test@example.com", When: time.Now()}
+	_, err = w.Commit("update", &git.CommitOptions{Author: sig})
+	require.NoError(t, err)
+}
+
+// installDependencies pretends to install the project's dependencies.
+func installDependencies(t *testing.T, dir string) {
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "node_modules", "left-pad"), 0700))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "node_modules", "left-pad", "index.js"), nil, 0600))
+}
+
+func TestCloneGitSourceReusesWorkdir(t *testing.T) {
+	logger := logging.NewLogger(t.Name(), "Request.Test", "TestCloneGitSourceReusesWorkdir")
+	client := fake.NewFakeClientWithScheme(scheme.Scheme)
+	rootDir := t.TempDir()
+
+	repoDir, _ := newTestRepo(t)
+	commitFiles(t, repoDir, map[string]string{
+		"Pulumi.yaml":  "name: first\nruntime: nodejs\n",
+		"package.json": `{"dependencies": {"left-pad": "1.0.0"}}`,
+		".gitignore":   "node_modules/\n",
+	})
+
+	// clone runs the git source as a reconciliation would, up to installing dependencies, and
+	// returns the session and project directory.
+	clone := func(spec shared.StackSpec) (*reconcileStackSession, string) {
+		sess := newReconcileStackSession(logger, spec, client, namespace)
+		sess.rootDir = rootDir
+		_, err := sess.MakeWorkspaceDir()
+		require.NoError(t, err)
+		dir, err := sess.CloneGitSource(context.TODO(), nil, hostKeyPolicy{}, spec.GitSource)
+		require.NoError(t, err)
+		return sess, dir
+	}
+	source := &shared.GitSource{ProjectRepo: repoDir}
+	spec := shared.StackSpec{Stack: "dev", GitSource: source}
+
+	sess, dir := clone(spec)
+	assert.False(t, sess.reusedWorkspace)
+	// simulate installing dependencies, and leaving things behind
+	installDependencies(t, dir)
+	sess.recordDependenciesInstalled()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "stray.txt"), nil, 0600))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "Pulumi.dev.yaml"), []byte("config: {}"), 0600))
+	sess.CleanupWorkspaceDir()
+	assert.NoDirExists(t, sess.getWorkspaceDir())
+	assert.DirExists(t, sess.getRetainedWorkdir(), "workspace is kept")
+
+	// a new commit is fetched; the dependencies are kept since the manifests haven't changed
+	commitFiles(t, repoDir, map[string]string{"Pulumi.yaml": "name: second\nruntime: nodejs\n"})
+	sess, dir = clone(spec)
+	assert.True(t, sess.reusedWorkspace, "dependencies are kept")
+	b, err := os.ReadFile(filepath.Join(dir, "Pulumi.yaml"))
+	require.NoError(t, err)
+	assert.Contains(t, string(b), "name: second")
+	assert.DirExists(t, filepath.Join(dir, "node_modules", "left-pad"))
+	assert.NoFileExists(t, filepath.Join(dir, "stray.txt"), "untracked files are removed")
+	assert.NoFileExists(t, filepath.Join(dir, "Pulumi.dev.yaml"), "stack settings from the last run are removed")
+	sess.CleanupWorkspaceDir()
+
+	// a change to the manifests means the dependencies are installed afresh
+	commitFiles(t, repoDir, map[string]string{"package.json": `{"dependencies": {"left-pad": "1.1.0"}}`})
+	sess, dir = clone(spec)
+	assert.False(t, sess.reusedWorkspace)
+	assert.NoDirExists(t, filepath.Join(dir, "node_modules"))
+	installDependencies(t, dir)
+	sess.recordDependenciesInstalled()
+	sess.CleanupWorkspaceDir()
+
+	// a workspace left by a run that was stopped while bringing it up to date isn't used
+	require.NoError(t, os.Remove(gitWorkdirRecordPath(sess.getRetainedWorkdir())))
+	sess, dir = clone(spec)
+	assert.False(t, sess.reusedWorkspace)
+	assert.NoDirExists(t, filepath.Join(dir, "node_modules"), "cloned afresh")
+	sess.recordDependenciesInstalled()
+	sess.CleanupWorkspaceDir()
+
+	// nor is a workspace checked out from another repository
+	otherRepo, _ := newTestRepo(t)
+	commitFiles(t, otherRepo, map[string]string{"Pulumi.yaml": "name: other\nruntime: yaml\n"})
+	sess, dir = clone(shared.StackSpec{Stack: "dev", GitSource: &shared.GitSource{ProjectRepo: otherRepo}})
+	assert.False(t, sess.reusedWorkspace)
+	b, err = os.ReadFile(filepath.Join(dir, "Pulumi.yaml"))
+	require.NoError(t, err)
+	assert.Contains(t, string(b), "name: other")
+	sess.CleanupWorkspaceDir()
+
+	// with persistWorkspace false, the workspace kept isn't used, and nothing is kept after
+	noPersist := false
+	spec.PersistWorkspace = &noPersist
+	sess, _ = clone(spec)
+	assert.False(t, sess.reusedWorkspace)
+	assert.NoDirExists(t, sess.getRetainedWorkdir())
+	sess.CleanupWorkspaceDir()
+	assert.NoDirExists(t, sess.getWorkspaceDir())
+	assert.NoDirExists(t, sess.getRetainedWorkdir(), "workspace is not kept")
+}
+
+func TestCloneGitSourceDiscardsCorruptWorkdir(t *testing.T) {
+	logger := logging.NewLogger(t.Name(), "Request.Test", "TestCloneGitSourceDiscardsCorruptWorkdir")
+	client := fake.NewFakeClientWithScheme(scheme.Scheme)
+	repoDir, commit := newTestRepo(t)
+	head := commit("name: first\nruntime: yaml\n")
+
+	sess := newReconcileStackSession(logger, shared.StackSpec{}, client, namespace)
+	sess.rootDir = t.TempDir()
+	source := &shared.GitSource{ProjectRepo: repoDir}
+	_, err := sess.MakeWorkspaceDir()
+	require.NoError(t, err)
+	_, err = sess.CloneGitSource(context.TODO(), nil, hostKeyPolicy{}, source)
+	require.NoError(t, err)
+	sess.CleanupWorkspaceDir()
+
+	// lose the objects, but keep the record
+	require.NoError(t, os.RemoveAll(filepath.Join(sess.getRetainedWorkdir(), ".git", "objects")))
+
+	_, err = sess.MakeWorkspaceDir()
+	require.NoError(t, err)
+	dir, err := sess.CloneGitSource(context.TODO(), nil, hostKeyPolicy{}, source)
+	require.NoError(t, err)
+	revision, err := revisionAtWorkingDir(dir)
+	require.NoError(t, err)
+	assert.Equal(t, head.String(), revision)
+}
+
+func TestDependenciesDigest(t *testing.T) {
+	dir := t.TempDir()
+	digest, err := dependenciesDigest(dir)
+	require.NoError(t, err)
+	assert.Empty(t, digest, "no manifests")
+
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "requirements.txt"), []byte("pulumi>=3\n"), 0600))
+	first, err := dependenciesDigest(dir)
+	require.NoError(t, err)
+	assert.NotEmpty(t, first)
+
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "Pulumi.yaml"), []byte("name: p\nruntime: python\n"), 0600))
+	same, err := dependenciesDigest(dir)
+	require.NoError(t, err)
+	assert.Equal(t, first, same, "other files don't count")
+
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "requirements.txt"), []byte("pulumi>=3.1\n"), 0600))
+	changed, err := dependenciesDigest(dir)
+	require.NoError(t, err)
+	assert.NotEqual(t, first, changed)
+}
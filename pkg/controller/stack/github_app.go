@@ -0,0 +1,236 @@
+// Copyright 2024, Pulumi Corporation.  All rights reserved.
+
+package stack
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// The entries of a gitAuthSecret used to authenticate as a GitHub App installation.
+const (
+	gitHubAppIDKey             = "appID"
+	gitHubAppInstallationIDKey = "installationID"
+	gitHubAppPrivateKeyKey     = "privateKey"
+	// gitHubAppAPIURLKey is optional, and gives the API of a GitHub Enterprise Server.
+	gitHubAppAPIURLKey = "apiURL"
+
+	defaultGitHubAPIURL = "https://api.github.com"
+
+	// gitHubAppTokenMargin is how long before it expires an installation token is replaced, so
+	// that it doesn't expire while in use.
+	gitHubAppTokenMargin = 5 * time.Minute
+)
+
+var (
+	gitHubAPIClient = &http.Client{Timeout: 30 * time.Second}
+
+	// gitHubAppTokens keeps the installation tokens minted, across reconciliations, since each
+	// is good for an hour.
+	gitHubAppTokens = &gitHubAppTokenCache{tokens: map[string]gitHubAppToken{}}
+)
+
+// gitHubApp is a GitHub App installation, as which to authenticate to GitHub.
+type gitHubApp struct {
+	appID          string
+	installationID string
+	privateKey     *rsa.PrivateKey
+	apiURL         string
+	// keyDigest identifies the private key, without keeping a copy of it as a string
+	keyDigest string
+}
+
+// gitHubAppFromSecret reads the GitHub App entries from a gitAuthSecret, returning nil if there
+// are none. Since only one means of authentication can be used, it's an error for the secret to
+// have entries for another as well.
+func gitHubAppFromSecret(data map[string][]byte) (*gitHubApp, error) {
+	_, hasID := data[gitHubAppIDKey]
+	_, hasInstallation := data[gitHubAppInstallationIDKey]
+	_, hasKey := data[gitHubAppPrivateKeyKey]
+	if !hasID && !hasInstallation && !hasKey {
+		return nil, nil
+	}
+	for _, other := range []string{"sshPrivateKey", "accessToken", "username", "password"} {
+		if _, ok := data[other]; ok {
+			return nil, fmt.Errorf("creating gitAuth: GitHub App entries (%s, %s, %s) cannot be used along with '%s'",
+				gitHubAppIDKey, gitHubAppInstallationIDKey, gitHubAppPrivateKeyKey, other)
+		}
+	}
+	if !hasID || !hasInstallation || !hasKey {
+		return nil, fmt.Errorf("creating gitAuth: GitHub App authentication needs all of '%s', '%s' and '%s'",
+			gitHubAppIDKey, gitHubAppInstallationIDKey, gitHubAppPrivateKeyKey)
+	}
+
+	keyPEM := data[gitHubAppPrivateKeyKey]
+	key, err := parseRSAPrivateKey(keyPEM)
+	if err != nil {
+		return nil, fmt.Errorf("creating gitAuth: reading GitHub App private key: %w", err)
+	}
+	digest := sha256.Sum256(keyPEM)
+	app := &gitHubApp{
+		appID:          strings.TrimSpace(string(data[gitHubAppIDKey])),
+		installationID: strings.TrimSpace(string(data[gitHubAppInstallationIDKey])),
+		privateKey:     key,
+		apiURL:         defaultGitHubAPIURL,
+		keyDigest:      hex.EncodeToString(digest[:]),
+	}
+	if apiURL, ok := data[gitHubAppAPIURLKey]; ok && len(apiURL) > 0 {
+		app.apiURL = strings.TrimSuffix(strings.TrimSpace(string(apiURL)), "/")
+	}
+	return app, nil
+}
+
+// parseRSAPrivateKey reads a PEM-encoded RSA key, in either of the forms GitHub has given them out.
+func parseRSAPrivateKey(keyPEM []byte) (*rsa.PrivateKey, error) {
+	block, _ := pem.Decode(keyPEM)
+	if block == nil {
+		return nil, errors.New("no PEM-encoded key found")
+	}
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	rsaKey, ok := key.(*rsa.PrivateKey)
+	if !ok {
+		return nil, errors.New("key is not an RSA key")
+	}
+	return rsaKey, nil
+}
+
+type gitHubAppToken struct {
+	token     string
+	expiresAt time.Time
+}
+
+// gitHubAppTokenCache keeps the installation tokens minted for each app installation.
+type gitHubAppTokenCache struct {
+	mu     sync.Mutex
+	tokens map[string]gitHubAppToken
+}
+
+// token returns an installation token for the app, minting a new one if there isn't one that's
+// good for a while yet.
+func (c *gitHubAppTokenCache) token(ctx context.Context, app *gitHubApp, now time.Time) (string, error) {
+	key := strings.Join([]string{app.apiURL, app.appID, app.installationID, app.keyDigest}, "|")
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if t, ok := c.tokens[key]; ok && t.expiresAt.After(now.Add(gitHubAppTokenMargin)) {
+		return t.token, nil
+	}
+	t, err := app.mintToken(ctx, now)
+	if err != nil {
+		return "", err
+	}
+	c.tokens[key] = t
+	return t.token, nil
+}
+
+// mintToken asks GitHub for an installation token, authenticating as the app with a JWT signed
+// by its private key.
+func (app *gitHubApp) mintToken(ctx context.Context, now time.Time) (gitHubAppToken, error) {
+	jwt, err := app.jwt(now)
+	if err != nil {
+		return gitHubAppToken{}, err
+	}
+	url := fmt.Sprintf("%s/app/installations/%s/access_tokens", app.apiURL, app.installationID)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, nil)
+	if err != nil {
+		return gitHubAppToken{}, err
+	}
+	req.Header.Set("Authorization", "Bearer "+jwt)
+	req.Header.Set("Accept", "application/vnd.github+json")
+	res, err := gitHubAPIClient.Do(req)
+	if err != nil {
+		return gitHubAppToken{}, fmt.Errorf("requesting GitHub App installation token: %w", err)
+	}
+	defer res.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(res.Body, 1<<20))
+	if err != nil {
+		return gitHubAppToken{}, err
+	}
+	if res.StatusCode != http.StatusCreated {
+		var apiErr struct {
+			Message string `json:"message"`
+		}
+		_ = json.Unmarshal(body, &apiErr)
+		return gitHubAppToken{}, fmt.Errorf("requesting GitHub App installation token: %s: %s", res.Status, apiErr.Message)
+	}
+	var created struct {
+		Token     string    `json:"token"`
+		ExpiresAt time.Time `json:"expires_at"`
+	}
+	if err := json.Unmarshal(body, &created); err != nil {
+		return gitHubAppToken{}, fmt.Errorf("reading GitHub App installation token: %w", err)
+	}
+	return gitHubAppToken{token: created.Token, expiresAt: created.ExpiresAt}, nil
+}
+
+// jwt makes the token with which the app authenticates itself, as described in
+// https://docs.github.com/en/apps/creating-github-apps/authenticating-with-a-github-app/generating-a-json-web-token-jwt-for-a-github-app
+func (app *gitHubApp) jwt(now time.Time) (string, error) {
+	header, err := json.Marshal(map[string]string{"alg": "RS256", "typ": "JWT"})
+	if err != nil {
+		return "", err
+	}
+	claims, err := json.Marshal(map[string]interface{}{
+		// backdated, to allow for clock drift
+		"iat": now.Add(-time.Minute).Unix(),
+		// GitHub allows at most ten minutes
+		"exp": now.Add(9 * time.Minute).Unix(),
+		"iss": app.appID,
+	})
+	if err != nil {
+		return "", err
+	}
+	enc := base64.RawURLEncoding
+	signed := enc.EncodeToString(header) + "." + enc.EncodeToString(claims)
+	digest := sha256.Sum256([]byte(signed))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, app.privateKey, crypto.SHA256, digest[:])
+	if err != nil {
+		return "", fmt.Errorf("signing GitHub App JWT: %w", err)
+	}
+	return signed + "." + enc.EncodeToString(sig), nil
+}
+
+// gitHubAppAuth authenticates git requests over HTTP with an installation token, which is replaced
+// as it nears expiry, so that a reconciliation that outlives a token can carry on.
+type gitHubAppAuth struct {
+	app *gitHubApp
+	// token is used if a replacement can't be minted; GitHub will say if it's no longer good.
+	token string
+}
+
+func (a *gitHubAppAuth) SetAuth(r *http.Request) {
+	if token, err := gitHubAppTokens.token(r.Context(), a.app, time.Now()); err == nil {
+		a.token = token
+	} else {
+		log.Error(err, "Failed to refresh GitHub App installation token; using the last one")
+	}
+	r.SetBasicAuth("x-access-token", a.token)
+}
+
+func (a *gitHubAppAuth) Name() string {
+	return "http-github-app-auth"
+}
+
+func (a *gitHubAppAuth) String() string {
+	return fmt.Sprintf("%s - app %s, installation %s", a.Name(), a.app.appID, a.app.installationID)
+}
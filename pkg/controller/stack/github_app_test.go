@@ -0,0 +1,149 @@
+// Copyright 2024, Pulumi Corporation.  All rights reserved.
+
+package stack
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newGitHubAppKey(t *testing.T) (*rsa.PrivateKey, []byte) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	return key, pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+}
+
+func TestGitHubAppFromSecret(t *testing.T) {
+	_, keyPEM := newGitHubAppKey(t)
+	complete := func() map[string][]byte {
+		return map[string][]byte{
+			"appID":          []byte("1234"),
+			"installationID": []byte("5678\n"),
+			"privateKey":     keyPEM,
+		}
+	}
+
+	app, err := gitHubAppFromSecret(map[string][]byte{"accessToken": []byte("token")})
+	require.NoError(t, err)
+	assert.Nil(t, app, "no GitHub App entries")
+
+	app, err = gitHubAppFromSecret(complete())
+	require.NoError(t, err)
+	require.NotNil(t, app)
+	assert.Equal(t, "1234", app.appID)
+	assert.Equal(t, "5678", app.installationID)
+	assert.Equal(t, defaultGitHubAPIURL, app.apiURL)
+
+	data := complete()
+	data["apiURL"] = []byte("https://github.example.com/api/v3/")
+	app, err = gitHubAppFromSecret(data)
+	require.NoError(t, err)
+	assert.Equal(t, "https://github.example.com/api/v3", app.apiURL)
+
+	data = complete()
+	delete(data, "installationID")
+	_, err = gitHubAppFromSecret(data)
+	assert.ErrorContains(t, err, "needs all of")
+
+	for _, other := range []string{"sshPrivateKey", "accessToken", "username", "password"} {
+		data = complete()
+		data[other] = []byte("x")
+		_, err = gitHubAppFromSecret(data)
+		assert.ErrorContains(t, err, "cannot be used along with '"+other+"'")
+	}
+
+	data = complete()
+	data["privateKey"] = []byte("not a key")
+	_, err = gitHubAppFromSecret(data)
+	assert.ErrorContains(t, err, "private key")
+}
+
+func TestGitHubAppTokens(t *testing.T) {
+	key, keyPEM := newGitHubAppKey(t)
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	minted := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodPost, r.Method)
+		assert.Equal(t, "/app/installations/5678/access_tokens", r.URL.Path)
+
+		// the JWT is signed with the app's key, and issued by the app
+		parts := strings.Split(strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer "), ".")
+		require.Len(t, parts, 3)
+		sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+		require.NoError(t, err)
+		digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+		assert.NoError(t, rsa.VerifyPKCS1v15(&key.PublicKey, crypto.SHA256, digest[:], sig))
+		rawClaims, err := base64.RawURLEncoding.DecodeString(parts[1])
+		require.NoError(t, err)
+		var claims struct {
+			Issuer string `json:"iss"`
+		}
+		require.NoError(t, json.Unmarshal(rawClaims, &claims))
+		assert.Equal(t, "1234", claims.Issuer)
+
+		minted++
+		w.WriteHeader(http.StatusCreated)
+		fmt.Fprintf(w, `{"token": "token-%d", "expires_at": %q}`, minted, now.Add(time.Hour).Format(time.RFC3339))
+	}))
+	defer server.Close()
+
+	app, err := gitHubAppFromSecret(map[string][]byte{
+		"appID":          []byte("1234"),
+		"installationID": []byte("5678"),
+		"privateKey":     keyPEM,
+		"apiURL":         []byte(server.URL),
+	})
+	require.NoError(t, err)
+
+	cache := &gitHubAppTokenCache{tokens: map[string]gitHubAppToken{}}
+	token, err := cache.token(context.TODO(), app, now)
+	require.NoError(t, err)
+	assert.Equal(t, "token-1", token)
+
+	// the token is reused while it's good for a while yet
+	token, err = cache.token(context.TODO(), app, now.Add(30*time.Minute))
+	require.NoError(t, err)
+	assert.Equal(t, "token-1", token)
+
+	// and replaced as it nears expiry
+	token, err = cache.token(context.TODO(), app, now.Add(57*time.Minute))
+	require.NoError(t, err)
+	assert.Equal(t, "token-2", token)
+}
+
+func TestGitHubAppTokenError(t *testing.T) {
+	_, keyPEM := newGitHubAppKey(t)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+		fmt.Fprint(w, `{"message": "Not Found"}`)
+	}))
+	defer server.Close()
+
+	app, err := gitHubAppFromSecret(map[string][]byte{
+		"appID":          []byte("1234"),
+		"installationID": []byte("5678"),
+		"privateKey":     keyPEM,
+		"apiURL":         []byte(server.URL),
+	})
+	require.NoError(t, err)
+	cache := &gitHubAppTokenCache{tokens: map[string]gitHubAppToken{}}
+	_, err = cache.token(context.TODO(), app, time.Now())
+	assert.ErrorContains(t, err, "404 Not Found: Not Found")
+}
@@ -0,0 +1,196 @@
+// Copyright 2024, Pulumi Corporation.  All rights reserved.
+
+package stack
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	"github.com/pulumi/pulumi-kubernetes-operator/pkg/apis/pulumi/shared"
+	pulumiv1 "github.com/pulumi/pulumi-kubernetes-operator/pkg/apis/pulumi/v1"
+	"github.com/pulumi/pulumi-kubernetes-operator/version"
+)
+
+// Handover protocol:
+//
+// When the operator starts an update, it records itself as the owner in .status.currentUpdate.
+// If it's stopped part way through (e.g., because the operator deployment is being rolled to a new
+// version), the update may still be running, or may have finished without the status being
+// updated. So, before the instance of the operator which next processes the stack runs an update
+// of its own, it asks the backend what became of the update recorded:
+//
+//   - if the update is still running, it waits for it to finish, for up to handoverTimeout, after
+//     which it takes the update over (and cancelOnConflict can deal with it);
+//   - if the update succeeded, and was for the same generation and revision, the status is
+//     repaired as though the update had been run by this instance, and no update is run;
+//   - otherwise, the record of the update is cleared and the stack is processed as usual.
+
+const (
+	// handoverPollInterval is how often to check on an update started by another instance of the
+	// operator which is still running.
+	handoverPollInterval = 30 * time.Second
+	// handoverTimeout is how long to wait for an update started by another instance of the
+	// operator to finish.
+	handoverTimeout = 10 * time.Minute
+	// handoverClockSkew allows for the clocks of the operator and the backend disagreeing, when
+	// matching an update in the stack's history to the one recorded.
+	handoverClockSkew = time.Minute
+)
+
+// operatorIdentity identifies this instance of the operator. The start time distinguishes a
+// restarted container from its predecessor in the same pod.
+func operatorIdentity(started time.Time) string {
+	name := os.Getenv("POD_NAME")
+	if name == "" {
+		name, _ = os.Hostname()
+	}
+	return fmt.Sprintf("%s/%s/%s", name, version.Version, started.UTC().Format(time.RFC3339))
+}
+
+// backendUpdate summarises the latest update in a stack's history.
+type backendUpdate struct {
+	Result    string
+	StartTime time.Time
+}
+
+type handoverOutcome int
+
+const (
+	// the update recorded was not started by another instance, or it can't be told what became of it
+	handoverNone handoverOutcome = iota
+	// the update didn't get as far as the backend
+	handoverNotStarted
+	// the update is still running
+	handoverRunning
+	// the update is still running, and has been waited on for long enough
+	handoverTakeOver
+	// the update finished, and succeeded
+	handoverSucceeded
+	// the update finished, but didn't succeed
+	handoverFailed
+)
+
+// checkHandover decides what to do about the update recorded, given the latest update in the
+// stack's history (nil if there is none).
+func checkHandover(update *pulumiv1.CurrentStackUpdate, self string, latest *backendUpdate, now time.Time) handoverOutcome {
+	if update == nil || update.Operator == self {
+		return handoverNone
+	}
+	if latest == nil || latest.StartTime.Before(update.StartTime.Add(-handoverClockSkew)) {
+		return handoverNotStarted
+	}
+	switch latest.Result {
+	case "in-progress", "not-started":
+		if update.HandoverTime != nil && now.Sub(update.HandoverTime.Time) >= handoverTimeout {
+			return handoverTakeOver
+		}
+		return handoverRunning
+	case "succeeded":
+		return handoverSucceeded
+	default:
+		return handoverFailed
+	}
+}
+
+// parseHistoryTime parses a time given in the stack's history. The format has varied between
+// versions of the Pulumi CLI.
+func parseHistoryTime(s string) (time.Time, error) {
+	var err error
+	for _, layout := range []string{time.RFC3339Nano, "2006-01-02T15:04:05.000Z0700", "2006-01-02 15:04:05.999999999 -0700 MST"} {
+		var t time.Time
+		if t, err = time.Parse(layout, s); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, err
+}
+
+// latestBackendUpdate gets the latest update in the stack's history, or nil if there's none.
+func (sess *reconcileStackSession) latestBackendUpdate(ctx context.Context) (*backendUpdate, error) {
+	history, err := sess.autoStack.History(ctx, 1 /*pageSize*/, 1 /*page*/)
+	if err != nil {
+		return nil, fmt.Errorf("getting stack history: %w", err)
+	}
+	if len(history) == 0 {
+		return nil, nil
+	}
+	start, err := parseHistoryTime(history[0].StartTime)
+	if err != nil {
+		return nil, fmt.Errorf("parsing start time of update in stack history: %w", err)
+	}
+	return &backendUpdate{Result: history[0].Result, StartTime: start}, nil
+}
+
+// handover deals with an update recorded as started by another instance of the operator, as
+// described above. It returns true if the stack should not be processed further, along with the
+// result to return.
+func (r *ReconcileStack) handover(ctx context.Context, sess *reconcileStackSession, instance *pulumiv1.Stack,
+	currentCommit string, done reconcile.Result) (bool, reconcile.Result, error) {
+	update := instance.Status.CurrentUpdate
+	if update == nil || update.Operator == r.operatorID {
+		return false, reconcile.Result{}, nil
+	}
+	latest, err := sess.latestBackendUpdate(ctx)
+	if err != nil {
+		// carry on; if the update is still running, the attempt to run another will conflict
+		sess.logger.Info("Unable to check on update started by another instance of the operator",
+			"Operator", update.Operator, "Error", err.Error())
+		return false, reconcile.Result{}, nil
+	}
+
+	switch checkHandover(update, r.operatorID, latest, time.Now()) {
+	case handoverRunning:
+		if update.HandoverTime == nil {
+			now := metav1.Now()
+			update.HandoverTime = &now
+		}
+		sess.logger.Info("Waiting for update started by another instance of the operator to finish",
+			"Operator", update.Operator, "StartTime", update.StartTime)
+		instance.Status.MarkReconcilingCondition(pulumiv1.ReconcilingInterruptedUpdateReason,
+			fmt.Sprintf("waiting for update started at %s by %s to finish", update.StartTime.Format(time.RFC3339), update.Operator))
+		return true, reconcile.Result{RequeueAfter: handoverPollInterval}, nil
+	case handoverTakeOver:
+		sess.logger.Info("Update started by another instance of the operator has not finished; taking it over",
+			"Operator", update.Operator, "StartTime", update.StartTime)
+		update.Operator = r.operatorID
+		update.HandoverTime = nil
+	case handoverSucceeded:
+		instance.Status.CurrentUpdate = nil
+		r.emitEvent(instance, pulumiv1.StackUpdateRecoveredEvent(),
+			"Update started at %s by %s succeeded.", update.StartTime.Format(time.RFC3339), update.Operator)
+		if update.Generation != instance.GetGeneration() || update.Commit != currentCommit {
+			// the update was for an earlier spec or revision, so there's still an update to run
+			return false, reconcile.Result{}, nil
+		}
+		if outs, err := sess.autoStack.Outputs(ctx); err == nil {
+			if outputs, err := sess.GetStackOutputs(outs); err == nil && outputs != nil {
+				instance.Status.Outputs = outputs
+				r.outputs.publish(instance, outputs)
+			}
+		}
+		instance.Status.LastUpdate = &shared.StackUpdateState{
+			State:                    shared.SucceededStackStateMessage,
+			LastAttemptedCommit:      currentCommit,
+			LastSuccessfulCommit:     currentCommit,
+			LastSuccessfulGeneration: instance.GetGeneration(),
+			ReconcileRequest:         update.ReconcileRequest,
+			ConfigFromRevision:       update.ConfigFromRevision,
+			ReferencesRevision:       update.ReferencesRevision,
+			PatchChecksum:            update.PatchChecksum,
+			LastResyncTime:           metav1.Now(),
+		}
+		recordUpdate(instance, update.StartTime)
+		instance.Status.MarkReadyCondition()
+		return true, done, nil
+	case handoverNotStarted, handoverFailed:
+		sess.logger.Info("Update started by another instance of the operator is not running",
+			"Operator", update.Operator, "StartTime", update.StartTime)
+		instance.Status.CurrentUpdate = nil
+	}
+	return false, reconcile.Result{}, nil
+}
@@ -0,0 +1,76 @@
+// Copyright 2024, Pulumi Corporation.  All rights reserved.
+
+package stack
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	pulumiv1 "github.com/pulumi/pulumi-kubernetes-operator/pkg/apis/pulumi/v1"
+)
+
+func TestCheckHandover(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	started := now.Add(-5 * time.Minute)
+	update := &pulumiv1.CurrentStackUpdate{
+		Generation: 2,
+		Commit:     "abc123",
+		StartTime:  metav1.NewTime(started),
+		Operator:   "operator-1/v1.15.0/2024-05-01T11:00:00Z",
+	}
+	const self = "operator-2/v1.16.0/2024-05-01T11:58:00Z"
+
+	assert.Equal(t, handoverNone, checkHandover(nil, self, nil, now), "no update recorded")
+	assert.Equal(t, handoverNone, checkHandover(update, update.Operator, nil, now), "started by this instance")
+
+	assert.Equal(t, handoverNotStarted, checkHandover(update, self, nil, now), "no history")
+	assert.Equal(t, handoverNotStarted, checkHandover(update, self,
+		&backendUpdate{Result: "succeeded", StartTime: started.Add(-time.Hour)}, now), "only an earlier update")
+
+	// the backend's clock may be a little behind
+	latest := &backendUpdate{Result: "in-progress", StartTime: started.Add(-10 * time.Second)}
+	assert.Equal(t, handoverRunning, checkHandover(update, self, latest, now))
+
+	update.HandoverTime = &metav1.Time{Time: now.Add(-time.Minute)}
+	assert.Equal(t, handoverRunning, checkHandover(update, self, latest, now), "not waited long enough")
+	update.HandoverTime = &metav1.Time{Time: now.Add(-handoverTimeout)}
+	assert.Equal(t, handoverTakeOver, checkHandover(update, self, latest, now), "waited long enough")
+	update.HandoverTime = nil
+
+	latest.Result = "succeeded"
+	assert.Equal(t, handoverSucceeded, checkHandover(update, self, latest, now))
+	latest.Result = "failed"
+	assert.Equal(t, handoverFailed, checkHandover(update, self, latest, now))
+
+	update.Operator = ""
+	assert.Equal(t, handoverFailed, checkHandover(update, self, latest, now),
+		"recorded by a version of the operator which didn't record itself")
+}
+
+func TestParseHistoryTime(t *testing.T) {
+	want := time.Date(2024, 5, 1, 12, 0, 1, 0, time.UTC)
+	for _, s := range []string{
+		"2024-05-01T12:00:01Z",
+		"2024-05-01T12:00:01.000Z",
+		"2024-05-01T13:00:01.000+0100",
+		"2024-05-01 12:00:01 +0000 UTC",
+	} {
+		got, err := parseHistoryTime(s)
+		if assert.NoError(t, err, s) {
+			assert.True(t, want.Equal(got), "%s: got %s", s, got)
+		}
+	}
+	_, err := parseHistoryTime("yesterday")
+	assert.Error(t, err)
+}
+
+func TestOperatorIdentity(t *testing.T) {
+	t.Setenv("POD_NAME", "pulumi-kubernetes-operator-5d8f7")
+	started := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	id := operatorIdentity(started)
+	assert.Contains(t, id, "pulumi-kubernetes-operator-5d8f7/")
+	assert.NotEqual(t, id, operatorIdentity(started.Add(time.Second)), "a restarted instance is a different instance")
+}
@@ -0,0 +1,144 @@
+// Copyright 2024, Pulumi Corporation.  All rights reserved.
+
+package stack
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/pulumi/pulumi-kubernetes-operator/pkg/apis/pulumi/shared"
+	pulumiv1 "github.com/pulumi/pulumi-kubernetes-operator/pkg/apis/pulumi/v1"
+)
+
+// importFile is the format of the file given to `pulumi import --file`.
+type importFile struct {
+	Resources []importFileResource `json:"resources"`
+}
+
+type importFileResource struct {
+	Type string `json:"type"`
+	Name string `json:"name"`
+	ID   string `json:"id"`
+}
+
+// urnTypeAndName gives the type and name of a resource from its URN, which is of the form
+// `urn:pulumi:<stack>::<project>::<parent type>$<type>::<name>`.
+func urnTypeAndName(urn string) (string, string, bool) {
+	parts := strings.SplitN(urn, "::", 4)
+	if len(parts) != 4 {
+		return "", "", false
+	}
+	typ := parts[2]
+	if i := strings.LastIndex(typ, "$"); i >= 0 {
+		typ = typ[i+1:]
+	}
+	return typ, parts[3], true
+}
+
+// pendingImports gives the imports which are not already in the exported deployment given, as
+// resources of the same type and name.
+func pendingImports(imports []shared.ImportSpec, deployment json.RawMessage) ([]shared.ImportSpec, error) {
+	present := map[[2]string]bool{}
+	if len(deployment) > 0 {
+		var state struct {
+			Resources []struct {
+				URN string `json:"urn"`
+			} `json:"resources"`
+		}
+		if err := json.Unmarshal(deployment, &state); err != nil {
+			return nil, err
+		}
+		for _, res := range state.Resources {
+			if typ, name, ok := urnTypeAndName(res.URN); ok {
+				present[[2]string{typ, name}] = true
+			}
+		}
+	}
+	var pending []shared.ImportSpec
+	for _, imp := range imports {
+		if !present[[2]string{imp.Type, imp.Name}] {
+			pending = append(pending, imp)
+		}
+	}
+	return pending, nil
+}
+
+// ImportResources imports the resources given in .spec.imports into the stack, with `pulumi
+// import`, skipping those already in its state. The resources imported are kept in sess.imported,
+// to be recorded in the status.
+func (sess *reconcileStackSession) ImportResources(ctx context.Context) error {
+	deployment, err := sess.autoStack.Export(ctx)
+	if err != nil {
+		return fmt.Errorf("exporting state of stack %q: %w", sess.stack.Stack, err)
+	}
+	pending, err := pendingImports(sess.stack.Imports, deployment.Deployment)
+	if err != nil {
+		return fmt.Errorf("reading state of stack %q: %w", sess.stack.Stack, err)
+	}
+	if len(pending) == 0 {
+		return nil
+	}
+
+	var spec importFile
+	for _, imp := range pending {
+		spec.Resources = append(spec.Resources, importFileResource{Type: imp.Type, Name: imp.Name, ID: imp.ID})
+	}
+	b, err := json.Marshal(spec)
+	if err != nil {
+		return err
+	}
+	f, err := os.CreateTemp("", "pulumi-import-*.json")
+	if err != nil {
+		return fmt.Errorf("writing resources to import: %w", err)
+	}
+	defer os.Remove(f.Name())
+	_, err = f.Write(b)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return fmt.Errorf("writing resources to import: %w", err)
+	}
+
+	sess.logger.Info("Importing resources into stack", "Stack.Name", sess.stack.Stack, "Count", len(pending))
+	workspace := sess.autoStack.Workspace()
+	args := []string{"import", "--file", f.Name(), "--stack", sess.stack.Stack,
+		"--yes", "--skip-preview", "--non-interactive", "--protect=false", "--generate-code=false"}
+	cmd := exec.CommandContext(ctx, "pulumi", args...)
+	if home := workspace.PulumiHome(); home != "" {
+		cmd.Env = append(os.Environ(), "PULUMI_HOME="+home)
+	}
+	if _, stderr, err := sess.runCmd("Pulumi Import", cmd, workspace); err != nil {
+		return &commandError{kind: "import", command: "pulumi " + strings.Join(args, " "), err: err, stderr: stderr}
+	}
+
+	now := metav1.Now()
+	for _, imp := range pending {
+		sess.imported = append(sess.imported, pulumiv1.ImportedResource{Type: imp.Type, Name: imp.Name, ID: imp.ID, Time: now})
+	}
+	return nil
+}
+
+// recordImported adds the resources just imported to those recorded in the status, replacing any
+// record of a resource with the same type and name.
+func recordImported(recorded, imported []pulumiv1.ImportedResource) []pulumiv1.ImportedResource {
+	for _, imp := range imported {
+		replaced := false
+		for i := range recorded {
+			if recorded[i].Type == imp.Type && recorded[i].Name == imp.Name {
+				recorded[i] = imp
+				replaced = true
+			}
+		}
+		if !replaced {
+			recorded = append(recorded, imp)
+		}
+	}
+	return recorded
+}
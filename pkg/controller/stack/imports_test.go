@@ -0,0 +1,60 @@
+// Copyright 2024, Pulumi Corporation.  All rights reserved.
+
+package stack
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/pulumi/pulumi-kubernetes-operator/pkg/apis/pulumi/shared"
+	pulumiv1 "github.com/pulumi/pulumi-kubernetes-operator/pkg/apis/pulumi/v1"
+)
+
+func TestPendingImports(t *testing.T) {
+	imports := []shared.ImportSpec{
+		{Type: "aws:s3/bucket:Bucket", Name: "logs", ID: "acme-logs"},
+		{Type: "aws:s3/bucket:Bucket", Name: "assets", ID: "acme-assets"},
+		{Type: "aws:ec2/vpc:Vpc", Name: "main", ID: "vpc-0123"},
+	}
+
+	pending, err := pendingImports(imports, nil)
+	require.NoError(t, err)
+	assert.Equal(t, imports, pending, "a new stack has nothing in it")
+
+	deployment := []byte(`{"manifest":{},"resources":[
+		{"urn":"urn:pulumi:dev::infra::pulumi:pulumi:Stack::infra-dev","type":"pulumi:pulumi:Stack"},
+		{"urn":"urn:pulumi:dev::infra::aws:s3/bucket:Bucket::logs","type":"aws:s3/bucket:Bucket","id":"acme-logs"},
+		{"urn":"urn:pulumi:dev::infra::my:index:Network$aws:ec2/vpc:Vpc::main","type":"aws:ec2/vpc:Vpc","id":"vpc-0123"},
+		{"urn":"urn:pulumi:dev::infra::aws:s3/bucket:Bucket::assets-old","type":"aws:s3/bucket:Bucket"}
+	]}`)
+	pending, err = pendingImports(imports, deployment)
+	require.NoError(t, err)
+	assert.Equal(t, imports[1:2], pending, "only resources not already in the state are imported")
+
+	_, err = pendingImports(imports, []byte(`{"resources":`))
+	assert.Error(t, err)
+}
+
+func TestRecordImported(t *testing.T) {
+	earlier := metav1.NewTime(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	now := metav1.NewTime(time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC))
+	recorded := []pulumiv1.ImportedResource{
+		{Type: "aws:s3/bucket:Bucket", Name: "logs", ID: "acme-logs", Time: earlier},
+		{Type: "aws:ec2/vpc:Vpc", Name: "main", ID: "vpc-0123", Time: earlier},
+	}
+	assert.Equal(t, recorded, recordImported(recorded, nil))
+
+	got := recordImported(recorded, []pulumiv1.ImportedResource{
+		{Type: "aws:ec2/vpc:Vpc", Name: "main", ID: "vpc-4567", Time: now},
+		{Type: "aws:s3/bucket:Bucket", Name: "assets", ID: "acme-assets", Time: now},
+	})
+	assert.Equal(t, []pulumiv1.ImportedResource{
+		{Type: "aws:s3/bucket:Bucket", Name: "logs", ID: "acme-logs", Time: earlier},
+		{Type: "aws:ec2/vpc:Vpc", Name: "main", ID: "vpc-4567", Time: now},
+		{Type: "aws:s3/bucket:Bucket", Name: "assets", ID: "acme-assets", Time: now},
+	}, got)
+}
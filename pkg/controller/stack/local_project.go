@@ -0,0 +1,167 @@
+// Copyright 2024, Pulumi Corporation.  All rights reserved.
+
+package stack
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pulumi/pulumi-kubernetes-operator/pkg/apis/pulumi/shared"
+)
+
+// EnvLocalProjectRoot is the name of the environment entry giving the directory within which
+// stacks may use a project on the operator's filesystem, with projectPath. When it's not set,
+// projectPath cannot be used, so that stacks can't read arbitrary files from the operator's
+// filesystem.
+const EnvLocalProjectRoot = "LOCAL_PROJECT_ROOT"
+
+// resolveProjectPath gives the absolute path of the project directory given, which must be within
+// the root directory given.
+func resolveProjectPath(root, projectPath string) (string, error) {
+	if root == "" {
+		return "", newStallErrorf("projectPath cannot be used, since the operator has no %s set", EnvLocalProjectRoot)
+	}
+	path := projectPath
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(root, path)
+	}
+	path = filepath.Clean(path)
+	rel, err := filepath.Rel(filepath.Clean(root), path)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", newStallErrorf("projectPath %q is not within %s (%s)", projectPath, EnvLocalProjectRoot, root)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return "", newStallErrorf("projectPath %q cannot be used: %v", projectPath, err)
+	}
+	if !info.IsDir() {
+		return "", newStallErrorf("projectPath %q is not a directory", projectPath)
+	}
+	return path, nil
+}
+
+// SetupWorkdirFromLocalPath sets up the workspace from a project on the operator's filesystem,
+// either in place or copied to the workspace directory. The revision returned is a hash of the
+// contents of the project directory.
+func (sess *reconcileStackSession) SetupWorkdirFromLocalPath(ctx context.Context, source *shared.GitSource) (string, error) {
+	path, err := resolveProjectPath(sess.localProjectRoot, source.ProjectPath)
+	if err != nil {
+		return "", err
+	}
+	sess.logger.Debug("Setting up pulumi workspace for stack from local path", "stack", sess.stack, "path", path)
+
+	revision, err := localProjectRevision(path)
+	if err != nil {
+		return "", fmt.Errorf("reading projectPath %q: %w", source.ProjectPath, err)
+	}
+
+	projectDir := filepath.Join(path, source.RepoDir)
+	if source.CopyProjectPath {
+		workspaceDir := sess.getWorkspaceDir()
+		if err := copyProjectDir(path, workspaceDir); err != nil {
+			return "", fmt.Errorf("copying projectPath %q: %w", source.ProjectPath, err)
+		}
+		projectDir = filepath.Join(workspaceDir, source.RepoDir)
+	}
+
+	w, err := sess.newWorkspace(ctx, projectDir)
+	if err != nil {
+		return "", fmt.Errorf("failed to create local workspace: %w", err)
+	}
+
+	return revision, sess.setupWorkspace(ctx, w)
+}
+
+// skipLocalProjectEntry reports whether a directory entry is to be left out of the project. The
+// entries with names starting ".." are those the kubelet uses to update ConfigMap and Secret
+// volumes atomically; the files themselves are symlinks into them.
+func skipLocalProjectEntry(name string) bool {
+	return strings.HasPrefix(name, "..")
+}
+
+// walkLocalProject calls fn for each regular file in the project directory, in lexical order,
+// with its path relative to the directory. Symlinks to files are followed; symlinks to directories
+// are not.
+func walkLocalProject(dir string, fn func(rel string, info fs.FileInfo) error) error {
+	return filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if path == dir {
+			return nil
+		}
+		if skipLocalProjectEntry(d.Name()) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if d.IsDir() {
+			return nil
+		}
+		info, err := os.Stat(path) // follows symlinks
+		if err != nil {
+			return err
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		return fn(rel, info)
+	})
+}
+
+// localProjectRevision hashes the names, modes and contents of the files in the project
+// directory, so that any change to the project gives a different revision.
+func localProjectRevision(dir string) (string, error) {
+	h := sha256.New()
+	err := walkLocalProject(dir, func(rel string, info fs.FileInfo) error {
+		fmt.Fprintf(h, "%s\x00%o\x00%d\x00", filepath.ToSlash(rel), info.Mode().Perm(), info.Size())
+		f, err := os.Open(filepath.Join(dir, rel))
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		_, err = io.Copy(h, f)
+		return err
+	})
+	if err != nil {
+		return "", err
+	}
+	return "sha256:" + hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// copyProjectDir copies the files in the project directory to the destination directory, which
+// must exist.
+func copyProjectDir(src, dst string) error {
+	return walkLocalProject(src, func(rel string, info fs.FileInfo) error {
+		target := filepath.Join(dst, rel)
+		if err := os.MkdirAll(filepath.Dir(target), 0700); err != nil {
+			return err
+		}
+		in, err := os.Open(filepath.Join(src, rel))
+		if err != nil {
+			return err
+		}
+		defer in.Close()
+		out, err := os.OpenFile(target, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, info.Mode().Perm()|0600)
+		if err != nil {
+			return err
+		}
+		if _, err := io.Copy(out, in); err != nil {
+			out.Close()
+			return err
+		}
+		return out.Close()
+	})
+}
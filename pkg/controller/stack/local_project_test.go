@@ -0,0 +1,83 @@
+// Copyright 2024, Pulumi Corporation.  All rights reserved.
+
+package stack
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestResolveProjectPath(t *testing.T) {
+	root := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(root, "project"), 0700))
+	require.NoError(t, os.WriteFile(filepath.Join(root, "file"), nil, 0600))
+
+	_, err := resolveProjectPath("", filepath.Join(root, "project"))
+	assert.True(t, isStalledError(err), "no root set")
+
+	path, err := resolveProjectPath(root, "project")
+	require.NoError(t, err)
+	assert.Equal(t, filepath.Join(root, "project"), path)
+
+	path, err = resolveProjectPath(root, filepath.Join(root, "project"))
+	require.NoError(t, err)
+	assert.Equal(t, filepath.Join(root, "project"), path)
+
+	for _, p := range []string{"../", "project/../../etc", "/etc", "missing", "file"} {
+		_, err = resolveProjectPath(root, p)
+		assert.True(t, isStalledError(err), p)
+	}
+}
+
+func TestLocalProjectRevision(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string) {
+		require.NoError(t, os.MkdirAll(filepath.Dir(filepath.Join(dir, name)), 0700))
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(content), 0600))
+	}
+	write("Pulumi.yaml", "name: test\nruntime: yaml\n")
+	write("sub/main.yaml", "resources: {}\n")
+
+	rev1, err := localProjectRevision(dir)
+	require.NoError(t, err)
+	rev, err := localProjectRevision(dir)
+	require.NoError(t, err)
+	assert.Equal(t, rev1, rev, "revision is stable")
+
+	// entries the kubelet uses for volume updates are ignored
+	write("..2024_05_01_12_00_00.123/Pulumi.yaml", "something else")
+	rev, err = localProjectRevision(dir)
+	require.NoError(t, err)
+	assert.Equal(t, rev1, rev)
+
+	write("sub/main.yaml", "resources: {a: b}\n")
+	rev2, err := localProjectRevision(dir)
+	require.NoError(t, err)
+	assert.NotEqual(t, rev1, rev2, "file changed")
+
+	require.NoError(t, os.Rename(filepath.Join(dir, "sub"), filepath.Join(dir, "other")))
+	rev3, err := localProjectRevision(dir)
+	require.NoError(t, err)
+	assert.NotEqual(t, rev2, rev3, "file moved")
+}
+
+func TestCopyProjectDir(t *testing.T) {
+	src := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(src, "..data"), 0700))
+	require.NoError(t, os.WriteFile(filepath.Join(src, "..data", "Pulumi.yaml"), []byte("name: test\n"), 0400))
+	// laid out as a ConfigMap volume is, with the file symlinked into the hidden directory
+	require.NoError(t, os.Symlink(filepath.Join("..data", "Pulumi.yaml"), filepath.Join(src, "Pulumi.yaml")))
+
+	dst := t.TempDir()
+	require.NoError(t, copyProjectDir(src, dst))
+	b, err := os.ReadFile(filepath.Join(dst, "Pulumi.yaml"))
+	require.NoError(t, err)
+	assert.Equal(t, "name: test\n", string(b))
+	assert.NoDirExists(t, filepath.Join(dst, "..data"))
+	// the copy can be written to, though the original can't
+	require.NoError(t, os.WriteFile(filepath.Join(dst, "Pulumi.yaml"), []byte("changed"), 0600))
+}
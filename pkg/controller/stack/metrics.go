@@ -3,15 +3,29 @@
 package stack
 
 import (
+	"sync"
+	"time"
+
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/pulumi/pulumi-kubernetes-operator/pkg/apis/pulumi/shared"
 	pulumiv1 "github.com/pulumi/pulumi-kubernetes-operator/pkg/apis/pulumi/v1"
+	"k8s.io/client-go/tools/cache"
 	"sigs.k8s.io/controller-runtime/pkg/metrics"
 )
 
 var (
-	numStacks        prometheus.Gauge
-	numStacksFailing *prometheus.GaugeVec
+	numStacks          prometheus.Gauge
+	numStacksFailing   *prometheus.GaugeVec
+	numStacksAbandoned *prometheus.CounterVec
+
+	numStacksReconciling prometheus.Gauge
+	stackUpdates         *prometheus.CounterVec
+	stackUpdateDuration  *prometheus.HistogramVec
+
+	numStacksDeprecatedFields *prometheus.GaugeVec
+	unclassifiedFailures      *prometheus.CounterVec
+
+	runtimeAvailable *prometheus.GaugeVec
 )
 
 func initMetrics() []prometheus.Collector {
@@ -29,7 +43,61 @@ func initMetrics() []prometheus.Collector {
 		[]string{"namespace", "name"},
 	)
 
-	collectors = append(collectors, numStacks, numStacksFailing)
+	numStacksAbandoned = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "stacks_abandoned_total",
+			Help: "Number of times the operator has given up on processing a stack, until it is changed",
+		},
+		[]string{"namespace", "name", "reason"},
+	)
+
+	numStacksReconciling = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "stacks_reconciling",
+		Help: "Number of stacks currently being processed",
+	})
+	stackUpdates = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "stack_updates_total",
+			Help: "Number of updates run for each stack, by result",
+		},
+		[]string{"namespace", "name", "result"},
+	)
+	stackUpdateDuration = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "stack_update_duration_seconds",
+			Help:    "Time taken by the updates of each stack, whatever their result",
+			Buckets: []float64{10, 30, 60, 120, 300, 600, 1200, 1800, 3600},
+		},
+		[]string{"namespace", "name"},
+	)
+
+	numStacksDeprecatedFields = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "stacks_deprecated_fields",
+			Help: "Number of stacks using each deprecated field of the Stack spec",
+		},
+		[]string{"namespace", "field"},
+	)
+
+	unclassifiedFailures = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "stack_unclassified_failures_total",
+			Help: "Number of update failures of each stack for reasons the operator doesn't recognise",
+		},
+		[]string{"namespace", "name"},
+	)
+
+	runtimeAvailable = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "runtime_available",
+			Help: "Whether the operator has the tools needed to run projects with each runtime (1) or not (0), as found when first needed",
+		},
+		[]string{"runtime"},
+	)
+
+	collectors = append(collectors, numStacks, numStacksFailing, numStacksAbandoned,
+		numStacksReconciling, stackUpdates, stackUpdateDuration,
+		numStacksDeprecatedFields, unclassifiedFailures, runtimeAvailable)
 	return collectors
 }
 
@@ -66,12 +134,75 @@ func updateStackCallback(oldObj, newObj interface{}) {
 
 func deleteStackCallback(oldObj interface{}) {
 	numStacks.Dec()
+	if tombstone, ok := oldObj.(cache.DeletedFinalStateUnknown); ok {
+		oldObj = tombstone.Obj
+	}
 	oldStack, ok := oldObj.(*pulumiv1.Stack)
 	if !ok {
 		return
 	}
-	// assume that if there was a status recorded, this gauge exists
-	if oldStack.Status.LastUpdate != nil {
-		numStacksFailing.With(prometheus.Labels{"namespace": oldStack.Namespace, "name": oldStack.Name}).Set(0)
+	forgetStackMetrics(oldStack.Namespace, oldStack.Name)
+}
+
+// updateResults gives the value of the "result" label of stack_updates_total for each update
+// status.
+var updateResults = map[shared.StackUpdateStatus]string{
+	shared.StackUpdateSucceeded:         "succeeded",
+	shared.StackUpdateFailed:            "failed",
+	shared.StackUpdateConflict:          "conflict",
+	shared.StackUpdatePendingOperations: "pending_operations",
+	shared.StackNotFound:                "not_found",
+	shared.StackUpdateTimeout:           "timeout",
+	shared.StackUpdateRetryable:         "retryable",
+}
+
+// recordUpdateMetrics counts an update of the stack with the status given, and records how long it
+// took.
+func recordUpdateMetrics(namespace, name string, status shared.StackUpdateStatus, duration time.Duration) {
+	result, ok := updateResults[status]
+	if !ok {
+		result = "unknown"
+	}
+	stackUpdates.With(prometheus.Labels{"namespace": namespace, "name": name, "result": result}).Inc()
+	stackUpdateDuration.With(prometheus.Labels{"namespace": namespace, "name": name}).Observe(duration.Seconds())
+}
+
+// abandonedReasons gives, for each stack, the reasons it has a stacks_abandoned_total series for,
+// so that they can be deleted along with the stack.
+var abandonedReasons = struct {
+	sync.Mutex
+	byStack map[string]map[string]struct{}
+}{byStack: map[string]map[string]struct{}{}}
+
+// recordAbandonedMetrics counts the stack being abandoned for the reason given.
+func recordAbandonedMetrics(namespace, name, reason string) {
+	numStacksAbandoned.With(prometheus.Labels{"namespace": namespace, "name": name, "reason": reason}).Inc()
+	abandonedReasons.Lock()
+	defer abandonedReasons.Unlock()
+	key := namespace + "/" + name
+	if abandonedReasons.byStack[key] == nil {
+		abandonedReasons.byStack[key] = map[string]struct{}{}
+	}
+	abandonedReasons.byStack[key][reason] = struct{}{}
+}
+
+// forgetStackMetrics removes the series labelled with a stack which has been deleted, so that
+// they don't pile up as stacks come and go.
+func forgetStackMetrics(namespace, name string) {
+	labels := prometheus.Labels{"namespace": namespace, "name": name}
+	numStacksFailing.Delete(labels)
+	stackUpdateDuration.Delete(labels)
+	unclassifiedFailures.Delete(labels)
+	for _, result := range updateResults {
+		stackUpdates.Delete(prometheus.Labels{"namespace": namespace, "name": name, "result": result})
+	}
+	stackUpdates.Delete(prometheus.Labels{"namespace": namespace, "name": name, "result": "unknown"})
+
+	abandonedReasons.Lock()
+	defer abandonedReasons.Unlock()
+	key := namespace + "/" + name
+	for reason := range abandonedReasons.byStack[key] {
+		numStacksAbandoned.Delete(prometheus.Labels{"namespace": namespace, "name": name, "reason": reason})
 	}
+	delete(abandonedReasons.byStack, key)
 }
@@ -0,0 +1,67 @@
+// Copyright 2024, Pulumi Corporation.  All rights reserved.
+
+package stack
+
+import (
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/cache"
+
+	"github.com/pulumi/pulumi-kubernetes-operator/pkg/apis/pulumi/shared"
+	pulumiv1 "github.com/pulumi/pulumi-kubernetes-operator/pkg/apis/pulumi/v1"
+)
+
+func TestUpdateMetrics(t *testing.T) {
+	updates := func(name, result string) float64 {
+		return testutil.ToFloat64(stackUpdates.With(prometheus.Labels{"namespace": namespace, "name": name, "result": result}))
+	}
+
+	recordUpdateMetrics(namespace, "metrics", shared.StackUpdateSucceeded, time.Minute)
+	recordUpdateMetrics(namespace, "metrics", shared.StackUpdateSucceeded, 2*time.Minute)
+	recordUpdateMetrics(namespace, "metrics", shared.StackUpdateConflict, time.Second)
+	recordUpdateMetrics(namespace, "other", shared.StackUpdateFailed, time.Second)
+	assert.Equal(t, 2.0, updates("metrics", "succeeded"))
+	assert.Equal(t, 1.0, updates("metrics", "conflict"))
+	assert.Equal(t, 1.0, updates("other", "failed"))
+	assert.Equal(t, 2, testutil.CollectAndCount(stackUpdateDuration))
+
+	numStacksFailing.With(prometheus.Labels{"namespace": namespace, "name": "metrics"}).Set(1)
+	unclassifiedFailures.With(prometheus.Labels{"namespace": namespace, "name": "metrics"}).Inc()
+	recordAbandonedMetrics(namespace, "metrics", pulumiv1.StalledSpecInvalidReason)
+	recordAbandonedMetrics(namespace, "metrics", pulumiv1.StalledConflictReason)
+	recordAbandonedMetrics(namespace, "other", pulumiv1.StalledSpecInvalidReason)
+	stack := &pulumiv1.Stack{ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: "metrics"}}
+	newStackCallback(stack)
+	// a deletion missed by the informer is given as a tombstone
+	deleteStackCallback(cache.DeletedFinalStateUnknown{Key: namespace + "/metrics", Obj: stack})
+
+	// the series for the stack deleted are gone, and the others remain
+	assert.Equal(t, 1, testutil.CollectAndCount(stackUpdates))
+	assert.Equal(t, 1, testutil.CollectAndCount(stackUpdateDuration))
+	assert.Equal(t, 0, testutil.CollectAndCount(numStacksFailing))
+	assert.Equal(t, 1.0, updates("other", "failed"))
+	assert.Equal(t, 1.0, testutil.ToFloat64(numStacksAbandoned.With(prometheus.Labels{
+		"namespace": namespace, "name": "other", "reason": pulumiv1.StalledSpecInvalidReason,
+	})))
+
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(numStacksFailing, numStacksAbandoned, stackUpdates, stackUpdateDuration, unclassifiedFailures)
+	families, err := registry.Gather()
+	require.NoError(t, err)
+	for _, family := range families {
+		for _, m := range family.GetMetric() {
+			labels := map[string]string{}
+			for _, l := range m.GetLabel() {
+				labels[l.GetName()] = l.GetValue()
+			}
+			assert.False(t, labels["namespace"] == namespace && labels["name"] == "metrics",
+				"%s has a series for the stack deleted: %v", family.GetName(), labels)
+		}
+	}
+}
@@ -0,0 +1,72 @@
+// Copyright 2024, Pulumi Corporation.  All rights reserved.
+
+package stack
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	pulumiv1 "github.com/pulumi/pulumi-kubernetes-operator/pkg/apis/pulumi/v1"
+)
+
+// When a namespace is deleted, every Stack in it is deleted at once, along with the Secrets and
+// ConfigMaps they refer to. A stack being deleted in a terminating namespace is finalized with as
+// little as possible: its prerequisites (which are likely being deleted too) aren't waited for,
+// and it isn't refreshed before being destroyed. If a Secret it refers to has already gone, it
+// can't be destroyed, and waiting for the Secret would hold up the namespace forever; so it's
+// finalized without being destroyed, leaving its resources in place, with a warning.
+
+// isNamespaceTerminating reports whether the namespace given is being deleted. The namespace is
+// read directly rather than through the cache, so that the operator needn't watch namespaces; if it
+// can't be read (e.g., the operator isn't allowed to), it's taken not to be terminating.
+func isNamespaceTerminating(ctx context.Context, reader client.Reader, name string) bool {
+	if reader == nil {
+		return false
+	}
+	var ns corev1.Namespace
+	if err := reader.Get(ctx, types.NamespacedName{Name: name}, &ns); err != nil {
+		return false
+	}
+	return ns.DeletionTimestamp != nil || ns.Status.Phase == corev1.NamespaceTerminating
+}
+
+// missingSecrets gives the names of the Secrets the stack refers to which no longer exist.
+func (sess *reconcileStackSession) missingSecrets(ctx context.Context) ([]string, error) {
+	var missing []string
+	for _, name := range referencedSecrets(sess.namespace, &sess.stack) {
+		var secret corev1.Secret
+		if err := sess.kubeClient.Get(ctx, types.NamespacedName{Namespace: sess.namespace, Name: name}, &secret); err != nil {
+			if isMissingReference(err) {
+				missing = append(missing, name)
+				continue
+			}
+			return nil, err
+		}
+	}
+	return missing, nil
+}
+
+// finalizeInTerminatingNamespace checks whether a stack being deleted along with its namespace
+// can still be destroyed. If a Secret it refers to has gone, the stack is finalized without being
+// destroyed, and true is returned; otherwise, the stack is to be destroyed as usual.
+func (r *ReconcileStack) finalizeInTerminatingNamespace(ctx context.Context, sess *reconcileStackSession, instance *pulumiv1.Stack) (bool, error) {
+	missing, err := sess.missingSecrets(ctx)
+	if err != nil {
+		return false, fmt.Errorf("checking the Secrets referred to by the stack: %w", err)
+	}
+	if len(missing) == 0 {
+		return false, nil
+	}
+	r.emitEvent(instance, pulumiv1.StackDestroySkippedEvent(),
+		"Namespace is being deleted and Secrets the stack needs to be destroyed have been removed (%s); its resources are left in place.",
+		strings.Join(missing, ", "))
+	sess.logger.Info("WARNING: finalizing stack without destroying it, since its namespace is being deleted and Secrets it refers to are gone",
+		"Stack.Name", sess.stack.Stack, "Secrets", missing)
+	sess.stack.DestroyOnFinalize = false
+	return true, sess.finalize(ctx, instance)
+}
@@ -0,0 +1,52 @@
+// Copyright 2024, Pulumi Corporation.  All rights reserved.
+
+package stack
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	"github.com/pulumi/pulumi-kubernetes-operator/pkg/apis/pulumi/shared"
+	"github.com/pulumi/pulumi-kubernetes-operator/pkg/logging"
+)
+
+func TestIsNamespaceTerminating(t *testing.T) {
+	active := &corev1.Namespace{
+		ObjectMeta: metav1.ObjectMeta{Name: "active"},
+		Status:     corev1.NamespaceStatus{Phase: corev1.NamespaceActive},
+	}
+	terminating := &corev1.Namespace{
+		ObjectMeta: metav1.ObjectMeta{Name: "terminating"},
+		Status:     corev1.NamespaceStatus{Phase: corev1.NamespaceTerminating},
+	}
+	client := fake.NewFakeClientWithScheme(scheme.Scheme, active, terminating)
+
+	assert.False(t, isNamespaceTerminating(context.TODO(), client, "active"))
+	assert.True(t, isNamespaceTerminating(context.TODO(), client, "terminating"))
+	assert.False(t, isNamespaceTerminating(context.TODO(), client, "absent"), "a namespace that can't be read is taken to be active")
+	assert.False(t, isNamespaceTerminating(context.TODO(), nil, "terminating"))
+}
+
+func TestMissingSecrets(t *testing.T) {
+	logger := logging.NewLogger(t.Name(), "Request.Test", "TestMissingSecrets")
+	present := &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "present", Namespace: namespace}}
+	client := fake.NewFakeClientWithScheme(scheme.Scheme, present)
+
+	sess := newReconcileStackSession(logger, shared.StackSpec{
+		EnvRefs: map[string]shared.ResourceRef{
+			"PULUMI_CONFIG_PASSPHRASE": shared.NewSecretResourceRef(namespace, "present", "passphrase"),
+			"KUBECONFIG":               shared.NewLiteralResourceRef("/etc/kubeconfig"),
+		},
+		SecretEnvs: []string{"removed"},
+	}, client, namespace)
+	missing, err := sess.missingSecrets(context.TODO())
+	require.NoError(t, err)
+	assert.Equal(t, []string{"removed"}, missing)
+}
@@ -0,0 +1,105 @@
+// Copyright 2024, Pulumi Corporation.  All rights reserved.
+
+package stack
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/pulumi/pulumi-kubernetes-operator/pkg/apis/pulumi/shared"
+	pulumiv1 "github.com/pulumi/pulumi-kubernetes-operator/pkg/apis/pulumi/v1"
+)
+
+// notificationHTTPClient is used to call the webhooks given in .spec.notifications. The timeout
+// is short, since the stack's processing waits on each webhook.
+var notificationHTTPClient = &http.Client{Timeout: 10 * time.Second}
+
+// notificationPayload is what's POSTed to a webhook given in .spec.notifications.
+type notificationPayload struct {
+	Namespace string                         `json:"namespace"`
+	Name      string                         `json:"name"`
+	Stack     string                         `json:"stack"`
+	Outcome   shared.StackUpdateStateMessage `json:"outcome"`
+	Reason    string                         `json:"reason,omitempty"`
+	Permalink shared.Permalink               `json:"permalink,omitempty"`
+	Commit    string                         `json:"commit,omitempty"`
+	Time      time.Time                      `json:"time"`
+}
+
+// wantsOutcome reports whether the webhook is to be notified of the outcome given.
+func wantsOutcome(hook *shared.WebhookNotification, outcome shared.StackUpdateStateMessage) bool {
+	if len(hook.On) == 0 {
+		return true
+	}
+	for _, o := range hook.On {
+		if o == outcome {
+			return true
+		}
+	}
+	return false
+}
+
+// sendNotifications calls the webhooks given in .spec.notifications with the outcome of
+// processing the stack, as recorded in its last update. A webhook which can't be called is
+// logged and otherwise ignored, so that it doesn't hold up or fail the stack.
+func (sess *reconcileStackSession) sendNotifications(ctx context.Context, instance *pulumiv1.Stack) {
+	last := instance.Status.LastUpdate
+	if sess.stack.Notifications == nil || last == nil || last.State == "" {
+		return
+	}
+	payload := notificationPayload{
+		Namespace: instance.Namespace,
+		Name:      instance.Name,
+		Stack:     sess.stack.Stack,
+		Outcome:   last.State,
+		Reason:    last.Reason,
+		Permalink: last.Permalink,
+		Commit:    last.LastAttemptedCommit,
+		Time:      last.LastResyncTime.Time,
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		sess.logger.Error(err, "Failed to encode notification", "Stack.Name", sess.stack.Stack)
+		return
+	}
+	for i := range sess.stack.Notifications.Webhooks {
+		hook := &sess.stack.Notifications.Webhooks[i]
+		if !wantsOutcome(hook, payload.Outcome) {
+			continue
+		}
+		if err := sess.callWebhook(ctx, hook, body); err != nil {
+			sess.logger.Info("WARNING: unable to deliver notification", "Stack.Name", sess.stack.Stack,
+				"Webhook", i, "Error", err.Error())
+		}
+	}
+}
+
+func (sess *reconcileStackSession) callWebhook(ctx context.Context, hook *shared.WebhookNotification, body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, hook.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if hook.AuthHeader != nil {
+		auth, err := sess.resolveResourceRef(ctx, hook.AuthHeader)
+		if err != nil {
+			return fmt.Errorf("resolving authHeader: %w", err)
+		}
+		req.Header.Set("Authorization", auth)
+	}
+	res, err := notificationHTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(res.Body, 1<<20))
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return fmt.Errorf("webhook responded %s", res.Status)
+	}
+	return nil
+}
@@ -0,0 +1,86 @@
+// Copyright 2024, Pulumi Corporation.  All rights reserved.
+
+package stack
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/pulumi/pulumi-kubernetes-operator/pkg/apis/pulumi/shared"
+	pulumiv1 "github.com/pulumi/pulumi-kubernetes-operator/pkg/apis/pulumi/v1"
+	"github.com/pulumi/pulumi-kubernetes-operator/pkg/logging"
+)
+
+func TestSendNotifications(t *testing.T) {
+	logger := logging.NewLogger(t.Name(), "Request.Test", "TestSendNotifications")
+
+	type delivery struct {
+		path    string
+		auth    string
+		payload notificationPayload
+	}
+	var delivered []delivery
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var d delivery
+		d.path, d.auth = r.URL.Path, r.Header.Get("Authorization")
+		assert.Equal(t, "application/json", r.Header.Get("Content-Type"))
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&d.payload))
+		delivered = append(delivered, d)
+		if r.URL.Path == "/broken" {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer server.Close()
+
+	token := shared.NewLiteralResourceRef("Bearer abc123")
+	spec := shared.StackSpec{
+		Stack: "org/network/dev",
+		Notifications: &shared.Notifications{Webhooks: []shared.WebhookNotification{
+			{URL: server.URL + "/all", AuthHeader: &token},
+			{URL: server.URL + "/failures", On: []shared.StackUpdateStateMessage{shared.FailedStackStateMessage}},
+			{URL: server.URL + "/broken"},
+			{URL: "http://127.0.0.1:1/unreachable"},
+		}},
+	}
+	instance := &pulumiv1.Stack{ObjectMeta: metav1.ObjectMeta{Name: "network", Namespace: namespace}}
+	instance.Status.LastUpdate = &shared.StackUpdateState{
+		State:               shared.SucceededStackStateMessage,
+		LastAttemptedCommit: "abc",
+		Permalink:           "https://app.pulumi.com/org/network/dev/updates/3",
+		LastResyncTime:      metav1.NewTime(time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)),
+	}
+	sess := newReconcileStackSession(logger, spec, nil, namespace)
+
+	// webhooks which can't be called don't stop the others being called
+	sess.sendNotifications(context.TODO(), instance)
+	require.Len(t, delivered, 2)
+	assert.Equal(t, "/all", delivered[0].path)
+	assert.Equal(t, "Bearer abc123", delivered[0].auth)
+	assert.Equal(t, notificationPayload{
+		Namespace: namespace,
+		Name:      "network",
+		Stack:     "org/network/dev",
+		Outcome:   shared.SucceededStackStateMessage,
+		Permalink: "https://app.pulumi.com/org/network/dev/updates/3",
+		Commit:    "abc",
+		Time:      time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC),
+	}, delivered[0].payload)
+	assert.Equal(t, "/broken", delivered[1].path)
+
+	delivered = nil
+	instance.Status.LastUpdate.State = shared.FailedStackStateMessage
+	instance.Status.LastUpdate.Reason = pulumiv1.ReconcilingProjectNotFoundReason
+	sess.sendNotifications(context.TODO(), instance)
+	require.Len(t, delivered, 3)
+	assert.Equal(t, "/failures", delivered[1].path)
+	assert.Equal(t, shared.FailedStackStateMessage, delivered[1].payload.Outcome)
+	assert.Equal(t, "ProjectNotFound", delivered[1].payload.Reason)
+}
@@ -0,0 +1,113 @@
+// Copyright 2024, Pulumi Corporation.  All rights reserved.
+
+package stack
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+
+	"github.com/pulumi/pulumi-kubernetes-operator/pkg/apis/pulumi/shared"
+	pulumiv1 "github.com/pulumi/pulumi-kubernetes-operator/pkg/apis/pulumi/v1"
+)
+
+// outputExchange keeps, within this process, the outputs of the last successful update of each
+// stack. A stack using the outputs of another (see resolveStackOutputRef) is usually processed
+// because that stack has just been updated, when the operator's cache may not have caught up with
+// its status yet; without the exchange, it would be updated with the outputs from before. The
+// outputs are the same as those put in the stack's status, so what's used doesn't depend on where
+// it came from. A nil *outputExchange has nothing in it.
+type outputExchange struct {
+	mu     sync.Mutex
+	stacks map[types.NamespacedName]publishedOutputs
+}
+
+// publishedOutputs are the outputs of a stack, and the UID of the stack, so that outputs of a
+// stack that has since been deleted and created again aren't used.
+type publishedOutputs struct {
+	uid     types.UID
+	outputs shared.StackOutputs
+}
+
+func newOutputExchange() *outputExchange {
+	return &outputExchange{stacks: map[types.NamespacedName]publishedOutputs{}}
+}
+
+// publish records the outputs of a stack just updated.
+func (x *outputExchange) publish(stack *pulumiv1.Stack, outputs shared.StackOutputs) {
+	if x == nil {
+		return
+	}
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	x.stacks[types.NamespacedName{Namespace: stack.Namespace, Name: stack.Name}] = publishedOutputs{
+		uid:     stack.UID,
+		outputs: outputs,
+	}
+}
+
+// get returns the outputs published for the stack with the name and UID given, if there are any.
+func (x *outputExchange) get(key types.NamespacedName, uid types.UID) (shared.StackOutputs, bool) {
+	if x == nil {
+		return nil, false
+	}
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	published, ok := x.stacks[key]
+	if !ok || published.uid != uid {
+		return nil, false
+	}
+	return published.outputs, true
+}
+
+// forget removes the outputs of a stack that has been deleted.
+func (x *outputExchange) forget(key types.NamespacedName) {
+	if x == nil {
+		return
+	}
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	delete(x.stacks, key)
+}
+
+// resolveStackOutputRef gives the value of an output of another stack in the same namespace,
+// preferring what's been published to the exchange over the stack's status, which may be out of
+// date.
+func (sess *reconcileStackSession) resolveStackOutputRef(ctx context.Context, sel *shared.StackOutputSelector) (string, error) {
+	key := types.NamespacedName{Namespace: sess.namespace, Name: sel.Name}
+	var producer pulumiv1.Stack
+	if err := sess.kubeClient.Get(ctx, key, &producer); err != nil {
+		if k8serrors.IsNotFound(err) {
+			return "", fmt.Errorf("%w: Stack %s: %w", errWaitingForDependency, key, err)
+		}
+		return "", fmt.Errorf("Stack %s: %w", key, err)
+	}
+	outputs := producer.Status.Outputs
+	if published, ok := sess.outputs.get(key, producer.UID); ok {
+		outputs = published
+	}
+	if len(outputs) == 0 {
+		return "", fmt.Errorf("%w: Stack %s has no outputs yet", errWaitingForDependency, key)
+	}
+	raw, ok := outputs[sel.Output]
+	if !ok {
+		return "", fmt.Errorf("no output %q found in Stack %s", sel.Output, key)
+	}
+	var value interface{}
+	if err := json.Unmarshal(raw.Raw, &value); err != nil {
+		return "", fmt.Errorf("reading output %q of Stack %s: %w", sel.Output, key, err)
+	}
+	s, isString := value.(string)
+	switch {
+	case isString && s == "[secret]" && !producer.Spec.ShowSecretOutputs:
+		return "", fmt.Errorf("output %q of Stack %s is secret; set showSecretOutputs on the Stack to use it", sel.Output, key)
+	case isString:
+		return s, nil
+	default:
+		return string(raw.Raw), nil
+	}
+}
@@ -0,0 +1,90 @@
+// Copyright 2024, Pulumi Corporation.  All rights reserved.
+
+package stack
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	"github.com/pulumi/pulumi-kubernetes-operator/pkg/apis/pulumi/shared"
+	pulumiv1 "github.com/pulumi/pulumi-kubernetes-operator/pkg/apis/pulumi/v1"
+	"github.com/pulumi/pulumi-kubernetes-operator/pkg/logging"
+)
+
+func TestStackOutputExchange(t *testing.T) {
+	logger := logging.NewLogger(t.Name(), "Request.Test", "TestStackOutputExchange")
+	output := func(raw string) apiextensionsv1.JSON {
+		return apiextensionsv1.JSON{Raw: []byte(raw)}
+	}
+
+	// the producer's status, as the cache has it, is from before its latest update
+	producer := &pulumiv1.Stack{
+		ObjectMeta: metav1.ObjectMeta{Name: "network", Namespace: namespace, UID: "network-1"},
+		Status: pulumiv1.StackStatus{Outputs: shared.StackOutputs{
+			"vpcId":   output(`"vpc-old"`),
+			"subnets": output(`["subnet-a"]`),
+			"token":   output(`"[secret]"`),
+		}},
+	}
+	s := runtime.NewScheme()
+	require.NoError(t, scheme.AddToScheme(s))
+	require.NoError(t, pulumiv1.SchemeBuilder.AddToScheme(s))
+	c := fake.NewFakeClientWithScheme(s, producer)
+
+	consumer := newReconcileStackSession(logger, shared.StackSpec{
+		ConfigRefs: map[string]shared.ResourceRef{"app:vpcId": shared.NewStackOutputResourceRef("network", "vpcId")},
+	}, c, namespace)
+	resolve := func(name, out string) (string, error) {
+		ref := shared.NewStackOutputResourceRef(name, out)
+		return consumer.resolveResourceRef(context.TODO(), &ref)
+	}
+
+	// without the exchange, the status is all there is to go on
+	v, err := resolve("network", "vpcId")
+	require.NoError(t, err)
+	assert.Equal(t, "vpc-old", v)
+
+	// the producer's update completes, and its outputs are published ...
+	exchange := newOutputExchange()
+	consumer.outputs = exchange
+	exchange.publish(producer, shared.StackOutputs{
+		"vpcId":   output(`"vpc-new"`),
+		"subnets": output(`["subnet-a","subnet-b"]`),
+		"token":   output(`"[secret]"`),
+	})
+	// ... and the consumer, processed straight after, sees them though the cache hasn't caught up
+	v, err = resolve("network", "vpcId")
+	require.NoError(t, err)
+	assert.Equal(t, "vpc-new", v)
+	v, err = resolve("network", "subnets")
+	require.NoError(t, err)
+	assert.Equal(t, `["subnet-a","subnet-b"]`, v, "values other than strings are given as JSON")
+
+	_, err = resolve("network", "token")
+	assert.ErrorContains(t, err, "is secret")
+	_, err = resolve("network", "missing")
+	assert.ErrorContains(t, err, `no output "missing"`)
+	_, err = resolve("absent", "vpcId")
+	assert.True(t, isMissingReference(err))
+
+	// outputs published for an earlier stack of the same name aren't used
+	recreated := producer.DeepCopy()
+	recreated.UID = "network-0"
+	exchange.publish(recreated, shared.StackOutputs{"vpcId": output(`"vpc-stale"`)})
+	v, err = resolve("network", "vpcId")
+	require.NoError(t, err)
+	assert.Equal(t, "vpc-old", v)
+
+	exchange.forget(types.NamespacedName{Namespace: namespace, Name: "network"})
+	_, ok := exchange.get(types.NamespacedName{Namespace: namespace, Name: "network"}, "network-0")
+	assert.False(t, ok)
+}
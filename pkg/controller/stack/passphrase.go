@@ -0,0 +1,62 @@
+// Copyright 2024, Pulumi Corporation.  All rights reserved.
+
+package stack
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/pulumi/pulumi/sdk/v3/go/auto"
+
+	"github.com/pulumi/pulumi-kubernetes-operator/pkg/apis/pulumi/shared"
+)
+
+// passphraseSecretsProvider is the value of .spec.secretsProvider which selects the passphrase
+// secrets provider.
+const passphraseSecretsProvider = "passphrase"
+
+// passphraseEnvVars are the environment variables the Pulumi CLI reads the passphrase from.
+var passphraseEnvVars = []string{"PULUMI_CONFIG_PASSPHRASE", "PULUMI_CONFIG_PASSPHRASE_FILE"}
+
+// validateSecretsProvider checks that a passphrase is given when the passphrase secrets provider
+// is used, so that a stack without one fails before anything is run, rather than with an opaque
+// error from the Pulumi CLI. The passphrase may be given by secretsProviderPassphraseRef, an
+// entry in envRefs, or the operator's own environment; envFrom, envs and envSecrets can't be
+// checked without reading the objects they refer to, so they are given the benefit of the doubt.
+func validateSecretsProvider(spec *shared.StackSpec) error {
+	if spec.SecretsProvider != passphraseSecretsProvider || spec.SecretsProviderPassphraseRef != nil {
+		return nil
+	}
+	if len(spec.EnvFrom) > 0 || len(spec.Envs) > 0 || len(spec.SecretEnvs) > 0 {
+		return nil
+	}
+	for _, name := range passphraseEnvVars {
+		if _, ok := spec.EnvRefs[name]; ok {
+			return nil
+		}
+		if os.Getenv(name) != "" {
+			return nil
+		}
+	}
+	return newStallErrorf("secretsProvider is passphrase, but no passphrase is given; set secretsProviderPassphraseRef")
+}
+
+// setPassphraseForWorkspace sets the passphrase given by .spec.secretsProviderPassphraseRef in the
+// workspace's environment, so that it's used for every operation on the stack. It's set after
+// envRefs, so that it takes precedence.
+func (sess *reconcileStackSession) setPassphraseForWorkspace(ctx context.Context, w auto.Workspace) error {
+	ref := sess.stack.SecretsProviderPassphraseRef
+	if ref == nil {
+		return nil
+	}
+	passphrase, err := sess.resolveResourceRef(ctx, ref)
+	if err != nil {
+		return fmt.Errorf("resolving secretsProviderPassphraseRef: %w", err)
+	}
+	if passphrase == "" {
+		return fmt.Errorf("the passphrase given by secretsProviderPassphraseRef is empty")
+	}
+	w.SetEnvVar("PULUMI_CONFIG_PASSPHRASE", passphrase)
+	return nil
+}
@@ -0,0 +1,39 @@
+// Copyright 2024, Pulumi Corporation.  All rights reserved.
+
+package stack
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/pulumi/pulumi-kubernetes-operator/pkg/apis/pulumi/shared"
+)
+
+func TestValidateSecretsProvider(t *testing.T) {
+	// the operator's environment is checked too, so make sure it has no passphrase
+	t.Setenv("PULUMI_CONFIG_PASSPHRASE", "")
+	t.Setenv("PULUMI_CONFIG_PASSPHRASE_FILE", "")
+	ref := shared.NewSecretResourceRef("", "passphrase", "passphrase")
+
+	for name, spec := range map[string]shared.StackSpec{
+		"default provider":       {},
+		"cloud provider":         {SecretsProvider: "awskms:///alias/pulumi"},
+		"passphrase ref":         {SecretsProvider: "passphrase", SecretsProviderPassphraseRef: &ref},
+		"passphrase ref alone":   {SecretsProviderPassphraseRef: &ref},
+		"moving off passphrase":  {SecretsProvider: "awskms:///alias/pulumi", SecretsProviderPassphraseRef: &ref},
+		"passphrase in envRefs":  {SecretsProvider: "passphrase", EnvRefs: map[string]shared.ResourceRef{"PULUMI_CONFIG_PASSPHRASE": ref}},
+		"passphrase file":        {SecretsProvider: "passphrase", EnvRefs: map[string]shared.ResourceRef{"PULUMI_CONFIG_PASSPHRASE_FILE": shared.NewLiteralResourceRef("/etc/passphrase")}},
+		"possibly in envFrom":    {SecretsProvider: "passphrase", EnvFrom: []shared.EnvFromSource{{SecretRef: &shared.EnvFromObjectReference{Name: "env"}}}},
+		"possibly in envSecrets": {SecretsProvider: "passphrase", SecretEnvs: []string{"env"}},
+	} {
+		assert.NoError(t, validateSecretsProvider(&spec), name)
+	}
+
+	err := validateSecretsProvider(&shared.StackSpec{SecretsProvider: "passphrase"})
+	assert.True(t, isStalledError(err))
+	assert.ErrorContains(t, err, "set secretsProviderPassphraseRef")
+
+	t.Setenv("PULUMI_CONFIG_PASSPHRASE", "from-the-operator")
+	assert.NoError(t, validateSecretsProvider(&shared.StackSpec{SecretsProvider: "passphrase"}))
+}
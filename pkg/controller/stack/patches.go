@@ -0,0 +1,330 @@
+// Copyright 2024, Pulumi Corporation.  All rights reserved.
+
+package stack
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	pulumiv1 "github.com/pulumi/pulumi-kubernetes-operator/pkg/apis/pulumi/v1"
+)
+
+// errPatchFailed is wrapped by the error returned when the patches given in .spec.patches can't be
+// applied to the source.
+var errPatchFailed = errors.New("patch failed")
+
+// patchesChecksum gives a checksum of the patches, to record which were applied to the source.
+// It's empty if there are no patches.
+func patchesChecksum(patches []string) string {
+	if len(patches) == 0 {
+		return ""
+	}
+	h := sha256.New()
+	for _, p := range patches {
+		h.Write([]byte(p))
+		h.Write([]byte{0})
+	}
+	return "sha256:" + hex.EncodeToString(h.Sum(nil))
+}
+
+// filePatch is the part of a unified diff which changes one file. The old path is empty for a file
+// being created, and the new path empty for a file being deleted.
+type filePatch struct {
+	oldPath, newPath string
+	hunks            []patchHunk
+}
+
+// patchHunk is a hunk of a unified diff. The lines are given with their prefix (' ', '-' or '+')
+// and with their line ending, which is absent from the last line of a file with no newline at the
+// end.
+type patchHunk struct {
+	oldStart, oldCount int
+	newStart, newCount int
+	lines              []string
+}
+
+// oldAndNew gives the lines the hunk expects to find, and those it replaces them with.
+func (h *patchHunk) oldAndNew() (before, after []string) {
+	for _, l := range h.lines {
+		switch l[0] {
+		case ' ':
+			before = append(before, l[1:])
+			after = append(after, l[1:])
+		case '-':
+			before = append(before, l[1:])
+		case '+':
+			after = append(after, l[1:])
+		}
+	}
+	return before, after
+}
+
+// parsePatch reads the file patches from a unified diff, as given by `git diff` or `diff -u`. Lines
+// outside the file patches, like the headers `git diff` gives, are ignored.
+func parsePatch(text string) ([]filePatch, error) {
+	lines := strings.SplitAfter(text, "\n")
+	var files []filePatch
+	for i := 0; i < len(lines); i++ {
+		if !strings.HasPrefix(lines[i], "--- ") || i+1 >= len(lines) || !strings.HasPrefix(lines[i+1], "+++ ") {
+			continue
+		}
+		file := filePatch{
+			oldPath: patchPath(lines[i][4:], "a/"),
+			newPath: patchPath(lines[i+1][4:], "b/"),
+		}
+		i += 2
+		for i < len(lines) && strings.HasPrefix(lines[i], "@@ ") {
+			hunk, next, err := parseHunk(lines, i)
+			if err != nil {
+				return nil, err
+			}
+			file.hunks = append(file.hunks, hunk)
+			i = next
+		}
+		if len(file.hunks) == 0 {
+			return nil, fmt.Errorf("no hunks given for %s", file.name())
+		}
+		files = append(files, file)
+		i-- // the loop moves on to the line after the last hunk
+	}
+	if len(files) == 0 {
+		return nil, errors.New("no file changes found; patches must be unified diffs")
+	}
+	return files, nil
+}
+
+// patchPath reads a path from a `---` or `+++` line, removing the prefix `git diff` puts on it.
+func patchPath(line, prefix string) string {
+	path := strings.TrimRight(line, "\r\n")
+	if tab := strings.IndexByte(path, '\t'); tab >= 0 {
+		path = path[:tab] // `diff -u` puts the time after a tab
+	}
+	if path == "/dev/null" {
+		return ""
+	}
+	return strings.TrimPrefix(path, prefix)
+}
+
+// parseHunk reads the hunk starting at lines[i], returning it and the index of the line after it.
+func parseHunk(lines []string, i int) (patchHunk, int, error) {
+	var hunk patchHunk
+	header := strings.TrimRight(lines[i], "\r\n")
+	fields := strings.Fields(header)
+	if len(fields) < 4 || fields[3] != "@@" || !strings.HasPrefix(fields[1], "-") || !strings.HasPrefix(fields[2], "+") {
+		return hunk, 0, fmt.Errorf("malformed hunk header %q", header)
+	}
+	var err error
+	if hunk.oldStart, hunk.oldCount, err = parseHunkRange(fields[1][1:]); err != nil {
+		return hunk, 0, fmt.Errorf("malformed hunk header %q: %w", header, err)
+	}
+	if hunk.newStart, hunk.newCount, err = parseHunkRange(fields[2][1:]); err != nil {
+		return hunk, 0, fmt.Errorf("malformed hunk header %q: %w", header, err)
+	}
+
+	i++
+	oldLeft, newLeft := hunk.oldCount, hunk.newCount
+	for oldLeft > 0 || newLeft > 0 {
+		if i >= len(lines) || lines[i] == "" {
+			return hunk, 0, fmt.Errorf("hunk %q ends early", header)
+		}
+		line := lines[i]
+		if line == "\n" {
+			line = " \n" // an empty context line, with its space removed by an editor
+		}
+		switch line[0] {
+		case ' ':
+			oldLeft--
+			newLeft--
+		case '-':
+			oldLeft--
+		case '+':
+			newLeft--
+		default:
+			return hunk, 0, fmt.Errorf("unexpected line in hunk %q: %q", header, strings.TrimRight(line, "\n"))
+		}
+		if oldLeft < 0 || newLeft < 0 {
+			return hunk, 0, fmt.Errorf("hunk %q has more lines than its header says", header)
+		}
+		hunk.lines = append(hunk.lines, line)
+		i++
+		if i < len(lines) && strings.HasPrefix(lines[i], `\`) {
+			// "\ No newline at end of file" applies to the line before
+			last := len(hunk.lines) - 1
+			hunk.lines[last] = strings.TrimSuffix(hunk.lines[last], "\n")
+			i++
+		}
+	}
+	return hunk, i, nil
+}
+
+// parseHunkRange reads "start,count" or "start" (for a count of one) from a hunk header.
+func parseHunkRange(s string) (int, int, error) {
+	start, count := s, "1"
+	if comma := strings.IndexByte(s, ','); comma >= 0 {
+		start, count = s[:comma], s[comma+1:]
+	}
+	a, err := strconv.Atoi(start)
+	if err != nil {
+		return 0, 0, err
+	}
+	b, err := strconv.Atoi(count)
+	if err != nil {
+		return 0, 0, err
+	}
+	return a, b, nil
+}
+
+func (f *filePatch) name() string {
+	if f.newPath != "" {
+		return f.newPath
+	}
+	return f.oldPath
+}
+
+// applyHunks applies the hunks to the content of a file. Each hunk is looked for where its header
+// says, and failing that, at the nearest place after the previous hunk where its lines match
+// exactly. There's no fuzz: a hunk whose context doesn't match anywhere doesn't apply.
+func applyHunks(content string, hunks []patchHunk) (string, error) {
+	lines := strings.SplitAfter(content, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	var out []string
+	next := 0 // the first line not yet copied to out
+	for n, hunk := range hunks {
+		before, after := hunk.oldAndNew()
+		want := hunk.oldStart - 1
+		if hunk.oldCount == 0 {
+			want = hunk.oldStart // a hunk only adding lines gives the line it adds them after
+		}
+		at := findHunk(lines, before, want, next)
+		if at < 0 {
+			return "", fmt.Errorf("hunk %d (at line %d) does not apply", n+1, hunk.oldStart)
+		}
+		out = append(out, lines[next:at]...)
+		out = append(out, after...)
+		next = at + len(before)
+	}
+	out = append(out, lines[next:]...)
+	return strings.Join(out, ""), nil
+}
+
+// findHunk finds where the lines given appear, at or after the index from, as near as possible to
+// the index wanted. It returns -1 if they don't appear.
+func findHunk(lines, old []string, want, from int) int {
+	matches := func(at int) bool {
+		if at < from || at+len(old) > len(lines) {
+			return false
+		}
+		for i := range old {
+			if lines[at+i] != old[i] {
+				return false
+			}
+		}
+		return true
+	}
+	for offset := 0; want-offset >= from || want+offset <= len(lines); offset++ {
+		if matches(want - offset) {
+			return want - offset
+		}
+		if matches(want + offset) {
+			return want + offset
+		}
+	}
+	return -1
+}
+
+// applyPatch applies a unified diff to the files in the directory given. Paths in the diff are
+// relative to the directory, and may not lead outside it.
+func applyPatch(root, text string) error {
+	files, err := parsePatch(text)
+	if err != nil {
+		return err
+	}
+	for _, file := range files {
+		for _, p := range []string{file.oldPath, file.newPath} {
+			if p != "" && !filepath.IsLocal(filepath.FromSlash(p)) {
+				return fmt.Errorf("path %q is outside the source", p)
+			}
+		}
+		if file.oldPath == "" && file.newPath == "" {
+			return errors.New("a file patch must give a path")
+		}
+
+		var content string
+		mode := os.FileMode(0644)
+		if file.oldPath != "" {
+			oldPath := filepath.Join(root, filepath.FromSlash(file.oldPath))
+			info, err := os.Stat(oldPath)
+			if err != nil {
+				return fmt.Errorf("%s: %w", file.oldPath, err)
+			}
+			mode = info.Mode().Perm()
+			b, err := os.ReadFile(oldPath)
+			if err != nil {
+				return fmt.Errorf("%s: %w", file.oldPath, err)
+			}
+			content = string(b)
+		}
+		patched, err := applyHunks(content, file.hunks)
+		if err != nil {
+			return fmt.Errorf("%s: %w", file.name(), err)
+		}
+
+		if file.newPath == "" {
+			if patched != "" {
+				return fmt.Errorf("%s: file to be deleted has content not in the patch", file.oldPath)
+			}
+			if err := os.Remove(filepath.Join(root, filepath.FromSlash(file.oldPath))); err != nil {
+				return fmt.Errorf("%s: %w", file.oldPath, err)
+			}
+			continue
+		}
+		newPath := filepath.Join(root, filepath.FromSlash(file.newPath))
+		if err := os.MkdirAll(filepath.Dir(newPath), 0700); err != nil {
+			return fmt.Errorf("%s: %w", file.newPath, err)
+		}
+		if err := os.WriteFile(newPath, []byte(patched), mode); err != nil {
+			return fmt.Errorf("%s: %w", file.newPath, err)
+		}
+		if file.oldPath != "" && file.oldPath != file.newPath {
+			if err := os.Remove(filepath.Join(root, filepath.FromSlash(file.oldPath))); err != nil {
+				return fmt.Errorf("%s: %w", file.oldPath, err)
+			}
+		}
+	}
+	return nil
+}
+
+// applyPatches applies the patches given in .spec.patches to the source in the workspace
+// directory, in order. The project directory given must be in the workspace directory, since a
+// project used in place is not to be changed.
+func (sess *reconcileStackSession) applyPatches(projectDir string) error {
+	root := sess.getWorkspaceDir()
+	if rel, err := filepath.Rel(root, projectDir); err != nil || !filepath.IsLocal(rel) && rel != "." {
+		return fmt.Errorf("%w: patches can only be applied to a copy of the project; set copyProjectPath", errPatchFailed)
+	}
+	for i, p := range sess.stack.Patches {
+		if err := applyPatch(root, p); err != nil {
+			return fmt.Errorf("%w: patches[%d]: %v", errPatchFailed, i, err)
+		}
+	}
+	sess.logger.Info("WARNING: applied patches to the stack's source", "Stack.Name", sess.stack.Stack,
+		"Count", len(sess.stack.Patches), "Checksum", patchesChecksum(sess.stack.Patches))
+	return nil
+}
+
+// patchFailed records that the patches given could not be applied, and gives up on the stack until
+// it is changed.
+func (r *ReconcileStack) patchFailed(sess *reconcileStackSession, instance *pulumiv1.Stack, err error) (reconcile.Result, error) {
+	r.markStackFailed(sess, instance, err, "", "")
+	return r.abandon(instance, pulumiv1.StalledPatchFailedReason, err.Error())
+}
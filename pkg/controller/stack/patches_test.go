@@ -0,0 +1,102 @@
+// Copyright 2024, Pulumi Corporation.  All rights reserved.
+
+package stack
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestApplyPatch(t *testing.T) {
+	writeFiles := func(t *testing.T, files map[string]string) string {
+		dir := t.TempDir()
+		for name, content := range files {
+			path := filepath.Join(dir, name)
+			require.NoError(t, os.MkdirAll(filepath.Dir(path), 0700))
+			require.NoError(t, os.WriteFile(path, []byte(content), 0600))
+		}
+		return dir
+	}
+	readFile := func(t *testing.T, dir, name string) string {
+		b, err := os.ReadFile(filepath.Join(dir, name))
+		require.NoError(t, err)
+		return string(b)
+	}
+
+	t.Run("git diff", func(t *testing.T) {
+		dir := writeFiles(t, map[string]string{
+			"app/index.ts": "import * as aws from \"@pulumi/aws\";\n\nconst size = \"t3.micro\";\nexport const name = \"app\";\n",
+			"README.md":    "old\n",
+		})
+		patch := `diff --git a/app/index.ts b/app/index.ts
+index 1111111..2222222 100644
+--- a/app/index.ts
++++ b/app/index.ts
+@@ -2,3 +2,3 @@ import * as aws from "@pulumi/aws";
+
+-const size = "t3.micro";
++const size = "t3.large";
+ export const name = "app";
+diff --git a/NOTES.md b/NOTES.md
+new file mode 100644
+--- /dev/null
++++ b/NOTES.md
+@@ -0,0 +1,2 @@
++Patched during an incident.
++No newline here
+\ No newline at end of file
+diff --git a/README.md b/README.md
+deleted file mode 100644
+--- a/README.md
++++ /dev/null
+@@ -1 +0,0 @@
+-old
+`
+		require.NoError(t, applyPatch(dir, patch))
+		assert.Equal(t, "import * as aws from \"@pulumi/aws\";\n\nconst size = \"t3.large\";\nexport const name = \"app\";\n",
+			readFile(t, dir, "app/index.ts"))
+		assert.Equal(t, "Patched during an incident.\nNo newline here", readFile(t, dir, "NOTES.md"))
+		assert.NoFileExists(t, filepath.Join(dir, "README.md"))
+	})
+
+	t.Run("offset hunks", func(t *testing.T) {
+		dir := writeFiles(t, map[string]string{"main.go": "a\nb\nc\nd\ne\nf\n"})
+		// the header says line 1, but the lines are found further on
+		patch := "--- main.go\t2024-01-01 00:00:00\n+++ main.go\t2024-01-01 00:00:00\n@@ -1,2 +1,2 @@\n d\n-e\n+E\n"
+		require.NoError(t, applyPatch(dir, patch))
+		assert.Equal(t, "a\nb\nc\nd\nE\nf\n", readFile(t, dir, "main.go"))
+	})
+
+	t.Run("does not apply", func(t *testing.T) {
+		dir := writeFiles(t, map[string]string{"main.go": "a\nb\n"})
+		err := applyPatch(dir, "--- a/main.go\n+++ b/main.go\n@@ -1,2 +1,2 @@\n a\n-x\n+y\n")
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "main.go: hunk 1")
+		assert.Equal(t, "a\nb\n", readFile(t, dir, "main.go"), "file is left as it was")
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		dir := writeFiles(t, map[string]string{"main.go": "a\n"})
+		for _, patch := range []string{
+			"not a diff",
+			"--- a/main.go\n+++ b/main.go\n",
+			"--- a/main.go\n+++ b/main.go\n@@ -1 +1 @@\n-a\n",
+			"--- a/main.go\n+++ b/main.go\n@@ one @@\n-a\n+b\n",
+			"--- /dev/null\n+++ b/../outside.go\n@@ -0,0 +1 @@\n+x\n",
+		} {
+			assert.Error(t, applyPatch(dir, patch), patch)
+		}
+		assert.NoFileExists(t, filepath.Join(filepath.Dir(dir), "outside.go"))
+	})
+}
+
+func TestPatchesChecksum(t *testing.T) {
+	assert.Equal(t, "", patchesChecksum(nil))
+	a := patchesChecksum([]string{"--- a\n", "+++ b\n"})
+	assert.Regexp(t, "^sha256:[0-9a-f]{64}$", a)
+	assert.NotEqual(t, a, patchesChecksum([]string{"--- a\n+++ b\n"}))
+}
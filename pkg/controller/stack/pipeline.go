@@ -0,0 +1,314 @@
+// Copyright 2024, Pulumi Corporation.  All rights reserved.
+
+package stack
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/pulumi/pulumi-kubernetes-operator/pkg/apis/pulumi/shared"
+	pulumiv1 "github.com/pulumi/pulumi-kubernetes-operator/pkg/apis/pulumi/v1"
+	"github.com/pulumi/pulumi-kubernetes-operator/pkg/logging"
+)
+
+// The reconcile pipeline -- fetching the source, resolving the environment and configuration,
+// running an operation, and mapping its outcome to a result -- is available to other controllers
+// through Pipeline, so that they can reconcile a stack given by a StackSpec without creating a
+// Stack object for this operator to process. Pipeline uses the same steps as Reconcile; what it
+// leaves out is everything to do with the Stack object: its status, events, finalizer,
+// prerequisites, and the decisions about when to run again.
+
+// PipelineStep names a step of the reconcile pipeline, as given to PipelineCallbacks.OnStep.
+type PipelineStep string
+
+const (
+	PipelineStepFetch     PipelineStep = "Fetch"
+	PipelineStepEnv       PipelineStep = "Env"
+	PipelineStepPreRun    PipelineStep = "PreRun"
+	PipelineStepRefresh   PipelineStep = "Refresh"
+	PipelineStepImport    PipelineStep = "Import"
+	PipelineStepUpdate    PipelineStep = "Update"
+	PipelineStepDestroy   PipelineStep = "Destroy"
+	PipelineStepOutputs   PipelineStep = "Outputs"
+	PipelineStepPostRun   PipelineStep = "PostRun"
+	PipelineStepCompleted PipelineStep = "Completed"
+)
+
+// PipelineCallbacks lets the caller of a Pipeline follow its progress. Each callback is optional.
+type PipelineCallbacks struct {
+	// OnStep is called as each step begins.
+	OnStep func(step PipelineStep)
+	// OnRevision is called once the source has been fetched, with the revision fetched.
+	OnRevision func(revision string)
+}
+
+// Pipeline runs the reconcile pipeline for a stack.
+type Pipeline struct {
+	// Client is used to read the objects the stack refers to (Secrets, ConfigMaps, Programs, Flux
+	// sources, and other stacks).
+	Client client.Client
+	// Namespace is the namespace in which the objects the stack refers to are found.
+	Namespace string
+	// Name identifies the stack's working directory, which is kept between runs (e.g., so that a
+	// git source needn't be cloned from scratch); it must be unique within the namespace.
+	Name string
+	// Logger is given the progress of the pipeline and the output of the Pulumi CLI.
+	Logger logging.Logger
+	// Callbacks are called as the pipeline progresses.
+	Callbacks PipelineCallbacks
+}
+
+// PipelineResult is the outcome of running a Pipeline.
+type PipelineResult struct {
+	// Revision is the revision of the source the operation was run at.
+	Revision string
+	// Status is the status of the update; it's only set by Update.
+	Status shared.StackUpdateStatus
+	// Permalink links to the operation in the Pulumi Service, if the stack uses it.
+	Permalink shared.Permalink
+	// Outputs are the stack's outputs after the update; they're only set by Update.
+	Outputs shared.StackOutputs
+	// Imported are the resources imported into the stack before the update.
+	Imported []pulumiv1.ImportedResource
+}
+
+// ErrPipelineSpecInvalid is wrapped by the errors from a Pipeline which won't go away by running
+// it again with the same spec.
+var ErrPipelineSpecInvalid = errors.New("invalid stack spec")
+
+// IsPipelineSpecInvalid reports whether the error given is one which won't go away by running a
+// Pipeline again with the same spec.
+func IsPipelineSpecInvalid(err error) bool {
+	return errors.Is(err, ErrPipelineSpecInvalid) || isStalledError(err)
+}
+
+// Update fetches the source of the stack, then refreshes it (if spec.refresh or
+// spec.refreshConfig.enabled is set), imports the resources given in spec.imports, and updates it.
+func (p *Pipeline) Update(ctx context.Context, spec shared.StackSpec) (*PipelineResult, error) {
+	sess, revision, err := p.prepare(ctx, spec)
+	if sess != nil {
+		defer sess.CleanupWorkspaceDir()
+	}
+	if err != nil {
+		return nil, err
+	}
+	res := &PipelineResult{Revision: revision}
+
+	p.step(PipelineStepPreRun)
+	if err := sess.runCommands(ctx, "pre-run", spec.PreRunCommands); err != nil {
+		return res, err
+	}
+
+	if refresh := refreshOptions(&spec); refresh.Enabled {
+		p.step(PipelineStepRefresh)
+		permalink, err := sess.refreshBeforeUpdate(ctx, refresh, spec.Targets)
+		res.Permalink = permalink
+		if err != nil && (!spec.ContinueOnRefreshError || isUnexpectedRefreshChanges(err)) {
+			return res, fmt.Errorf("refreshing stack: %w", err)
+		}
+	}
+
+	if len(spec.Imports) > 0 {
+		p.step(PipelineStepImport)
+		err := sess.ImportResources(ctx)
+		res.Imported = sess.imported
+		if err != nil {
+			return res, err
+		}
+	}
+
+	p.step(PipelineStepUpdate)
+	status, permalink, result, err := sess.UpdateStack(ctx, spec.Targets)
+	res.Status, res.Permalink = status, permalink
+	if err != nil {
+		return res, err
+	}
+
+	p.step(PipelineStepOutputs)
+	if res.Outputs, err = sess.GetStackOutputs(result.Outputs); err != nil {
+		return res, fmt.Errorf("getting stack outputs: %w", err)
+	}
+
+	p.step(PipelineStepPostRun)
+	if err := sess.runCommands(ctx, "post-run", spec.PostRunCommands); err != nil {
+		return res, err
+	}
+	if err := sess.SaveWorkspaceCache(revision); err != nil {
+		sess.logger.Info("Unable to cache workspace", "Error", err.Error())
+	}
+	p.step(PipelineStepCompleted)
+	return res, nil
+}
+
+// Destroy fetches the source of the stack, then destroys its resources and removes it. The
+// stack's working directory is removed too.
+func (p *Pipeline) Destroy(ctx context.Context, spec shared.StackSpec) (*PipelineResult, error) {
+	sess, revision, err := p.prepare(ctx, spec)
+	if err != nil {
+		if sess != nil {
+			sess.CleanupWorkspaceDir()
+		}
+		return nil, err
+	}
+	defer sess.cleanupRootDir()
+	res := &PipelineResult{Revision: revision}
+
+	if spec.RefreshBeforeDestroy {
+		p.step(PipelineStepRefresh)
+		if res.Permalink, err = sess.RefreshStack(ctx, false, nil); err != nil {
+			return res, fmt.Errorf("refreshing stack before destroying it: %w", err)
+		}
+	}
+
+	p.step(PipelineStepDestroy)
+	if err := sess.DestroyStack(ctx); err != nil {
+		return res, err
+	}
+	p.step(PipelineStepCompleted)
+	return res, nil
+}
+
+func (p *Pipeline) step(step PipelineStep) {
+	if p.Callbacks.OnStep != nil {
+		p.Callbacks.OnStep(step)
+	}
+}
+
+// prepare checks the spec, fetches the source of the stack into a workspace, and sets up the
+// workspace's environment. The session is returned if the workspace directory was created, so
+// that the caller can clean it up.
+func (p *Pipeline) prepare(ctx context.Context, spec shared.StackSpec) (*reconcileStackSession, string, error) {
+	if err := validateSpec(&spec); err != nil {
+		return nil, "", err
+	}
+	logger := p.Logger
+	if logger == nil {
+		logger = logging.WithValues(log, "Namespace", p.Namespace, "Name", p.Name)
+	}
+	sess := newReconcileStackSession(logger, spec, p.Client, p.Namespace)
+	sess.objectMeta.Name, sess.objectMeta.Namespace = p.Name, p.Namespace
+	sess.sameNamespaceSecretsOnly = sameNamespaceSecretsOnly(ctx, p.Client, p.Namespace)
+
+	if _, err := sess.MakeRootDir(p.Namespace, p.Name); err != nil {
+		return nil, "", fmt.Errorf("unable to create root directory for stack: %w", err)
+	}
+	if err := sess.readConfigFrom(ctx); err != nil {
+		return nil, "", err
+	}
+	if _, err := sess.MakeWorkspaceDir(); err != nil {
+		return nil, "", fmt.Errorf("unable to create tmp directory for workspace: %w", err)
+	}
+
+	p.step(PipelineStepFetch)
+	revision, err := sess.fetchSource(ctx)
+	if err != nil {
+		return sess, "", err
+	}
+	if p.Callbacks.OnRevision != nil {
+		p.Callbacks.OnRevision(revision)
+	}
+
+	p.step(PipelineStepEnv)
+	if err := sess.SetEnvs(ctx, spec.Envs, p.Namespace); err != nil {
+		return sess, revision, fmt.Errorf("could not find ConfigMap for Envs: %w", err)
+	}
+	if err := sess.SetSecretEnvs(ctx, spec.SecretEnvs, p.Namespace); err != nil {
+		return sess, revision, fmt.Errorf("could not find Secret for SecretEnvs: %w", err)
+	}
+	return sess, revision, nil
+}
+
+// fetchSource sets up the workspace from whichever source the stack has, giving the revision
+// fetched. The sources are checked as Reconcile checks them, though the errors are returned
+// rather than reported in a status.
+func (sess *reconcileStackSession) fetchSource(ctx context.Context) (string, error) {
+	stack := sess.stack
+	invalid := func(msg string) error { return fmt.Errorf("%w: %s", ErrPipelineSpecInvalid, msg) }
+
+	switch {
+	case !exactlyOneOf(stack.GitSource != nil, stack.FluxSource != nil, stack.ProgramRef != nil, stack.ProgramFrom != nil):
+		return "", fmt.Errorf("%w: %w", ErrPipelineSpecInvalid, errOtherThanOneSourceSpecified)
+
+	case stack.GitSource != nil && stack.GitSource.ProjectArchiveURL != "":
+		source := stack.GitSource
+		if source.ProjectRepo != "" || source.ProjectPath != "" || source.Commit != "" || source.Branch != "" || source.Tag != "" {
+			return "", invalid("Stack source cannot specify 'projectArchiveURL' along with any of 'projectRepo', 'projectPath', 'branch', 'commit' or 'tag'")
+		}
+		return sess.SetupWorkdirFromArchive(ctx, source)
+
+	case stack.GitSource != nil && stack.GitSource.ProjectPath != "":
+		source := stack.GitSource
+		if source.ProjectRepo != "" || source.Commit != "" || source.Branch != "" || source.Tag != "" {
+			return "", invalid("Stack source cannot specify 'projectPath' along with any of 'projectRepo', 'branch', 'commit' or 'tag'")
+		}
+		return sess.SetupWorkdirFromLocalPath(ctx, source)
+
+	case stack.GitSource != nil:
+		source := stack.GitSource
+		if source.ProjectRepo == "" || (source.Commit == "" && source.Branch == "" && source.Tag == "") ||
+			(source.Tag != "" && (source.Commit != "" || source.Branch != "")) {
+			return "", invalid("Stack git source needs to specify 'projectRepo' and one of 'branch', 'commit' or 'tag'")
+		}
+		gitAuth, err := sess.SetupGitAuth(ctx)
+		if err != nil {
+			return "", fmt.Errorf("setting up git authentication: %w", err)
+		}
+		hostKeys, err := sess.SetupGitHostKeyPolicy(ctx)
+		if err != nil {
+			return "", fmt.Errorf("setting up git host key verification: %w", err)
+		}
+		if gitAuth.SSHPrivateKey != "" && hostKeys.ScanHostKeys() {
+			if err := sess.addSSHKeysToKnownHosts(source.ProjectRepo); err != nil {
+				return "", fmt.Errorf("adding SSH host keys to known hosts: %w", err)
+			}
+		}
+		return sess.SetupWorkdirFromGitSource(ctx, gitAuth, hostKeys, source)
+
+	case stack.FluxSource != nil:
+		fluxSource := stack.FluxSource
+		sourceNamespace := fluxSourceNamespace(sess.namespace, fluxSource.SourceRef)
+		if !IsNamespaceIsolationWaived() && sourceNamespace != sess.namespace {
+			return "", fmt.Errorf("cannot use source in namespace %q: %w", sourceNamespace, errNamespaceIsolation)
+		}
+		var sourceObject unstructured.Unstructured
+		sourceObject.SetAPIVersion(fluxSource.SourceRef.APIVersion)
+		sourceObject.SetKind(fluxSource.SourceRef.Kind)
+		if err := sess.kubeClient.Get(ctx, client.ObjectKey{
+			Name:      fluxSource.SourceRef.Name,
+			Namespace: sourceNamespace,
+		}, &sourceObject); err != nil {
+			return "", fmt.Errorf("could not resolve sourceRef: %w", err)
+		}
+		if err := checkFluxSourceReady(sourceObject); err != nil {
+			return "", err
+		}
+		return sess.SetupWorkdirFromFluxSource(ctx, sourceObject, fluxSource)
+
+	case stack.ProgramRef != nil:
+		return sess.SetupWorkdirFromYAML(ctx, *stack.ProgramRef)
+
+	default:
+		return sess.SetupWorkdirFromConfigMap(ctx, stack.ProgramFrom)
+	}
+}
+
+// validateSpec makes the checks of the spec which are made before anything is fetched, since
+// they can't be fixed by retrying. Each problem is reported as a StallError.
+func validateSpec(spec *shared.StackSpec) error {
+	for _, validate := range []func(*shared.StackSpec) error{
+		validateBackend,
+		validateConfigValues,
+		validateFieldRefs,
+		validateSecretsProvider,
+	} {
+		if err := validate(spec); err != nil {
+			return err
+		}
+	}
+	_, err := buildConfigPaths(spec)
+	return err
+}
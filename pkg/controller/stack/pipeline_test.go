@@ -0,0 +1,50 @@
+// Copyright 2024, Pulumi Corporation.  All rights reserved.
+
+package stack
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	"github.com/pulumi/pulumi-kubernetes-operator/pkg/apis/pulumi/shared"
+	"github.com/pulumi/pulumi-kubernetes-operator/pkg/logging"
+)
+
+func TestExactlyOneOf(t *testing.T) {
+	assert.False(t, exactlyOneOf())
+	assert.False(t, exactlyOneOf(false, false))
+	assert.True(t, exactlyOneOf(false, true, false))
+	assert.False(t, exactlyOneOf(true, false, true))
+}
+
+func TestPipelineInvalidSpec(t *testing.T) {
+	p := &Pipeline{
+		Client:    fake.NewFakeClientWithScheme(scheme.Scheme),
+		Namespace: namespace,
+		Name:      t.Name(),
+		Logger:    logging.NewLogger(t.Name(), "Request.Test", "TestPipelineInvalidSpec"),
+	}
+	var steps []PipelineStep
+	p.Callbacks.OnStep = func(step PipelineStep) { steps = append(steps, step) }
+
+	// checked before anything is fetched
+	t.Setenv("PULUMI_CONFIG_PASSPHRASE", "")
+	t.Setenv("PULUMI_CONFIG_PASSPHRASE_FILE", "")
+	_, err := p.Update(context.TODO(), shared.StackSpec{SecretsProvider: "passphrase"})
+	assert.True(t, IsPipelineSpecInvalid(err))
+	assert.Empty(t, steps)
+
+	// checked when fetching the source
+	_, err = p.Update(context.TODO(), shared.StackSpec{Stack: "dev"})
+	assert.True(t, IsPipelineSpecInvalid(err))
+	assert.ErrorIs(t, err, errOtherThanOneSourceSpecified)
+
+	_, err = p.Destroy(context.TODO(), shared.StackSpec{Stack: "dev", GitSource: &shared.GitSource{ProjectRepo: "https://github.com/pulumi/examples"}})
+	assert.True(t, IsPipelineSpecInvalid(err))
+	assert.ErrorContains(t, err, "needs to specify 'projectRepo' and one of 'branch', 'commit' or 'tag'")
+	assert.Equal(t, []PipelineStep{PipelineStepFetch, PipelineStepFetch}, steps)
+}
@@ -0,0 +1,94 @@
+// Copyright 2024, Pulumi Corporation.  All rights reserved.
+
+package stack
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/pulumi/pulumi/sdk/v3/go/auto"
+	"github.com/pulumi/pulumi/sdk/v3/go/auto/optpreview"
+	"github.com/pulumi/pulumi/sdk/v3/go/common/apitype"
+	"github.com/pulumi/pulumi/sdk/v3/go/common/util/contract"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	"github.com/pulumi/pulumi-kubernetes-operator/pkg/apis/pulumi/shared"
+	pulumiv1 "github.com/pulumi/pulumi-kubernetes-operator/pkg/apis/pulumi/v1"
+)
+
+// A stack with previewOnly set is previewed in place of being updated, each time it would
+// otherwise be updated, and the outcome is recorded in .status.lastPreview. Nothing the preview
+// does changes the stack's resources or its state: a refresh, if asked for, is run as part of the
+// preview, and the imports and post-run commands, which exist to go with an update, are not run.
+// Since the operator never applies such a stack, it never destroys it either.
+
+// previewResourceChanges gives the changes a preview found an update would make, by operation.
+func previewResourceChanges(summary map[apitype.OpType]int) map[string]int {
+	var changes map[string]int
+	for op, n := range summary {
+		if op != apitype.OpSame && n > 0 {
+			if changes == nil {
+				changes = map[string]int{}
+			}
+			changes[string(op)] = n
+		}
+	}
+	return changes
+}
+
+// PreviewStack runs a preview of the stack and returns its result, and the Pulumi Service URL of
+// the preview. It accepts a list of URNs to target, as UpdateStack does.
+func (sess *reconcileStackSession) PreviewStack(ctx context.Context, targets []string) (auto.PreviewResult, shared.Permalink, error) {
+	defer sess.timer.enter(phaseUpdate)()
+	writer := sess.logger.LogWriterDebug("Pulumi Preview")
+	defer contract.IgnoreClose(writer)
+
+	opts := []optpreview.Option{optpreview.ProgressStreams(writer), optpreview.UserAgent(execAgent)}
+	if targets != nil {
+		opts = append(opts, optpreview.Target(targets))
+	}
+	if sess.stack.Parallel > 0 {
+		opts = append(opts, optpreview.Parallel(sess.stack.Parallel))
+	}
+	if refreshOptions(&sess.stack).Enabled {
+		opts = append(opts, optpreview.Refresh())
+	}
+
+	result, err := sess.autoStack.Preview(ctx, opts...)
+	var permalink shared.Permalink
+	if p, perr := auto.GetPermalink(result.StdOut); perr == nil {
+		permalink = credentialFreePermalink(p)
+	}
+	if err != nil {
+		return result, permalink, fmt.Errorf("previewing stack %q: %w", sess.stack.Stack, err)
+	}
+	return result, permalink, nil
+}
+
+// previewInsteadOfUpdate previews the stack, in place of updating it, and records the outcome in
+// the status. The result given is returned if the preview succeeds.
+func (r *ReconcileStack) previewInsteadOfUpdate(ctx context.Context, sess *reconcileStackSession, instance *pulumiv1.Stack, currentCommit string, done reconcile.Result) reconcile.Result {
+	result, permalink, err := sess.PreviewStack(ctx, sess.stack.Targets)
+	preview := &pulumiv1.StackPreviewState{
+		State:     shared.SucceededStackStateMessage,
+		Time:      metav1.Now(),
+		Revision:  currentCommit,
+		Permalink: permalink,
+	}
+	instance.Status.LastPreview = preview
+	if err != nil {
+		preview.State = shared.FailedStackStateMessage
+		preview.Message = err.Error()
+		r.emitEvent(instance, pulumiv1.StackUpdateFailureEvent(), "Failed to preview Stack: %v.", err.Error())
+		sess.logger.Error(err, "Failed to preview Stack", "Stack.Name", sess.stack.Stack)
+		instance.Status.MarkReconcilingCondition(pulumiv1.ReconcilingRetryReason, err.Error())
+		return reconcile.Result{Requeue: true}
+	}
+	preview.ResourceChanges = previewResourceChanges(result.ChangeSummary)
+	preview.ChangesDetected = len(preview.ResourceChanges) > 0
+	sess.logger.Info("Previewed stack", "Stack.Name", sess.stack.Stack, "Revision", currentCommit,
+		"Changes", describeResourceChanges(preview.ResourceChanges))
+	instance.Status.MarkReadyCondition()
+	return done
+}
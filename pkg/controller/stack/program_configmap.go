@@ -0,0 +1,84 @@
+// Copyright 2024, Pulumi Corporation.  All rights reserved.
+
+package stack
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/pulumi/pulumi-kubernetes-operator/pkg/apis/pulumi/shared"
+)
+
+// programConfigMapIndexFieldName is the name used for indexing stacks by the ConfigMap given in
+// .spec.programFrom.configMap.
+const programConfigMapIndexFieldName = ".spec.programFrom.configMap.name" // this is an arbitrary string, named for the field it indexes
+
+// configMapRevision gives the revision reported for a project kept in a ConfigMap. This includes
+// the resourceVersion of the ConfigMap, which changes whenever it's edited, so that a deployment
+// can be correlated with the edit that caused it.
+func configMapRevision(cm *corev1.ConfigMap) string {
+	return fmt.Sprintf("%s/%s", cm.Name, cm.ResourceVersion)
+}
+
+// getProgramConfigMap fetches the ConfigMap holding the project for the stack.
+func (sess *reconcileStackSession) getProgramConfigMap(ctx context.Context, source *shared.ProgramFromSource) (*corev1.ConfigMap, error) {
+	if source.ConfigMap == nil || source.ConfigMap.Name == "" {
+		return nil, newStallErrorf("programFrom must give the name of a ConfigMap")
+	}
+	var cm corev1.ConfigMap
+	key := client.ObjectKey{Name: source.ConfigMap.Name, Namespace: sess.namespace}
+	if err := sess.kubeClient.Get(ctx, key, &cm); err != nil {
+		return nil, fmt.Errorf("fetching ConfigMap %q for programFrom: %w", source.ConfigMap.Name, err)
+	}
+	return &cm, nil
+}
+
+// SetupWorkdirFromConfigMap writes the files kept in the ConfigMap given in .spec.programFrom into
+// the workspace directory, and sets up the workspace from there.
+func (sess *reconcileStackSession) SetupWorkdirFromConfigMap(ctx context.Context, source *shared.ProgramFromSource) (string, error) {
+	workspaceDir := sess.getWorkspaceDir()
+	sess.logger.Debug("Setting up pulumi workspace for stack", "stack", sess.stack, "workspace", workspaceDir)
+
+	cm, err := sess.getProgramConfigMap(ctx, source)
+	if err != nil {
+		return "", err
+	}
+	if err := writeConfigMapProgram(cm, workspaceDir); err != nil {
+		return "", err
+	}
+
+	w, err := sess.newWorkspace(ctx, workspaceDir)
+	if err != nil {
+		return "", fmt.Errorf("failed to create local workspace: %w", err)
+	}
+
+	return configMapRevision(cm), sess.setupWorkspace(ctx, w)
+}
+
+// writeConfigMapProgram writes each key of the ConfigMap, from both data and binaryData, as a file
+// in the directory given. The keys of a ConfigMap can't contain a '/', so the project is flat. A
+// ConfigMap that doesn't contain a project file is a stall error, since it will have to be changed
+// before it can be used.
+func writeConfigMapProgram(cm *corev1.ConfigMap, dir string) error {
+	_, hasYAML := cm.Data["Pulumi.yaml"]
+	_, hasYML := cm.Data["Pulumi.yml"]
+	if !hasYAML && !hasYML {
+		return newStallErrorf("ConfigMap %q used for programFrom has no Pulumi.yaml key", cm.Name)
+	}
+	for name, content := range cm.Data {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0600); err != nil {
+			return fmt.Errorf("writing %q from ConfigMap %q: %w", name, cm.Name, err)
+		}
+	}
+	for name, content := range cm.BinaryData {
+		if err := os.WriteFile(filepath.Join(dir, name), content, 0600); err != nil {
+			return fmt.Errorf("writing %q from ConfigMap %q: %w", name, cm.Name, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,41 @@
+// Copyright 2024, Pulumi Corporation.  All rights reserved.
+
+package stack
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestWriteConfigMapProgram(t *testing.T) {
+	cm := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "program", Namespace: namespace, ResourceVersion: "42"},
+		Data: map[string]string{
+			"Pulumi.yaml":  "name: program\nruntime: nodejs\n",
+			"index.ts":     "export const x = 1;\n",
+			"package.json": "{}\n",
+		},
+		BinaryData: map[string][]byte{"logo.png": {0x89, 0x50, 0x4e, 0x47}},
+	}
+	dir := t.TempDir()
+	require.NoError(t, writeConfigMapProgram(cm, dir))
+	for name, content := range cm.Data {
+		b, err := os.ReadFile(filepath.Join(dir, name))
+		require.NoError(t, err)
+		assert.Equal(t, content, string(b))
+	}
+	b, err := os.ReadFile(filepath.Join(dir, "logo.png"))
+	require.NoError(t, err)
+	assert.Equal(t, cm.BinaryData["logo.png"], b)
+	assert.Equal(t, "program/42", configMapRevision(cm))
+
+	delete(cm.Data, "Pulumi.yaml")
+	err = writeConfigMapProgram(cm, t.TempDir())
+	assert.True(t, isStalledError(err))
+}
@@ -0,0 +1,204 @@
+// Copyright 2024, Pulumi Corporation.  All rights reserved.
+
+package stack
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/yaml"
+
+	pulumiv1 "github.com/pulumi/pulumi-kubernetes-operator/pkg/apis/pulumi/v1"
+)
+
+// projectNotFoundBackoff is how long to wait before trying a stack again, when there's no usable
+// project in its source. Trying again won't help until the source is changed; and a change to the
+// spec will requeue the stack anyway.
+const projectNotFoundBackoff = 10 * time.Minute
+
+// errProjectNotFound marks errors from checking the project directory.
+var errProjectNotFound = errors.New("no usable Pulumi project")
+
+// checkProjectDir checks that the directory holds a Pulumi project that the operator can run:
+// that it has a readable project file, which gives a name and a runtime, and that the tools for
+// installing the dependencies of the runtime are available.
+func checkProjectDir(dir string) error {
+	info, err := os.Stat(dir)
+	if err != nil {
+		return fmt.Errorf("%w: project directory %s does not exist; check repoDir", errProjectNotFound, dir)
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("%w: project directory %s is not a directory; check repoDir", errProjectNotFound, dir)
+	}
+
+	runtime, options, err := readProjectRuntime(dir)
+	if err != nil {
+		return err
+	}
+	return checkRuntime(runtime, options)
+}
+
+// readProjectRuntime reads the project file in the directory given, and returns the runtime it
+// gives, with the runtime's options if there are any.
+func readProjectRuntime(dir string) (string, map[string]interface{}, error) {
+	var projectFile string
+	for _, name := range []string{"Pulumi.yaml", "Pulumi.yml"} {
+		if _, err := os.Stat(filepath.Join(dir, name)); err == nil {
+			projectFile = filepath.Join(dir, name)
+			break
+		}
+	}
+	if projectFile == "" {
+		return "", nil, fmt.Errorf("%w: no Pulumi.yaml in %s; check repoDir", errProjectNotFound, dir)
+	}
+
+	b, err := os.ReadFile(projectFile)
+	if err != nil {
+		return "", nil, fmt.Errorf("%w: %v", errProjectNotFound, err)
+	}
+	var project struct {
+		Name    string      `json:"name"`
+		Runtime interface{} `json:"runtime"`
+	}
+	if err := yaml.Unmarshal(b, &project); err != nil {
+		return "", nil, fmt.Errorf("%w: parsing %s: %v", errProjectNotFound, filepath.Base(projectFile), err)
+	}
+	if project.Name == "" {
+		return "", nil, fmt.Errorf("%w: %s does not give a project name", errProjectNotFound, filepath.Base(projectFile))
+	}
+
+	// the runtime is given either as a name, or as a name with options
+	var runtime string
+	var options map[string]interface{}
+	switch r := project.Runtime.(type) {
+	case string:
+		runtime = r
+	case map[string]interface{}:
+		runtime, _ = r["name"].(string)
+		options, _ = r["options"].(map[string]interface{})
+	}
+	if runtime == "" {
+		return "", nil, fmt.Errorf("%w: %s does not give a runtime", errProjectNotFound, filepath.Base(projectFile))
+	}
+	return runtime, options, nil
+}
+
+// runtimeTools gives the tools needed for each runtime the operator knows about, to install the
+// dependencies of a project and run its program; see InstallProjectDependencies. Each entry is a
+// list of alternatives, at least one of which must be on the PATH.
+var runtimeTools = map[string][][]string{
+	"nodejs": {{"node"}, {"npm", "yarn"}},
+	"python": {{"python3"}, {"pip3"}},
+	"go":     {{"go"}},
+	"dotnet": {{"dotnet"}},
+}
+
+// runtimeMismatchError is returned when the tools needed for a project's runtime are not available
+// to the operator. Programs are run in the operator's own container, so the remedy is to use an
+// operator image which includes them. It counts as there being no usable project.
+type runtimeMismatchError struct {
+	runtime string
+	missing string
+}
+
+func (e *runtimeMismatchError) Error() string {
+	return fmt.Sprintf("%v: the project's runtime is %s, which needs %s; this is not on the PATH of the operator, "+
+		"which runs programs in its own container. Use an operator image that includes the %s toolchain "+
+		"(e.g., pulumi/pulumi rather than a slim image)", errProjectNotFound, e.runtime, e.missing, e.runtime)
+}
+
+func (e *runtimeMismatchError) Unwrap() error {
+	return errProjectNotFound
+}
+
+// runtimeProbe finds which runtimes the operator is able to run, as they are needed. The tools
+// available come with the operator's image, so what's found for each runtime is kept for the life
+// of the process.
+type runtimeProbe struct {
+	mu sync.Mutex
+	// missing gives, for each runtime probed, the tools missing for it, or "" if there are none.
+	missing map[string]string
+}
+
+var runtimes = &runtimeProbe{missing: map[string]string{}}
+
+// probe returns the tools missing for the runtime given, or "" if the runtime can be run or the
+// operator doesn't know about it.
+func (p *runtimeProbe) probe(runtime string) string {
+	alternatives, ok := runtimeTools[runtime]
+	if !ok {
+		return ""
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if missing, ok := p.missing[runtime]; ok {
+		return missing
+	}
+
+	missing := ""
+	for _, tools := range alternatives {
+		found := false
+		for _, tool := range tools {
+			if onPath(tool) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			missing = "'" + strings.Join(tools, "' or '") + "'"
+			break
+		}
+	}
+	p.missing[runtime] = missing
+	available := 1.0
+	if missing != "" {
+		available = 0
+	}
+	runtimeAvailable.With(prometheus.Labels{"runtime": runtime}).Set(available)
+	return missing
+}
+
+// checkRuntime checks that a project with the runtime given can be run by the operator: that the
+// tools needed for the runtime are available, and that the runtime's options are supported.
+// Runtimes the operator doesn't know about are passed, since nothing is done to install their
+// dependencies.
+func checkRuntime(runtime string, options map[string]interface{}) error {
+	if missing := runtimes.probe(runtime); missing != "" {
+		return &runtimeMismatchError{runtime: runtime, missing: missing}
+	}
+	if runtime == "python" {
+		if venv, _ := options["virtualenv"].(string); venv == "" {
+			return fmt.Errorf("%w: python projects without a `virtualenv` runtime option are not yet supported", errProjectNotFound)
+		}
+	}
+	return nil
+}
+
+func onPath(tool string) bool {
+	_, err := exec.LookPath(tool)
+	return err == nil
+}
+
+// projectNotFound records that there's no usable project in the stack's source, or that its
+// runtime can't be run by the operator, and has the stack tried again after a long wait, rather
+// than retrying it straight away.
+func (r *ReconcileStack) projectNotFound(sess *reconcileStackSession, instance *pulumiv1.Stack, err error) (reconcile.Result, error) {
+	r.emitEvent(instance, pulumiv1.StackInitializationFailureEvent(), "Failed to initialize stack: %v", err.Error())
+	r.markStackFailed(sess, instance, err, "", "")
+	reason := pulumiv1.ReconcilingProjectNotFoundReason
+	var mismatch *runtimeMismatchError
+	if errors.As(err, &mismatch) {
+		reason = pulumiv1.ReconcilingRuntimeMismatchReason
+	}
+	instance.Status.LastUpdate.Reason = reason
+	instance.Status.MarkReconcilingCondition(reason, err.Error())
+	return reconcile.Result{RequeueAfter: projectNotFoundBackoff}, nil
+}
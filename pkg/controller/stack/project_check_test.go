@@ -0,0 +1,138 @@
+// Copyright 2024, Pulumi Corporation.  All rights reserved.
+
+package stack
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	apimeta "k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+
+	"github.com/pulumi/pulumi-kubernetes-operator/pkg/apis/pulumi/shared"
+	pulumiv1 "github.com/pulumi/pulumi-kubernetes-operator/pkg/apis/pulumi/v1"
+	"github.com/pulumi/pulumi-kubernetes-operator/pkg/logging"
+)
+
+func TestCheckProjectDir(t *testing.T) {
+	for _, test := range []struct {
+		name    string
+		files   map[string]string
+		subdir  string
+		wantErr string
+	}{
+		{
+			name:  "valid",
+			files: map[string]string{"Pulumi.yaml": "name: test\nruntime: yaml\n"},
+		},
+		{
+			name:  "yml",
+			files: map[string]string{"Pulumi.yml": "name: test\nruntime:\n  name: go\n"},
+		},
+		{
+			name:   "valid in subdirectory",
+			files:  map[string]string{"infra/Pulumi.yaml": "name: test\nruntime: yaml\n"},
+			subdir: "infra",
+		},
+		{
+			name:    "missing directory",
+			files:   map[string]string{"Pulumi.yaml": "name: test\nruntime: yaml\n"},
+			subdir:  "infra",
+			wantErr: "does not exist",
+		},
+		{
+			name:    "missing project file",
+			files:   map[string]string{"main.go": "package main\n"},
+			wantErr: "no Pulumi.yaml",
+		},
+		{
+			name:    "unparseable project file",
+			files:   map[string]string{"Pulumi.yaml": "name: [test\n"},
+			wantErr: "parsing Pulumi.yaml",
+		},
+		{
+			name:    "no runtime",
+			files:   map[string]string{"Pulumi.yaml": "name: test\n"},
+			wantErr: "does not give a runtime",
+		},
+		{
+			name:    "python without virtualenv",
+			files:   map[string]string{"Pulumi.yaml": "name: test\nruntime: python\n"},
+			wantErr: "python",
+		},
+		{
+			name:  "unknown runtime",
+			files: map[string]string{"Pulumi.yaml": "name: test\nruntime: java\n"},
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			dir := t.TempDir()
+			for name, content := range test.files {
+				require.NoError(t, os.MkdirAll(filepath.Dir(filepath.Join(dir, name)), 0700))
+				require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(content), 0600))
+			}
+			err := checkProjectDir(filepath.Join(dir, test.subdir))
+			if test.wantErr == "" {
+				assert.NoError(t, err)
+				return
+			}
+			assert.ErrorContains(t, err, test.wantErr)
+			assert.True(t, errors.Is(err, errProjectNotFound))
+		})
+	}
+}
+
+func TestRuntimeProbe(t *testing.T) {
+	bin := t.TempDir()
+	t.Setenv("PATH", bin)
+	install := func(tool string) {
+		require.NoError(t, os.WriteFile(filepath.Join(bin, tool), []byte("#!/bin/sh\n"), 0700))
+	}
+	install("node")
+
+	p := &runtimeProbe{missing: map[string]string{}}
+	assert.Equal(t, "'dotnet'", p.probe("dotnet"))
+	assert.Equal(t, "'npm' or 'yarn'", p.probe("nodejs"))
+	assert.Equal(t, "", p.probe("java"), "runtimes not known about are passed")
+
+	// what's found is kept, since the tools come with the operator's image
+	install("yarn")
+	assert.Equal(t, "'npm' or 'yarn'", p.probe("nodejs"))
+	assert.Equal(t, "", (&runtimeProbe{missing: map[string]string{}}).probe("nodejs"))
+
+	err := error(&runtimeMismatchError{runtime: "dotnet", missing: "'dotnet'"})
+	assert.True(t, errors.Is(err, errProjectNotFound))
+	assert.ErrorContains(t, err, "the project's runtime is dotnet, which needs 'dotnet'")
+}
+
+func TestProjectNotFound(t *testing.T) {
+	logger := logging.NewLogger(t.Name(), "Request.Test", "TestProjectNotFound")
+	r := &ReconcileStack{recorder: record.NewFakeRecorder(10)}
+	sess := newReconcileStackSession(logger, shared.StackSpec{}, nil, namespace)
+
+	for _, test := range []struct {
+		name   string
+		err    error
+		reason string
+	}{
+		{name: "no project", err: errProjectNotFound, reason: pulumiv1.ReconcilingProjectNotFoundReason},
+		{name: "runtime mismatch", err: &runtimeMismatchError{runtime: "dotnet", missing: "dotnet"}, reason: pulumiv1.ReconcilingRuntimeMismatchReason},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			instance := &pulumiv1.Stack{ObjectMeta: metav1.ObjectMeta{Name: "project", Namespace: namespace, Generation: 1}}
+			res, err := r.projectNotFound(sess, instance, test.err)
+			require.NoError(t, err)
+			assert.Equal(t, projectNotFoundBackoff, res.RequeueAfter, "retried after a long wait")
+			reconciling := apimeta.FindStatusCondition(instance.Status.Conditions, pulumiv1.ReconcilingCondition)
+			require.NotNil(t, reconciling)
+			assert.Equal(t, test.reason, reconciling.Reason)
+			assert.Nil(t, apimeta.FindStatusCondition(instance.Status.Conditions, pulumiv1.StalledCondition), "not stalled, since it's retried")
+			assert.Equal(t, test.reason, instance.Status.LastUpdate.Reason)
+		})
+	}
+}
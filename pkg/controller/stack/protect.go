@@ -0,0 +1,109 @@
+// Copyright 2024, Pulumi Corporation.  All rights reserved.
+
+package stack
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	"github.com/pulumi/pulumi-kubernetes-operator/pkg/apis/pulumi/shared"
+	pulumiv1 "github.com/pulumi/pulumi-kubernetes-operator/pkg/apis/pulumi/v1"
+)
+
+// A stack with protectResources set has its resources protected in its state after each update,
+// as if each were given the `protect` resource option; so `pulumi destroy` (whether run by the
+// operator or by hand) refuses to delete them. When such a stack is deleted with
+// destroyOnFinalize, the operator doesn't destroy it unless allowDestroyProtectedResources is
+// also set; it's stalled with the reason DestroyProtected instead, and keeps its finalizer. With
+// allowDestroyProtectedResources, the resources are unprotected just before the stack is
+// destroyed.
+
+// setResourcesProtected sets the protection of the resources in an exported deployment, other
+// than the stack itself and providers, returning the deployment with them set and the number of
+// resources changed. If none are changed, the deployment is returned as it is.
+func setResourcesProtected(deployment json.RawMessage, protect bool) (json.RawMessage, int, error) {
+	if len(deployment) == 0 {
+		return deployment, 0, nil
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(deployment, &fields); err != nil {
+		return nil, 0, err
+	}
+	raw, ok := fields["resources"]
+	if !ok {
+		return deployment, 0, nil
+	}
+	var resources []map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &resources); err != nil {
+		return nil, 0, fmt.Errorf("reading resources: %w", err)
+	}
+	want, _ := json.Marshal(protect)
+	changed := 0
+	for _, res := range resources {
+		var typ string
+		_ = json.Unmarshal(res["type"], &typ)
+		if typ == "pulumi:pulumi:Stack" || strings.HasPrefix(typ, "pulumi:providers:") {
+			continue
+		}
+		var current bool
+		_ = json.Unmarshal(res["protect"], &current)
+		if current == protect {
+			continue
+		}
+		res["protect"] = want
+		changed++
+	}
+	if changed == 0 {
+		return deployment, 0, nil
+	}
+	b, err := json.Marshal(resources)
+	if err != nil {
+		return nil, 0, err
+	}
+	fields["resources"] = b
+	updated, err := json.Marshal(fields)
+	if err != nil {
+		return nil, 0, err
+	}
+	return updated, changed, nil
+}
+
+// setProtected exports the stack's state, and imports it again with its resources protected or
+// unprotected as given.
+func (sess *reconcileStackSession) setProtected(ctx context.Context, protect bool) error {
+	deployment, err := sess.autoStack.Export(ctx)
+	if err != nil {
+		return fmt.Errorf("exporting state of stack %q: %w", sess.stack.Stack, err)
+	}
+	updated, n, err := setResourcesProtected(deployment.Deployment, protect)
+	if err != nil {
+		return fmt.Errorf("reading state of stack %q: %w", sess.stack.Stack, err)
+	}
+	if n == 0 {
+		return nil
+	}
+	deployment.Deployment = updated
+	if err := sess.autoStack.Import(ctx, deployment); err != nil {
+		return fmt.Errorf("importing state of stack %q with resources protected=%t: %w", sess.stack.Stack, protect, err)
+	}
+	sess.logger.Info("Set protection of resources", "Stack.Name", sess.stack.Stack, "Protected", protect, "Count", n)
+	return nil
+}
+
+// destroyProtected reports whether the stack's resources are protected from being destroyed when
+// it's deleted.
+func destroyProtected(stack *shared.StackSpec) bool {
+	return stack.ProtectResources && !stack.AllowDestroyProtectedResources
+}
+
+// refuseProtectedDestroy gives up on destroying a deleted stack whose resources are protected,
+// until it's changed to allow the destroy (or not to destroy the stack at all).
+func (r *ReconcileStack) refuseProtectedDestroy(instance *pulumiv1.Stack) (reconcile.Result, error) {
+	return r.abandon(instance, pulumiv1.StalledDestroyProtectedReason,
+		"the stack has protectResources set, so it is not destroyed unless allowDestroyProtectedResources is also set; "+
+			"set allowDestroyProtectedResources to destroy it, or unset destroyOnFinalize to leave its resources in place")
+}
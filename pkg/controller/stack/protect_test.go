@@ -0,0 +1,78 @@
+// Copyright 2024, Pulumi Corporation.  All rights reserved.
+
+package stack
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/pulumi/pulumi-kubernetes-operator/pkg/apis/pulumi/shared"
+)
+
+func TestSetResourcesProtected(t *testing.T) {
+	deployment := json.RawMessage(`{
+		"manifest": {"time": "2024-05-01T12:00:00Z"},
+		"resources": [
+			{"urn": "urn:pulumi:dev::proj::pulumi:pulumi:Stack::proj-dev", "type": "pulumi:pulumi:Stack"},
+			{"urn": "urn:pulumi:dev::proj::pulumi:providers:aws::default", "type": "pulumi:providers:aws"},
+			{"urn": "urn:pulumi:dev::proj::aws:s3/bucket:Bucket::a", "type": "aws:s3/bucket:Bucket"},
+			{"urn": "urn:pulumi:dev::proj::aws:s3/bucket:Bucket::b", "type": "aws:s3/bucket:Bucket", "protect": true}
+		]
+	}`)
+	protectedOf := func(d json.RawMessage) map[string]bool {
+		var state struct {
+			Resources []struct {
+				URN     string `json:"urn"`
+				Protect bool   `json:"protect"`
+			} `json:"resources"`
+		}
+		require.NoError(t, json.Unmarshal(d, &state))
+		protected := map[string]bool{}
+		for _, res := range state.Resources {
+			protected[res.URN] = res.Protect
+		}
+		return protected
+	}
+
+	protected, n, err := setResourcesProtected(deployment, true)
+	require.NoError(t, err)
+	assert.Equal(t, 1, n)
+	assert.Equal(t, map[string]bool{
+		"urn:pulumi:dev::proj::pulumi:pulumi:Stack::proj-dev": false,
+		"urn:pulumi:dev::proj::pulumi:providers:aws::default": false,
+		"urn:pulumi:dev::proj::aws:s3/bucket:Bucket::a":       true,
+		"urn:pulumi:dev::proj::aws:s3/bucket:Bucket::b":       true,
+	}, protectedOf(protected))
+	assert.Contains(t, string(protected), `"manifest"`, "other fields are kept")
+
+	again, n, err := setResourcesProtected(protected, true)
+	require.NoError(t, err)
+	assert.Zero(t, n)
+	assert.Equal(t, protected, again, "nothing to change")
+
+	unprotected, n, err := setResourcesProtected(protected, false)
+	require.NoError(t, err)
+	assert.Equal(t, 2, n)
+	for urn, p := range protectedOf(unprotected) {
+		assert.False(t, p, urn)
+	}
+
+	empty, n, err := setResourcesProtected(nil, true)
+	require.NoError(t, err)
+	assert.Zero(t, n)
+	assert.Empty(t, empty)
+
+	_, _, err = setResourcesProtected(json.RawMessage(`{"resources": {}}`), true)
+	assert.Error(t, err)
+}
+
+func TestDestroyProtected(t *testing.T) {
+	assert.False(t, destroyProtected(&shared.StackSpec{DestroyOnFinalize: true}))
+	assert.True(t, destroyProtected(&shared.StackSpec{DestroyOnFinalize: true, ProtectResources: true}))
+	assert.False(t, destroyProtected(&shared.StackSpec{
+		DestroyOnFinalize: true, ProtectResources: true, AllowDestroyProtectedResources: true,
+	}))
+}
@@ -0,0 +1,98 @@
+// Copyright 2024, Pulumi Corporation.  All rights reserved.
+
+package stack
+
+import (
+	"context"
+
+	"github.com/pulumi/pulumi/sdk/v3/go/auto"
+	"github.com/pulumi/pulumi/sdk/v3/go/auto/optdestroy"
+	"github.com/pulumi/pulumi/sdk/v3/go/auto/opthistory"
+	"github.com/pulumi/pulumi/sdk/v3/go/auto/optpreview"
+	"github.com/pulumi/pulumi/sdk/v3/go/auto/optrefresh"
+	"github.com/pulumi/pulumi/sdk/v3/go/auto/optup"
+	"github.com/pulumi/pulumi/sdk/v3/go/common/apitype"
+)
+
+// The controller reaches Pulumi through pulumiLayer, which makes workspaces and the stacks in
+// them, and pulumiStack, which is what's used of a stack. Ordinarily these are the Automation API
+// (autoLayer and auto.Stack); the simulated layer in simulate.go stands in for them with canned
+// results, so that the controller can be run without the Pulumi CLI or any cloud.
+
+// pulumiStack is the part of auto.Stack used by the controller.
+type pulumiStack interface {
+	Workspace() auto.Workspace
+	Up(ctx context.Context, opts ...optup.Option) (auto.UpResult, error)
+	Preview(ctx context.Context, opts ...optpreview.Option) (auto.PreviewResult, error)
+	Refresh(ctx context.Context, opts ...optrefresh.Option) (auto.RefreshResult, error)
+	Destroy(ctx context.Context, opts ...optdestroy.Option) (auto.DestroyResult, error)
+	Cancel(ctx context.Context) error
+	Outputs(ctx context.Context) (auto.OutputMap, error)
+	History(ctx context.Context, pageSize int, page int, opts ...opthistory.Option) ([]auto.UpdateSummary, error)
+	Info(ctx context.Context) (auto.StackSummary, error)
+	Export(ctx context.Context) (apitype.UntypedDeployment, error)
+	Import(ctx context.Context, state apitype.UntypedDeployment) error
+	GetAllConfig(ctx context.Context) (auto.ConfigMap, error)
+	SetAllConfig(ctx context.Context, config auto.ConfigMap) error
+	ListEnvironments(ctx context.Context) ([]string, error)
+	AddEnvironments(ctx context.Context, envs ...string) error
+	RemoveEnvironment(ctx context.Context, env string) error
+}
+
+var _ pulumiStack = &auto.Stack{}
+
+// pulumiLayer makes the workspaces and stacks the controller uses.
+type pulumiLayer interface {
+	// NewWorkspace makes a workspace for the project in the directory given.
+	NewWorkspace(ctx context.Context, workDir, pulumiHome, secretsProvider string) (auto.Workspace, error)
+	// UpsertStack selects the stack named in the workspace, creating it if it doesn't exist.
+	UpsertStack(ctx context.Context, name string, w auto.Workspace) (pulumiStack, error)
+	// SelectStack selects the stack named in the workspace, which must exist.
+	SelectStack(ctx context.Context, name string, w auto.Workspace) (pulumiStack, error)
+	// RemoveStack removes the stack named, once it's been destroyed.
+	RemoveStack(ctx context.Context, name string, w auto.Workspace) error
+	// InstallsDependencies reports whether the project's dependencies must be installed before
+	// the stack is run.
+	InstallsDependencies() bool
+}
+
+// autoLayer is the pulumiLayer using the Automation API.
+type autoLayer struct{}
+
+var _ pulumiLayer = autoLayer{}
+
+func (autoLayer) NewWorkspace(ctx context.Context, workDir, pulumiHome, secretsProvider string) (auto.Workspace, error) {
+	return auto.NewLocalWorkspace(ctx,
+		auto.PulumiHome(pulumiHome),
+		auto.WorkDir(workDir),
+		auto.SecretsProvider(secretsProvider))
+}
+
+func (autoLayer) UpsertStack(ctx context.Context, name string, w auto.Workspace) (pulumiStack, error) {
+	s, err := auto.UpsertStack(ctx, name, w)
+	if err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+func (autoLayer) SelectStack(ctx context.Context, name string, w auto.Workspace) (pulumiStack, error) {
+	s, err := auto.SelectStack(ctx, name, w)
+	if err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+func (autoLayer) RemoveStack(ctx context.Context, name string, w auto.Workspace) error {
+	return w.RemoveStack(ctx, name)
+}
+
+func (autoLayer) InstallsDependencies() bool {
+	return true
+}
+
+// newWorkspace makes a workspace for the project in the directory given.
+func (sess *reconcileStackSession) newWorkspace(ctx context.Context, workDir string) (auto.Workspace, error) {
+	return sess.pulumi.NewWorkspace(ctx, workDir, sess.getPulumiHome(), sess.stack.SecretsProvider)
+}
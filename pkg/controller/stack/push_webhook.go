@@ -0,0 +1,238 @@
+// Copyright 2024, Pulumi Corporation.  All rights reserved.
+
+package stack
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+
+	"github.com/pulumi/pulumi-kubernetes-operator/pkg/apis/pulumi/shared"
+	pulumiv1 "github.com/pulumi/pulumi-kubernetes-operator/pkg/apis/pulumi/v1"
+)
+
+const (
+	// EnvPushWebhookBindAddress is the name of the environment entry giving the address on which to
+	// serve the push webhook receiver, e.g., ":8484". The receiver is not served if it's not set.
+	EnvPushWebhookBindAddress = "PUSH_WEBHOOK_BIND_ADDRESS"
+
+	// pushWebhookPathPrefix is the prefix of the path of the receiver for a stack, which is
+	// /hooks/<namespace>/<name>.
+	pushWebhookPathPrefix = "/hooks/"
+
+	// maxPushWebhookBody is the largest payload accepted; GitHub caps payloads at 25MB, but push
+	// events are usually far smaller.
+	maxPushWebhookBody = 25 * 1024 * 1024
+)
+
+// addPushWebhookReceiver serves the push webhook receiver, if an address is given for it.
+func addPushWebhookReceiver(mgr manager.Manager) error {
+	addr, ok := os.LookupEnv(EnvPushWebhookBindAddress)
+	if !ok || addr == "" {
+		return nil
+	}
+	receiver := &pushWebhookReceiver{client: mgr.GetClient(), logger: mgr.GetLogger().WithName("push-webhook")}
+	return mgr.Add(&pushWebhookServer{addr: addr, handler: receiver, logger: receiver.logger})
+}
+
+// pushWebhookServer runs the HTTP server for the receiver, for as long as the manager runs.
+type pushWebhookServer struct {
+	addr    string
+	handler http.Handler
+	logger  logr.Logger
+}
+
+// NeedLeaderElection is false, so that every replica of the operator can receive webhooks; they
+// only annotate stacks, which the leader then processes.
+func (s *pushWebhookServer) NeedLeaderElection() bool {
+	return false
+}
+
+func (s *pushWebhookServer) Start(ctx context.Context) error {
+	mux := http.NewServeMux()
+	mux.Handle(pushWebhookPathPrefix, s.handler)
+	srv := &http.Server{Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+	ln, err := net.Listen("tcp", s.addr)
+	if err != nil {
+		return fmt.Errorf("listening for push webhooks on %s: %w", s.addr, err)
+	}
+	s.logger.Info("serving push webhook receiver", "address", s.addr)
+
+	errs := make(chan error, 1)
+	go func() {
+		errs <- srv.Serve(ln)
+	}()
+	select {
+	case <-ctx.Done():
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		return srv.Shutdown(shutdownCtx)
+	case err := <-errs:
+		return err
+	}
+}
+
+// pushWebhookReceiver handles push webhooks from GitHub and GitLab (and others that sign or
+// authenticate requests in the same way), by requesting reconciliation of the stack named in the
+// path, when the ref pushed is the one the stack tracks.
+type pushWebhookReceiver struct {
+	client client.Client
+	logger logr.Logger
+}
+
+func (h *pushWebhookReceiver) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, pushWebhookPathPrefix), "/")
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		http.NotFound(w, r)
+		return
+	}
+	key := client.ObjectKey{Namespace: parts[0], Name: parts[1]}
+
+	ctx := r.Context()
+	var stack pulumiv1.Stack
+	// A stack which doesn't accept push webhooks looks the same as one which doesn't exist, so as
+	// not to reveal which stacks exist.
+	if err := h.client.Get(ctx, key, &stack); err != nil || stack.Spec.GitSource == nil || stack.Spec.GitSource.PushWebhook == nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxPushWebhookBody))
+	if err != nil {
+		http.Error(w, "unable to read body", http.StatusBadRequest)
+		return
+	}
+
+	secret, err := h.pushWebhookSecret(ctx, &stack)
+	if err != nil {
+		h.logger.Error(err, "unable to get push webhook secret", "namespace", key.Namespace, "name", key.Name)
+		http.Error(w, "unable to verify request", http.StatusInternalServerError)
+		return
+	}
+	if err := verifyPushWebhook(r.Header, body, secret); err != nil {
+		h.logger.Info("rejected push webhook", "namespace", key.Namespace, "name", key.Name, "reason", err.Error())
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var push struct {
+		Ref   string `json:"ref"`
+		After string `json:"after"`
+	}
+	if err := json.Unmarshal(body, &push); err != nil {
+		http.Error(w, "unable to parse body", http.StatusBadRequest)
+		return
+	}
+	if !pushMatchesSource(push.Ref, stack.Spec.GitSource) {
+		// this includes events other than pushes (e.g., the "ping" sent by GitHub), which have no ref
+		w.WriteHeader(http.StatusOK)
+		fmt.Fprintln(w, "ignored: the ref pushed is not tracked by the stack")
+		return
+	}
+
+	stack1 := stack.DeepCopy()
+	a := stack1.GetAnnotations()
+	if a == nil {
+		a = map[string]string{}
+	}
+	a[shared.ReconcileRequestAnnotation] = fmt.Sprintf("push of %s to %s at %s", push.After, push.Ref, time.Now().Format(time.RFC3339Nano))
+	a[shared.PushWebhookRevisionAnnotation] = push.After
+	stack1.SetAnnotations(a)
+	if err := h.client.Patch(ctx, stack1, client.MergeFrom(&stack)); err != nil {
+		h.logger.Error(err, "unable to request reconciliation for push webhook", "namespace", key.Namespace, "name", key.Name)
+		http.Error(w, "unable to request reconciliation", http.StatusInternalServerError)
+		return
+	}
+	h.logger.Info("requested reconciliation for push webhook", "namespace", key.Namespace, "name", key.Name,
+		"ref", push.Ref, "revision", push.After)
+	w.WriteHeader(http.StatusAccepted)
+	fmt.Fprintln(w, "reconciliation requested")
+}
+
+// pushWebhookSecret gets the secret shared with the git host, from the stack's own namespace.
+func (h *pushWebhookReceiver) pushWebhookSecret(ctx context.Context, stack *pulumiv1.Stack) ([]byte, error) {
+	ref := stack.Spec.GitSource.PushWebhook.SecretRef
+	var secret corev1.Secret
+	if err := h.client.Get(ctx, client.ObjectKey{Namespace: stack.Namespace, Name: ref.Name}, &secret); err != nil {
+		return nil, err
+	}
+	value, ok := secret.Data[ref.Key]
+	if !ok || len(value) == 0 {
+		return nil, fmt.Errorf("no key %q in Secret %q", ref.Key, ref.Name)
+	}
+	return value, nil
+}
+
+var errUnsignedPushWebhook = errors.New("request has no signature or token")
+
+// verifyPushWebhook checks that the request was sent by someone with the shared secret. GitHub
+// (and Gitea, etc.) sign the body with an HMAC-SHA256 of the secret; GitLab sends the secret itself
+// as a token.
+func verifyPushWebhook(header http.Header, body, secret []byte) error {
+	if sig := header.Get("X-Hub-Signature-256"); sig != "" {
+		return verifyHMAC(strings.TrimPrefix(sig, "sha256="), body, secret)
+	}
+	if sig := header.Get("X-Gitea-Signature"); sig != "" {
+		return verifyHMAC(sig, body, secret)
+	}
+	if token := header.Get("X-Gitlab-Token"); token != "" {
+		if subtle.ConstantTimeCompare([]byte(token), secret) != 1 {
+			return errors.New("token does not match")
+		}
+		return nil
+	}
+	return errUnsignedPushWebhook
+}
+
+func verifyHMAC(signature string, body, secret []byte) error {
+	got, err := hex.DecodeString(signature)
+	if err != nil {
+		return errors.New("signature is not hex-encoded")
+	}
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(body)
+	if !hmac.Equal(got, mac.Sum(nil)) {
+		return errors.New("signature does not match")
+	}
+	return nil
+}
+
+// pushMatchesSource reports whether the ref pushed is the branch or tag tracked by the git source.
+func pushMatchesSource(ref string, source *shared.GitSource) bool {
+	if ref == "" || source == nil {
+		return false
+	}
+	var want plumbing.ReferenceName
+	var err error
+	switch {
+	case source.Branch != "":
+		want, err = gitReferenceName(source.Branch)
+	case source.Tag != "":
+		want, err = gitTagReferenceName(source.Tag)
+	default:
+		// a fixed commit doesn't change when something is pushed
+		return false
+	}
+	return err == nil && want == plumbing.ReferenceName(ref)
+}
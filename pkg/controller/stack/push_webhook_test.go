@@ -0,0 +1,168 @@
+// Copyright 2024, Pulumi Corporation.  All rights reserved.
+
+package stack
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/pulumi/pulumi-kubernetes-operator/pkg/apis/pulumi/shared"
+	pulumiv1 "github.com/pulumi/pulumi-kubernetes-operator/pkg/apis/pulumi/v1"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestPushWebhookReceiver(t *testing.T) {
+	const sharedSecret = "s3cret"
+	webhookSecret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "webhook", Namespace: namespace},
+		Data:       map[string][]byte{"secret": []byte(sharedSecret)},
+	}
+	stack := func(name string, source *shared.GitSource) *pulumiv1.Stack {
+		return &pulumiv1.Stack{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace},
+			Spec:       shared.StackSpec{GitSource: source},
+		}
+	}
+	pushWebhook := &shared.PushWebhook{SecretRef: shared.SecretKeyReference{Name: "webhook", Key: "secret"}}
+	s := runtime.NewScheme()
+	require.NoError(t, scheme.AddToScheme(s))
+	require.NoError(t, pulumiv1.SchemeBuilder.AddToScheme(s))
+	c := fake.NewFakeClientWithScheme(s, webhookSecret,
+		stack("tracking-main", &shared.GitSource{Branch: "main", PushWebhook: pushWebhook}),
+		stack("no-webhook", &shared.GitSource{Branch: "main"}),
+	)
+	receiver := &pushWebhookReceiver{client: c, logger: log}
+
+	sign := func(body string) string {
+		mac := hmac.New(sha256.New, []byte(sharedSecret))
+		mac.Write([]byte(body))
+		return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+	}
+	const pushMain = `{"ref": "refs/heads/main", "after": "abc123"}`
+	const pushOther = `{"ref": "refs/heads/other", "after": "def456"}`
+
+	for _, test := range []struct {
+		name      string
+		method    string
+		path      string
+		body      string
+		header    map[string]string
+		status    int
+		requested bool
+	}{
+		{
+			name:      "GitHub push to the tracked branch",
+			path:      "/hooks/test/tracking-main",
+			body:      pushMain,
+			header:    map[string]string{"X-Hub-Signature-256": sign(pushMain)},
+			status:    http.StatusAccepted,
+			requested: true,
+		},
+		{
+			name:      "GitLab push to the tracked branch",
+			path:      "/hooks/test/tracking-main",
+			body:      pushMain,
+			header:    map[string]string{"X-Gitlab-Token": sharedSecret},
+			status:    http.StatusAccepted,
+			requested: true,
+		},
+		{
+			name:   "push to another branch",
+			path:   "/hooks/test/tracking-main",
+			body:   pushOther,
+			header: map[string]string{"X-Hub-Signature-256": sign(pushOther)},
+			status: http.StatusOK,
+		},
+		{
+			name:   "bad signature",
+			path:   "/hooks/test/tracking-main",
+			body:   pushMain,
+			header: map[string]string{"X-Hub-Signature-256": sign(pushOther)},
+			status: http.StatusUnauthorized,
+		},
+		{
+			name:   "bad token",
+			path:   "/hooks/test/tracking-main",
+			body:   pushMain,
+			header: map[string]string{"X-Gitlab-Token": "guess"},
+			status: http.StatusUnauthorized,
+		},
+		{
+			name:   "unsigned",
+			path:   "/hooks/test/tracking-main",
+			body:   pushMain,
+			status: http.StatusUnauthorized,
+		},
+		{
+			name:   "stack without a push webhook",
+			path:   "/hooks/test/no-webhook",
+			body:   pushMain,
+			header: map[string]string{"X-Hub-Signature-256": sign(pushMain)},
+			status: http.StatusNotFound,
+		},
+		{
+			name:   "no such stack",
+			path:   "/hooks/test/missing",
+			body:   pushMain,
+			header: map[string]string{"X-Hub-Signature-256": sign(pushMain)},
+			status: http.StatusNotFound,
+		},
+		{
+			name:   "not a POST",
+			method: http.MethodGet,
+			path:   "/hooks/test/tracking-main",
+			status: http.StatusMethodNotAllowed,
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			var before pulumiv1.Stack
+			require.NoError(t, c.Get(context.TODO(), client.ObjectKey{Namespace: namespace, Name: "tracking-main"}, &before))
+			method := test.method
+			if method == "" {
+				method = http.MethodPost
+			}
+			req := httptest.NewRequest(method, test.path, strings.NewReader(test.body))
+			for k, v := range test.header {
+				req.Header.Set(k, v)
+			}
+			res := httptest.NewRecorder()
+			receiver.ServeHTTP(res, req)
+			assert.Equal(t, test.status, res.Code)
+
+			var after pulumiv1.Stack
+			require.NoError(t, c.Get(context.TODO(), client.ObjectKey{Namespace: namespace, Name: "tracking-main"}, &after))
+			if test.requested {
+				assert.NotEqual(t, before.Annotations[shared.ReconcileRequestAnnotation], after.Annotations[shared.ReconcileRequestAnnotation])
+				assert.Equal(t, "abc123", after.Annotations[shared.PushWebhookRevisionAnnotation])
+			} else {
+				assert.Equal(t, before.Annotations, after.Annotations)
+			}
+		})
+	}
+}
+
+func TestPushMatchesSource(t *testing.T) {
+	assert.True(t, pushMatchesSource("refs/heads/main", &shared.GitSource{Branch: "main"}))
+	assert.True(t, pushMatchesSource("refs/heads/main", &shared.GitSource{Branch: "refs/heads/main"}))
+	assert.True(t, pushMatchesSource("refs/heads/main", &shared.GitSource{Branch: "refs/remotes/origin/main"}))
+	assert.False(t, pushMatchesSource("refs/heads/mainline", &shared.GitSource{Branch: "main"}))
+	assert.True(t, pushMatchesSource("refs/tags/v1.0.0", &shared.GitSource{Tag: "v1.0.0"}))
+	assert.False(t, pushMatchesSource("refs/heads/v1.0.0", &shared.GitSource{Tag: "v1.0.0"}))
+	assert.False(t, pushMatchesSource("refs/heads/main", &shared.GitSource{Commit: "abc123"}))
+	assert.False(t, pushMatchesSource("", &shared.GitSource{Branch: "main"}))
+	assert.False(t, pushMatchesSource("refs/heads/main", nil))
+}
@@ -0,0 +1,143 @@
+// Copyright 2024, Pulumi Corporation.  All rights reserved.
+
+package stack
+
+import (
+	"context"
+	"math/rand"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/util/workqueue"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	ctrlhandler "sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	"github.com/pulumi/pulumi-kubernetes-operator/pkg/apis/pulumi/shared"
+	pulumiv1 "github.com/pulumi/pulumi-kubernetes-operator/pkg/apis/pulumi/v1"
+)
+
+// A stack can refer to Secrets and ConfigMaps for its credentials, environment and configuration
+// (e.g., in envRefs, secretRefs or gitAuth). The stacks are indexed by the names of those objects,
+// and when one changes, each stack referring to it is queued. Since the index is kept by the
+// cache, it follows references being added and removed as stacks change.
+//
+// For a change to make a difference, the stack must be updated even if its source hasn't changed;
+// so the versions of the objects are recorded for each update, in
+// .status.lastUpdate.referencesRevision, and a change to any of them is reason enough to update
+// the stack again.
+//
+// One Secret (e.g., cloud credentials) may be shared by many stacks, so rather than being queued at
+// once, the stacks are queued after a delay, spread at random over a window that grows with the
+// number of stacks. A stack queued again while it's waiting is not queued twice, so a burst of
+// changes (e.g., several Secrets rotated together) has each stack processed once.
+//
+// The ConfigMaps given in configFrom, the Secrets given in secretsFrom and the ConfigMap given as
+// the program are watched separately; see config_from.go and program_configmap.go.
+
+const (
+	// referencedSecretIndexFieldName and referencedConfigMapIndexFieldName are the names used for
+	// indexing stacks by the Secrets and ConfigMaps they refer to.
+	referencedSecretIndexFieldName    = ".spec.referencedSecrets"    // an arbitrary name
+	referencedConfigMapIndexFieldName = ".spec.referencedConfigMaps" // an arbitrary name
+
+	// referenceChangeDelay is the least time a stack is queued after an object it refers to
+	// changes, so that changes made together are seen together.
+	referenceChangeDelay = 5 * time.Second
+	// referenceChangeSpreadPerStack is how much the window over which stacks are queued grows for
+	// each stack referring to the object that changed, up to referenceChangeMaxSpread.
+	referenceChangeSpreadPerStack = time.Second
+	referenceChangeMaxSpread      = 2 * time.Minute
+)
+
+// watchedReferences gives the names of the Secrets and ConfigMaps, in the stack's own namespace,
+// that are watched on behalf of the stack; that is, those it refers to other than the ones watched
+// for configFrom and secretsFrom.
+func watchedReferences(namespace string, spec *shared.StackSpec) (secrets, configMaps []string) {
+	allSecrets, allConfigMaps := referencedObjects(namespace, spec)
+	return without(allSecrets, secretsFromSecretNames(spec)), without(allConfigMaps, configFromConfigMapNames(spec))
+}
+
+// without gives the names not in the exceptions.
+func without(names, exceptions []string) []string {
+	var result []string
+	for _, name := range names {
+		if !contains(exceptions, name) {
+			result = append(result, name)
+		}
+	}
+	return result
+}
+
+// readReferencesRevision works out the revision of the Secrets and ConfigMaps watched on behalf of
+// the stack, from their resourceVersions, so that a change to any of them can be told apart from
+// what the last update used. An object that can't be read is given without a version; it's for
+// the code using the object to report the problem. The objects are given in order of name, since
+// most references are kept in maps.
+func (sess *reconcileStackSession) readReferencesRevision(ctx context.Context) {
+	secrets, configMaps := watchedReferences(sess.namespace, &sess.stack)
+	sort.Strings(secrets)
+	sort.Strings(configMaps)
+	var versions []string
+	for _, name := range secrets {
+		var secret corev1.Secret
+		_ = sess.kubeClient.Get(ctx, types.NamespacedName{Namespace: sess.namespace, Name: name}, &secret)
+		versions = append(versions, "secret/"+name+"@"+secret.ResourceVersion)
+	}
+	for _, name := range configMaps {
+		var configMap corev1.ConfigMap
+		_ = sess.kubeClient.Get(ctx, types.NamespacedName{Namespace: sess.namespace, Name: name}, &configMap)
+		versions = append(versions, "configmap/"+name+"@"+configMap.ResourceVersion)
+	}
+	sess.referencesRevision = strings.Join(versions, ",")
+}
+
+// referencesUnchanged reports whether the revision of the referenced objects is the same as that
+// recorded for the last successful update. A stack last updated by a version of the operator
+// which didn't record the revision is taken to be up to date, so that upgrading the operator
+// doesn't have every stack updated again.
+func referencesUnchanged(recorded, current string) bool {
+	return recorded == "" || recorded == current
+}
+
+// referenceChangeQueueDelay gives the delay before queueing a stack after an object it refers to
+// changes, when n stacks refer to the object; r is a random number in [0, 1).
+func referenceChangeQueueDelay(n int, r float64) time.Duration {
+	spread := min(time.Duration(n)*referenceChangeSpreadPerStack, referenceChangeMaxSpread)
+	return referenceChangeDelay + time.Duration(r*float64(spread))
+}
+
+// enqueueReferringStacks returns an event handler for watching Secrets or ConfigMaps, which queues
+// the stacks referring to an object, found using the index given, when it is changed or deleted.
+func enqueueReferringStacks(c client.Client, indexName string, logger logr.Logger) ctrlhandler.EventHandler {
+	enqueue := func(obj client.Object, q workqueue.RateLimitingInterface) {
+		var stacks pulumiv1.StackList
+		if err := c.List(context.TODO(), &stacks,
+			client.InNamespace(obj.GetNamespace()),
+			client.MatchingFields{indexName: obj.GetName()}); err != nil {
+			// we don't get to return an error; only to fail quietly
+			logger.Error(err, "failed to fetch stacks referring to object",
+				"index", indexName, "name", obj.GetName(), "namespace", obj.GetNamespace())
+			return
+		}
+		for i := range stacks.Items {
+			req := reconcile.Request{NamespacedName: client.ObjectKeyFromObject(&stacks.Items[i])}
+			q.AddAfter(req, referenceChangeQueueDelay(len(stacks.Items), rand.Float64()))
+		}
+	}
+	return ctrlhandler.Funcs{
+		UpdateFunc: func(e event.UpdateEvent, q workqueue.RateLimitingInterface) {
+			if e.ObjectOld.GetResourceVersion() != e.ObjectNew.GetResourceVersion() {
+				enqueue(e.ObjectNew, q)
+			}
+		},
+		DeleteFunc: func(e event.DeleteEvent, q workqueue.RateLimitingInterface) {
+			enqueue(e.Object, q)
+		},
+	}
+}
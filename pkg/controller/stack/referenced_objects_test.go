@@ -0,0 +1,108 @@
+// Copyright 2024, Pulumi Corporation.  All rights reserved.
+
+package stack
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	"github.com/pulumi/pulumi-kubernetes-operator/pkg/apis/pulumi/shared"
+	pulumiv1 "github.com/pulumi/pulumi-kubernetes-operator/pkg/apis/pulumi/v1"
+	"github.com/pulumi/pulumi-kubernetes-operator/pkg/logging"
+)
+
+func TestWatchedReferences(t *testing.T) {
+	spec := &shared.StackSpec{
+		EnvRefs: map[string]shared.ResourceRef{
+			"AWS_ACCESS_KEY_ID": shared.NewSecretResourceRef("", "aws-credentials", "accessKey"),
+			"AWS_REGION":        shared.NewConfigMapResourceRef("", "aws-settings", "region"),
+			"OTHER":             shared.NewSecretResourceRef("elsewhere", "credentials", "key"),
+		},
+		EnvFrom: []shared.EnvFromSource{
+			{ConfigMapRef: &shared.EnvFromObjectReference{Name: "env"}},
+			{SecretRef: &shared.EnvFromObjectReference{Name: "aws-credentials"}},
+		},
+		SecretsFrom: []shared.SecretsFromSource{{SecretRef: shared.SecretsFromSecretReference{Name: "settings"}}},
+		SecretRefs:  map[string]shared.ResourceRef{"password": shared.NewSecretResourceRef("", "settings", "password")},
+		ConfigFrom:  []shared.ConfigFromSource{{ConfigMapRef: shared.ConfigFromConfigMapReference{Name: "config"}}},
+		ConfigRefs:  map[string]shared.ResourceRef{"replicas": shared.NewConfigMapResourceRef("", "config", "replicas")},
+		StackConfigFrom: &shared.StackConfigSource{
+			ConfigMapRef: shared.ConfigMapSelector{Name: "stack-settings", Key: "Pulumi.prod.yaml"},
+		},
+	}
+	secrets, configMaps := watchedReferences(namespace, spec)
+	assert.ElementsMatch(t, []string{"aws-credentials"}, secrets,
+		"the Secrets in secretsFrom and in other namespaces are left out")
+	assert.ElementsMatch(t, []string{"aws-settings", "env", "stack-settings"}, configMaps,
+		"the ConfigMaps in configFrom are left out")
+}
+
+func TestReadReferencesRevision(t *testing.T) {
+	logger := logging.NewLogger(t.Name(), "Request.Test", "TestReadReferencesRevision")
+	credentials := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "aws-credentials", Namespace: namespace},
+		Data:       map[string][]byte{"accessKey": []byte("AKIA")},
+	}
+	settings := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "aws-settings", Namespace: namespace},
+		Data:       map[string]string{"region": "us-west-2"},
+	}
+	c := fake.NewFakeClientWithScheme(scheme.Scheme, credentials, settings)
+	spec := shared.StackSpec{
+		EnvRefs: map[string]shared.ResourceRef{
+			"AWS_ACCESS_KEY_ID": shared.NewSecretResourceRef("", "aws-credentials", "accessKey"),
+			"AWS_REGION":        shared.NewConfigMapResourceRef("", "aws-settings", "region"),
+			"MISSING":           shared.NewSecretResourceRef("", "missing", "key"),
+		},
+	}
+	sess := newReconcileStackSession(logger, spec, c, namespace)
+	sess.readReferencesRevision(context.TODO())
+	revision := sess.referencesRevision
+	for i := 0; i < 5; i++ {
+		sess.readReferencesRevision(context.TODO())
+		require.Equal(t, revision, sess.referencesRevision, "the revision is stable")
+	}
+	assert.Contains(t, revision, "secret/aws-credentials@")
+	assert.Contains(t, revision, "secret/missing@")
+	assert.Contains(t, revision, "configmap/aws-settings@")
+	assert.NotContains(t, revision, "AKIA")
+
+	const commit = "0123456789abcdef0123456789abcdef01234567"
+	instance := &pulumiv1.Stack{
+		ObjectMeta: metav1.ObjectMeta{Name: "website", Namespace: namespace, Generation: 1},
+		Spec:       spec,
+	}
+	instance.Status.LastUpdate = &shared.StackUpdateState{
+		State:                    shared.SucceededStackStateMessage,
+		LastSuccessfulCommit:     commit,
+		LastSuccessfulGeneration: 1,
+		ReferencesRevision:       revision,
+	}
+	assert.True(t, sess.updateUnchanged(instance, commit))
+
+	credentials.Data["accessKey"] = []byte("AKIB")
+	require.NoError(t, c.Update(context.TODO(), credentials))
+	sess.readReferencesRevision(context.TODO())
+	assert.NotEqual(t, revision, sess.referencesRevision)
+	assert.False(t, sess.updateUnchanged(instance, commit), "a referenced Secret changed")
+
+	instance.Status.LastUpdate.ReferencesRevision = ""
+	assert.True(t, sess.updateUnchanged(instance, commit), "no revision recorded by an earlier operator")
+}
+
+func TestReferenceChangeQueueDelay(t *testing.T) {
+	assert.Equal(t, referenceChangeDelay, referenceChangeQueueDelay(1, 0))
+	assert.Equal(t, referenceChangeDelay+time.Second/2, referenceChangeQueueDelay(1, 0.5))
+	assert.Equal(t, referenceChangeDelay+5*time.Second, referenceChangeQueueDelay(10, 0.5),
+		"the window grows with the number of stacks")
+	assert.Equal(t, referenceChangeDelay+referenceChangeMaxSpread/2, referenceChangeQueueDelay(1000, 0.5),
+		"up to a limit")
+}
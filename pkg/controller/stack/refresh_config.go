@@ -0,0 +1,62 @@
+// Copyright 2024, Pulumi Corporation.  All rights reserved.
+
+package stack
+
+import (
+	"context"
+
+	"github.com/pulumi/pulumi-kubernetes-operator/pkg/apis/pulumi/shared"
+)
+
+// refreshOptions gives how to refresh the stack before it's updated: .spec.refreshConfig if it's
+// given, otherwise the legacy fields refresh and expectNoRefreshChanges.
+func refreshOptions(spec *shared.StackSpec) shared.RefreshConfig {
+	if spec.RefreshConfig != nil {
+		return *spec.RefreshConfig
+	}
+	return shared.RefreshConfig{
+		Enabled:         spec.Refresh,
+		ExpectNoChanges: spec.ExpectNoRefreshChanges,
+	}
+}
+
+// refreshTargets gives the URNs to refresh when some are to be ignored: those given as targets,
+// or if there are none, those of all the resources in the state, less those ignored.
+func refreshTargets(targets []string, resources []stateResource, ignore []string) []string {
+	if targets == nil {
+		for _, r := range resources {
+			targets = append(targets, r.URN)
+		}
+	}
+	var refresh []string
+	for _, urn := range targets {
+		if !contains(ignore, urn) {
+			refresh = append(refresh, urn)
+		}
+	}
+	return refresh
+}
+
+// refreshBeforeUpdate refreshes the stack as given, before it's updated. Resources to be ignored
+// are left out by targeting the rest, and are recorded with the refresh in the status; if that
+// leaves nothing to refresh, the refresh is skipped.
+func (sess *reconcileStackSession) refreshBeforeUpdate(ctx context.Context, refresh shared.RefreshConfig, targets []string) (shared.Permalink, error) {
+	if len(refresh.IgnoreTargets) == 0 {
+		return sess.RefreshStack(ctx, refresh.ExpectNoChanges, targets)
+	}
+	var resources []stateResource
+	if targets == nil {
+		var err error
+		if resources, err = sess.stateResources(ctx); err != nil {
+			return "", err
+		}
+	}
+	targets = refreshTargets(targets, resources, refresh.IgnoreTargets)
+	if len(targets) == 0 {
+		sess.logger.Info("All resources are ignored by the refresh; skipping it", "Stack.Name", sess.stack.Stack)
+		return "", nil
+	}
+	permalink, err := sess.RefreshStack(ctx, refresh.ExpectNoChanges, targets)
+	sess.lastRefresh.IgnoredTargets = refresh.IgnoreTargets
+	return permalink, err
+}
@@ -0,0 +1,44 @@
+// Copyright 2024, Pulumi Corporation.  All rights reserved.
+
+package stack
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/pulumi/pulumi-kubernetes-operator/pkg/apis/pulumi/shared"
+)
+
+func TestRefreshOptions(t *testing.T) {
+	assert.Equal(t, shared.RefreshConfig{}, refreshOptions(&shared.StackSpec{}))
+	assert.Equal(t, shared.RefreshConfig{Enabled: true, ExpectNoChanges: true},
+		refreshOptions(&shared.StackSpec{Refresh: true, ExpectNoRefreshChanges: true}),
+		"the legacy fields are mapped onto the config")
+
+	config := &shared.RefreshConfig{Enabled: true, IgnoreTargets: []string{"urn:a"}}
+	assert.Equal(t, *config, refreshOptions(&shared.StackSpec{
+		Refresh: false, ExpectNoRefreshChanges: true, RefreshConfig: config,
+	}), "refreshConfig takes the place of the legacy fields")
+}
+
+func TestRefreshTargets(t *testing.T) {
+	resources := []stateResource{
+		{URN: "urn:pulumi:dev::proj::pulumi:pulumi:Stack::proj-dev"},
+		{URN: "urn:pulumi:dev::proj::aws:s3/bucket:Bucket::a"},
+		{URN: "urn:pulumi:dev::proj::aws:s3/bucket:Bucket::b"},
+	}
+	ignore := []string{"urn:pulumi:dev::proj::aws:s3/bucket:Bucket::b", "urn:pulumi:dev::proj::aws:s3/bucket:Bucket::gone"}
+
+	assert.Equal(t, []string{
+		"urn:pulumi:dev::proj::pulumi:pulumi:Stack::proj-dev",
+		"urn:pulumi:dev::proj::aws:s3/bucket:Bucket::a",
+	}, refreshTargets(nil, resources, ignore), "all resources but those ignored")
+
+	targets := []string{"urn:pulumi:dev::proj::aws:s3/bucket:Bucket::a", "urn:pulumi:dev::proj::aws:s3/bucket:Bucket::b"}
+	assert.Equal(t, []string{"urn:pulumi:dev::proj::aws:s3/bucket:Bucket::a"},
+		refreshTargets(targets, nil, ignore), "the targets given but those ignored")
+
+	assert.Empty(t, refreshTargets(targets[1:], nil, ignore), "everything is ignored")
+	assert.Empty(t, refreshTargets(nil, nil, ignore), "nothing in the state")
+}
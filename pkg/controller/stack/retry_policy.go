@@ -0,0 +1,72 @@
+// Copyright 2024, Pulumi Corporation.  All rights reserved.
+
+package stack
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/pulumi/pulumi-kubernetes-operator/pkg/apis/pulumi/shared"
+)
+
+// These are the values used for the parts of a RetryPolicy which aren't given, including when
+// retryOnUpdateConflict is set without a policy. The initial backoff is the fixed interval used
+// before there were policies.
+const (
+	defaultConflictMaxRetries     = 10
+	defaultConflictInitialBackoff = 5 * time.Second
+	defaultConflictBackoffFactor  = 2.0
+
+	// maxConflictBackoff limits the wait between retries, however many there have been.
+	maxConflictBackoff = 10 * time.Minute
+)
+
+// conflictRetryPolicy is a RetryPolicy with the defaults filled in.
+type conflictRetryPolicy struct {
+	maxRetries     int32
+	initialBackoff time.Duration
+	factor         float64
+}
+
+// getConflictRetryPolicy returns the policy for retrying updates that conflict with another
+// update, and false if they aren't to be retried. An invalid policy is a stall error.
+func getConflictRetryPolicy(spec *shared.StackSpec) (conflictRetryPolicy, bool, error) {
+	policy := conflictRetryPolicy{
+		maxRetries:     defaultConflictMaxRetries,
+		initialBackoff: defaultConflictInitialBackoff,
+		factor:         defaultConflictBackoffFactor,
+	}
+	p := spec.RetryPolicy
+	if p == nil {
+		return policy, spec.RetryOnUpdateConflict, nil
+	}
+	if p.MaxRetries < 0 || p.InitialBackoffSeconds < 0 {
+		return policy, false, newStallErrorf("retryPolicy.maxRetries and retryPolicy.initialBackoffSeconds must not be negative")
+	}
+	if p.MaxRetries > 0 {
+		policy.maxRetries = p.MaxRetries
+	}
+	if p.InitialBackoffSeconds > 0 {
+		policy.initialBackoff = time.Duration(p.InitialBackoffSeconds) * time.Second
+	}
+	if p.BackoffFactor != "" {
+		factor, err := strconv.ParseFloat(p.BackoffFactor, 64)
+		if err != nil || factor < 1 {
+			return policy, false, newStallErrorf("retryPolicy.backoffFactor must be a number of at least 1, but got %q", p.BackoffFactor)
+		}
+		policy.factor = factor
+	}
+	return policy, true, nil
+}
+
+// backoff gives how long to wait before the retry given, counting from 1.
+func (p conflictRetryPolicy) backoff(retry int32) time.Duration {
+	d := float64(p.initialBackoff)
+	for i := int32(1); i < retry; i++ {
+		d *= p.factor
+		if d >= float64(maxConflictBackoff) {
+			return maxConflictBackoff
+		}
+	}
+	return time.Duration(d)
+}
@@ -0,0 +1,52 @@
+// Copyright 2024, Pulumi Corporation.  All rights reserved.
+
+package stack
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/pulumi/pulumi-kubernetes-operator/pkg/apis/pulumi/shared"
+)
+
+func TestConflictRetryPolicy(t *testing.T) {
+	t.Run("no retries", func(t *testing.T) {
+		_, retry, err := getConflictRetryPolicy(&shared.StackSpec{})
+		require.NoError(t, err)
+		assert.False(t, retry)
+	})
+
+	t.Run("retryOnUpdateConflict without a policy", func(t *testing.T) {
+		policy, retry, err := getConflictRetryPolicy(&shared.StackSpec{RetryOnUpdateConflict: true})
+		require.NoError(t, err)
+		assert.True(t, retry)
+		assert.Equal(t, int32(defaultConflictMaxRetries), policy.maxRetries)
+		assert.Equal(t, 5*time.Second, policy.backoff(1))
+		assert.Equal(t, 10*time.Second, policy.backoff(2))
+		assert.Equal(t, 20*time.Second, policy.backoff(3))
+		assert.Equal(t, maxConflictBackoff, policy.backoff(10), "backoff is limited")
+	})
+
+	t.Run("policy", func(t *testing.T) {
+		policy, retry, err := getConflictRetryPolicy(&shared.StackSpec{RetryPolicy: &shared.RetryPolicy{
+			MaxRetries:            3,
+			InitialBackoffSeconds: 30,
+			BackoffFactor:         "1.5",
+		}})
+		require.NoError(t, err)
+		assert.True(t, retry, "a policy implies retrying")
+		assert.Equal(t, int32(3), policy.maxRetries)
+		assert.Equal(t, 30*time.Second, policy.backoff(1))
+		assert.Equal(t, 45*time.Second, policy.backoff(2))
+	})
+
+	t.Run("invalid factor", func(t *testing.T) {
+		for _, factor := range []string{"0.5", "two"} {
+			_, _, err := getConflictRetryPolicy(&shared.StackSpec{RetryPolicy: &shared.RetryPolicy{BackoffFactor: factor}})
+			assert.True(t, isStalledError(err), factor)
+		}
+	})
+}
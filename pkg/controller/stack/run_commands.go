@@ -0,0 +1,63 @@
+// Copyright 2024, Pulumi Corporation.  All rights reserved.
+
+package stack
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"strings"
+
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	"github.com/pulumi/pulumi-kubernetes-operator/pkg/apis/pulumi/shared"
+	pulumiv1 "github.com/pulumi/pulumi-kubernetes-operator/pkg/apis/pulumi/v1"
+)
+
+// maxCommandStderr limits how much of what a failed command wrote to stderr is reported; the end
+// is kept, since that's usually where the cause is.
+const maxCommandStderr = 4096
+
+// commandError is returned when one of a stack's pre- or post-run commands fails.
+type commandError struct {
+	kind    string
+	command string
+	err     error
+	stderr  string
+}
+
+func (e *commandError) Error() string {
+	msg := fmt.Sprintf("%s command %q failed: %v", e.kind, e.command, e.err)
+	if stderr := strings.TrimSpace(e.stderr); stderr != "" {
+		if len(stderr) > maxCommandStderr {
+			stderr = "..." + stderr[len(stderr)-maxCommandStderr:]
+		}
+		msg += "; stderr: " + stderr
+	}
+	return msg
+}
+
+func (e *commandError) Unwrap() error {
+	return e.err
+}
+
+// runCommands runs the shell commands given one after another, in the project directory and with
+// the stack's environment, stopping at the first to fail.
+func (sess *reconcileStackSession) runCommands(ctx context.Context, kind string, commands []string) error {
+	for _, command := range commands {
+		sess.logger.Info("Running "+kind+" command", "Stack.Name", sess.stack.Stack, "Command", command)
+		cmd := exec.CommandContext(ctx, "/bin/sh", "-c", command)
+		if _, stderr, err := sess.runCmd(kind+" command", cmd, sess.autoStack.Workspace()); err != nil {
+			return &commandError{kind: kind, command: command, err: err, stderr: stderr}
+		}
+	}
+	return nil
+}
+
+// commandFailed records that a pre- or post-run command failed, and has the stack retried.
+func (r *ReconcileStack) commandFailed(sess *reconcileStackSession, instance *pulumiv1.Stack, err error, currentCommit string, permalink shared.Permalink) (reconcile.Result, error) {
+	r.markStackFailed(sess, instance, err, currentCommit, permalink)
+	instance.Status.LastUpdate.Reason = pulumiv1.ReconcilingCommandFailedReason
+	instance.Status.MarkReconcilingCondition(pulumiv1.ReconcilingCommandFailedReason, err.Error())
+	return reconcile.Result{Requeue: true}, nil
+}
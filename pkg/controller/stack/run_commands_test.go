@@ -0,0 +1,28 @@
+// Copyright 2024, Pulumi Corporation.  All rights reserved.
+
+package stack
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCommandError(t *testing.T) {
+	exitErr := errors.New("exit status 2")
+
+	err := &commandError{kind: "pre-run", command: "make generate", err: exitErr, stderr: "make: *** No rule to make target 'generate'.  Stop.\n"}
+	assert.Equal(t, `pre-run command "make generate" failed: exit status 2; stderr: make: *** No rule to make target 'generate'.  Stop.`, err.Error())
+	assert.ErrorIs(t, err, exitErr)
+
+	err = &commandError{kind: "post-run", command: "./smoke-test.sh", err: exitErr}
+	assert.Equal(t, `post-run command "./smoke-test.sh" failed: exit status 2`, err.Error())
+
+	// only the end of a long stderr is kept
+	long := strings.Repeat("x", maxCommandStderr) + "the cause"
+	err = &commandError{kind: "post-run", command: "./smoke-test.sh", err: exitErr, stderr: "start" + long}
+	assert.NotContains(t, err.Error(), "start")
+	assert.True(t, strings.HasSuffix(err.Error(), "; stderr: ..."+long[len(long)-maxCommandStderr:]))
+}
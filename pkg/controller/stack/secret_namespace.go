@@ -0,0 +1,65 @@
+// Copyright 2024, Pulumi Corporation.  All rights reserved.
+
+package stack
+
+import (
+	"context"
+	"errors"
+	"os"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/pulumi/pulumi-kubernetes-operator/pkg/apis/pulumi/shared"
+	pulumiv1 "github.com/pulumi/pulumi-kubernetes-operator/pkg/apis/pulumi/v1"
+)
+
+// When namespace isolation is waived (see EnvInsecureNoNamespaceIsolation), a stack can refer to
+// Secrets in any namespace. In a cluster shared between tenants, that lets a stack read another
+// tenant's credentials, so Secrets can be restricted to the stack's own namespace on their own:
+// for every stack, with the operator's SAME_NAMESPACE_SECRETS_ONLY environment entry, or for the
+// stacks in a namespace, with the `pulumi.com/same-namespace-secrets-only` annotation on the
+// namespace. A stack referring to a Secret elsewhere is stalled, as for a cross-namespace ref with
+// namespace isolation in force.
+
+var errCrossNamespaceSecret = newStallErrorf(`Secrets are constrained to the stack's namespace by %s or the %s annotation on the namespace`,
+	EnvSameNamespaceSecretsOnly, shared.SameNamespaceSecretsOnlyAnnotation)
+
+// IsSameNamespaceSecretsOnly reports whether the operator restricts the Secrets every stack can
+// refer to to its own namespace.
+func IsSameNamespaceSecretsOnly() bool {
+	switch os.Getenv(EnvSameNamespaceSecretsOnly) {
+	case "1", "true":
+		return true
+	default:
+		return false
+	}
+}
+
+// sameNamespaceSecretsOnly reports whether the stacks in the namespace given can refer only to
+// Secrets in the same namespace. The namespace is read directly rather than through the cache, so
+// that the operator needn't watch namespaces; if it can't be read, only the operator's setting
+// applies.
+func sameNamespaceSecretsOnly(ctx context.Context, reader client.Reader, namespace string) bool {
+	if IsSameNamespaceSecretsOnly() {
+		return true
+	}
+	if reader == nil {
+		return false
+	}
+	var ns corev1.Namespace
+	if err := reader.Get(ctx, types.NamespacedName{Name: namespace}, &ns); err != nil {
+		return false
+	}
+	return ns.GetAnnotations()[shared.SameNamespaceSecretsOnlyAnnotation] == "true"
+}
+
+// stalledReason gives the reason to record for a stalled error: the reason for a forbidden
+// cross-namespace reference, if that's the problem, or else the reason given.
+func stalledReason(err error, reason string) string {
+	if errors.Is(err, errNamespaceIsolation) || errors.Is(err, errCrossNamespaceSecret) {
+		return pulumiv1.StalledCrossNamespaceRefForbiddenReason
+	}
+	return reason
+}
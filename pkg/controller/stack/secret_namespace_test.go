@@ -0,0 +1,77 @@
+// Copyright 2024, Pulumi Corporation.  All rights reserved.
+
+package stack
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	"github.com/pulumi/pulumi-kubernetes-operator/pkg/apis/pulumi/shared"
+	pulumiv1 "github.com/pulumi/pulumi-kubernetes-operator/pkg/apis/pulumi/v1"
+	"github.com/pulumi/pulumi-kubernetes-operator/pkg/logging"
+)
+
+func TestSameNamespaceSecretsOnly(t *testing.T) {
+	restricted := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{
+		Name:        "restricted",
+		Annotations: map[string]string{shared.SameNamespaceSecretsOnlyAnnotation: "true"},
+	}}
+	open := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "open"}}
+	client := fake.NewFakeClientWithScheme(scheme.Scheme, restricted, open)
+
+	assert.True(t, sameNamespaceSecretsOnly(context.TODO(), client, "restricted"))
+	assert.False(t, sameNamespaceSecretsOnly(context.TODO(), client, "open"))
+	assert.False(t, sameNamespaceSecretsOnly(context.TODO(), client, "absent"))
+	assert.False(t, sameNamespaceSecretsOnly(context.TODO(), nil, "restricted"))
+
+	t.Setenv(EnvSameNamespaceSecretsOnly, "true")
+	assert.True(t, sameNamespaceSecretsOnly(context.TODO(), client, "open"))
+	assert.True(t, sameNamespaceSecretsOnly(context.TODO(), nil, "absent"))
+}
+
+func TestResolveSecretSameNamespaceOnly(t *testing.T) {
+	t.Setenv(EnvInsecureNoNamespaceIsolation, "true")
+	logger := logging.NewLogger(t.Name(), "Request.Test", "TestResolveSecretSameNamespaceOnly")
+	own := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "creds", Namespace: namespace},
+		Data:       map[string][]byte{"token": []byte("own")},
+	}
+	other := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "creds", Namespace: "other-team"},
+		Data:       map[string][]byte{"token": []byte("theirs")},
+	}
+	client := fake.NewFakeClientWithScheme(scheme.Scheme, own, other)
+	sess := newReconcileStackSession(logger, shared.StackSpec{}, client, namespace)
+
+	ownRef := shared.NewSecretResourceRef("", "creds", "token")
+	otherRef := shared.NewSecretResourceRef("other-team", "creds", "token")
+
+	// with namespace isolation waived, any namespace will do
+	v, err := sess.resolveResourceRef(context.TODO(), &otherRef)
+	require.NoError(t, err)
+	assert.Equal(t, "theirs", v)
+
+	sess.sameNamespaceSecretsOnly = true
+	v, err = sess.resolveResourceRef(context.TODO(), &ownRef)
+	require.NoError(t, err)
+	assert.Equal(t, "own", v)
+	_, err = sess.resolveResourceRef(context.TODO(), &otherRef)
+	assert.True(t, errors.Is(err, errCrossNamespaceSecret))
+	assert.True(t, isStalledError(err))
+}
+
+func TestStalledReason(t *testing.T) {
+	wrapped := fmt.Errorf("failed to set stack config: %w", fmt.Errorf("Secret other/creds: %w", errCrossNamespaceSecret))
+	assert.Equal(t, pulumiv1.StalledCrossNamespaceRefForbiddenReason, stalledReason(wrapped, pulumiv1.StalledSpecInvalidReason))
+	assert.Equal(t, pulumiv1.StalledCrossNamespaceRefForbiddenReason, stalledReason(errNamespaceIsolation, pulumiv1.StalledSpecInvalidReason))
+	assert.Equal(t, pulumiv1.StalledSpecInvalidReason, stalledReason(newStallErrorf("bad spec"), pulumiv1.StalledSpecInvalidReason))
+}
@@ -0,0 +1,101 @@
+// Copyright 2024, Pulumi Corporation.  All rights reserved.
+
+package stack
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/pulumi/pulumi/sdk/v3/go/auto"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/pulumi/pulumi-kubernetes-operator/pkg/apis/pulumi/shared"
+	pulumiv1 "github.com/pulumi/pulumi-kubernetes-operator/pkg/apis/pulumi/v1"
+)
+
+// A stack's secrets provider is fixed when the stack is created, so changing .spec.secretsProvider
+// of an existing stack has no effect by itself. Instead, the provider the stack's state is
+// encrypted with is compared with the one in the spec before anything else is done with the
+// stack, and if they differ, the stack is moved to the new provider with `pulumi stack
+// change-secrets-provider`, which re-encrypts its state and configuration. The comparison is with
+// the state rather than with a record in the status, so a change which fails part way is simply
+// tried again the next time; whatever the old provider needs to decrypt (e.g., the passphrase)
+// must stay available until the change has succeeded.
+
+// defaultSecretsProvider is the value of .spec.secretsProvider which selects the Pulumi Service's
+// secrets provider.
+const defaultSecretsProvider = "default"
+
+// stateSecretsProvider gives the secrets provider the deployment given is encrypted with, in the
+// form given to .spec.secretsProvider; or an empty string if the deployment doesn't say (e.g.,
+// because the stack has never been updated).
+func stateSecretsProvider(deployment json.RawMessage) (string, error) {
+	var state struct {
+		SecretsProviders *struct {
+			Type  string `json:"type"`
+			State struct {
+				URL string `json:"url"`
+			} `json:"state"`
+		} `json:"secrets_providers"`
+	}
+	if len(deployment) == 0 {
+		return "", nil
+	}
+	if err := json.Unmarshal(deployment, &state); err != nil {
+		return "", err
+	}
+	sp := state.SecretsProviders
+	switch {
+	case sp == nil:
+		return "", nil
+	case sp.Type == "passphrase":
+		return passphraseSecretsProvider, nil
+	case sp.Type == "service":
+		return defaultSecretsProvider, nil
+	case sp.Type == "cloud":
+		return sp.State.URL, nil
+	default:
+		return sp.Type, nil
+	}
+}
+
+// changeSecretsProvider moves the stack to the secrets provider given in .spec.secretsProvider,
+// if its state is encrypted with another. The change is recorded in the session, to be put in the
+// status whether or not it succeeds.
+func (sess *reconcileStackSession) changeSecretsProvider(ctx context.Context, w auto.Workspace) error {
+	wanted := sess.stack.SecretsProvider
+	if wanted == "" {
+		return nil
+	}
+	deployment, err := sess.autoStack.Export(ctx)
+	if err != nil {
+		return fmt.Errorf("exporting state of stack %q: %w", sess.stack.Stack, err)
+	}
+	current, err := stateSecretsProvider(deployment.Deployment)
+	if err != nil {
+		return fmt.Errorf("reading state of stack %q: %w", sess.stack.Stack, err)
+	}
+	if current == "" || current == wanted {
+		return nil
+	}
+
+	sess.logger.Info("Changing secrets provider of stack", "Stack.Name", sess.stack.Stack, "From", current, "To", wanted)
+	change := &pulumiv1.SecretsProviderChange{From: current, To: wanted, Time: metav1.Now()}
+	sess.secretsProviderChange = change
+	args := []string{"stack", "change-secrets-provider", wanted, "--stack", sess.stack.Stack, "--non-interactive"}
+	cmd := exec.CommandContext(ctx, "pulumi", args...)
+	if home := w.PulumiHome(); home != "" {
+		cmd.Env = append(os.Environ(), "PULUMI_HOME="+home)
+	}
+	if _, stderr, err := sess.runCmd("Pulumi Change Secrets Provider", cmd, w); err != nil {
+		err = &commandError{kind: "change-secrets-provider", command: "pulumi " + strings.Join(args, " "), err: err, stderr: stderr}
+		change.State, change.Message = shared.FailedStackStateMessage, err.Error()
+		return err
+	}
+	change.State = shared.SucceededStackStateMessage
+	return nil
+}
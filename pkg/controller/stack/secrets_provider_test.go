@@ -0,0 +1,30 @@
+// Copyright 2024, Pulumi Corporation.  All rights reserved.
+
+package stack
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStateSecretsProvider(t *testing.T) {
+	for deployment, want := range map[string]string{
+		``:                 "",
+		`{}`:               "",
+		`{"resources":[]}`: "",
+		`{"secrets_providers":{"type":"passphrase","state":{"salt":"v1:abc"}}}`:                                              "passphrase",
+		`{"secrets_providers":{"type":"service","state":{"url":"https://api.pulumi.com","owner":"org"}}}`:                    "default",
+		`{"secrets_providers":{"type":"cloud","state":{"url":"awskms://alias/pulumi?region=us-east-1","encryptedkey":"x"}}}`: "awskms://alias/pulumi?region=us-east-1",
+		`{"secrets_providers":{"type":"b64"}}`:                                                                               "b64",
+	} {
+		got, err := stateSecretsProvider(json.RawMessage(deployment))
+		require.NoError(t, err, deployment)
+		assert.Equal(t, want, got, deployment)
+	}
+
+	_, err := stateSecretsProvider(json.RawMessage(`{"secrets_providers":`))
+	assert.Error(t, err)
+}
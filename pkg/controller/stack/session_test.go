@@ -336,7 +336,7 @@ func (suite *GitAuthTestSuite) TestSetupGitAuthWithRefs() {
 		{
 			name:    "EmptyGitAuth",
 			gitAuth: &shared.GitAuthConfig{},
-			err:     fmt.Errorf("gitAuth config must specify exactly one of 'personalAccessToken', 'sshPrivateKey' or 'basicAuth'"),
+			err:     fmt.Errorf("gitAuth config must specify exactly one of 'personalAccessToken', 'sshPrivateKey', 'basicAuth' or 'codeCommit'"),
 		},
 		{
 			name: "GitAuthValidSecretReference",
@@ -560,3 +560,225 @@ func (suite *GitAuthTestSuite) TestSetupGitAuthWithRefs() {
 		})
 	}
 }
+
+func (suite *GitAuthTestSuite) TestSetupGitAuthPrefersGitAuth() {
+	t := suite.T()
+	logger := logging.NewLogger(t.Name(), "Request.Test", "TestSetupGitAuthPrefersGitAuth")
+
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "git-auth",
+			Namespace: namespace,
+		},
+		Data: map[string][]byte{
+			"accessToken": []byte("token from gitAuthSecret"),
+		},
+		Type: "Opaque",
+	}
+	client := fake.NewFakeClientWithScheme(scheme.Scheme, secret)
+
+	session := newReconcileStackSession(logger, shared.StackSpec{
+		GitSource: &shared.GitSource{
+			GitAuthSecret: secret.Name,
+			GitAuth: &shared.GitAuthConfig{
+				PersonalAccessToken: &shared.ResourceRef{
+					SelectorType: shared.ResourceSelectorEnv,
+					ResourceSelector: shared.ResourceSelector{
+						Env: &shared.EnvSelector{
+							Name: "SECRET3",
+						},
+					},
+				},
+			},
+		},
+	}, client, namespace)
+	gitAuth, err := session.SetupGitAuth(context.TODO())
+	require.NoError(t, err)
+	assert.Equal(t, &auto.GitAuth{PersonalAccessToken: "so secret"}, gitAuth)
+}
+
+func TestResolveEnvFrom(t *testing.T) {
+	logger := logging.NewLogger(t.Name(), "Request.Test", "TestResolveEnvFrom")
+
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "aws-credentials", Namespace: namespace},
+		Data: map[string][]byte{
+			"AWS_ACCESS_KEY_ID":     []byte("id"),
+			"AWS_SECRET_ACCESS_KEY": []byte("secret"),
+			"1BAD":                  []byte("skipped"),
+		},
+	}
+	configMap := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "settings", Namespace: namespace},
+		Data: map[string]string{
+			"REGION":            "us-east-1",
+			"AWS_ACCESS_KEY_ID": "overridden",
+		},
+	}
+	client := fake.NewFakeClientWithScheme(scheme.Scheme, secret, configMap)
+	secretRef := func(name string, optional bool) shared.EnvFromSource {
+		return shared.EnvFromSource{SecretRef: &shared.EnvFromObjectReference{Name: name, Optional: optional}}
+	}
+	configMapRef := func(name, prefix string) shared.EnvFromSource {
+		return shared.EnvFromSource{Prefix: prefix, ConfigMapRef: &shared.EnvFromObjectReference{Name: name}}
+	}
+
+	for _, test := range []struct {
+		name     string
+		envFrom  []shared.EnvFromSource
+		expected map[string]string
+		notFound bool
+		err      bool
+	}{
+		{
+			name:    "secret",
+			envFrom: []shared.EnvFromSource{secretRef("aws-credentials", false)},
+			expected: map[string]string{
+				"AWS_ACCESS_KEY_ID":     "id",
+				"AWS_SECRET_ACCESS_KEY": "secret",
+			},
+		},
+		{
+			name:    "later sources win",
+			envFrom: []shared.EnvFromSource{secretRef("aws-credentials", false), configMapRef("settings", "")},
+			expected: map[string]string{
+				"AWS_ACCESS_KEY_ID":     "overridden",
+				"AWS_SECRET_ACCESS_KEY": "secret",
+				"REGION":                "us-east-1",
+			},
+		},
+		{
+			name:    "prefix",
+			envFrom: []shared.EnvFromSource{configMapRef("settings", "APP_")},
+			expected: map[string]string{
+				"APP_REGION":            "us-east-1",
+				"APP_AWS_ACCESS_KEY_ID": "overridden",
+			},
+		},
+		{
+			name:     "optional and missing",
+			envFrom:  []shared.EnvFromSource{secretRef("missing", true)},
+			expected: map[string]string{},
+		},
+		{
+			name:     "missing",
+			envFrom:  []shared.EnvFromSource{secretRef("missing", false)},
+			notFound: true,
+		},
+		{
+			name: "both secret and config map",
+			envFrom: []shared.EnvFromSource{{
+				SecretRef:    &shared.EnvFromObjectReference{Name: "aws-credentials"},
+				ConfigMapRef: &shared.EnvFromObjectReference{Name: "settings"},
+			}},
+			err: true,
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			sess := newReconcileStackSession(logger, shared.StackSpec{EnvFrom: test.envFrom}, client, namespace)
+			envvars, err := sess.resolveEnvFrom(context.TODO())
+			switch {
+			case test.notFound:
+				assert.True(t, isMissingReference(err))
+			case test.err:
+				assert.Error(t, err)
+			default:
+				require.NoError(t, err)
+				assert.Equal(t, test.expected, envvars)
+			}
+		})
+	}
+}
+
+func TestResolveConfigMapResourceRef(t *testing.T) {
+	logger := logging.NewLogger(t.Name(), "Request.Test", "TestResolveConfigMapResourceRef")
+	configMap := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "cluster-info", Namespace: namespace},
+		Data:       map[string]string{"region": "us-west-2"},
+		BinaryData: map[string][]byte{"clusterID": []byte("c-1234")},
+	}
+	client := fake.NewFakeClientWithScheme(scheme.Scheme, configMap)
+	sess := newReconcileStackSession(logger, shared.StackSpec{}, client, namespace)
+
+	ref := shared.NewConfigMapResourceRef("", configMap.Name, "region")
+	v, err := sess.resolveResourceRef(context.TODO(), &ref)
+	require.NoError(t, err)
+	assert.Equal(t, "us-west-2", v)
+
+	ref = shared.NewConfigMapResourceRef(namespace, configMap.Name, "clusterID")
+	v, err = sess.resolveResourceRef(context.TODO(), &ref)
+	require.NoError(t, err)
+	assert.Equal(t, "c-1234", v, "binary data")
+
+	ref = shared.NewConfigMapResourceRef("", configMap.Name, "zone")
+	_, err = sess.resolveResourceRef(context.TODO(), &ref)
+	assert.EqualError(t, err, `no key "zone" found in ConfigMap test/cluster-info`)
+
+	ref = shared.NewConfigMapResourceRef("", "missing", "region")
+	_, err = sess.resolveResourceRef(context.TODO(), &ref)
+	assert.Error(t, err)
+
+	ref = shared.NewConfigMapResourceRef("other", configMap.Name, "region")
+	_, err = sess.resolveResourceRef(context.TODO(), &ref)
+	assert.ErrorIs(t, err, errNamespaceIsolation)
+}
+
+func TestResolveConfigPrecedence(t *testing.T) {
+	logger := logging.NewLogger(t.Name(), "Request.Test", "TestResolveConfigPrecedence")
+	configMap := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "cluster-info", Namespace: namespace},
+		Data:       map[string]string{"region": "us-west-2"},
+	}
+	client := fake.NewFakeClientWithScheme(scheme.Scheme, configMap)
+	sess := newReconcileStackSession(logger, shared.StackSpec{
+		Config: map[string]string{"app:inline": "config", "app:both": "config"},
+		ConfigRefs: map[string]shared.ResourceRef{
+			"aws:region": shared.NewConfigMapResourceRef("", configMap.Name, "region"),
+			"app:inline": shared.NewLiteralResourceRef("configRefs"),
+			"app:secret": shared.NewLiteralResourceRef("configRefs"),
+		},
+		ConfigValues: map[string]shared.ConfigValue{"app:value": {Value: "configValues", Secret: true}},
+		SecretRefs:   map[string]shared.ResourceRef{"app:both": shared.NewLiteralResourceRef("secretsRef")},
+		Secrets:      map[string]string{"app:secret": "secrets"},
+	}, client, namespace)
+	sess.configFrom = map[string]string{"aws:region": "configFrom", "app:fromMap": "configFrom"}
+	sess.secretsFrom = map[string]string{"app:secret": "secretsFrom", "app:secretFromMap": "secretsFrom"}
+
+	m, err := sess.resolveConfig(context.TODO())
+	require.NoError(t, err)
+	assert.Equal(t, auto.ConfigMap{
+		"aws:region":        {Value: "us-west-2"},
+		"app:fromMap":       {Value: "configFrom"},
+		"app:inline":        {Value: "config"},
+		"app:value":         {Value: "configValues", Secret: true},
+		"app:secret":        {Value: "secrets", Secret: true},
+		"app:secretFromMap": {Value: "secretsFrom", Secret: true},
+		"app:both":          {Value: "secretsRef", Secret: true},
+	}, m)
+
+	// the first ref which can't be resolved is the one reported
+	sess.stack.ConfigRefs["app:a"] = shared.NewConfigMapResourceRef("", "missing", "a")
+	sess.stack.ConfigRefs["app:b"] = shared.NewConfigMapResourceRef("", "missing", "b")
+	_, err = sess.resolveConfig(context.TODO())
+	assert.ErrorContains(t, err, `configRef for "app:a"`)
+}
+
+func TestGetStackOutputs(t *testing.T) {
+	logger := logging.NewLogger(t.Name(), "Request.Test", "TestGetStackOutputs")
+	client := fake.NewFakeClientWithScheme(scheme.Scheme)
+	outs := auto.OutputMap{
+		"bucket":   {Value: "bucket-1234"},
+		"password": {Value: "hunter2", Secret: true},
+	}
+
+	sess := newReconcileStackSession(logger, shared.StackSpec{}, client, namespace)
+	outputs, err := sess.GetStackOutputs(outs)
+	require.NoError(t, err)
+	assert.Equal(t, `"bucket-1234"`, string(outputs["bucket"].Raw))
+	assert.Equal(t, `"[secret]"`, string(outputs["password"].Raw), "secrets are redacted by default")
+
+	sess = newReconcileStackSession(logger, shared.StackSpec{ShowSecretOutputs: true}, client, namespace)
+	outputs, err = sess.GetStackOutputs(outs)
+	require.NoError(t, err)
+	assert.Equal(t, `"hunter2"`, string(outputs["password"].Raw), "secrets shown when asked")
+}
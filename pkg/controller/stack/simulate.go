@@ -0,0 +1,789 @@
+// Copyright 2024, Pulumi Corporation.  All rights reserved.
+
+package stack
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pulumi/pulumi/sdk/v3/go/auto"
+	"github.com/pulumi/pulumi/sdk/v3/go/auto/optdestroy"
+	"github.com/pulumi/pulumi/sdk/v3/go/auto/opthistory"
+	"github.com/pulumi/pulumi/sdk/v3/go/auto/optpreview"
+	"github.com/pulumi/pulumi/sdk/v3/go/auto/optrefresh"
+	"github.com/pulumi/pulumi/sdk/v3/go/auto/optup"
+	"github.com/pulumi/pulumi/sdk/v3/go/common/apitype"
+	"github.com/pulumi/pulumi/sdk/v3/go/common/resource/config"
+	"github.com/pulumi/pulumi/sdk/v3/go/common/workspace"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	apimeta "k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/yaml"
+
+	"github.com/pulumi/pulumi-kubernetes-operator/pkg/apis/pulumi/shared"
+	pulumiv1 "github.com/pulumi/pulumi-kubernetes-operator/pkg/apis/pulumi/v1"
+)
+
+// A simulation runs the stack controller over a set of objects held in memory, with Pulumi
+// replaced by canned results given in a fixture. This is for checking how the operator treats
+// Stack objects -- the status and events it gives them -- without a cluster, a cloud, or the
+// Pulumi CLI; for example, before moving to a new version of the operator.
+//
+// What's simulated is the Automation API: making workspaces and stacks, configuring stacks, and
+// updating, refreshing and destroying them. The things the operator does by running the Pulumi CLI
+// itself (importing resources, previewing a destroy, changing the secrets provider) are not
+// simulated, and will fail unless the CLI is available. Flux sources are not supported. Git
+// sources are simulated by mapping the repository URLs to directories in the fixture; projects
+// given with projectPath are used as they are. Time does not advance during a simulation, so a
+// stack waiting to be retried after a failure stays waiting.
+
+// SimulationFixture gives the results the simulated Pulumi layer has for each stack.
+type SimulationFixture struct {
+	// Stacks has the results for each Pulumi stack, by its name as given in .spec.stack. A stack
+	// not given here is updated successfully, with no outputs and no resources.
+	Stacks map[string]SimulatedStack `json:"stacks,omitempty"`
+	// Sources maps git repository URLs, as given in .spec.projectRepo, to the directories holding
+	// their projects. Relative directories are taken from the working directory.
+	Sources map[string]string `json:"sources,omitempty"`
+}
+
+// SimulatedStack gives the results of the operations on a stack.
+type SimulatedStack struct {
+	// Outputs has the outputs of the stack once it's updated.
+	Outputs map[string]interface{} `json:"outputs,omitempty"`
+	// SecretOutputs names the outputs which are secret.
+	SecretOutputs []string `json:"secretOutputs,omitempty"`
+	// Resources has the URNs of the resources in the stack once it's updated.
+	Resources []string `json:"resources,omitempty"`
+	// ResourceChanges has the resource changes reported for an update, e.g., {"create": 2}.
+	ResourceChanges map[string]int `json:"resourceChanges,omitempty"`
+	// RefreshChanges has the resource changes reported for a refresh. Anything other than "same"
+	// counts as drift.
+	RefreshChanges map[string]int `json:"refreshChanges,omitempty"`
+	// UpdateError, if given, is the error with which updates fail.
+	UpdateError string `json:"updateError,omitempty"`
+	// FailedUpdates is the number of updates which fail with UpdateError before they succeed. When
+	// it's zero, all updates fail.
+	FailedUpdates int `json:"failedUpdates,omitempty"`
+	// RefreshError, if given, is the error with which refreshes fail.
+	RefreshError string `json:"refreshError,omitempty"`
+	// DestroyError, if given, is the error with which destroys fail.
+	DestroyError string `json:"destroyError,omitempty"`
+}
+
+// SimulationReport gives the outcome of a simulation, for each Stack object.
+type SimulationReport struct {
+	Stacks []SimulatedStackReport `json:"stacks"`
+}
+
+// SimulatedStackReport gives the outcome of a simulation for a Stack object.
+type SimulatedStackReport struct {
+	Namespace string `json:"namespace"`
+	Name      string `json:"name"`
+	// Passes is the number of times the Stack object was reconciled.
+	Passes int `json:"passes"`
+	// Settled is true if the controller had finished with the object -- it's ready, abandoned,
+	// paused, or doesn't need to be processed again -- by the end of the simulation.
+	Settled bool `json:"settled"`
+	// Deleted is true if the object was deleted, e.g., after being finalized.
+	Deleted bool `json:"deleted,omitempty"`
+	// Error is the error returned from the last reconciliation, if there was one.
+	Error  string               `json:"error,omitempty"`
+	Status pulumiv1.StackStatus `json:"status"`
+	Events []SimulatedEvent     `json:"events,omitempty"`
+}
+
+// SimulatedEvent is an event recorded for an object during a simulation.
+type SimulatedEvent struct {
+	Type    string `json:"type"`
+	Reason  string `json:"reason"`
+	Message string `json:"message"`
+}
+
+// Simulation runs the stack controller over the objects it's given, with Pulumi simulated.
+type Simulation struct {
+	client     client.Client
+	reconciler *ReconcileStack
+
+	mu     sync.Mutex
+	events map[types.NamespacedName][]SimulatedEvent
+	passes map[types.NamespacedName]int
+}
+
+// NewSimulation makes a simulation of the objects given, which must be in the scheme given, using
+// the results in the fixture.
+func NewSimulation(scheme *runtime.Scheme, fixture SimulationFixture, objs ...client.Object) (*Simulation, error) {
+	sources := make(map[string]string, len(fixture.Sources))
+	for repo, dir := range fixture.Sources {
+		abs, err := filepath.Abs(dir)
+		if err != nil {
+			return nil, fmt.Errorf("source for %s: %w", repo, err)
+		}
+		sources[repo] = abs
+	}
+	for i, o := range objs {
+		if stack, ok := o.(*pulumiv1.Stack); ok {
+			stack = stack.DeepCopy()
+			if err := simulateGitSource(&stack.Spec, sources); err != nil {
+				return nil, fmt.Errorf("stack %s/%s: %w", stack.Namespace, stack.Name, err)
+			}
+			objs[i] = stack
+		}
+	}
+
+	sim := &Simulation{
+		client: fake.NewClientBuilder().WithScheme(scheme).WithObjects(objs...).Build(),
+		events: map[types.NamespacedName][]SimulatedEvent{},
+		passes: map[types.NamespacedName]int{},
+	}
+	sim.reconciler = &ReconcileStack{
+		client:   sim.client,
+		reader:   sim.client,
+		scheme:   scheme,
+		recorder: sim,
+		enqueued: newEnqueueTimes(),
+		maybeWatchFluxSourceKind: func(shared.FluxSourceReference) error {
+			return errors.New("Flux sources are not supported in simulations")
+		},
+		// projects are given by path in the fixture, or in the stacks themselves
+		localProjectRoot: string(filepath.Separator),
+		operatorID:       operatorIdentity(time.Now()),
+		verifications:    newVerificationCoordinator(),
+		outputs:          newOutputExchange(),
+		pulumi:           newSimulatedLayer(fixture),
+	}
+	return sim, nil
+}
+
+// simulateGitSource replaces a git repository in the stack spec with the directory the fixture
+// gives for it. The project is copied, so the directory isn't changed by the simulation.
+func simulateGitSource(spec *shared.StackSpec, sources map[string]string) error {
+	src := spec.GitSource
+	if src == nil || src.ProjectRepo == "" {
+		return nil
+	}
+	dir, ok := sources[src.ProjectRepo]
+	if !ok {
+		return fmt.Errorf("the fixture has no source for %s", src.ProjectRepo)
+	}
+	src.ProjectPath, src.CopyProjectPath = dir, true
+	src.ProjectRepo, src.Commit, src.Branch, src.Tag = "", "", "", ""
+	src.GitAuth, src.GitAuthSecret = nil, ""
+	return nil
+}
+
+// Delete deletes the Stack object named, as kubectl would. If the object has a finalizer, it's
+// finalized when the simulation is next run.
+func (s *Simulation) Delete(ctx context.Context, namespace, name string) error {
+	stack := &pulumiv1.Stack{}
+	if err := s.client.Get(ctx, types.NamespacedName{Namespace: namespace, Name: name}, stack); err != nil {
+		return err
+	}
+	return s.client.Delete(ctx, stack)
+}
+
+// Run reconciles the Stack objects until they have all settled, or each unsettled object has been
+// reconciled the number of times given, and reports the outcome. Each round reconciles every
+// unsettled object once, so that a stack waiting for a prerequisite is seen again after the
+// prerequisite has been processed.
+func (s *Simulation) Run(ctx context.Context, maxPasses int) (*SimulationReport, error) {
+	var stacks pulumiv1.StackList
+	if err := s.client.List(ctx, &stacks); err != nil {
+		return nil, err
+	}
+	names := make([]types.NamespacedName, len(stacks.Items))
+	for i := range stacks.Items {
+		names[i] = types.NamespacedName{Namespace: stacks.Items[i].Namespace, Name: stacks.Items[i].Name}
+	}
+	sort.Slice(names, func(i, j int) bool { return names[i].String() < names[j].String() })
+
+	settled := make(map[types.NamespacedName]bool, len(names))
+	errs := make(map[types.NamespacedName]error, len(names))
+	for pass := 0; pass < maxPasses; pass++ {
+		progress := false
+		for _, name := range names {
+			if settled[name] {
+				continue
+			}
+			progress = true
+			s.mu.Lock()
+			s.passes[name]++
+			s.mu.Unlock()
+			res, err := s.reconcile(ctx, name)
+			errs[name] = err
+			if err != nil {
+				continue
+			}
+			if settled[name], err = s.settled(ctx, name, res); err != nil {
+				return nil, err
+			}
+		}
+		if !progress {
+			break
+		}
+	}
+
+	report := &SimulationReport{Stacks: make([]SimulatedStackReport, 0, len(names))}
+	for _, name := range names {
+		r := SimulatedStackReport{Namespace: name.Namespace, Name: name.Name, Settled: settled[name]}
+		if err := errs[name]; err != nil {
+			r.Error = err.Error()
+		}
+		var stack pulumiv1.Stack
+		switch err := s.client.Get(ctx, name, &stack); {
+		case k8serrors.IsNotFound(err):
+			r.Deleted = true
+		case err != nil:
+			return nil, err
+		default:
+			r.Status = stack.Status
+		}
+		s.mu.Lock()
+		r.Passes = s.passes[name]
+		r.Events = append([]SimulatedEvent(nil), s.events[name]...)
+		s.mu.Unlock()
+		report.Stacks = append(report.Stacks, r)
+	}
+	return report, nil
+}
+
+// reconcile reconciles the object named once. Using a part of the Automation API that isn't
+// simulated is reported as an error, rather than crashing the simulation.
+func (s *Simulation) reconcile(ctx context.Context, name types.NamespacedName) (res reconcile.Result, err error) {
+	defer func() {
+		if p := recover(); p != nil {
+			err = fmt.Errorf("reconciliation used something not simulated: %v", p)
+		}
+	}()
+	return s.reconciler.Reconcile(ctx, reconcile.Request{NamespacedName: name})
+}
+
+// settled reports whether the controller has finished with the object named, given the result of
+// reconciling it.
+func (s *Simulation) settled(ctx context.Context, name types.NamespacedName, res reconcile.Result) (bool, error) {
+	var stack pulumiv1.Stack
+	if err := s.client.Get(ctx, name, &stack); err != nil {
+		if k8serrors.IsNotFound(err) {
+			return true, nil
+		}
+		return false, err
+	}
+	if stack.DeletionTimestamp != nil {
+		return false, nil
+	}
+	if isSettledOutcome(&stack.Status, res) {
+		return true, nil
+	}
+	return !res.Requeue && res.RequeueAfter == 0, nil
+}
+
+// Event records an event, as record.EventRecorder.
+func (s *Simulation) Event(object runtime.Object, eventtype, reason, message string) {
+	o, err := apimeta.Accessor(object)
+	if err != nil {
+		return
+	}
+	name := types.NamespacedName{Namespace: o.GetNamespace(), Name: o.GetName()}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.events[name] = append(s.events[name], SimulatedEvent{Type: eventtype, Reason: reason, Message: message})
+}
+
+// Eventf records an event, as record.EventRecorder.
+func (s *Simulation) Eventf(object runtime.Object, eventtype, reason, messageFmt string, args ...interface{}) {
+	s.Event(object, eventtype, reason, fmt.Sprintf(messageFmt, args...))
+}
+
+// AnnotatedEventf records an event, as record.EventRecorder. The annotations are not kept.
+func (s *Simulation) AnnotatedEventf(object runtime.Object, _ map[string]string, eventtype, reason, messageFmt string, args ...interface{}) {
+	s.Eventf(object, eventtype, reason, messageFmt, args...)
+}
+
+// simulatedLayer is the pulumiLayer used in simulations. The state of each stack is kept here,
+// since the controller makes new workspaces and stacks each time it processes a Stack object.
+type simulatedLayer struct {
+	fixture SimulationFixture
+
+	mu     sync.Mutex
+	stacks map[string]*simulatedState
+}
+
+// simulatedState is the state of a simulated stack.
+type simulatedState struct {
+	updates   int
+	history   []auto.UpdateSummary // most recent first
+	resources []string             // nil until the stack is first updated
+	outputs   auto.OutputMap
+	tags      map[string]string
+}
+
+var _ pulumiLayer = &simulatedLayer{}
+
+func newSimulatedLayer(fixture SimulationFixture) *simulatedLayer {
+	return &simulatedLayer{fixture: fixture, stacks: map[string]*simulatedState{}}
+}
+
+func (l *simulatedLayer) NewWorkspace(_ context.Context, workDir, pulumiHome, secretsProvider string) (auto.Workspace, error) {
+	return &simulatedWorkspace{
+		layer:           l,
+		workDir:         workDir,
+		pulumiHome:      pulumiHome,
+		secretsProvider: secretsProvider,
+		envvars:         map[string]string{},
+	}, nil
+}
+
+func (l *simulatedLayer) UpsertStack(_ context.Context, name string, w auto.Workspace) (pulumiStack, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if _, ok := l.stacks[name]; !ok {
+		l.stacks[name] = &simulatedState{}
+	}
+	return &simulatedStack{layer: l, name: name, w: w}, nil
+}
+
+func (l *simulatedLayer) SelectStack(_ context.Context, name string, w auto.Workspace) (pulumiStack, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if _, ok := l.stacks[name]; !ok {
+		return nil, fmt.Errorf("no stack named '%s' found", name)
+	}
+	return &simulatedStack{layer: l, name: name, w: w}, nil
+}
+
+func (l *simulatedLayer) RemoveStack(_ context.Context, name string, _ auto.Workspace) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	delete(l.stacks, name)
+	return nil
+}
+
+func (l *simulatedLayer) InstallsDependencies() bool {
+	return false
+}
+
+// simulatedWorkspace is the workspace used in simulations. It has the project and stack settings
+// from its directory, and keeps the environment in memory. The methods of auto.Workspace which
+// aren't given here are not simulated, and panic if used.
+type simulatedWorkspace struct {
+	auto.Workspace
+
+	layer           *simulatedLayer
+	workDir         string
+	pulumiHome      string
+	secretsProvider string
+	envvars         map[string]string
+}
+
+func (w *simulatedWorkspace) WorkDir() string {
+	return w.workDir
+}
+
+func (w *simulatedWorkspace) PulumiHome() string {
+	return w.pulumiHome
+}
+
+func (w *simulatedWorkspace) GetEnvVars() map[string]string {
+	return w.envvars
+}
+
+func (w *simulatedWorkspace) SetEnvVars(envvars map[string]string) error {
+	for k, v := range envvars {
+		w.envvars[k] = v
+	}
+	return nil
+}
+
+func (w *simulatedWorkspace) SetEnvVar(key, value string) {
+	w.envvars[key] = value
+}
+
+func (w *simulatedWorkspace) UnsetEnvVar(key string) {
+	delete(w.envvars, key)
+}
+
+func (w *simulatedWorkspace) ProjectSettings(context.Context) (*workspace.Project, error) {
+	for _, name := range []string{"Pulumi.yaml", "Pulumi.yml"} {
+		path := filepath.Join(w.workDir, name)
+		if _, err := os.Stat(path); err == nil {
+			return workspace.LoadProject(path)
+		}
+	}
+	return nil, fmt.Errorf("unable to find project settings in workspace")
+}
+
+// stackSettingsPath gives the path of the settings file for the stack named, which is the file
+// that exists if either does.
+func (w *simulatedWorkspace) stackSettingsPath(stackName string) string {
+	name := stackName[strings.LastIndex(stackName, "/")+1:]
+	path := filepath.Join(w.workDir, "Pulumi."+name+".yaml")
+	if alt := filepath.Join(w.workDir, "Pulumi."+name+".yml"); fileExists(alt) {
+		return alt
+	}
+	return path
+}
+
+func (w *simulatedWorkspace) StackSettings(_ context.Context, stackName string) (*workspace.ProjectStack, error) {
+	b, err := os.ReadFile(w.stackSettingsPath(stackName))
+	if err != nil {
+		return nil, fmt.Errorf("unable to find stack settings in workspace for %s: %w", stackName, err)
+	}
+	var settings workspace.ProjectStack
+	if err := yaml.Unmarshal(b, &settings); err != nil {
+		return nil, fmt.Errorf("reading stack settings for %s: %w", stackName, err)
+	}
+	return &settings, nil
+}
+
+func (w *simulatedWorkspace) SaveStackSettings(_ context.Context, stackName string, settings *workspace.ProjectStack) error {
+	b, err := yaml.Marshal(settings)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(w.stackSettingsPath(stackName), b, 0600)
+}
+
+// stackState gives the state of the stack named, as kept by the layer. The layer must be locked.
+func (w *simulatedWorkspace) stackState(stackName string) (*simulatedState, error) {
+	st, ok := w.layer.stacks[stackName]
+	if !ok {
+		return nil, fmt.Errorf("no stack named '%s' found", stackName)
+	}
+	return st, nil
+}
+
+func (w *simulatedWorkspace) ListTags(_ context.Context, stackName string) (map[string]string, error) {
+	w.layer.mu.Lock()
+	defer w.layer.mu.Unlock()
+	st, err := w.stackState(stackName)
+	if err != nil {
+		return nil, err
+	}
+	tags := make(map[string]string, len(st.tags))
+	for k, v := range st.tags {
+		tags[k] = v
+	}
+	return tags, nil
+}
+
+func (w *simulatedWorkspace) SetTag(_ context.Context, stackName, key, value string) error {
+	w.layer.mu.Lock()
+	defer w.layer.mu.Unlock()
+	st, err := w.stackState(stackName)
+	if err != nil {
+		return err
+	}
+	if st.tags == nil {
+		st.tags = map[string]string{}
+	}
+	st.tags[key] = value
+	return nil
+}
+
+func (w *simulatedWorkspace) RemoveTag(_ context.Context, stackName, key string) error {
+	w.layer.mu.Lock()
+	defer w.layer.mu.Unlock()
+	st, err := w.stackState(stackName)
+	if err != nil {
+		return err
+	}
+	delete(st.tags, key)
+	return nil
+}
+
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+// simulatedStack is the stack used in simulations, which gives the results from the fixture.
+type simulatedStack struct {
+	layer *simulatedLayer
+	name  string
+	w     auto.Workspace
+	// environments are those attached to the stack; like the stack's settings, they last only as
+	// long as the workspace
+	environments []string
+}
+
+var _ pulumiStack = &simulatedStack{}
+
+// state gives the stack's state and its results in the fixture. The layer must be locked.
+func (s *simulatedStack) state() (*simulatedState, SimulatedStack) {
+	st, ok := s.layer.stacks[s.name]
+	if !ok {
+		// the stack has been removed from under this
+		st = &simulatedState{}
+		s.layer.stacks[s.name] = st
+	}
+	return st, s.layer.fixture.Stacks[s.name]
+}
+
+// record adds an operation to the stack's history, and returns its summary.
+func (st *simulatedState) record(kind string, changes map[string]int, err error) auto.UpdateSummary {
+	now := time.Now().UTC().Format(time.RFC3339)
+	summary := auto.UpdateSummary{
+		Version:   len(st.history) + 1,
+		Kind:      kind,
+		StartTime: now,
+		EndTime:   &now,
+		Result:    "succeeded",
+	}
+	if err != nil {
+		summary.Result = "failed"
+	}
+	if changes != nil {
+		c := make(map[string]int, len(changes))
+		for op, n := range changes {
+			c[op] = n
+		}
+		summary.ResourceChanges = &c
+	}
+	st.history = append([]auto.UpdateSummary{summary}, st.history...)
+	return summary
+}
+
+func (s *simulatedStack) Workspace() auto.Workspace {
+	return s.w
+}
+
+func (s *simulatedStack) Up(_ context.Context, _ ...optup.Option) (auto.UpResult, error) {
+	s.layer.mu.Lock()
+	defer s.layer.mu.Unlock()
+	st, fx := s.state()
+	st.updates++
+	if fx.UpdateError != "" && (fx.FailedUpdates == 0 || st.updates <= fx.FailedUpdates) {
+		err := errors.New(fx.UpdateError)
+		return auto.UpResult{StdErr: fx.UpdateError, Summary: st.record("update", fx.ResourceChanges, err)}, err
+	}
+
+	st.resources = append([]string{}, fx.Resources...)
+	secret := make(map[string]bool, len(fx.SecretOutputs))
+	for _, k := range fx.SecretOutputs {
+		secret[k] = true
+	}
+	st.outputs = make(auto.OutputMap, len(fx.Outputs))
+	for k, v := range fx.Outputs {
+		st.outputs[k] = auto.OutputValue{Value: v, Secret: secret[k]}
+	}
+	return auto.UpResult{Outputs: st.outputs, Summary: st.record("update", fx.ResourceChanges, nil)}, nil
+}
+
+func (s *simulatedStack) Preview(_ context.Context, _ ...optpreview.Option) (auto.PreviewResult, error) {
+	s.layer.mu.Lock()
+	defer s.layer.mu.Unlock()
+	_, fx := s.state()
+	if fx.UpdateError != "" && fx.FailedUpdates == 0 {
+		return auto.PreviewResult{StdErr: fx.UpdateError}, errors.New(fx.UpdateError)
+	}
+	summary := make(map[apitype.OpType]int, len(fx.ResourceChanges))
+	for op, n := range fx.ResourceChanges {
+		summary[apitype.OpType(op)] = n
+	}
+	return auto.PreviewResult{ChangeSummary: summary}, nil
+}
+
+func (s *simulatedStack) Refresh(_ context.Context, _ ...optrefresh.Option) (auto.RefreshResult, error) {
+	s.layer.mu.Lock()
+	defer s.layer.mu.Unlock()
+	st, fx := s.state()
+	var err error
+	if fx.RefreshError != "" {
+		err = errors.New(fx.RefreshError)
+	}
+	return auto.RefreshResult{StdErr: fx.RefreshError, Summary: st.record("refresh", fx.RefreshChanges, err)}, err
+}
+
+func (s *simulatedStack) Destroy(_ context.Context, opts ...optdestroy.Option) (auto.DestroyResult, error) {
+	s.layer.mu.Lock()
+	defer s.layer.mu.Unlock()
+	st, fx := s.state()
+	if fx.DestroyError != "" {
+		err := errors.New(fx.DestroyError)
+		return auto.DestroyResult{StdErr: fx.DestroyError, Summary: st.record("destroy", nil, err)}, err
+	}
+
+	var options optdestroy.Options
+	for _, o := range opts {
+		o.ApplyOption(&options)
+	}
+	targeted := make(map[string]bool, len(options.Target))
+	for _, urn := range options.Target {
+		targeted[urn] = true
+	}
+	var left []string
+	for _, urn := range st.resources {
+		if len(targeted) > 0 && !targeted[urn] {
+			left = append(left, urn)
+		}
+	}
+	changes := map[string]int{"delete": len(st.resources) - len(left)}
+	st.resources = left
+	if len(targeted) == 0 {
+		st.outputs = nil
+	}
+	return auto.DestroyResult{Summary: st.record("destroy", changes, nil)}, nil
+}
+
+func (s *simulatedStack) Cancel(context.Context) error {
+	return nil
+}
+
+func (s *simulatedStack) Outputs(context.Context) (auto.OutputMap, error) {
+	s.layer.mu.Lock()
+	defer s.layer.mu.Unlock()
+	st, _ := s.state()
+	outs := make(auto.OutputMap, len(st.outputs))
+	for k, v := range st.outputs {
+		outs[k] = v
+	}
+	return outs, nil
+}
+
+func (s *simulatedStack) History(_ context.Context, pageSize int, page int, _ ...opthistory.Option) ([]auto.UpdateSummary, error) {
+	s.layer.mu.Lock()
+	defer s.layer.mu.Unlock()
+	st, _ := s.state()
+	history := st.history
+	if pageSize > 0 {
+		if page < 1 {
+			page = 1
+		}
+		start := (page - 1) * pageSize
+		if start > len(history) {
+			start = len(history)
+		}
+		end := start + pageSize
+		if end > len(history) {
+			end = len(history)
+		}
+		history = history[start:end]
+	}
+	return append([]auto.UpdateSummary(nil), history...), nil
+}
+
+func (s *simulatedStack) Info(context.Context) (auto.StackSummary, error) {
+	s.layer.mu.Lock()
+	defer s.layer.mu.Unlock()
+	st, _ := s.state()
+	count := len(st.resources)
+	summary := auto.StackSummary{Name: s.name, Current: true, ResourceCount: &count}
+	if len(st.history) > 0 {
+		summary.LastUpdate = st.history[0].StartTime
+	}
+	return summary, nil
+}
+
+// simulatedResource is a resource in the state exported from a simulated stack; the type is taken
+// from the URN, which is `urn:pulumi:<stack>::<project>::<type>::<name>`.
+type simulatedResource struct {
+	URN  string `json:"urn"`
+	Type string `json:"type"`
+}
+
+func (s *simulatedStack) Export(context.Context) (apitype.UntypedDeployment, error) {
+	s.layer.mu.Lock()
+	defer s.layer.mu.Unlock()
+	st, _ := s.state()
+	if st.resources == nil {
+		return apitype.UntypedDeployment{Version: 3}, nil
+	}
+	resources := make([]simulatedResource, len(st.resources))
+	for i, urn := range st.resources {
+		resources[i] = simulatedResource{URN: urn}
+		if parts := strings.Split(urn, "::"); len(parts) == 4 {
+			resources[i].Type = parts[2]
+		}
+	}
+	deployment, err := json.Marshal(map[string]interface{}{"resources": resources})
+	if err != nil {
+		return apitype.UntypedDeployment{}, err
+	}
+	return apitype.UntypedDeployment{Version: 3, Deployment: deployment}, nil
+}
+
+func (s *simulatedStack) Import(_ context.Context, state apitype.UntypedDeployment) error {
+	resources, err := parseStateResources(state.Deployment)
+	if err != nil {
+		return err
+	}
+	s.layer.mu.Lock()
+	defer s.layer.mu.Unlock()
+	st, _ := s.state()
+	st.resources = make([]string, len(resources))
+	for i, r := range resources {
+		st.resources[i] = r.URN
+	}
+	return nil
+}
+
+// GetAllConfig gives the stack's configuration from its settings file. Secret values are kept in
+// the clear in simulations.
+func (s *simulatedStack) GetAllConfig(ctx context.Context) (auto.ConfigMap, error) {
+	settings, err := s.w.StackSettings(ctx, s.name)
+	if err != nil {
+		// a stack without a settings file has no configuration
+		return auto.ConfigMap{}, nil
+	}
+	c := make(auto.ConfigMap, len(settings.Config))
+	for k, v := range settings.Config {
+		value, err := v.Value(config.NopDecrypter)
+		if err != nil {
+			return nil, err
+		}
+		c[k.String()] = auto.ConfigValue{Value: value, Secret: v.Secure()}
+	}
+	return c, nil
+}
+
+func (s *simulatedStack) ListEnvironments(context.Context) ([]string, error) {
+	return s.environments, nil
+}
+
+func (s *simulatedStack) AddEnvironments(_ context.Context, envs ...string) error {
+	s.environments = append(s.environments, envs...)
+	return nil
+}
+
+func (s *simulatedStack) RemoveEnvironment(_ context.Context, env string) error {
+	s.environments = without(s.environments, []string{env})
+	return nil
+}
+
+func (s *simulatedStack) SetAllConfig(ctx context.Context, c auto.ConfigMap) error {
+	project, err := s.w.ProjectSettings(ctx)
+	if err != nil {
+		return err
+	}
+	settings, err := s.w.StackSettings(ctx, s.name)
+	if err != nil {
+		settings = &workspace.ProjectStack{}
+	}
+	if settings.Config == nil {
+		settings.Config = config.Map{}
+	}
+	for k, v := range c {
+		key, err := config.ParseKey(qualifyConfigKey(string(project.Name), k))
+		if err != nil {
+			return err
+		}
+		if v.Secret {
+			settings.Config[key] = config.NewSecureValue(v.Value)
+		} else {
+			settings.Config[key] = config.NewValue(v.Value)
+		}
+	}
+	return s.w.SaveStackSettings(ctx, s.name, settings)
+}
@@ -0,0 +1,169 @@
+// Copyright 2024, Pulumi Corporation.  All rights reserved.
+
+package stack
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	apimeta "k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+
+	"github.com/pulumi/pulumi-kubernetes-operator/pkg/apis/pulumi/shared"
+	pulumiv1 "github.com/pulumi/pulumi-kubernetes-operator/pkg/apis/pulumi/v1"
+)
+
+func TestSimulation(t *testing.T) {
+	project := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(project, "Pulumi.yaml"), []byte("name: website\nruntime: yaml\n"), 0600))
+
+	s := runtime.NewScheme()
+	require.NoError(t, scheme.AddToScheme(s))
+	require.NoError(t, pulumiv1.SchemeBuilder.AddToScheme(s))
+
+	newStack := func(name string) *pulumiv1.Stack {
+		return &pulumiv1.Stack{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace},
+			Spec: shared.StackSpec{
+				Stack:  "acme/website/" + name,
+				Config: map[string]string{"greeting": "hello"},
+				GitSource: &shared.GitSource{
+					ProjectRepo: "https://github.com/acme/website",
+					Branch:      "main",
+				},
+			},
+		}
+	}
+	fixture := SimulationFixture{
+		Sources: map[string]string{"https://github.com/acme/website": project},
+		Stacks: map[string]SimulatedStack{
+			"acme/website/prod": {
+				Outputs:         map[string]interface{}{"url": "https://example.com", "token": "s3cr3t"},
+				SecretOutputs:   []string{"token"},
+				Resources:       []string{"urn:pulumi:prod::website::pulumi:pulumi:Stack::website-prod"},
+				ResourceChanges: map[string]int{"create": 1},
+			},
+			"acme/website/broken": {UpdateError: "error: the bucket name is taken"},
+			"acme/website/staging": {
+				Outputs:         map[string]interface{}{"url": "https://staging.example.com"},
+				ResourceChanges: map[string]int{"create": 2, "same": 1},
+			},
+		},
+	}
+
+	_, err := NewSimulation(s, SimulationFixture{}, newStack("prod"))
+	assert.ErrorContains(t, err, "the fixture has no source for https://github.com/acme/website")
+
+	tagged := newStack("prod")
+	tagged.Spec.Tags = map[string]string{"owner": "{{ .Namespace }}/{{ .Name }}"}
+	previewed := newStack("staging")
+	previewed.Spec.PreviewOnly = true
+	sim, err := NewSimulation(s, fixture, tagged, newStack("broken"), previewed)
+	require.NoError(t, err)
+	report, err := sim.Run(context.TODO(), 3)
+	require.NoError(t, err)
+	require.Len(t, report.Stacks, 3)
+
+	broken, prod, staging := report.Stacks[0], report.Stacks[1], report.Stacks[2]
+	assert.Equal(t, "prod", prod.Name)
+	assert.True(t, prod.Settled)
+	assert.Equal(t, 1, prod.Passes)
+	assert.True(t, apimeta.IsStatusConditionTrue(prod.Status.Conditions, pulumiv1.ReadyCondition))
+	require.NotNil(t, prod.Status.LastUpdate)
+	assert.Equal(t, shared.SucceededStackStateMessage, prod.Status.LastUpdate.State)
+	assert.JSONEq(t, `"https://example.com"`, string(prod.Status.Outputs["url"].Raw))
+	assert.JSONEq(t, `"[secret]"`, string(prod.Status.Outputs["token"].Raw))
+	assert.Contains(t, prod.Events, SimulatedEvent{Type: "Normal", Reason: string(pulumiv1.StackUpdateSuccessful), Message: "Successfully updated stack."})
+	assert.Equal(t, []string{"owner"}, prod.Status.Tags)
+	assert.Empty(t, prod.Status.TagsError)
+
+	assert.Equal(t, "broken", broken.Name)
+	assert.False(t, broken.Settled)
+	assert.Equal(t, 3, broken.Passes)
+	require.NotNil(t, broken.Status.LastUpdate)
+	assert.Equal(t, shared.FailedStackStateMessage, broken.Status.LastUpdate.State)
+	var reasons []string
+	for _, e := range broken.Events {
+		reasons = append(reasons, e.Reason)
+	}
+	assert.Contains(t, reasons, string(pulumiv1.StackUpdateFailure))
+
+	assert.Equal(t, "staging", staging.Name)
+	assert.True(t, staging.Settled)
+	assert.True(t, apimeta.IsStatusConditionTrue(staging.Status.Conditions, pulumiv1.ReadyCondition))
+	if last := staging.Status.LastUpdate; last != nil {
+		assert.Empty(t, last.State, "a stack with previewOnly set is not updated")
+	}
+	assert.Empty(t, staging.Status.Outputs)
+	require.NotNil(t, staging.Status.LastPreview)
+	assert.Equal(t, shared.SucceededStackStateMessage, staging.Status.LastPreview.State)
+	assert.True(t, staging.Status.LastPreview.ChangesDetected)
+	assert.Equal(t, map[string]int{"create": 2}, staging.Status.LastPreview.ResourceChanges)
+	assert.NotEmpty(t, staging.Status.LastPreview.Revision)
+}
+
+func TestSimulationResync(t *testing.T) {
+	project := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(project, "Pulumi.yaml"), []byte("name: website\nruntime: yaml\n"), 0600))
+
+	s := runtime.NewScheme()
+	require.NoError(t, scheme.AddToScheme(s))
+	require.NoError(t, pulumiv1.SchemeBuilder.AddToScheme(s))
+
+	newStack := func(name string, resyncFrequencySeconds int64) *pulumiv1.Stack {
+		return &pulumiv1.Stack{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace},
+			Spec: shared.StackSpec{
+				Stack:                  "acme/website/" + name,
+				ResyncFrequencySeconds: resyncFrequencySeconds,
+				GitSource: &shared.GitSource{
+					ProjectRepo: "https://github.com/acme/website",
+					Branch:      "main",
+				},
+			},
+		}
+	}
+	fixture := SimulationFixture{Sources: map[string]string{"https://github.com/acme/website": project}}
+	sim, err := NewSimulation(s, fixture, newStack("resynced", 60), newStack("steady", 0))
+	require.NoError(t, err)
+	ctx := context.TODO()
+	_, err = sim.Run(ctx, 1)
+	require.NoError(t, err)
+
+	// the updates were run long enough ago for a resync to be due
+	for _, name := range []string{"resynced", "steady"} {
+		var stack pulumiv1.Stack
+		require.NoError(t, sim.client.Get(ctx, types.NamespacedName{Namespace: namespace, Name: name}, &stack))
+		require.NotNil(t, stack.Status.LastUpdate)
+		stack.Status.LastUpdate.StartTime = &metav1.Time{Time: time.Now().Add(-10 * time.Minute)}
+		require.NoError(t, sim.client.Status().Update(ctx, &stack))
+	}
+	report, err := sim.Run(ctx, 1)
+	require.NoError(t, err)
+	require.Len(t, report.Stacks, 2)
+
+	updated := SimulatedEvent{Type: "Normal", Reason: string(pulumiv1.StackUpdateSuccessful), Message: "Successfully updated stack."}
+	count := func(events []SimulatedEvent) int {
+		n := 0
+		for _, e := range events {
+			if e == updated {
+				n++
+			}
+		}
+		return n
+	}
+	resynced, steady := report.Stacks[0], report.Stacks[1]
+	assert.Equal(t, 2, count(resynced.Events), "updated again at the same revision")
+	assert.NotNil(t, resynced.Status.LastRefresh, "refreshed before the update")
+	assert.WithinDuration(t, time.Now(), resynced.Status.LastUpdate.StartTime.Time, time.Minute)
+	assert.Equal(t, 1, count(steady.Events), "not updated again without a resync frequency")
+	assert.Nil(t, steady.Status.LastRefresh)
+}
@@ -0,0 +1,87 @@
+// Copyright 2024, Pulumi Corporation.  All rights reserved.
+
+package stack
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/pulumi/pulumi/sdk/v3/go/common/resource/config"
+	"github.com/pulumi/pulumi/sdk/v3/go/common/workspace"
+	yaml "sigs.k8s.io/yaml"
+
+	"github.com/pulumi/pulumi-kubernetes-operator/pkg/apis/pulumi/shared"
+)
+
+// stackConfigFromRef gives .spec.stackConfigFrom as a reference, so that it's resolved (and
+// watched) as any other reference to a ConfigMap is.
+func stackConfigFromRef(source *shared.StackConfigSource) *shared.ResourceRef {
+	if source == nil {
+		return nil
+	}
+	return &shared.ResourceRef{
+		SelectorType: shared.ResourceSelectorConfigMap,
+		ResourceSelector: shared.ResourceSelector{
+			ConfigMapRef: &source.ConfigMapRef,
+		},
+	}
+}
+
+// parseStackSettings reads the contents of a stack settings file.
+func parseStackSettings(contents string) (*workspace.ProjectStack, error) {
+	settings := &workspace.ProjectStack{}
+	if err := yaml.Unmarshal([]byte(contents), settings); err != nil {
+		return nil, err
+	}
+	return settings, nil
+}
+
+// overlayStackSettings gives the stack settings checked in with the overlay given in place of
+// them or, if merging, merged into them.
+func overlayStackSettings(checkedIn, overlay *workspace.ProjectStack, merge bool) *workspace.ProjectStack {
+	if !merge {
+		return overlay
+	}
+	merged := *checkedIn
+	merged.Config = make(config.Map, len(checkedIn.Config)+len(overlay.Config))
+	for k, v := range checkedIn.Config {
+		merged.Config[k] = v
+	}
+	for k, v := range overlay.Config {
+		merged.Config[k] = v
+	}
+	if overlay.SecretsProvider != "" {
+		merged.SecretsProvider = overlay.SecretsProvider
+	}
+	if overlay.EncryptedKey != "" {
+		merged.EncryptedKey = overlay.EncryptedKey
+	}
+	if overlay.EncryptionSalt != "" {
+		merged.EncryptionSalt = overlay.EncryptionSalt
+	}
+	if overlay.Environment != nil {
+		merged.Environment = overlay.Environment
+	}
+	return &merged
+}
+
+// readStackConfigFrom resolves .spec.stackConfigFrom, if given, and gives the stack settings
+// checked in with it overlaid. The settings are returned as they are otherwise.
+func (sess *reconcileStackSession) readStackConfigFrom(ctx context.Context, checkedIn *workspace.ProjectStack) (*workspace.ProjectStack, error) {
+	source := sess.stack.StackConfigFrom
+	if source == nil {
+		return checkedIn, nil
+	}
+	contents, err := sess.resolveResourceRef(ctx, stackConfigFromRef(source))
+	if err != nil {
+		return nil, fmt.Errorf("resolving stackConfigFrom: %w", err)
+	}
+	overlay, err := parseStackSettings(contents)
+	if err != nil {
+		return nil, fmt.Errorf("stackConfigFrom: key %q of ConfigMap %s is not a valid stack settings file: %w",
+			source.ConfigMapRef.Key, source.ConfigMapRef.Name, err)
+	}
+	sess.logger.Debug("Overlaying stack settings from ConfigMap", "ConfigMap", source.ConfigMapRef.Name,
+		"Key", source.ConfigMapRef.Key, "Merge", source.Merge)
+	return overlayStackSettings(checkedIn, overlay, source.Merge), nil
+}
@@ -0,0 +1,106 @@
+// Copyright 2024, Pulumi Corporation.  All rights reserved.
+
+package stack
+
+import (
+	"context"
+	"testing"
+
+	"github.com/pulumi/pulumi/sdk/v3/go/common/resource/config"
+	"github.com/pulumi/pulumi/sdk/v3/go/common/workspace"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	"github.com/pulumi/pulumi-kubernetes-operator/pkg/apis/pulumi/shared"
+	"github.com/pulumi/pulumi-kubernetes-operator/pkg/logging"
+)
+
+func TestOverlayStackSettings(t *testing.T) {
+	region, replicas, name := config.MustMakeKey("aws", "region"), config.MustMakeKey("app", "replicas"), config.MustMakeKey("app", "name")
+	checkedIn := &workspace.ProjectStack{
+		SecretsProvider: "passphrase",
+		EncryptionSalt:  "v1:salt",
+		Config: config.Map{
+			region: config.NewValue("us-west-2"),
+			name:   config.NewValue("app"),
+		},
+	}
+	overlay := &workspace.ProjectStack{
+		Config: config.Map{
+			region:   config.NewValue("eu-west-1"),
+			replicas: config.NewValue("3"),
+		},
+	}
+
+	assert.Equal(t, overlay, overlayStackSettings(checkedIn, overlay, false), "replaced")
+
+	merged := overlayStackSettings(checkedIn, overlay, true)
+	assert.Equal(t, config.Map{
+		region:   config.NewValue("eu-west-1"),
+		replicas: config.NewValue("3"),
+		name:     config.NewValue("app"),
+	}, merged.Config)
+	assert.Equal(t, "passphrase", merged.SecretsProvider, "not given by the overlay")
+	assert.Equal(t, "v1:salt", merged.EncryptionSalt, "not given by the overlay")
+	assert.Equal(t, config.NewValue("us-west-2"), checkedIn.Config[region], "the settings checked in are left as they were")
+}
+
+func TestReadStackConfigFrom(t *testing.T) {
+	logger := logging.NewLogger(t.Name(), "Request.Test", "TestReadStackConfigFrom")
+	settings := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "stack-settings", Namespace: namespace},
+		Data: map[string]string{
+			"Pulumi.prod.yaml": "config:\n  aws:region: eu-west-1\n  app:replicas: \"3\"\n",
+			"invalid":          "config: [\n",
+		},
+	}
+	c := fake.NewFakeClientWithScheme(scheme.Scheme, settings)
+	region := config.MustMakeKey("aws", "region")
+	checkedIn := &workspace.ProjectStack{
+		Config: config.Map{region: config.NewValue("us-west-2"), config.MustMakeKey("app", "name"): config.NewValue("app")},
+	}
+	read := func(key string, merge bool) (*workspace.ProjectStack, error) {
+		spec := shared.StackSpec{StackConfigFrom: &shared.StackConfigSource{
+			ConfigMapRef: shared.ConfigMapSelector{Name: "stack-settings", Key: key},
+			Merge:        merge,
+		}}
+		sess := newReconcileStackSession(logger, spec, c, namespace)
+		return sess.readStackConfigFrom(context.TODO(), checkedIn)
+	}
+
+	t.Run("not given", func(t *testing.T) {
+		sess := newReconcileStackSession(logger, shared.StackSpec{}, c, namespace)
+		got, err := sess.readStackConfigFrom(context.TODO(), checkedIn)
+		require.NoError(t, err)
+		assert.Same(t, checkedIn, got)
+	})
+
+	t.Run("replace", func(t *testing.T) {
+		got, err := read("Pulumi.prod.yaml", false)
+		require.NoError(t, err)
+		assert.Len(t, got.Config, 2)
+		assert.Equal(t, config.NewValue("eu-west-1"), got.Config[region])
+		assert.NotContains(t, got.Config, config.MustMakeKey("app", "name"))
+	})
+
+	t.Run("merge", func(t *testing.T) {
+		got, err := read("Pulumi.prod.yaml", true)
+		require.NoError(t, err)
+		assert.Len(t, got.Config, 3)
+		assert.Equal(t, config.NewValue("eu-west-1"), got.Config[region])
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		_, err := read("invalid", false)
+		assert.ErrorContains(t, err, `stackConfigFrom: key "invalid" of ConfigMap stack-settings is not a valid stack settings file`)
+	})
+
+	t.Run("missing key", func(t *testing.T) {
+		_, err := read("Pulumi.dev.yaml", false)
+		assert.ErrorContains(t, err, "resolving stackConfigFrom")
+	})
+}
@@ -13,6 +13,7 @@ import (
 	"os"
 	"os/exec"
 	"path/filepath"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
@@ -30,15 +31,16 @@ import (
 	"github.com/pulumi/pulumi/sdk/v3/go/auto/optup"
 	"github.com/pulumi/pulumi/sdk/v3/go/common/util/contract"
 	"github.com/pulumi/pulumi/sdk/v3/go/common/workspace"
-	giturls "github.com/whilp/git-urls"
 	corev1 "k8s.io/api/core/v1"
 	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
 	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	apimeta "k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/validation"
 	"k8s.io/client-go/tools/cache"
 	"k8s.io/client-go/tools/record"
 	"k8s.io/client-go/util/retry"
@@ -75,6 +77,10 @@ const (
 	// truthy value (1|true), shall allow multiple namespaces to be watched, and cross-namespace
 	// references to be accepted.
 	EnvInsecureNoNamespaceIsolation = "INSECURE_NO_NAMESPACE_ISOLATION"
+	// EnvSameNamespaceSecretsOnly is the name of the environment entry which, when set to a truthy
+	// value (1|true), restricts the Secrets a stack can refer to to those in its own namespace, even
+	// when namespace isolation has been waived; see secret_namespace.go.
+	EnvSameNamespaceSecretsOnly = "SAME_NAMESPACE_SECRETS_ONLY"
 )
 
 // A directory (under /tmp) under which to put all working directories, for convenience in cleaning
@@ -95,8 +101,17 @@ func getSourceGVK(src shared.FluxSourceReference) (schema.GroupVersionKind, erro
 	return gv.WithKind(src.Kind), err
 }
 
-func fluxSourceKey(gvk schema.GroupVersionKind, name string) string {
-	return fmt.Sprintf("%s:%s", gvk, name)
+func fluxSourceKey(gvk schema.GroupVersionKind, namespace, name string) string {
+	return fmt.Sprintf("%s:%s/%s", gvk, namespace, name)
+}
+
+// fluxSourceNamespace returns the namespace of the Flux source referred to by a stack in the
+// namespace given.
+func fluxSourceNamespace(stackNamespace string, src shared.FluxSourceReference) string {
+	if src.Namespace != "" {
+		return src.Namespace
+	}
+	return stackNamespace
 }
 
 // Add creates a new Stack Controller and adds it to the Manager. The Manager will set fields on the Controller
@@ -108,15 +123,45 @@ func Add(mgr manager.Manager) error {
 	if err := setupInClusterKubeconfig(); err != nil {
 		log.Error(err, "skipping in-cluster kubeconfig setup due to non-existent ServiceAccount")
 	}
-	return add(mgr, newReconciler(mgr))
+	r := newReconciler(mgr)
+	strictSpecFields, err := getStrictSpecFieldsMode()
+	if err != nil {
+		return err
+	}
+	if strictSpecFields != strictSpecFieldsOff {
+		addStackValidator(mgr, strictSpecFields)
+		r.strictSpecFields = strictSpecFields
+	}
+	stackDefaults, err := getStackDefaults()
+	if err != nil {
+		return err
+	}
+	if stackDefaults != nil {
+		addStackDefaulter(mgr, stackDefaults)
+	}
+	if err := addPushWebhookReceiver(mgr); err != nil {
+		return err
+	}
+	if err := addStackReporter(mgr); err != nil {
+		return err
+	}
+	if err := addDeprecationReporter(mgr); err != nil {
+		return err
+	}
+	return add(mgr, r)
 }
 
 // newReconciler returns a new reconcile.Reconciler
 func newReconciler(mgr manager.Manager) *ReconcileStack {
 	return &ReconcileStack{
 		client:   mgr.GetClient(),
+		reader:   mgr.GetAPIReader(),
 		scheme:   mgr.GetScheme(),
 		recorder: mgr.GetEventRecorderFor("stack-controller"),
+		enqueued: newEnqueueTimes(),
+
+		verifications: newVerificationCoordinator(),
+		outputs:       newOutputExchange(),
 	}
 }
 
@@ -134,6 +179,20 @@ func add(mgr manager.Manager, r *ReconcileStack) error {
 			return err
 		}
 	}
+	if r.defaultInitialReconcileDelay, err = getDefaultInitialReconcileDelay(); err != nil {
+		return err
+	}
+	if r.gitMirrors, err = getGitMirrorCache(); err != nil {
+		return err
+	}
+	if r.deadLetters, err = getDeadLetters(r.client, r.reader); err != nil {
+		return err
+	}
+	if r.events, err = addEventAggregator(mgr, r.recorder); err != nil {
+		return err
+	}
+	r.localProjectRoot = os.Getenv(EnvLocalProjectRoot)
+	r.operatorID = operatorIdentity(time.Now())
 
 	// Create a new controller
 	c, err := controller.New("stack-controller", mgr, controller.Options{
@@ -165,11 +224,7 @@ func add(mgr manager.Manager, r *ReconcileStack) error {
 	indexer := mgr.GetFieldIndexer()
 	if err = indexer.IndexField(context.Background(), &pulumiv1.Stack{}, prerequisiteIndexFieldName, func(o client.Object) []string {
 		stack := o.(*pulumiv1.Stack)
-		names := make([]string, len(stack.Spec.Prerequisites), len(stack.Spec.Prerequisites))
-		for i := range stack.Spec.Prerequisites {
-			names[i] = stack.Spec.Prerequisites[i].Name
-		}
-		return names
+		return dependencyNames(&stack.Spec)
 	}); err != nil {
 		return err
 	}
@@ -192,11 +247,18 @@ func add(mgr manager.Manager, r *ReconcileStack) error {
 	}
 
 	// Watch for changes to primary resource Stack
-	if err = c.Watch(&source.Kind{Type: &pulumiv1.Stack{}}, &handler.InstrumentedEnqueueRequestForObject{}, predicates...); err != nil {
+	if err = c.Watch(&source.Kind{Type: &pulumiv1.Stack{}}, r.enqueued.handler(&handler.InstrumentedEnqueueRequestForObject{}), predicates...); err != nil {
 		return err
 	}
 	// Watch stacks so that dependent stacks can be requeued when they change
-	if err = c.Watch(&source.Kind{Type: &pulumiv1.Stack{}}, ctrlhandler.EnqueueRequestsFromMapFunc(enqueueDependents)); err != nil {
+	if err = c.Watch(&source.Kind{Type: &pulumiv1.Stack{}}, r.enqueued.handler(ctrlhandler.EnqueueRequestsFromMapFunc(enqueueDependents))); err != nil {
+		return err
+	}
+
+	// Watch Secrets, so that abandoned stacks can be resumed when a Secret they refer to changes
+	if err = c.Watch(&source.Kind{Type: &corev1.Secret{}},
+		ctrlhandler.EnqueueRequestsFromMapFunc(resumeStacksForSecret(mgr.GetClient(), mgr.GetLogger())),
+		secretChangedPredicate); err != nil {
 		return err
 	}
 
@@ -214,13 +276,16 @@ func add(mgr manager.Manager, r *ReconcileStack) error {
 	}
 
 	// this encodes the "use an index to look up the stacks used by a source" pattern which both
-	// ProgramRef and FluxSource need.
-	enqueueStacksForSourceFunc := func(indexName string, getFieldKey func(client.Object) string) func(client.Object) []reconcile.Request {
+	// ProgramRef and FluxSource need. A Flux source can be in another namespace to the stacks using
+	// it, so it's looked up in all namespaces, with the namespace of the source part of the key.
+	enqueueStacksForSourceFunc := func(indexName string, allNamespaces bool, getFieldKey func(client.Object) string) func(client.Object) []reconcile.Request {
 		return func(src client.Object) []reconcile.Request {
 			var stacks pulumiv1.StackList
-			err := mgr.GetClient().List(context.TODO(), &stacks,
-				client.InNamespace(src.GetNamespace()),
-				client.MatchingFields{indexName: getFieldKey(src)})
+			opts := []client.ListOption{client.MatchingFields{indexName: getFieldKey(src)}}
+			if !allNamespaces {
+				opts = append(opts, client.InNamespace(src.GetNamespace()))
+			}
+			err := mgr.GetClient().List(context.TODO(), &stacks, opts...)
 			if err == nil {
 				reqs := make([]reconcile.Request, len(stacks.Items), len(stacks.Items))
 				for i := range stacks.Items {
@@ -237,11 +302,95 @@ func add(mgr manager.Manager, r *ReconcileStack) error {
 		}
 	}
 
-	err = c.Watch(&source.Kind{Type: &pulumiv1.Program{}}, ctrlhandler.EnqueueRequestsFromMapFunc(
-		enqueueStacksForSourceFunc(programRefIndexFieldName,
+	err = c.Watch(&source.Kind{Type: &pulumiv1.Program{}}, r.enqueued.handler(ctrlhandler.EnqueueRequestsFromMapFunc(
+		enqueueStacksForSourceFunc(programRefIndexFieldName, false,
+			func(obj client.Object) string {
+				return obj.GetName()
+			}))))
+	if err != nil {
+		return err
+	}
+
+	// Watch ConfigMaps, and look up which (if any) Stack uses them as its program when they change
+
+	if err = indexer.IndexField(context.Background(), &pulumiv1.Stack{}, programConfigMapIndexFieldName, func(o client.Object) []string {
+		stack := o.(*pulumiv1.Stack)
+		if source := stack.Spec.ProgramFrom; source != nil && source.ConfigMap != nil {
+			return []string{source.ConfigMap.Name}
+		}
+		return nil
+	}); err != nil {
+		return err
+	}
+
+	err = c.Watch(&source.Kind{Type: &corev1.ConfigMap{}}, r.enqueued.handler(ctrlhandler.EnqueueRequestsFromMapFunc(
+		enqueueStacksForSourceFunc(programConfigMapIndexFieldName, false,
+			func(obj client.Object) string {
+				return obj.GetName()
+			}))))
+	if err != nil {
+		return err
+	}
+
+	// Watch ConfigMaps, and look up which (if any) Stacks take configuration from them when they
+	// change
+
+	if err = indexer.IndexField(context.Background(), &pulumiv1.Stack{}, configFromIndexFieldName, func(o client.Object) []string {
+		return configFromConfigMapNames(&o.(*pulumiv1.Stack).Spec)
+	}); err != nil {
+		return err
+	}
+
+	err = c.Watch(&source.Kind{Type: &corev1.ConfigMap{}}, r.enqueued.handler(ctrlhandler.EnqueueRequestsFromMapFunc(
+		enqueueStacksForSourceFunc(configFromIndexFieldName, false,
 			func(obj client.Object) string {
 				return obj.GetName()
-			})))
+			}))))
+	if err != nil {
+		return err
+	}
+
+	// Watch Secrets, and look up which (if any) Stacks take secret configuration from them when
+	// they change
+
+	if err = indexer.IndexField(context.Background(), &pulumiv1.Stack{}, secretsFromIndexFieldName, func(o client.Object) []string {
+		return secretsFromSecretNames(&o.(*pulumiv1.Stack).Spec)
+	}); err != nil {
+		return err
+	}
+
+	err = c.Watch(&source.Kind{Type: &corev1.Secret{}}, r.enqueued.handler(ctrlhandler.EnqueueRequestsFromMapFunc(
+		enqueueStacksForSourceFunc(secretsFromIndexFieldName, false,
+			func(obj client.Object) string {
+				return obj.GetName()
+			}))))
+	if err != nil {
+		return err
+	}
+
+	// Watch the other Secrets and ConfigMaps stacks refer to (e.g., for credentials), and queue the
+	// stacks referring to them when they change; see referenced_objects.go
+
+	if err = indexer.IndexField(context.Background(), &pulumiv1.Stack{}, referencedSecretIndexFieldName, func(o client.Object) []string {
+		secrets, _ := watchedReferences(o.GetNamespace(), &o.(*pulumiv1.Stack).Spec)
+		return secrets
+	}); err != nil {
+		return err
+	}
+	if err = indexer.IndexField(context.Background(), &pulumiv1.Stack{}, referencedConfigMapIndexFieldName, func(o client.Object) []string {
+		_, configMaps := watchedReferences(o.GetNamespace(), &o.(*pulumiv1.Stack).Spec)
+		return configMaps
+	}); err != nil {
+		return err
+	}
+
+	err = c.Watch(&source.Kind{Type: &corev1.Secret{}}, r.enqueued.handler(
+		enqueueReferringStacks(mgr.GetClient(), referencedSecretIndexFieldName, mgr.GetLogger())))
+	if err != nil {
+		return err
+	}
+	err = c.Watch(&source.Kind{Type: &corev1.ConfigMap{}}, r.enqueued.handler(
+		enqueueReferringStacks(mgr.GetClient(), referencedConfigMapIndexFieldName, mgr.GetLogger())))
 	if err != nil {
 		return err
 	}
@@ -258,7 +407,7 @@ func add(mgr manager.Manager, r *ReconcileStack) error {
 				return nil
 			}
 			// the keys include the type, because the references are not of a fixed type of object
-			return []string{fluxSourceKey(gvk, source.SourceRef.Name)}
+			return []string{fluxSourceKey(gvk, fluxSourceNamespace(stack.Namespace, source.SourceRef), source.SourceRef.Name)}
 		}
 		return nil
 	}); err != nil {
@@ -299,11 +448,11 @@ func add(mgr manager.Manager, r *ReconcileStack) error {
 			sourceKind.SetGroupVersionKind(gvk)
 			mgr.GetLogger().Info("installing watcher for newly seen source kind", "GroupVersionKind", gvk)
 			if err := c.Watch(&source.Kind{Type: &sourceKind},
-				ctrlhandler.EnqueueRequestsFromMapFunc(
-					enqueueStacksForSourceFunc(fluxSourceIndexFieldName, func(obj client.Object) string {
+				r.enqueued.handler(ctrlhandler.EnqueueRequestsFromMapFunc(
+					enqueueStacksForSourceFunc(fluxSourceIndexFieldName, true, func(obj client.Object) string {
 						gvk := obj.GetObjectKind().GroupVersionKind()
-						return fluxSourceKey(gvk, obj.GetName())
-					}))); err != nil {
+						return fluxSourceKey(gvk, obj.GetNamespace(), obj.GetName())
+					})))); err != nil {
 				watchedMu.Lock()
 				delete(watched, gvk)
 				watchedMu.Unlock()
@@ -392,9 +541,59 @@ type ReconcileStack struct {
 	client   client.Client
 	scheme   *runtime.Scheme
 	recorder record.EventRecorder
+	// reader reads objects directly, rather than through the cache; it's used for objects which
+	// aren't watched
+	reader client.Reader
 
 	// this is initialised by add(), to be available to Reconcile
 	maybeWatchFluxSourceKind func(shared.FluxSourceReference) error
+
+	// this is initialised by Add(), from the environment; see EnvStrictSpecFields
+	strictSpecFields strictSpecFieldsMode
+	// this is initialised by add(), from the environment; see EnvInitialReconcileDelaySeconds
+	defaultInitialReconcileDelay time.Duration
+	// this is initialised by add(), from the environment; see EnvGitMirrorCacheDir
+	gitMirrors *gitMirrorCache
+	// this is initialised by add(), from the environment; see EnvLocalProjectRoot
+	localProjectRoot string
+	// this is initialised by add(), to identify this instance in the updates it starts; see
+	// handover.go
+	operatorID string
+	// this records when stacks are queued, so the time they wait in the queue can be reported
+	enqueued *enqueueTimes
+	// this coordinates the verifications asked of prerequisites; see verify_coordinator.go
+	verifications *verificationCoordinator
+	// this has the outputs of stacks as soon as they're updated; see output_exchange.go
+	outputs *outputExchange
+	// this, when set, replaces the Automation API as the means of running Pulumi; see simulate.go
+	pulumi pulumiLayer
+	// this is initialised by add(), from the environment; see EnvDeadLetterConfigMap
+	deadLetters *deadLetters
+	// this is initialised by add(), from the flags; see event_aggregation.go
+	events *eventAggregator
+}
+
+// isSettledOutcome reports whether the status, and the result of reconciling the stack, record an
+// outcome of processing the stack which stands until the spec is changed: it's ready, paused, or
+// stalled and abandoned. A stack marked as stalled is not settled if it's to be tried again.
+func isSettledOutcome(status *pulumiv1.StackStatus, res reconcile.Result) bool {
+	if c := apimeta.FindStatusCondition(status.Conditions, pulumiv1.ReconcilingCondition); c != nil && c.Reason == pulumiv1.ReconcilingPausedReason {
+		return true
+	}
+	if apimeta.IsStatusConditionTrue(status.Conditions, pulumiv1.ReadyCondition) {
+		return true
+	}
+	return apimeta.IsStatusConditionTrue(status.Conditions, pulumiv1.StalledCondition) &&
+		status.Abandoned != nil && isAbandoned(status) && !res.Requeue && res.RequeueAfter == 0
+}
+
+// observeGeneration records the generation of the stack as observed, given the result of
+// reconciling it. The generation is only taken as observed once there's an outcome that stands
+// until the spec changes; not while the stack is being retried.
+func observeGeneration(instance *pulumiv1.Stack, res reconcile.Result) {
+	if isSettledOutcome(&instance.Status, res) {
+		instance.Status.ObservedGeneration = instance.GetGeneration()
+	}
 }
 
 // StallError represents a problem that makes a Stack spec unprocessable, while otherwise being
@@ -414,8 +613,20 @@ func isStalledError(e error) bool {
 	return errors.As(e, &s)
 }
 
+// exactlyOneOf reports whether exactly one of the conditions given is true.
+func exactlyOneOf(these ...bool) bool {
+	var found bool
+	for _, b := range these {
+		if found && b {
+			return false
+		}
+		found = found || b
+	}
+	return found
+}
+
 var errNamespaceIsolation = newStallErrorf(`refs are constrained to the object's namespace unless %s is set`, EnvInsecureNoNamespaceIsolation)
-var errOtherThanOneSourceSpecified = newStallErrorf(`exactly one source (.spec.fluxSource, .spec.projectRepo, or .spec.programRef) for the stack must be given`)
+var errOtherThanOneSourceSpecified = newStallErrorf(`exactly one source (.spec.fluxSource, .spec.projectRepo, .spec.programRef, or .spec.programFrom) for the stack must be given`)
 
 var errProgramNotFound = fmt.Errorf("unable to retrieve program for stack")
 
@@ -424,6 +635,20 @@ var errProgramNotFound = fmt.Errorf("unable to retrieve program for stack")
 func (r *ReconcileStack) Reconcile(ctx context.Context, request reconcile.Request) (retres reconcile.Result, reterr error) {
 	reqLogger := logging.WithValues(log, "Request.Namespace", request.Namespace, "Request.Name", request.Name)
 	reqLogger.Info("Reconciling Stack")
+	numStacksReconciling.Inc()
+	defer numStacksReconciling.Dec()
+
+	// Time the phases of processing, starting with how long the request waited in the queue. A
+	// request to run again later counts as queued from when it's due.
+	timer := newPhaseTimer(time.Now)
+	if wait, ok := r.enqueued.take(request, timer.start); ok {
+		timer.add(phaseQueue, wait)
+	}
+	defer func() {
+		if reterr == nil && retres.RequeueAfter > 0 {
+			r.enqueued.record(request, time.Now().Add(retres.RequeueAfter))
+		}
+	}()
 
 	// Fetch the Stack instance
 	instance := &pulumiv1.Stack{}
@@ -434,6 +659,9 @@ func (r *ReconcileStack) Reconcile(ctx context.Context, request reconcile.Reques
 			// Owned objects are automatically garbage collected. For additional cleanup logic use finalizers.
 			// Return and don't requeue
 			reqLogger.Info("Stack resource not found. Ignoring since object must be deleted.")
+			r.verifications.forget(request.NamespacedName)
+			r.outputs.forget(request.NamespacedName)
+			r.deadLetters.forget(request.NamespacedName)
 			return reconcile.Result{}, nil
 		}
 		// Error reading the object - requeue the request.
@@ -457,9 +685,19 @@ func (r *ReconcileStack) Reconcile(ctx context.Context, request reconcile.Reques
 		return reconcile.Result{}, nil
 	}
 
-	// This helper helps with updates, from here onwards.
-	stack := instance.Spec
+	// This helper helps with updates, from here onwards. The stacks given in dependsOn are put
+	// into effect as prerequisites and StackOutput refs; see depends_on.go.
+	stack, dependsOnErr := expandDependsOn(instance.Spec)
 	sess := newReconcileStackSession(reqLogger, stack, r.client, request.Namespace)
+	sess.timer = timer
+	sess.gitMirrors = r.gitMirrors
+	sess.localProjectRoot = r.localProjectRoot
+	sess.outputs = r.outputs
+	if r.pulumi != nil {
+		sess.pulumi = r.pulumi
+	}
+	sess.objectMeta = instance.ObjectMeta
+	sess.recordedConfigKeys = instance.Status.ConfigKeys
 
 	// Create a long-term working directory containing the home and workspace directories.
 	// The working directory is deleted during stack finalization.
@@ -469,6 +707,39 @@ func (r *ReconcileStack) Reconcile(ctx context.Context, request reconcile.Reques
 		return reconcile.Result{}, fmt.Errorf("unable to create root directory for stack: %w", err)
 	}
 
+	sess.sameNamespaceSecretsOnly = sameNamespaceSecretsOnly(ctx, r.reader, instance.Namespace)
+
+	// A stack with previewOnly set has never been applied by the operator, so it's not destroyed;
+	// see preview.go.
+	if isStackMarkedToBeDeleted && stack.DestroyOnFinalize && stack.PreviewOnly {
+		r.emitEvent(instance, pulumiv1.StackDestroySkippedEvent(),
+			"The stack has previewOnly set, so it is not destroyed; its resources are left in place.")
+		sess.stack.DestroyOnFinalize = false
+		return reconcile.Result{}, sess.finalize(ctx, instance)
+	}
+
+	// A stack being deleted along with its namespace is finalized with as little as possible; see
+	// namespace_termination.go.
+	if isStackMarkedToBeDeleted && stack.DestroyOnFinalize && isNamespaceTerminating(ctx, r.reader, instance.Namespace) {
+		reqLogger.Info("Namespace is being deleted; destroying stack without waiting for prerequisites or refreshing it")
+		sess.namespaceTerminating = true
+		if done, err := r.finalizeInTerminatingNamespace(ctx, sess, instance); done || err != nil {
+			return reconcile.Result{}, err
+		}
+	}
+
+	// A stack whose resources are protected isn't destroyed unless that's allowed; see protect.go.
+	// Holding up the deletion of its namespace would do no good, so it's left in place instead.
+	if isStackMarkedToBeDeleted && stack.DestroyOnFinalize && destroyProtected(&stack) {
+		if !sess.namespaceTerminating {
+			return r.refuseProtectedDestroy(instance)
+		}
+		r.emitEvent(instance, pulumiv1.StackDestroySkippedEvent(),
+			"Namespace is being deleted and the stack has protectResources set; its resources are left in place.")
+		sess.stack.DestroyOnFinalize = false
+		return reconcile.Result{}, sess.finalize(ctx, instance)
+	}
+
 	// We can exit early if there is no clean-up to do.
 	if isStackMarkedToBeDeleted && !stack.DestroyOnFinalize {
 		// We know `!(isStackMarkedToBeDeleted && !contains(finalizer))` from above, and now
@@ -477,13 +748,29 @@ func (r *ReconcileStack) Reconcile(ctx context.Context, request reconcile.Reques
 		return reconcile.Result{}, sess.finalize(ctx, instance)
 	}
 
+	// A change to the spec, or a request for reconciliation, ends any abandonment of the stack, so
+	// that giving up on it again counts as a new abandonment.
+	if resumeAbandoned(instance) {
+		reqLogger.Info("Resuming abandoned stack")
+	}
+
 	// This makes sure the status reflects the outcome of reconciliation. Any non-error return means
 	// the object definition was observed, whether the object ended up in a ready state or not. An
 	// error return (now we have successfully fetched the object) means it is "in progress" and not
 	// ready.
+	//
+	// If the stack got as far as being processed, the phase timings are reported in the status and
+	// in an event. The final write of the status can't be included in the timings it contains.
+	reportTimings := false
 	saveStatus := func() {
+		var timings string
+		if reportTimings {
+			timings = sess.timer.summary()
+			instance.Status.LastReconcileTimings = timings
+		}
+		instance.Status.LastReconcileTime = metav1.Now()
 		if reterr == nil {
-			instance.Status.ObservedGeneration = instance.GetGeneration()
+			observeGeneration(instance, retres)
 			if req, ok := getReconcileRequestAnnotation(instance); ok {
 				instance.Status.ObservedReconcileRequest = req
 			}
@@ -492,23 +779,101 @@ func (r *ReconcileStack) Reconcile(ctx context.Context, request reconcile.Reques
 			// saying it is still in progress.
 			instance.Status.MarkReconcilingCondition(pulumiv1.ReconcilingRetryReason, reterr.Error())
 		}
+		if sess.secretsProviderChange != nil {
+			instance.Status.LastSecretsProviderChange = sess.secretsProviderChange
+		}
+		if sess.lastRefresh != nil {
+			instance.Status.LastRefresh = sess.lastRefresh
+		}
+		if sess.environmentsSynced {
+			instance.Status.Environments = sess.environments
+		}
+		if sess.configKeysSynced {
+			instance.Status.ConfigKeys = sess.configKeys
+		}
+		if sess.tagsSynced {
+			instance.Status.Tags = sess.tags
+			instance.Status.TagsError = ""
+		} else if sess.tagsError != "" {
+			instance.Status.TagsError = sess.tagsError
+		}
+		// Processing the stack without giving up on it ends any abandonment.
+		if !isAbandoned(&instance.Status) {
+			instance.Status.Abandoned = nil
+		}
+		if sess.failure != nil && isUnclassifiedFailure(instance.Status.LastUpdate) {
+			r.recordFailure(ctx, sess, instance)
+		}
 		if err := sess.patchStatus(ctx, instance); err != nil {
 			log.Error(err, "unable to save object status")
 		}
+		if sess.outcomeRecorded {
+			sess.sendNotifications(ctx, instance)
+		}
+		if timings != "" {
+			r.emitEvent(instance, pulumiv1.StackReconcileTimingsEvent(), "Phase timings: %s", timings)
+		}
 	}
 	// there's no reason to save the status if it's being deleted, and it'll fail anyway.
 	if !isStackMarkedToBeDeleted {
 		defer saveStatus()
 	}
 
+	// Fields not in the schema are dropped by the API server; in strict mode, say so once for each
+	// generation of the object.
+	if r.strictSpecFields != strictSpecFieldsOff && instance.Status.ObservedGeneration != instance.GetGeneration() {
+		r.warnUnknownSpecFields(instance)
+	}
+
+	// A paused stack is left alone until it's resumed, which changes the spec and so queues it
+	// again. It isn't requeued in the meantime. Deletion goes ahead regardless.
+	if stack.Paused && !isStackMarkedToBeDeleted {
+		reqLogger.Info("Stack is paused; not processing it", "Stack.Name", stack.Stack)
+		instance.Status.MarkPausedCondition()
+		return reconcile.Result{}, nil
+	}
+
+	// Give the objects created along with a new stack (e.g., the Secrets it refers to) a chance to
+	// appear before it's first run.
+	if !isStackMarkedToBeDeleted {
+		if delay := initialReconcileDelay(instance, r.defaultInitialReconcileDelay, time.Now()); delay > 0 {
+			reqLogger.Info("Delaying first run of new stack", "Stack.Name", stack.Stack, "Delay", delay)
+			instance.Status.MarkReconcilingCondition(pulumiv1.ReconcilingInitialDelayReason,
+				fmt.Sprintf("new stack; waiting %s before the first run", delay.Round(time.Second)))
+			return reconcile.Result{RequeueAfter: delay}, nil
+		}
+	}
+
 	// Check prerequisites, to make sure they are adequately up to date. Any prerequisite failing to
 	// be met will cause this run to be abandoned and the stack under consideration to be requeued;
 	// however, we go through all of the prerequisites anyway, so we can annotate all failing stacks
 	// to be requeued themselves.
 	var failedPrereqNames []string // in the case there's more than one, we report the names
 	var failedPrereqErr error      // in caase there's just one, we report the specific error
+	var verifyRetryAfter time.Duration
+
+	if dependsOnErr != nil {
+		r.markStackFailed(sess, instance, dependsOnErr, "", "")
+		return r.abandon(instance, pulumiv1.StalledSpecInvalidReason, dependsOnErr.Error())
+	}
+	if !isStackMarkedToBeDeleted {
+		cycle, err := dependencyCycle(ctx, r.client, instance.Namespace, instance.Name, &stack)
+		if err != nil {
+			r.markStackFailed(sess, instance, err, "", "")
+			return reconcile.Result{}, err
+		}
+		if cycle != nil {
+			err := newStallErrorf("dependency cycle: %s", strings.Join(cycle, " -> "))
+			r.markStackFailed(sess, instance, err, "", "")
+			return r.abandon(instance, pulumiv1.StalledDependencyCycleReason, err.Error())
+		}
+	}
 
-	for _, prereq := range instance.Spec.Prerequisites {
+	prereqs := stack.Prerequisites
+	if sess.namespaceTerminating {
+		prereqs = nil // they're being deleted too
+	}
+	for _, prereq := range prereqs {
 		var prereqStack pulumiv1.Stack
 		key := types.NamespacedName{Name: prereq.Name, Namespace: instance.Namespace}
 		err := r.client.Get(ctx, key, &prereqStack)
@@ -526,9 +891,27 @@ func (r *ReconcileStack) Reconcile(ctx context.Context, request reconcile.Reques
 
 		// does the prerequisite stack satisfy the requirements given?
 		requireErr := isRequirementSatisfied(prereq.Requirement, prereqStack)
+		requeuePrereq := requireErr != nil
+		// a stack given in dependsOn must be Ready too; it's not requeued, since it'll be
+		// requeuing itself until it is.
+		if requireErr == nil && isDependedOn(&stack, prereq.Name) {
+			requireErr = isDependencyReady(&prereqStack)
+		}
+		// if so, and it's required to have verified its resources, has it done so?
+		var requestVerify bool
+		if requireErr == nil {
+			var retryAfter time.Duration
+			requestVerify, retryAfter, requireErr = r.verifications.check(prereq.Requirement, &prereqStack, time.Now())
+			requeuePrereq = requestVerify
+			if retryAfter > 0 && (verifyRetryAfter == 0 || retryAfter < verifyRetryAfter) {
+				verifyRetryAfter = retryAfter
+			}
+		}
 		if requireErr != nil {
 			failedPrereqNames = append(failedPrereqNames, prereq.Name)
 			failedPrereqErr = fmt.Errorf("prerequisite not satisfied for %q: %w", prereq.Name, requireErr)
+		}
+		if requeuePrereq {
 			// annotate the out of date stack so that it'll be queued. The value is arbitrary; this
 			// value gives a bit of context which might be helpful when troubleshooting.
 			v := fmt.Sprintf("update prerequisite of %s at %s", instance.Name, time.Now().Format(time.RFC3339))
@@ -538,9 +921,15 @@ func (r *ReconcileStack) Reconcile(ctx context.Context, request reconcile.Reques
 				a = map[string]string{}
 			}
 			a[shared.ReconcileRequestAnnotation] = v
+			if requestVerify {
+				a[shared.VerifyRequestAnnotation] = v
+			}
 			prereqStack1.SetAnnotations(a)
 			reqLogger.Info("requesting requeue of prerequisite", "name", prereqStack1.Name, "cause", requireErr.Error())
 			if err := r.client.Patch(ctx, prereqStack1, client.MergeFrom(&prereqStack)); err != nil {
+				if requestVerify {
+					r.verifications.withdraw(key)
+				}
 				// A conflict here may mean the prerequisite has been changed, or it's just been
 				// run. In any case, requeueing this object means we'll see the new state of the
 				// world next time around.
@@ -555,32 +944,67 @@ func (r *ReconcileStack) Reconcile(ctx context.Context, request reconcile.Reques
 	if failedPrereqErr != nil {
 		instance.Status.MarkReconcilingCondition(pulumiv1.ReconcilingPrerequisiteNotSatisfiedReason, failedPrereqErr.Error())
 		// Rely on the watcher watching prerequisites to requeue this, rather than requeuing
-		// explicitly.
-		return reconcile.Result{}, nil
+		// explicitly -- unless a prerequisite failed verification, in which case it won't be asked
+		// again until the verification window has passed.
+		return reconcile.Result{RequeueAfter: verifyRetryAfter}, nil
 	}
 
 	// We're ready to do some actual work. Until we have a definitive outcome, mark the stack as
 	// reconciling.
 	instance.Status.MarkReconcilingCondition(pulumiv1.ReconcilingProcessingReason, pulumiv1.ReconcilingProcessingMessage)
+	reportTimings = true
 	if err = sess.patchStatus(ctx, instance); err != nil {
 		return reconcile.Result{}, err
 	}
 
+	// requeueForSourcePoll keeps track of whether this object will need to be requeued for the
+	// purpose of polling its source.
+	trackBranch, requeueForSourcePoll, resyncFreqSeconds := sourcePolling(&sess.stack)
+
 	// This value is reported in .status, and is set from some property of the source -- whether
 	// it's the actual commit, or some analogue.
 	var currentCommit string
 
 	// Step 1. Set up the workdir, select the right stack and populate config if supplied.
 
-	exactlyOneOf := func(these ...bool) bool {
-		var found bool
-		for _, b := range these {
-			if found && b {
-				return false
+	// The backend settings and structured configuration are checked before anything is fetched,
+	// since they can't be fixed by retrying.
+	if err := validateSpec(&stack); err != nil {
+		r.markStackFailed(sess, instance, err, "", "")
+		return r.abandon(instance, pulumiv1.StalledSpecInvalidReason, err.Error())
+	}
+
+	// The ConfigMaps and Secrets given in configFrom and secretsFrom are read before anything is
+	// fetched, since a change to them means the stack is to be updated even if its source hasn't changed.
+	if err := sess.readConfigFrom(ctx); err != nil {
+		if isMissingReference(err) {
+			return waitForReferences(sess, instance, err), nil
+		}
+		r.markStackFailed(sess, instance, err, "", "")
+		instance.Status.MarkReconcilingCondition(pulumiv1.ReconcilingRetryReason, err.Error())
+		return reconcile.Result{Requeue: true}, nil
+	}
+	sess.readReferencesRevision(ctx)
+	// A stack being deleted doesn't need the outputs of the stacks it depends on, which may be
+	// gone already.
+	if !isStackMarkedToBeDeleted {
+		if err := sess.readDependencyOutputs(ctx); err != nil {
+			if isMissingReference(err) {
+				return waitForReferences(sess, instance, err), nil
 			}
-			found = found || b
+			r.markStackFailed(sess, instance, err, "", "")
+			instance.Status.MarkReconcilingCondition(pulumiv1.ReconcilingRetryReason, err.Error())
+			return reconcile.Result{Requeue: true}, nil
 		}
-		return found
+	}
+
+	// Stale credentials are caught before anything is run with them.
+	if refusal, err := r.checkCredentialAge(ctx, sess, instance); err != nil {
+		r.markStackFailed(sess, instance, err, "", "")
+		instance.Status.MarkReconcilingCondition(pulumiv1.ReconcilingRetryReason, err.Error())
+		return reconcile.Result{Requeue: true}, nil
+	} else if refusal != "" {
+		return r.credentialsStale(sess, instance, refusal)
 	}
 
 	// Create the workspace directory. Any problem here is unexpected, and treated as a
@@ -593,52 +1017,190 @@ func (r *ReconcileStack) Reconcile(ctx context.Context, request reconcile.Reques
 	// Delete the workspace directory after the reconciliation is completed (regardless of success or failure).
 	defer sess.CleanupWorkspaceDir()
 
+	// Fetching the source includes setting up the workspace, but the time spent configuring it and
+	// installing dependencies is accounted separately.
+	stopFetch := sess.timer.enter(phaseFetch)
+
+	// If only the configuration has changed since the last successful run, the workspace from that
+	// run can be reused, skipping fetching the source and installing dependencies.
+	if currentCommit, err = sess.SetupWorkdirFromCache(ctx); err != nil {
+		reqLogger.Info("Unable to reuse cached workspace, setting up workspace from source", "Error", err.Error())
+		currentCommit = ""
+		if _, err = sess.MakeWorkspaceDir(); err != nil {
+			return reconcile.Result{}, fmt.Errorf("unable to create tmp directory for workspace: %w", err)
+		}
+	}
+
 	// Check which kind of source we have.
 
 	switch {
-	case !exactlyOneOf(stack.GitSource != nil, stack.FluxSource != nil, stack.ProgramRef != nil):
+	case currentCommit != "":
+		reqLogger.Info("Configuration-only change; reusing cached workspace, skipping fetch and dependency installation",
+			"Stack.Name", stack.Stack, "Revision", currentCommit)
+
+	case !exactlyOneOf(stack.GitSource != nil, stack.FluxSource != nil, stack.ProgramRef != nil, stack.ProgramFrom != nil):
 		err := errOtherThanOneSourceSpecified
 		r.markStackFailed(sess, instance, err, "", "")
-		instance.Status.MarkStalledCondition(pulumiv1.StalledSpecInvalidReason, err.Error())
-		return reconcile.Result{}, nil
+		return r.abandon(instance, pulumiv1.StalledSpecInvalidReason, err.Error())
+
+	case stack.GitSource != nil && stack.GitSource.ProjectArchiveURL != "":
+		gitSource := stack.GitSource
+		if gitSource.ProjectRepo != "" || gitSource.ProjectPath != "" ||
+			gitSource.Commit != "" || gitSource.Branch != "" || gitSource.Tag != "" {
+			msg := "Stack source cannot specify 'projectArchiveURL' along with any of 'projectRepo', 'projectPath', 'branch', 'commit' or 'tag'"
+			r.emitEvent(instance, pulumiv1.StackConfigInvalidEvent(), msg)
+			reqLogger.Info(msg)
+			r.markStackFailed(sess, instance, errors.New(msg), "", "")
+			return r.abandon(instance, pulumiv1.StalledSpecInvalidReason, msg)
+		}
+		if currentCommit, err = sess.SetupWorkdirFromArchive(ctx, gitSource); err != nil {
+			if isMissingReference(err) {
+				return waitForReferences(sess, instance, err), nil
+			}
+			if errors.Is(err, errProjectNotFound) {
+				return r.projectNotFound(sess, instance, err)
+			}
+			if errors.Is(err, errPatchFailed) {
+				return r.patchFailed(sess, instance, err)
+			}
+			r.emitEvent(instance, pulumiv1.StackInitializationFailureEvent(), "Failed to initialize stack: %v", err.Error())
+			reqLogger.Error(err, "Failed to setup Pulumi workspace", "Stack.Name", stack.Stack)
+			r.markStackFailed(sess, instance, err, "", "")
+			if isStalledError(err) {
+				return r.abandon(instance, stalledReason(err, pulumiv1.StalledSourceUnavailableReason), err.Error())
+			}
+			instance.Status.MarkReconcilingCondition(pulumiv1.ReconcilingRetryReason, err.Error())
+			// this can fail for reasons which might go away without intervention; so, retry explicitly
+			return reconcile.Result{Requeue: true}, nil
+		}
+
+	case stack.GitSource != nil && stack.GitSource.ProjectPath != "":
+		gitSource := stack.GitSource
+		if gitSource.ProjectRepo != "" || gitSource.Commit != "" || gitSource.Branch != "" || gitSource.Tag != "" {
+			msg := "Stack source cannot specify 'projectPath' along with any of 'projectRepo', 'branch', 'commit' or 'tag'"
+			r.emitEvent(instance, pulumiv1.StackConfigInvalidEvent(), msg)
+			reqLogger.Info(msg)
+			r.markStackFailed(sess, instance, errors.New(msg), "", "")
+			return r.abandon(instance, pulumiv1.StalledSpecInvalidReason, msg)
+		}
+		if currentCommit, err = sess.SetupWorkdirFromLocalPath(ctx, gitSource); err != nil {
+			if errors.Is(err, errProjectNotFound) {
+				return r.projectNotFound(sess, instance, err)
+			}
+			if errors.Is(err, errPatchFailed) {
+				return r.patchFailed(sess, instance, err)
+			}
+			r.emitEvent(instance, pulumiv1.StackInitializationFailureEvent(), "Failed to initialize stack: %v", err.Error())
+			reqLogger.Error(err, "Failed to setup Pulumi workspace", "Stack.Name", stack.Stack)
+			r.markStackFailed(sess, instance, err, "", "")
+			if isStalledError(err) {
+				return r.abandon(instance, stalledReason(err, pulumiv1.StalledSourceUnavailableReason), err.Error())
+			}
+			instance.Status.MarkReconcilingCondition(pulumiv1.ReconcilingRetryReason, err.Error())
+			// this can fail for reasons which might go away without intervention; so, retry explicitly
+			return reconcile.Result{Requeue: true}, nil
+		}
 
 	case stack.GitSource != nil:
 		gitSource := stack.GitSource
 		// Validate that there is enough specified to be able to clone the git repo.
-		if gitSource.ProjectRepo == "" || (gitSource.Commit == "" && gitSource.Branch == "") {
+		if gitSource.ProjectRepo == "" || (gitSource.Commit == "" && gitSource.Branch == "" && gitSource.Tag == "") ||
+			(gitSource.Tag != "" && (gitSource.Commit != "" || gitSource.Branch != "")) {
 
-			msg := "Stack git source needs to specify 'projectRepo' and either 'branch' or 'commit'"
+			msg := "Stack git source needs to specify 'projectRepo' and one of 'branch', 'commit' or 'tag'"
 			r.emitEvent(instance, pulumiv1.StackConfigInvalidEvent(), msg)
 			reqLogger.Info(msg)
 			r.markStackFailed(sess, instance, errors.New(msg), "", "")
-			instance.Status.MarkStalledCondition(pulumiv1.StalledSpecInvalidReason, msg)
 			// this object won't be processable until the spec is changed, so no reason to requeue
 			// explicitly
-			return reconcile.Result{}, nil
+			return r.abandon(instance, pulumiv1.StalledSpecInvalidReason, msg)
 		}
 
 		gitAuth, err := sess.SetupGitAuth(ctx) // TODO be more explicit about what's being fed in here
 		if err != nil {
+			if isMissingReference(err) {
+				return waitForReferences(sess, instance, err), nil
+			}
 			r.emitEvent(instance, pulumiv1.StackGitAuthFailureEvent(), "Failed to setup git authentication: %v", err.Error())
 			reqLogger.Error(err, "Failed to setup git authentication", "Stack.Name", stack.Stack)
 			r.markStackFailed(sess, instance, err, "", "")
-			instance.Status.MarkStalledCondition(pulumiv1.StalledSourceUnavailableReason, err.Error())
-			return reconcile.Result{}, nil
+			return r.abandon(instance, pulumiv1.StalledSourceUnavailableReason, err.Error())
+		}
+
+		hostKeys, err := sess.SetupGitHostKeyPolicy(ctx)
+		if err != nil {
+			if isMissingReference(err) {
+				return waitForReferences(sess, instance, err), nil
+			}
+			r.emitEvent(instance, pulumiv1.StackGitAuthFailureEvent(), "Failed to setup git host key verification: %v", err.Error())
+			reqLogger.Error(err, "Failed to setup git host key verification", "Stack.Name", stack.Stack)
+			r.markStackFailed(sess, instance, err, "", "")
+			return r.abandon(instance, pulumiv1.StalledSourceUnavailableReason, err.Error())
 		}
 
-		if gitAuth.SSHPrivateKey != "" {
+		if gitAuth.SSHPrivateKey != "" && hostKeys.ScanHostKeys() {
 			// Add the project repo's public SSH keys to the SSH known hosts
 			// to perform the necessary key checking during SSH git cloning.
-			sess.addSSHKeysToKnownHosts(sess.stack.ProjectRepo)
+			if err := sess.addSSHKeysToKnownHosts(sess.stack.ProjectRepo); err != nil {
+				reqLogger.Error(err, "Failed to add SSH host keys to known hosts", "Stack.Name", stack.Stack)
+				r.markStackFailed(sess, instance, err, "", "")
+				instance.Status.MarkReconcilingCondition(pulumiv1.ReconcilingRetryReason, err.Error())
+				return reconcile.Result{Requeue: true}, nil
+			}
 		}
 
-		if currentCommit, err = sess.SetupWorkdirFromGitSource(ctx, gitAuth, gitSource); err != nil {
+		// If the branch or tag still points at the commit last deployed, and nothing else has
+		// changed, there's no need to fetch the source at all. Any problem finding out is left to
+		// be reported by fetching the source. A stack due to be checked for drift needs the source
+		// though. Likewise a stack pinned to the commit last deployed, which saves cloning (and
+		// perhaps deepening the clone to find the commit) each time it's resynced.
+		driftCheck, _ := driftCheckDue(instance, time.Now())
+		knownRevision := (trackBranch && (gitSource.Branch != "" || gitSource.Tag != "")) || gitSource.Commit != ""
+		if !isStackMarkedToBeDeleted && !driftCheck && knownRevision && sess.updateUnchanged(instance, lastSuccessfulCommit(instance)) {
+			revision, err := sess.ResolveGitSourceRevision(ctx, gitAuth, hostKeys, gitSource)
+			if err != nil {
+				reqLogger.Info("Unable to resolve revision without fetching the source", "Error", err.Error())
+			} else if sess.updateUnchanged(instance, revision) {
+				return skipUnchangedUpdate(sess, instance, revision, resyncFreqSeconds), nil
+			}
+		}
+
+		// A stack being destroyed is destroyed using the revision it was last deployed at, unless
+		// it says otherwise.
+		if isStackMarkedToBeDeleted && stack.DestroyOnFinalize {
+			gitSource = destroyGitSource(instance, gitSource)
+		}
+
+		if currentCommit, err = sess.SetupWorkdirFromGitSource(ctx, gitAuth, hostKeys, gitSource); err != nil {
+			if isMissingReference(err) {
+				return waitForReferences(sess, instance, err), nil
+			}
+			if errors.Is(err, errProjectNotFound) {
+				return r.projectNotFound(sess, instance, err)
+			}
+			if errors.Is(err, errCommitNotFound) {
+				return r.commitNotFound(sess, instance, err)
+			}
+			if errors.Is(err, errGitCloneFailed) {
+				return r.gitCloneFailed(sess, instance, err)
+			}
+			if errors.Is(err, errPatchFailed) {
+				return r.patchFailed(sess, instance, err)
+			}
 			r.emitEvent(instance, pulumiv1.StackInitializationFailureEvent(), "Failed to initialize stack: %v", err.Error())
 			reqLogger.Error(err, "Failed to setup Pulumi workspace", "Stack.Name", stack.Stack)
 			r.markStackFailed(sess, instance, err, "", "")
+			if isHostKeyVerificationError(err) {
+				return r.abandon(instance, pulumiv1.StalledHostKeyVerificationFailedReason, err.Error())
+			}
+			if isTLSVerificationError(err) {
+				return r.abandon(instance, pulumiv1.StalledTLSVerificationFailedReason, err.Error())
+			}
+			if isGitAuthenticationError(err) {
+				return r.abandon(instance, pulumiv1.StalledGitAuthenticationFailedReason, err.Error())
+			}
 			if isStalledError(err) {
-				instance.Status.MarkStalledCondition(pulumiv1.StalledCrossNamespaceRefForbiddenReason, err.Error())
-				return reconcile.Result{}, nil
+				return r.abandon(instance, pulumiv1.StalledCrossNamespaceRefForbiddenReason, err.Error())
 			}
 			instance.Status.MarkReconcilingCondition(pulumiv1.ReconcilingRetryReason, err.Error())
 			// this can fail for reasons which might go away without intervention; so, retry explicitly
@@ -647,12 +1209,19 @@ func (r *ReconcileStack) Reconcile(ctx context.Context, request reconcile.Reques
 
 	case stack.FluxSource != nil:
 		fluxSource := stack.FluxSource
+		sourceNamespace := fluxSourceNamespace(request.Namespace, fluxSource.SourceRef)
+		// enforce namespace isolation unless it's explicitly been waived
+		if !IsNamespaceIsolationWaived() && sourceNamespace != request.Namespace {
+			reterr := fmt.Errorf("cannot use source in namespace %q: %w", sourceNamespace, errNamespaceIsolation)
+			r.markStackFailed(sess, instance, reterr, "", "")
+			return r.abandon(instance, pulumiv1.StalledCrossNamespaceRefForbiddenReason, reterr.Error())
+		}
 		var sourceObject unstructured.Unstructured
 		sourceObject.SetAPIVersion(fluxSource.SourceRef.APIVersion)
 		sourceObject.SetKind(fluxSource.SourceRef.Kind)
 		if err := r.client.Get(ctx, client.ObjectKey{
 			Name:      fluxSource.SourceRef.Name,
-			Namespace: request.Namespace,
+			Namespace: sourceNamespace,
 		}, &sourceObject); err != nil {
 			reterr := fmt.Errorf("could not resolve sourceRef: %w", err)
 			r.markStackFailed(sess, instance, reterr, "", "")
@@ -661,16 +1230,14 @@ func (r *ReconcileStack) Reconcile(ctx context.Context, request reconcile.Reques
 			}
 			// this is marked as stalled and not requeued; the watch mechanism will requeue it if
 			// the source it points to appears.
-			instance.Status.MarkStalledCondition(pulumiv1.StalledSourceUnavailableReason, reterr.Error())
-			return reconcile.Result{}, nil
+			return r.abandon(instance, pulumiv1.StalledSourceUnavailableReason, reterr.Error())
 		}
 
 		// Watch this kind of source, if we haven't already.
 		if err := r.maybeWatchFluxSourceKind(fluxSource.SourceRef); err != nil {
 			reterr := fmt.Errorf("cannot process source reference: %w", err)
 			r.markStackFailed(sess, instance, reterr, "", "")
-			instance.Status.MarkStalledCondition(pulumiv1.StalledSpecInvalidReason, reterr.Error())
-			return reconcile.Result{}, nil
+			return r.abandon(instance, pulumiv1.StalledSpecInvalidReason, reterr.Error())
 		}
 
 		if err := checkFluxSourceReady(sourceObject); err != nil {
@@ -683,12 +1250,20 @@ func (r *ReconcileStack) Reconcile(ctx context.Context, request reconcile.Reques
 
 		currentCommit, err = sess.SetupWorkdirFromFluxSource(ctx, sourceObject, fluxSource)
 		if err != nil {
+			if isMissingReference(err) {
+				return waitForReferences(sess, instance, err), nil
+			}
+			if errors.Is(err, errProjectNotFound) {
+				return r.projectNotFound(sess, instance, err)
+			}
+			if errors.Is(err, errPatchFailed) {
+				return r.patchFailed(sess, instance, err)
+			}
 			r.emitEvent(instance, pulumiv1.StackInitializationFailureEvent(), "Failed to initialize stack: %v", err.Error())
 			reqLogger.Error(err, "Failed to setup Pulumi workspace", "Stack.Name", stack.Stack)
 			r.markStackFailed(sess, instance, err, "", "")
 			if isStalledError(err) {
-				instance.Status.MarkStalledCondition(pulumiv1.StalledCrossNamespaceRefForbiddenReason, err.Error())
-				return reconcile.Result{}, nil
+				return r.abandon(instance, pulumiv1.StalledCrossNamespaceRefForbiddenReason, err.Error())
 			}
 			instance.Status.MarkReconcilingCondition(pulumiv1.ReconcilingRetryReason, err.Error())
 			// this can fail for reasons which might go away without intervention; so, retry explicitly
@@ -698,16 +1273,47 @@ func (r *ReconcileStack) Reconcile(ctx context.Context, request reconcile.Reques
 	case stack.ProgramRef != nil:
 		programRef := stack.ProgramRef
 		if currentCommit, err = sess.SetupWorkdirFromYAML(ctx, *programRef); err != nil {
+			if isMissingReference(err) {
+				return waitForReferences(sess, instance, err), nil
+			}
+			if errors.Is(err, errProjectNotFound) {
+				return r.projectNotFound(sess, instance, err)
+			}
+			if errors.Is(err, errPatchFailed) {
+				return r.patchFailed(sess, instance, err)
+			}
 			r.emitEvent(instance, pulumiv1.StackInitializationFailureEvent(), "Failed to initialize stack: %v", err.Error())
 			reqLogger.Error(err, "Failed to setup Pulumi workspace", "Stack.Name", stack.Stack)
 			r.markStackFailed(sess, instance, err, "", "")
 			if errors.Is(err, errProgramNotFound) {
-				instance.Status.MarkStalledCondition(pulumiv1.StalledSourceUnavailableReason, err.Error())
-				return reconcile.Result{}, nil
+				return r.abandon(instance, pulumiv1.StalledSourceUnavailableReason, err.Error())
 			}
 			if isStalledError(err) {
-				instance.Status.MarkStalledCondition(pulumiv1.StalledSpecInvalidReason, err.Error())
-				return reconcile.Result{}, nil
+				return r.abandon(instance, stalledReason(err, pulumiv1.StalledSpecInvalidReason), err.Error())
+			}
+			instance.Status.MarkReconcilingCondition(pulumiv1.ReconcilingRetryReason, err.Error())
+			// this can fail for reasons which might go away without intervention; so, retry explicitly
+			return reconcile.Result{Requeue: true}, nil
+		}
+
+	case stack.ProgramFrom != nil:
+		if currentCommit, err = sess.SetupWorkdirFromConfigMap(ctx, stack.ProgramFrom); err != nil {
+			if isMissingReference(err) {
+				// the watch on ConfigMaps will requeue the stack when the ConfigMap appears
+				return waitForReferences(sess, instance, err), nil
+			}
+			if errors.Is(err, errProjectNotFound) {
+				return r.projectNotFound(sess, instance, err)
+			}
+			if errors.Is(err, errPatchFailed) {
+				return r.patchFailed(sess, instance, err)
+			}
+			r.emitEvent(instance, pulumiv1.StackInitializationFailureEvent(), "Failed to initialize stack: %v", err.Error())
+			reqLogger.Error(err, "Failed to setup Pulumi workspace", "Stack.Name", stack.Stack)
+			r.markStackFailed(sess, instance, err, "", "")
+			if isStalledError(err) {
+				// the watch on ConfigMaps will requeue the stack when the ConfigMap is changed
+				return r.abandon(instance, stalledReason(err, pulumiv1.StalledSpecInvalidReason), err.Error())
 			}
 			instance.Status.MarkReconcilingCondition(pulumiv1.ReconcilingRetryReason, err.Error())
 			// this can fail for reasons which might go away without intervention; so, retry explicitly
@@ -715,25 +1321,68 @@ func (r *ReconcileStack) Reconcile(ctx context.Context, request reconcile.Reques
 		}
 	}
 
+	stopFetch()
+
 	// Step 2. If there are extra environment variables, read them in now and use them for subsequent commands.
 	if err = sess.SetEnvs(ctx, stack.Envs, request.Namespace); err != nil {
 		err := fmt.Errorf("could not find ConfigMap for Envs: %w", err)
+		if isMissingReference(err) {
+			return waitForReferences(sess, instance, err), nil
+		}
 		r.markStackFailed(sess, instance, err, currentCommit, "")
 		instance.Status.MarkReconcilingCondition(pulumiv1.ReconcilingRetryReason, err.Error())
 		return reconcile.Result{Requeue: true}, nil
 	}
 	if err = sess.SetSecretEnvs(ctx, stack.SecretEnvs, request.Namespace); err != nil {
 		err := fmt.Errorf("could not find Secret for SecretEnvs: %w", err)
+		if isMissingReference(err) {
+			return waitForReferences(sess, instance, err), nil
+		}
 		r.markStackFailed(sess, instance, err, currentCommit, "")
 		instance.Status.MarkReconcilingCondition(pulumiv1.ReconcilingRetryReason, err.Error())
 		return reconcile.Result{Requeue: true}, nil
 	}
 
+	// Attach the ESC environments given, before the stack is refreshed, updated or destroyed.
+	if err = sess.syncEnvironments(ctx, instance.Status.Environments); err != nil {
+		if errors.Is(err, errEnvironmentNotFound) {
+			return r.environmentNotFound(sess, instance, err)
+		}
+		r.emitEvent(instance, pulumiv1.StackInitializationFailureEvent(), "Failed to initialize stack: %v", err.Error())
+		r.markStackFailed(sess, instance, err, currentCommit, "")
+		instance.Status.MarkReconcilingCondition(pulumiv1.ReconcilingRetryReason, err.Error())
+		return reconcile.Result{Requeue: true}, nil
+	}
+
+	// Set the tags given, whether or not the stack is then updated. Tags are bookkeeping, so
+	// failing to set them doesn't fail the stack; the error is recorded in the status, and they're
+	// tried again next time.
+	if !isStackMarkedToBeDeleted {
+		if err = sess.syncTags(ctx, instance.Status.Tags); err != nil {
+			reqLogger.Info("Unable to set stack tags", "Stack.Name", stack.Stack, "Error", err.Error())
+			sess.tagsError = err.Error()
+		}
+	}
+
 	// This is enough preparation to be able to destroy the stack, if it's being deleted, or to
 	// consider it destroyable, if not.
 
 	if isStackMarkedToBeDeleted {
 		if contains(instance.GetFinalizers(), pulumiFinalizer) {
+			if stack.DestroyOnFinalize {
+				recordDestroyRevision(ctx, sess, instance, currentCommit)
+				approved, wait, err := r.awaitDestroyApproval(ctx, sess, instance)
+				if err != nil || !approved {
+					return reconcile.Result{RequeueAfter: wait}, err
+				}
+				var approval *pulumiv1.StackDestroyApproval
+				if instance.Status.DestroyProgress != nil {
+					approval = instance.Status.DestroyProgress.Approval
+				}
+				if msg, ok := elevatedDestroyAudit(stack.DestroyOptions, approval); ok {
+					r.emitEvent(instance, pulumiv1.StackElevatedDestroyEvent(), "%s", msg)
+				}
+			}
 			err := sess.finalize(ctx, instance)
 			// Manage extra status here
 			return reconcile.Result{}, err
@@ -753,43 +1402,43 @@ func (r *ReconcileStack) Reconcile(ctx context.Context, request reconcile.Reques
 		}
 	}
 
-	// Proceed/Requeue logic: this depends on the kind of source, but broadly:
-	// - if the fetched revision is the same as the last one, proceed only if
-	//   `ContinueResyncOnCommitMatch`
-	// - if not proceeding, requeue in ResyncFrequencySeconds (sic)
-
-	// requeueForSourcePoll keeps track of whether this object will need to be requeued for the
-	// purpose of polling its source.
-	requeueForSourcePoll := true
-	resyncFreqSeconds := sess.stack.ResyncFrequencySeconds
-	if sess.stack.ResyncFrequencySeconds != 0 && sess.stack.ResyncFrequencySeconds < 60 {
-		resyncFreqSeconds = 60
+	// A stack depending on this one may have asked for its resources to be verified. This is done
+	// whether or not there's an update to run, since the dependent stack is waiting on it.
+	if verifyRequest, ok := verificationRequested(instance); ok {
+		r.verifications.begin(request.NamespacedName)
+		v := sess.verifyResources(ctx, instance, verifyRequest)
+		r.verifications.finish(request.NamespacedName, v)
+		if v.Passed {
+			reqLogger.Info("Verified stack resources", "message", v.Message)
+		} else {
+			reqLogger.Info("Stack resources failed verification", "message", v.Message, "driftedOutputs", v.DriftedOutputs)
+		}
+		if err := sess.patchStatus(ctx, instance); err != nil {
+			return reconcile.Result{}, err
+		}
 	}
 
-	if stack.GitSource != nil {
-		trackBranch := len(stack.GitSource.Branch) > 0
-		// this object won't need to be requeued later if it's not tracking a branch
-		requeueForSourcePoll = trackBranch
-
-		// when tracking a branch, rather than an exact commit, always requeue
-		if trackBranch || sess.stack.ContinueResyncOnCommitMatch {
-			if resyncFreqSeconds == 0 {
-				resyncFreqSeconds = 60
-			}
+	// A stack which is to have drift detected rather than remediated isn't updated again at the same
+	// revision; instead, it's checked for drift when that's due.
+	if stack.DriftDetectionOnly && sess.updateUnchanged(instance, currentCommit) {
+		var pollInterval time.Duration
+		if requeueForSourcePoll {
+			pollInterval = time.Duration(resyncFreqSeconds) * time.Second
 		}
+		return r.checkForDrift(ctx, sess, instance, currentCommit, pollInterval), nil
+	}
 
+	// Proceed/Requeue logic: this depends on the kind of source, but broadly:
+	// - if the fetched revision is the same as the last one successfully deployed, and neither the
+	//   spec has changed nor a reconciliation been requested since, proceed only if
+	//   `ContinueResyncOnCommitMatch`, or a resync is due
+	// - if not proceeding, requeue in ResyncFrequencySeconds (sic)
+
+	if stack.GitSource != nil {
 		if trackBranch && instance.Status.LastUpdate != nil {
 			reqLogger.Info("Checking current HEAD commit hash", "Current commit", currentCommit)
-			if instance.Status.LastUpdate.LastSuccessfulCommit == currentCommit && !sess.stack.ContinueResyncOnCommitMatch {
-				reqLogger.Info("Commit hash unchanged. Will poll again.", "pollFrequencySeconds", resyncFreqSeconds)
-				// Reconcile every resyncFreqSeconds to check for new commits to the branch.
-				instance.Status.MarkReadyCondition() // FIXME: should this reflect the previous update state?
-				// Ensure lastUpdate state is updated if previous sync failure occurred
-				if instance.Status.LastUpdate.State != shared.SucceededStackStateMessage {
-					instance.Status.LastUpdate.State = shared.SucceededStackStateMessage
-					instance.Status.LastUpdate.LastResyncTime = metav1.Now()
-				}
-				return reconcile.Result{RequeueAfter: time.Duration(resyncFreqSeconds) * time.Second}, nil
+			if sess.updateUnchanged(instance, currentCommit) {
+				return skipUnchangedUpdate(sess, instance, currentCommit, resyncFreqSeconds), nil
 			}
 
 			if instance.Status.LastUpdate.LastSuccessfulCommit != currentCommit {
@@ -801,16 +1450,8 @@ func (r *ReconcileStack) Reconcile(ctx context.Context, request reconcile.Reques
 
 	} else if stack.FluxSource != nil {
 		if instance.Status.LastUpdate != nil {
-			if instance.Status.LastUpdate.LastSuccessfulCommit == currentCommit && !stack.ContinueResyncOnCommitMatch {
-				reqLogger.Info("Commit hash unchanged. Will poll again.", "pollFrequencySeconds", resyncFreqSeconds)
-				// Reconcile every resyncFreqSeconds to check for new commits to the branch.
-				instance.Status.MarkReadyCondition() // FIXME: should this reflect the previous update state?
-				// Ensure lastUpdate state is updated if previous sync failure occurred
-				if instance.Status.LastUpdate.State != shared.SucceededStackStateMessage {
-					instance.Status.LastUpdate.State = shared.SucceededStackStateMessage
-					instance.Status.LastUpdate.LastResyncTime = metav1.Now()
-				}
-				return reconcile.Result{RequeueAfter: time.Duration(resyncFreqSeconds) * time.Second}, nil
+			if sess.updateUnchanged(instance, currentCommit) {
+				return skipUnchangedUpdate(sess, instance, currentCommit, resyncFreqSeconds), nil
 			}
 
 			if instance.Status.LastUpdate.LastSuccessfulCommit != currentCommit {
@@ -819,18 +1460,10 @@ func (r *ReconcileStack) Reconcile(ctx context.Context, request reconcile.Reques
 					"Last commit", instance.Status.LastUpdate.LastSuccessfulCommit)
 			}
 		}
-	} else if stack.ProgramRef != nil {
+	} else if stack.ProgramRef != nil || stack.ProgramFrom != nil {
 		if instance.Status.LastUpdate != nil {
-			if instance.Status.LastUpdate.LastSuccessfulCommit == currentCommit && !stack.ContinueResyncOnCommitMatch {
-				reqLogger.Info("Commit hash unchanged. Will poll again.", "pollFrequencySeconds", resyncFreqSeconds)
-				// Reconcile every resyncFreqSeconds to check for new commits to the branch.
-				instance.Status.MarkReadyCondition() // FIXME: should this reflect the previous update state?
-				// Ensure lastUpdate state is updated if previous sync failure occurred
-				if instance.Status.LastUpdate.State != shared.SucceededStackStateMessage {
-					instance.Status.LastUpdate.State = shared.SucceededStackStateMessage
-					instance.Status.LastUpdate.LastResyncTime = metav1.Now()
-				}
-				return reconcile.Result{RequeueAfter: time.Duration(resyncFreqSeconds) * time.Second}, nil
+			if sess.updateUnchanged(instance, currentCommit) {
+				return skipUnchangedUpdate(sess, instance, currentCommit, resyncFreqSeconds), nil
 			}
 
 			if instance.Status.LastUpdate.LastSuccessfulCommit != currentCommit {
@@ -841,16 +1474,50 @@ func (r *ReconcileStack) Reconcile(ctx context.Context, request reconcile.Reques
 		}
 	}
 
+	// An update recorded as started by another instance of the operator (e.g., before the operator
+	// was upgraded) may still be running, or may have finished without the status being updated.
+	// Find out which before running an update.
+	done := reconcile.Result{}
+	if requeueForSourcePoll || sess.stack.ContinueResyncOnCommitMatch {
+		done = reconcile.Result{RequeueAfter: time.Duration(resyncFreqSeconds) * time.Second}
+	}
+	if stop, result, err := r.handover(ctx, sess, instance, currentCommit, done); stop {
+		return result, err
+	}
+
+	// Commands given to prepare the workspace (e.g., to generate files) are run once it's set up.
+	if err := sess.runCommands(ctx, "pre-run", stack.PreRunCommands); err != nil {
+		return r.commandFailed(sess, instance, err, currentCommit, "")
+	}
+
+	// A stack with previewOnly set is previewed rather than refreshed and updated; see preview.go.
+	if stack.PreviewOnly {
+		return r.previewInsteadOfUpdate(ctx, sess, instance, currentCommit, done), nil
+	}
+
 	// targets are used for both refresh and up, if present
 	targets := stack.Targets
 
-	// Step 3. If a stack refresh is requested, run it now.
-	if sess.stack.Refresh {
-		permalink, err := sess.RefreshStack(ctx, sess.stack.ExpectNoRefreshChanges, targets)
+	// Step 3. If a stack refresh is requested, run it now. A resync always refreshes the stack, so
+	// that the update puts right any drift of its resources.
+	instance.Status.ClearRefreshFailedCondition()
+	refresh := refreshOptions(&sess.stack)
+	if resyncDue(instance, time.Now()) {
+		reqLogger.Info("Resyncing stack", "Stack.Name", stack.Stack, "ResyncFrequencySeconds", stack.ResyncFrequencySeconds)
+		refresh.Enabled = true
+	}
+	if refresh.Enabled {
+		permalink, err := sess.refreshBeforeUpdate(ctx, refresh, targets)
+		refreshErr := err
 		if err != nil {
-			r.markStackFailed(sess, instance, fmt.Errorf("refreshing stack: %w", err), currentCommit, permalink)
-			instance.Status.MarkReconcilingCondition(pulumiv1.ReconcilingRetryReason, err.Error())
-			return reconcile.Result{Requeue: true}, nil
+			if !sess.stack.ContinueOnRefreshError || isUnexpectedRefreshChanges(err) {
+				r.markStackFailed(sess, instance, fmt.Errorf("refreshing stack: %w", err), currentCommit, permalink)
+				instance.Status.MarkReconcilingCondition(pulumiv1.ReconcilingRetryReason, err.Error())
+				return reconcile.Result{Requeue: true}, nil
+			}
+			reqLogger.Info("WARNING: refresh failed; continuing with the update, since continueOnRefreshError is set",
+				"Stack.Name", stack.Stack, "Error", err.Error())
+			instance.Status.MarkRefreshFailedCondition(err.Error())
 		}
 		if instance.Status.LastUpdate == nil {
 			instance.Status.LastUpdate = &shared.StackUpdateState{}
@@ -862,39 +1529,183 @@ func (r *ReconcileStack) Reconcile(ctx context.Context, request reconcile.Reques
 			reqLogger.Error(err, "Failed to update Stack status for refresh", "Stack.Name", stack.Stack)
 			return reconcile.Result{}, err
 		}
-		reqLogger.Info("Successfully refreshed Stack", "Stack.Name", stack.Stack)
+		if refreshErr == nil {
+			reqLogger.Info("Successfully refreshed Stack", "Stack.Name", stack.Stack)
+		}
+	}
+
+	// Resources to be adopted by the stack are imported before it's updated.
+	if len(stack.Imports) > 0 {
+		err := sess.ImportResources(ctx)
+		instance.Status.Imported = recordImported(instance.Status.Imported, sess.imported)
+		if err != nil {
+			r.markStackFailed(sess, instance, err, currentCommit, "")
+			instance.Status.MarkReconcilingCondition(pulumiv1.ReconcilingRetryReason, err.Error())
+			return reconcile.Result{Requeue: true}, nil
+		}
 	}
 
 	// Step 4. Run a `pulumi up --skip-preview`.
 	// TODO: is it possible to support a --dry-run with a preview?
+
+	// Record that an update is being started, so that if it's interrupted (e.g., the operator is
+	// restarted) the lock left behind can be recognised as the operator's own.
+	interruptedUpdate := instance.Status.CurrentUpdate
+	reconcileRequest, _ := getReconcileRequestAnnotation(instance)
+	startedUpdate := &pulumiv1.CurrentStackUpdate{
+		Generation:         instance.GetGeneration(),
+		Commit:             currentCommit,
+		ReconcileRequest:   reconcileRequest,
+		ConfigFromRevision: sess.configFromRevision,
+		ReferencesRevision: sess.referencesRevision,
+		PatchChecksum:      patchesChecksum(stack.Patches),
+		StartTime:          metav1.Now(),
+		Operator:           r.operatorID,
+	}
+	instance.Status.CurrentUpdate = startedUpdate
+	if startedUpdate.PatchChecksum != "" {
+		r.emitEvent(instance, pulumiv1.StackPatchedEvent(),
+			"Updating with %d patch(es) applied to the source (%s); remove them from .spec.patches once the change is merged.",
+			len(stack.Patches), startedUpdate.PatchChecksum)
+	}
+	if err = sess.patchStatus(ctx, instance); err != nil {
+		return reconcile.Result{}, err
+	}
+
+	attempt := beginUpdateAttempt(instance.Status, instance.GetGeneration(), currentCommit)
 	status, permalink, result, err := sess.UpdateStack(ctx, targets)
+	recordUpdateMetrics(instance.Namespace, instance.Name, status, time.Since(startedUpdate.StartTime.Time))
+	instance.Status.CurrentUpdate = nil
+	if status != shared.StackUpdateConflict {
+		instance.Status.ConflictRetries = 0
+	}
+	if status != shared.StackUpdateRetryable {
+		instance.Status.TransientRetries = 0
+	}
 	switch status {
 	case shared.StackUpdateConflict:
+		// This attempt didn't get as far as starting an update, so the update recorded before (if
+		// any) is still the one holding the lock.
+		instance.Status.CurrentUpdate = interruptedUpdate
 		r.emitEvent(instance,
 			pulumiv1.StackUpdateConflictDetectedEvent(),
 			"Conflict with another concurrent update. "+
 				"If Stack CR specifies 'retryOnUpdateConflict' a retry will trigger automatically.")
-		if sess.stack.RetryOnUpdateConflict {
-			reqLogger.Error(err, "Conflict with another concurrent update -- will retry shortly", "Stack.Name", stack.Stack)
-			instance.Status.MarkReconcilingCondition(pulumiv1.ReconcilingRetryReason, "conflict with concurrent update, retryOnUpdateConflict set")
-			return reconcile.Result{RequeueAfter: time.Second * 5}, nil
+		if sess.stack.CancelOnConflict && interruptedUpdate != nil && !cancelAttemptedSince(instance.Status.LastCancel, interruptedUpdate) {
+			reqLogger.Info("Cancelling interrupted update started by the operator", "Stack.Name", stack.Stack,
+				"StartTime", interruptedUpdate.StartTime)
+			cancelState := &pulumiv1.StackCancelState{Time: metav1.Now()}
+			instance.Status.LastCancel = cancelState
+			if err := sess.CancelStack(ctx); err != nil {
+				reqLogger.Error(err, "Failed to cancel interrupted update", "Stack.Name", stack.Stack)
+				cancelState.Message = err.Error()
+			} else {
+				cancelState.Succeeded = true
+				instance.Status.CurrentUpdate = nil
+				r.emitEvent(instance, pulumiv1.StackUpdateCancelledEvent(),
+					"Cancelled update interrupted at %s.", interruptedUpdate.StartTime.Format(time.RFC3339))
+				instance.Status.MarkReconcilingCondition(pulumiv1.ReconcilingRetryReason, "cancelled interrupted update; retrying")
+				return reconcile.Result{RequeueAfter: time.Second * 5}, nil
+			}
 		}
-		reqLogger.Error(err, "Conflict with another concurrent update -- NOT retrying", "Stack.Name", stack.Stack)
-		instance.Status.MarkStalledCondition(pulumiv1.StalledConflictReason, "conflict with concurrent update, retryOnUpdateConflict not set")
-		return reconcile.Result{}, nil
+		policy, retry, perr := getConflictRetryPolicy(&sess.stack)
+		if perr != nil {
+			return r.abandon(instance, pulumiv1.StalledSpecInvalidReason, perr.Error())
+		}
+		if !retry {
+			reqLogger.Error(err, "Conflict with another concurrent update -- NOT retrying", "Stack.Name", stack.Stack)
+			return r.abandon(instance, pulumiv1.StalledConflictReason, "conflict with concurrent update, retryOnUpdateConflict not set")
+		}
+		if instance.Status.ConflictRetries >= policy.maxRetries {
+			reqLogger.Error(err, "Conflict with another concurrent update -- retries exhausted", "Stack.Name", stack.Stack,
+				"Retries", instance.Status.ConflictRetries)
+			// counting starts again when the abandonment is ended
+			instance.Status.ConflictRetries = 0
+			return r.abandon(instance, pulumiv1.StalledConflictReason,
+				fmt.Sprintf("conflict with concurrent update persisted after %d retries", policy.maxRetries))
+		}
+		instance.Status.ConflictRetries++
+		backoff := policy.backoff(instance.Status.ConflictRetries)
+		reqLogger.Error(err, "Conflict with another concurrent update -- will retry", "Stack.Name", stack.Stack,
+			"Retry", instance.Status.ConflictRetries, "Backoff", backoff)
+		instance.Status.MarkReconcilingCondition(pulumiv1.ReconcilingRetryReason,
+			fmt.Sprintf("conflict with concurrent update; retry %d of %d in %s", instance.Status.ConflictRetries, policy.maxRetries, backoff))
+		return reconcile.Result{RequeueAfter: backoff}, nil
+	case shared.StackUpdateTimeout:
+		r.markStackFailed(sess, instance, err, currentCommit, permalink)
+		attempt.addChanges(sess.lastResourceChanges(ctx))
+		attempt.applyTo(instance.Status.LastUpdate)
+		recordUpdate(instance, startedUpdate.StartTime)
+		// The update was stopped part way through, so it may still hold the stack's lock; cancel
+		// it so the retry isn't blocked. If that doesn't work, the update remains recorded as
+		// current, so that cancelOnConflict can deal with it.
+		if cerr := sess.CancelStack(ctx); cerr != nil {
+			reqLogger.Info("Unable to cancel timed out update", "Stack.Name", stack.Stack, "Error", cerr.Error())
+			instance.Status.CurrentUpdate = startedUpdate
+		}
+		instance.Status.MarkReconcilingCondition(pulumiv1.ReconcilingUpdateTimeoutReason, err.Error())
+		// retry, with the backoff that applies to failures
+		return reconcile.Result{Requeue: true}, nil
 	case shared.StackNotFound:
 		r.emitEvent(instance, pulumiv1.StackNotFoundEvent(), "Stack not found. Will retry.")
 		reqLogger.Error(err, "Stack not found -- will retry shortly", "Stack.Name", stack.Stack, "Err:")
 		instance.Status.MarkReconcilingCondition(pulumiv1.ReconcilingRetryReason, "stack not found in backend; retrying")
 		return reconcile.Result{RequeueAfter: time.Second * 5}, nil
+	case shared.StackUpdateRetryable:
+		if instance.Status.TransientRetries < maxTransientRetries {
+			instance.Status.TransientRetries++
+			backoff := transientRetryWait(instance.Status.TransientRetries)
+			r.emitEvent(instance, pulumiv1.StackUpdateTransientFailureEvent(),
+				"Update failed with an error which is likely to be transient; retry %d of %d in %s: %v.",
+				instance.Status.TransientRetries, maxTransientRetries, backoff, err.Error())
+			reqLogger.Info("Update failed with a transient error -- will retry", "Stack.Name", stack.Stack,
+				"Retry", instance.Status.TransientRetries, "Backoff", backoff, "Error", err.Error())
+			instance.Status.MarkReconcilingCondition(pulumiv1.ReconcilingTransientErrorReason,
+				fmt.Sprintf("transient error; retry %d of %d in %s: %s", instance.Status.TransientRetries, maxTransientRetries, backoff, err.Error()))
+			return reconcile.Result{RequeueAfter: backoff}, nil
+		}
+		// counting starts again with the next update, which is retried as after any failure
+		instance.Status.TransientRetries = 0
+		fallthrough
 	default:
 		if err != nil {
 			r.markStackFailed(sess, instance, err, currentCommit, permalink)
+			attempt.addChanges(sess.lastResourceChanges(ctx))
+			attempt.applyTo(instance.Status.LastUpdate)
+			recordUpdate(instance, startedUpdate.StartTime)
+			instance.Status.MarkReconcilingCondition(pulumiv1.ReconcilingRetryReason, err.Error())
+			return reconcile.Result{Requeue: true}, nil
+		}
+	}
+	if result.Summary.ResourceChanges != nil {
+		attempt.addChanges(*result.Summary.ResourceChanges)
+	}
+
+	// The update sets the protection of each resource to what the program gives, so protecting
+	// them all is done after every update.
+	if stack.ProtectResources {
+		if err := sess.setProtected(ctx, true); err != nil {
+			r.markStackFailed(sess, instance, err, currentCommit, permalink)
+			attempt.applyTo(instance.Status.LastUpdate)
+			recordUpdate(instance, startedUpdate.StartTime)
 			instance.Status.MarkReconcilingCondition(pulumiv1.ReconcilingRetryReason, err.Error())
 			return reconcile.Result{Requeue: true}, nil
 		}
 	}
 
+	// Commands given to check the update (e.g., smoke tests) are run only once it has succeeded.
+	if err := sess.runCommands(ctx, "post-run", stack.PostRunCommands); err != nil {
+		res, rerr := r.commandFailed(sess, instance, err, currentCommit, permalink)
+		attempt.applyTo(instance.Status.LastUpdate)
+		recordUpdate(instance, startedUpdate.StartTime)
+		return res, rerr
+	}
+
+	// Keep the workspace, so that a subsequent change to only the configuration can reuse it.
+	if err := sess.SaveWorkspaceCache(currentCommit); err != nil {
+		reqLogger.Info("Unable to cache workspace", "Error", err.Error())
+	}
+
 	// At this point, the stack has been processed successfully. Mark it as ready, and rely on the
 	// post-return hook `saveStatus` to account for any last minute exceptions.
 	instance.Status.MarkReadyCondition()
@@ -912,13 +1723,23 @@ func (r *ReconcileStack) Reconcile(ctx context.Context, request reconcile.Reques
 	}
 
 	instance.Status.Outputs = outs
+	r.outputs.publish(instance, outs)
 	instance.Status.LastUpdate = &shared.StackUpdateState{
-		State:                shared.SucceededStackStateMessage,
-		LastAttemptedCommit:  currentCommit,
-		LastSuccessfulCommit: currentCommit,
-		Permalink:            permalink,
-		LastResyncTime:       metav1.Now(),
-	}
+		State:                    shared.SucceededStackStateMessage,
+		LastAttemptedCommit:      currentCommit,
+		LastSuccessfulCommit:     currentCommit,
+		LastSuccessfulGeneration: instance.GetGeneration(),
+		ReconcileRequest:         startedUpdate.ReconcileRequest,
+		ConfigFromRevision:       startedUpdate.ConfigFromRevision,
+		ReferencesRevision:       startedUpdate.ReferencesRevision,
+		PatchChecksum:            startedUpdate.PatchChecksum,
+		Permalink:                permalink,
+		LastResyncTime:           metav1.Now(),
+	}
+	attempt.applyTo(instance.Status.LastUpdate)
+	recordUpdate(instance, startedUpdate.StartTime)
+	instance.Status.ClearDriftedCondition()
+	sess.outcomeRecorded = true
 
 	r.emitEvent(instance, pulumiv1.StackUpdateSuccessfulEvent(), "Successfully updated stack.")
 	if requeueForSourcePoll || sess.stack.ContinueResyncOnCommitMatch {
@@ -930,7 +1751,12 @@ func (r *ReconcileStack) Reconcile(ctx context.Context, request reconcile.Reques
 	return reconcile.Result{}, nil
 }
 
+// emitEvent emits an event on the stack, unless it is collapsed into an aggregated event; see
+// event_aggregation.go.
 func (r *ReconcileStack) emitEvent(instance *pulumiv1.Stack, event pulumiv1.StackEvent, messageFmt string, args ...interface{}) {
+	if r.events != nil && r.events.collapse(instance, event, messageFmt, fmt.Sprintf(messageFmt, args...)) {
+		return
+	}
 	r.recorder.Eventf(instance, event.EventType(), event.Reason(), messageFmt, args...)
 }
 
@@ -944,8 +1770,12 @@ func (r *ReconcileStack) markStackFailed(sess *reconcileStackSession, instance *
 	}
 	instance.Status.LastUpdate.LastAttemptedCommit = currentCommit
 	instance.Status.LastUpdate.State = shared.FailedStackStateMessage
+	sess.outcomeRecorded = true
+	sess.failure, sess.failurePhase = err, sess.timer.lastEntered()
+	instance.Status.LastUpdate.Reason = ""
 	instance.Status.LastUpdate.Permalink = permalink
 	instance.Status.LastUpdate.LastResyncTime = metav1.Now()
+	instance.Status.LastUpdate.StartTime = nil
 }
 
 func (sess *reconcileStackSession) finalize(ctx context.Context, stack *pulumiv1.Stack) error {
@@ -953,7 +1783,7 @@ func (sess *reconcileStackSession) finalize(ctx context.Context, stack *pulumiv1
 	// Run finalization logic for pulumiFinalizer. If the
 	// finalization logic fails, don't remove the finalizer so
 	// that we can retry during the next reconciliation.
-	if err := sess.finalizeStack(ctx); err != nil {
+	if err := sess.finalizeStack(ctx, stack); err != nil {
 		sess.logger.Error(err, "Failed to run Pulumi finalizer", "Stack.Name", stack.Spec.Stack)
 		return err
 	}
@@ -982,10 +1812,53 @@ func (sess *reconcileStackSession) removeFinalizerAndUpdate(ctx context.Context,
 	})
 }
 
-func (sess *reconcileStackSession) finalizeStack(ctx context.Context) error {
+func (sess *reconcileStackSession) finalizeStack(ctx context.Context, instance *pulumiv1.Stack) error {
 	// Destroy the stack resources and stack.
 	if sess.stack.DestroyOnFinalize {
+		// Any credentials given for destroying the stack are used for everything from here on.
+		if err := sess.setDestroyCredentials(ctx); err != nil {
+			return err
+		}
+		// Refreshing first means resources deleted out of band don't trip up the destroy. It's
+		// not essential though, so a failed refresh is reported but doesn't stop the destroy.
+		var refreshErr error
+		if sess.stack.RefreshBeforeDestroy && !sess.namespaceTerminating {
+			if _, refreshErr = sess.RefreshStack(ctx, false, nil); refreshErr != nil {
+				sess.logger.Error(refreshErr, "Failed to refresh stack before destroying it; destroying anyway",
+					"Stack.Name", sess.stack.Stack)
+			} else {
+				sess.logger.Info("Refreshed stack before destroying it", "Stack.Name", sess.stack.Stack)
+			}
+		}
+		// A stack left with an update in progress, or pending operations, by an interrupted update
+		// can't be destroyed until it's recovered; this is only done if asked for, since clearing
+		// pending operations can leave resources untracked.
+		if sess.stack.ForceDestroy {
+			if err := sess.recoverForDestroy(ctx, instance); err != nil {
+				return err
+			}
+		}
+		// Protected resources would stop the destroy; this is only reached if destroying them is
+		// allowed.
+		if sess.stack.ProtectResources {
+			if err := sess.setProtected(ctx, false); err != nil {
+				return err
+			}
+		}
+		// A very large stack can be destroyed in batches; the full destroy after that gets anything
+		// left, and removes the stack.
+		if opts := sess.stack.DestroyOptions; opts != nil && opts.BatchSize > 0 {
+			if err := sess.destroyInBatches(ctx, instance, int(opts.BatchSize)); err != nil {
+				if refreshErr != nil {
+					return fmt.Errorf("%w (the refresh before destroying also failed: %v)", err, refreshErr)
+				}
+				return err
+			}
+		}
 		if err := sess.DestroyStack(ctx); err != nil {
+			if refreshErr != nil {
+				return fmt.Errorf("%w (the refresh before destroying also failed: %v)", err, refreshErr)
+			}
 			return err
 		}
 	}
@@ -1017,10 +1890,87 @@ type reconcileStackSession struct {
 	logger     logging.Logger
 	kubeClient client.Client
 	stack      shared.StackSpec
-	autoStack  *auto.Stack
+	autoStack  pulumiStack
 	namespace  string
 	workdir    string
 	rootDir    string
+	// pulumi makes the workspace and stack; see pulumi_layer.go.
+	pulumi pulumiLayer
+	// reusedWorkspace is set when the workspace was restored from the cache, or kept from the last
+	// run with its dependencies still installed, so dependencies needn't be installed again.
+	reusedWorkspace bool
+	// vault caches the tokens and secrets fetched from Vault for Vault ResourceRefs.
+	vault *vaultCache
+	// timer accounts the time spent in each phase of processing the stack; it may be nil.
+	timer *phaseTimer
+	// gitMirrors is the cache of git repositories to clone from; it's nil if there isn't one.
+	gitMirrors *gitMirrorCache
+	// gitWorkdir is the record of the workspace checked out from a git source; see git_workdir.go.
+	gitWorkdir *gitWorkdirRecord
+	// gitHubApp is set when the git source is accessed as a GitHub App installation.
+	gitHubApp *gitHubApp
+	// codeCommit is set when the git source is accessed with AWS credentials.
+	codeCommit *codeCommitAuth
+	// localProjectRoot is the directory within which a projectPath must be; if empty, projectPath
+	// can't be used.
+	localProjectRoot string
+	// configFrom is the configuration read from the ConfigMaps given in configFrom, and
+	// configFromRevision identifies the versions of those ConfigMaps; see readConfigFrom.
+	configFrom         map[string]string
+	configFromRevision string
+	// referencesRevision identifies the versions of the other Secrets and ConfigMaps the stack
+	// refers to; see readReferencesRevision.
+	referencesRevision string
+	// secretsFrom is the secret configuration read from the Secrets given in secretsFrom.
+	secretsFrom map[string]string
+	// dotEnvPath is the .env file written for dotEnvRefs, if any; see dot_env.go.
+	dotEnvPath string
+	// sameNamespaceSecretsOnly restricts the Secrets the stack can refer to to its own namespace;
+	// see secret_namespace.go.
+	sameNamespaceSecretsOnly bool
+	// checkedInConfig has the keys in the stack's settings file as found in the workspace, before
+	// the configuration in the spec is applied; see config_prune.go.
+	checkedInConfig map[string]bool
+	// recordedConfigKeys are the configuration keys the operator introduced before, from the
+	// status, and configKeys those it's introduced this time, to be recorded in the status once
+	// configKeysSynced is set; see config_prune.go.
+	recordedConfigKeys []string
+	configKeys         []string
+	configKeysSynced   bool
+	// outputs has the outputs of other stacks updated by this process; if nil, stack outputs are
+	// read from the status of the stacks alone.
+	outputs *outputExchange
+	// imported has the resources imported into the stack by ImportResources.
+	imported []pulumiv1.ImportedResource
+	// objectMeta is the metadata of the Stack object, for resolving FieldRef selectors.
+	objectMeta metav1.ObjectMeta
+	// namespaceTerminating is set when the stack is being deleted along with its namespace; see
+	// namespace_termination.go.
+	namespaceTerminating bool
+	// outcomeRecorded is set when the outcome of processing the stack has been recorded in its
+	// last update, to be sent to the webhooks given in .spec.notifications.
+	outcomeRecorded bool
+	// secretsProviderChange is set when the stack's secrets provider has been changed, or an
+	// attempt made to, to be recorded in the status.
+	secretsProviderChange *pulumiv1.SecretsProviderChange
+	// lastRefresh is set when the stack has been refreshed, to be recorded in the status.
+	lastRefresh *pulumiv1.StackRefreshState
+	// environments are the environments attached by the operator, to be recorded in the status
+	// once environmentsSynced is set; see environments.go.
+	environments       []string
+	environmentsSynced bool
+	// tags are the keys of the tags set by the operator, to be recorded in the status once
+	// tagsSynced is set, and tagsError is the error from setting them, if that failed; see
+	// tags.go.
+	tags       []string
+	tagsSynced bool
+	tagsError  string
+	// failure is the error with which processing the stack last failed, and failurePhase the
+	// phase it failed in; secretValues has the values of the secret configuration, to be kept out
+	// of any record of the failure. See dead_letter.go.
+	failure      error
+	failurePhase string
+	secretValues []string
 }
 
 func newReconcileStackSession(
@@ -1034,6 +1984,7 @@ func newReconcileStackSession(
 		kubeClient: kubeClient,
 		stack:      stack,
 		namespace:  namespace,
+		pulumi:     autoLayer{},
 	}
 }
 
@@ -1071,6 +2022,67 @@ func (sess *reconcileStackSession) SetSecretEnvs(ctx context.Context, secrets []
 	return nil
 }
 
+// SetEnvFromForWorkspace populates environment variables for workspace using the entries of
+// the Secrets and ConfigMaps given in the EnvFrom field in the stack specification.
+func (sess *reconcileStackSession) SetEnvFromForWorkspace(ctx context.Context, w auto.Workspace) error {
+	envvars, err := sess.resolveEnvFrom(ctx)
+	if err != nil {
+		return err
+	}
+	if len(envvars) == 0 {
+		return nil
+	}
+	return w.SetEnvVars(envvars)
+}
+
+// resolveEnvFrom reads the environment variables given by the EnvFrom field in the stack
+// specification. Later sources take precedence over earlier ones.
+func (sess *reconcileStackSession) resolveEnvFrom(ctx context.Context) (map[string]string, error) {
+	envvars := map[string]string{}
+	for i, source := range sess.stack.EnvFrom {
+		var (
+			ref  *shared.EnvFromObjectReference
+			obj  client.Object
+			data func() map[string]string
+		)
+		switch {
+		case source.SecretRef != nil && source.ConfigMapRef == nil:
+			secret := &corev1.Secret{}
+			ref, obj = source.SecretRef, secret
+			data = func() map[string]string {
+				values := map[string]string{}
+				for k, v := range secret.Data {
+					values[k] = string(v)
+				}
+				return values
+			}
+		case source.ConfigMapRef != nil && source.SecretRef == nil:
+			configMap := &corev1.ConfigMap{}
+			ref, obj = source.ConfigMapRef, configMap
+			data = func() map[string]string { return configMap.Data }
+		default:
+			return nil, fmt.Errorf("envFrom[%d] must give exactly one of secretRef and configMapRef", i)
+		}
+
+		if err := sess.kubeClient.Get(ctx, types.NamespacedName{Name: ref.Name, Namespace: sess.namespace}, obj); err != nil {
+			if k8serrors.IsNotFound(err) && ref.Optional {
+				continue
+			}
+			return nil, fmt.Errorf("resolving envFrom[%d]: Namespace=%s Name=%s: %w", i, sess.namespace, ref.Name, err)
+		}
+		for k, v := range data() {
+			name := source.Prefix + k
+			if errs := validation.IsEnvVarName(name); len(errs) > 0 {
+				sess.logger.Info("Skipping envFrom entry which is not a valid environment variable name",
+					"Stack.Name", sess.stack.Stack, "Name", name)
+				continue
+			}
+			envvars[name] = v
+		}
+	}
+	return envvars, nil
+}
+
 // SetEnvRefsForWorkspace populates environment variables for workspace using items in
 // the EnvRefs field in the stack specification.
 func (sess *reconcileStackSession) SetEnvRefsForWorkspace(ctx context.Context, w auto.Workspace) error {
@@ -1121,6 +2133,10 @@ func (sess *reconcileStackSession) resolveResourceRef(ctx context.Context, ref *
 			if !IsNamespaceIsolationWaived() && namespace != sess.namespace {
 				return "", errNamespaceIsolation
 			}
+			// Secrets may be restricted to the stack's namespace regardless
+			if sess.sameNamespaceSecretsOnly && namespace != sess.namespace {
+				return "", fmt.Errorf("Secret %s/%s: %w", namespace, ref.SecretRef.Name, errCrossNamespaceSecret)
+			}
 
 			if err := sess.kubeClient.Get(ctx, types.NamespacedName{Name: ref.SecretRef.Name, Namespace: namespace}, &config); err != nil {
 				return "", fmt.Errorf("Namespace=%s Name=%s: %w", ref.SecretRef.Namespace, ref.SecretRef.Name, err)
@@ -1132,6 +2148,45 @@ func (sess *reconcileStackSession) resolveResourceRef(ctx context.Context, ref *
 			return string(secretVal), nil
 		}
 		return "", errors.New("Missing secret reference in ResourceRef")
+	case shared.ResourceSelectorConfigMap:
+		if ref.ConfigMapRef != nil {
+			var configMap corev1.ConfigMap
+			namespace := ref.ConfigMapRef.Namespace
+			if namespace == "" {
+				namespace = sess.namespace
+			}
+			// enforce namespace isolation unless it's explicitly been waived
+			if !IsNamespaceIsolationWaived() && namespace != sess.namespace {
+				return "", errNamespaceIsolation
+			}
+
+			if err := sess.kubeClient.Get(ctx, types.NamespacedName{Name: ref.ConfigMapRef.Name, Namespace: namespace}, &configMap); err != nil {
+				return "", fmt.Errorf("Namespace=%s Name=%s: %w", namespace, ref.ConfigMapRef.Name, err)
+			}
+			if v, ok := configMap.Data[ref.ConfigMapRef.Key]; ok {
+				return v, nil
+			}
+			if v, ok := configMap.BinaryData[ref.ConfigMapRef.Key]; ok {
+				return string(v), nil
+			}
+			return "", fmt.Errorf("no key %q found in ConfigMap %s/%s", ref.ConfigMapRef.Key, namespace, ref.ConfigMapRef.Name)
+		}
+		return "", errors.New("missing ConfigMap reference in ResourceRef")
+	case shared.ResourceSelectorVault:
+		if ref.Vault != nil {
+			return sess.resolveVaultRef(ctx, ref.Vault)
+		}
+		return "", errors.New("Missing vault reference in ResourceRef")
+	case shared.ResourceSelectorStackOutput:
+		if ref.StackOutput != nil {
+			return sess.resolveStackOutputRef(ctx, ref.StackOutput)
+		}
+		return "", errors.New("Missing stack output reference in ResourceRef")
+	case shared.ResourceSelectorFieldRef:
+		if ref.FieldRef != nil {
+			return fieldRefValue(&sess.objectMeta, ref.FieldRef.FieldPath)
+		}
+		return "", errors.New("Missing field reference in ResourceRef")
 	default:
 		return "", fmt.Errorf("Unsupported selector type: %v", ref.SelectorType)
 	}
@@ -1282,16 +2337,16 @@ func (sess *reconcileStackSession) MakeWorkspaceDir() (string, error) {
 	return workspaceDir, nil
 }
 
-// CleanupWorkspace cleans the Pulumi workspace directory, located within the root directory.
+// CleanupWorkspace cleans the Pulumi workspace directory, located within the root directory. A
+// workspace checked out from a git source is kept for the next run; see git_workdir.go.
 func (sess *reconcileStackSession) CleanupWorkspaceDir() {
 	if sess.rootDir == "" {
 		return
 	}
 	workspaceDir := sess.getWorkspaceDir()
 	sess.logger.Debug("Cleaning up pulumi workspace for stack", "stack", sess.stack, "workspace", workspaceDir)
-	if err := os.RemoveAll(workspaceDir); err != nil {
-		sess.logger.Error(err, "Failed to delete workspace dir: %s", workspaceDir)
-	}
+	sess.removeDotEnv()
+	sess.retainWorkdir(workspaceDir)
 }
 
 // getWorkspaceDir returns the workspace directory (containing the Pulumi project).
@@ -1299,28 +2354,17 @@ func (sess *reconcileStackSession) getWorkspaceDir() string {
 	return filepath.Join(sess.rootDir, "workspace")
 }
 
-func (sess *reconcileStackSession) SetupWorkdirFromGitSource(ctx context.Context, gitAuth *auto.GitAuth, source *shared.GitSource) (string, error) {
-	repo := auto.GitRepo{
-		URL:         source.ProjectRepo,
-		ProjectPath: source.RepoDir,
-		CommitHash:  source.Commit,
-		Branch:      source.Branch,
-		Auth:        gitAuth,
-	}
-	homeDir := sess.getPulumiHome()
+func (sess *reconcileStackSession) SetupWorkdirFromGitSource(ctx context.Context, gitAuth *auto.GitAuth, hostKeys hostKeyPolicy, source *shared.GitSource) (string, error) {
 	workspaceDir := sess.getWorkspaceDir()
 
 	sess.logger.Debug("Setting up pulumi workspace for stack", "stack", sess.stack, "workspace", workspaceDir)
-	// Create a new workspace.
-
-	secretsProvider := auto.SecretsProvider(sess.stack.SecretsProvider)
+	projectDir, err := sess.cloneGitSourceWithRetries(ctx, gitAuth, hostKeys, source)
+	if err != nil {
+		return "", err
+	}
 
-	w, err := auto.NewLocalWorkspace(
-		ctx,
-		auto.PulumiHome(homeDir),
-		auto.WorkDir(workspaceDir),
-		auto.Repo(repo),
-		secretsProvider)
+	// Create a new workspace.
+	w, err := sess.newWorkspace(ctx, projectDir)
 	if err != nil {
 		return "", fmt.Errorf("failed to create local workspace: %w", err)
 	}
@@ -1341,13 +2385,9 @@ type ProjectFile struct {
 }
 
 func (sess *reconcileStackSession) SetupWorkdirFromYAML(ctx context.Context, programRef shared.ProgramReference) (string, error) {
-	homeDir := sess.getPulumiHome()
 	workspaceDir := sess.getWorkspaceDir()
 	sess.logger.Debug("Setting up pulumi workspace for stack", "stack", sess.stack, "workspace", workspaceDir)
 
-	// Create a new workspace.
-	secretsProvider := auto.SecretsProvider(sess.stack.SecretsProvider)
-
 	program := pulumiv1.Program{}
 	programKey := client.ObjectKey{
 		Name:      programRef.Name,
@@ -1375,11 +2415,7 @@ func (sess *reconcileStackSession) SetupWorkdirFromYAML(ctx context.Context, pro
 	}
 
 	var w auto.Workspace
-	w, err = auto.NewLocalWorkspace(
-		ctx,
-		auto.PulumiHome(homeDir),
-		auto.WorkDir(workspaceDir),
-		secretsProvider)
+	w, err = sess.newWorkspace(ctx, workspaceDir)
 	if err != nil {
 		return "", fmt.Errorf("failed to create local workspace: %w", err)
 	}
@@ -1392,33 +2428,65 @@ func (sess *reconcileStackSession) SetupWorkdirFromYAML(ctx context.Context, pro
 // setupWorkspace sets all the extra configuration specified by the Stack object, after you have
 // constructed a workspace from a source.
 func (sess *reconcileStackSession) setupWorkspace(ctx context.Context, w auto.Workspace) error {
+	defer sess.timer.enter(phaseConfig)()
 	sess.workdir = w.WorkDir()
 
+	// Patches are applied before anything looks at the project, since they may change it.
+	if len(sess.stack.Patches) > 0 {
+		if err := sess.applyPatches(w.WorkDir()); err != nil {
+			return err
+		}
+	}
+
+	// Check the project is there before going any further, since the errors from Pulumi when it's
+	// not are unhelpful. The runtime's tools aren't needed if the program isn't going to be run
+	// for real, as when simulating.
+	if err := checkProjectDir(w.WorkDir()); err != nil {
+		var mismatch *runtimeMismatchError
+		if sess.pulumi.InstallsDependencies() || !errors.As(err, &mismatch) {
+			return err
+		}
+	}
+
 	if sess.stack.Backend != "" {
-		w.SetEnvVar("PULUMI_BACKEND_URL", sess.stack.Backend)
+		backendURL, err := sess.backendURL(ctx)
+		if err != nil {
+			return err
+		}
+		w.SetEnvVar("PULUMI_BACKEND_URL", backendURL)
 	}
 	if accessToken, found := sess.lookupPulumiAccessToken(ctx); found {
 		w.SetEnvVar("PULUMI_ACCESS_TOKEN", accessToken)
 	}
 
 	var err error
+	// EnvRefs are set after EnvFrom, so that they take precedence.
+	if err = sess.SetEnvFromForWorkspace(ctx, w); err != nil {
+		return err
+	}
 	if err = sess.SetEnvRefsForWorkspace(ctx, w); err != nil {
 		return err
 	}
+	if err = sess.writeDotEnv(ctx, w.WorkDir()); err != nil {
+		return err
+	}
+	if err = sess.setPassphraseForWorkspace(ctx, w); err != nil {
+		return err
+	}
 
-	var a auto.Stack
+	var a pulumiStack
 
 	if sess.stack.UseLocalStackOnly {
 		sess.logger.Info("Using local stack", "stack", sess.stack.Stack)
-		a, err = auto.SelectStack(ctx, sess.stack.Stack, w)
+		a, err = sess.pulumi.SelectStack(ctx, sess.stack.Stack, w)
 	} else {
 		sess.logger.Info("Upserting stack", "stack", sess.stack.Stack, "workspace", w)
-		a, err = auto.UpsertStack(ctx, sess.stack.Stack, w)
+		a, err = sess.pulumi.UpsertStack(ctx, sess.stack.Stack, w)
 	}
 	if err != nil {
 		return fmt.Errorf("failed to create and/or select stack %s: %w", sess.stack.Stack, err)
 	}
-	sess.autoStack = &a
+	sess.autoStack = a
 	sess.logger.Debug("Setting autostack", "autostack", sess.autoStack)
 
 	var c auto.ConfigMap
@@ -1428,6 +2496,12 @@ func (sess *reconcileStackSession) setupWorkspace(ctx context.Context, w auto.Wo
 	}
 	sess.logger.Debug("Initial autostack config", "config", c)
 
+	// A change to the secrets provider is made before the stack settings are written, so that the
+	// configuration can still be decrypted with the old provider; see secrets_provider.go.
+	if err = sess.changeSecretsProvider(ctx, w); err != nil {
+		return err
+	}
+
 	// Ensure stack settings file in workspace is populated appropriately.
 	if err = sess.ensureStackSettings(ctx, w); err != nil {
 		return err
@@ -1440,10 +2514,18 @@ func (sess *reconcileStackSession) setupWorkspace(ctx context.Context, w auto.Wo
 		return fmt.Errorf("failed to set stack config: %w", err)
 	}
 
-	// Install project dependencies
+	// Install project dependencies, unless the workspace is being reused and already has them.
+	if sess.reusedWorkspace {
+		sess.logger.Debug("Skipping installation of project dependencies for reused workspace")
+		return nil
+	}
+	if !sess.pulumi.InstallsDependencies() {
+		return nil
+	}
 	if err = sess.InstallProjectDependencies(ctx, sess.autoStack.Workspace()); err != nil {
 		return fmt.Errorf("installing project dependencies: %w", err)
 	}
+	sess.recordDependenciesInstalled()
 
 	return nil
 }
@@ -1459,8 +2541,18 @@ func (sess *reconcileStackSession) ensureStackSettings(ctx context.Context, w au
 		sess.logger.Info("Missing stack config file. Will assume no stack config checked-in.", "Error", err.Error())
 		stackConfig = &workspace.ProjectStack{}
 	}
+	// A stack settings file given in stackConfigFrom stands in for (or is merged into) the one
+	// checked in, before anything else is made of it.
+	stackConfig, err = sess.readStackConfigFrom(ctx, stackConfig)
+	if err != nil {
+		return err
+	}
 
 	sess.logger.Debug("stackConfig loaded", "stack", sess.autoStack, "stackConfig", stackConfig)
+	sess.checkedInConfig = make(map[string]bool, len(stackConfig.Config))
+	for k := range stackConfig.Config {
+		sess.checkedInConfig[k.String()] = true
+	}
 
 	// Prefer the secretsProvider in the stack config. To override an existing stack to the default
 	// secret provider, the stack's secretsProvider field needs to be set to 'default'
@@ -1490,6 +2582,7 @@ func revisionAtWorkingDir(workingDir string) (string, error) {
 }
 
 func (sess *reconcileStackSession) InstallProjectDependencies(ctx context.Context, workspace auto.Workspace) error {
+	defer sess.timer.enter(phaseInstall)()
 	project, err := workspace.ProjectSettings(ctx)
 	if err != nil {
 		return fmt.Errorf("unable to get project runtime: %w", err)
@@ -1555,14 +2648,62 @@ func (sess *reconcileStackSession) InstallProjectDependencies(ctx context.Contex
 	}
 }
 
-func (sess *reconcileStackSession) UpdateConfig(ctx context.Context) error {
+// resolveConfig gives the configuration from the spec, to be set on the stack over what's checked
+// in. Where a key is given more than once, the value is taken from the first of these that gives
+// it: SecretRefs, Secrets, SecretsFrom, ConfigValues, Config, ConfigRefs, ConfigFrom. That is,
+// secret configuration takes precedence over plain, and configuration given key by key over that
+// from a whole ConfigMap or Secret.
+func (sess *reconcileStackSession) resolveConfig(ctx context.Context) (auto.ConfigMap, error) {
 	m := make(auto.ConfigMap)
+	// The configuration from configFrom comes first, so that anything given explicitly takes
+	// precedence.
+	for k, v := range sess.configFrom {
+		m[k] = auto.ConfigValue{
+			Value:  v,
+			Secret: false,
+		}
+	}
+	// ConfigRefs are resolved in order of key, so any error is reported consistently. Inline
+	// Config and ConfigValues take precedence, so a key given there isn't resolved.
+	configRefKeys := make([]string, 0, len(sess.stack.ConfigRefs))
+	for k := range sess.stack.ConfigRefs {
+		_, inline := sess.stack.Config[k]
+		_, inlineValue := sess.stack.ConfigValues[k]
+		if !inline && !inlineValue {
+			configRefKeys = append(configRefKeys, k)
+		}
+	}
+	sort.Strings(configRefKeys)
+	for _, k := range configRefKeys {
+		ref := sess.stack.ConfigRefs[k]
+		resolved, err := sess.resolveResourceRef(ctx, &ref)
+		if err != nil {
+			return nil, fmt.Errorf("updating configRef for %q: %w", k, err)
+		}
+		m[k] = auto.ConfigValue{
+			Value:  resolved,
+			Secret: false,
+		}
+	}
 	for k, v := range sess.stack.Config {
 		m[k] = auto.ConfigValue{
 			Value:  v,
 			Secret: false,
 		}
 	}
+	for k, v := range sess.stack.ConfigValues {
+		m[k] = auto.ConfigValue{
+			Value:  v.Value,
+			Secret: v.Secret,
+		}
+	}
+	// The per-key forms of secret configuration take precedence over secretsFrom.
+	for k, v := range sess.secretsFrom {
+		m[k] = auto.ConfigValue{
+			Value:  v,
+			Secret: true,
+		}
+	}
 	for k, v := range sess.stack.Secrets {
 		m[k] = auto.ConfigValue{
 			Value:  v,
@@ -1570,26 +2711,68 @@ func (sess *reconcileStackSession) UpdateConfig(ctx context.Context) error {
 		}
 	}
 
-	for k, ref := range sess.stack.SecretRefs {
+	// SecretRefs are resolved in order of key too.
+	secretRefKeys := make([]string, 0, len(sess.stack.SecretRefs))
+	for k := range sess.stack.SecretRefs {
+		secretRefKeys = append(secretRefKeys, k)
+	}
+	sort.Strings(secretRefKeys)
+	for _, k := range secretRefKeys {
+		ref := sess.stack.SecretRefs[k]
 		resolved, err := sess.resolveResourceRef(ctx, &ref)
 		if err != nil {
-			return fmt.Errorf("updating secretRef for %q: %w", k, err)
+			return nil, fmt.Errorf("updating secretRef for %q: %w", k, err)
 		}
 		m[k] = auto.ConfigValue{
 			Value:  resolved,
 			Secret: true,
 		}
 	}
+	return m, nil
+}
+
+func (sess *reconcileStackSession) UpdateConfig(ctx context.Context) error {
+	m, err := sess.resolveConfig(ctx)
+	if err != nil {
+		return err
+	}
+	for _, v := range m {
+		if v.Secret {
+			sess.secretValues = append(sess.secretValues, v.Value)
+		}
+	}
 	if err := sess.autoStack.SetAllConfig(ctx, m); err != nil {
 		return err
 	}
-	sess.logger.Debug("Updated stack config", "Stack.Name", sess.stack.Stack, "config", m)
+	if len(sess.stack.ConfigPath) > 0 {
+		if err := sess.setConfigPaths(ctx); err != nil {
+			return err
+		}
+	}
+	if err := sess.syncConfigKeys(ctx, m); err != nil {
+		return err
+	}
+	sess.logger.Debug("Updated stack config", "Stack.Name", sess.stack.Stack, "config", redactSecretConfig(m))
 	return nil
 }
 
+// redactSecretConfig gives the configuration with the values of secrets hidden, so that it can be
+// logged.
+func redactSecretConfig(m auto.ConfigMap) auto.ConfigMap {
+	redacted := make(auto.ConfigMap, len(m))
+	for k, v := range m {
+		if v.Secret {
+			v.Value = "[secret]"
+		}
+		redacted[k] = v
+	}
+	return redacted
+}
+
 // RefreshStack runs a refresh on the stack and returns the Pulumi Service URL of the refresh
 // operation. It accepts a list of pre-requisite targets which contains a list of URNs to refresh.
 func (sess *reconcileStackSession) RefreshStack(ctx context.Context, expectNoChanges bool, targets []string) (shared.Permalink, error) {
+	defer sess.timer.enter(phaseRefresh)()
 	writer := sess.logger.LogWriterDebug("Pulumi Refresh")
 	defer contract.IgnoreClose(writer)
 	opts := []optrefresh.Option{optrefresh.ProgressStreams(writer), optrefresh.UserAgent(execAgent)}
@@ -1599,8 +2782,12 @@ func (sess *reconcileStackSession) RefreshStack(ctx context.Context, expectNoCha
 	if targets != nil {
 		opts = append(opts, optrefresh.Target(targets))
 	}
+	if sess.stack.Parallel > 0 {
+		opts = append(opts, optrefresh.Parallel(sess.stack.Parallel))
+	}
 
 	result, err := sess.autoStack.Refresh(ctx, opts...)
+	sess.recordRefresh(result, err)
 	if err != nil {
 		return "", fmt.Errorf("refreshing stack %q: %w", sess.stack.Stack, err)
 	}
@@ -1609,7 +2796,7 @@ func (sess *reconcileStackSession) RefreshStack(ctx context.Context, expectNoCha
 		// Successful update but no permalink suggests a backend which doesn't support permalinks. Ignore.
 		sess.logger.Debug("No permalink found - ignoring.", "Stack.Name", sess.stack.Stack, "Namespace", sess.namespace)
 	}
-	permalink := shared.Permalink(p)
+	permalink := credentialFreePermalink(p)
 	return permalink, nil
 }
 
@@ -1617,6 +2804,7 @@ func (sess *reconcileStackSession) RefreshStack(ctx context.Context, expectNoCha
 // and error. In certain cases, an update may be unabled to proceed due to locking,
 // in which case the operator will requeue itself to retry later.
 func (sess *reconcileStackSession) UpdateStack(ctx context.Context, targets []string) (shared.StackUpdateStatus, shared.Permalink, *auto.UpResult, error) {
+	defer sess.timer.enter(phaseUpdate)()
 	writer := sess.logger.LogWriterDebug("Pulumi Update")
 	defer contract.IgnoreClose(writer)
 
@@ -1624,9 +2812,28 @@ func (sess *reconcileStackSession) UpdateStack(ctx context.Context, targets []st
 	if targets != nil {
 		opts = append(opts, optup.Target(targets))
 	}
+	if sess.stack.Parallel > 0 {
+		opts = append(opts, optup.Parallel(sess.stack.Parallel))
+	}
+	if checksum := patchesChecksum(sess.stack.Patches); checksum != "" {
+		opts = append(opts, optup.Message(fmt.Sprintf("[patched] update with %d patch(es) applied to the source (%s)", len(sess.stack.Patches), checksum)))
+	}
+
+	upCtx := ctx
+	if sess.stack.UpdateTimeoutSeconds > 0 {
+		var cancel context.CancelFunc
+		upCtx, cancel = context.WithTimeout(ctx, time.Duration(sess.stack.UpdateTimeoutSeconds)*time.Second)
+		defer cancel()
+	}
 
-	result, err := sess.autoStack.Up(ctx, opts...)
+	result, err := sess.autoStack.Up(upCtx, opts...)
 	if err != nil {
+		// If the update ran out of time (rather than the reconciliation as a whole being cancelled),
+		// report that distinctly, so it's not mistaken for a failure of the program.
+		if errors.Is(upCtx.Err(), context.DeadlineExceeded) && ctx.Err() == nil {
+			return shared.StackUpdateTimeout, shared.Permalink(""), nil,
+				fmt.Errorf("update did not complete within %ds: %w", sess.stack.UpdateTimeoutSeconds, err)
+		}
 		// If this is the "conflict" error message, we will want to gracefully quit and retry.
 		if auto.IsConcurrentUpdateError(err) {
 			return shared.StackUpdateConflict, shared.Permalink(""), nil, err
@@ -1635,6 +2842,10 @@ func (sess *reconcileStackSession) UpdateStack(ctx context.Context, targets []st
 		if strings.Contains(result.StdErr, "error: [404] Not found") {
 			return shared.StackNotFound, shared.Permalink(""), nil, err
 		}
+		// If this looks like a provider's rate limit or outage, the update is worth retrying.
+		if isTransientUpdateError(err) {
+			return shared.StackUpdateRetryable, shared.Permalink(""), nil, err
+		}
 		return shared.StackUpdateFailed, shared.Permalink(""), nil, err
 	}
 	p, err := auto.GetPermalink(result.StdOut)
@@ -1642,16 +2853,17 @@ func (sess *reconcileStackSession) UpdateStack(ctx context.Context, targets []st
 		// Successful update but no permalink suggests a backend which doesn't support permalinks. Ignore.
 		sess.logger.Debug("No permalink found - ignoring.", "Stack.Name", sess.stack.Stack, "Namespace", sess.namespace)
 	}
-	permalink := shared.Permalink(p)
+	permalink := credentialFreePermalink(p)
 	return shared.StackUpdateSucceeded, permalink, &result, nil
 }
 
-// GetStackOutputs gets the stack outputs and parses them into a map.
+// GetStackOutputs gets the stack outputs and parses them into a map. The values of secret outputs
+// are replaced with "[secret]", unless the stack says to show them.
 func (sess *reconcileStackSession) GetStackOutputs(outs auto.OutputMap) (shared.StackOutputs, error) {
 	o := make(shared.StackOutputs)
 	for k, v := range outs {
 		var value apiextensionsv1.JSON
-		if v.Secret {
+		if v.Secret && !sess.stack.ShowSecretOutputs {
 			value = apiextensionsv1.JSON{Raw: []byte(`"[secret]"`)}
 		} else {
 			// Marshal the OutputMap value only, to use in unmarshaling to StackOutputs
@@ -1669,16 +2881,34 @@ func (sess *reconcileStackSession) GetStackOutputs(outs auto.OutputMap) (shared.
 	return o, nil
 }
 
+// CancelStack cancels the update in progress for the stack, releasing its lock.
+func (sess *reconcileStackSession) CancelStack(ctx context.Context) error {
+	if err := sess.autoStack.Cancel(ctx); err != nil {
+		return fmt.Errorf("cancelling update for stack %s: %w", sess.stack.Stack, err)
+	}
+	return nil
+}
+
+// cancelAttemptedSince reports whether a cancellation has been attempted since the given update
+// was started, so that only one attempt is made for each interrupted update.
+func cancelAttemptedSince(cancel *pulumiv1.StackCancelState, update *pulumiv1.CurrentStackUpdate) bool {
+	return cancel != nil && !cancel.Time.Before(&update.StartTime)
+}
+
 func (sess *reconcileStackSession) DestroyStack(ctx context.Context) error {
 	writer := sess.logger.LogWriterInfo("Pulumi Destroy")
 	defer contract.IgnoreClose(writer)
 
-	_, err := sess.autoStack.Destroy(ctx, optdestroy.ProgressStreams(writer), optdestroy.UserAgent(execAgent))
+	opts := []optdestroy.Option{optdestroy.ProgressStreams(writer), optdestroy.UserAgent(execAgent)}
+	if sess.stack.Parallel > 0 {
+		opts = append(opts, optdestroy.Parallel(sess.stack.Parallel))
+	}
+	_, err := sess.autoStack.Destroy(ctx, opts...)
 	if err != nil {
 		return fmt.Errorf("destroying resources for stack %q: %w", sess.stack.Stack, err)
 	}
 
-	err = sess.autoStack.Workspace().RemoveStack(ctx, sess.stack.Stack)
+	err = sess.pulumi.RemoveStack(ctx, sess.stack.Stack, sess.autoStack.Workspace())
 	if err != nil {
 		return fmt.Errorf("removing stack %q: %w", sess.stack.Stack, err)
 	}
@@ -1688,17 +2918,31 @@ func (sess *reconcileStackSession) DestroyStack(ctx context.Context) error {
 // SetupGitAuth sets up the authentication option to use for the git source
 // repository of the stack. If neither gitAuth or gitAuthSecret are set,
 // a pointer to a zero value of GitAuth is returned — representing
-// unauthenticated git access.
+// unauthenticated git access. If both are set, gitAuth is used.
 func (sess *reconcileStackSession) SetupGitAuth(ctx context.Context) (*auto.GitAuth, error) {
 	gitAuth := &auto.GitAuth{}
 
 	// check that the URL is valid (and we'll use it later to check we got appropriate auth)
-	u, err := giturls.Parse(sess.stack.ProjectRepo)
+	remote, err := parseGitRemote(sess.stack.ProjectRepo)
 	if err != nil {
 		return gitAuth, err
 	}
 
 	if sess.stack.GitAuth != nil {
+		if sess.stack.GitAuthSecret != "" {
+			sess.logger.Info("Both gitAuth and gitAuthSecret are given; using gitAuth",
+				"Stack.GitAuthSecret", sess.stack.GitAuthSecret)
+		}
+
+		if sess.stack.GitAuth.CodeCommit != nil {
+			// requests are signed with the AWS credentials when they're made, at clone time
+			codeCommit, err := sess.resolveCodeCommitAuth(ctx, sess.stack.GitAuth.CodeCommit)
+			if err != nil {
+				return nil, err
+			}
+			sess.codeCommit = codeCommit
+			return gitAuth, nil
+		}
 
 		if sess.stack.GitAuth.SSHAuth != nil {
 			privateKey, err := sess.resolveResourceRef(ctx, &sess.stack.GitAuth.SSHAuth.SSHPrivateKey)
@@ -1729,7 +2973,7 @@ func (sess *reconcileStackSession) SetupGitAuth(ctx context.Context) (*auto.GitA
 
 		if sess.stack.GitAuth.BasicAuth == nil {
 			return nil, errors.New("gitAuth config must specify exactly one of " +
-				"'personalAccessToken', 'sshPrivateKey' or 'basicAuth'")
+				"'personalAccessToken', 'sshPrivateKey', 'basicAuth' or 'codeCommit'")
 		}
 
 		userName, err := sess.resolveResourceRef(ctx, &sess.stack.GitAuth.BasicAuth.UserName)
@@ -1755,8 +2999,22 @@ func (sess *reconcileStackSession) SetupGitAuth(ctx context.Context) (*auto.GitA
 			return nil, err
 		}
 
-		// First check if an SSH private key has been specified.
-		if sshPrivateKey, exists := secret.Data["sshPrivateKey"]; exists {
+		app, err := gitHubAppFromSecret(secret.Data)
+		if err != nil {
+			return nil, err
+		}
+
+		// First check if a GitHub App has been specified, which rules out everything else.
+		if app != nil {
+			if remote.IsSSH() {
+				return nil, fmt.Errorf("gitAuthSecret %q gives a GitHub App, which can't be used with SSH remote %q",
+					sess.stack.GitAuthSecret, sess.stack.ProjectRepo)
+			}
+			// the installation token is minted when it's needed, at clone time
+			gitAuth = &auto.GitAuth{Username: "x-access-token"}
+			sess.gitHubApp = app
+			// Then check if an SSH private key has been specified.
+		} else if sshPrivateKey, exists := secret.Data["sshPrivateKey"]; exists {
 			gitAuth = &auto.GitAuth{
 				SSHPrivateKey: string(sshPrivateKey),
 			}
@@ -1780,9 +3038,14 @@ func (sess *reconcileStackSession) SetupGitAuth(ctx context.Context) (*auto.GitA
 				return nil, errors.New("creating gitAuth: missing 'password' secret entry")
 			}
 		}
+
+		if remote.IsSSH() && gitAuth.SSHPrivateKey == "" {
+			return nil, fmt.Errorf("gitAuthSecret %q has no 'sshPrivateKey' entry, which is required for SSH remote %q",
+				sess.stack.GitAuthSecret, sess.stack.ProjectRepo)
+		}
 	}
 
-	if u.Scheme == "ssh" && gitAuth.SSHPrivateKey == "" {
+	if remote.IsSSH() && gitAuth.SSHPrivateKey == "" {
 		return gitAuth, fmt.Errorf("a private key must be provided for SSH")
 	}
 
@@ -1801,7 +3064,7 @@ func (sess *reconcileStackSession) addDefaultPermalink(ctx context.Context, stac
 	if stack.Status.LastUpdate == nil {
 		stack.Status.LastUpdate = &shared.StackUpdateState{}
 	}
-	stack.Status.LastUpdate.Permalink = shared.Permalink(info.URL)
+	stack.Status.LastUpdate.Permalink = credentialFreePermalink(info.URL)
 	err = sess.patchStatus(ctx, stack)
 	if err != nil {
 		return err
@@ -1813,6 +3076,7 @@ func (sess *reconcileStackSession) addDefaultPermalink(ctx context.Context, stac
 // patchStatus updates the recorded status of a stack using a patch. The patch is calculated with
 // respect to a freshly fetched object, to better avoid conflicts.
 func (sess *reconcileStackSession) patchStatus(ctx context.Context, o *pulumiv1.Stack) error {
+	defer sess.timer.enter(phaseStatus)()
 	var s pulumiv1.Stack
 	if err := sess.kubeClient.Get(ctx, types.NamespacedName{
 		Namespace: o.GetNamespace(),
@@ -1832,22 +3096,21 @@ func (sess *reconcileStackSession) patchStatus(ctx context.Context, o *pulumiv1.
 func (sess *reconcileStackSession) addSSHKeysToKnownHosts(projectRepoURL string) error {
 	// Parse the Stack project repo SSH host and port (if exists) from the git SSH URL
 	// e.g. git@github.com:foo/bar.git returns "github.com" for host
-	// e.g. git@example.com:1234:foo/bar.git returns "example.com" for host and "1234" for port
-	u, err := giturls.Parse(projectRepoURL)
+	// e.g. ssh://git@example.com:2222/foo/bar.git returns "example.com" for host and "2222" for port
+	remote, err := parseGitRemote(projectRepoURL)
 	if err != nil {
 		return fmt.Errorf("error parsing project repo URL to use with ssh-keyscan: %w", err)
 	}
-	hostPort := strings.Split(u.Host, ":")
-	if len(hostPort) == 0 || len(hostPort) > 2 {
-		return fmt.Errorf("error parsing project repo URL to use with ssh-keyscan: %w", err)
+	if remote.Host == "" {
+		return fmt.Errorf("error parsing project repo URL to use with ssh-keyscan: no host in %q", projectRepoURL)
 	}
 
 	// SSH key scan the repo's URL (host port) to get the public keys.
 	args := []string{}
-	if len(hostPort) == 2 {
-		args = append(args, "-p", hostPort[1])
+	if remote.Port != "" {
+		args = append(args, "-p", remote.Port)
 	}
-	args = append(args, "-H", hostPort[0])
+	args = append(args, "-H", remote.Host)
 	sshKeyScan, _ := exec.LookPath("ssh-keyscan")
 	cmd := exec.Command(sshKeyScan, args...)
 	cmd.Dir = os.Getenv("HOME")
@@ -0,0 +1,115 @@
+// Copyright 2024, Pulumi Corporation.  All rights reserved.
+
+package stack
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+const (
+	// EnvDefaultStackBranch is the name of the environment entry giving the branch to set in a
+	// Stack with a git repository but no branch, tag or commit.
+	EnvDefaultStackBranch = "DEFAULT_STACK_BRANCH"
+	// EnvDefaultStackOrganization is the name of the environment entry giving the organization to
+	// prefix to a Stack's stack name when it doesn't give one (i.e., it contains no "/").
+	EnvDefaultStackOrganization = "DEFAULT_STACK_ORGANIZATION"
+	// EnvDefaultStackBackend is the name of the environment entry giving the backend to set in a
+	// Stack which doesn't give one.
+	EnvDefaultStackBackend = "DEFAULT_STACK_BACKEND"
+
+	// mutateStackPath is the path at which the defaulting webhook for Stacks is served.
+	mutateStackPath = "/mutate-pulumi-com-stack"
+)
+
+// stackDefaults are the values filled in by the defaulting webhook for the fields a Stack leaves
+// out. The defaults are written into the object as it's stored, so that what will be run can be
+// seen in the object; a value given in the spec is never replaced.
+type stackDefaults struct {
+	branch       string
+	organization string
+	backend      string
+}
+
+// getStackDefaults gives the defaults for Stacks according to the environment; it's nil if none
+// are given.
+func getStackDefaults() (*stackDefaults, error) {
+	d := &stackDefaults{
+		branch:       os.Getenv(EnvDefaultStackBranch),
+		organization: os.Getenv(EnvDefaultStackOrganization),
+		backend:      os.Getenv(EnvDefaultStackBackend),
+	}
+	if strings.Contains(d.organization, "/") {
+		return nil, fmt.Errorf("%s must be an organization name, without a \"/\", but got %q",
+			EnvDefaultStackOrganization, d.organization)
+	}
+	if *d == (stackDefaults{}) {
+		return nil, nil
+	}
+	return d, nil
+}
+
+// addStackDefaulter registers the defaulting webhook for Stacks with the manager's webhook server.
+func addStackDefaulter(mgr manager.Manager, defaults *stackDefaults) {
+	mgr.GetWebhookServer().Register(mutateStackPath, &webhook.Admission{Handler: &stackDefaulter{defaults: defaults}})
+}
+
+// apply fills in the defaults for the fields not given in the spec, which is the spec of a Stack
+// as JSON. It's done with the spec as JSON, rather than decoded, so that nothing else about the
+// object is changed. It returns the fields defaulted.
+func (d *stackDefaults) apply(spec map[string]interface{}) []string {
+	var defaulted []string
+	given := func(field string) bool {
+		s, _ := spec[field].(string)
+		return s != ""
+	}
+	if d.branch != "" && given("projectRepo") && !given("branch") && !given("tag") && !given("commit") {
+		spec["branch"] = d.branch
+		defaulted = append(defaulted, "branch")
+	}
+	if name, _ := spec["stack"].(string); d.organization != "" && name != "" && !strings.Contains(name, "/") {
+		spec["stack"] = d.organization + "/" + name
+		defaulted = append(defaulted, "stack")
+	}
+	if d.backend != "" && !given("backend") {
+		spec["backend"] = d.backend
+		defaulted = append(defaulted, "backend")
+	}
+	return defaulted
+}
+
+// stackDefaulter is a mutating admission webhook which fills in defaults for Stacks.
+type stackDefaulter struct {
+	defaults *stackDefaults
+}
+
+func (m *stackDefaulter) Handle(_ context.Context, req admission.Request) admission.Response {
+	if len(req.Object.Raw) == 0 {
+		return admission.Allowed("")
+	}
+	var obj map[string]interface{}
+	if err := json.Unmarshal(req.Object.Raw, &obj); err != nil {
+		return admission.Errored(http.StatusBadRequest, err)
+	}
+	spec, ok := obj["spec"].(map[string]interface{})
+	if !ok {
+		return admission.Allowed("")
+	}
+	defaulted := m.defaults.apply(spec)
+	if len(defaulted) == 0 {
+		return admission.Allowed("")
+	}
+	raw, err := json.Marshal(obj)
+	if err != nil {
+		return admission.Errored(http.StatusInternalServerError, err)
+	}
+	return admission.PatchResponseFromRaw(req.Object.Raw, raw)
+}
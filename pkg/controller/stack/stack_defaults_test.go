@@ -0,0 +1,111 @@
+// Copyright 2024, Pulumi Corporation.  All rights reserved.
+
+package stack
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	admissionv1 "k8s.io/api/admission/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+func TestGetStackDefaults(t *testing.T) {
+	t.Setenv(EnvDefaultStackBranch, "")
+	t.Setenv(EnvDefaultStackOrganization, "")
+	t.Setenv(EnvDefaultStackBackend, "")
+	d, err := getStackDefaults()
+	require.NoError(t, err)
+	assert.Nil(t, d, "no defaults, so no webhook")
+
+	t.Setenv(EnvDefaultStackOrganization, "acme")
+	d, err = getStackDefaults()
+	require.NoError(t, err)
+	assert.Equal(t, &stackDefaults{organization: "acme"}, d)
+
+	t.Setenv(EnvDefaultStackOrganization, "acme/infra")
+	_, err = getStackDefaults()
+	assert.Error(t, err)
+}
+
+func TestStackDefaultsApply(t *testing.T) {
+	d := &stackDefaults{branch: "main", organization: "acme", backend: "s3://state"}
+	for _, test := range []struct {
+		name      string
+		spec      map[string]interface{}
+		expected  map[string]interface{}
+		defaulted []string
+	}{
+		{
+			name: "all defaulted",
+			spec: map[string]interface{}{"stack": "dev", "projectRepo": "https://github.com/pulumi/examples"},
+			expected: map[string]interface{}{
+				"stack": "acme/dev", "projectRepo": "https://github.com/pulumi/examples",
+				"branch": "main", "backend": "s3://state",
+			},
+			defaulted: []string{"branch", "stack", "backend"},
+		},
+		{
+			name: "explicit values kept",
+			spec: map[string]interface{}{
+				"stack": "other/dev", "projectRepo": "https://github.com/pulumi/examples",
+				"commit": "abc123", "backend": "file:///state",
+			},
+			expected: map[string]interface{}{
+				"stack": "other/dev", "projectRepo": "https://github.com/pulumi/examples",
+				"commit": "abc123", "backend": "file:///state",
+			},
+		},
+		{
+			name: "no branch without a git source",
+			spec: map[string]interface{}{"stack": "org/project/dev", "fluxSource": map[string]interface{}{}},
+			expected: map[string]interface{}{
+				"stack": "org/project/dev", "fluxSource": map[string]interface{}{}, "backend": "s3://state",
+			},
+			defaulted: []string{"backend"},
+		},
+		{
+			name: "tag counts as a branch",
+			spec: map[string]interface{}{"stack": "acme/dev", "projectRepo": "https://github.com/pulumi/examples", "tag": "v1", "backend": "s3://state"},
+			expected: map[string]interface{}{
+				"stack": "acme/dev", "projectRepo": "https://github.com/pulumi/examples", "tag": "v1", "backend": "s3://state",
+			},
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			defaulted := d.apply(test.spec)
+			assert.Equal(t, test.defaulted, defaulted)
+			assert.Equal(t, test.expected, test.spec)
+		})
+	}
+}
+
+func TestStackDefaulter(t *testing.T) {
+	request := func(raw string) admission.Request {
+		return admission.Request{AdmissionRequest: admissionv1.AdmissionRequest{
+			Operation: admissionv1.Create,
+			Object:    runtime.RawExtension{Raw: []byte(raw)},
+		}}
+	}
+	m := &stackDefaulter{defaults: &stackDefaults{branch: "main", organization: "acme"}}
+
+	resp := m.Handle(context.TODO(), request(`{"apiVersion":"pulumi.com/v1","kind":"Stack",
+		"metadata":{"name":"my-stack"},"spec":{"stack":"dev","projectRepo":"https://github.com/pulumi/examples"}}`))
+	assert.True(t, resp.Allowed)
+	patches := map[string]interface{}{}
+	for _, p := range resp.Patches {
+		patches[p.Operation+" "+p.Path] = p.Value
+	}
+	assert.Equal(t, map[string]interface{}{
+		"add /spec/branch":    "main",
+		"replace /spec/stack": "acme/dev",
+	}, patches)
+
+	resp = m.Handle(context.TODO(), request(`{"apiVersion":"pulumi.com/v1","kind":"Stack",
+		"metadata":{"name":"my-stack"},"spec":{"stack":"org/dev","projectRepo":"https://github.com/pulumi/examples","branch":"dev"}}`))
+	assert.True(t, resp.Allowed)
+	assert.Empty(t, resp.Patches, "nothing to default")
+}
@@ -0,0 +1,305 @@
+// Copyright 2024, Pulumi Corporation.  All rights reserved.
+
+package stack
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/go-logr/logr"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	apimeta "k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+
+	"github.com/pulumi/pulumi-kubernetes-operator/pkg/apis/pulumi/shared"
+	pulumiv1 "github.com/pulumi/pulumi-kubernetes-operator/pkg/apis/pulumi/v1"
+)
+
+const (
+	// EnvStackReports is the name of the environment entry saying which StackReports the operator
+	// maintains: "global" for one report covering all the namespaces watched, or "namespace" for
+	// one report for each namespace with stacks. No reports are maintained if it's not set.
+	EnvStackReports = "STACK_REPORTS"
+	// EnvStackReportInterval is the name of the environment entry giving how often the reports are
+	// made, as a duration, e.g., "1m". The default is five minutes.
+	EnvStackReportInterval = "STACK_REPORT_INTERVAL"
+	// EnvStackReportStaleAfter is the name of the environment entry giving how long a stack can go
+	// without being processed before it's reported as stale, as a duration. The default is 24h.
+	EnvStackReportStaleAfter = "STACK_REPORT_STALE_AFTER"
+
+	stackReportsGlobal    = "global"
+	stackReportsNamespace = "namespace"
+
+	defaultStackReportInterval   = 5 * time.Minute
+	defaultStackReportStaleAfter = 24 * time.Hour
+
+	// maxStackReportNames limits the length of each list of names in a report.
+	maxStackReportNames = 50
+
+	// stackReportManagedByLabel marks the reports made by the operator, so that those no longer
+	// needed can be found and removed.
+	stackReportManagedByLabel = "app.kubernetes.io/managed-by"
+	stackReportManagedBy      = "pulumi-kubernetes-operator"
+)
+
+// addStackReporter runs the stack reporter, if reports are asked for.
+func addStackReporter(mgr manager.Manager) error {
+	mode := os.Getenv(EnvStackReports)
+	switch mode {
+	case "":
+		return nil
+	case stackReportsGlobal, stackReportsNamespace:
+	default:
+		return fmt.Errorf("%s must be one of %q or %q, but got %q",
+			EnvStackReports, stackReportsGlobal, stackReportsNamespace, mode)
+	}
+	interval, err := durationFromEnv(EnvStackReportInterval, defaultStackReportInterval)
+	if err != nil {
+		return err
+	}
+	staleAfter, err := durationFromEnv(EnvStackReportStaleAfter, defaultStackReportStaleAfter)
+	if err != nil {
+		return err
+	}
+	return mgr.Add(&stackReporter{
+		client: mgr.GetClient(),
+		// StackReports are cluster-scoped, so they are read directly rather than from the cache,
+		// which may be restricted to the watched namespaces.
+		reader:     mgr.GetAPIReader(),
+		logger:     mgr.GetLogger().WithName("stack-reporter"),
+		perNS:      mode == stackReportsNamespace,
+		interval:   interval,
+		staleAfter: staleAfter,
+	})
+}
+
+func durationFromEnv(name string, def time.Duration) (time.Duration, error) {
+	raw := os.Getenv(name)
+	if raw == "" {
+		return def, nil
+	}
+	d, err := time.ParseDuration(raw)
+	if err != nil || d <= 0 {
+		return 0, fmt.Errorf("%s must be a positive duration, but got %q", name, raw)
+	}
+	return d, nil
+}
+
+// stackReporter maintains StackReports, remaking them every interval. It runs only in the leader,
+// like the controller.
+type stackReporter struct {
+	client     client.Client
+	reader     client.Reader
+	logger     logr.Logger
+	perNS      bool
+	interval   time.Duration
+	staleAfter time.Duration
+}
+
+func (s *stackReporter) Start(ctx context.Context) error {
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+	for {
+		if err := s.report(ctx); err != nil {
+			s.logger.Error(err, "unable to make stack reports")
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// report makes the reports, and removes any the operator made before which are no longer needed.
+func (s *stackReporter) report(ctx context.Context) error {
+	var stacks pulumiv1.StackList
+	if err := s.client.List(ctx, &stacks); err != nil {
+		return fmt.Errorf("listing stacks: %w", err)
+	}
+	reports := makeStackReports(stacks.Items, s.perNS, s.staleAfter, time.Now())
+
+	for _, report := range reports {
+		if err := s.save(ctx, report); err != nil {
+			return err
+		}
+	}
+
+	var existing pulumiv1.StackReportList
+	if err := s.reader.List(ctx, &existing, client.MatchingLabels{stackReportManagedByLabel: stackReportManagedBy}); err != nil {
+		return fmt.Errorf("listing stack reports: %w", err)
+	}
+	for i := range existing.Items {
+		old := &existing.Items[i]
+		if _, ok := reports[old.Name]; ok {
+			continue
+		}
+		if err := s.client.Delete(ctx, old); client.IgnoreNotFound(err) != nil {
+			return fmt.Errorf("removing stack report %s: %w", old.Name, err)
+		}
+	}
+	return nil
+}
+
+// save creates or updates the report given.
+func (s *stackReporter) save(ctx context.Context, report *pulumiv1.StackReport) error {
+	var current pulumiv1.StackReport
+	err := s.reader.Get(ctx, client.ObjectKey{Name: report.Name}, &current)
+	switch {
+	case apierrors.IsNotFound(err):
+		if err := s.client.Create(ctx, report); err != nil {
+			return fmt.Errorf("creating stack report %s: %w", report.Name, err)
+		}
+		return nil
+	case err != nil:
+		return fmt.Errorf("getting stack report %s: %w", report.Name, err)
+	}
+	current.Labels = report.Labels
+	current.Report = report.Report
+	if err := s.client.Update(ctx, &current); err != nil {
+		return fmt.Errorf("updating stack report %s: %w", report.Name, err)
+	}
+	return nil
+}
+
+// makeStackReports summarises the stacks given, in a single report or in one report for each
+// namespace with stacks. The reports are keyed by name.
+func makeStackReports(stacks []pulumiv1.Stack, perNS bool, staleAfter time.Duration, now time.Time) map[string]*pulumiv1.StackReport {
+	reports := map[string]*pulumiv1.StackReport{}
+	if !perNS {
+		// the global report is kept even when there are no stacks, to show there are none
+		reports[pulumiv1.StackReportGlobalName] = newStackReport(pulumiv1.StackReportGlobalName, "", now)
+	}
+
+	// stacks are taken in order of name, so that the names listed are in order too
+	sorted := make([]*pulumiv1.Stack, len(stacks))
+	for i := range stacks {
+		sorted[i] = &stacks[i]
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		return stackReportName(sorted[i]) < stackReportName(sorted[j])
+	})
+
+	for _, stack := range sorted {
+		name := pulumiv1.StackReportGlobalName
+		if perNS {
+			name = pulumiv1.StackReportNamespacePrefix + stack.Namespace
+		}
+		report, ok := reports[name]
+		if !ok {
+			report = newStackReport(name, stack.Namespace, now)
+			reports[name] = report
+		}
+		addToStackReport(&report.Report, stack, staleAfter, now)
+	}
+	return reports
+}
+
+func newStackReport(name, namespace string, now time.Time) *pulumiv1.StackReport {
+	return &pulumiv1.StackReport{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:   name,
+			Labels: map[string]string{stackReportManagedByLabel: stackReportManagedBy},
+		},
+		Report: pulumiv1.StackReportSummary{
+			Namespace: namespace,
+			Time:      metav1.NewTime(now),
+			States:    map[string]int32{},
+		},
+	}
+}
+
+func stackReportName(stack *pulumiv1.Stack) string {
+	return stack.Namespace + "/" + stack.Name
+}
+
+// addToStackReport counts the stack in the report.
+func addToStackReport(report *pulumiv1.StackReportSummary, stack *pulumiv1.Stack, staleAfter time.Duration, now time.Time) {
+	name := stackReportName(stack)
+	state := stackReportState(stack)
+	report.Total++
+	report.States[state]++
+
+	if isStaleStack(stack, staleAfter, now) {
+		report.StaleStacks = appendStackReportName(report, report.StaleStacks, name)
+	}
+	if v := stack.Status.Verification; v != nil && !v.Passed && v.DeletedResources > 0 {
+		report.DriftedStacks = appendStackReportName(report, report.DriftedStacks, name)
+	}
+
+	if state == pulumiv1.StackReportStateFailed || state == pulumiv1.StackReportStateStalled {
+		since := lastSuccessTime(stack)
+		if oldest := report.OldestFailingStack; oldest == nil || since.Before(&oldest.Since) {
+			report.OldestFailingStack = &pulumiv1.StackReportEntry{
+				Name:    name,
+				Since:   since,
+				Message: failureMessage(stack),
+			}
+		}
+	}
+}
+
+func appendStackReportName(report *pulumiv1.StackReportSummary, names []string, name string) []string {
+	if len(names) >= maxStackReportNames {
+		report.Truncated = true
+		return names
+	}
+	return append(names, name)
+}
+
+// stackReportState gives the state the stack is counted in.
+func stackReportState(stack *pulumiv1.Stack) string {
+	status := &stack.Status
+	switch {
+	case status.Abandoned != nil || apimeta.IsStatusConditionTrue(status.Conditions, pulumiv1.StalledCondition):
+		return pulumiv1.StackReportStateStalled
+	case status.CurrentUpdate != nil:
+		return pulumiv1.StackReportStateInProgress
+	case status.LastUpdate == nil:
+		return pulumiv1.StackReportStatePending
+	case status.LastUpdate.State == shared.SucceededStackStateMessage:
+		return pulumiv1.StackReportStateSucceeded
+	default:
+		return pulumiv1.StackReportStateFailed
+	}
+}
+
+// isStaleStack reports whether the stack has a change to its spec that hasn't been processed, or
+// hasn't been processed for longer than staleAfter.
+func isStaleStack(stack *pulumiv1.Stack, staleAfter time.Duration, now time.Time) bool {
+	if stack.Status.ObservedGeneration != stack.Generation {
+		return true
+	}
+	last := stack.CreationTimestamp
+	if stack.Status.LastUpdate != nil && !stack.Status.LastUpdate.LastResyncTime.IsZero() {
+		last = stack.Status.LastUpdate.LastResyncTime
+	}
+	return now.Sub(last.Time) > staleAfter
+}
+
+// lastSuccessTime gives the time the stack was last updated successfully, according to its
+// history, or the time it was created if there's none.
+func lastSuccessTime(stack *pulumiv1.Stack) metav1.Time {
+	history := stack.Status.History
+	for i := len(history) - 1; i >= 0; i-- {
+		if history[i].State == shared.SucceededStackStateMessage && history[i].StartTime != nil {
+			return *history[i].StartTime
+		}
+	}
+	return stack.CreationTimestamp
+}
+
+// failureMessage gives the message of the condition explaining why the stack isn't ready.
+func failureMessage(stack *pulumiv1.Stack) string {
+	for _, condition := range []string{pulumiv1.StalledCondition, pulumiv1.ReconcilingCondition} {
+		if c := apimeta.FindStatusCondition(stack.Status.Conditions, condition); c != nil && c.Status == metav1.ConditionTrue {
+			return c.Message
+		}
+	}
+	return ""
+}
@@ -0,0 +1,119 @@
+// Copyright 2024, Pulumi Corporation.  All rights reserved.
+
+package stack
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/pulumi/pulumi-kubernetes-operator/pkg/apis/pulumi/shared"
+	pulumiv1 "github.com/pulumi/pulumi-kubernetes-operator/pkg/apis/pulumi/v1"
+)
+
+func TestMakeStackReports(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	created := metav1.NewTime(now.Add(-48 * time.Hour))
+	recent := metav1.NewTime(now.Add(-time.Minute))
+	lastSuccess := metav1.NewTime(now.Add(-30 * time.Hour))
+
+	stack := func(namespace, name string) pulumiv1.Stack {
+		s := pulumiv1.Stack{ObjectMeta: metav1.ObjectMeta{
+			Namespace: namespace, Name: name, Generation: 1, CreationTimestamp: created,
+		}}
+		s.Status.ObservedGeneration = 1
+		return s
+	}
+
+	succeeded := stack("team-a", "web")
+	succeeded.Status.LastUpdate = &shared.StackUpdateState{State: shared.SucceededStackStateMessage, LastResyncTime: recent}
+
+	drifted := stack("team-a", "db")
+	drifted.Status.LastUpdate = &shared.StackUpdateState{State: shared.SucceededStackStateMessage, LastResyncTime: recent}
+	drifted.Status.Verification = &pulumiv1.StackVerificationState{Passed: false, DeletedResources: 2}
+
+	pending := stack("team-a", "queue")
+	pending.Generation = 2 // spec changed but not yet processed
+
+	failed := stack("team-b", "network")
+	failed.Status.LastUpdate = &shared.StackUpdateState{State: shared.FailedStackStateMessage, LastResyncTime: recent}
+	failed.Status.History = []shared.StackUpdateState{
+		{State: shared.SucceededStackStateMessage, StartTime: &lastSuccess},
+		{State: shared.FailedStackStateMessage, StartTime: &recent},
+	}
+	failed.Status.MarkReconcilingCondition(pulumiv1.ReconcilingRetryReason, "update failed")
+
+	stalled := stack("team-b", "cluster")
+	stalled.Status.MarkStalledCondition(pulumiv1.StalledSpecInvalidReason, "spec is invalid")
+
+	inProgress := stack("team-b", "dns")
+	inProgress.Status.LastUpdate = &shared.StackUpdateState{State: shared.SucceededStackStateMessage, LastResyncTime: recent}
+	inProgress.Status.CurrentUpdate = &pulumiv1.CurrentStackUpdate{Generation: 1, StartTime: recent}
+
+	stacks := []pulumiv1.Stack{succeeded, drifted, pending, failed, stalled, inProgress}
+
+	t.Run("global", func(t *testing.T) {
+		reports := makeStackReports(stacks, false, 24*time.Hour, now)
+		require.Len(t, reports, 1)
+		report := reports[pulumiv1.StackReportGlobalName]
+		require.NotNil(t, report)
+		assert.Equal(t, stackReportManagedBy, report.Labels[stackReportManagedByLabel])
+
+		summary := report.Report
+		assert.Equal(t, "", summary.Namespace)
+		assert.Equal(t, int32(6), summary.Total)
+		assert.Equal(t, map[string]int32{
+			pulumiv1.StackReportStateSucceeded:  2,
+			pulumiv1.StackReportStatePending:    1,
+			pulumiv1.StackReportStateFailed:     1,
+			pulumiv1.StackReportStateStalled:    1,
+			pulumiv1.StackReportStateInProgress: 1,
+		}, summary.States)
+		// the stalled stack has never been processed; the pending one has an unprocessed change
+		assert.Equal(t, []string{"team-a/queue", "team-b/cluster"}, summary.StaleStacks)
+		assert.Equal(t, []string{"team-a/db"}, summary.DriftedStacks)
+		// the stalled stack has never succeeded, so it has been failing since it was created
+		require.NotNil(t, summary.OldestFailingStack)
+		assert.Equal(t, "team-b/cluster", summary.OldestFailingStack.Name)
+		assert.Equal(t, created, summary.OldestFailingStack.Since)
+		assert.Equal(t, "spec is invalid", summary.OldestFailingStack.Message)
+		assert.False(t, summary.Truncated)
+	})
+
+	t.Run("per namespace", func(t *testing.T) {
+		reports := makeStackReports(stacks, true, 24*time.Hour, now)
+		require.Len(t, reports, 2)
+		a := reports[pulumiv1.StackReportNamespacePrefix+"team-a"]
+		require.NotNil(t, a)
+		assert.Equal(t, "team-a", a.Report.Namespace)
+		assert.Equal(t, int32(3), a.Report.Total)
+		assert.Nil(t, a.Report.OldestFailingStack)
+
+		b := reports[pulumiv1.StackReportNamespacePrefix+"team-b"]
+		require.NotNil(t, b)
+		assert.Equal(t, int32(3), b.Report.Total)
+		assert.Equal(t, "team-b/cluster", b.Report.OldestFailingStack.Name)
+	})
+
+	t.Run("no stacks", func(t *testing.T) {
+		reports := makeStackReports(nil, false, 24*time.Hour, now)
+		require.Contains(t, reports, pulumiv1.StackReportGlobalName)
+		assert.Equal(t, int32(0), reports[pulumiv1.StackReportGlobalName].Report.Total)
+		assert.Empty(t, makeStackReports(nil, true, 24*time.Hour, now))
+	})
+
+	t.Run("names are limited", func(t *testing.T) {
+		var many []pulumiv1.Stack
+		for i := 0; i < maxStackReportNames+10; i++ {
+			many = append(many, stack("team-c", fmt.Sprintf("stack-%03d", i)))
+		}
+		summary := makeStackReports(many, false, 24*time.Hour, now)[pulumiv1.StackReportGlobalName].Report
+		assert.Equal(t, int32(maxStackReportNames+10), summary.Total)
+		assert.Len(t, summary.StaleStacks, maxStackReportNames)
+		assert.True(t, summary.Truncated)
+	})
+}
@@ -0,0 +1,206 @@
+// Copyright 2024, Pulumi Corporation.  All rights reserved.
+
+package stack
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	"github.com/pulumi/pulumi-kubernetes-operator/pkg/apis/pulumi/shared"
+	pulumiv1 "github.com/pulumi/pulumi-kubernetes-operator/pkg/apis/pulumi/v1"
+)
+
+const (
+	// EnvStrictSpecFields is the name of the environment entry which turns on strict checking of
+	// the fields in a Stack's spec. The API server drops fields that are not in the schema, so a
+	// typo such as `destoryOnFinalize` would otherwise go unnoticed. When set to "warn", unknown
+	// fields are reported in warnings and events; when set to "reject", a Stack with unknown
+	// fields is rejected by the validating webhook.
+	EnvStrictSpecFields = "STRICT_SPEC_FIELDS"
+
+	// validateStackPath is the path at which the validating webhook for Stacks is served.
+	validateStackPath = "/validate-pulumi-com-stack"
+)
+
+type strictSpecFieldsMode string
+
+const (
+	strictSpecFieldsOff    strictSpecFieldsMode = ""
+	strictSpecFieldsWarn   strictSpecFieldsMode = "warn"
+	strictSpecFieldsReject strictSpecFieldsMode = "reject"
+)
+
+func getStrictSpecFieldsMode() (strictSpecFieldsMode, error) {
+	switch mode := strictSpecFieldsMode(os.Getenv(EnvStrictSpecFields)); mode {
+	case strictSpecFieldsOff, strictSpecFieldsWarn, strictSpecFieldsReject:
+		return mode, nil
+	default:
+		return "", fmt.Errorf("%s must be one of %q or %q, but got %q",
+			EnvStrictSpecFields, strictSpecFieldsWarn, strictSpecFieldsReject, mode)
+	}
+}
+
+// addStackValidator registers the validating webhook for Stacks with the manager's webhook server.
+func addStackValidator(mgr manager.Manager, mode strictSpecFieldsMode) {
+	mgr.GetWebhookServer().Register(validateStackPath, &webhook.Admission{Handler: &stackValidator{mode: mode}})
+}
+
+// unknownSpecFields returns the paths of the fields given in the spec of the last applied
+// configuration of obj, which are not in the schema of a Stack. The last applied configuration is
+// used because by the time the object is seen by the operator, or by an admission webhook, the API
+// server has already dropped any unknown fields from the object itself. An object without a last
+// applied configuration (e.g., one that was not created with `kubectl apply`) has no unknown fields
+// that can be detected.
+func unknownSpecFields(obj metav1.Object) ([]string, error) {
+	lastApplied, ok := obj.GetAnnotations()[corev1.LastAppliedConfigAnnotation]
+	if !ok {
+		return nil, nil
+	}
+	var applied struct {
+		Spec interface{} `json:"spec"`
+	}
+	if err := json.Unmarshal([]byte(lastApplied), &applied); err != nil {
+		return nil, fmt.Errorf("parsing last applied configuration: %w", err)
+	}
+	fields := unknownFields("spec", reflect.TypeOf(shared.StackSpec{}), applied.Spec)
+	sort.Strings(fields)
+	return fields, nil
+}
+
+var jsonUnmarshalerType = reflect.TypeOf((*json.Unmarshaler)(nil)).Elem()
+
+// unknownFields walks the JSON value v alongside the type t it is meant to be decoded into, and
+// returns the paths of the fields in v that have no counterpart in t.
+func unknownFields(path string, t reflect.Type, v interface{}) []string {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	// Types which decode themselves (e.g., metav1.Time or apiextensionsv1.JSON) are opaque here.
+	if reflect.PtrTo(t).Implements(jsonUnmarshalerType) {
+		return nil
+	}
+
+	var unknown []string
+	switch t.Kind() {
+	case reflect.Struct:
+		obj, ok := v.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		fields := jsonFields(t)
+		for name, value := range obj {
+			fieldType, ok := fields[name]
+			if !ok {
+				unknown = append(unknown, path+"."+name)
+				continue
+			}
+			unknown = append(unknown, unknownFields(path+"."+name, fieldType, value)...)
+		}
+	case reflect.Map:
+		obj, ok := v.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		for key, value := range obj {
+			unknown = append(unknown, unknownFields(path+"."+key, t.Elem(), value)...)
+		}
+	case reflect.Slice, reflect.Array:
+		items, ok := v.([]interface{})
+		if !ok {
+			return nil
+		}
+		for i, item := range items {
+			unknown = append(unknown, unknownFields(fmt.Sprintf("%s[%d]", path, i), t.Elem(), item)...)
+		}
+	}
+	return unknown
+}
+
+// jsonFields returns the types of the fields of the struct type t, by the names they have in JSON.
+// The fields of embedded structs are included, as they are when encoding.
+func jsonFields(t reflect.Type) map[string]reflect.Type {
+	fields := map[string]reflect.Type{}
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := field.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name := strings.Split(tag, ",")[0]
+		if name == "" && field.Anonymous {
+			embedded := field.Type
+			if embedded.Kind() == reflect.Ptr {
+				embedded = embedded.Elem()
+			}
+			for name, fieldType := range jsonFields(embedded) {
+				fields[name] = fieldType
+			}
+			continue
+		}
+		if !field.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		fields[name] = field.Type
+	}
+	return fields
+}
+
+func unknownSpecFieldsMessage(fields []string) string {
+	return fmt.Sprintf("the applied configuration has fields which are not in the Stack schema, "+
+		"and have been dropped: %s", strings.Join(fields, ", "))
+}
+
+// warnUnknownSpecFields emits a warning event for fields in the applied configuration of the
+// stack which were dropped because they are not in the schema.
+func (r *ReconcileStack) warnUnknownSpecFields(instance *pulumiv1.Stack) {
+	fields, err := unknownSpecFields(instance)
+	if err != nil {
+		log.Error(err, "unable to check stack for unknown fields", "Stack.Name", instance.Name)
+		return
+	}
+	if len(fields) > 0 {
+		r.emitEvent(instance, pulumiv1.StackUnknownFieldsEvent(), "%s", unknownSpecFieldsMessage(fields))
+	}
+}
+
+// stackValidator is a validating admission webhook which checks Stacks for unknown fields.
+type stackValidator struct {
+	mode strictSpecFieldsMode
+}
+
+func (v *stackValidator) Handle(_ context.Context, req admission.Request) admission.Response {
+	if len(req.Object.Raw) == 0 {
+		return admission.Allowed("")
+	}
+	// Only the metadata is needed, since that is where the last applied configuration is kept.
+	obj := &metav1.PartialObjectMetadata{}
+	if err := json.Unmarshal(req.Object.Raw, obj); err != nil {
+		return admission.Errored(http.StatusBadRequest, err)
+	}
+	fields, err := unknownSpecFields(obj)
+	if err != nil {
+		return admission.Errored(http.StatusBadRequest, err)
+	}
+	if len(fields) == 0 {
+		return admission.Allowed("")
+	}
+	if v.mode == strictSpecFieldsReject {
+		return admission.Denied(unknownSpecFieldsMessage(fields))
+	}
+	return admission.Allowed("").WithWarnings(unknownSpecFieldsMessage(fields))
+}
@@ -0,0 +1,116 @@
+// Copyright 2024, Pulumi Corporation.  All rights reserved.
+
+package stack
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	admissionv1 "k8s.io/api/admission/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+func TestUnknownSpecFields(t *testing.T) {
+	for _, test := range []struct {
+		name        string
+		lastApplied string
+		expected    []string
+	}{
+		{
+			name: "no unknown fields",
+			lastApplied: `{"apiVersion":"pulumi.com/v1","kind":"Stack","spec":{
+				"stack":"org/dev","projectRepo":"https://github.com/pulumi/examples","branch":"main",
+				"destroyOnFinalize":true,"config":{"aws:region":"us-east-1"},
+				"envRefs":{"PULUMI_ACCESS_TOKEN":{"type":"Secret","secret":{"name":"token","key":"token"}}},
+				"gitAuth":{"sshAuth":{"sshPrivateKey":{"type":"Secret","secret":{"name":"ssh","key":"key"}}}},
+				"prerequisites":[{"name":"other","requirement":{"succeededWithinDuration":"1h"}}]}}`,
+		},
+		{
+			name:        "misspelled destroyOnFinalize",
+			lastApplied: `{"spec":{"stack":"org/dev","destoryOnFinalize":true}}`,
+			expected:    []string{"spec.destoryOnFinalize"},
+		},
+		{
+			name:        "wrong case",
+			lastApplied: `{"spec":{"stack":"org/dev","projectRepo":"https://github.com/pulumi/examples","Branch":"main"}}`,
+			expected:    []string{"spec.Branch"},
+		},
+		{
+			name:        "misspelled nested field",
+			lastApplied: `{"spec":{"stack":"org/dev","gitAuth":{"accessToken":{"type":"Secret","secert":{"name":"token"}}}}}`,
+			expected:    []string{"spec.gitAuth.accessToken.secert"},
+		},
+		{
+			name: "misspelled fields in map and list entries",
+			lastApplied: `{"spec":{"stack":"org/dev",
+				"envRefs":{"TOKEN":{"type":"Literal","literal":{"vaule":"x"}}},
+				"prerequisites":[{"name":"other"},{"name":"another","requirements":{}}]}}`,
+			expected: []string{"spec.envRefs.TOKEN.literal.vaule", "spec.prerequisites[1].requirements"},
+		},
+		{
+			name:        "no spec",
+			lastApplied: `{"apiVersion":"pulumi.com/v1","kind":"Stack"}`,
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			obj := &metav1.ObjectMeta{Annotations: map[string]string{
+				corev1.LastAppliedConfigAnnotation: test.lastApplied,
+			}}
+			fields, err := unknownSpecFields(obj)
+			require.NoError(t, err)
+			assert.Equal(t, test.expected, fields)
+		})
+	}
+
+	t.Run("no last applied configuration", func(t *testing.T) {
+		fields, err := unknownSpecFields(&metav1.ObjectMeta{})
+		require.NoError(t, err)
+		assert.Empty(t, fields)
+	})
+}
+
+func TestStackValidator(t *testing.T) {
+	request := func(lastApplied string) admission.Request {
+		obj := &metav1.PartialObjectMetadata{
+			TypeMeta:   metav1.TypeMeta{APIVersion: "pulumi.com/v1", Kind: "Stack"},
+			ObjectMeta: metav1.ObjectMeta{Name: "my-stack", Namespace: namespace},
+		}
+		if lastApplied != "" {
+			obj.Annotations = map[string]string{corev1.LastAppliedConfigAnnotation: lastApplied}
+		}
+		raw, err := json.Marshal(obj)
+		require.NoError(t, err)
+		return admission.Request{AdmissionRequest: admissionv1.AdmissionRequest{
+			Operation: admissionv1.Create,
+			Object:    runtime.RawExtension{Raw: raw},
+		}}
+	}
+	const typo = `{"spec":{"stack":"org/dev","destoryOnFinalize":true}}`
+
+	t.Run("reject", func(t *testing.T) {
+		v := &stackValidator{mode: strictSpecFieldsReject}
+		resp := v.Handle(context.TODO(), request(typo))
+		assert.False(t, resp.Allowed)
+		assert.Contains(t, string(resp.Result.Reason), "spec.destoryOnFinalize")
+
+		resp = v.Handle(context.TODO(), request(`{"spec":{"stack":"org/dev","destroyOnFinalize":true}}`))
+		assert.True(t, resp.Allowed)
+
+		resp = v.Handle(context.TODO(), request(""))
+		assert.True(t, resp.Allowed)
+	})
+
+	t.Run("warn", func(t *testing.T) {
+		v := &stackValidator{mode: strictSpecFieldsWarn}
+		resp := v.Handle(context.TODO(), request(typo))
+		assert.True(t, resp.Allowed)
+		require.Len(t, resp.Warnings, 1)
+		assert.Contains(t, resp.Warnings[0], "spec.destoryOnFinalize")
+	})
+}
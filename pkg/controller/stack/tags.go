@@ -0,0 +1,115 @@
+// Copyright 2024, Pulumi Corporation.  All rights reserved.
+
+package stack
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"text/template"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// expandStackTags gives the tags from .spec.tags with their values expanded as templates, which
+// can refer to the Stack object's namespace and name.
+func expandStackTags(tags map[string]string, meta metav1.ObjectMeta) (map[string]string, error) {
+	if len(tags) == 0 {
+		return nil, nil
+	}
+	data := struct{ Namespace, Name string }{meta.Namespace, meta.Name}
+	expanded := make(map[string]string, len(tags))
+	for key, value := range tags {
+		if !strings.Contains(value, "{{") {
+			expanded[key] = value
+			continue
+		}
+		tmpl, err := template.New(key).Option("missingkey=error").Parse(value)
+		if err != nil {
+			return nil, fmt.Errorf("tag %q: %w", key, err)
+		}
+		var b bytes.Buffer
+		if err := tmpl.Execute(&b, data); err != nil {
+			return nil, fmt.Errorf("tag %q: %w", key, err)
+		}
+		expanded[key] = b.String()
+	}
+	return expanded, nil
+}
+
+// stackTagsPlan gives the tags to set and the keys of the tags to remove, to bring the tags on a
+// stack in line with those wanted, and the keys to record as set by the operator. Only tags the
+// operator set (those recorded) are removed, and only when pruning; otherwise, they stay recorded
+// for as long as they're on the stack, so that turning pruning on later removes them.
+func stackTagsPlan(wanted, current map[string]string, recorded []string, prune bool) (set map[string]string, remove, record []string) {
+	set = map[string]string{}
+	for key, value := range wanted {
+		if v, ok := current[key]; !ok || v != value {
+			set[key] = value
+		}
+		record = append(record, key)
+	}
+	for _, key := range recorded {
+		if _, ok := wanted[key]; ok {
+			continue
+		}
+		if _, ok := current[key]; !ok {
+			continue
+		}
+		if prune {
+			remove = append(remove, key)
+		} else {
+			record = append(record, key)
+		}
+	}
+	sort.Strings(remove)
+	sort.Strings(record)
+	return set, remove, record
+}
+
+// isTagsUnsupportedError reports whether the error is from a backend which doesn't support stack
+// tags.
+func isTagsUnsupportedError(err error) bool {
+	msg := strings.ToLower(err.Error())
+	return strings.Contains(msg, "not supported") || strings.Contains(msg, "unsupported")
+}
+
+// syncTags sets the tags given in .spec.tags on the stack, and removes those the operator set
+// before which are no longer given, if .spec.pruneTags is set. The tags set by the operator are
+// recorded in sess.tags, for the status. If the backend doesn't support tags, nothing is done.
+func (sess *reconcileStackSession) syncTags(ctx context.Context, recorded []string) error {
+	if len(sess.stack.Tags) == 0 && len(recorded) == 0 {
+		return nil
+	}
+	wanted, err := expandStackTags(sess.stack.Tags, sess.objectMeta)
+	if err != nil {
+		return err
+	}
+	w := sess.autoStack.Workspace()
+	current, err := w.ListTags(ctx, sess.stack.Stack)
+	if err != nil {
+		if isTagsUnsupportedError(err) {
+			sess.logger.Debug("Backend does not support stack tags; ignoring tags", "Error", err.Error())
+			return nil
+		}
+		return fmt.Errorf("listing the stack's tags: %w", err)
+	}
+	set, remove, record := stackTagsPlan(wanted, current, recorded, sess.stack.PruneTags)
+	for _, key := range remove {
+		if err := w.RemoveTag(ctx, sess.stack.Stack, key); err != nil {
+			return fmt.Errorf("removing tag %q: %w", key, err)
+		}
+	}
+	for key, value := range set {
+		if err := w.SetTag(ctx, sess.stack.Stack, key, value); err != nil {
+			return fmt.Errorf("setting tag %q: %w", key, err)
+		}
+	}
+	if len(set) > 0 || len(remove) > 0 {
+		sess.logger.Info("Synced stack tags", "Set", len(set), "Removed", remove)
+	}
+	sess.tags, sess.tagsSynced = record, true
+	return nil
+}
@@ -0,0 +1,63 @@
+// Copyright 2024, Pulumi Corporation.  All rights reserved.
+
+package stack
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestExpandStackTags(t *testing.T) {
+	meta := metav1.ObjectMeta{Namespace: "payments", Name: "api-prod"}
+	tags, err := expandStackTags(map[string]string{
+		"team":  "payments",
+		"owner": "{{ .Namespace }}/{{ .Name }}",
+	}, meta)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"team": "payments", "owner": "payments/api-prod"}, tags)
+
+	_, err = expandStackTags(map[string]string{"owner": "{{ .Cluster }}"}, meta)
+	assert.ErrorContains(t, err, `tag "owner"`)
+	_, err = expandStackTags(map[string]string{"owner": "{{ .Name"}, meta)
+	assert.Error(t, err)
+
+	tags, err = expandStackTags(nil, meta)
+	require.NoError(t, err)
+	assert.Empty(t, tags)
+}
+
+func TestStackTagsPlan(t *testing.T) {
+	current := map[string]string{
+		"team":           "payments",
+		"owner":          "old",
+		"retired":        "yes",
+		"pulumi:runtime": "go",
+	}
+	wanted := map[string]string{"team": "payments", "owner": "payments/api", "env": "prod"}
+	recorded := []string{"team", "owner", "retired", "gone"}
+
+	set, remove, record := stackTagsPlan(wanted, current, recorded, false)
+	assert.Equal(t, map[string]string{"owner": "payments/api", "env": "prod"}, set)
+	assert.Empty(t, remove, "not pruning")
+	assert.Equal(t, []string{"env", "owner", "retired", "team"}, record,
+		"a tag no longer given stays recorded while it's on the stack")
+
+	set, remove, record = stackTagsPlan(wanted, current, recorded, true)
+	assert.Len(t, set, 2)
+	assert.Equal(t, []string{"retired"}, remove, "only tags set by the operator are removed")
+	assert.Equal(t, []string{"env", "owner", "team"}, record)
+
+	set, remove, record = stackTagsPlan(nil, current, recorded, true)
+	assert.Empty(t, set)
+	assert.Equal(t, []string{"owner", "retired", "team"}, remove)
+	assert.Empty(t, record)
+}
+
+func TestIsTagsUnsupportedError(t *testing.T) {
+	assert.True(t, isTagsUnsupportedError(errors.New("stack tags not supported in --local mode")))
+	assert.False(t, isTagsUnsupportedError(errors.New("403 Forbidden")))
+}
@@ -0,0 +1,204 @@
+// Copyright 2024, Pulumi Corporation.  All rights reserved.
+
+package stack
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"k8s.io/client-go/util/workqueue"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	ctrlhandler "sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// The phases of processing a stack which are timed. The time spent waiting in the queue is not
+// part of a reconciliation as such, but is reported along with the phases since it's often where
+// the time goes when a lot of stacks are queued at once.
+const (
+	phaseQueue   = "queue"
+	phaseFetch   = "fetch"
+	phaseInstall = "install"
+	phaseConfig  = "config"
+	phaseRefresh = "refresh"
+	phaseUpdate  = "update"
+	phaseStatus  = "status"
+)
+
+// timedPhases gives the order in which the phases are reported.
+var timedPhases = []string{phaseQueue, phaseFetch, phaseInstall, phaseConfig, phaseRefresh, phaseUpdate, phaseStatus}
+
+// phaseTimer accounts the time spent in each phase of a reconciliation. Only one phase is timed
+// at once; entering a phase pauses the one being timed, so that (e.g.) installing dependencies
+// during a fetch is counted as installing and not as fetching. The zero value is not usable, but
+// a nil *phaseTimer is, and times nothing.
+type phaseTimer struct {
+	now       func() time.Time
+	start     time.Time
+	durations map[string]time.Duration
+	current   string
+	since     time.Time
+	// entered is the phase last entered, which is where any failure is taken to have happened
+	entered string
+}
+
+func newPhaseTimer(now func() time.Time) *phaseTimer {
+	return &phaseTimer{now: now, start: now(), durations: map[string]time.Duration{}}
+}
+
+// enter starts timing the phase given, and returns a func which goes back to timing whichever
+// phase was being timed before.
+func (t *phaseTimer) enter(phase string) func() {
+	if t == nil {
+		return func() {}
+	}
+	prev := t.switchTo(phase)
+	t.entered = phase
+	return func() { t.switchTo(prev) }
+}
+
+// lastEntered gives the phase last entered, or "" if none has been.
+func (t *phaseTimer) lastEntered() string {
+	if t == nil {
+		return ""
+	}
+	return t.entered
+}
+
+func (t *phaseTimer) switchTo(phase string) string {
+	now := t.now()
+	if t.current != "" {
+		t.durations[t.current] += now.Sub(t.since)
+	}
+	prev := t.current
+	t.current, t.since = phase, now
+	return prev
+}
+
+// add records time spent in a phase outside of the reconciliation, i.e., waiting in the queue.
+func (t *phaseTimer) add(phase string, d time.Duration) {
+	if t != nil {
+		t.durations[phase] += d
+	}
+}
+
+// summary gives the time spent in each phase so far, and the total time since the timer was
+// started, in a fixed format, e.g.,
+//
+//	queue=1.2s fetch=3.4s install=- config=200ms refresh=- update=21m3.1s status=100ms total=21m7s
+//
+// A phase that wasn't entered is given as "-". The total does not include the time spent in the
+// queue.
+func (t *phaseTimer) summary() string {
+	if t == nil {
+		return ""
+	}
+	t.switchTo(t.current) // account the time spent in the current phase
+	parts := make([]string, 0, len(timedPhases)+1)
+	for _, phase := range timedPhases {
+		d, ok := t.durations[phase]
+		if !ok {
+			parts = append(parts, phase+"=-")
+			continue
+		}
+		parts = append(parts, fmt.Sprintf("%s=%s", phase, roundDuration(d)))
+	}
+	parts = append(parts, fmt.Sprintf("total=%s", roundDuration(t.now().Sub(t.start))))
+	return strings.Join(parts, " ")
+}
+
+func roundDuration(d time.Duration) time.Duration {
+	return d.Round(100 * time.Millisecond)
+}
+
+// enqueueTimes records when stacks were queued for reconciliation, so that the time they spent
+// waiting in the queue can be reported. A nil *enqueueTimes records nothing.
+type enqueueTimes struct {
+	mu    sync.Mutex
+	times map[reconcile.Request]time.Time
+}
+
+func newEnqueueTimes() *enqueueTimes {
+	return &enqueueTimes{times: map[reconcile.Request]time.Time{}}
+}
+
+// record notes that the request was due to be processed at the time given. Since the queue
+// coalesces requests for the same object, the earliest time is kept.
+func (e *enqueueTimes) record(req reconcile.Request, due time.Time) {
+	if e == nil {
+		return
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if t, ok := e.times[req]; !ok || due.Before(t) {
+		e.times[req] = due
+	}
+}
+
+// take returns how long the request has been waiting at the time given, and forgets it. It
+// returns false if it's not known when the request was queued (e.g., because it was requeued
+// with a backoff after failing).
+func (e *enqueueTimes) take(req reconcile.Request, now time.Time) (time.Duration, bool) {
+	if e == nil {
+		return 0, false
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	t, ok := e.times[req]
+	if !ok {
+		return 0, false
+	}
+	delete(e.times, req)
+	if wait := now.Sub(t); wait > 0 {
+		return wait, true
+	}
+	return 0, true
+}
+
+// handler wraps an event handler so that the requests it queues are recorded.
+func (e *enqueueTimes) handler(h ctrlhandler.EventHandler) ctrlhandler.EventHandler {
+	return timedEventHandler{EventHandler: h, times: e}
+}
+
+type timedEventHandler struct {
+	ctrlhandler.EventHandler
+	times *enqueueTimes
+}
+
+func (h timedEventHandler) Create(e event.CreateEvent, q workqueue.RateLimitingInterface) {
+	h.EventHandler.Create(e, timedQueue{q, h.times})
+}
+
+func (h timedEventHandler) Update(e event.UpdateEvent, q workqueue.RateLimitingInterface) {
+	h.EventHandler.Update(e, timedQueue{q, h.times})
+}
+
+func (h timedEventHandler) Delete(e event.DeleteEvent, q workqueue.RateLimitingInterface) {
+	h.EventHandler.Delete(e, timedQueue{q, h.times})
+}
+
+func (h timedEventHandler) Generic(e event.GenericEvent, q workqueue.RateLimitingInterface) {
+	h.EventHandler.Generic(e, timedQueue{q, h.times})
+}
+
+// timedQueue records the requests added to the queue it wraps.
+type timedQueue struct {
+	workqueue.RateLimitingInterface
+	times *enqueueTimes
+}
+
+func (q timedQueue) Add(item interface{}) {
+	if req, ok := item.(reconcile.Request); ok {
+		q.times.record(req, time.Now())
+	}
+	q.RateLimitingInterface.Add(item)
+}
+
+func (q timedQueue) AddAfter(item interface{}, d time.Duration) {
+	if req, ok := item.(reconcile.Request); ok {
+		q.times.record(req, time.Now().Add(d))
+	}
+	q.RateLimitingInterface.AddAfter(item, d)
+}
@@ -0,0 +1,80 @@
+// Copyright 2024, Pulumi Corporation.  All rights reserved.
+
+package stack
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+func TestPhaseTimer(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	clock := func() time.Time { return now }
+	tick := func(d time.Duration) { now = now.Add(d) }
+
+	timer := newPhaseTimer(clock)
+	timer.add(phaseQueue, 1200*time.Millisecond)
+	tick(time.Second) // not in any phase
+
+	stopFetch := timer.enter(phaseFetch)
+	tick(3 * time.Second)
+	stopConfig := timer.enter(phaseConfig)
+	tick(200 * time.Millisecond)
+	stopInstall := timer.enter(phaseInstall)
+	tick(time.Minute)
+	stopInstall()
+	tick(100 * time.Millisecond)
+	stopConfig()
+	tick(400 * time.Millisecond)
+	stopFetch()
+
+	stopStatus := timer.enter(phaseStatus)
+	tick(50 * time.Millisecond)
+	stopStatus()
+	// the current phase is accounted up to the time of the summary
+	timer.enter(phaseUpdate)
+	tick(21 * time.Minute)
+
+	assert.Equal(t,
+		"queue=1.2s fetch=3.4s install=1m0s config=300ms refresh=- update=21m0s status=100ms total=22m4.8s",
+		timer.summary())
+
+	var none *phaseTimer
+	none.enter(phaseFetch)()
+	none.add(phaseQueue, time.Second)
+	assert.Empty(t, none.summary())
+}
+
+func TestEnqueueTimes(t *testing.T) {
+	start := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	req := reconcile.Request{NamespacedName: types.NamespacedName{Namespace: namespace, Name: "stack"}}
+	times := newEnqueueTimes()
+
+	_, ok := times.take(req, start)
+	assert.False(t, ok, "nothing recorded")
+
+	// the earliest time is kept, since the queue coalesces requests
+	times.record(req, start.Add(time.Minute))
+	times.record(req, start.Add(10*time.Second))
+	times.record(req, start.Add(30*time.Second))
+	wait, ok := times.take(req, start.Add(15*time.Second))
+	assert.True(t, ok)
+	assert.Equal(t, 5*time.Second, wait)
+	_, ok = times.take(req, start.Add(15*time.Second))
+	assert.False(t, ok, "taken already")
+
+	// processed before it was due
+	times.record(req, start.Add(time.Minute))
+	wait, ok = times.take(req, start)
+	assert.True(t, ok)
+	assert.Zero(t, wait)
+
+	var none *enqueueTimes
+	none.record(req, start)
+	_, ok = none.take(req, start)
+	assert.False(t, ok)
+}
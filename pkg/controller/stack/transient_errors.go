@@ -0,0 +1,57 @@
+// Copyright 2024, Pulumi Corporation.  All rights reserved.
+
+package stack
+
+import (
+	"regexp"
+	"time"
+)
+
+// An update can fail for reasons that have nothing to do with the program or the stack: a
+// provider's API throttling requests, answering with a 5xx status, or a network timeout. Rather
+// than being marked as failed, an update failing like that is given the status
+// StackUpdateRetryable, and retried after a backoff, up to maxTransientRetries times in a row;
+// after that, it's marked as failed as any other failure is. A failure of the program itself (e.g.,
+// it not compiling) is never taken to be transient, whatever else the error says, so it still
+// fails fast.
+
+const (
+	// maxTransientRetries is the most times in a row an update is retried after failing with a
+	// transient error, before it's marked as failed.
+	maxTransientRetries = 5
+	// transientRetryBackoff is the wait before the first retry after a transient error; it's
+	// doubled for each retry after that.
+	transientRetryBackoff = 10 * time.Second
+	// maxTransientRetryBackoff is the longest wait before a retry.
+	maxTransientRetryBackoff = 5 * time.Minute
+)
+
+var (
+	// transientErrorPattern matches what the CLI reports for errors which are likely to be
+	// transient.
+	transientErrorPattern = regexp.MustCompile(`(?i)(rate exceeded|rate limit|too many requests|` +
+		`throttl|(status ?code|error|http)[^0-9a-z]{0,3}5\d\d\b|internal server error|bad gateway|` +
+		`service unavailable|gateway time-?out|i/o timeout|connection reset by peer|` +
+		`tls handshake timeout|timeout awaiting response headers)`)
+	// programErrorPattern matches what the CLI reports for failures of the program itself.
+	programErrorPattern = regexp.MustCompile(`(?i)(failed with an unhandled exception|` +
+		`an unhandled error occurred|compilation (error|failed)|unable to compile|syntaxerror|` +
+		`error TS\d+|panic: |Traceback \(most recent call last\))`)
+)
+
+// isTransientUpdateError reports whether an update failed with an error which is likely to be
+// transient, so that it's worth retrying; the error from the automation API includes what the CLI
+// wrote to stderr.
+func isTransientUpdateError(err error) bool {
+	msg := err.Error()
+	return transientErrorPattern.MatchString(msg) && !programErrorPattern.MatchString(msg)
+}
+
+// transientRetryWait gives the wait before the retry given, counting from 1.
+func transientRetryWait(retry int32) time.Duration {
+	backoff := transientRetryBackoff
+	for i := int32(1); i < retry && backoff < maxTransientRetryBackoff; i++ {
+		backoff *= 2
+	}
+	return min(backoff, maxTransientRetryBackoff)
+}
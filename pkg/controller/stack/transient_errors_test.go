@@ -0,0 +1,41 @@
+// Copyright 2024, Pulumi Corporation.  All rights reserved.
+
+package stack
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIsTransientUpdateError(t *testing.T) {
+	cases := []struct {
+		stderr    string
+		transient bool
+	}{
+		{"aws:s3:Bucket (logs): error: creating S3 Bucket: operation error S3: CreateBucket, https response error StatusCode: 503, api error SlowDown", true},
+		{"error: Error 429: Too Many Requests", true},
+		{"gcp:compute:Instance (vm): error: googleapi: Error 500: Internal error encountered.", true},
+		{"error: ThrottlingException: Rate exceeded", true},
+		{"error: Get \"https://management.azure.com/subscriptions\": dial tcp 20.0.0.1:443: i/o timeout", true},
+		{"error: read tcp 10.0.0.1:1234->52.0.0.1:443: read: connection reset by peer", true},
+		{"aws:s3:Bucket (logs): error: creating S3 Bucket: BucketAlreadyExists", false},
+		{"error: Running program '/workspace' failed with an unhandled exception:\nError: rate limit must be positive", false},
+		{"error: Running program: main.go:12:2: syntax error\ncompilation failed\nerror: Error 500", false},
+		{"index.ts(3,1): error TS2304: Cannot find name 'foo'.", false},
+		{"error: resource urn:pulumi:dev::proj::aws:ec2/instance:Instance::i-50012 already exists", false},
+	}
+	for _, c := range cases {
+		err := errors.New("failed to run update: exit status 255\ncode: 255\nstdout: \nstderr: " + c.stderr)
+		assert.Equal(t, c.transient, isTransientUpdateError(err), c.stderr)
+	}
+}
+
+func TestTransientRetryWait(t *testing.T) {
+	assert.Equal(t, 10*time.Second, transientRetryWait(1))
+	assert.Equal(t, 20*time.Second, transientRetryWait(2))
+	assert.Equal(t, 160*time.Second, transientRetryWait(5))
+	assert.Equal(t, 5*time.Minute, transientRetryWait(10), "limited")
+}
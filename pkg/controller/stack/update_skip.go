@@ -0,0 +1,102 @@
+// Copyright 2024, Pulumi Corporation.  All rights reserved.
+
+package stack
+
+import (
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	"github.com/pulumi/pulumi-kubernetes-operator/pkg/apis/pulumi/shared"
+	pulumiv1 "github.com/pulumi/pulumi-kubernetes-operator/pkg/apis/pulumi/v1"
+)
+
+// updateUnchanged reports whether an update of the stack at the revision given would have nothing
+// new to do: the last update succeeded, at that revision and with the spec as it is now, and no
+// reconciliation has been requested since (using the annotation named for
+// shared.ReconcileRequestAnnotation). With ContinueResyncOnCommitMatch, the stack is always
+// updated; and it's updated again once a resync is due (see resyncDue).
+//
+// The value of the annotation is compared with that recorded for the last successful update,
+// rather than .status.observedReconcileRequest, since a request may be observed without an update
+// being run; e.g., while the stack waits for its prerequisites.
+func updateUnchanged(instance *pulumiv1.Stack, revision string) bool {
+	last := instance.Status.LastUpdate
+	switch {
+	case instance.Spec.ContinueResyncOnCommitMatch:
+		return false
+	case resyncDue(instance, time.Now()):
+		return false
+	case last == nil || last.State != shared.SucceededStackStateMessage:
+		return false
+	case revision == "" || last.LastSuccessfulCommit != revision:
+		return false
+	case last.LastSuccessfulGeneration != instance.GetGeneration():
+		return false
+	}
+	if req, ok := getReconcileRequestAnnotation(instance); ok && req != last.ReconcileRequest {
+		return false
+	}
+	return true
+}
+
+func lastSuccessfulCommit(instance *pulumiv1.Stack) string {
+	if instance.Status.LastUpdate == nil {
+		return ""
+	}
+	return instance.Status.LastUpdate.LastSuccessfulCommit
+}
+
+// skipUnchangedUpdate records that the stack was checked and found to be up to date, and gives
+// when to check it again.
+func skipUnchangedUpdate(sess *reconcileStackSession, instance *pulumiv1.Stack, revision string, resyncFreqSeconds int64) reconcile.Result {
+	sess.logger.Info("Commit hash unchanged. Will poll again.", "Commit", revision, "pollFrequencySeconds", resyncFreqSeconds)
+	instance.Status.LastUpdate.LastResyncTime = metav1.Now()
+	instance.Status.MarkReadyCondition()
+	return reconcile.Result{RequeueAfter: time.Duration(resyncFreqSeconds) * time.Second}
+}
+
+// resyncDue reports whether .spec.resyncFrequencySeconds has passed since the last successful
+// update of the stack started, so that it's to be refreshed and updated again even if nothing has
+// changed. A stack with driftDetectionOnly set is checked for drift rather than updated, so a
+// resync is never due for it.
+func resyncDue(instance *pulumiv1.Stack, now time.Time) bool {
+	freq := instance.Spec.ResyncFrequencySeconds
+	last := instance.Status.LastUpdate
+	if freq <= 0 || instance.Spec.DriftDetectionOnly || last == nil || last.State != shared.SucceededStackStateMessage {
+		return false
+	}
+	// a status from before the start time was recorded
+	if last.StartTime == nil {
+		return true
+	}
+	return now.Sub(last.StartTime.Time) >= time.Duration(freq)*time.Second
+}
+
+// sourcePolling gives whether the stack's source is tracked, rather than fixed (e.g., a branch
+// rather than a commit), whether the stack is to be requeued to poll its source, and how often to
+// do so. A tracked source is polled every 60 seconds if no resync frequency is given, and a source
+// fixed at a commit is polled only if one is.
+func sourcePolling(stack *shared.StackSpec) (trackBranch, requeueForSourcePoll bool, resyncFreqSeconds int64) {
+	requeueForSourcePoll = true
+	resyncFreqSeconds = stack.ResyncFrequencySeconds
+
+	// a tag can be moved, and the contents of a local directory or an archive without a digest
+	// changed, so these are polled in the same way as a branch
+	if stack.GitSource != nil {
+		trackBranch = len(stack.GitSource.Branch) > 0 || len(stack.GitSource.Tag) > 0 || len(stack.GitSource.ProjectPath) > 0 ||
+			(len(stack.GitSource.ProjectArchiveURL) > 0 && len(stack.GitSource.ArchiveSHA256) == 0)
+		// this object won't need to be requeued later if it's not tracking a branch, unless a
+		// resync frequency has been given explicitly
+		requeueForSourcePoll = trackBranch || stack.ResyncFrequencySeconds != 0
+
+		// when tracking a branch, rather than an exact commit, always requeue
+		if trackBranch || stack.ContinueResyncOnCommitMatch {
+			if resyncFreqSeconds == 0 {
+				resyncFreqSeconds = 60
+			}
+		}
+	}
+	return trackBranch, requeueForSourcePoll, resyncFreqSeconds
+}
@@ -0,0 +1,128 @@
+// Copyright 2024, Pulumi Corporation.  All rights reserved.
+
+package stack
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/pulumi/pulumi-kubernetes-operator/pkg/apis/pulumi/shared"
+	pulumiv1 "github.com/pulumi/pulumi-kubernetes-operator/pkg/apis/pulumi/v1"
+)
+
+func TestUpdateUnchanged(t *testing.T) {
+	const commit = "0123456789abcdef0123456789abcdef01234567"
+	deployed := func() *pulumiv1.Stack {
+		s := &pulumiv1.Stack{ObjectMeta: metav1.ObjectMeta{Generation: 3}}
+		s.Status.LastUpdate = &shared.StackUpdateState{
+			State:                    shared.SucceededStackStateMessage,
+			LastAttemptedCommit:      commit,
+			LastSuccessfulCommit:     commit,
+			LastSuccessfulGeneration: 3,
+		}
+		return s
+	}
+
+	assert.True(t, updateUnchanged(deployed(), commit))
+	assert.False(t, updateUnchanged(deployed(), "fedcba9876543210fedcba9876543210fedcba98"), "new commit")
+	assert.False(t, updateUnchanged(deployed(), ""), "revision not known")
+
+	never := deployed()
+	never.Status.LastUpdate = nil
+	assert.False(t, updateUnchanged(never, commit), "never updated")
+
+	failed := deployed()
+	failed.Status.LastUpdate.State = shared.FailedStackStateMessage
+	assert.False(t, updateUnchanged(failed, commit), "last update failed")
+
+	changed := deployed()
+	changed.Generation = 4
+	assert.False(t, updateUnchanged(changed, commit), "spec changed")
+
+	// a status from before the generation was recorded
+	old := deployed()
+	old.Status.LastUpdate.LastSuccessfulGeneration = 0
+	assert.False(t, updateUnchanged(old, commit))
+
+	requested := deployed()
+	requested.Annotations = map[string]string{shared.ReconcileRequestAnnotation: "now"}
+	assert.False(t, updateUnchanged(requested, commit), "reconciliation requested")
+	requested.Status.ObservedReconcileRequest = "now"
+	assert.False(t, updateUnchanged(requested, commit), "request seen, but not handled by an update")
+	requested.Status.LastUpdate.ReconcileRequest = "now"
+	assert.True(t, updateUnchanged(requested, commit), "request already handled")
+	requested.Annotations[shared.ReconcileRequestAnnotation] = "later"
+	assert.False(t, updateUnchanged(requested, commit), "reconciliation requested again")
+
+	resync := deployed()
+	resync.Spec.ContinueResyncOnCommitMatch = true
+	assert.False(t, updateUnchanged(resync, commit), "continueResyncOnCommitMatch")
+
+	due := deployed()
+	due.Spec.ResyncFrequencySeconds = 300
+	due.Status.LastUpdate.StartTime = &metav1.Time{Time: time.Now().Add(-10 * time.Minute)}
+	assert.False(t, updateUnchanged(due, commit), "resync due")
+	due.Status.LastUpdate.StartTime = &metav1.Time{Time: time.Now().Add(-time.Minute)}
+	assert.True(t, updateUnchanged(due, commit), "resync not yet due")
+}
+
+func TestResyncDue(t *testing.T) {
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	deployed := func(freq int64, started time.Duration) *pulumiv1.Stack {
+		s := &pulumiv1.Stack{Spec: shared.StackSpec{ResyncFrequencySeconds: freq}}
+		s.Status.LastUpdate = &shared.StackUpdateState{
+			State:     shared.SucceededStackStateMessage,
+			StartTime: &metav1.Time{Time: now.Add(-started)},
+		}
+		return s
+	}
+
+	assert.True(t, resyncDue(deployed(60, 2*time.Minute), now))
+	assert.True(t, resyncDue(deployed(60, time.Minute), now), "exactly due")
+	assert.False(t, resyncDue(deployed(300, 2*time.Minute), now), "not yet due")
+	assert.False(t, resyncDue(deployed(0, time.Hour), now), "no resync frequency")
+
+	driftOnly := deployed(60, time.Hour)
+	driftOnly.Spec.DriftDetectionOnly = true
+	assert.False(t, resyncDue(driftOnly, now), "checked for drift rather than updated")
+
+	failed := deployed(60, time.Hour)
+	failed.Status.LastUpdate.State = shared.FailedStackStateMessage
+	assert.False(t, resyncDue(failed, now), "retried as a failure, not resynced")
+
+	old := deployed(60, 0)
+	old.Status.LastUpdate.StartTime = nil
+	assert.True(t, resyncDue(old, now), "a status from before the start time was recorded")
+}
+
+func TestSourcePolling(t *testing.T) {
+	const commit = "0123456789abcdef0123456789abcdef01234567"
+	cases := []struct {
+		name        string
+		spec        shared.StackSpec
+		trackBranch bool
+		requeue     bool
+		freqSeconds int64
+	}{
+		{name: "branch", spec: shared.StackSpec{GitSource: &shared.GitSource{Branch: "main"}},
+			trackBranch: true, requeue: true, freqSeconds: 60},
+		{name: "branch with resync frequency", spec: shared.StackSpec{GitSource: &shared.GitSource{Branch: "main"}, ResyncFrequencySeconds: 300},
+			trackBranch: true, requeue: true, freqSeconds: 300},
+		{name: "commit", spec: shared.StackSpec{GitSource: &shared.GitSource{Commit: commit}}},
+		{name: "commit with resync frequency", spec: shared.StackSpec{GitSource: &shared.GitSource{Commit: commit}, ResyncFrequencySeconds: 300},
+			requeue: true, freqSeconds: 300},
+		{name: "commit with continueResyncOnCommitMatch", spec: shared.StackSpec{GitSource: &shared.GitSource{Commit: commit}, ContinueResyncOnCommitMatch: true},
+			freqSeconds: 60},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			trackBranch, requeue, freqSeconds := sourcePolling(&c.spec)
+			assert.Equal(t, c.trackBranch, trackBranch, "trackBranch")
+			assert.Equal(t, c.requeue, requeue, "requeueForSourcePoll")
+			assert.Equal(t, c.freqSeconds, freqSeconds, "resyncFreqSeconds")
+		})
+	}
+}
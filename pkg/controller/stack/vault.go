@@ -0,0 +1,198 @@
+// Copyright 2024, Pulumi Corporation.  All rights reserved.
+
+package stack
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/pulumi/pulumi-kubernetes-operator/pkg/apis/pulumi/shared"
+)
+
+const defaultVaultKubernetesMountPath = "kubernetes"
+
+var (
+	// vaultServiceAccountTokenPath is where the operator's service account token is found, for
+	// authenticating with Vault's Kubernetes auth method.
+	vaultServiceAccountTokenPath = "/var/run/secrets/kubernetes.io/serviceaccount/token"
+
+	vaultHTTPClient = &http.Client{Timeout: 30 * time.Second}
+)
+
+// vaultCache keeps the tokens and secrets fetched from Vault during a session, so that a secret
+// referred to more than once (e.g., several keys of the same secret) is fetched only once.
+type vaultCache struct {
+	tokens  map[string]string
+	secrets map[string]map[string]interface{}
+}
+
+// resolveVaultRef fetches the value of the key given from a secret in Vault.
+func (sess *reconcileStackSession) resolveVaultRef(ctx context.Context, sel *shared.VaultSelector) (string, error) {
+	if sel.Address == "" || sel.Path == "" || sel.Key == "" {
+		return "", errors.New("vault reference needs an address, a path and a key")
+	}
+	if sess.vault == nil {
+		sess.vault = &vaultCache{tokens: map[string]string{}, secrets: map[string]map[string]interface{}{}}
+	}
+
+	secretKey := strings.Join([]string{sel.Address, sel.Namespace, sel.Path}, "|")
+	data, ok := sess.vault.secrets[secretKey]
+	if !ok {
+		token, err := sess.vaultToken(ctx, sel)
+		if err != nil {
+			return "", fmt.Errorf("authenticating with Vault at %s: %w", sel.Address, err)
+		}
+		data, err = readVaultSecret(ctx, sel, token)
+		if err != nil {
+			return "", fmt.Errorf("reading Vault secret %q: %w", sel.Path, err)
+		}
+		sess.vault.secrets[secretKey] = data
+	}
+
+	value, ok := data[sel.Key]
+	if !ok {
+		return "", fmt.Errorf("no key %q found in Vault secret %q", sel.Key, sel.Path)
+	}
+	if s, ok := value.(string); ok {
+		return s, nil
+	}
+	raw, err := json.Marshal(value)
+	if err != nil {
+		return "", fmt.Errorf("encoding key %q of Vault secret %q: %w", sel.Key, sel.Path, err)
+	}
+	return string(raw), nil
+}
+
+// vaultToken returns a Vault token, using the auth method given in the selector.
+func (sess *reconcileStackSession) vaultToken(ctx context.Context, sel *shared.VaultSelector) (string, error) {
+	auth := sel.Auth
+	var tokenKey string
+	switch {
+	case auth.TokenSecretRef != nil && auth.Kubernetes == nil:
+		tokenKey = fmt.Sprintf("%s|%s|token|%s/%s/%s", sel.Address, sel.Namespace,
+			auth.TokenSecretRef.Namespace, auth.TokenSecretRef.Name, auth.TokenSecretRef.Key)
+	case auth.Kubernetes != nil && auth.TokenSecretRef == nil:
+		tokenKey = fmt.Sprintf("%s|%s|kubernetes|%s/%s", sel.Address, sel.Namespace,
+			auth.Kubernetes.MountPath, auth.Kubernetes.Role)
+	default:
+		return "", errors.New("exactly one of tokenSecretRef and kubernetes must be given for Vault auth")
+	}
+	if token, ok := sess.vault.tokens[tokenKey]; ok {
+		return token, nil
+	}
+
+	var token string
+	var err error
+	if auth.TokenSecretRef != nil {
+		token, err = sess.resolveResourceRef(ctx, &shared.ResourceRef{
+			SelectorType:     shared.ResourceSelectorSecret,
+			ResourceSelector: shared.ResourceSelector{SecretRef: auth.TokenSecretRef},
+		})
+		token = strings.TrimSpace(token)
+	} else {
+		token, err = vaultKubernetesLogin(ctx, sel)
+	}
+	if err != nil {
+		return "", err
+	}
+	sess.vault.tokens[tokenKey] = token
+	return token, nil
+}
+
+// vaultKubernetesLogin logs in to Vault with the Kubernetes auth method, using the operator's
+// service account token, and returns the client token.
+func vaultKubernetesLogin(ctx context.Context, sel *shared.VaultSelector) (string, error) {
+	jwt, err := os.ReadFile(vaultServiceAccountTokenPath)
+	if err != nil {
+		return "", fmt.Errorf("reading service account token: %w", err)
+	}
+	mount := sel.Auth.Kubernetes.MountPath
+	if mount == "" {
+		mount = defaultVaultKubernetesMountPath
+	}
+	body, err := json.Marshal(map[string]string{
+		"role": sel.Auth.Kubernetes.Role,
+		"jwt":  strings.TrimSpace(string(jwt)),
+	})
+	if err != nil {
+		return "", err
+	}
+
+	var resp struct {
+		Auth *struct {
+			ClientToken string `json:"client_token"`
+		} `json:"auth"`
+	}
+	path := "auth/" + strings.Trim(mount, "/") + "/login"
+	if err := vaultRequest(ctx, sel, http.MethodPost, path, "", body, &resp); err != nil {
+		return "", err
+	}
+	if resp.Auth == nil || resp.Auth.ClientToken == "" {
+		return "", errors.New("the login response has no client token")
+	}
+	return resp.Auth.ClientToken, nil
+}
+
+// readVaultSecret reads the secret at the path given. Both version 1 and version 2 of the KV
+// secrets engine are supported; for version 2, the path includes "data/" after the mount, and the
+// latest version of the secret is read.
+func readVaultSecret(ctx context.Context, sel *shared.VaultSelector, token string) (map[string]interface{}, error) {
+	var resp struct {
+		Data map[string]interface{} `json:"data"`
+	}
+	if err := vaultRequest(ctx, sel, http.MethodGet, strings.Trim(sel.Path, "/"), token, nil, &resp); err != nil {
+		return nil, err
+	}
+	if resp.Data == nil {
+		return nil, errors.New("the secret has no data")
+	}
+	// KV version 2 nests the secret's data, alongside its metadata.
+	if data, ok := resp.Data["data"].(map[string]interface{}); ok {
+		if _, ok := resp.Data["metadata"]; ok {
+			return data, nil
+		}
+	}
+	return resp.Data, nil
+}
+
+func vaultRequest(ctx context.Context, sel *shared.VaultSelector, method, path, token string, body []byte, into interface{}) error {
+	url := strings.TrimSuffix(sel.Address, "/") + "/v1/" + path
+	var reader io.Reader
+	if body != nil {
+		reader = bytes.NewReader(body)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, url, reader)
+	if err != nil {
+		return err
+	}
+	if token != "" {
+		req.Header.Set("X-Vault-Token", token)
+	}
+	if sel.Namespace != "" {
+		req.Header.Set("X-Vault-Namespace", sel.Namespace)
+	}
+	res, err := vaultHTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		// Vault gives the reasons for an error in the body; these don't include secret values.
+		var errResp struct {
+			Errors []string `json:"errors"`
+		}
+		if json.NewDecoder(res.Body).Decode(&errResp) == nil && len(errResp.Errors) > 0 {
+			return fmt.Errorf("%s: %s", res.Status, strings.Join(errResp.Errors, "; "))
+		}
+		return fmt.Errorf("unexpected status %s", res.Status)
+	}
+	return json.NewDecoder(res.Body).Decode(into)
+}
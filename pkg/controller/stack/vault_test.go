@@ -0,0 +1,162 @@
+// Copyright 2024, Pulumi Corporation.  All rights reserved.
+
+package stack
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/pulumi/pulumi-kubernetes-operator/pkg/apis/pulumi/shared"
+	"github.com/pulumi/pulumi-kubernetes-operator/pkg/logging"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+// fakeVault serves a KV version 2 secret at secret/data/pulumi and a KV version 1 secret at
+// kv/pulumi, to requests with the token "s.token", and logs in the role "operator" with the
+// Kubernetes auth method.
+func fakeVault(t *testing.T, reads *int) *httptest.Server {
+	writeJSON := func(w http.ResponseWriter, v interface{}) {
+		require.NoError(t, json.NewEncoder(w).Encode(v))
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v1/auth/kubernetes/login", func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]string
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+		if body["role"] != "operator" || body["jwt"] != "sa-token" {
+			w.WriteHeader(http.StatusForbidden)
+			writeJSON(w, map[string]interface{}{"errors": []string{"permission denied"}})
+			return
+		}
+		writeJSON(w, map[string]interface{}{"auth": map[string]interface{}{"client_token": "s.token"}})
+	})
+	secret := func(data map[string]interface{}) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			*reads++
+			if r.Header.Get("X-Vault-Token") != "s.token" {
+				w.WriteHeader(http.StatusForbidden)
+				writeJSON(w, map[string]interface{}{"errors": []string{"permission denied"}})
+				return
+			}
+			writeJSON(w, map[string]interface{}{"data": data})
+		}
+	}
+	mux.HandleFunc("/v1/secret/data/pulumi", secret(map[string]interface{}{
+		"data":     map[string]interface{}{"passphrase": "v2-passphrase", "port": 8080},
+		"metadata": map[string]interface{}{"version": 3},
+	}))
+	mux.HandleFunc("/v1/kv/pulumi", secret(map[string]interface{}{"passphrase": "v1-passphrase"}))
+	return httptest.NewServer(mux)
+}
+
+func TestResolveVaultRef(t *testing.T) {
+	reads := 0
+	server := fakeVault(t, &reads)
+	defer server.Close()
+
+	tokenFile := filepath.Join(t.TempDir(), "token")
+	require.NoError(t, os.WriteFile(tokenFile, []byte("sa-token\n"), 0600))
+	defer func(path string) { vaultServiceAccountTokenPath = path }(vaultServiceAccountTokenPath)
+	vaultServiceAccountTokenPath = tokenFile
+
+	tokenSecret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "vault-token", Namespace: namespace},
+		Data:       map[string][]byte{"token": []byte("s.token"), "wrong": []byte("s.wrong")},
+	}
+	client := fake.NewFakeClientWithScheme(scheme.Scheme, tokenSecret)
+	tokenAuth := shared.VaultAuth{TokenSecretRef: &shared.SecretSelector{Name: "vault-token", Key: "token"}}
+	kubernetesAuth := shared.VaultAuth{Kubernetes: &shared.VaultKubernetesAuth{Role: "operator"}}
+
+	for _, test := range []struct {
+		name     string
+		path     string
+		key      string
+		auth     shared.VaultAuth
+		expected string
+		err      string
+	}{
+		{
+			name:     "KV version 2 with a token",
+			path:     "secret/data/pulumi",
+			key:      "passphrase",
+			auth:     tokenAuth,
+			expected: "v2-passphrase",
+		},
+		{
+			name:     "KV version 1 with Kubernetes auth",
+			path:     "kv/pulumi",
+			key:      "passphrase",
+			auth:     kubernetesAuth,
+			expected: "v1-passphrase",
+		},
+		{
+			name:     "non-string value",
+			path:     "secret/data/pulumi",
+			key:      "port",
+			auth:     tokenAuth,
+			expected: "8080",
+		},
+		{
+			name: "missing key",
+			path: "secret/data/pulumi",
+			key:  "nope",
+			auth: tokenAuth,
+			err:  `no key "nope" found`,
+		},
+		{
+			name: "wrong token",
+			path: "secret/data/pulumi",
+			key:  "passphrase",
+			auth: shared.VaultAuth{TokenSecretRef: &shared.SecretSelector{Name: "vault-token", Key: "wrong"}},
+			err:  "permission denied",
+		},
+		{
+			name: "wrong role",
+			path: "secret/data/pulumi",
+			key:  "passphrase",
+			auth: shared.VaultAuth{Kubernetes: &shared.VaultKubernetesAuth{Role: "intruder"}},
+			err:  "permission denied",
+		},
+		{
+			name: "no auth",
+			path: "secret/data/pulumi",
+			key:  "passphrase",
+			err:  "exactly one of tokenSecretRef and kubernetes",
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			logger := logging.NewLogger(t.Name(), "Request.Test", "TestResolveVaultRef")
+			session := newReconcileStackSession(logger, shared.StackSpec{}, client, namespace)
+			ref := shared.NewVaultResourceRef(server.URL, test.path, test.key, test.auth)
+			value, err := session.resolveResourceRef(context.TODO(), &ref)
+			if test.err != "" {
+				assert.ErrorContains(t, err, test.err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, test.expected, value)
+		})
+	}
+
+	t.Run("secrets are cached for the session", func(t *testing.T) {
+		logger := logging.NewLogger(t.Name(), "Request.Test", "TestResolveVaultRef")
+		session := newReconcileStackSession(logger, shared.StackSpec{}, client, namespace)
+		reads = 0
+		for _, key := range []string{"passphrase", "port"} {
+			ref := shared.NewVaultResourceRef(server.URL, "secret/data/pulumi", key, tokenAuth)
+			_, err := session.resolveResourceRef(context.TODO(), &ref)
+			require.NoError(t, err)
+		}
+		assert.Equal(t, 1, reads)
+	})
+}
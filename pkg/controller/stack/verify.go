@@ -0,0 +1,187 @@
+// Copyright 2024, Pulumi Corporation.  All rights reserved.
+
+package stack
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/pulumi/pulumi-kubernetes-operator/pkg/apis/pulumi/shared"
+	pulumiv1 "github.com/pulumi/pulumi-kubernetes-operator/pkg/apis/pulumi/v1"
+)
+
+// Verification protocol:
+//
+// A stack can require that a prerequisite has verified its resources recently, by giving `verify:
+// Refresh` in the prerequisite's requirement. If the prerequisite has no verification recorded in
+// its status within the window given, the dependent stack annotates it with
+// shared.VerifyRequestAnnotation (and shared.ReconcileRequestAnnotation, to queue it), and waits.
+// When the prerequisite is next processed, it refreshes its state, and records in
+// .status.verification which resources (if any) were found to have been deleted. The change to
+// its status queues the dependent stack, which then proceeds if the verification passed. Since the
+// verification is kept on the prerequisite, all the stacks depending on it share it, and it's
+// requested at most once per window. Within the operator, verificationCoordinator makes sure that
+// stacks checking the same prerequisite at about the same time don't each ask for a verification.
+
+// defaultVerifyWithin is how recent a verification must be, if not given in the requirement.
+const defaultVerifyWithin = 10 * time.Minute
+
+var (
+	errVerificationPending = errors.New("prerequisite has not verified its resources recently")
+	errVerificationFailed  = errors.New("prerequisite failed verification")
+)
+
+// checkVerification checks whether the prerequisite given satisfies the verification part of the
+// requirement. If it doesn't, an error is returned, along with whether the prerequisite should be
+// asked to verify its resources, or else how long to wait before asking.
+func checkVerification(req *shared.RequirementSpec, prereq *pulumiv1.Stack, now time.Time) (bool, time.Duration, error) {
+	if req == nil || req.Verify != shared.VerifyRefresh {
+		return false, 0, nil
+	}
+	window := defaultVerifyWithin
+	if req.VerifyWithinDuration != nil {
+		window = req.VerifyWithinDuration.Duration
+	}
+
+	v := prereq.Status.Verification
+	if v != nil && now.Sub(v.Time.Time) <= window {
+		if verificationPassedFor(v, req.VerifyOutputs) {
+			return false, 0, nil
+		}
+		// The failure stands until the window has passed, so that the prerequisite isn't asked to
+		// verify its resources over and over.
+		return false, window - now.Sub(v.Time.Time), fmt.Errorf("%w: %s", errVerificationFailed, v.Message)
+	}
+	if _, pending := verificationRequested(prereq); pending {
+		return false, 0, errVerificationPending
+	}
+	return true, 0, errVerificationPending
+}
+
+// verificationPassedFor reports whether the verification found none of the resources behind the
+// outputs given deleted, or none at all if no outputs are given.
+func verificationPassedFor(v *pulumiv1.StackVerificationState, outputs []string) bool {
+	if v.Passed {
+		return true
+	}
+	if len(outputs) == 0 || v.DeletedResources == 0 {
+		// either everything is relied on, or the verification couldn't be done
+		return false
+	}
+	for _, drifted := range v.DriftedOutputs {
+		if contains(outputs, drifted) {
+			return false
+		}
+	}
+	return true
+}
+
+// verificationRequested returns the value of the verification request annotation, and true, if
+// there's a request which hasn't been acted on.
+func verificationRequested(instance *pulumiv1.Stack) (string, bool) {
+	request, ok := instance.GetAnnotations()[shared.VerifyRequestAnnotation]
+	if !ok {
+		return "", false
+	}
+	if v := instance.Status.Verification; v != nil && v.Request == request {
+		return "", false
+	}
+	return request, true
+}
+
+// verifyResources refreshes the stack's state, and records in the status whether any resources
+// were found to have been deleted out of band. This does not change any resources.
+func (sess *reconcileStackSession) verifyResources(ctx context.Context, instance *pulumiv1.Stack, request string) *pulumiv1.StackVerificationState {
+	v := &pulumiv1.StackVerificationState{Request: request}
+	instance.Status.Verification = v
+
+	before, err := sess.stateResources(ctx)
+	if err == nil {
+		_, err = sess.RefreshStack(ctx, false, nil)
+	}
+	var after []stateResource
+	if err == nil {
+		after, err = sess.stateResources(ctx)
+	}
+	v.Time = metav1.Now()
+	if err != nil {
+		v.Message = fmt.Sprintf("unable to verify resources: %v", err)
+		return v
+	}
+
+	deleted := deletedResources(before, after)
+	v.DeletedResources = int32(len(deleted))
+	v.DriftedOutputs = driftedOutputs(instance.Status.Outputs, deleted)
+	v.Passed = len(deleted) == 0
+	if v.Passed {
+		v.Message = fmt.Sprintf("verified %d resources", len(after))
+	} else {
+		v.Message = fmt.Sprintf("%d resources have been deleted out of band", len(deleted))
+	}
+	return v
+}
+
+// deletedResources returns the resources in the state before a refresh which are missing after.
+func deletedResources(before, after []stateResource) []stateResource {
+	remaining := map[string]bool{}
+	for _, r := range after {
+		remaining[r.URN] = true
+	}
+	var deleted []stateResource
+	for _, r := range before {
+		if !remaining[r.URN] {
+			deleted = append(deleted, r)
+		}
+	}
+	return deleted
+}
+
+// driftedOutputs returns the names of the outputs which include the ID of a deleted resource, in
+// order.
+func driftedOutputs(outputs shared.StackOutputs, deleted []stateResource) []string {
+	ids := map[string]bool{}
+	for _, r := range deleted {
+		if r.ID != "" {
+			ids[r.ID] = true
+		}
+	}
+	var names []string
+	for name, raw := range outputs {
+		var value interface{}
+		if err := json.Unmarshal(raw.Raw, &value); err != nil {
+			continue
+		}
+		if includesAny(value, ids) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// includesAny reports whether any of the strings in the JSON value given is in the set.
+func includesAny(value interface{}, set map[string]bool) bool {
+	switch v := value.(type) {
+	case string:
+		return set[v]
+	case []interface{}:
+		for _, item := range v {
+			if includesAny(item, set) {
+				return true
+			}
+		}
+	case map[string]interface{}:
+		for _, item := range v {
+			if includesAny(item, set) {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,129 @@
+// Copyright 2024, Pulumi Corporation.  All rights reserved.
+
+package stack
+
+import (
+	"sync"
+	"time"
+
+	"k8s.io/apimachinery/pkg/types"
+
+	"github.com/pulumi/pulumi-kubernetes-operator/pkg/apis/pulumi/shared"
+	pulumiv1 "github.com/pulumi/pulumi-kubernetes-operator/pkg/apis/pulumi/v1"
+)
+
+// verificationRequestTimeout is how long a request for a prerequisite to verify its resources is
+// waited on before another dependent stack may make it again; e.g., if the prerequisite is busy
+// with a long update.
+const verificationRequestTimeout = defaultVerifyWithin
+
+// verificationCoordinator coordinates, within this process, the verifications which the stacks
+// depending on a prerequisite ask of it (see verify.go). Without it, many dependent stacks
+// processed at about the same time could each see no verification pending -- e.g., if their view
+// of the prerequisite is out of date -- and each ask for one, which would have the prerequisite
+// refresh its state over and over. With it, per prerequisite:
+//
+//   - at most one verification is requested at a time, and none while one is running;
+//   - the outcome of the last verification is kept, so dependent stacks which haven't yet seen
+//     it in the prerequisite's status use it rather than asking again.
+//
+// The outcome is also recorded in the prerequisite's status, which is what counts after a
+// restart. A nil *verificationCoordinator goes by the status alone.
+type verificationCoordinator struct {
+	mu     sync.Mutex
+	stacks map[types.NamespacedName]*stackVerifications
+}
+
+// stackVerifications is what's known about the verification of one stack.
+type stackVerifications struct {
+	// requested is when a dependent stack last asked for a verification, or zero if there's no
+	// request outstanding.
+	requested time.Time
+	// running is true while the stack is verifying its resources.
+	running bool
+	// last is the outcome of the last verification done by this process.
+	last *pulumiv1.StackVerificationState
+}
+
+func newVerificationCoordinator() *verificationCoordinator {
+	return &verificationCoordinator{stacks: map[types.NamespacedName]*stackVerifications{}}
+}
+
+func (c *verificationCoordinator) get(key types.NamespacedName) *stackVerifications {
+	s, ok := c.stacks[key]
+	if !ok {
+		s = &stackVerifications{}
+		c.stacks[key] = s
+	}
+	return s
+}
+
+// check is checkVerification, taking into account verifications which are running or have been
+// requested, and outcomes not yet seen in the prerequisite's status. If it returns true, the
+// caller is expected to ask the prerequisite to verify its resources, and to call withdraw if
+// that fails.
+func (c *verificationCoordinator) check(req *shared.RequirementSpec, prereq *pulumiv1.Stack, now time.Time) (bool, time.Duration, error) {
+	if c == nil {
+		return checkVerification(req, prereq, now)
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	s := c.get(types.NamespacedName{Namespace: prereq.Namespace, Name: prereq.Name})
+
+	if s.last != nil && (prereq.Status.Verification == nil || s.last.Time.After(prereq.Status.Verification.Time.Time)) {
+		prereq = prereq.DeepCopy()
+		prereq.Status.Verification = s.last.DeepCopy()
+	}
+	request, retryAfter, err := checkVerification(req, prereq, now)
+	if !request {
+		return false, retryAfter, err
+	}
+	if s.running || (!s.requested.IsZero() && now.Sub(s.requested) < verificationRequestTimeout) {
+		return false, 0, err
+	}
+	s.requested = now
+	return true, 0, err
+}
+
+// withdraw forgets a request made for the stack given, e.g., because annotating the stack failed.
+func (c *verificationCoordinator) withdraw(key types.NamespacedName) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.get(key).requested = time.Time{}
+}
+
+// begin notes that the stack given has started verifying its resources.
+func (c *verificationCoordinator) begin(key types.NamespacedName) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.get(key).running = true
+}
+
+// finish records the outcome of the stack's verification, which answers any request outstanding.
+func (c *verificationCoordinator) finish(key types.NamespacedName, v *pulumiv1.StackVerificationState) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	s := c.get(key)
+	s.running = false
+	s.requested = time.Time{}
+	s.last = v.DeepCopy()
+}
+
+// forget drops what's known about the stack given, once it has been deleted.
+func (c *verificationCoordinator) forget(key types.NamespacedName) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.stacks, key)
+}
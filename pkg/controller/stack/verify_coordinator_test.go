@@ -0,0 +1,75 @@
+// Copyright 2024, Pulumi Corporation.  All rights reserved.
+
+package stack
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+
+	"github.com/pulumi/pulumi-kubernetes-operator/pkg/apis/pulumi/shared"
+	pulumiv1 "github.com/pulumi/pulumi-kubernetes-operator/pkg/apis/pulumi/v1"
+)
+
+func TestVerificationCoordinator(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	req := &shared.RequirementSpec{Verify: shared.VerifyRefresh}
+	key := types.NamespacedName{Namespace: namespace, Name: "network"}
+	producer := &pulumiv1.Stack{ObjectMeta: metav1.ObjectMeta{Namespace: key.Namespace, Name: key.Name}}
+	c := newVerificationCoordinator()
+
+	// many dependents check the producer as it is in the cache, without the annotation made by
+	// the first; only the first asks for a verification
+	request, _, err := c.check(req, producer, now)
+	assert.ErrorIs(t, err, errVerificationPending)
+	assert.True(t, request, "first dependent asks")
+	for i := 0; i < 50; i++ {
+		request, _, err = c.check(req, producer, now.Add(time.Second))
+		assert.ErrorIs(t, err, errVerificationPending)
+		assert.False(t, request, "others wait")
+	}
+
+	// a request that couldn't be made can be made by another dependent
+	c.withdraw(key)
+	request, _, _ = c.check(req, producer, now)
+	assert.True(t, request, "asked again once withdrawn")
+
+	// nobody asks while the verification is running
+	c.begin(key)
+	request, _, err = c.check(req, producer, now.Add(verificationRequestTimeout))
+	assert.ErrorIs(t, err, errVerificationPending)
+	assert.False(t, request, "verification is running")
+
+	// the outcome is used before the producer's status shows it
+	c.finish(key, &pulumiv1.StackVerificationState{Request: "req-1", Time: metav1.NewTime(now), Passed: true})
+	request, _, err = c.check(req, producer, now.Add(time.Minute))
+	assert.NoError(t, err, "verified")
+	assert.False(t, request)
+
+	// ... or if it shows an older one
+	producer.Status.Verification = &pulumiv1.StackVerificationState{Request: "req-0", Time: metav1.NewTime(now.Add(-time.Hour))}
+	_, _, err = c.check(req, producer, now.Add(time.Minute))
+	assert.NoError(t, err, "verified")
+
+	// once the outcome is too old, one dependent asks again
+	request, _, _ = c.check(req, producer, now.Add(defaultVerifyWithin+time.Minute))
+	assert.True(t, request, "verification too old")
+	request, _, _ = c.check(req, producer, now.Add(defaultVerifyWithin+time.Minute))
+	assert.False(t, request, "already asked")
+
+	// a request not answered in time may be made again
+	request, _, _ = c.check(req, producer, now.Add(defaultVerifyWithin+time.Minute+verificationRequestTimeout))
+	assert.True(t, request, "request timed out")
+
+	// without a coordinator, the status alone counts
+	var none *verificationCoordinator
+	request, _, err = none.check(req, &pulumiv1.Stack{}, now)
+	assert.ErrorIs(t, err, errVerificationPending)
+	assert.True(t, request)
+	none.begin(key)
+	none.finish(key, &pulumiv1.StackVerificationState{})
+	none.forget(key)
+}
@@ -0,0 +1,89 @@
+// Copyright 2024, Pulumi Corporation.  All rights reserved.
+
+package stack
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/pulumi/pulumi-kubernetes-operator/pkg/apis/pulumi/shared"
+	pulumiv1 "github.com/pulumi/pulumi-kubernetes-operator/pkg/apis/pulumi/v1"
+)
+
+func TestCheckVerification(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	req := &shared.RequirementSpec{Verify: shared.VerifyRefresh}
+
+	stack := &pulumiv1.Stack{}
+	request, _, err := checkVerification(&shared.RequirementSpec{}, stack, now)
+	assert.NoError(t, err, "no verification required")
+	assert.False(t, request)
+
+	request, _, err = checkVerification(req, stack, now)
+	assert.ErrorIs(t, err, errVerificationPending)
+	assert.True(t, request, "never verified")
+
+	stack.Annotations = map[string]string{shared.VerifyRequestAnnotation: "req-1"}
+	request, _, err = checkVerification(req, stack, now)
+	assert.ErrorIs(t, err, errVerificationPending)
+	assert.False(t, request, "already requested")
+
+	stack.Status.Verification = &pulumiv1.StackVerificationState{
+		Request: "req-1",
+		Time:    metav1.NewTime(now.Add(-time.Minute)),
+		Passed:  true,
+	}
+	_, _, err = checkVerification(req, stack, now)
+	assert.NoError(t, err, "recently verified")
+
+	request, _, err = checkVerification(req, stack, now.Add(defaultVerifyWithin))
+	assert.ErrorIs(t, err, errVerificationPending)
+	assert.True(t, request, "verification too old")
+
+	req5m := &shared.RequirementSpec{Verify: shared.VerifyRefresh, VerifyWithinDuration: &metav1.Duration{Duration: 5 * time.Minute}}
+	_, _, err = checkVerification(req5m, stack, now.Add(5*time.Minute))
+	assert.ErrorIs(t, err, errVerificationPending, "verification older than given window")
+
+	stack.Status.Verification = &pulumiv1.StackVerificationState{
+		Request:          "req-1",
+		Time:             metav1.NewTime(now.Add(-time.Minute)),
+		DeletedResources: 1,
+		DriftedOutputs:   []string{"bucket"},
+	}
+	request, retryAfter, err := checkVerification(req, stack, now)
+	assert.ErrorIs(t, err, errVerificationFailed)
+	assert.False(t, request, "not asked again within the window")
+	assert.Equal(t, defaultVerifyWithin-time.Minute, retryAfter)
+
+	_, _, err = checkVerification(&shared.RequirementSpec{Verify: shared.VerifyRefresh, VerifyOutputs: []string{"bucket"}}, stack, now)
+	assert.ErrorIs(t, err, errVerificationFailed, "referenced output drifted")
+	_, _, err = checkVerification(&shared.RequirementSpec{Verify: shared.VerifyRefresh, VerifyOutputs: []string{"queue"}}, stack, now)
+	assert.NoError(t, err, "only unreferenced outputs drifted")
+
+	stack.Status.Verification = &pulumiv1.StackVerificationState{Request: "req-1", Time: metav1.NewTime(now), Message: "unable to verify"}
+	_, _, err = checkVerification(&shared.RequirementSpec{Verify: shared.VerifyRefresh, VerifyOutputs: []string{"queue"}}, stack, now)
+	assert.ErrorIs(t, err, errVerificationFailed, "verification could not be done")
+}
+
+func TestDriftedOutputs(t *testing.T) {
+	before := []stateResource{
+		{URN: "urn:bucket", ID: "bucket-1234"},
+		{URN: "urn:queue", ID: "queue-5678"},
+		{URN: "urn:topic", ID: "topic-9"},
+	}
+	after := []stateResource{{URN: "urn:queue", ID: "queue-5678"}}
+	deleted := deletedResources(before, after)
+	assert.Len(t, deleted, 2)
+
+	outputs := shared.StackOutputs{
+		"bucketName": apiextensionsv1.JSON{Raw: []byte(`"bucket-1234"`)},
+		"queueName":  apiextensionsv1.JSON{Raw: []byte(`"queue-5678"`)},
+		"nested":     apiextensionsv1.JSON{Raw: []byte(`{"topics": ["topic-9"]}`)},
+		"count":      apiextensionsv1.JSON{Raw: []byte(`3`)},
+	}
+	assert.Equal(t, []string{"bucketName", "nested"}, driftedOutputs(outputs, deleted))
+}
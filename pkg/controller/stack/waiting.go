@@ -0,0 +1,78 @@
+// Copyright 2024, Pulumi Corporation.  All rights reserved.
+
+package stack
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	pulumiv1 "github.com/pulumi/pulumi-kubernetes-operator/pkg/apis/pulumi/v1"
+)
+
+const (
+	// EnvInitialReconcileDelaySeconds is the name of the environment entry giving the default for
+	// a stack's initialReconcileDelaySeconds.
+	EnvInitialReconcileDelaySeconds = "INITIAL_RECONCILE_DELAY_SECONDS"
+
+	// waitForReferencesInterval is how long to wait before checking again for objects a stack
+	// refers to which don't exist yet.
+	waitForReferencesInterval = 15 * time.Second
+)
+
+func getDefaultInitialReconcileDelay() (time.Duration, error) {
+	raw, ok := os.LookupEnv(EnvInitialReconcileDelaySeconds)
+	if !ok {
+		return 0, nil
+	}
+	seconds, err := strconv.ParseInt(raw, 10, 64)
+	if err != nil || seconds < 0 {
+		return 0, fmt.Errorf("%s must be a non-negative number of seconds, but got %q", EnvInitialReconcileDelaySeconds, raw)
+	}
+	return time.Duration(seconds) * time.Second, nil
+}
+
+// initialReconcileDelay returns how much longer a new stack should wait before it is first run,
+// or zero if it can be run now. A stack is new until its first update has been attempted.
+func initialReconcileDelay(instance *pulumiv1.Stack, defaultDelay time.Duration, now time.Time) time.Duration {
+	if instance.Status.LastUpdate != nil {
+		return 0
+	}
+	delay := defaultDelay
+	if instance.Spec.InitialReconcileDelaySeconds != nil {
+		delay = time.Duration(*instance.Spec.InitialReconcileDelaySeconds) * time.Second
+	}
+	remaining := instance.CreationTimestamp.Add(delay).Sub(now)
+	if remaining < 0 {
+		return 0
+	}
+	return remaining
+}
+
+// errWaitingForDependency marks the error when another Stack whose outputs are used hasn't
+// produced them yet.
+var errWaitingForDependency = errors.New("waiting for Stack outputs")
+
+// isMissingReference reports whether err was caused by an object the stack refers to (e.g., a
+// Secret given in envRefs) not existing, or a Stack whose outputs it uses not having produced them.
+func isMissingReference(err error) bool {
+	return k8serrors.IsNotFound(err) || errors.Is(err, errWaitingForDependency)
+}
+
+// waitForReferences marks the stack as waiting for an object it refers to, which doesn't exist
+// yet. This is not treated as a failure, since the object may be on its way (e.g., it is created
+// in the same apply as the stack); instead, the stack is checked again after a short interval.
+func waitForReferences(sess *reconcileStackSession, instance *pulumiv1.Stack, err error) reconcile.Result {
+	sess.logger.Info("Waiting for object referred to by stack", "Stack.Name", sess.stack.Stack, "Reason", err.Error())
+	reason := pulumiv1.ReconcilingWaitingForReferencesReason
+	if errors.Is(err, errWaitingForDependency) {
+		reason = pulumiv1.ReconcilingWaitingForDependencyReason
+	}
+	instance.Status.MarkReconcilingCondition(reason, err.Error())
+	return reconcile.Result{RequeueAfter: waitForReferencesInterval}
+}
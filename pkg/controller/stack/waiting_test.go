@@ -0,0 +1,98 @@
+// Copyright 2024, Pulumi Corporation.  All rights reserved.
+
+package stack
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/pulumi/pulumi-kubernetes-operator/pkg/apis/pulumi/shared"
+	pulumiv1 "github.com/pulumi/pulumi-kubernetes-operator/pkg/apis/pulumi/v1"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+func TestInitialReconcileDelay(t *testing.T) {
+	created := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	seconds := func(s int64) *int64 { return &s }
+
+	for _, test := range []struct {
+		name         string
+		delaySeconds *int64
+		defaultDelay time.Duration
+		lastUpdate   *shared.StackUpdateState
+		now          time.Time
+		expected     time.Duration
+	}{
+		{
+			name:     "no delay",
+			now:      created,
+			expected: 0,
+		},
+		{
+			name:         "delay from spec",
+			delaySeconds: seconds(30),
+			now:          created.Add(10 * time.Second),
+			expected:     20 * time.Second,
+		},
+		{
+			name:         "operator default",
+			defaultDelay: 30 * time.Second,
+			now:          created.Add(10 * time.Second),
+			expected:     20 * time.Second,
+		},
+		{
+			name:         "spec overrides operator default",
+			delaySeconds: seconds(0),
+			defaultDelay: 30 * time.Second,
+			now:          created.Add(10 * time.Second),
+			expected:     0,
+		},
+		{
+			name:         "delay has passed",
+			delaySeconds: seconds(30),
+			now:          created.Add(time.Minute),
+			expected:     0,
+		},
+		{
+			name:         "not a new stack",
+			delaySeconds: seconds(30),
+			lastUpdate:   &shared.StackUpdateState{State: shared.FailedStackStateMessage},
+			now:          created.Add(10 * time.Second),
+			expected:     0,
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			instance := &pulumiv1.Stack{
+				ObjectMeta: metav1.ObjectMeta{CreationTimestamp: metav1.NewTime(created)},
+				Spec:       shared.StackSpec{InitialReconcileDelaySeconds: test.delaySeconds},
+				Status:     pulumiv1.StackStatus{LastUpdate: test.lastUpdate},
+			}
+			assert.Equal(t, test.expected, initialReconcileDelay(instance, test.defaultDelay, test.now))
+		})
+	}
+}
+
+func TestGetDefaultInitialReconcileDelay(t *testing.T) {
+	t.Setenv(EnvInitialReconcileDelaySeconds, "45")
+	delay, err := getDefaultInitialReconcileDelay()
+	require.NoError(t, err)
+	assert.Equal(t, 45*time.Second, delay)
+
+	t.Setenv(EnvInitialReconcileDelaySeconds, "45s")
+	_, err = getDefaultInitialReconcileDelay()
+	assert.Error(t, err)
+}
+
+func TestIsMissingReference(t *testing.T) {
+	notFound := k8serrors.NewNotFound(schema.GroupResource{Resource: "secrets"}, "git-auth")
+	assert.True(t, isMissingReference(fmt.Errorf("resolving gitAuth personal access token: %w", notFound)))
+	assert.False(t, isMissingReference(fmt.Errorf("resolving gitAuth personal access token: %w", errNamespaceIsolation)))
+	assert.False(t, isMissingReference(errProgramNotFound))
+	assert.True(t, isMissingReference(fmt.Errorf("%w: Stack test/network has no outputs yet", errWaitingForDependency)))
+}
@@ -0,0 +1,231 @@
+// Copyright 2024, Pulumi Corporation.  All rights reserved.
+
+package stack
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/pulumi/pulumi-kubernetes-operator/pkg/apis/pulumi/shared"
+	pulumiv1 "github.com/pulumi/pulumi-kubernetes-operator/pkg/apis/pulumi/v1"
+)
+
+const (
+	workspaceCacheDirName    = "workspace-cache"
+	workspaceCacheRecordName = "workspace-cache.json"
+)
+
+// workspaceCacheRecord describes the workspace kept from the last successful run of a stack. It
+// is used to decide whether a later run can reuse the workspace as-is, rather than fetching the
+// source and installing dependencies again.
+type workspaceCacheRecord struct {
+	// Revision is the source revision checked out in the workspace.
+	Revision string `json:"revision"`
+	// SourceFingerprint is a hash of the stack spec, excluding configuration and secrets.
+	SourceFingerprint string `json:"sourceFingerprint"`
+	// ProjectPath is the path of the project within the workspace.
+	ProjectPath string `json:"projectPath"`
+	// ConfigKeys are the configuration keys that had been applied to the workspace.
+	ConfigKeys []string `json:"configKeys"`
+}
+
+// sourceFingerprint hashes everything in the stack spec that isn't configuration or secrets, so
+// that a change to only those can be recognised.
+func sourceFingerprint(spec shared.StackSpec) (string, error) {
+	spec.Config = nil
+	spec.ConfigValues = nil
+	spec.Secrets = nil
+	spec.SecretRefs = nil
+	b, err := json.Marshal(spec)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// configKeys returns the set of configuration keys supplied by the stack spec.
+func configKeys(spec shared.StackSpec) []string {
+	var keys []string
+	for k := range spec.Config {
+		keys = append(keys, k)
+	}
+	for k := range spec.ConfigValues {
+		keys = append(keys, k)
+	}
+	for k := range spec.Secrets {
+		keys = append(keys, k)
+	}
+	for k := range spec.SecretRefs {
+		keys = append(keys, k)
+	}
+	return keys
+}
+
+// expectedRevision returns the revision the stack source will resolve to, if that can be
+// determined without fetching the source. Sources which track a moving target (e.g., a branch)
+// are reported as unknown.
+func (sess *reconcileStackSession) expectedRevision(ctx context.Context) (string, bool, error) {
+	switch {
+	case sess.stack.GitSource != nil && sess.stack.GitSource.ProjectArchiveURL != "":
+		if sess.stack.GitSource.ArchiveSHA256 == "" {
+			return "", false, nil
+		}
+		return archiveRevision(sess.stack.GitSource.ArchiveSHA256), true, nil
+	case sess.stack.GitSource != nil:
+		if sess.stack.GitSource.Branch != "" || sess.stack.GitSource.Commit == "" {
+			return "", false, nil
+		}
+		return sess.stack.GitSource.Commit, true, nil
+	case sess.stack.ProgramRef != nil:
+		var program pulumiv1.Program
+		key := client.ObjectKey{Name: sess.stack.ProgramRef.Name, Namespace: sess.namespace}
+		if err := sess.kubeClient.Get(ctx, key, &program); err != nil {
+			return "", false, err
+		}
+		return fmt.Sprintf("%s/%d", program.Name, program.ObjectMeta.Generation), true, nil
+	case sess.stack.ProgramFrom != nil:
+		cm, err := sess.getProgramConfigMap(ctx, sess.stack.ProgramFrom)
+		if err != nil {
+			return "", false, err
+		}
+		return configMapRevision(cm), true, nil
+	}
+	return "", false, nil
+}
+
+func (sess *reconcileStackSession) getWorkspaceCacheDir() string {
+	return filepath.Join(sess.rootDir, workspaceCacheDirName)
+}
+
+func (sess *reconcileStackSession) getWorkspaceCacheRecordPath() string {
+	return filepath.Join(sess.rootDir, workspaceCacheRecordName)
+}
+
+// dropWorkspaceCache removes any cached workspace.
+func (sess *reconcileStackSession) dropWorkspaceCache() {
+	if sess.rootDir == "" {
+		return
+	}
+	if err := os.Remove(sess.getWorkspaceCacheRecordPath()); err != nil && !os.IsNotExist(err) {
+		sess.logger.Error(err, "Failed to delete workspace cache record")
+	}
+	if err := os.RemoveAll(sess.getWorkspaceCacheDir()); err != nil {
+		sess.logger.Error(err, "Failed to delete cached workspace")
+	}
+}
+
+// SaveWorkspaceCache keeps the workspace used for a successful run, so that a subsequent change to
+// only the configuration of the stack can reuse it.
+func (sess *reconcileStackSession) SaveWorkspaceCache(revision string) error {
+	sess.dropWorkspaceCache()
+	if sess.workdir == "" {
+		return errors.New("no workspace to cache")
+	}
+	// A patched workspace isn't kept, so that patches are always applied to the source as fetched;
+	// nor is any workspace when the stack says not to.
+	if len(sess.stack.Patches) > 0 || !persistWorkspace(&sess.stack) {
+		return nil
+	}
+
+	fingerprint, err := sourceFingerprint(sess.stack)
+	if err != nil {
+		return err
+	}
+	projectPath, err := filepath.Rel(sess.getWorkspaceDir(), sess.workdir)
+	if err != nil {
+		return err
+	}
+	record, err := json.Marshal(workspaceCacheRecord{
+		Revision:          revision,
+		SourceFingerprint: fingerprint,
+		ProjectPath:       projectPath,
+		ConfigKeys:        configKeys(sess.stack),
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := os.Rename(sess.getWorkspaceDir(), sess.getWorkspaceCacheDir()); err != nil {
+		return fmt.Errorf("moving workspace to cache: %w", err)
+	}
+	if err := os.WriteFile(sess.getWorkspaceCacheRecordPath(), record, 0600); err != nil {
+		sess.dropWorkspaceCache()
+		return fmt.Errorf("writing workspace cache record: %w", err)
+	}
+	return nil
+}
+
+// SetupWorkdirFromCache sets up the workspace from the one cached by the last successful run, if
+// the only differences since then are in the stack's configuration. It returns the revision of the
+// source in the workspace, or an empty string if the cached workspace cannot be used.
+func (sess *reconcileStackSession) SetupWorkdirFromCache(ctx context.Context) (string, error) {
+	b, err := os.ReadFile(sess.getWorkspaceCacheRecordPath())
+	if os.IsNotExist(err) {
+		return "", nil
+	} else if err != nil {
+		return "", err
+	}
+	// Whatever happens from here, the cache is either used or no longer useful; though if it's a
+	// git workspace, it can still be brought up to date rather than cloned afresh.
+	defer func() {
+		sess.retainWorkdir(sess.getWorkspaceCacheDir())
+		sess.dropWorkspaceCache()
+	}()
+
+	var record workspaceCacheRecord
+	if err := json.Unmarshal(b, &record); err != nil {
+		return "", fmt.Errorf("reading workspace cache record: %w", err)
+	}
+
+	fingerprint, err := sourceFingerprint(sess.stack)
+	if err != nil {
+		return "", err
+	}
+	if fingerprint != record.SourceFingerprint {
+		sess.logger.Debug("Stack source or options changed; not reusing cached workspace")
+		return "", nil
+	}
+	revision, known, err := sess.expectedRevision(ctx)
+	if err != nil || !known || revision != record.Revision {
+		sess.logger.Debug("Source revision unknown or changed; not reusing cached workspace")
+		return "", nil
+	}
+	// Removing a config key can't be undone in place, since the workspace had the value
+	// written into its stack settings.
+	current := configKeys(sess.stack)
+	for _, k := range record.ConfigKeys {
+		if !contains(current, k) {
+			sess.logger.Debug("Config key removed; not reusing cached workspace", "key", k)
+			return "", nil
+		}
+	}
+
+	workspaceDir := sess.getWorkspaceDir()
+	if err := os.RemoveAll(workspaceDir); err != nil {
+		return "", err
+	}
+	if err := os.Rename(sess.getWorkspaceCacheDir(), workspaceDir); err != nil {
+		return "", fmt.Errorf("restoring cached workspace: %w", err)
+	}
+
+	w, err := sess.newWorkspace(ctx, filepath.Join(workspaceDir, record.ProjectPath))
+	if err != nil {
+		return "", fmt.Errorf("failed to create local workspace: %w", err)
+	}
+
+	sess.reusedWorkspace = true
+	if err := sess.setupWorkspace(ctx, w); err != nil {
+		sess.reusedWorkspace = false
+		return "", err
+	}
+	return revision, nil
+}
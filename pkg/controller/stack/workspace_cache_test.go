@@ -0,0 +1,105 @@
+// Copyright 2024, Pulumi Corporation.  All rights reserved.
+
+package stack
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	"github.com/pulumi/pulumi-kubernetes-operator/pkg/apis/pulumi/shared"
+	"github.com/pulumi/pulumi-kubernetes-operator/pkg/logging"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestSourceFingerprint(t *testing.T) {
+	base := shared.StackSpec{
+		Stack:  "dev",
+		Config: map[string]string{"aws:region": "us-east-1"},
+		GitSource: &shared.GitSource{
+			ProjectRepo: "https://github.com/pulumi/examples",
+			Commit:      "abc123",
+		},
+	}
+	fp, err := sourceFingerprint(base)
+	require.NoError(t, err)
+
+	configOnly := *base.DeepCopy()
+	configOnly.Config = map[string]string{"aws:region": "us-west-2"}
+	configOnly.Secrets = map[string]string{"password": "hunter2"}
+	fp2, err := sourceFingerprint(configOnly)
+	require.NoError(t, err)
+	assert.Equal(t, fp, fp2, "config and secrets changes should not change the fingerprint")
+
+	sourceChanged := *base.DeepCopy()
+	sourceChanged.GitSource.Commit = "def456"
+	fp3, err := sourceFingerprint(sourceChanged)
+	require.NoError(t, err)
+	assert.NotEqual(t, fp, fp3, "a source change should change the fingerprint")
+
+	assert.Equal(t, map[string]string{"aws:region": "us-east-1"}, base.Config, "the spec should not be modified")
+}
+
+func TestSetupWorkdirFromCacheFallsBack(t *testing.T) {
+	logger := logging.NewLogger(t.Name(), "Request.Test", "TestSetupWorkdirFromCacheFallsBack")
+	client := fake.NewFakeClientWithScheme(scheme.Scheme)
+
+	spec := shared.StackSpec{
+		Stack:  "dev",
+		Config: map[string]string{"aws:region": "us-east-1"},
+		GitSource: &shared.GitSource{
+			ProjectRepo: "https://github.com/pulumi/examples",
+			Commit:      "abc123",
+		},
+	}
+
+	for _, test := range []struct {
+		name   string
+		update func(*shared.StackSpec)
+	}{
+		{
+			name:   "source changed",
+			update: func(s *shared.StackSpec) { s.GitSource.Commit = "def456" },
+		},
+		{
+			name:   "options changed",
+			update: func(s *shared.StackSpec) { s.Refresh = true },
+		},
+		{
+			name:   "branch tracked",
+			update: func(s *shared.StackSpec) { s.GitSource.Commit, s.GitSource.Branch = "", "main" },
+		},
+		{
+			name:   "config key removed",
+			update: func(s *shared.StackSpec) { s.Config = nil },
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			rootDir := t.TempDir()
+			sess := newReconcileStackSession(logger, *spec.DeepCopy(), client, namespace)
+			sess.rootDir = rootDir
+			_, err := sess.MakeWorkspaceDir()
+			require.NoError(t, err)
+			sess.workdir = sess.getWorkspaceDir()
+			require.NoError(t, sess.SaveWorkspaceCache("abc123"))
+			require.DirExists(t, sess.getWorkspaceCacheDir())
+
+			updated := *spec.DeepCopy()
+			test.update(&updated)
+			sess = newReconcileStackSession(logger, updated, client, namespace)
+			sess.rootDir = rootDir
+			revision, err := sess.SetupWorkdirFromCache(context.TODO())
+			require.NoError(t, err)
+			assert.Empty(t, revision)
+			assert.False(t, sess.reusedWorkspace)
+
+			// the cache is dropped once it's been considered
+			_, err = os.Stat(sess.getWorkspaceCacheRecordPath())
+			assert.True(t, os.IsNotExist(err))
+		})
+	}
+}
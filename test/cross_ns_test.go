@@ -90,6 +90,7 @@ var _ = Describe("Cross-namespace refs", func() {
 		waitForStackFailure(&stack)
 		Expect(apimeta.IsStatusConditionTrue(stack.Status.Conditions, pulumiv1.StalledCondition)).To(BeTrue())
 		Expect(apimeta.IsStatusConditionTrue(stack.Status.Conditions, pulumiv1.ReadyCondition)).To(BeFalse())
+		expectAbandoned(&stack)
 	})
 
 	When("namespace isolation is waived", func() {
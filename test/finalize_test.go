@@ -0,0 +1,93 @@
+// Copyright 2024, Pulumi Corporation.  All rights reserved.
+
+package tests
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pulumi/pulumi-kubernetes-operator/pkg/apis/pulumi/shared"
+	pulumiv1 "github.com/pulumi/pulumi-kubernetes-operator/pkg/apis/pulumi/v1"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Stack finalization", func() {
+	var (
+		tmpDir             string
+		gitDir, backendDir string
+		kubeconfig         string
+		stack              pulumiv1.Stack
+	)
+
+	BeforeEach(func() {
+		var err error
+		tmpDir, err = os.MkdirTemp("", "pulumi-test")
+		Expect(err).ToNot(HaveOccurred())
+
+		gitDir = filepath.Join(tmpDir, "repo")
+		backendDir = filepath.Join(tmpDir, "state")
+		Expect(os.Mkdir(backendDir, 0777)).To(Succeed())
+		kubeconfig = writeKubeconfig(tmpDir)
+		Expect(makeFixtureIntoRepo(gitDir, "testdata/success")).To(Succeed())
+
+		stack = pulumiv1.Stack{
+			Spec: shared.StackSpec{
+				Stack:   "test",
+				Backend: fmt.Sprintf("file://%s", backendDir),
+				GitSource: &shared.GitSource{
+					ProjectRepo: gitDir,
+					RepoDir:     "testdata/success",
+					Branch:      "default",
+				},
+				EnvRefs: map[string]shared.ResourceRef{
+					"PULUMI_CONFIG_PASSPHRASE": shared.NewLiteralResourceRef("password"),
+					"KUBECONFIG":               shared.NewLiteralResourceRef(kubeconfig),
+				},
+				DestroyOnFinalize: true,
+			},
+		}
+		stack.Namespace = "default"
+	})
+
+	AfterEach(func() {
+		if strings.HasPrefix(tmpDir, os.TempDir()) {
+			os.RemoveAll(tmpDir)
+		}
+	})
+
+	// stackStateExists reports whether the backend has state for the stack; it's removed when the
+	// stack is destroyed.
+	stackStateExists := func() bool {
+		matches, err := filepath.Glob(filepath.Join(backendDir, ".pulumi", "stacks", "*", "test.json"))
+		Expect(err).ToNot(HaveOccurred())
+		legacy, err := filepath.Glob(filepath.Join(backendDir, ".pulumi", "stacks", "test.json"))
+		Expect(err).ToNot(HaveOccurred())
+		return len(matches)+len(legacy) > 0
+	}
+
+	It("should destroy the stack when it is deleted", func() {
+		stack.Name = "destroyonfinalize-" + randString()
+		Expect(k8sClient.Create(context.TODO(), &stack)).To(Succeed())
+		waitForStackSuccess(&stack)
+		Expect(stackStateExists()).To(BeTrue())
+
+		deleteAndWaitForFinalization(&stack)
+		Expect(stackStateExists()).To(BeFalse())
+	})
+
+	It("should refresh and then destroy the stack when it is deleted, if refreshBeforeDestroy is set", func() {
+		stack.Name = "refreshbeforedestroy-" + randString()
+		stack.Spec.RefreshBeforeDestroy = true
+		Expect(k8sClient.Create(context.TODO(), &stack)).To(Succeed())
+		waitForStackSuccess(&stack)
+		Expect(stackStateExists()).To(BeTrue())
+
+		deleteAndWaitForFinalization(&stack)
+		Expect(stackStateExists()).To(BeFalse())
+	})
+})
@@ -171,6 +171,20 @@ var _ = Describe("Flux source integration", func() {
 		It("is marked as failed and stalled", func() {
 			waitForStackFailure(stack)
 			expectStalled(stack.Status.Conditions)
+			expectAbandoned(stack)
+		})
+
+		When("the source is in another namespace", func() {
+			BeforeEach(func() {
+				stack.Name = "other-namespace-source"
+				stack.Spec.FluxSource.SourceRef.Namespace = "flux-system"
+			})
+
+			It("is marked as stalled, since namespace isolation is in effect", func() {
+				waitForStackFailure(stack)
+				expectStalledWithReason(stack.Status.Conditions, pulumiv1.StalledCrossNamespaceRefForbiddenReason)
+				expectAbandoned(stack)
+			})
 		})
 
 		When("the source is an unknown group/kind", func() {
@@ -28,6 +28,7 @@ func checkInvalidSpecStalls(when string, setup func(stack *pulumiv1.Stack)) {
 			// wait until the controller has seen the stack object and completed processing it
 			waitForStackFailure(&stack)
 			expectStalledWithReason(stack.Status.Conditions, pulumiv1.StalledSpecInvalidReason)
+			expectAbandoned(&stack)
 		})
 
 		AfterEach(func() {
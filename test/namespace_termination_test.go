@@ -0,0 +1,132 @@
+// Copyright 2024, Pulumi Corporation.  All rights reserved.
+
+package tests
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/pulumi/pulumi-kubernetes-operator/pkg/apis/pulumi/shared"
+	pulumiv1 "github.com/pulumi/pulumi-kubernetes-operator/pkg/apis/pulumi/v1"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Stacks in a namespace being deleted", func() {
+	var (
+		tmpDir             string
+		gitDir, backendDir string
+		kubeconfig         string
+		ns                 corev1.Namespace
+	)
+
+	BeforeEach(func() {
+		var err error
+		tmpDir, err = os.MkdirTemp("", "pulumi-test")
+		Expect(err).ToNot(HaveOccurred())
+
+		gitDir = filepath.Join(tmpDir, "repo")
+		backendDir = filepath.Join(tmpDir, "state")
+		Expect(os.Mkdir(backendDir, 0777)).To(Succeed())
+		kubeconfig = writeKubeconfig(tmpDir)
+		Expect(makeFixtureIntoRepo(gitDir, "testdata/success")).To(Succeed())
+
+		ns = corev1.Namespace{}
+		ns.Name = "terminating-" + randString()
+		Expect(k8sClient.Create(context.TODO(), &ns)).To(Succeed())
+	})
+
+	AfterEach(func() {
+		if strings.HasPrefix(tmpDir, os.TempDir()) {
+			os.RemoveAll(tmpDir)
+		}
+	})
+
+	newStack := func(name string, destroy bool) *pulumiv1.Stack {
+		stack := &pulumiv1.Stack{
+			Spec: shared.StackSpec{
+				Stack:   name,
+				Backend: fmt.Sprintf("file://%s", backendDir),
+				GitSource: &shared.GitSource{
+					ProjectRepo: gitDir,
+					RepoDir:     "testdata/success",
+					Branch:      "default",
+				},
+				EnvRefs: map[string]shared.ResourceRef{
+					"PULUMI_CONFIG_PASSPHRASE": shared.NewLiteralResourceRef("password"),
+					"KUBECONFIG":               shared.NewLiteralResourceRef(kubeconfig),
+				},
+				DestroyOnFinalize: destroy,
+			},
+		}
+		stack.Name = name
+		stack.Namespace = ns.Name
+		return stack
+	}
+
+	// stackStateExists reports whether the backend has state for the stack; it's removed when the
+	// stack is destroyed.
+	stackStateExists := func(name string) bool {
+		matches, err := filepath.Glob(filepath.Join(backendDir, ".pulumi", "stacks", "*", name+".json"))
+		Expect(err).ToNot(HaveOccurred())
+		legacy, err := filepath.Glob(filepath.Join(backendDir, ".pulumi", "stacks", name+".json"))
+		Expect(err).ToNot(HaveOccurred())
+		return len(matches)+len(legacy) > 0
+	}
+
+	It("should finalize every stack promptly, destroying those it can", func() {
+		// a stack to be destroyed, and another to be destroyed which has it as a prerequisite
+		network := newStack("network", true)
+		app := newStack("app", true)
+		app.Spec.Prerequisites = []shared.PrerequisiteRef{{Name: "network"}}
+		// a stack to be left in place
+		orphan := newStack("orphan", false)
+		// a stack to be destroyed, but which needs a Secret the namespace controller removes
+		secret := &corev1.Secret{StringData: map[string]string{"passphrase": "password"}}
+		secret.Name = "passphrase"
+		secret.Namespace = ns.Name
+		Expect(k8sClient.Create(context.TODO(), secret)).To(Succeed())
+		needsSecret := newStack("needs-secret", true)
+		needsSecret.Spec.EnvRefs["PULUMI_CONFIG_PASSPHRASE"] = shared.NewSecretResourceRef("", "passphrase", "passphrase")
+
+		stacks := []*pulumiv1.Stack{network, app, orphan, needsSecret}
+		for _, stack := range stacks {
+			Expect(k8sClient.Create(context.TODO(), stack)).To(Succeed())
+		}
+		for _, stack := range stacks {
+			waitForStackSuccess(stack)
+			Expect(stackStateExists(stack.Spec.Stack)).To(BeTrue())
+		}
+
+		// The test environment has no namespace controller, so the namespace is left terminating;
+		// what the namespace controller would do -- delete everything in the namespace at once --
+		// is done here.
+		Expect(k8sClient.Delete(context.TODO(), &ns)).To(Succeed())
+		Expect(k8sClient.Delete(context.TODO(), secret)).To(Succeed())
+		Eventually(func() bool {
+			err := k8sClient.Get(context.TODO(), client.ObjectKeyFromObject(secret), &corev1.Secret{})
+			return apierrors.IsNotFound(err)
+		}, "10s", "1s").Should(BeTrue(), "the operator sees the Secret is gone")
+		for _, stack := range stacks {
+			Expect(client.IgnoreNotFound(k8sClient.Delete(context.TODO(), stack))).To(Succeed())
+		}
+		Eventually(func() int {
+			var remaining pulumiv1.StackList
+			Expect(k8sClient.List(context.TODO(), &remaining, client.InNamespace(ns.Name))).To(Succeed())
+			return len(remaining.Items)
+		}, "3m", "5s").Should(BeZero(), "all stacks are finalized")
+
+		Expect(stackStateExists("network")).To(BeFalse(), "network is destroyed")
+		Expect(stackStateExists("app")).To(BeFalse(), "app is destroyed, without waiting for its prerequisite")
+		Expect(stackStateExists("orphan")).To(BeTrue(), "orphan is left in place")
+		Expect(stackStateExists("needs-secret")).To(BeTrue(), "needs-secret can't be destroyed without its Secret, so is left in place")
+	})
+})
@@ -0,0 +1,101 @@
+// Copyright 2024, Pulumi Corporation.  All rights reserved.
+
+package tests
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pulumi/pulumi-kubernetes-operator/pkg/apis/pulumi/shared"
+	pulumiv1 "github.com/pulumi/pulumi-kubernetes-operator/pkg/apis/pulumi/v1"
+	corev1 "k8s.io/api/core/v1"
+	apimeta "k8s.io/apimachinery/pkg/api/meta"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Stack with a program from a ConfigMap", func() {
+	var (
+		tmpDir     string
+		backendDir string
+		kubeconfig string
+		programCM  corev1.ConfigMap
+		stack      pulumiv1.Stack
+	)
+
+	BeforeEach(func() {
+		var err error
+		tmpDir, err = os.MkdirTemp("", "pulumi-test")
+		Expect(err).ToNot(HaveOccurred())
+		backendDir = filepath.Join(tmpDir, "state")
+		Expect(os.Mkdir(backendDir, 0777)).To(Succeed())
+		kubeconfig = writeKubeconfig(tmpDir)
+
+		project, err := os.ReadFile(filepath.Join("testdata", "success", "Pulumi.yaml"))
+		Expect(err).ToNot(HaveOccurred())
+		programCM = corev1.ConfigMap{Data: map[string]string{"Pulumi.yaml": string(project)}}
+		programCM.Name = "program-" + randString()
+		programCM.Namespace = "default"
+
+		stack = pulumiv1.Stack{
+			Spec: shared.StackSpec{
+				Stack:   "test",
+				Backend: fmt.Sprintf("file://%s", backendDir),
+				ProgramFrom: &shared.ProgramFromSource{
+					ConfigMap: &shared.ProgramConfigMapReference{Name: programCM.Name},
+				},
+				EnvRefs: map[string]shared.ResourceRef{
+					"PULUMI_CONFIG_PASSPHRASE": shared.NewLiteralResourceRef("password"),
+					"KUBECONFIG":               shared.NewLiteralResourceRef(kubeconfig),
+				},
+				ResyncFrequencySeconds: 3600, // make sure it doesn't run again unless there's another reason to
+			},
+		}
+		stack.Name = "programfrom-" + randString()
+		stack.Namespace = "default"
+	})
+
+	AfterEach(func() {
+		deleteAndWaitForFinalization(&stack)
+		Expect(k8sClient.Delete(context.TODO(), &programCM)).To(Succeed())
+		if strings.HasPrefix(tmpDir, os.TempDir()) {
+			os.RemoveAll(tmpDir)
+		}
+	})
+
+	It("runs the project in the ConfigMap, and again when the ConfigMap is changed", func() {
+		Expect(k8sClient.Create(context.TODO(), &programCM)).To(Succeed())
+		Expect(k8sClient.Create(context.TODO(), &stack)).To(Succeed())
+		waitForStackSuccess(&stack)
+		Expect(stack.Status.LastUpdate.LastSuccessfulCommit).To(Equal(programCM.Name + "/" + programCM.ResourceVersion))
+
+		resetWaitForStack()
+		programCM.Data["Pulumi.yaml"] = strings.Replace(programCM.Data["Pulumi.yaml"], "foo: bar", "foo: baz", 1)
+		Expect(k8sClient.Update(context.TODO(), &programCM)).To(Succeed())
+		Eventually(func() string {
+			refetch(&stack)
+			if stack.Status.LastUpdate == nil {
+				return ""
+			}
+			return stack.Status.LastUpdate.LastSuccessfulCommit
+		}, "2m", "2s").Should(Equal(programCM.Name + "/" + programCM.ResourceVersion))
+	})
+
+	It("waits for the ConfigMap to be created", func() {
+		Expect(k8sClient.Create(context.TODO(), &stack)).To(Succeed())
+		Eventually(func() string {
+			refetch(&stack)
+			if c := apimeta.FindStatusCondition(stack.Status.Conditions, pulumiv1.ReconcilingCondition); c != nil {
+				return c.Reason
+			}
+			return ""
+		}, "20s", "1s").Should(Equal(pulumiv1.ReconcilingWaitingForReferencesReason))
+
+		Expect(k8sClient.Create(context.TODO(), &programCM)).To(Succeed())
+		waitForStackSuccess(&stack)
+	})
+})
@@ -172,6 +172,7 @@ var _ = Describe("Creating a YAML program", func() {
 
 			waitForStackFailure(&stack)
 			expectStalledWithReason(stack.Status.Conditions, pulumiv1.StalledSourceUnavailableReason)
+			expectAbandoned(&stack)
 		})
 
 		It("should fail if given a syntactically correct but invalid program.", func() {
@@ -106,7 +106,7 @@ var _ = Describe("go build caching", func() {
 
 		It("doesn't grow the Go build cache", func() {
 			// run it again and check that we get the same result from du -sh <cache>
-			stack.Spec.ResyncFrequencySeconds = 30 // just to provoke reprocessing
+			stack.Spec.ResyncFrequencySeconds = 120 // just to provoke reprocessing
 			resetWaitForStack()
 			Expect(k8sClient.Update(context.TODO(), stack)).To(Succeed())
 			waitForStackSuccess(stack, "90s")
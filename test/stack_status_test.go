@@ -101,6 +101,7 @@ var _ = Describe("Stack controller status", func() {
 
 		waitForStackFailure(&stack)
 		expectStalled(stack.Status.Conditions)
+		expectAbandoned(&stack)
 	})
 
 	It("should mark a stack as reconciling while it's being processed", func() {
@@ -175,4 +176,46 @@ var _ = Describe("Stack controller status", func() {
 		}, "20s", "1s").Should(BeTrue())
 		expectInProgress(s.Status.Conditions)
 	})
+
+	It("should not process a paused stack until it is resumed", func() {
+		Expect(makeFixtureIntoRepo(gitDir, "testdata/success")).To(Succeed())
+
+		stack = pulumiv1.Stack{
+			Spec: shared.StackSpec{
+				Stack:   "test",
+				Backend: fmt.Sprintf("file://%s", backendDir),
+				GitSource: &shared.GitSource{
+					ProjectRepo: gitDir,
+					RepoDir:     "testdata/success",
+					Branch:      "default",
+				},
+				EnvRefs: map[string]shared.ResourceRef{
+					"PULUMI_CONFIG_PASSPHRASE": shared.NewLiteralResourceRef("password"),
+					"KUBECONFIG":               shared.NewLiteralResourceRef(kubeconfig),
+				},
+				Paused: true,
+			},
+		}
+		stack.Name = "testpaused"
+		stack.Namespace = "default"
+
+		Expect(k8sClient.Create(context.TODO(), &stack)).To(Succeed())
+
+		// wait until the controller has seen the stack object, and check it wasn't run
+		Eventually(func() bool {
+			refetch(&stack)
+			return stack.Generation != 0 && stack.Status.ObservedGeneration == stack.Generation
+		}, "20s", "1s").Should(BeTrue())
+		reconciling := apimeta.FindStatusCondition(stack.Status.Conditions, pulumiv1.ReconcilingCondition)
+		Expect(reconciling).ToNot(BeNil())
+		Expect(reconciling.Status).To(BeEquivalentTo("False"))
+		Expect(reconciling.Reason).To(Equal(pulumiv1.ReconcilingPausedReason))
+		Expect(stack.Status.LastUpdate).To(BeNil())
+
+		// resuming the stack runs it straight away
+		stack.Spec.Paused = false
+		Expect(k8sClient.Update(context.TODO(), &stack)).To(Succeed())
+		waitForStackSuccess(&stack)
+		expectReady(stack.Status.Conditions)
+	})
 })
@@ -244,6 +244,17 @@ func expectStalledWithReason(conditions []metav1.Condition, reason string) {
 	ExpectWithOffset(1, apimeta.FindStatusCondition(conditions, pulumiv1.ReconcilingCondition)).To(BeNil(), "Reconciling condition is absent")
 }
 
+// expectAbandoned checks that the operator has given up on the stack, in the single way every
+// give-up path is reported.
+func expectAbandoned(stack *pulumiv1.Stack) {
+	readyCondition := apimeta.FindStatusCondition(stack.Status.Conditions, pulumiv1.ReadyCondition)
+	ExpectWithOffset(1, readyCondition).ToNot(BeNil(), "Ready condition is present")
+	ExpectWithOffset(1, readyCondition.Status).To(Equal(metav1.ConditionFalse), "Ready condition is false")
+	ExpectWithOffset(1, readyCondition.Reason).To(Equal(pulumiv1.NotReadyAbandonedReason), "Ready reason is ReconciliationAbandoned")
+	ExpectWithOffset(1, stack.Status.Abandoned).ToNot(BeNil(), "abandonment is recorded in the status")
+	ExpectWithOffset(1, stack.Status.Abandoned.Generation).To(Equal(stack.Generation), "abandonment records the generation")
+}
+
 func expectInProgress(conditions []metav1.Condition) {
 	ExpectWithOffset(1, apimeta.IsStatusConditionTrue(conditions, pulumiv1.ReconcilingCondition)).To(BeTrue(), "Reconciling condition is true")
 	ExpectWithOffset(1, apimeta.IsStatusConditionTrue(conditions, pulumiv1.ReadyCondition)).To(BeFalse(), "Ready condition is false")